@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/pguia/iam/internal/openapi"
+)
+
+const usage = `usage: openapi [flags] PROTO
+
+Writes the OpenAPI v3 document of the services and messages of a protobuf file, describing their
+gRPC-JSON mapping.
+
+flags:
+  -o FILE    write the document to FILE instead of stdout
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		slog.Error("Generating the OpenAPI document failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	output := flags.String("o", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one protobuf file, got %d arguments", flags.NArg())
+	}
+
+	proto, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	document, err := openapi.Generate(proto)
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(document)
+		return err
+	}
+	return os.WriteFile(*output, document, 0o644)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/ldap"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/opa"
+	"github.com/pguia/iam/internal/replay"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/service"
+)
+
+const usage = `usage: replay [flags]
+
+Replays recorded permission checks against the environment of the configuration (config.yaml and
+IAM_* variables, e.g. IAM_DATABASE_HOST) and reports the checks decided differently and the
+latency change. Checks are evaluated without a cache and without the condition context, which the
+decision log does not record.
+
+flags:
+  -input FILE            decision log written by the file sink, or "-" for stdin; without it,
+                         the newest -limit entries of the decision_logs table are replayed
+  -limit N               entries read from the decision_logs table (default 10000)
+  -backend native|opa    evaluator to replay against (default evaluator.backend); the OPA server
+                         at evaluator.opa.url must already hold the policy
+  -read-model            answer native checks from the evaluation read model
+  -concurrency N         checks evaluated at once (default 4)
+  -diffs FILE            write each check decided differently, or failed, as a JSON line
+  -fail-on-diff          exit with status 2 when a check is decided differently
+`
+
+// errDiverged is returned by run with -fail-on-diff when checks were decided differently
+var errDiverged = errors.New("checks were decided differently than recorded")
+
+func main() {
+	err := run(os.Args[1:])
+	switch {
+	case errors.Is(err, errDiverged):
+		os.Exit(2)
+	case err != nil:
+		slog.Error("Replay failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	input := flags.String("input", "", "")
+	limit := flags.Int("limit", 10000, "")
+	backend := flags.String("backend", "", "")
+	readModel := flags.Bool("read-model", false, "")
+	concurrency := flags.Int("concurrency", 4, "")
+	diffsFile := flags.String("diffs", "", "")
+	failOnDiff := flags.Bool("fail-on-diff", false, "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("replay takes no arguments")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *backend == "" {
+		*backend = cfg.Evaluator.Backend
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	db, err := database.New(&cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	entries, err := readEntries(*input, db, *limit)
+	if err != nil {
+		return err
+	}
+
+	evaluator, err := newEvaluator(cfg, db, *backend, *readModel, logger)
+	if err != nil {
+		return err
+	}
+
+	opts := replay.Options{Concurrency: *concurrency}
+	if *diffsFile != "" {
+		f, err := os.Create(*diffsFile)
+		if err != nil {
+			return fmt.Errorf("failed to create diffs file: %w", err)
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		opts.OnDiff = func(diff replay.Diff) {
+			if err := enc.Encode(&diff); err != nil {
+				logger.Warn("Failed to write diff", "error", err)
+			}
+		}
+	}
+
+	logger.Info("Replaying decision log", "entries", len(entries), "backend", *backend, "read_model", *readModel)
+	start := time.Now()
+	report := replay.Replay(entries, evaluator, opts)
+	logger.Info("Replay finished", "duration", time.Since(start))
+
+	if err := replay.WriteReport(os.Stdout, report); err != nil {
+		return err
+	}
+	if *failOnDiff && report.Diverged() > 0 {
+		return errDiverged
+	}
+	return nil
+}
+
+// readEntries reads the decision log file at path, or the newest limit entries of the
+// decision_logs table when path is empty
+func readEntries(path string, db *database.Database, limit int) ([]domain.DecisionLog, error) {
+	if path == "" {
+		entries, err := repository.NewDecisionLogRepository(db.DB).List("", nil, limit, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read decision log: %w", err)
+		}
+		return entries, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open decision log: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	entries, err := replay.ReadEntries(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decision log: %w", err)
+	}
+	return entries, nil
+}
+
+// newEvaluator creates the evaluator of backend as the server does, with the principal aliases,
+// directory groups and LDAP groups of the configuration, but without a cache
+func newEvaluator(cfg *config.Config, db *database.Database, backend string, readModel bool, logger *slog.Logger) (service.PermissionEvaluator, error) {
+	cache := service.NewNoopCache()
+	reader := repository.WithReader(db.Reader())
+	closure := repository.WithClosureTable(cfg.Resource.ClosureTable)
+
+	opts := []service.EvaluatorOption{
+		service.WithAliasResolver(repository.NewPrincipalAliasRepository(db.DB, reader)),
+		service.WithGroupResolver(service.NewDirectoryService(
+			repository.NewUserRepository(db.DB),
+			repository.NewGroupRepository(db.DB, reader),
+			cache,
+		)),
+	}
+	if cfg.LDAP.Enabled {
+		resolver, err := ldap.NewResolver(&cfg.LDAP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize ldap group resolver: %w", err)
+		}
+		opts = append(opts, service.WithGroupResolver(service.NewCachedGroupResolver(
+			"ldap",
+			resolver,
+			time.Duration(cfg.LDAP.CacheTTLSeconds)*time.Second,
+			time.Duration(cfg.LDAP.TimeoutSeconds)*time.Second,
+			cfg.LDAP.CacheSize,
+			logger,
+		)))
+	}
+
+	resources := repository.NewResourceRepositoryWithMaxDepth(db.DB, cfg.Resource.MaxDepth, reader, closure)
+	policies := repository.NewPolicyRepository(db.DB, reader)
+	permissions := repository.NewPermissionRepository(db.DB, reader)
+	switch backend {
+	case "native", "":
+		if readModel {
+			opts = append(opts, service.WithEvaluationGrants(repository.NewEvaluationGrantRepository(db.DB, reader)))
+		}
+		return service.NewPermissionEvaluator(resources, policies, permissions, cache, opts...), nil
+	case "opa":
+		engine, err := opa.NewClient(&cfg.Evaluator.OPA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize opa evaluator: %w", err)
+		}
+		return service.NewOPAEvaluator(resources, policies, permissions, cache, engine, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown evaluator backend: %s (valid: native, opa)", backend)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/service"
+)
+
+const importBindingsUsage = `usage: iam-server import-bindings [flags] FILE
+
+Grants the rows of a CSV file of resource path, role name and member ("-" reads stdin), e.g.
+when migrating from a legacy system:
+
+  resource,role,member
+  acme/web,roles/viewer,user:alice@example.com
+
+Resource paths are the names of the resources from a root, separated by "/". The header row is
+optional. Rows already granted are skipped, so the file can be imported again once the rows
+that failed are fixed. The rows that failed are written as CSV with their line and error.
+
+flags:
+  -batch-size N   rows of a resource granted in one transaction (default 500)
+  -dry-run        validate every row without granting any
+  -report FILE    write the rows that failed to FILE instead of stdout
+`
+
+// runImportBindings implements the "import-bindings" subcommand
+func runImportBindings(args []string) error {
+	flags := flag.NewFlagSet("import-bindings", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, importBindingsUsage) }
+	batchSize := flags.Int("batch-size", service.DefaultBindingImportBatchSize, "")
+	dryRun := flags.Bool("dry-run", false, "")
+	reportFile := flags.String("report", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, importBindingsUsage)
+		return fmt.Errorf("import-bindings takes exactly one file")
+	}
+
+	var input io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open bindings file: %w", err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	db, err := database.New(&cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	// Imported bindings must invalidate decisions cached by running servers sharing the cache
+	cacheService, err := service.NewCache(&cfg.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	if closer, ok := cacheService.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	iamService := service.NewIAMService(
+		repository.NewResourceRepositoryWithMaxDepth(db.DB, cfg.Resource.MaxDepth),
+		repository.NewPermissionRepository(db.DB),
+		repository.NewRoleRepository(db.DB),
+		repository.NewPolicyRepository(db.DB),
+		repository.NewBindingRepository(db.DB),
+		repository.NewPolicyRevisionRepository(db.DB),
+		repository.NewConditionRepository(db.DB),
+		nil,
+		cacheService,
+	)
+	policyLimits, err := service.NewPolicyLimitSet(&cfg.PolicyLimits)
+	if err != nil {
+		return fmt.Errorf("failed to initialize policy limits: %w", err)
+	}
+	iamService.SetPolicyLimits(policyLimits)
+
+	report, err := iamService.ImportBindingsCSV(input, service.BindingImportOptions{BatchSize: *batchSize, DryRun: *dryRun})
+	if err != nil {
+		return fmt.Errorf("failed to import bindings: %w", err)
+	}
+
+	var output io.Writer = os.Stdout
+	if *reportFile != "" {
+		f, err := os.Create(*reportFile)
+		if err != nil {
+			return fmt.Errorf("failed to create report file: %w", err)
+		}
+		defer f.Close()
+		output = f
+	}
+	if err := writeImportErrors(output, report.Errors); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	logger.Info("Bindings imported", "rows", report.Rows, "imported", report.Imported,
+		"unchanged", report.Unchanged, "failed", len(report.Errors), "dry_run", *dryRun)
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d rows were not imported", len(report.Errors), report.Rows)
+	}
+	return nil
+}
+
+// writeImportErrors writes the rows that failed as CSV, with their line and error
+func writeImportErrors(w io.Writer, failed []service.BindingImportError) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"line", "resource", "role", "member", "error"}); err != nil {
+		return err
+	}
+	for _, row := range failed {
+		if err := out.Write([]string{strconv.Itoa(row.Line), row.ResourcePath, row.Role, row.Member, row.Error}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -1,25 +1,65 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/pguia/iam/internal/config"
 	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/ldap"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/oidc"
+	"github.com/pguia/iam/internal/opa"
 	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/scim"
 	"github.com/pguia/iam/internal/service"
+	"github.com/pguia/iam/internal/tlsconfig"
+	"github.com/pguia/iam/internal/version"
 )
 
 // App holds all application components
 type App struct {
-	Config              *config.Config
+	Config              *config.Config // Configuration loaded at startup
+	ConfigStore         *config.Store  // Active configuration, including settings reloaded on SIGHUP
+	Logger              *slog.Logger
+	LogLevel            *slog.LevelVar
 	Database            *database.Database
 	IAMService          *service.IAMService
 	PermissionEvaluator service.PermissionEvaluator
+	AdminAuthorizer     service.AdminAuthorizer
 	CacheService        service.CacheService
+	CacheWarmer         *service.CacheWarmer
+	DecisionLogger      *service.DecisionLogger
+	DeprecationTracker  *service.DeprecationTracker // Counts checks of deprecated permissions
+	EvaluationStats     *service.EvaluationStats    // nil unless evaluator.stats.enabled
+	ShadowEvaluator     *service.ShadowEvaluator    // nil unless evaluator.shadow.enabled
+	PolicyWatcher       *service.PolicyWatcher      // Streams policy changes to WatchPolicies clients
+	OperationRunner     *service.OperationRunner
+	PolicyScanner       *service.PolicyScanner      // nil unless policy_scan.interval_minutes is set
+	IntegrityScanner    *service.IntegrityScanner   // nil unless integrity.interval_minutes is set
+	Purger              *service.Purger             // nil unless retention.purge_interval_minutes is set
+	AccessReviewCloser  *service.AccessReviewCloser // nil unless access_review.close_interval_minutes is set
+	WriterElection      *database.WriterElection    // nil unless replication.mode is single-writer
+	Idempotency         *service.Idempotency        // Deduplicates retried create requests; nil when idempotency.ttl_hours is 0
+	DirectoryService    *service.DirectoryService
+	SCIMServer          *http.Server // nil unless scim.enabled
+	ServerTLS           *tls.Config  // Credentials of the gRPC server; nil unless server.tls.enabled
+
+	// Servers are drained first on shutdown
+	Servers []GracefulServer
+
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
 // InitializeApp initializes all application components
@@ -30,16 +70,30 @@ func InitializeApp() (*App, error) {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Initialize logging; the default logger also receives output of the standard log package
+	logger, logLevel, err := logging.NewLeveled(&cfg.Log, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	build := version.Get()
+	logger.Info("Starting IAM service", "version", build.Version, "commit", build.GitCommit, "api_version", build.APIVersion)
+
 	// Initialize database
-	db, err := database.New(&cfg.Database)
+	db, err := database.New(&cfg.Database, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
 	// Run migrations
-	if err := db.AutoMigrate(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	if cfg.Database.AutoMigrate {
+		if err := db.Migrate(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	} else {
+		logger.Info("Auto-migration disabled; run \"migrate up\" to apply schema changes")
 	}
 
 	// Test database connection
@@ -48,14 +102,20 @@ func InitializeApp() (*App, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connection established successfully")
+	logger.Info("Database connection established successfully")
+	if err := repository.CheckMembersIndex(db.DB); err != nil {
+		logger.Warn("Listing the bindings of a principal will scan every binding; run \"migrate up\" to create the index", "error", err)
+	}
 
 	// Initialize repositories
-	resourceRepo := repository.NewResourceRepository(db.DB)
+	closure := repository.WithClosureTable(cfg.Resource.ClosureTable)
+	resourceRepo := repository.NewResourceRepositoryWithMaxDepth(db.DB, cfg.Resource.MaxDepth, closure)
 	permissionRepo := repository.NewPermissionRepository(db.DB)
 	roleRepo := repository.NewRoleRepository(db.DB)
 	policyRepo := repository.NewPolicyRepository(db.DB)
 	bindingRepo := repository.NewBindingRepository(db.DB)
+	revisionRepo := repository.NewPolicyRevisionRepository(db.DB)
+	conditionRepo := repository.NewConditionRepository(db.DB)
 
 	// Initialize services
 	cacheService, err := service.NewCache(&cfg.Cache)
@@ -63,14 +123,182 @@ func InitializeApp() (*App, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize cache: %w", err)
 	}
-	log.Printf("Cache initialized: type=%s, enabled=%v", cfg.Cache.Type, cfg.Cache.Enabled)
+	logger.Info("Cache initialized", "type", cfg.Cache.Type, "enabled", cfg.Cache.Enabled)
 
-	permissionEvaluator := service.NewPermissionEvaluator(
-		resourceRepo,
-		policyRepo,
-		permissionRepo,
+	// Permission checks are read-only and served by the read replica when configured.
+	// The admin APIs keep reading from the primary so etag/version checks see their own writes.
+	reader := repository.WithReader(db.Reader())
+
+	// Users inherit the bindings of the groups provisioned for them
+	directoryService := service.NewDirectoryService(
+		repository.NewUserRepository(db.DB),
+		repository.NewGroupRepository(db.DB, reader),
 		cacheService,
 	)
+	// Bindings to an identity apply to the identities linked to it as principal aliases
+	principalAliases := repository.NewPrincipalAliasRepository(db.DB, reader)
+	evaluatorOpts := []service.EvaluatorOption{
+		service.WithAliasResolver(principalAliases),
+		service.WithGroupResolver(directoryService),
+		// Fully consistent checks read the resources and policies of the primary
+		service.WithPrimaryReads(resourceRepo, policyRepo),
+	}
+	if cfg.LDAP.Enabled {
+		ldapResolver, err := ldapGroupResolver(&cfg.LDAP, logger)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		evaluatorOpts = append(evaluatorOpts, service.WithGroupResolver(ldapResolver))
+	}
+	var tokenVerifier *oidc.Verifier
+	if cfg.OIDC.Enabled {
+		tokenVerifier, err = oidc.NewVerifier(&cfg.OIDC)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize oidc verifier: %w", err)
+		}
+		logger.Info("ID token principals enabled", "issuer", cfg.OIDC.IssuerURL, "groups_claim", cfg.OIDC.GroupsClaim)
+	}
+	evaluatorResources := repository.NewResourceRepositoryWithMaxDepth(db.DB, cfg.Resource.MaxDepth, reader, closure)
+	evaluatorPolicies := repository.NewPolicyRepository(db.DB, reader)
+	evaluatorPermissions := repository.NewPermissionRepository(db.DB, reader)
+	newEvaluator := func(backend string, readModel bool, cache service.CacheService) (service.PermissionEvaluator, error) {
+		switch backend {
+		case "native", "":
+			nativeOpts := evaluatorOpts
+			if readModel {
+				grants := repository.NewEvaluationGrantRepository(db.DB, reader)
+				nativeOpts = append(nativeOpts[:len(nativeOpts):len(nativeOpts)], service.WithEvaluationGrants(grants))
+			}
+			return service.NewPermissionEvaluator(
+				evaluatorResources,
+				evaluatorPolicies,
+				evaluatorPermissions,
+				cache,
+				nativeOpts...,
+			), nil
+		case "opa":
+			engine, err := opaEngine(&cfg.Evaluator.OPA)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize opa evaluator: %w", err)
+			}
+			return service.NewOPAEvaluator(
+				evaluatorResources,
+				evaluatorPolicies,
+				evaluatorPermissions,
+				cache,
+				engine,
+				evaluatorOpts...,
+			), nil
+		default:
+			return nil, fmt.Errorf("unknown evaluator backend: %s (valid: native, opa)", backend)
+		}
+	}
+	permissionEvaluator, err := newEvaluator(cfg.Evaluator.Backend, cfg.Evaluator.ReadModel, cacheService)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	switch {
+	case cfg.Evaluator.Backend == "opa":
+		logger.Info("Permission checks evaluated by OPA", "url", cfg.Evaluator.OPA.URL)
+	case cfg.Evaluator.ReadModel:
+		logger.Info("Permission checks answered from the evaluation read model")
+	}
+
+	// The shadow evaluator has no cache, so it never serves nor stores the decisions of the
+	// primary evaluator. It sits below the limits, which only apply to the decisions served.
+	var shadowEvaluator *service.ShadowEvaluator
+	if cfg.Evaluator.Shadow.Enabled {
+		shadow, err := newEvaluator(cfg.Evaluator.Shadow.Backend, cfg.Evaluator.Shadow.ReadModel, service.NewNoopCache())
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize shadow evaluator: %w", err)
+		}
+		shadowEvaluator = service.NewShadowEvaluator(permissionEvaluator, shadow, &cfg.Evaluator.Shadow, logger)
+		permissionEvaluator = shadowEvaluator
+		logger.Info("Shadow evaluation enabled",
+			"backend", cfg.Evaluator.Shadow.Backend,
+			"read_model", cfg.Evaluator.Shadow.ReadModel,
+			"sample_rate", cfg.Evaluator.Shadow.SampleRate,
+		)
+	}
+	permissionEvaluator, err = service.NewGuardedEvaluator(permissionEvaluator, &cfg.Evaluator, logger)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize evaluator limits: %w", err)
+	}
+	if cfg.Evaluator.TimeoutMS > 0 || cfg.Evaluator.MaxInFlight > 0 || cfg.Evaluator.CircuitBreaker.Enabled {
+		logger.Info("Permission evaluation limits configured",
+			"timeout_ms", cfg.Evaluator.TimeoutMS,
+			"max_in_flight", cfg.Evaluator.MaxInFlight,
+			"failure_mode", cfg.Evaluator.FailureMode,
+			"circuit_breaker", cfg.Evaluator.CircuitBreaker.Enabled,
+		)
+	}
+
+	// Admin API checks never fail open; failure_mode only applies to data-plane checks
+	adminEvaluator := service.FailClosed(permissionEvaluator)
+
+	// Cache warm-up uses the plain evaluator so its own checks are not counted as hot pairs
+	var checkTracker *service.CheckTracker
+	if cfg.Cache.Warmup.TopPairs > 0 {
+		checkTracker = service.NewCheckTracker(service.DefaultMaxTrackedPairs)
+	}
+	cacheWarmer, err := service.NewCacheWarmer(&cfg.Cache.Warmup, permissionEvaluator, checkTracker, logger)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache warmer: %w", err)
+	}
+
+	// Decision hooks only run around data-plane checks
+	decisionHooks, err := service.NewDecisionHooks(cfg.Evaluator.Hooks)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize decision hooks: %w", err)
+	}
+	permissionEvaluator = service.NewHookedEvaluator(permissionEvaluator, decisionHooks...)
+	if len(decisionHooks) > 0 {
+		logger.Info("Decision hooks configured", "hooks", len(decisionHooks))
+	}
+
+	if checkTracker != nil {
+		permissionEvaluator = service.NewTrackingEvaluator(permissionEvaluator, checkTracker)
+	}
+
+	// Checks of deprecated permissions still succeed but are logged until roles are migrated
+	deprecationTracker := service.NewDeprecationTracker(permissionRepo, service.DefaultDeprecationRefresh, logger)
+	permissionEvaluator = service.NewDeprecationEvaluator(permissionEvaluator, deprecationTracker)
+	adminEvaluator = service.NewDeprecationEvaluator(adminEvaluator, deprecationTracker)
+
+	// Only data-plane checks are counted; admin API authorization is not a client's traffic
+	var evaluationStats *service.EvaluationStats
+	if cfg.Evaluator.Stats.Enabled {
+		evaluationStats = service.NewEvaluationStats(time.Duration(cfg.Evaluator.Stats.WindowSeconds)*time.Second, cfg.Evaluator.Stats.MaxTracked)
+		permissionEvaluator = service.NewStatsEvaluator(permissionEvaluator, evaluationStats)
+		logger.Info("Evaluation statistics enabled", "window_seconds", cfg.Evaluator.Stats.WindowSeconds)
+	}
+
+	var decisionLogger *service.DecisionLogger
+	if cfg.DecisionLog.Enabled {
+		sink, err := service.NewDecisionSink(&cfg.DecisionLog, repository.NewDecisionLogRepository(db.DB))
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize decision log: %w", err)
+		}
+		decisionLogger = service.NewDecisionLogger(&cfg.DecisionLog, sink, logger)
+		permissionEvaluator = service.NewDecisionLoggingEvaluator(permissionEvaluator, decisionLogger)
+		adminEvaluator = service.NewDecisionLoggingEvaluator(adminEvaluator, decisionLogger)
+		logger.Info("Decision log enabled", "sink", cfg.DecisionLog.Sink, "sample_rate", cfg.DecisionLog.SampleRate)
+	}
+
+	adminAuthorizer, err := service.NewAdminAuthorizer(&cfg.Authz, adminEvaluator)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize admin authorizer: %w", err)
+	}
+	logger.Info("Admin API authorization configured", "enabled", cfg.Authz.Enabled, "root_principals", len(cfg.Authz.RootPrincipals))
 
 	// Initialize IAM service
 	iamService := service.NewIAMService(
@@ -79,57 +307,377 @@ func InitializeApp() (*App, error) {
 		roleRepo,
 		policyRepo,
 		bindingRepo,
+		revisionRepo,
+		conditionRepo,
 		permissionEvaluator,
 		cacheService,
 	)
+	operationRunner := service.NewOperationRunner(&cfg.Operations, repository.NewOperationRepository(db.DB), logger)
+	if failed, err := operationRunner.FailInterrupted(); err != nil {
+		logger.Warn("Failed to mark interrupted operations", "error", err)
+	} else if failed > 0 {
+		logger.Warn("Marked operations interrupted by a restart as failed", "count", failed)
+	}
+	iamService.SetOperationRunner(operationRunner)
+	iamService.SetAdminAuthorizer(adminAuthorizer)
+	if tokenVerifier != nil {
+		iamService.SetTokenVerifier(tokenVerifier)
+	}
+	iamService.SetGrantConstraints(repository.NewGrantConstraintRepository(db.DB, reader))
+	iamService.SetAccessRequests(repository.NewAccessRequestRepository(db.DB, reader))
+	iamService.SetAccessReviews(repository.NewAccessReviewRepository(db.DB, reader))
+	iamService.SetPrincipalAliases(principalAliases)
+	iamService.SetEvaluationGrants(repository.NewEvaluationGrantRepository(db.DB, reader))
+	iamService.SetIntegrityChecks(repository.NewIntegrityRepository(db.DB), cfg.Integrity.CheckGroups)
+	if evaluationStats != nil {
+		iamService.SetEvaluationStats(evaluationStats)
+	}
+	iamService.SetDatabaseStats(db.PoolStats)
+
+	if cfg.DecisionLog.Enabled && cfg.DecisionLog.Sink == "db" {
+		iamService.SetAccessAnalysis(
+			repository.NewDecisionLogRepository(db.DB, reader),
+			repository.NewAccessRecommendationRepository(db.DB, reader),
+		)
+	}
+
+	iamService.SetRequireImpactAcknowledgment(cfg.Role.RequireImpactAcknowledgment)
+	iamService.SetRetention(time.Duration(cfg.Retention.Days) * 24 * time.Hour)
+
+	if len(cfg.Resource.AttachmentRules) > 0 {
+		iamService.SetAttachmentRules(attachmentRules(cfg.Resource.AttachmentRules))
+		logger.Info("Role attachment rules configured", "roles", len(cfg.Resource.AttachmentRules))
+	}
+	if len(cfg.Resource.DefaultBindings) > 0 {
+		iamService.SetDefaultBindings(defaultBindings(cfg.Resource.DefaultBindings))
+		logger.Info("Default bindings of new resources configured", "bindings", len(cfg.Resource.DefaultBindings))
+	}
+
+	policyLimits, err := service.NewPolicyLimitSet(&cfg.PolicyLimits)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize policy limits: %w", err)
+	}
+	iamService.SetPolicyLimits(policyLimits)
+
+	policyWatcher := service.NewPolicyWatcher(service.DefaultPolicyWatchBuffer)
+	iamService.SetPolicyWatcher(policyWatcher)
 
-	log.Printf("IAM service initialized successfully")
+	logger.Info("IAM service initialized successfully")
+
+	var serverTLS *tls.Config
+	if cfg.Server.TLS.Enabled {
+		serverTLS, err = tlsconfig.Server(&cfg.Server.TLS)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize server tls: %w", err)
+		}
+		logger.Info("Server TLS configured", "client_auth", serverTLS.ClientAuth.String(), "min_version", cfg.Server.TLS.MinVersion)
+	}
+
+	var scimServer *http.Server
+	var servers []GracefulServer
+	if cfg.SCIM.Enabled {
+		scimServer = &http.Server{
+			Addr:    cfg.SCIM.Address,
+			Handler: scim.NewHandler(directoryService, cfg.SCIM.Token, logger),
+		}
+		servers = append(servers, httpServer{scimServer})
+	}
+
+	var writerElection *database.WriterElection
+	if cfg.Replication.Mode == "single-writer" {
+		interval := time.Duration(cfg.Replication.ElectionIntervalSeconds) * time.Second
+		writerElection, err = db.NewWriterElection(cfg.Replication.Region, interval)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize writer election: %w", err)
+		}
+		writerElection.Start()
+		logger.Info("Single-writer mode enabled", "region", cfg.Replication.Region, "writer", writerElection.Writer())
+	}
+
+	var policyScanner *service.PolicyScanner
+	if cfg.PolicyScan.IntervalMinutes > 0 {
+		interval := time.Duration(cfg.PolicyScan.IntervalMinutes) * time.Minute
+		policyScanner = service.NewPolicyScanner(iamService, interval, logger)
+		policyScanner.Start()
+		logger.Info("Policy scanner started", "interval", interval)
+	}
+
+	var integrityScanner *service.IntegrityScanner
+	if cfg.Integrity.IntervalMinutes > 0 {
+		interval := time.Duration(cfg.Integrity.IntervalMinutes) * time.Minute
+		integrityScanner = service.NewIntegrityScanner(iamService, interval, logger)
+		integrityScanner.Start()
+		logger.Info("Integrity scanner started", "interval", interval, "check_groups", cfg.Integrity.CheckGroups)
+	}
+
+	var idempotency *service.Idempotency
+	if cfg.Idempotency.TTLHours > 0 {
+		ttl := time.Duration(cfg.Idempotency.TTLHours) * time.Hour
+		idempotency = service.NewIdempotency(repository.NewIdempotencyRepository(db.DB), ttl, logger)
+		idempotency.Start()
+		logger.Info("Idempotency keys enabled", "ttl", ttl)
+	}
+
+	var purger *service.Purger
+	if cfg.Retention.PurgeIntervalMinutes > 0 {
+		interval := time.Duration(cfg.Retention.PurgeIntervalMinutes) * time.Minute
+		purger = service.NewPurger(iamService, interval, logger)
+		purger.Start()
+		logger.Info("Purge of deleted rows started", "interval", interval, "retention_days", cfg.Retention.Days)
+	}
+
+	var accessReviewCloser *service.AccessReviewCloser
+	if cfg.AccessReview.CloseIntervalMinutes > 0 {
+		interval := time.Duration(cfg.AccessReview.CloseIntervalMinutes) * time.Minute
+		accessReviewCloser = service.NewAccessReviewCloser(iamService, interval, logger)
+		accessReviewCloser.Start()
+		logger.Info("Access review closer started", "interval", interval)
+	}
+
+	if cfg.Cache.Enabled && cfg.Cache.Warmup.Enabled {
+		cacheWarmer.WarmAsync(nil)
+		logger.Info("Cache warm-up started",
+			"principals", len(cfg.Cache.Warmup.Principals),
+			"resources", len(cfg.Cache.Warmup.Resources),
+			"top_pairs", cfg.Cache.Warmup.TopPairs)
+	}
 
 	return &App{
 		Config:              cfg,
+		ConfigStore:         config.NewStore(cfg),
+		Logger:              logger,
+		LogLevel:            logLevel,
 		Database:            db,
 		IAMService:          iamService,
 		PermissionEvaluator: permissionEvaluator,
+		AdminAuthorizer:     adminAuthorizer,
 		CacheService:        cacheService,
+		CacheWarmer:         cacheWarmer,
+		DecisionLogger:      decisionLogger,
+		DeprecationTracker:  deprecationTracker,
+		EvaluationStats:     evaluationStats,
+		ShadowEvaluator:     shadowEvaluator,
+		PolicyWatcher:       policyWatcher,
+		OperationRunner:     operationRunner,
+		PolicyScanner:       policyScanner,
+		IntegrityScanner:    integrityScanner,
+		Purger:              purger,
+		AccessReviewCloser:  accessReviewCloser,
+		WriterElection:      writerElection,
+		Idempotency:         idempotency,
+		DirectoryService:    directoryService,
+		SCIMServer:          scimServer,
+		ServerTLS:           serverTLS,
+		Servers:             servers,
 	}, nil
 }
 
-// Close cleans up application resources
+// Close cleans up application resources, allowing the configured shutdown grace period
 func (app *App) Close() error {
-	log.Println("Closing application resources...")
-	if app.Database != nil {
-		return app.Database.Close()
-	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout())
+	defer cancel()
+	return app.Shutdown(ctx)
 }
 
 // Run starts the application and waits for shutdown signal
 func Run(app *App) error {
 	// TODO: Create gRPC server and register IAM service
 	// This will be implemented after proto files are generated
-	log.Printf("IAM service would be listening on %s", app.Config.Server.Address)
-	log.Println("Note: gRPC server implementation pending proto file generation")
+	logger := app.logger()
+	// The server will be created with grpc.Creds(credentials.NewTLS(app.ServerTLS)) when TLS is enabled,
+	// and its interceptors will serve each call from app.IAMService.WithRequestMetadata of
+	// service.RequestMetadataFromHeaders(peer, metadata, app.Config.Server.TrustedCallerServices)
+	logger.Info("IAM service would be listening", "address", app.Config.Server.Address,
+		"api_versions", version.SupportedAPIVersions, "reflection", app.Config.Server.Reflection,
+		"tls", app.ServerTLS != nil)
+	logger.Info("Note: gRPC server implementation pending proto file generation")
+
+	if app.SCIMServer != nil {
+		go func() {
+			logger.Info("SCIM endpoint listening", "address", app.SCIMServer.Addr, "path", scim.BasePath)
+			if err := app.SCIMServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("SCIM server failed", "error", err)
+			}
+		}()
+	}
 
 	// For now, just keep the service running
-	log.Println("IAM service is ready (core services initialized)")
+	logger.Info("IAM service is ready (core services initialized)")
+
+	// Reload the configuration on SIGHUP until an interrupt signal arrives
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			if err := app.Reload(config.Load); err != nil {
+				logger.Error("Configuration reload failed; keeping the active configuration", "error", err)
+			}
+		case <-ctx.Done():
+			logger.Info("Shutting down server", "grace_period", app.shutdownTimeout())
+			return app.Close()
+		}
+	}
+}
+
+// logger returns the application logger, falling back to the default logger for partially built apps
+func (app *App) logger() *slog.Logger {
+	if app.Logger != nil {
+		return app.Logger
+	}
+	return slog.Default()
+}
+
+// opaEngine connects to the OPA server and uploads the built-in Rego policy,
+// or the module read from cfg.PolicyFile
+func opaEngine(cfg *config.OPAConfig) (*opa.Client, error) {
+	client, err := opa.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	module := service.DefaultRegoPolicy
+	if cfg.PolicyFile != "" {
+		data, err := os.ReadFile(cfg.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file: %w", err)
+		}
+		module = string(data)
+	}
 
-	log.Println("Shutting down server...")
-	return nil
+	if err := client.PutPolicy(context.Background(), service.RegoPolicyID, module); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// ldapGroupResolver connects the cached LDAP group resolver
+func ldapGroupResolver(cfg *config.LDAPConfig, logger *slog.Logger) (service.GroupResolver, error) {
+	resolver, err := ldap.NewResolver(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ldap group resolver: %w", err)
+	}
+	logger.Info("LDAP group resolution enabled", "url", cfg.URL, "base_dn", cfg.BaseDN)
+	return service.NewCachedGroupResolver(
+		"ldap",
+		resolver,
+		time.Duration(cfg.CacheTTLSeconds)*time.Second,
+		time.Duration(cfg.TimeoutSeconds)*time.Second,
+		cfg.CacheSize,
+		logger,
+	), nil
+}
+
+// attachmentRules converts the configured attachment rules, merging rules repeated for the same role
+func attachmentRules(rules []config.AttachmentRule) service.AttachmentRules {
+	result := make(service.AttachmentRules, len(rules))
+	for _, rule := range rules {
+		result[rule.Role] = append(result[rule.Role], rule.ResourceTypes...)
+	}
+	return result
+}
+
+// defaultBindings groups the configured default bindings by resource type
+func defaultBindings(bindings []config.DefaultBinding) service.DefaultBindings {
+	result := make(service.DefaultBindings, len(bindings))
+	for _, binding := range bindings {
+		result[binding.ResourceType] = append(result[binding.ResourceType], service.DefaultBinding{
+			Role:    binding.Role,
+			Members: binding.Members,
+		})
+	}
+	return result
+}
+
+// printVersion writes the build information as JSON
+func printVersion(w io.Writer) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(version.Get())
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export-tuples" {
+		if err := runExportTuples(os.Args[2:]); err != nil {
+			fatal("Export failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		if err := runSeed(os.Args[2:]); err != nil {
+			fatal("Seeding failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import-bindings" {
+		if err := runImportBindings(os.Args[2:]); err != nil {
+			fatal("Binding import failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "gcp-policy" {
+		if err := runGCPPolicy(os.Args[2:]); err != nil {
+			fatal("GCP policy conversion failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import-aws-policy" {
+		if err := runImportAWSPolicy(os.Args[2:]); err != nil {
+			fatal("AWS policy import failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rewrite-aliases" {
+		if err := runRewriteAliases(os.Args[2:]); err != nil {
+			fatal("Alias rewrite failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "sidecar" {
+		if err := runSidecar(os.Args[2:]); err != nil {
+			fatal("Sidecar failed", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		printVersion(os.Stdout)
+		return
+	}
+
 	app, err := InitializeApp()
 	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+		fatal("Failed to initialize application", err)
 	}
 	defer app.Close()
 
 	if err := Run(app); err != nil {
-		log.Fatalf("Application error: %v", err)
+		fatal("Application error", err)
 	}
 }
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/service"
+	"github.com/pguia/iam/internal/testharness/testenv"
+	"github.com/pguia/iam/internal/version"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -24,6 +32,7 @@ func TestInitializeApp_Success(t *testing.T) {
 	assert.NotNil(t, app.IAMService)
 	assert.NotNil(t, app.PermissionEvaluator)
 	assert.NotNil(t, app.CacheService)
+	assert.NotNil(t, app.CacheWarmer)
 
 	// Verify configuration was loaded
 	assert.Equal(t, "localhost", app.Config.Database.Host)
@@ -168,7 +177,9 @@ func TestApp_RepositoriesIntegration(t *testing.T) {
 		"bucket",
 		"test-bucket",
 		nil,
-		map[string]string{"region": "us-east-1"},
+		map[string]interface{}{"region": "us-east-1"},
+		nil,
+		"",
 	)
 	require.NoError(t, err)
 	assert.NotNil(t, resource)
@@ -186,6 +197,7 @@ func TestApp_RepositoriesIntegration(t *testing.T) {
 		"Storage Objects Admin",
 		"Full access to storage objects",
 		[]uuid.UUID{perm1.ID, perm2.ID},
+		nil,
 	)
 	require.NoError(t, err)
 	assert.NotNil(t, role)
@@ -204,7 +216,7 @@ func TestApp_PermissionEvaluator(t *testing.T) {
 	assert.NotNil(t, app.PermissionEvaluator)
 
 	// Create test data
-	resource, err := app.IAMService.CreateResource("project", "test-project", nil, nil)
+	resource, err := app.IAMService.CreateResource("project", "test-project", nil, nil, nil, "")
 	require.NoError(t, err)
 
 	// Check permission (should be denied since no policy exists)
@@ -256,6 +268,23 @@ func TestApp_DatabaseMigrations(t *testing.T) {
 		"policies",
 		"bindings",
 		"conditions",
+		"policy_revisions",
+		"schema_migrations",
+		"decision_logs",
+		"resource_closure",
+		"operations",
+		"users",
+		"groups",
+		"group_members",
+		"access_recommendations",
+		"grant_constraints",
+		"resource_tags",
+		"idempotency_keys",
+		"access_requests",
+		"access_reviews",
+		"access_review_items",
+		"evaluation_grants",
+		"principal_aliases",
 	}
 
 	for _, tableName := range expectedTables {
@@ -270,23 +299,98 @@ func TestApp_DatabaseMigrations(t *testing.T) {
 	}
 }
 
+func TestRunMigrate_InvalidArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "Missing command", args: nil},
+		{name: "Unknown command", args: []string{"sideways"}},
+		{name: "Up with arguments", args: []string{"up", "1"}},
+		{name: "Down with bad steps", args: []string{"down", "zero"}},
+		{name: "Down with negative steps", args: []string{"down", "-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, runMigrate(tt.args))
+		})
+	}
+}
+
+func TestRunImportBindings_InvalidArguments(t *testing.T) {
+	assert.Error(t, runImportBindings(nil))
+	assert.Error(t, runImportBindings([]string{"a.csv", "b.csv"}))
+	assert.Error(t, runImportBindings([]string{"-batch-size", "many", "a.csv"}))
+	assert.ErrorContains(t, runImportBindings([]string{filepath.Join(t.TempDir(), "missing.csv")}), "failed to open bindings file")
+}
+
+func TestRunGCPPolicy_InvalidArguments(t *testing.T) {
+	resourceID := uuid.NewString()
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	assert.Error(t, runGCPPolicy(nil))
+	assert.Error(t, runGCPPolicy([]string{"convert", resourceID}))
+	assert.Error(t, runGCPPolicy([]string{"export"}))
+	assert.Error(t, runGCPPolicy([]string{"import", resourceID}))
+	assert.ErrorContains(t, runGCPPolicy([]string{"export", "project-123"}), "invalid resource id")
+	assert.ErrorContains(t, runGCPPolicy([]string{"import", resourceID, missing}), "failed to open gcp policy")
+	assert.ErrorContains(t, runGCPPolicy([]string{"export", "-role-map", missing, resourceID}), "failed to open role mappings")
+}
+
+func TestRunImportAWSPolicy_InvalidArguments(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	assert.Error(t, runImportAWSPolicy(nil))
+	assert.Error(t, runImportAWSPolicy([]string{"-members", "group:sre@example.com", "s3-readers", missing}))
+	assert.Error(t, runImportAWSPolicy([]string{"-mapping", missing, "s3-readers", missing}))
+	assert.ErrorContains(t, runImportAWSPolicy([]string{"-mapping", missing, "-members", "group:sre@example.com", "s3-readers", missing}),
+		"failed to open aws policy mapping")
+}
+
+func TestWriteImportErrors(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, writeImportErrors(&out, []service.BindingImportError{{
+		BindingImportRow: service.BindingImportRow{Line: 3, ResourcePath: "acme/web", Role: "roles/nope", Member: "user:alice@example.com"},
+		Error:            `role "roles/nope" not found`,
+	}}))
+	assert.Equal(t, "line,resource,role,member,error\n3,acme/web,roles/nope,user:alice@example.com,\"role \"\"roles/nope\"\" not found\"\n", out.String())
+}
+
+func TestRunSidecar_Configuration(t *testing.T) {
+	assert.Error(t, runSidecar([]string{"extra"}))
+
+	t.Setenv("IAM_SIDECAR_UPSTREAM", "")
+	t.Setenv("IAM_SIDECAR_ROOT_RESOURCE_ID", "")
+	err := runSidecar(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sidecar.upstream")
+
+	t.Setenv("IAM_SIDECAR_UPSTREAM", "iam.internal:8081")
+	t.Setenv("IAM_SIDECAR_ROOT_RESOURCE_ID", uuid.NewString())
+	err = runSidecar(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pending proto file generation")
+}
+
+func TestRunMigrate_UpAndStatus(t *testing.T) {
+	setupTestEnv(t)
+
+	require.NoError(t, runMigrate([]string{"up"}))
+	require.NoError(t, runMigrate([]string{"status"}))
+}
+
 // Helper function to set up test environment
 func setupTestEnv(t *testing.T) {
 	// Clear environment variables
 	clearEnvVars()
 
-	// Set test database configuration
-	host := os.Getenv("TEST_DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
-	os.Setenv("IAM_DATABASE_HOST", host)
-	os.Setenv("IAM_DATABASE_PORT", "5432")
-	os.Setenv("IAM_DATABASE_USER", "postgres")
-	os.Setenv("IAM_DATABASE_PASSWORD", "postgres")
-	os.Setenv("IAM_DATABASE_DBNAME", "iam_db")
-	os.Setenv("IAM_DATABASE_SSLMODE", "disable")
+	// Set test database configuration (see testenv)
+	db := testenv.PostgresServer(t)
+	os.Setenv("IAM_DATABASE_HOST", db.Host)
+	os.Setenv("IAM_DATABASE_PORT", strconv.Itoa(db.Port))
+	os.Setenv("IAM_DATABASE_USER", db.User)
+	os.Setenv("IAM_DATABASE_PASSWORD", db.Password)
+	os.Setenv("IAM_DATABASE_DBNAME", db.DBName)
+	os.Setenv("IAM_DATABASE_SSLMODE", db.SSLMode)
 	os.Setenv("IAM_CACHE_TYPE", "none")
 	os.Setenv("IAM_CACHE_ENABLED", "false")
 
@@ -320,3 +424,13 @@ func clearEnvVars() {
 		os.Unsetenv(envVar)
 	}
 }
+
+func TestPrintVersion(t *testing.T) {
+	var buf bytes.Buffer
+	printVersion(&buf)
+
+	var info version.Info
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &info))
+	assert.Equal(t, version.Version, info.Version)
+	assert.Equal(t, "iam.v1", info.APIVersion)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/logging"
+)
+
+const migrateUsage = `usage: iam-server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  status      list migrations and whether they are applied
+`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("missing migrate command")
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			return fmt.Errorf("migrate %s takes no arguments", args[0])
+		}
+	case "down":
+		if len(args) > 2 {
+			return fmt.Errorf("migrate down takes at most one argument")
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	db, err := database.New(&cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		return db.Migrate()
+	case "down":
+		return db.MigrateDown(steps)
+	default:
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(os.Stdout, statuses)
+		return nil
+	}
+}
+
+func printMigrationStatus(w io.Writer, statuses []database.MigrationStatus) {
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied " + status.AppliedAt.Format("2006-01-02T15:04:05Z07:00")
+		}
+		fmt.Fprintf(w, "%04d_%s\t%s\n", status.Version, status.Name, state)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/service"
+)
+
+// Reload loads the configuration with load and applies the settings that can change
+// without a restart (see config.MergeReloadable). The new values are validated first;
+// on error nothing is applied. Changes to other settings are logged and ignored.
+func (app *App) Reload(load func() (*config.Config, error)) error {
+	loaded, err := load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := validateReloadable(loaded); err != nil {
+		return err
+	}
+
+	current := app.activeConfig()
+	next, ignored := config.MergeReloadable(current, loaded)
+
+	if app.LogLevel != nil {
+		level, _ := logging.ParseLevel(next.Log.Level)
+		app.LogLevel.Set(level)
+	}
+	if cache, ok := app.CacheService.(service.TTLSetter); ok {
+		ttl := next.Cache.TTLSeconds
+		if next.Cache.Type == "redis" {
+			ttl = next.Cache.Redis.TTLSeconds
+		}
+		cache.SetTTL(time.Duration(ttl) * time.Second)
+	}
+	if app.DecisionLogger != nil {
+		app.DecisionLogger.SetSampleRate(next.DecisionLog.SampleRate)
+	}
+
+	if app.ConfigStore == nil {
+		app.ConfigStore = config.NewStore(next)
+	} else {
+		app.ConfigStore.Swap(next)
+	}
+
+	logger := app.logger()
+	logger.Info("Configuration reloaded",
+		"log_level", next.Log.Level,
+		"cache_ttl_seconds", next.Cache.TTLSeconds,
+		"redis_ttl_seconds", next.Cache.Redis.TTLSeconds,
+		"decision_log_sample_rate", next.DecisionLog.SampleRate)
+	if len(ignored) > 0 {
+		logger.Warn("Configuration changes require a restart and were not applied", "sections", ignored)
+	}
+	return nil
+}
+
+// activeConfig returns the active configuration, falling back to the startup configuration
+func (app *App) activeConfig() *config.Config {
+	if app.ConfigStore != nil {
+		return app.ConfigStore.Get()
+	}
+	if app.Config != nil {
+		return app.Config
+	}
+	return &config.Config{}
+}
+
+// validateReloadable checks the settings applied by Reload
+func validateReloadable(cfg *config.Config) error {
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		return fmt.Errorf("invalid log.level: %w", err)
+	}
+	if cfg.Cache.TTLSeconds <= 0 {
+		return fmt.Errorf("invalid cache.ttl_seconds %d: must be positive", cfg.Cache.TTLSeconds)
+	}
+	if cfg.Cache.Redis.TTLSeconds <= 0 {
+		return fmt.Errorf("invalid cache.redis.ttl_seconds %d: must be positive", cfg.Cache.Redis.TTLSeconds)
+	}
+	if cfg.DecisionLog.SampleRate < 0 || cfg.DecisionLog.SampleRate > 1 {
+		return fmt.Errorf("invalid decision_log.sample_rate %v: must be between 0 and 1", cfg.DecisionLog.SampleRate)
+	}
+	return nil
+}
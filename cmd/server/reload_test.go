@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ttlCache records the TTL set on reload
+type ttlCache struct {
+	service.CacheService
+	ttl time.Duration
+}
+
+func (c *ttlCache) SetTTL(ttl time.Duration) {
+	c.ttl = ttl
+}
+
+func reloadTestConfig() *config.Config {
+	return &config.Config{
+		Database:    config.DatabaseConfig{Host: "db-1"},
+		Cache:       config.CacheConfig{Type: "memory", TTLSeconds: 300, Redis: config.RedisCacheConfig{TTLSeconds: 300}},
+		Log:         config.LogConfig{Level: "info", Format: "json"},
+		DecisionLog: config.DecisionLogConfig{SampleRate: 1},
+	}
+}
+
+func TestApp_Reload(t *testing.T) {
+	startup := reloadTestConfig()
+	level := new(slog.LevelVar)
+	cache := &ttlCache{CacheService: service.NewNoopCache()}
+	app := &App{
+		Config:       startup,
+		ConfigStore:  config.NewStore(startup),
+		LogLevel:     level,
+		CacheService: cache,
+	}
+
+	loaded := reloadTestConfig()
+	loaded.Log.Level = "debug"
+	loaded.Cache.TTLSeconds = 60
+	loaded.Database.Host = "db-2" // Needs a restart; ignored
+
+	require.NoError(t, app.Reload(func() (*config.Config, error) { return loaded, nil }))
+
+	assert.Equal(t, slog.LevelDebug, level.Level())
+	assert.Equal(t, time.Minute, cache.ttl)
+	active := app.ConfigStore.Get()
+	assert.Equal(t, "debug", active.Log.Level)
+	assert.Equal(t, 60, active.Cache.TTLSeconds)
+	assert.Equal(t, "db-1", active.Database.Host)
+
+	// The startup configuration is left untouched
+	assert.Equal(t, "info", app.Config.Log.Level)
+}
+
+func TestApp_Reload_Invalid(t *testing.T) {
+	startup := reloadTestConfig()
+	level := new(slog.LevelVar)
+	app := &App{Config: startup, ConfigStore: config.NewStore(startup), LogLevel: level}
+
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+	}{
+		{"log level", func(c *config.Config) { c.Log.Level = "verbose" }},
+		{"cache ttl", func(c *config.Config) { c.Cache.TTLSeconds = 0 }},
+		{"redis ttl", func(c *config.Config) { c.Cache.Redis.TTLSeconds = -1 }},
+		{"sample rate", func(c *config.Config) { c.DecisionLog.SampleRate = 1.5 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := reloadTestConfig()
+			loaded.Log.Level = "debug"
+			tt.modify(loaded)
+
+			err := app.Reload(func() (*config.Config, error) { return loaded, nil })
+			assert.Error(t, err)
+			assert.Same(t, startup, app.ConfigStore.Get())
+			assert.Equal(t, slog.LevelInfo, level.Level())
+		})
+	}
+
+	err := app.Reload(func() (*config.Config, error) { return nil, errors.New("bad yaml") })
+	assert.ErrorContains(t, err, "failed to load config")
+}
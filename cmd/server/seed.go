@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/service"
+)
+
+const seedUsage = `usage: iam-server seed FILE
+
+Imports the permissions, roles, resources and bindings declared in a YAML file ("-" reads
+stdin). Objects are created or updated to match the file, so it can be applied repeatedly.
+See examples/seed/seed.yaml.
+`
+
+// runSeed implements the "seed" subcommand
+func runSeed(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, seedUsage)
+		return fmt.Errorf("seed takes exactly one file")
+	}
+
+	// Reject invalid files before connecting to the database
+	file, err := readSeedFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	db, err := database.New(&cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	// Seeded bindings must invalidate decisions cached by running servers sharing the cache
+	cacheService, err := service.NewCache(&cfg.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	if closer, ok := cacheService.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	iamService := service.NewIAMService(
+		repository.NewResourceRepositoryWithMaxDepth(db.DB, cfg.Resource.MaxDepth),
+		repository.NewPermissionRepository(db.DB),
+		repository.NewRoleRepository(db.DB),
+		repository.NewPolicyRepository(db.DB),
+		repository.NewBindingRepository(db.DB),
+		repository.NewPolicyRevisionRepository(db.DB),
+		repository.NewConditionRepository(db.DB),
+		nil,
+		cacheService,
+	)
+	if len(cfg.Resource.AttachmentRules) > 0 {
+		iamService.SetAttachmentRules(attachmentRules(cfg.Resource.AttachmentRules))
+	}
+	policyLimits, err := service.NewPolicyLimitSet(&cfg.PolicyLimits)
+	if err != nil {
+		return fmt.Errorf("failed to initialize policy limits: %w", err)
+	}
+	iamService.SetPolicyLimits(policyLimits)
+
+	result, err := iamService.ApplySeed(file)
+	if err != nil {
+		return fmt.Errorf("failed to apply seed file: %w", err)
+	}
+
+	logger.Info("Seed file applied",
+		"permissions_created", result.Permissions.Created,
+		"permissions_updated", result.Permissions.Updated,
+		"permissions_deprecated", len(result.DeprecatedPermissions),
+		"roles_created", result.Roles.Created,
+		"roles_updated", result.Roles.Updated,
+		"resources_created", result.Resources.Created,
+		"resources_updated", result.Resources.Updated,
+		"policies_created", result.Policies.Created,
+		"policies_updated", result.Policies.Updated)
+	for _, name := range result.DeprecatedPermissions {
+		logger.Warn("Permission missing from the seed file deprecated", "permission", name)
+	}
+	return nil
+}
+
+// readSeedFile parses the seed file at path, or stdin if path is "-"
+func readSeedFile(path string) (*service.SeedFile, error) {
+	if path == "-" {
+		return service.ParseSeedFile(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open seed file: %w", err)
+	}
+	defer f.Close()
+	return service.ParseSeedFile(f)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultShutdownTimeout is used when no configuration is loaded
+const defaultShutdownTimeout = 30 * time.Second
+
+// GracefulServer is a server that can stop accepting requests and drain in-flight ones,
+// such as *grpc.Server
+type GracefulServer interface {
+	// GracefulStop stops accepting new requests and blocks until in-flight ones finish
+	GracefulStop()
+	// Stop closes all connections immediately, cancelling in-flight requests
+	Stop()
+}
+
+// httpServer adapts *http.Server, e.g. the SCIM endpoint, to GracefulServer
+type httpServer struct {
+	*http.Server
+}
+
+func (s httpServer) GracefulStop() {
+	s.Shutdown(context.Background())
+}
+
+func (s httpServer) Stop() {
+	s.Close()
+}
+
+// Shutdown stops the application in dependency order:
+//  1. servers stop accepting requests and drain in-flight ones
+//  2. background cache warm-ups, shadow checks and policy scans stop and running long-running operations finish,
+//     after which a single-writer deployment hands the writer lock over
+//  3. the decision log is flushed while the database is still open
+//  4. the cache (e.g. the Redis client) and the database are closed
+//
+// Servers still draining and operations still running when ctx expires are stopped forcibly. Shutdown runs once;
+// later calls return the result of the first.
+func (app *App) Shutdown(ctx context.Context) error {
+	app.shutdownOnce.Do(func() {
+		app.shutdownErr = app.shutdown(ctx)
+	})
+	return app.shutdownErr
+}
+
+func (app *App) shutdown(ctx context.Context) error {
+	logger := app.logger()
+	logger.Info("Closing application resources")
+
+	var errs []error
+
+	for _, srv := range app.Servers {
+		if !drain(ctx, srv) {
+			logger.Warn("Shutdown grace period expired; cancelled in-flight requests")
+		}
+	}
+
+	if app.CacheWarmer != nil {
+		if err := app.CacheWarmer.Stop(ctx); err != nil {
+			logger.Warn("Cache warm-up still running at shutdown", "error", err)
+		}
+	}
+
+	if app.ShadowEvaluator != nil {
+		if err := app.ShadowEvaluator.Stop(ctx); err != nil {
+			logger.Warn("Shadow checks still running at shutdown", "error", err)
+		}
+		stats := app.ShadowEvaluator.Stats()
+		logger.Info("Shadow evaluation summary",
+			"checks", stats.Checks,
+			"divergences", stats.Divergences,
+			"errors", stats.Errors,
+			"skipped", stats.Skipped,
+		)
+	}
+
+	if app.PolicyScanner != nil {
+		if err := app.PolicyScanner.Stop(ctx); err != nil {
+			logger.Warn("Policy scan still running at shutdown", "error", err)
+		}
+	}
+
+	if app.IntegrityScanner != nil {
+		if err := app.IntegrityScanner.Stop(ctx); err != nil {
+			logger.Warn("Integrity scan still running at shutdown", "error", err)
+		}
+	}
+
+	if app.Idempotency != nil {
+		if err := app.Idempotency.Stop(ctx); err != nil {
+			logger.Warn("Idempotency key cleanup still running at shutdown", "error", err)
+		}
+	}
+
+	if app.Purger != nil {
+		if err := app.Purger.Stop(ctx); err != nil {
+			logger.Warn("Purge of deleted rows still running at shutdown", "error", err)
+		}
+	}
+
+	if app.AccessReviewCloser != nil {
+		if err := app.AccessReviewCloser.Stop(ctx); err != nil {
+			logger.Warn("Closing of due access reviews still running at shutdown", "error", err)
+		}
+	}
+
+	if app.OperationRunner != nil {
+		if err := app.OperationRunner.Stop(ctx); err != nil {
+			logger.Warn("Cancelled long-running operations at shutdown", "error", err)
+		}
+	}
+
+	if app.WriterElection != nil {
+		// No more writes are made, so another region can take over without waiting for the session to time out
+		if err := app.WriterElection.Stop(ctx); err != nil {
+			logger.Warn("Writer election still running at shutdown", "error", err)
+		}
+	}
+
+	if app.DecisionLogger != nil {
+		// Flush buffered decisions while the database is still open
+		if err := app.DecisionLogger.Close(); err != nil {
+			logger.Error("Failed to close decision log", "error", err)
+			errs = append(errs, fmt.Errorf("failed to close decision log: %w", err))
+		}
+	}
+
+	if closer, ok := app.CacheService.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Error("Failed to close cache", "error", err)
+			errs = append(errs, fmt.Errorf("failed to close cache: %w", err))
+		}
+	}
+
+	if app.Database != nil {
+		if err := app.Database.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// drain gracefully stops srv, forcing it to stop once ctx expires.
+// It reports whether all in-flight requests finished in time.
+func drain(ctx context.Context, srv GracefulServer) bool {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		srv.Stop()
+		<-done
+		return false
+	}
+}
+
+// shutdownTimeout returns the configured grace period for shutdown
+func (app *App) shutdownTimeout() time.Duration {
+	if app.Config == nil || app.Config.Server.ShutdownTimeoutSeconds <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(app.Config.Server.ShutdownTimeoutSeconds) * time.Second
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer records shutdown calls; GracefulStop blocks until release is closed or Stop is called
+type fakeServer struct {
+	mu       sync.Mutex
+	release  chan struct{}
+	graceful bool
+	stopped  bool
+	stopOnce sync.Once
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{release: make(chan struct{})}
+}
+
+func (s *fakeServer) GracefulStop() {
+	s.mu.Lock()
+	s.graceful = true
+	s.mu.Unlock()
+	<-s.release
+}
+
+func (s *fakeServer) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.stopOnce.Do(func() { close(s.release) })
+}
+
+// closingCache is a cache that tracks Close, like the Redis cache
+type closingCache struct {
+	service.CacheService
+	closed int
+	err    error
+}
+
+func (c *closingCache) Close() error {
+	c.closed++
+	return c.err
+}
+
+func TestApp_Shutdown_DrainsServers(t *testing.T) {
+	srv := newFakeServer()
+	close(srv.release) // No in-flight requests
+	cache := &closingCache{CacheService: service.NewNoopCache()}
+	app := &App{Servers: []GracefulServer{srv}, CacheService: cache}
+
+	assert.NoError(t, app.Shutdown(context.Background()))
+	assert.True(t, srv.graceful)
+	assert.False(t, srv.stopped)
+	assert.Equal(t, 1, cache.closed)
+
+	// Shutdown runs once
+	assert.NoError(t, app.Close())
+	assert.Equal(t, 1, cache.closed)
+}
+
+func TestApp_Shutdown_ForcesStopAfterGracePeriod(t *testing.T) {
+	srv := newFakeServer() // In-flight requests never finish
+	app := &App{Servers: []GracefulServer{srv}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.NoError(t, app.Shutdown(ctx))
+	assert.True(t, srv.graceful)
+	assert.True(t, srv.stopped)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestApp_Shutdown_ReportsCloseErrors(t *testing.T) {
+	cache := &closingCache{CacheService: service.NewNoopCache(), err: errors.New("connection reset")}
+	app := &App{CacheService: cache}
+
+	err := app.Shutdown(context.Background())
+	assert.ErrorContains(t, err, "failed to close cache")
+}
+
+func TestApp_ShutdownTimeout(t *testing.T) {
+	assert.Equal(t, defaultShutdownTimeout, (&App{}).shutdownTimeout())
+
+	app := &App{Config: &config.Config{Server: config.ServerConfig{ShutdownTimeoutSeconds: 5}}}
+	assert.Equal(t, 5*time.Second, app.shutdownTimeout())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/logging"
+	"github.com/pguia/iam/internal/service"
+)
+
+const sidecarUsage = `usage: iam-server sidecar
+
+Runs next to an application and answers its permission checks from an in-memory replica of the
+policies of sidecar.root_resource_id, kept up to date through the WatchPolicies stream of the
+central service at sidecar.upstream. Checks the replica cannot answer are forwarded upstream.
+`
+
+// dialUpstream connects to the central IAM service
+var dialUpstream = func(cfg *config.SidecarConfig) (service.PolicySource, service.PermissionEvaluator, error) {
+	// TODO: Connect the gRPC client once proto files are generated
+	return nil, nil, fmt.Errorf("sidecar upstream %s: gRPC client pending proto file generation", cfg.Upstream)
+}
+
+// runSidecar implements the "sidecar" subcommand
+func runSidecar(args []string) error {
+	if len(args) != 0 {
+		fmt.Fprint(os.Stderr, sidecarUsage)
+		return fmt.Errorf("sidecar takes no arguments")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ValidateSidecar(); err != nil {
+		return err
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	source, upstream, err := dialUpstream(&cfg.Sidecar)
+	if err != nil {
+		return err
+	}
+
+	// Groups resolved by the central service's directory are only known upstream; see confirm_denials
+	var evaluatorOpts []service.EvaluatorOption
+	if cfg.LDAP.Enabled {
+		ldapResolver, err := ldapGroupResolver(&cfg.LDAP, logger)
+		if err != nil {
+			return err
+		}
+		evaluatorOpts = append(evaluatorOpts, service.WithGroupResolver(ldapResolver))
+	}
+
+	authorizer, err := service.NewLocalAuthorizer(&cfg.Sidecar, source, upstream, logger, evaluatorOpts...)
+	if err != nil {
+		return err
+	}
+
+	// TODO: Serve the permission check RPCs from authorizer once proto files are generated
+	logger.Info("IAM sidecar would be listening", "address", cfg.Server.Address,
+		"upstream", cfg.Sidecar.Upstream, "root_resource_id", cfg.Sidecar.RootResourceID,
+		"confirm_denials", cfg.Sidecar.ConfirmDenials)
+	logger.Info("Note: gRPC server implementation pending proto file generation")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return authorizer.Run(ctx)
+}
@@ -8,17 +8,17 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
-	iamv1 "github.com/pguia/iam/api/proto/iam/v1"
+	"github.com/pguia/iam/pkg/client"
+	"github.com/pguia/iam/pkg/client/grpctransport"
+	"github.com/pguia/iam/pkg/middleware"
 )
 
 // ChassisIntegration provides a simple way to integrate Auth + IAM services
 type ChassisIntegration struct {
 	authServiceURL string
-	iamClient      iamv1.IAMServiceClient
-	iamConn        *grpc.ClientConn
+	iam            *client.Client
+	authz          *middleware.Middleware
 	jwtValidator   JWTValidator
 }
 
@@ -39,6 +39,7 @@ type Config struct {
 	AuthServiceURL string
 	IAMServiceAddr string // e.g., "localhost:8081"
 	JWTSecret      string // The access token secret from the auth service
+	FailOpen       bool   // Let requests through when IAM is unreachable
 }
 
 // standardJWTValidator implements JWTValidator using golang-jwt
@@ -101,27 +102,27 @@ func (v *standardJWTValidator) ValidateToken(tokenString string) (*UserClaims, e
 // NewChassisIntegration creates a new integration helper
 func NewChassisIntegration(cfg Config) (*ChassisIntegration, error) {
 	// Connect to IAM service
-	conn, err := grpc.NewClient(cfg.IAMServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	transport, err := grpctransport.Dial(cfg.IAMServiceAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to IAM service: %w", err)
+		return nil, err
 	}
 
-	iamClient := iamv1.NewIAMServiceClient(conn)
+	iamClient := client.New(transport)
 
 	// Create JWT validator
 	jwtValidator := NewJWTValidator(cfg.JWTSecret)
 
 	return &ChassisIntegration{
 		authServiceURL: cfg.AuthServiceURL,
-		iamClient:      iamClient,
-		iamConn:        conn,
+		iam:            iamClient,
+		authz:          middleware.New(iamClient, middleware.WithFailOpen(cfg.FailOpen)),
 		jwtValidator:   jwtValidator,
 	}, nil
 }
 
 // Close closes the gRPC connection
 func (ci *ChassisIntegration) Close() error {
-	return ci.iamConn.Close()
+	return ci.iam.Close()
 }
 
 // Middleware returns an HTTP middleware that handles both auth and authz
@@ -145,6 +146,7 @@ func (ci *ChassisIntegration) Middleware() func(http.Handler) http.Handler {
 			ctx := context.WithValue(r.Context(), "user_email", claims.Email)
 			ctx = context.WithValue(ctx, "user_id", claims.UserID)
 			ctx = context.WithValue(ctx, "chassis_integration", ci)
+			ctx = middleware.WithPrincipal(ctx, client.User(claims.Email))
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -153,56 +155,22 @@ func (ci *ChassisIntegration) Middleware() func(http.Handler) http.Handler {
 
 // RequirePermission returns a middleware that checks a specific permission
 func (ci *ChassisIntegration) RequirePermission(resourceID, permission string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userEmail := r.Context().Value("user_email").(string)
-
-			allowed, reason, err := ci.CheckPermission(r.Context(), userEmail, resourceID, permission)
-			if err != nil {
-				http.Error(w, "Authorization check failed", http.StatusInternalServerError)
-				return
-			}
-
-			if !allowed {
-				http.Error(w, fmt.Sprintf("Forbidden: %s", reason), http.StatusForbidden)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
+	return ci.authz.RequirePermission(permission, middleware.StaticResource(resourceID))
 }
 
 // CheckPermission checks if a user has a permission on a resource
 func (ci *ChassisIntegration) CheckPermission(ctx context.Context, userEmail, resourceID, permission string) (bool, string, error) {
-	principal := fmt.Sprintf("user:%s", userEmail)
-
-	resp, err := ci.iamClient.CheckPermission(ctx, &iamv1.CheckPermissionRequest{
-		Principal:  principal,
-		ResourceId: resourceID,
-		Permission: permission,
-		Context:    nil,
-	})
+	decision, err := ci.iam.CheckPermission(ctx, client.User(userEmail), resourceID, permission, nil)
 	if err != nil {
 		return false, "", err
 	}
 
-	return resp.Allowed, resp.Reason, nil
+	return decision.Allowed, decision.Reason, nil
 }
 
 // GetEffectivePermissions returns all permissions for a user on a resource
 func (ci *ChassisIntegration) GetEffectivePermissions(ctx context.Context, userEmail, resourceID string) ([]string, []string, error) {
-	principal := fmt.Sprintf("user:%s", userEmail)
-
-	resp, err := ci.iamClient.GetEffectivePermissions(ctx, &iamv1.GetEffectivePermissionsRequest{
-		Principal:  principal,
-		ResourceId: resourceID,
-	})
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return resp.Permissions, resp.Roles, nil
+	return ci.iam.GetEffectivePermissions(ctx, client.User(userEmail), resourceID)
 }
 
 // Helper functions
@@ -243,21 +211,7 @@ func RequirePermissionDynamic(permission string, getResourceID func(*http.Reques
 				return
 			}
 
-			userEmail := GetUserEmail(r)
-			resourceID := getResourceID(r)
-
-			allowed, reason, err := ci.CheckPermission(r.Context(), userEmail, resourceID, permission)
-			if err != nil {
-				http.Error(w, "Authorization check failed", http.StatusInternalServerError)
-				return
-			}
-
-			if !allowed {
-				http.Error(w, fmt.Sprintf("Forbidden: %s", reason), http.StatusForbidden)
-				return
-			}
-
-			next.ServeHTTP(w, r)
+			ci.authz.RequirePermission(permission, getResourceID)(next).ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,199 @@
+// Package benchmarks seeds synthetic resource trees and benchmarks the permission evaluator on
+// them, so that performance changes are measurable:
+//
+//	go test -run '^$' -bench . ./internal/benchmarks/
+//	go test -run '^$' -bench . ./internal/benchmarks/ -tree depth=6,fanout=3,bindings=10,members=50
+//
+// Trees are seeded through a testharness, so the database comes from testenv or, with
+// TEST_DB_DRIVER=sqlite, is an embedded SQLite database (needs -tags sqlite).
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/testharness"
+)
+
+// Permission is the permission granted by every role of a seeded tree
+const Permission = "bench.resources.get"
+
+// TreeSpec is the shape of a synthetic resource tree
+type TreeSpec struct {
+	Depth             int // Levels of resources, the root included
+	FanOut            int // Children of every resource above the leaves
+	BindingsPerPolicy int // Bindings of the policy of every resource
+	MembersPerBinding int // Members of every binding
+}
+
+// String returns the spec in the form ParseTreeSpec reads, e.g. "depth=4,fanout=3,bindings=2,members=10"
+func (s TreeSpec) String() string {
+	return fmt.Sprintf("depth=%d,fanout=%d,bindings=%d,members=%d", s.Depth, s.FanOut, s.BindingsPerPolicy, s.MembersPerBinding)
+}
+
+// Resources returns the number of resources of the tree
+func (s TreeSpec) Resources() int {
+	total, level := 0, 1
+	for range s.Depth {
+		total += level
+		level *= s.FanOut
+	}
+	return total
+}
+
+// ParseTreeSpec parses a spec written as comma-separated key=value pairs of depth, fanout,
+// bindings and members; omitted keys keep their value in defaults
+func ParseTreeSpec(s string, defaults TreeSpec) (TreeSpec, error) {
+	spec := defaults
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return TreeSpec{}, fmt.Errorf("invalid tree spec %q: expected key=value", pair)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return TreeSpec{}, fmt.Errorf("invalid tree spec %q: %s must be a positive integer", pair, key)
+		}
+		switch key {
+		case "depth":
+			spec.Depth = n
+		case "fanout":
+			spec.FanOut = n
+		case "bindings":
+			spec.BindingsPerPolicy = n
+		case "members":
+			spec.MembersPerBinding = n
+		default:
+			return TreeSpec{}, fmt.Errorf("invalid tree spec %q: unknown key %s (valid: depth, fanout, bindings, members)", pair, key)
+		}
+	}
+	return spec, nil
+}
+
+// Tree is a seeded resource tree and principals whose checks exercise its paths
+type Tree struct {
+	Spec TreeSpec
+	Root uuid.UUID
+	Leaf uuid.UUID // The deepest resource seeded last, i.e. the furthest from the root's bindings
+
+	// RootMember is the last member of the last binding of the root's policy: checks on Leaf walk
+	// every ancestor and scan every binding before granting
+	RootMember string
+	// LeafMember is a member of the first binding of Leaf's policy: checks on Leaf grant at once
+	LeafMember string
+	// Outsider is a member of no binding: checks on Leaf scan the whole path and deny
+	Outsider string
+}
+
+// Seed creates a tree of spec through the repositories of h. Every resource has a policy whose
+// bindings each grant a role with Permission to distinct users.
+func Seed(h *testharness.Harness, spec TreeSpec) (*Tree, error) {
+	if spec.Depth < 1 || spec.FanOut < 1 || spec.BindingsPerPolicy < 1 || spec.MembersPerBinding < 1 {
+		return nil, fmt.Errorf("invalid tree spec %s: every value must be positive", spec)
+	}
+
+	permission := &domain.Permission{Name: Permission, Service: "bench"}
+	if err := h.Permissions.Create(permission); err != nil {
+		return nil, fmt.Errorf("failed to create permission: %w", err)
+	}
+	roles := make([]uuid.UUID, spec.BindingsPerPolicy)
+	for i := range roles {
+		role := &domain.Role{
+			Name:        fmt.Sprintf("roles/bench.role%d", i),
+			Title:       fmt.Sprintf("Bench role %d", i),
+			Permissions: []domain.Permission{*permission},
+		}
+		if err := h.Roles.Create(role); err != nil {
+			return nil, fmt.Errorf("failed to create role: %w", err)
+		}
+		roles[i] = role.ID
+	}
+
+	s := &seeder{h: h, spec: spec, roles: roles}
+	root, err := s.resource(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	level := []uuid.UUID{root}
+	for depth := 1; depth < spec.Depth; depth++ {
+		next := make([]uuid.UUID, 0, len(level)*spec.FanOut)
+		for _, parent := range level {
+			for range spec.FanOut {
+				resource, err := s.resource(depth, &parent)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, resource)
+			}
+		}
+		level = next
+	}
+
+	tree := &Tree{Spec: spec, Outsider: "user:outsider@example.com"}
+	tree.Root, tree.RootMember = s.first, s.firstLastMember
+	tree.Leaf, tree.LeafMember = s.last, s.lastFirstMember
+	return tree, nil
+}
+
+// seeder creates the resources of a tree, numbering resources and members
+type seeder struct {
+	h         *testharness.Harness
+	spec      TreeSpec
+	roles     []uuid.UUID
+	resources int
+	members   int
+
+	first, last                      uuid.UUID
+	firstLastMember, lastFirstMember string
+}
+
+// resource creates a resource at depth under parent (nil for the root) with its policy
+func (s *seeder) resource(depth int, parent *uuid.UUID) (uuid.UUID, error) {
+	s.resources++
+	resource := &domain.Resource{
+		Type:     fmt.Sprintf("level%d", depth),
+		Name:     fmt.Sprintf("resource-%d", s.resources),
+		ParentID: parent,
+	}
+	if err := s.h.Resources.Create(resource); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	if err := s.h.Policies.Create(policy); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create policy: %w", err)
+	}
+
+	var firstMember, lastMember string
+	for _, role := range s.roles {
+		members := make([]string, s.spec.MembersPerBinding)
+		for i := range members {
+			s.members++
+			members[i] = fmt.Sprintf("user:member%d@example.com", s.members)
+		}
+		if firstMember == "" {
+			firstMember = members[0]
+		}
+		lastMember = members[len(members)-1]
+
+		encoded, err := json.Marshal(members)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to marshal members: %w", err)
+		}
+		if err := s.h.Bindings.Create(&domain.Binding{PolicyID: policy.ID, RoleID: role, Members: encoded}); err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create binding: %w", err)
+		}
+	}
+
+	if s.first == uuid.Nil {
+		s.first, s.firstLastMember = resource.ID, lastMember
+	}
+	s.last, s.lastFirstMember = resource.ID, firstMember
+	return resource.ID, nil
+}
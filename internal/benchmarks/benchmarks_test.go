@@ -0,0 +1,57 @@
+package benchmarks
+
+import (
+	"testing"
+
+	"github.com/pguia/iam/internal/testharness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTreeSpec(t *testing.T) {
+	defaults := TreeSpec{Depth: 3, FanOut: 4, BindingsPerPolicy: 3, MembersPerBinding: 10}
+
+	spec, err := ParseTreeSpec("depth=5,members=20", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, TreeSpec{Depth: 5, FanOut: 4, BindingsPerPolicy: 3, MembersPerBinding: 20}, spec)
+
+	spec, err = ParseTreeSpec(defaults.String(), TreeSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, defaults, spec)
+
+	for _, invalid := range []string{"depth", "depth=0", "depth=x", "width=2"} {
+		_, err := ParseTreeSpec(invalid, defaults)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTreeSpec_Resources(t *testing.T) {
+	assert.Equal(t, 1, TreeSpec{Depth: 1, FanOut: 5}.Resources())
+	assert.Equal(t, 21, TreeSpec{Depth: 3, FanOut: 4}.Resources())
+	assert.Equal(t, 6, TreeSpec{Depth: 6, FanOut: 1}.Resources())
+}
+
+func TestSeed(t *testing.T) {
+	h := testharness.New(t)
+	spec := TreeSpec{Depth: 3, FanOut: 2, BindingsPerPolicy: 2, MembersPerBinding: 3}
+
+	tree, err := Seed(h, spec)
+	require.NoError(t, err)
+
+	descendants, err := h.Resources.GetDescendants(tree.Root)
+	require.NoError(t, err)
+	assert.Len(t, descendants, spec.Resources()-1)
+
+	ancestors, err := h.Resources.GetAncestors(tree.Leaf)
+	require.NoError(t, err)
+	assert.Len(t, ancestors, spec.Depth-1)
+
+	for principal, expected := range map[string]bool{tree.LeafMember: true, tree.RootMember: true, tree.Outsider: false} {
+		allowed, _, err := h.Evaluator.CheckPermission(principal, tree.Leaf, Permission, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, allowed, principal)
+	}
+
+	_, err = Seed(h, TreeSpec{Depth: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package benchmarks
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/service"
+	"github.com/pguia/iam/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+var treeFlag = flag.String("tree", "", "shape of the seeded tree, e.g. depth=5,fanout=4,bindings=5,members=20; the default trees when empty")
+
+// defaultTrees are a wide and shallow tree and a narrow and deep one with larger policies
+var defaultTrees = []TreeSpec{
+	{Depth: 3, FanOut: 4, BindingsPerPolicy: 3, MembersPerBinding: 10},
+	{Depth: 6, FanOut: 2, BindingsPerPolicy: 5, MembersPerBinding: 50},
+}
+
+// trees returns the tree of -tree, or the default trees
+func trees(b *testing.B) []TreeSpec {
+	if *treeFlag == "" {
+		return defaultTrees
+	}
+	spec, err := ParseTreeSpec(*treeFlag, defaultTrees[0])
+	require.NoError(b, err)
+	return []TreeSpec{spec}
+}
+
+// benchmarkTrees seeds every tree in a harness of its own and runs fn on it
+func benchmarkTrees(b *testing.B, fn func(b *testing.B, h *testharness.Harness, tree *Tree)) {
+	for _, spec := range trees(b) {
+		b.Run(spec.String(), func(b *testing.B) {
+			h := testharness.New(b)
+			tree, err := Seed(h, spec)
+			require.NoError(b, err)
+			fn(b, h, tree)
+		})
+	}
+}
+
+// checkCases are checks on the leaf granted there, granted at the root, and denied
+func checkCases(tree *Tree) []struct {
+	name      string
+	principal string
+	allowed   bool
+} {
+	return []struct {
+		name      string
+		principal string
+		allowed   bool
+	}{
+		{"granted-on-leaf", tree.LeafMember, true},
+		{"granted-on-root", tree.RootMember, true},
+		{"denied", tree.Outsider, false},
+	}
+}
+
+// BenchmarkCheckPermission measures uncached checks on the deepest leaf
+func BenchmarkCheckPermission(b *testing.B) {
+	benchmarkTrees(b, func(b *testing.B, h *testharness.Harness, tree *Tree) {
+		for _, tc := range checkCases(tree) {
+			b.Run(tc.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					allowed, _, err := h.Evaluator.CheckPermission(tc.principal, tree.Leaf, Permission, nil)
+					if err != nil || allowed != tc.allowed {
+						b.Fatalf("CheckPermission(%s) = %v, %v; want %v", tc.principal, allowed, err, tc.allowed)
+					}
+				}
+			})
+		}
+	})
+}
+
+// BenchmarkCheckPermission_Cached measures checks on the deepest leaf answered by the memory cache
+func BenchmarkCheckPermission_Cached(b *testing.B) {
+	benchmarkTrees(b, func(b *testing.B, h *testharness.Harness, tree *Tree) {
+		cache := service.NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 300, MaxSize: 1000, CleanupMinutes: 10})
+		evaluator := service.NewPermissionEvaluator(h.Resources, h.Policies, h.Permissions, cache)
+
+		for _, tc := range checkCases(tree) {
+			b.Run(tc.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					allowed, _, err := evaluator.CheckPermission(tc.principal, tree.Leaf, Permission, nil)
+					if err != nil || allowed != tc.allowed {
+						b.Fatalf("CheckPermission(%s) = %v, %v; want %v", tc.principal, allowed, err, tc.allowed)
+					}
+				}
+			})
+		}
+	})
+}
+
+// BenchmarkGetEffectivePermissions measures computing the permissions of principals on the
+// deepest leaf, which reads the policies of all its ancestors
+func BenchmarkGetEffectivePermissions(b *testing.B) {
+	benchmarkTrees(b, func(b *testing.B, h *testharness.Harness, tree *Tree) {
+		for _, tc := range checkCases(tree) {
+			b.Run(tc.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					permissions, _, err := h.Evaluator.GetEffectivePermissions(tc.principal, tree.Leaf)
+					if err != nil || (len(permissions) > 0) != tc.allowed {
+						b.Fatalf("GetEffectivePermissions(%s) = %v, %v; want granted %v", tc.principal, permissions, err, tc.allowed)
+					}
+				}
+			})
+		}
+	})
+}
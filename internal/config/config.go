@@ -9,45 +9,428 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Cache    CacheConfig    `mapstructure:"cache"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	Cache        CacheConfig        `mapstructure:"cache"`
+	Authz        AuthzConfig        `mapstructure:"authz"`
+	Resource     ResourceConfig     `mapstructure:"resource"`
+	Log          LogConfig          `mapstructure:"log"`
+	DecisionLog  DecisionLogConfig  `mapstructure:"decision_log"`
+	Operations   OperationsConfig   `mapstructure:"operations"`
+	SCIM         SCIMConfig         `mapstructure:"scim"`
+	LDAP         LDAPConfig         `mapstructure:"ldap"`
+	PolicyScan   PolicyScanConfig   `mapstructure:"policy_scan"`
+	Integrity    IntegrityConfig    `mapstructure:"integrity"`
+	Retention    RetentionConfig    `mapstructure:"retention"`
+	Idempotency  IdempotencyConfig  `mapstructure:"idempotency"`
+	Role         RoleConfig         `mapstructure:"role"`
+	Evaluator    EvaluatorConfig    `mapstructure:"evaluator"`
+	OIDC         OIDCConfig         `mapstructure:"oidc"`
+	PolicyLimits PolicyLimitsConfig `mapstructure:"policy_limits"`
+	Sidecar      SidecarConfig      `mapstructure:"sidecar"`
+	AccessReview AccessReviewConfig `mapstructure:"access_review"`
+	Replication  ReplicationConfig  `mapstructure:"replication"`
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
 	Address string `mapstructure:"address"`
 	Port    int    `mapstructure:"port"`
+
+	// Register the gRPC reflection service so tools such as grpcurl can discover the API
+	Reflection bool `mapstructure:"reflection"`
+
+	// Time allowed for in-flight requests to finish and logs to flush on shutdown
+	ShutdownTimeoutSeconds int `mapstructure:"shutdown_timeout_seconds"`
+
+	// Service principals allowed to call on behalf of end-users with the x-iam-caller metadata
+	TrustedCallerServices []string `mapstructure:"trusted_caller_services"`
+
+	// Serve gRPC over TLS; with ca_file, clients must present a certificate signed by it (mTLS)
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// TLSConfig holds the TLS settings of a server or of a client connection.
+// Certificate files are re-read when they change, so rotated certificates need no restart.
+type TLSConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CertFile   string `mapstructure:"cert_file"`   // PEM certificate chain presented to the peer
+	KeyFile    string `mapstructure:"key_file"`    // PEM private key of cert_file
+	CAFile     string `mapstructure:"ca_file"`     // Server: CA of client certificates; client: CA of the server (default: system roots)
+	MinVersion string `mapstructure:"min_version"` // "1.2" (default) or "1.3"
+
+	// Server only: "none", "request", "require", "verify_if_given" or "require_and_verify";
+	// defaults to "require_and_verify" when ca_file is set and "none" otherwise
+	ClientAuth string `mapstructure:"client_auth"`
+
+	// Client only
+	ServerName         string `mapstructure:"server_name"`          // Overrides the host name verified against the server certificate
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Testing only
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
+	// "postgres" (default) or "sqlite", an embedded database for local development and tests;
+	// sqlite needs a binary built with -tags sqlite
+	Driver     string `mapstructure:"driver"`
+	SQLitePath string `mapstructure:"sqlite_path"` // Database file of the sqlite driver; ":memory:" keeps it in memory
+
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
+	Password string `mapstructure:"password"` // Plain value or "vault:<path>#<key>"
 	DBName   string `mapstructure:"dbname"`
 	SSLMode  string `mapstructure:"sslmode"`
 	MaxConns int    `mapstructure:"max_conns"`
 	MaxIdle  int    `mapstructure:"max_idle"`
+
+	// File holding the password, e.g. a Docker or Kubernetes secret mount; overrides password
+	PasswordFile string `mapstructure:"password_file"`
+
+	// Apply pending SQL migrations at startup; disable in production and run "iam-server migrate up" instead
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+
+	// Optional read replica; read-only queries fail over to the primary while it is unreachable
+	ReplicaDSN                string `mapstructure:"replica_dsn"`
+	ReplicaHealthCheckSeconds int    `mapstructure:"replica_health_check_seconds"`
+	// Reads use the primary for this long after each write, so a lagging replica cannot serve
+	// (and the cache keep) grants the write revoked; set it above the replica's usual lag
+	ReplicaReadYourWritesSeconds int `mapstructure:"replica_read_your_writes_seconds"`
+
+	// Certificates for sslmode verify-ca / verify-full and client certificate authentication
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+
+	// Connections are closed after this long (0 = never), e.g. to rebalance behind PgBouncer or a failover proxy
+	ConnMaxLifetimeSeconds int `mapstructure:"conn_max_lifetime_seconds"`
+	ConnMaxIdleTimeSeconds int `mapstructure:"conn_max_idle_time_seconds"`
+
+	// Server-side limit on each statement (0 = none) and schema search path of every session
+	StatementTimeoutSeconds int    `mapstructure:"statement_timeout_seconds"`
+	SearchPath              string `mapstructure:"search_path"`
+
+	// Additional DSN parameters appended verbatim, e.g. "application_name=iam target_session_attrs=read-write"
+	Params string `mapstructure:"params"`
+
+	// Statements slower than this are logged at warn level, without their bound parameters (0 = off)
+	SlowQueryMS int `mapstructure:"slow_query_ms"`
 }
 
 // CacheConfig holds cache configuration
 type CacheConfig struct {
-	Type           string           `mapstructure:"type"` // "none", "memory", "redis"
-	Enabled        bool             `mapstructure:"enabled"`
-	TTLSeconds     int              `mapstructure:"ttl_seconds"`
-	MaxSize        int              `mapstructure:"max_size"`
-	CleanupMinutes int              `mapstructure:"cleanup_minutes"`
-	Redis          RedisCacheConfig `mapstructure:"redis"`
+	Type           string            `mapstructure:"type"` // "none", "memory", "redis"
+	Enabled        bool              `mapstructure:"enabled"`
+	TTLSeconds     int               `mapstructure:"ttl_seconds"`
+	MaxSize        int               `mapstructure:"max_size"`
+	CleanupMinutes int               `mapstructure:"cleanup_minutes"`
+	Shards         int               `mapstructure:"shards"` // Independently locked parts of the memory cache
+	Redis          RedisCacheConfig  `mapstructure:"redis"`
+	Warmup         CacheWarmupConfig `mapstructure:"warmup"`
 }
 
 // RedisCacheConfig holds Redis cache configuration
 type RedisCacheConfig struct {
-	Address    string `mapstructure:"address"`
-	Password   string `mapstructure:"password"`
-	DB         int    `mapstructure:"db"`
-	TTLSeconds int    `mapstructure:"ttl_seconds"`
+	Mode         string   `mapstructure:"mode"`        // "standalone" (default), "cluster" or "sentinel"
+	Address      string   `mapstructure:"address"`     // Standalone server
+	Addresses    []string `mapstructure:"addresses"`   // Cluster seed nodes, or the sentinels
+	MasterName   string   `mapstructure:"master_name"` // Sentinel: name of the monitored master
+	Password     string   `mapstructure:"password"`    // Plain value or "vault:<path>#<key>"
+	PasswordFile string   `mapstructure:"password_file"`
+	DB           int      `mapstructure:"db"` // Not supported by cluster
+	TTLSeconds   int      `mapstructure:"ttl_seconds"`
+
+	// Sentinel: password of the sentinels when it differs from the master's
+	SentinelPassword string `mapstructure:"sentinel_password"`
+
+	// Prepended to every key, e.g. "staging:", so environments can safely share a server or cluster
+	KeyPrefix string `mapstructure:"key_prefix"`
+
+	// Connection pool of each server; 0 keeps the client default
+	PoolSize               int `mapstructure:"pool_size"`                  // Default 10 per CPU
+	MinIdleConns           int `mapstructure:"min_idle_conns"`             // Kept open while idle
+	PoolTimeoutSeconds     int `mapstructure:"pool_timeout_seconds"`       // Wait for a free connection; default read timeout + 1s
+	ConnMaxIdleTimeSeconds int `mapstructure:"conn_max_idle_time_seconds"` // Default 30 minutes
+	ConnMaxLifetimeSeconds int `mapstructure:"conn_max_lifetime_seconds"`  // Default unlimited
+	DialTimeoutSeconds     int `mapstructure:"dial_timeout_seconds"`       // Default 5
+	ReadTimeoutSeconds     int `mapstructure:"read_timeout_seconds"`       // Also bounds writes; default 3
+
+	// Connect over TLS; cert_file and key_file authenticate the client (mTLS)
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// CacheWarmupConfig holds configuration for precomputing permissions of hot principals
+type CacheWarmupConfig struct {
+	Enabled     bool     `mapstructure:"enabled"`     // Warm the cache on startup
+	Principals  []string `mapstructure:"principals"`  // Hot principals, e.g. "serviceAccount:api@example.com"
+	Resources   []string `mapstructure:"resources"`   // Resource IDs warmed for each hot principal
+	TopPairs    int      `mapstructure:"top_pairs"`   // Also warm the N most frequently checked principal/resource pairs
+	Concurrency int      `mapstructure:"concurrency"` // Number of pairs warmed in parallel
+}
+
+// AuthzConfig holds configuration for authorizing callers of the IAM admin APIs
+type AuthzConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	RootPrincipals []string `mapstructure:"root_principals"`  // Bootstrap principals that bypass admin checks
+	RootResourceID string   `mapstructure:"root_resource_id"` // Resource guarding global objects (roles, permissions)
+}
+
+// ResourceConfig holds resource hierarchy configuration
+type ResourceConfig struct {
+	MaxDepth int `mapstructure:"max_depth"` // Maximum number of levels in a resource hierarchy
+
+	// Read subtrees from the resource_closure table instead of recursive queries; faster for large hierarchies
+	ClosureTable bool `mapstructure:"closure_table"`
+
+	// Resource types each listed role may be bound on; roles without a rule may be bound anywhere
+	AttachmentRules []AttachmentRule `mapstructure:"attachment_rules"`
+
+	// Bindings added to the policy of every new resource of a type, e.g. roles/owner for its creator
+	DefaultBindings []DefaultBinding `mapstructure:"default_bindings"`
+}
+
+// AttachmentRule restricts a role to bindings on the given resource types
+type AttachmentRule struct {
+	Role          string   `mapstructure:"role"`           // e.g. "roles/owner"
+	ResourceTypes []string `mapstructure:"resource_types"` // e.g. ["organization"]
+}
+
+// DefaultBinding grants a role on each new resource of a type
+type DefaultBinding struct {
+	ResourceType string   `mapstructure:"resource_type"` // e.g. "project"
+	Role         string   `mapstructure:"role"`          // e.g. "roles/owner"
+	Members      []string `mapstructure:"members"`       // "creator" stands for the principal creating the resource
+}
+
+// PolicyLimitsConfig holds the size limits of policies, which keep pathological policies from
+// slowing down evaluation. A zero limit is unlimited.
+type PolicyLimitsConfig struct {
+	MaxBindings        int `mapstructure:"max_bindings"`         // Bindings in one policy
+	MaxMembers         int `mapstructure:"max_members"`          // Members of one binding
+	MaxConditionLength int `mapstructure:"max_condition_length"` // Characters in one condition expression
+
+	// Stricter or looser limits for some tenants or resources
+	Overrides []PolicyLimitOverride `mapstructure:"overrides"`
+}
+
+// PolicyLimitOverride replaces the limits of a resource and its descendants, e.g. a tenant's
+// organization. The nearest override wins; its zero fields keep the inherited limit.
+type PolicyLimitOverride struct {
+	ResourceID         string `mapstructure:"resource_id"`
+	MaxBindings        int    `mapstructure:"max_bindings"`
+	MaxMembers         int    `mapstructure:"max_members"`
+	MaxConditionLength int    `mapstructure:"max_condition_length"`
+	MaxDepth           int    `mapstructure:"max_depth"` // Levels of the hierarchy, at most resource.max_depth
+}
+
+// LogConfig holds logging configuration
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // "debug", "info", "warn", "error"
+	Format string `mapstructure:"format"` // "json", "text"
+}
+
+// DecisionLogConfig holds configuration for recording every permission check
+type DecisionLogConfig struct {
+	Enabled              bool    `mapstructure:"enabled"`
+	Sink                 string  `mapstructure:"sink"`                   // "db", "file"
+	FilePath             string  `mapstructure:"file_path"`              // JSON lines file used by the "file" sink
+	SampleRate           float64 `mapstructure:"sample_rate"`            // Fraction of allowed checks recorded; denials are always recorded
+	BufferSize           int     `mapstructure:"buffer_size"`            // Entries buffered before new ones are dropped
+	BatchSize            int     `mapstructure:"batch_size"`             // Entries written to the sink at once
+	FlushIntervalSeconds int     `mapstructure:"flush_interval_seconds"` // Maximum delay before buffered entries are written
+}
+
+// OperationsConfig holds configuration for long-running operations executed in the background
+type OperationsConfig struct {
+	Workers   int `mapstructure:"workers"`    // Operations executed concurrently
+	QueueSize int `mapstructure:"queue_size"` // Operations waiting for a worker before new ones are rejected
+}
+
+// PolicyScanConfig holds configuration for the background policy linter
+type PolicyScanConfig struct {
+	IntervalMinutes int `mapstructure:"interval_minutes"` // Time between scans of all policies; 0 disables the scanner
+}
+
+// IntegrityConfig holds configuration for the background integrity scanner
+type IntegrityConfig struct {
+	IntervalMinutes int `mapstructure:"interval_minutes"` // Time between integrity scans; 0 disables the scanner
+
+	// Report group members of bindings naming no group provisioned through SCIM. Enable it only
+	// when SCIM is the source of all groups, not LDAP or ID tokens.
+	CheckGroups bool `mapstructure:"check_groups"`
+}
+
+// RetentionConfig holds configuration for soft-deleted resources, roles, policies and bindings
+type RetentionConfig struct {
+	Days                 int `mapstructure:"days"`                   // Deleted rows can be restored for this long; 0 keeps them forever
+	PurgeIntervalMinutes int `mapstructure:"purge_interval_minutes"` // Time between purges of rows past retention; 0 disables the purge job
+}
+
+// AccessReviewConfig holds configuration for access review campaigns
+type AccessReviewConfig struct {
+	CloseIntervalMinutes int `mapstructure:"close_interval_minutes"` // Time between checks for due reviews to close; 0 disables the closer
+}
+
+// IdempotencyConfig holds configuration for deduplicating retried mutating requests
+type IdempotencyConfig struct {
+	TTLHours int `mapstructure:"ttl_hours"` // Results are replayed to retries with the same key for this long; 0 disables idempotency keys
+}
+
+// RoleConfig holds configuration for role management
+type RoleConfig struct {
+	// Reject permission changes to bound roles unless the request acknowledges their impact
+	RequireImpactAcknowledgment bool `mapstructure:"require_impact_acknowledgment"`
+}
+
+// EvaluatorConfig selects the backend evaluating permission checks
+type EvaluatorConfig struct {
+	Backend string    `mapstructure:"backend"` // "native" (default) or "opa"
+	OPA     OPAConfig `mapstructure:"opa"`
+
+	// Answer native checks from the evaluation_grants read model, one indexed lookup per check
+	// instead of loading the policy of every ancestor. The table is maintained on every write either way.
+	ReadModel bool `mapstructure:"read_model"`
+
+	// Latency budget of a check (0 = unlimited) and checks evaluated concurrently (0 = unlimited);
+	// checks over either limit are decided by failure_mode instead of waiting for the database.
+	// Admin API authorization always fails closed.
+	TimeoutMS   int    `mapstructure:"timeout_ms"`
+	MaxInFlight int    `mapstructure:"max_in_flight"`
+	FailureMode string `mapstructure:"failure_mode"` // "closed" (deny, default) or "open" (allow)
+
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+
+	Stats EvaluationStatsConfig `mapstructure:"stats"`
+
+	// Decision hooks run around every data-plane check, in order; see service.RegisterDecisionHook
+	Hooks []DecisionHookConfig `mapstructure:"hooks"`
+
+	Shadow ShadowEvaluatorConfig `mapstructure:"shadow"`
+}
+
+// ShadowEvaluatorConfig holds configuration for evaluating data-plane checks a second way in the
+// background, e.g. before switching backends. The configured evaluator keeps serving every result;
+// checks the shadow evaluator decides differently are logged.
+type ShadowEvaluatorConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Backend     string  `mapstructure:"backend"`       // "native" or "opa" (configured by evaluator.opa)
+	ReadModel   bool    `mapstructure:"read_model"`    // Native shadow checks use the evaluation read model
+	SampleRate  float64 `mapstructure:"sample_rate"`   // Fraction of checks shadowed
+	MaxInFlight int     `mapstructure:"max_in_flight"` // Shadow checks running at once; further checks are not shadowed
+}
+
+// DecisionHookConfig enables a registered decision hook
+type DecisionHookConfig struct {
+	Name    string            `mapstructure:"name"`    // e.g. "ip_allowlist"
+	Options map[string]string `mapstructure:"options"` // Passed to the hook's factory
+}
+
+// EvaluationStatsConfig holds configuration for the rolling statistics of data-plane checks
+// reported by GetEvaluationStats
+type EvaluationStatsConfig struct {
+	Enabled       bool `mapstructure:"enabled"`
+	WindowSeconds int  `mapstructure:"window_seconds"` // Period reported on
+	MaxTracked    int  `mapstructure:"max_tracked"`    // Resources and principals counted per tenth of the window
+}
+
+// CircuitBreakerConfig holds configuration for failing checks fast while the database is degraded
+type CircuitBreakerConfig struct {
+	Enabled          bool `mapstructure:"enabled"`
+	FailureThreshold int  `mapstructure:"failure_threshold"` // Consecutive failed or timed out checks opening the breaker
+	OpenSeconds      int  `mapstructure:"open_seconds"`      // Time checks fail fast before a trial check is let through
+}
+
+// OPAConfig holds configuration for evaluating checks with an Open Policy Agent server
+type OPAConfig struct {
+	URL            string `mapstructure:"url"`   // REST API of the OPA server, e.g. http://localhost:8181
+	Token          string `mapstructure:"token"` // Optional bearer token; plain value or "vault:<path>#<key>"
+	TokenFile      string `mapstructure:"token_file"`
+	PolicyFile     string `mapstructure:"policy_file"` // Rego module replacing the built-in package iam.authz
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+}
+
+// SCIMConfig holds configuration for the SCIM 2.0 provisioning endpoint
+type SCIMConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Address string `mapstructure:"address"` // HTTP listen address, e.g. ":8082"
+	Token   string `mapstructure:"token"`   // Bearer token the identity provider authenticates with; plain value or "vault:<path>#<key>"
+
+	// File holding the token; overrides token
+	TokenFile string `mapstructure:"token_file"`
+}
+
+// LDAPConfig holds configuration for resolving group memberships from an LDAP or Active Directory server
+type LDAPConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	URL                string `mapstructure:"url"` // ldap://host:389 or ldaps://host:636
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	BindDN             string `mapstructure:"bind_dn"`       // Empty binds anonymously
+	BindPassword       string `mapstructure:"bind_password"` // Plain value or "vault:<path>#<key>"
+	BindPasswordFile   string `mapstructure:"bind_password_file"`
+	BaseDN             string `mapstructure:"base_dn"`
+
+	// A principal "user:<id>" is the entry whose user_attribute equals <id>
+	UserAttribute   string `mapstructure:"user_attribute"`    // e.g. "mail" or "userPrincipalName"
+	UserObjectClass string `mapstructure:"user_object_class"` // Optional, e.g. "person"
+
+	// Each group DN in group_attribute becomes "group:<first RDN value><group_suffix>"
+	GroupAttribute string `mapstructure:"group_attribute"` // e.g. "memberOf"
+	GroupSuffix    string `mapstructure:"group_suffix"`    // e.g. "@example.com"
+
+	// A lookup slower than timeout_seconds is abandoned; the check proceeds without the user's LDAP groups
+	TimeoutSeconds  int `mapstructure:"timeout_seconds"`
+	CacheTTLSeconds int `mapstructure:"cache_ttl_seconds"`
+	CacheSize       int `mapstructure:"cache_size"` // Principals whose groups are cached
+}
+
+// OIDCConfig holds configuration for resolving the principal of permission checks from OpenID Connect ID tokens
+type OIDCConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	IssuerURL string   `mapstructure:"issuer_url"` // Expected "iss"; keys are discovered from <issuer_url>/.well-known/openid-configuration
+	JWKSURL   string   `mapstructure:"jwks_url"`   // Optional, skips discovery
+	Audiences []string `mapstructure:"audiences"`  // Accepted "aud" values, e.g. the client IDs of the calling applications
+
+	// The principal is "user:<principal_claim>", or "serviceAccount:<principal_claim>" when the claim
+	// ends with one of service_account_suffixes
+	PrincipalClaim         string   `mapstructure:"principal_claim"`          // e.g. "email"
+	ServiceAccountSuffixes []string `mapstructure:"service_account_suffixes"` // e.g. ".iam.gserviceaccount.com"
+
+	// Each value of groups_claim becomes "group:<value><group_suffix>"; empty ignores groups
+	GroupsClaim string `mapstructure:"groups_claim"`
+	GroupSuffix string `mapstructure:"group_suffix"` // e.g. "@example.com"
+
+	ClockSkewSeconds int `mapstructure:"clock_skew_seconds"`
+	JWKSCacheSeconds int `mapstructure:"jwks_cache_seconds"` // Keys are also refreshed when a token names an unknown key
+	TimeoutSeconds   int `mapstructure:"timeout_seconds"`
+}
+
+// SidecarConfig holds configuration for the "sidecar" subcommand, which answers permission checks
+// from an in-memory replica of one subtree's policies and forwards the others to the central service
+type SidecarConfig struct {
+	Upstream       string `mapstructure:"upstream"`         // Address of the central IAM service, e.g. "iam.internal:8081"
+	RootResourceID string `mapstructure:"root_resource_id"` // Subtree replicated in memory, with the policies it inherits
+	RefreshSeconds int    `mapstructure:"refresh_seconds"`  // Full reload interval, picking up resources created since the last load; 0 reloads only on changes
+	RetrySeconds   int    `mapstructure:"retry_seconds"`    // Delay before reconnecting after the watch stream fails
+
+	// Ask the central service before denying a check, for principals whose groups only it can
+	// resolve (e.g. SCIM directory groups); allowed checks are still answered locally
+	ConfirmDenials bool `mapstructure:"confirm_denials"`
+
+	// Connect to the upstream over TLS; cert_file and key_file authenticate the sidecar (mTLS)
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// ReplicationConfig holds configuration for deployments in several regions sharing a primary database
+type ReplicationConfig struct {
+	// "" (default): every deployment accepts writes. "single-writer": only the deployment holding
+	// the writer lock on the primary accepts writes; the others refuse them, naming the writer's
+	// region, and one of them takes over when the writer stops or loses its connection.
+	Mode   string `mapstructure:"mode"`
+	Region string `mapstructure:"region"` // Region of this deployment, named to callers of the other regions
+
+	// Time between attempts to take the writer lock, and between checks that the writer still holds it.
+	// A new writer waits this long before accepting writes.
+	ElectionIntervalSeconds int `mapstructure:"election_interval_seconds"`
 }
 
 // Load loads configuration from file and environment variables
@@ -85,6 +468,14 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
@@ -92,16 +483,37 @@ func setDefaults(v *viper.Viper) {
 	// Server defaults
 	v.SetDefault("server.address", ":8081")
 	v.SetDefault("server.port", 8081)
+	v.SetDefault("server.reflection", false)
+	v.SetDefault("server.shutdown_timeout_seconds", 30)
+	v.SetDefault("server.trusted_caller_services", []string{})
+	v.SetDefault("server.tls.enabled", false)
+	v.SetDefault("server.tls.min_version", "1.2")
 
 	// Database defaults
+	v.SetDefault("database.driver", "postgres")
+	v.SetDefault("database.sqlite_path", "iam.db")
 	v.SetDefault("database.host", "localhost")
 	v.SetDefault("database.port", 5432)
 	v.SetDefault("database.user", "postgres")
 	v.SetDefault("database.password", "postgres")
+	v.SetDefault("database.password_file", "")
 	v.SetDefault("database.dbname", "iam_db")
 	v.SetDefault("database.sslmode", "disable")
 	v.SetDefault("database.max_conns", 25)
 	v.SetDefault("database.max_idle", 5)
+	v.SetDefault("database.auto_migrate", true)
+	v.SetDefault("database.replica_dsn", "")
+	v.SetDefault("database.replica_health_check_seconds", 5)
+	v.SetDefault("database.replica_read_your_writes_seconds", 5)
+	v.SetDefault("database.sslrootcert", "")
+	v.SetDefault("database.sslcert", "")
+	v.SetDefault("database.sslkey", "")
+	v.SetDefault("database.conn_max_lifetime_seconds", 0)
+	v.SetDefault("database.conn_max_idle_time_seconds", 0)
+	v.SetDefault("database.statement_timeout_seconds", 0)
+	v.SetDefault("database.search_path", "")
+	v.SetDefault("database.params", "")
+	v.SetDefault("database.slow_query_ms", 500)
 
 	// Cache defaults (stateless by default)
 	v.SetDefault("cache.type", "none")         // "none", "memory", "redis"
@@ -109,28 +521,185 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("cache.ttl_seconds", 300)     // 5 minutes
 	v.SetDefault("cache.max_size", 10000)      // 10k entries
 	v.SetDefault("cache.cleanup_minutes", 10)  // cleanup every 10 minutes
+	v.SetDefault("cache.shards", 32)           // lock shards of the memory cache
 
 	// Redis cache defaults
+	v.SetDefault("cache.redis.mode", "standalone")
 	v.SetDefault("cache.redis.address", "localhost:6379")
+	v.SetDefault("cache.redis.addresses", []string{})
+	v.SetDefault("cache.redis.master_name", "")
 	v.SetDefault("cache.redis.password", "")
+	v.SetDefault("cache.redis.password_file", "")
 	v.SetDefault("cache.redis.db", 0)
 	v.SetDefault("cache.redis.ttl_seconds", 300)
+	v.SetDefault("cache.redis.key_prefix", "")
+	v.SetDefault("cache.redis.pool_size", 0)
+	v.SetDefault("cache.redis.min_idle_conns", 0)
+	v.SetDefault("cache.redis.pool_timeout_seconds", 0)
+	v.SetDefault("cache.redis.conn_max_idle_time_seconds", 0)
+	v.SetDefault("cache.redis.conn_max_lifetime_seconds", 0)
+	v.SetDefault("cache.redis.dial_timeout_seconds", 0)
+	v.SetDefault("cache.redis.read_timeout_seconds", 0)
+	v.SetDefault("cache.redis.tls.enabled", false)
+	v.SetDefault("cache.redis.tls.min_version", "1.2")
+
+	// Cache warm-up defaults
+	v.SetDefault("cache.warmup.enabled", false)
+	v.SetDefault("cache.warmup.principals", []string{})
+	v.SetDefault("cache.warmup.resources", []string{})
+	v.SetDefault("cache.warmup.top_pairs", 0)
+	v.SetDefault("cache.warmup.concurrency", 4)
+
+	// Admin API authorization defaults
+	v.SetDefault("authz.enabled", false)
+	v.SetDefault("authz.root_principals", []string{})
+	v.SetDefault("authz.root_resource_id", "")
+
+	// Resource hierarchy defaults
+	v.SetDefault("resource.max_depth", 32)
+	v.SetDefault("resource.closure_table", false)
+	v.SetDefault("resource.attachment_rules", []AttachmentRule{})
+	v.SetDefault("resource.default_bindings", []DefaultBinding{})
+
+	// Policy limit defaults
+	v.SetDefault("policy_limits.max_bindings", 1500)
+	v.SetDefault("policy_limits.max_members", 1500)
+	v.SetDefault("policy_limits.max_condition_length", 12288)
+	v.SetDefault("policy_limits.overrides", []PolicyLimitOverride{})
+
+	// Logging defaults
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "json")
+
+	// Decision log defaults
+	v.SetDefault("decision_log.enabled", false)
+	v.SetDefault("decision_log.sink", "db")
+	v.SetDefault("decision_log.file_path", "decisions.log")
+	v.SetDefault("decision_log.sample_rate", 1.0)
+	v.SetDefault("decision_log.buffer_size", 10000)
+	v.SetDefault("decision_log.batch_size", 100)
+	v.SetDefault("decision_log.flush_interval_seconds", 1)
+
+	// Long-running operation defaults
+	v.SetDefault("operations.workers", 2)
+	v.SetDefault("operations.queue_size", 100)
+
+	// Policy scan defaults
+	v.SetDefault("policy_scan.interval_minutes", 0)
+
+	// Integrity scan defaults
+	v.SetDefault("integrity.interval_minutes", 0)
+	v.SetDefault("integrity.check_groups", false)
+
+	// Retention defaults
+	v.SetDefault("retention.days", 30)
+	v.SetDefault("retention.purge_interval_minutes", 0)
+
+	// Access review defaults
+	v.SetDefault("access_review.close_interval_minutes", 0)
+
+	// Replication defaults
+	v.SetDefault("replication.mode", "")
+	v.SetDefault("replication.election_interval_seconds", 5)
+
+	// Idempotency defaults
+	v.SetDefault("idempotency.ttl_hours", 24)
+
+	// Role defaults
+	v.SetDefault("role.require_impact_acknowledgment", false)
+
+	// Evaluator defaults
+	v.SetDefault("evaluator.backend", "native")
+	v.SetDefault("evaluator.opa.url", "http://localhost:8181")
+	v.SetDefault("evaluator.opa.timeout_seconds", 2)
+	v.SetDefault("evaluator.read_model", false)
+	v.SetDefault("evaluator.timeout_ms", 0)
+	v.SetDefault("evaluator.max_in_flight", 0)
+	v.SetDefault("evaluator.failure_mode", "closed")
+	v.SetDefault("evaluator.circuit_breaker.enabled", false)
+	v.SetDefault("evaluator.circuit_breaker.failure_threshold", 5)
+	v.SetDefault("evaluator.circuit_breaker.open_seconds", 30)
+	v.SetDefault("evaluator.stats.enabled", false)
+	v.SetDefault("evaluator.stats.window_seconds", 600)
+	v.SetDefault("evaluator.stats.max_tracked", 10000)
+	v.SetDefault("evaluator.hooks", []DecisionHookConfig{})
+	v.SetDefault("evaluator.shadow.enabled", false)
+	v.SetDefault("evaluator.shadow.backend", "native")
+	v.SetDefault("evaluator.shadow.read_model", false)
+	v.SetDefault("evaluator.shadow.sample_rate", 1.0)
+	v.SetDefault("evaluator.shadow.max_in_flight", 100)
+
+	// SCIM defaults
+	v.SetDefault("scim.enabled", false)
+	v.SetDefault("scim.address", ":8082")
+
+	// LDAP group resolution defaults
+	v.SetDefault("ldap.enabled", false)
+	v.SetDefault("ldap.user_attribute", "mail")
+	v.SetDefault("ldap.group_attribute", "memberOf")
+	v.SetDefault("ldap.timeout_seconds", 2)
+	v.SetDefault("ldap.cache_ttl_seconds", 300)
+	v.SetDefault("ldap.cache_size", 10000)
+
+	// OIDC defaults
+	v.SetDefault("oidc.enabled", false)
+	v.SetDefault("oidc.audiences", []string{})
+	v.SetDefault("oidc.principal_claim", "email")
+	v.SetDefault("oidc.service_account_suffixes", []string{})
+	v.SetDefault("oidc.groups_claim", "groups")
+	v.SetDefault("oidc.clock_skew_seconds", 60)
+	v.SetDefault("oidc.jwks_cache_seconds", 3600)
+	v.SetDefault("oidc.timeout_seconds", 5)
+
+	// Sidecar defaults
+	v.SetDefault("sidecar.upstream", "")
+	v.SetDefault("sidecar.root_resource_id", "")
+	v.SetDefault("sidecar.refresh_seconds", 300)
+	v.SetDefault("sidecar.retry_seconds", 5)
+	v.SetDefault("sidecar.confirm_denials", false)
+	v.SetDefault("sidecar.tls.enabled", false)
+	v.SetDefault("sidecar.tls.min_version", "1.2")
 }
 
 func bindEnvVariables(v *viper.Viper) {
 	// Server
 	v.BindEnv("server.address")
 	v.BindEnv("server.port")
+	v.BindEnv("server.reflection")
+	v.BindEnv("server.shutdown_timeout_seconds")
+	v.BindEnv("server.trusted_caller_services")
+	v.BindEnv("server.tls.enabled")
+	v.BindEnv("server.tls.cert_file")
+	v.BindEnv("server.tls.key_file")
+	v.BindEnv("server.tls.ca_file")
+	v.BindEnv("server.tls.min_version")
+	v.BindEnv("server.tls.client_auth")
 
 	// Database
+	v.BindEnv("database.driver")
+	v.BindEnv("database.sqlite_path")
 	v.BindEnv("database.host")
 	v.BindEnv("database.port")
 	v.BindEnv("database.user")
 	v.BindEnv("database.password")
+	v.BindEnv("database.password_file")
 	v.BindEnv("database.dbname")
 	v.BindEnv("database.sslmode")
 	v.BindEnv("database.max_conns")
 	v.BindEnv("database.max_idle")
+	v.BindEnv("database.auto_migrate")
+	v.BindEnv("database.replica_dsn")
+	v.BindEnv("database.replica_health_check_seconds")
+	v.BindEnv("database.replica_read_your_writes_seconds")
+	v.BindEnv("database.sslrootcert")
+	v.BindEnv("database.sslcert")
+	v.BindEnv("database.sslkey")
+	v.BindEnv("database.conn_max_lifetime_seconds")
+	v.BindEnv("database.conn_max_idle_time_seconds")
+	v.BindEnv("database.statement_timeout_seconds")
+	v.BindEnv("database.search_path")
+	v.BindEnv("database.params")
+	v.BindEnv("database.slow_query_ms")
 
 	// Cache
 	v.BindEnv("cache.type")
@@ -138,10 +707,168 @@ func bindEnvVariables(v *viper.Viper) {
 	v.BindEnv("cache.ttl_seconds")
 	v.BindEnv("cache.max_size")
 	v.BindEnv("cache.cleanup_minutes")
+	v.BindEnv("cache.shards")
 
 	// Redis Cache
+	v.BindEnv("cache.redis.mode")
 	v.BindEnv("cache.redis.address")
+	v.BindEnv("cache.redis.addresses")
+	v.BindEnv("cache.redis.master_name")
+	v.BindEnv("cache.redis.sentinel_password")
 	v.BindEnv("cache.redis.password")
+	v.BindEnv("cache.redis.password_file")
 	v.BindEnv("cache.redis.db")
 	v.BindEnv("cache.redis.ttl_seconds")
+	v.BindEnv("cache.redis.key_prefix")
+	v.BindEnv("cache.redis.pool_size")
+	v.BindEnv("cache.redis.min_idle_conns")
+	v.BindEnv("cache.redis.pool_timeout_seconds")
+	v.BindEnv("cache.redis.conn_max_idle_time_seconds")
+	v.BindEnv("cache.redis.conn_max_lifetime_seconds")
+	v.BindEnv("cache.redis.dial_timeout_seconds")
+	v.BindEnv("cache.redis.read_timeout_seconds")
+	v.BindEnv("cache.redis.tls.enabled")
+	v.BindEnv("cache.redis.tls.cert_file")
+	v.BindEnv("cache.redis.tls.key_file")
+	v.BindEnv("cache.redis.tls.ca_file")
+	v.BindEnv("cache.redis.tls.min_version")
+	v.BindEnv("cache.redis.tls.server_name")
+	v.BindEnv("cache.redis.tls.insecure_skip_verify")
+
+	// Cache warm-up
+	v.BindEnv("cache.warmup.enabled")
+	v.BindEnv("cache.warmup.principals")
+	v.BindEnv("cache.warmup.resources")
+	v.BindEnv("cache.warmup.top_pairs")
+	v.BindEnv("cache.warmup.concurrency")
+
+	// Admin API authorization
+	v.BindEnv("authz.enabled")
+	v.BindEnv("authz.root_principals")
+	v.BindEnv("authz.root_resource_id")
+
+	// Resource hierarchy
+	v.BindEnv("resource.max_depth")
+	v.BindEnv("resource.closure_table")
+	// resource.attachment_rules and resource.default_bindings are lists of objects and can only be set in the config file
+
+	// Policy limits
+	v.BindEnv("policy_limits.max_bindings")
+	v.BindEnv("policy_limits.max_members")
+	v.BindEnv("policy_limits.max_condition_length")
+	// policy_limits.overrides is a list of objects and can only be set in the config file
+
+	// Logging
+	v.BindEnv("log.level")
+	v.BindEnv("log.format")
+
+	// Decision log
+	v.BindEnv("decision_log.enabled")
+	v.BindEnv("decision_log.sink")
+	v.BindEnv("decision_log.file_path")
+	v.BindEnv("decision_log.sample_rate")
+	v.BindEnv("decision_log.buffer_size")
+	v.BindEnv("decision_log.batch_size")
+	v.BindEnv("decision_log.flush_interval_seconds")
+
+	// Long-running operations
+	v.BindEnv("operations.workers")
+	v.BindEnv("operations.queue_size")
+
+	// Policy scan
+	v.BindEnv("policy_scan.interval_minutes")
+
+	// Integrity scan
+	v.BindEnv("integrity.interval_minutes")
+	v.BindEnv("integrity.check_groups")
+
+	// Retention
+	v.BindEnv("retention.days")
+	v.BindEnv("retention.purge_interval_minutes")
+
+	// Access review
+	v.BindEnv("access_review.close_interval_minutes")
+
+	// Replication
+	v.BindEnv("replication.mode")
+	v.BindEnv("replication.region")
+	v.BindEnv("replication.election_interval_seconds")
+
+	// Idempotency
+	v.BindEnv("idempotency.ttl_hours")
+
+	// Role
+	v.BindEnv("role.require_impact_acknowledgment")
+
+	// Evaluator
+	v.BindEnv("evaluator.backend")
+	v.BindEnv("evaluator.opa.url")
+	v.BindEnv("evaluator.opa.token")
+	v.BindEnv("evaluator.opa.token_file")
+	v.BindEnv("evaluator.opa.policy_file")
+	v.BindEnv("evaluator.opa.timeout_seconds")
+	v.BindEnv("evaluator.read_model")
+	v.BindEnv("evaluator.timeout_ms")
+	v.BindEnv("evaluator.max_in_flight")
+	v.BindEnv("evaluator.failure_mode")
+	v.BindEnv("evaluator.circuit_breaker.enabled")
+	v.BindEnv("evaluator.circuit_breaker.failure_threshold")
+	v.BindEnv("evaluator.circuit_breaker.open_seconds")
+	v.BindEnv("evaluator.stats.enabled")
+	v.BindEnv("evaluator.stats.window_seconds")
+	v.BindEnv("evaluator.stats.max_tracked")
+	v.BindEnv("evaluator.shadow.enabled")
+	v.BindEnv("evaluator.shadow.backend")
+	v.BindEnv("evaluator.shadow.read_model")
+	v.BindEnv("evaluator.shadow.sample_rate")
+	v.BindEnv("evaluator.shadow.max_in_flight")
+
+	// SCIM
+	v.BindEnv("scim.enabled")
+	v.BindEnv("scim.address")
+	v.BindEnv("scim.token")
+	v.BindEnv("scim.token_file")
+
+	// LDAP group resolution
+	v.BindEnv("ldap.enabled")
+	v.BindEnv("ldap.url")
+	v.BindEnv("ldap.insecure_skip_verify")
+	v.BindEnv("ldap.bind_dn")
+	v.BindEnv("ldap.bind_password")
+	v.BindEnv("ldap.bind_password_file")
+	v.BindEnv("ldap.base_dn")
+	v.BindEnv("ldap.user_attribute")
+	v.BindEnv("ldap.user_object_class")
+	v.BindEnv("ldap.group_attribute")
+	v.BindEnv("ldap.group_suffix")
+	v.BindEnv("ldap.timeout_seconds")
+	v.BindEnv("ldap.cache_ttl_seconds")
+	v.BindEnv("ldap.cache_size")
+
+	// OIDC
+	v.BindEnv("oidc.enabled")
+	v.BindEnv("oidc.issuer_url")
+	v.BindEnv("oidc.jwks_url")
+	v.BindEnv("oidc.audiences")
+	v.BindEnv("oidc.principal_claim")
+	v.BindEnv("oidc.service_account_suffixes")
+	v.BindEnv("oidc.groups_claim")
+	v.BindEnv("oidc.group_suffix")
+	v.BindEnv("oidc.clock_skew_seconds")
+	v.BindEnv("oidc.jwks_cache_seconds")
+	v.BindEnv("oidc.timeout_seconds")
+
+	// Sidecar
+	v.BindEnv("sidecar.upstream")
+	v.BindEnv("sidecar.root_resource_id")
+	v.BindEnv("sidecar.refresh_seconds")
+	v.BindEnv("sidecar.retry_seconds")
+	v.BindEnv("sidecar.confirm_denials")
+	v.BindEnv("sidecar.tls.enabled")
+	v.BindEnv("sidecar.tls.cert_file")
+	v.BindEnv("sidecar.tls.key_file")
+	v.BindEnv("sidecar.tls.ca_file")
+	v.BindEnv("sidecar.tls.min_version")
+	v.BindEnv("sidecar.tls.server_name")
+	v.BindEnv("sidecar.tls.insecure_skip_verify")
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,8 +20,14 @@ func TestLoad_Defaults(t *testing.T) {
 	// Verify server defaults
 	assert.Equal(t, ":8081", cfg.Server.Address)
 	assert.Equal(t, 8081, cfg.Server.Port)
+	assert.False(t, cfg.Server.Reflection)
+	assert.Equal(t, 30, cfg.Server.ShutdownTimeoutSeconds)
+	assert.False(t, cfg.Server.TLS.Enabled)
+	assert.Equal(t, "1.2", cfg.Server.TLS.MinVersion)
 
 	// Verify database defaults
+	assert.Equal(t, "postgres", cfg.Database.Driver)
+	assert.Equal(t, "iam.db", cfg.Database.SQLitePath)
 	assert.Equal(t, "localhost", cfg.Database.Host)
 	assert.Equal(t, 5432, cfg.Database.Port)
 	assert.Equal(t, "postgres", cfg.Database.User)
@@ -29,12 +36,21 @@ func TestLoad_Defaults(t *testing.T) {
 	assert.Equal(t, "disable", cfg.Database.SSLMode)
 	assert.Equal(t, 25, cfg.Database.MaxConns)
 	assert.Equal(t, 5, cfg.Database.MaxIdle)
+	assert.True(t, cfg.Database.AutoMigrate)
+	assert.Empty(t, cfg.Database.ReplicaDSN)
+	assert.Equal(t, 5, cfg.Database.ReplicaHealthCheckSeconds)
+	assert.Equal(t, 5, cfg.Database.ReplicaReadYourWritesSeconds)
+	assert.Equal(t, 0, cfg.Database.ConnMaxLifetimeSeconds)
+	assert.Equal(t, 0, cfg.Database.StatementTimeoutSeconds)
+	assert.Empty(t, cfg.Database.SearchPath)
+	assert.Empty(t, cfg.Database.Params)
 
 	// Verify cache defaults
 	assert.Equal(t, "none", cfg.Cache.Type)
 	assert.False(t, cfg.Cache.Enabled)
 	assert.Equal(t, 300, cfg.Cache.TTLSeconds)
 	assert.Equal(t, 10000, cfg.Cache.MaxSize)
+	assert.Equal(t, 32, cfg.Cache.Shards)
 	assert.Equal(t, 10, cfg.Cache.CleanupMinutes)
 
 	// Verify Redis defaults
@@ -42,6 +58,86 @@ func TestLoad_Defaults(t *testing.T) {
 	assert.Empty(t, cfg.Cache.Redis.Password)
 	assert.Equal(t, 0, cfg.Cache.Redis.DB)
 	assert.Equal(t, 300, cfg.Cache.Redis.TTLSeconds)
+	assert.Equal(t, "standalone", cfg.Cache.Redis.Mode)
+	assert.Empty(t, cfg.Cache.Redis.KeyPrefix)
+	assert.Zero(t, cfg.Cache.Redis.PoolSize)
+	assert.False(t, cfg.Cache.Redis.TLS.Enabled)
+	assert.Equal(t, "1.2", cfg.Cache.Redis.TLS.MinVersion)
+
+	// Verify cache warm-up defaults
+	assert.False(t, cfg.Cache.Warmup.Enabled)
+	assert.Empty(t, cfg.Cache.Warmup.Principals)
+	assert.Empty(t, cfg.Cache.Warmup.Resources)
+	assert.Equal(t, 0, cfg.Cache.Warmup.TopPairs)
+	assert.Equal(t, 4, cfg.Cache.Warmup.Concurrency)
+
+	// Verify admin authorization defaults
+	assert.False(t, cfg.Authz.Enabled)
+	assert.Empty(t, cfg.Authz.RootPrincipals)
+	assert.Empty(t, cfg.Authz.RootResourceID)
+
+	// Verify resource hierarchy defaults
+	assert.Equal(t, 32, cfg.Resource.MaxDepth)
+	assert.False(t, cfg.Resource.ClosureTable)
+	assert.Empty(t, cfg.Resource.AttachmentRules)
+
+	// Verify policy limit defaults
+	assert.Equal(t, 1500, cfg.PolicyLimits.MaxBindings)
+	assert.Equal(t, 1500, cfg.PolicyLimits.MaxMembers)
+	assert.Equal(t, 12288, cfg.PolicyLimits.MaxConditionLength)
+	assert.Empty(t, cfg.PolicyLimits.Overrides)
+
+	// Verify logging defaults
+	assert.Equal(t, "info", cfg.Log.Level)
+	assert.Equal(t, "json", cfg.Log.Format)
+
+	// Verify long-running operation defaults
+	assert.Equal(t, 2, cfg.Operations.Workers)
+	assert.Equal(t, 100, cfg.Operations.QueueSize)
+	assert.Equal(t, 0, cfg.PolicyScan.IntervalMinutes)
+	assert.Equal(t, 30, cfg.Retention.Days)
+	assert.Equal(t, 0, cfg.Retention.PurgeIntervalMinutes)
+	assert.Equal(t, 0, cfg.AccessReview.CloseIntervalMinutes)
+	assert.Equal(t, 24, cfg.Idempotency.TTLHours)
+	assert.False(t, cfg.Role.RequireImpactAcknowledgment)
+
+	// Verify evaluator defaults
+	assert.Equal(t, "native", cfg.Evaluator.Backend)
+	assert.Equal(t, "http://localhost:8181", cfg.Evaluator.OPA.URL)
+	assert.Equal(t, 2, cfg.Evaluator.OPA.TimeoutSeconds)
+	assert.False(t, cfg.Evaluator.ReadModel)
+	assert.Equal(t, 0, cfg.Evaluator.TimeoutMS)
+	assert.Equal(t, "closed", cfg.Evaluator.FailureMode)
+	assert.False(t, cfg.Evaluator.CircuitBreaker.Enabled)
+	assert.Equal(t, 5, cfg.Evaluator.CircuitBreaker.FailureThreshold)
+	assert.Equal(t, 30, cfg.Evaluator.CircuitBreaker.OpenSeconds)
+
+	// Verify SCIM defaults
+	assert.False(t, cfg.SCIM.Enabled)
+	assert.Equal(t, ":8082", cfg.SCIM.Address)
+	assert.Empty(t, cfg.SCIM.Token)
+
+	// Verify LDAP defaults
+	assert.False(t, cfg.LDAP.Enabled)
+	assert.Equal(t, "mail", cfg.LDAP.UserAttribute)
+	assert.Equal(t, "memberOf", cfg.LDAP.GroupAttribute)
+	assert.Equal(t, 2, cfg.LDAP.TimeoutSeconds)
+	assert.Equal(t, 300, cfg.LDAP.CacheTTLSeconds)
+	assert.Equal(t, 10000, cfg.LDAP.CacheSize)
+
+	// Verify OIDC defaults
+	assert.False(t, cfg.OIDC.Enabled)
+	assert.Equal(t, "email", cfg.OIDC.PrincipalClaim)
+	assert.Equal(t, "groups", cfg.OIDC.GroupsClaim)
+	assert.Equal(t, 60, cfg.OIDC.ClockSkewSeconds)
+	assert.Equal(t, 3600, cfg.OIDC.JWKSCacheSeconds)
+	assert.Equal(t, 5, cfg.OIDC.TimeoutSeconds)
+
+	// Verify sidecar defaults
+	assert.Empty(t, cfg.Sidecar.Upstream)
+	assert.Equal(t, 300, cfg.Sidecar.RefreshSeconds)
+	assert.Equal(t, 5, cfg.Sidecar.RetrySeconds)
+	assert.False(t, cfg.Sidecar.ConfirmDenials)
 }
 
 func TestLoad_WithEnvironmentVariables(t *testing.T) {
@@ -189,6 +285,105 @@ func TestLoad_DatabaseConnectionPoolSettings(t *testing.T) {
 	assert.Equal(t, 20, cfg.Database.MaxIdle)
 }
 
+func TestLoad_AuthzSettings(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	os.Setenv("IAM_AUTHZ_ENABLED", "true")
+	os.Setenv("IAM_AUTHZ_ROOT_PRINCIPALS", "user:root@example.com,serviceAccount:bootstrap@example.com")
+	os.Setenv("IAM_AUTHZ_ROOT_RESOURCE_ID", "6f1c1d9e-4c0e-4d3b-9a53-1f6f7a8b9c0d")
+
+	defer clearIAMEnvVars(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.Authz.Enabled)
+	assert.Equal(t, []string{"user:root@example.com", "serviceAccount:bootstrap@example.com"}, cfg.Authz.RootPrincipals)
+	assert.Equal(t, "6f1c1d9e-4c0e-4d3b-9a53-1f6f7a8b9c0d", cfg.Authz.RootResourceID)
+}
+
+func TestLoad_AttachmentRulesFromFile(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	dir := t.TempDir()
+	content := `resource:
+  attachment_rules:
+    - role: roles/owner
+      resource_types: [organization]
+    - role: roles/storage.admin
+      resource_types: [project, bucket]
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0o600))
+	t.Chdir(dir)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, []AttachmentRule{
+		{Role: "roles/owner", ResourceTypes: []string{"organization"}},
+		{Role: "roles/storage.admin", ResourceTypes: []string{"project", "bucket"}},
+	}, cfg.Resource.AttachmentRules)
+}
+
+func TestLoad_PolicyLimitOverridesFromFile(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	dir := t.TempDir()
+	content := `policy_limits:
+  max_bindings: 100
+  overrides:
+    - resource_id: 5a8f0c1e-7d3b-4c2a-9e6f-1b2c3d4e5f60
+      max_bindings: 500
+      max_depth: 4
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0o600))
+	t.Chdir(dir)
+	t.Setenv("IAM_POLICY_LIMITS_MAX_MEMBERS", "50")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 100, cfg.PolicyLimits.MaxBindings)
+	assert.Equal(t, 50, cfg.PolicyLimits.MaxMembers)
+	assert.Equal(t, []PolicyLimitOverride{
+		{ResourceID: "5a8f0c1e-7d3b-4c2a-9e6f-1b2c3d4e5f60", MaxBindings: 500, MaxDepth: 4},
+	}, cfg.PolicyLimits.Overrides)
+}
+
+func TestLoad_LogSettings(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	os.Setenv("IAM_LOG_LEVEL", "debug")
+	os.Setenv("IAM_LOG_FORMAT", "text")
+
+	defer clearIAMEnvVars(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, "text", cfg.Log.Format)
+}
+
+func TestLoad_DecisionLogSettings(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.False(t, cfg.DecisionLog.Enabled)
+	assert.Equal(t, "db", cfg.DecisionLog.Sink)
+	assert.Equal(t, 1.0, cfg.DecisionLog.SampleRate)
+	assert.Equal(t, 10000, cfg.DecisionLog.BufferSize)
+
+	os.Setenv("IAM_DECISION_LOG_ENABLED", "true")
+	os.Setenv("IAM_DECISION_LOG_SINK", "file")
+	os.Setenv("IAM_DECISION_LOG_FILE_PATH", "/var/log/iam/decisions.log")
+	os.Setenv("IAM_DECISION_LOG_SAMPLE_RATE", "0.1")
+
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.DecisionLog.Enabled)
+	assert.Equal(t, "file", cfg.DecisionLog.Sink)
+	assert.Equal(t, "/var/log/iam/decisions.log", cfg.DecisionLog.FilePath)
+	assert.Equal(t, 0.1, cfg.DecisionLog.SampleRate)
+}
+
 func TestLoad_ServerAddressFormats(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -271,23 +466,129 @@ func clearIAMEnvVars(t *testing.T) {
 	envVars := []string{
 		"IAM_SERVER_ADDRESS",
 		"IAM_SERVER_PORT",
+		"IAM_SERVER_REFLECTION",
+		"IAM_SERVER_SHUTDOWN_TIMEOUT_SECONDS",
+		"IAM_SERVER_TLS_ENABLED",
+		"IAM_SERVER_TLS_CERT_FILE",
+		"IAM_SERVER_TLS_KEY_FILE",
+		"IAM_SERVER_TLS_CA_FILE",
+		"IAM_SERVER_TLS_MIN_VERSION",
+		"IAM_SERVER_TLS_CLIENT_AUTH",
+		"IAM_DATABASE_DRIVER",
+		"IAM_DATABASE_SQLITE_PATH",
 		"IAM_DATABASE_HOST",
 		"IAM_DATABASE_PORT",
 		"IAM_DATABASE_USER",
 		"IAM_DATABASE_PASSWORD",
+		"IAM_DATABASE_PASSWORD_FILE",
 		"IAM_DATABASE_DBNAME",
 		"IAM_DATABASE_SSLMODE",
 		"IAM_DATABASE_MAX_CONNS",
 		"IAM_DATABASE_MAX_IDLE",
+		"IAM_DATABASE_AUTO_MIGRATE",
+		"IAM_DATABASE_REPLICA_DSN",
+		"IAM_DATABASE_REPLICA_HEALTH_CHECK_SECONDS",
+		"IAM_DATABASE_SSLROOTCERT",
+		"IAM_DATABASE_SSLCERT",
+		"IAM_DATABASE_SSLKEY",
+		"IAM_DATABASE_CONN_MAX_LIFETIME_SECONDS",
+		"IAM_DATABASE_CONN_MAX_IDLE_TIME_SECONDS",
+		"IAM_DATABASE_STATEMENT_TIMEOUT_SECONDS",
+		"IAM_DATABASE_SEARCH_PATH",
+		"IAM_DATABASE_PARAMS",
 		"IAM_CACHE_TYPE",
 		"IAM_CACHE_ENABLED",
 		"IAM_CACHE_TTL_SECONDS",
 		"IAM_CACHE_MAX_SIZE",
 		"IAM_CACHE_CLEANUP_MINUTES",
+		"IAM_CACHE_SHARDS",
 		"IAM_CACHE_REDIS_ADDRESS",
 		"IAM_CACHE_REDIS_PASSWORD",
+		"IAM_CACHE_REDIS_PASSWORD_FILE",
 		"IAM_CACHE_REDIS_DB",
 		"IAM_CACHE_REDIS_TTL_SECONDS",
+		"IAM_CACHE_REDIS_TLS_ENABLED",
+		"IAM_CACHE_REDIS_TLS_CERT_FILE",
+		"IAM_CACHE_REDIS_TLS_KEY_FILE",
+		"IAM_CACHE_REDIS_TLS_CA_FILE",
+		"IAM_CACHE_REDIS_TLS_MIN_VERSION",
+		"IAM_CACHE_REDIS_TLS_SERVER_NAME",
+		"IAM_CACHE_REDIS_TLS_INSECURE_SKIP_VERIFY",
+		"IAM_CACHE_WARMUP_ENABLED",
+		"IAM_CACHE_WARMUP_PRINCIPALS",
+		"IAM_CACHE_WARMUP_RESOURCES",
+		"IAM_CACHE_WARMUP_TOP_PAIRS",
+		"IAM_CACHE_WARMUP_CONCURRENCY",
+		"IAM_AUTHZ_ENABLED",
+		"IAM_AUTHZ_ROOT_PRINCIPALS",
+		"IAM_AUTHZ_ROOT_RESOURCE_ID",
+		"IAM_RESOURCE_MAX_DEPTH",
+		"IAM_RESOURCE_CLOSURE_TABLE",
+		"IAM_POLICY_LIMITS_MAX_BINDINGS",
+		"IAM_POLICY_LIMITS_MAX_MEMBERS",
+		"IAM_POLICY_LIMITS_MAX_CONDITION_LENGTH",
+		"IAM_LOG_LEVEL",
+		"IAM_LOG_FORMAT",
+		"IAM_OPERATIONS_WORKERS",
+		"IAM_OPERATIONS_QUEUE_SIZE",
+		"IAM_POLICY_SCAN_INTERVAL_MINUTES",
+		"IAM_RETENTION_DAYS",
+		"IAM_RETENTION_PURGE_INTERVAL_MINUTES",
+		"IAM_IDEMPOTENCY_TTL_HOURS",
+		"IAM_ROLE_REQUIRE_IMPACT_ACKNOWLEDGMENT",
+		"IAM_EVALUATOR_BACKEND",
+		"IAM_EVALUATOR_OPA_URL",
+		"IAM_EVALUATOR_OPA_TOKEN",
+		"IAM_EVALUATOR_OPA_TOKEN_FILE",
+		"IAM_EVALUATOR_OPA_POLICY_FILE",
+		"IAM_EVALUATOR_OPA_TIMEOUT_SECONDS",
+		"IAM_EVALUATOR_TIMEOUT_MS",
+		"IAM_EVALUATOR_MAX_IN_FLIGHT",
+		"IAM_EVALUATOR_FAILURE_MODE",
+		"IAM_EVALUATOR_CIRCUIT_BREAKER_ENABLED",
+		"IAM_EVALUATOR_CIRCUIT_BREAKER_FAILURE_THRESHOLD",
+		"IAM_EVALUATOR_CIRCUIT_BREAKER_OPEN_SECONDS",
+		"IAM_SCIM_ENABLED",
+		"IAM_SCIM_ADDRESS",
+		"IAM_SCIM_TOKEN",
+		"IAM_SCIM_TOKEN_FILE",
+		"IAM_LDAP_ENABLED",
+		"IAM_LDAP_URL",
+		"IAM_LDAP_INSECURE_SKIP_VERIFY",
+		"IAM_LDAP_BIND_DN",
+		"IAM_LDAP_BIND_PASSWORD",
+		"IAM_LDAP_BIND_PASSWORD_FILE",
+		"IAM_LDAP_BASE_DN",
+		"IAM_LDAP_USER_ATTRIBUTE",
+		"IAM_LDAP_USER_OBJECT_CLASS",
+		"IAM_LDAP_GROUP_ATTRIBUTE",
+		"IAM_LDAP_GROUP_SUFFIX",
+		"IAM_LDAP_TIMEOUT_SECONDS",
+		"IAM_LDAP_CACHE_TTL_SECONDS",
+		"IAM_LDAP_CACHE_SIZE",
+		"IAM_OIDC_ENABLED",
+		"IAM_OIDC_ISSUER_URL",
+		"IAM_OIDC_JWKS_URL",
+		"IAM_OIDC_AUDIENCES",
+		"IAM_OIDC_PRINCIPAL_CLAIM",
+		"IAM_OIDC_SERVICE_ACCOUNT_SUFFIXES",
+		"IAM_OIDC_GROUPS_CLAIM",
+		"IAM_OIDC_GROUP_SUFFIX",
+		"IAM_OIDC_CLOCK_SKEW_SECONDS",
+		"IAM_OIDC_JWKS_CACHE_SECONDS",
+		"IAM_OIDC_TIMEOUT_SECONDS",
+		"IAM_SIDECAR_UPSTREAM",
+		"IAM_SIDECAR_ROOT_RESOURCE_ID",
+		"IAM_SIDECAR_REFRESH_SECONDS",
+		"IAM_SIDECAR_RETRY_SECONDS",
+		"IAM_SIDECAR_CONFIRM_DENIALS",
+		"IAM_DECISION_LOG_ENABLED",
+		"IAM_DECISION_LOG_SINK",
+		"IAM_DECISION_LOG_FILE_PATH",
+		"IAM_DECISION_LOG_SAMPLE_RATE",
+		"IAM_DECISION_LOG_BUFFER_SIZE",
+		"IAM_DECISION_LOG_BATCH_SIZE",
+		"IAM_DECISION_LOG_FLUSH_INTERVAL_SECONDS",
 	}
 
 	for _, envVar := range envVars {
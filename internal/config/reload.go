@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Store holds the active configuration; reloads swap it atomically
+type Store struct {
+	current atomic.Pointer[Config]
+}
+
+// NewStore creates a store holding cfg
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the active configuration. Callers must not modify it.
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Swap makes next the active configuration and returns the previous one
+func (s *Store) Swap(next *Config) *Config {
+	return s.current.Swap(next)
+}
+
+// MergeReloadable returns a copy of current with the settings that can change without a
+// restart taken from loaded:
+//   - log.level
+//   - cache.ttl_seconds and cache.redis.ttl_seconds
+//   - decision_log.sample_rate
+//
+// Changes to any other section of loaded are ignored; their keys are returned in ignored
+// so callers can report that a restart is needed.
+func MergeReloadable(current, loaded *Config) (next *Config, ignored []string) {
+	merged := *current
+	merged.Log.Level = loaded.Log.Level
+	merged.Cache.TTLSeconds = loaded.Cache.TTLSeconds
+	merged.Cache.Redis.TTLSeconds = loaded.Cache.Redis.TTLSeconds
+	merged.DecisionLog.SampleRate = loaded.DecisionLog.SampleRate
+
+	sections := []struct {
+		key            string
+		merged, loaded interface{}
+	}{
+		{"server", merged.Server, loaded.Server},
+		{"database", merged.Database, loaded.Database},
+		{"cache", merged.Cache, loaded.Cache},
+		{"authz", merged.Authz, loaded.Authz},
+		{"resource", merged.Resource, loaded.Resource},
+		{"log", merged.Log, loaded.Log},
+		{"decision_log", merged.DecisionLog, loaded.DecisionLog},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.merged, section.loaded) {
+			ignored = append(ignored, section.key)
+		}
+	}
+
+	return &merged, ignored
+}
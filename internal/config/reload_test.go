@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Swap(t *testing.T) {
+	first := &Config{Log: LogConfig{Level: "info"}}
+	second := &Config{Log: LogConfig{Level: "debug"}}
+
+	store := NewStore(first)
+	assert.Same(t, first, store.Get())
+
+	assert.Same(t, first, store.Swap(second))
+	assert.Same(t, second, store.Get())
+}
+
+func TestMergeReloadable(t *testing.T) {
+	current := &Config{
+		Database:    DatabaseConfig{Host: "db-1"},
+		Cache:       CacheConfig{Type: "memory", TTLSeconds: 300, Redis: RedisCacheConfig{TTLSeconds: 300}},
+		Log:         LogConfig{Level: "info", Format: "json"},
+		DecisionLog: DecisionLogConfig{SampleRate: 1},
+	}
+	loaded := &Config{
+		Database:    DatabaseConfig{Host: "db-2"}, // Structural: needs a restart
+		Cache:       CacheConfig{Type: "memory", TTLSeconds: 60, Redis: RedisCacheConfig{TTLSeconds: 30}},
+		Log:         LogConfig{Level: "debug", Format: "json"},
+		DecisionLog: DecisionLogConfig{SampleRate: 0.1},
+	}
+
+	next, ignored := MergeReloadable(current, loaded)
+
+	assert.Equal(t, "debug", next.Log.Level)
+	assert.Equal(t, 60, next.Cache.TTLSeconds)
+	assert.Equal(t, 30, next.Cache.Redis.TTLSeconds)
+	assert.Equal(t, 0.1, next.DecisionLog.SampleRate)
+	assert.Equal(t, "db-1", next.Database.Host)
+	assert.Equal(t, []string{"database"}, ignored)
+
+	// current is not modified
+	assert.Equal(t, "info", current.Log.Level)
+	assert.Equal(t, 300, current.Cache.TTLSeconds)
+}
+
+func TestMergeReloadable_NoChanges(t *testing.T) {
+	current := &Config{Cache: CacheConfig{Warmup: CacheWarmupConfig{Principals: []string{"user:alice@example.com"}}}}
+	loaded := &Config{Cache: CacheConfig{Warmup: CacheWarmupConfig{Principals: []string{"user:alice@example.com"}}}}
+
+	next, ignored := MergeReloadable(current, loaded)
+
+	assert.Equal(t, current, next)
+	assert.Empty(t, ignored)
+}
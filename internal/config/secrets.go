@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultPrefix marks a secret stored in HashiCorp Vault: "vault:<path>#<key>", e.g.
+// "vault:secret/data/iam#db_password". The server is read from VAULT_ADDR and the token
+// from VAULT_TOKEN; both KV version 1 and 2 paths are supported.
+const vaultPrefix = "vault:"
+
+// vaultTimeout bounds each Vault request made while loading the configuration
+const vaultTimeout = 10 * time.Second
+
+// resolveSecrets replaces secret settings with their values read from *_file paths
+// (e.g. Docker or Kubernetes secret mounts) or from Vault
+func resolveSecrets(cfg *Config) error {
+	secrets := []struct {
+		key   string
+		value *string
+		file  string
+	}{
+		{"database.password", &cfg.Database.Password, cfg.Database.PasswordFile},
+		{"cache.redis.password", &cfg.Cache.Redis.Password, cfg.Cache.Redis.PasswordFile},
+		{"cache.redis.sentinel_password", &cfg.Cache.Redis.SentinelPassword, ""},
+		{"scim.token", &cfg.SCIM.Token, cfg.SCIM.TokenFile},
+		{"ldap.bind_password", &cfg.LDAP.BindPassword, cfg.LDAP.BindPasswordFile},
+		{"evaluator.opa.token", &cfg.Evaluator.OPA.Token, cfg.Evaluator.OPA.TokenFile},
+	}
+
+	for _, secret := range secrets {
+		value, err := resolveSecret(*secret.value, secret.file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", secret.key, err)
+		}
+		*secret.value = value
+	}
+	return nil
+}
+
+// resolveSecret returns the contents of file when set, the Vault secret referenced by value,
+// or value itself
+func resolveSecret(value, file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if strings.HasPrefix(value, vaultPrefix) {
+		return readVaultSecret(strings.TrimPrefix(value, vaultPrefix))
+	}
+
+	return value, nil
+}
+
+// readVaultSecret reads "<path>#<key>" from the Vault server configured in the environment
+func readVaultSecret(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q (expected vault:<path>#<key>)", vaultPrefix+ref)
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is required for vault references")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	client := &http.Client{Timeout: vaultTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read vault secret %s: status %d", path, resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV version 2 nests the secret's fields under data.data
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %q", path, key)
+	}
+	return value, nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_PasswordFiles(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "db_password")
+	redisFile := filepath.Join(dir, "redis_password")
+	scimFile := filepath.Join(dir, "scim_token")
+	require.NoError(t, os.WriteFile(dbFile, []byte("s3cret\n"), 0o600))
+	require.NoError(t, os.WriteFile(redisFile, []byte("r3dis"), 0o600))
+	require.NoError(t, os.WriteFile(scimFile, []byte("sc1m\n"), 0o600))
+
+	os.Setenv("IAM_DATABASE_PASSWORD", "ignored")
+	os.Setenv("IAM_DATABASE_PASSWORD_FILE", dbFile)
+	os.Setenv("IAM_CACHE_REDIS_PASSWORD_FILE", redisFile)
+	os.Setenv("IAM_SCIM_TOKEN_FILE", scimFile)
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Database.Password)
+	assert.Equal(t, "r3dis", cfg.Cache.Redis.Password)
+	assert.Equal(t, "sc1m", cfg.SCIM.Token)
+}
+
+func TestLoad_PasswordFileMissing(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	os.Setenv("IAM_DATABASE_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "database.password")
+}
+
+func TestLoad_VaultSecret(t *testing.T) {
+	clearIAMEnvVars(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/iam": // KV version 2
+			w.Write([]byte(`{"data": {"data": {"db_password": "from-vault"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/iam": // KV version 1
+			w.Write([]byte(`{"data": {"redis_password": "kv1-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+	os.Setenv("IAM_DATABASE_PASSWORD", "vault:secret/data/iam#db_password")
+	os.Setenv("IAM_CACHE_REDIS_PASSWORD", "vault:kv/iam#redis_password")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", cfg.Database.Password)
+	assert.Equal(t, "kv1-secret", cfg.Cache.Redis.Password)
+}
+
+func TestResolveSecret_VaultErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"data": {"other": "value"}}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+
+	_, err := resolveSecret("vault:secret/data/iam", "")
+	assert.ErrorContains(t, err, "invalid vault reference")
+
+	_, err = resolveSecret("vault:secret/data/iam#db_password", "")
+	assert.ErrorContains(t, err, `no string field "db_password"`)
+
+	t.Setenv("VAULT_ADDR", "")
+	_, err = resolveSecret("vault:secret/data/iam#db_password", "")
+	assert.ErrorContains(t, err, "VAULT_ADDR")
+}
+
+func TestResolveSecret_Plain(t *testing.T) {
+	value, err := resolveSecret("postgres", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres", value)
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ValidationError lists every invalid setting of a configuration
+type ValidationError struct {
+	Problems []string // One "<key>: <problem>" entry per invalid setting
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// validator collects the problems found by Validate
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) port(key string, value int) {
+	if value < 1 || value > 65535 {
+		v.addf(key, "must be between 1 and 65535, got %d", value)
+	}
+}
+
+func (v *validator) positive(key string, value int) {
+	if value <= 0 {
+		v.addf(key, "must be positive, got %d", value)
+	}
+}
+
+func (v *validator) nonNegative(key string, value int) {
+	if value < 0 {
+		v.addf(key, "must not be negative, got %d", value)
+	}
+}
+
+// required reports an empty value; when names the setting making it required, if any
+func (v *validator) required(key, value, when string) {
+	if strings.TrimSpace(value) != "" {
+		return
+	}
+	if when == "" {
+		v.addf(key, "is required")
+		return
+	}
+	v.addf(key, "is required %s", when)
+}
+
+// oneOf reports a value missing from valid; an empty value selects the default
+func (v *validator) oneOf(key, value string, valid ...string) {
+	if value == "" {
+		return
+	}
+	for _, candidate := range valid {
+		if value == candidate {
+			return
+		}
+	}
+	v.addf(key, "unsupported value %q (valid: %s)", value, strings.Join(valid, ", "))
+}
+
+func (v *validator) tls(key string, cfg TLSConfig, server bool) {
+	if !cfg.Enabled {
+		return
+	}
+	v.oneOf(key+".min_version", cfg.MinVersion, "1.2", "1.3")
+	if server {
+		v.required(key+".cert_file", cfg.CertFile, "when "+key+".enabled is set")
+		v.required(key+".key_file", cfg.KeyFile, "when "+key+".enabled is set")
+		v.oneOf(key+".client_auth", cfg.ClientAuth, "none", "request", "require", "verify_if_given", "require_and_verify")
+	} else if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		v.addf(key, "cert_file and key_file must be set together")
+	}
+}
+
+func (v *validator) redis(key string, cfg *RedisCacheConfig) {
+	mode := strings.ToLower(cfg.Mode)
+	v.oneOf(key+".mode", mode, "standalone", "cluster", "sentinel")
+	switch mode {
+	case "cluster":
+		if len(cfg.Addresses) == 0 {
+			v.addf(key+".addresses", "is required when %s.mode is cluster", key)
+		}
+		if cfg.DB != 0 {
+			v.addf(key+".db", "is not supported when %s.mode is cluster", key)
+		}
+	case "sentinel":
+		if len(cfg.Addresses) == 0 {
+			v.addf(key+".addresses", "is required when %s.mode is sentinel", key)
+		}
+		v.required(key+".master_name", cfg.MasterName, "when "+key+".mode is sentinel")
+	default:
+		v.required(key+".address", cfg.Address, "when cache.type is redis")
+	}
+	v.positive(key+".ttl_seconds", cfg.TTLSeconds)
+	v.nonNegative(key+".db", cfg.DB)
+	v.nonNegative(key+".pool_size", cfg.PoolSize)
+	v.nonNegative(key+".min_idle_conns", cfg.MinIdleConns)
+	if cfg.PoolSize > 0 && cfg.MinIdleConns > cfg.PoolSize {
+		v.addf(key+".min_idle_conns", "must not exceed %s.pool_size (%d), got %d", key, cfg.PoolSize, cfg.MinIdleConns)
+	}
+	v.nonNegative(key+".pool_timeout_seconds", cfg.PoolTimeoutSeconds)
+	v.nonNegative(key+".conn_max_idle_time_seconds", cfg.ConnMaxIdleTimeSeconds)
+	v.nonNegative(key+".conn_max_lifetime_seconds", cfg.ConnMaxLifetimeSeconds)
+	v.nonNegative(key+".dial_timeout_seconds", cfg.DialTimeoutSeconds)
+	v.nonNegative(key+".read_timeout_seconds", cfg.ReadTimeoutSeconds)
+	v.tls(key+".tls", cfg.TLS, false)
+}
+
+// Validate checks the configuration for values and combinations the server cannot start with.
+// All problems are reported at once in a *ValidationError.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	// Server
+	v.port("server.port", c.Server.Port)
+	v.nonNegative("server.shutdown_timeout_seconds", c.Server.ShutdownTimeoutSeconds)
+	v.tls("server.tls", c.Server.TLS, true)
+
+	// Database
+	v.oneOf("database.driver", c.Database.Driver, "postgres", "sqlite")
+	if c.Database.Driver == "sqlite" {
+		v.required("database.sqlite_path", c.Database.SQLitePath, "when database.driver is sqlite")
+		if c.Database.ReplicaDSN != "" {
+			v.addf("database.replica_dsn", "is not supported when database.driver is sqlite")
+		}
+	} else {
+		v.required("database.host", c.Database.Host, "")
+		v.port("database.port", c.Database.Port)
+		v.required("database.dbname", c.Database.DBName, "")
+	}
+	v.positive("database.max_conns", c.Database.MaxConns)
+	v.nonNegative("database.max_idle", c.Database.MaxIdle)
+	if c.Database.MaxIdle > c.Database.MaxConns && c.Database.MaxConns > 0 {
+		v.addf("database.max_idle", "must not exceed database.max_conns (%d), got %d", c.Database.MaxConns, c.Database.MaxIdle)
+	}
+	if c.Database.ReplicaDSN != "" {
+		v.positive("database.replica_health_check_seconds", c.Database.ReplicaHealthCheckSeconds)
+	}
+	v.nonNegative("database.conn_max_lifetime_seconds", c.Database.ConnMaxLifetimeSeconds)
+	v.nonNegative("database.conn_max_idle_time_seconds", c.Database.ConnMaxIdleTimeSeconds)
+	v.nonNegative("database.statement_timeout_seconds", c.Database.StatementTimeoutSeconds)
+	v.nonNegative("database.slow_query_ms", c.Database.SlowQueryMS)
+
+	// Replication
+	v.oneOf("replication.mode", c.Replication.Mode, "single-writer")
+	if c.Replication.Mode == "single-writer" {
+		v.required("replication.region", c.Replication.Region, "when replication.mode is single-writer")
+		v.positive("replication.election_interval_seconds", c.Replication.ElectionIntervalSeconds)
+		if c.Database.Driver == "sqlite" {
+			v.addf("replication.mode", "single-writer is not supported when database.driver is sqlite")
+		}
+	}
+
+	// Cache
+	v.oneOf("cache.type", strings.ToLower(c.Cache.Type), "none", "memory", "redis")
+	if c.Cache.Enabled {
+		v.positive("cache.ttl_seconds", c.Cache.TTLSeconds)
+		switch strings.ToLower(c.Cache.Type) {
+		case "memory":
+			v.positive("cache.max_size", c.Cache.MaxSize)
+			v.positive("cache.cleanup_minutes", c.Cache.CleanupMinutes)
+			v.positive("cache.shards", c.Cache.Shards)
+		case "redis":
+			v.redis("cache.redis", &c.Cache.Redis)
+		}
+	}
+	if c.Cache.Warmup.Enabled {
+		v.nonNegative("cache.warmup.top_pairs", c.Cache.Warmup.TopPairs)
+		v.positive("cache.warmup.concurrency", c.Cache.Warmup.Concurrency)
+	}
+
+	// Resources
+	v.positive("resource.max_depth", c.Resource.MaxDepth)
+	v.nonNegative("policy_limits.max_bindings", c.PolicyLimits.MaxBindings)
+	v.nonNegative("policy_limits.max_members", c.PolicyLimits.MaxMembers)
+	v.nonNegative("policy_limits.max_condition_length", c.PolicyLimits.MaxConditionLength)
+	overridden := make(map[uuid.UUID]bool, len(c.PolicyLimits.Overrides))
+	for i, override := range c.PolicyLimits.Overrides {
+		key := fmt.Sprintf("policy_limits.overrides[%d]", i)
+		id, err := uuid.Parse(override.ResourceID)
+		if err != nil {
+			v.addf(key+".resource_id", "must be a resource ID, got %q", override.ResourceID)
+		} else if overridden[id] {
+			v.addf(key+".resource_id", "duplicates an earlier override of %s", id)
+		}
+		overridden[id] = true
+		v.nonNegative(key+".max_bindings", override.MaxBindings)
+		v.nonNegative(key+".max_members", override.MaxMembers)
+		v.nonNegative(key+".max_condition_length", override.MaxConditionLength)
+		v.nonNegative(key+".max_depth", override.MaxDepth)
+		if override.MaxDepth > c.Resource.MaxDepth && c.Resource.MaxDepth > 0 {
+			v.addf(key+".max_depth", "must not exceed resource.max_depth (%d), got %d", c.Resource.MaxDepth, override.MaxDepth)
+		}
+	}
+
+	// Logging
+	v.oneOf("log.level", strings.ToLower(c.Log.Level), "debug", "info", "warn", "warning", "error")
+	v.oneOf("log.format", strings.ToLower(c.Log.Format), "json", "text")
+	if c.DecisionLog.Enabled {
+		v.oneOf("decision_log.sink", strings.ToLower(c.DecisionLog.Sink), "db", "file")
+		if strings.EqualFold(c.DecisionLog.Sink, "file") {
+			v.required("decision_log.file_path", c.DecisionLog.FilePath, "when decision_log.sink is file")
+		}
+		v.positive("decision_log.buffer_size", c.DecisionLog.BufferSize)
+		v.positive("decision_log.batch_size", c.DecisionLog.BatchSize)
+		v.positive("decision_log.flush_interval_seconds", c.DecisionLog.FlushIntervalSeconds)
+	}
+	if c.DecisionLog.SampleRate < 0 || c.DecisionLog.SampleRate > 1 {
+		v.addf("decision_log.sample_rate", "must be between 0 and 1, got %v", c.DecisionLog.SampleRate)
+	}
+
+	// Background jobs
+	v.positive("operations.workers", c.Operations.Workers)
+	v.nonNegative("operations.queue_size", c.Operations.QueueSize)
+	v.nonNegative("policy_scan.interval_minutes", c.PolicyScan.IntervalMinutes)
+	v.nonNegative("integrity.interval_minutes", c.Integrity.IntervalMinutes)
+	v.nonNegative("retention.days", c.Retention.Days)
+	v.nonNegative("retention.purge_interval_minutes", c.Retention.PurgeIntervalMinutes)
+	v.nonNegative("access_review.close_interval_minutes", c.AccessReview.CloseIntervalMinutes)
+	if c.Retention.PurgeIntervalMinutes > 0 && c.Retention.Days == 0 {
+		v.addf("retention.days", "is required when retention.purge_interval_minutes is set")
+	}
+	v.nonNegative("idempotency.ttl_hours", c.Idempotency.TTLHours)
+
+	// Evaluator
+	v.oneOf("evaluator.backend", c.Evaluator.Backend, "native", "opa")
+	if c.Evaluator.Backend == "opa" {
+		v.required("evaluator.opa.url", c.Evaluator.OPA.URL, "when evaluator.backend is opa")
+		v.positive("evaluator.opa.timeout_seconds", c.Evaluator.OPA.TimeoutSeconds)
+	}
+	v.nonNegative("evaluator.timeout_ms", c.Evaluator.TimeoutMS)
+	v.nonNegative("evaluator.max_in_flight", c.Evaluator.MaxInFlight)
+	v.oneOf("evaluator.failure_mode", c.Evaluator.FailureMode, "closed", "open")
+	if c.Evaluator.CircuitBreaker.Enabled {
+		v.positive("evaluator.circuit_breaker.failure_threshold", c.Evaluator.CircuitBreaker.FailureThreshold)
+		v.positive("evaluator.circuit_breaker.open_seconds", c.Evaluator.CircuitBreaker.OpenSeconds)
+	}
+	if c.Evaluator.Shadow.Enabled {
+		v.oneOf("evaluator.shadow.backend", c.Evaluator.Shadow.Backend, "native", "opa")
+		if c.Evaluator.Shadow.Backend == "opa" && c.Evaluator.Backend != "opa" {
+			v.required("evaluator.opa.url", c.Evaluator.OPA.URL, "when evaluator.shadow.backend is opa")
+			v.positive("evaluator.opa.timeout_seconds", c.Evaluator.OPA.TimeoutSeconds)
+		}
+		if c.Evaluator.Shadow.SampleRate < 0 || c.Evaluator.Shadow.SampleRate > 1 {
+			v.addf("evaluator.shadow.sample_rate", "must be between 0 and 1, got %v", c.Evaluator.Shadow.SampleRate)
+		}
+		v.positive("evaluator.shadow.max_in_flight", c.Evaluator.Shadow.MaxInFlight)
+	}
+
+	// Identity integrations
+	if c.SCIM.Enabled {
+		v.required("scim.address", c.SCIM.Address, "when scim.enabled is set")
+		v.required("scim.token", c.SCIM.Token, "when scim.enabled is set")
+	}
+	if c.LDAP.Enabled {
+		v.required("ldap.url", c.LDAP.URL, "when ldap.enabled is set")
+		v.required("ldap.base_dn", c.LDAP.BaseDN, "when ldap.enabled is set")
+		v.required("ldap.user_attribute", c.LDAP.UserAttribute, "when ldap.enabled is set")
+		v.positive("ldap.timeout_seconds", c.LDAP.TimeoutSeconds)
+		v.nonNegative("ldap.cache_ttl_seconds", c.LDAP.CacheTTLSeconds)
+		v.nonNegative("ldap.cache_size", c.LDAP.CacheSize)
+	}
+	if c.OIDC.Enabled {
+		v.required("oidc.issuer_url", c.OIDC.IssuerURL, "when oidc.enabled is set")
+		if len(c.OIDC.Audiences) == 0 {
+			v.addf("oidc.audiences", "at least one audience is required when oidc.enabled is set")
+		}
+		v.required("oidc.principal_claim", c.OIDC.PrincipalClaim, "when oidc.enabled is set")
+		v.nonNegative("oidc.clock_skew_seconds", c.OIDC.ClockSkewSeconds)
+		v.positive("oidc.timeout_seconds", c.OIDC.TimeoutSeconds)
+	}
+
+	// Sidecar; the settings it requires are checked by ValidateSidecar
+	if c.Sidecar.RootResourceID != "" {
+		if _, err := uuid.Parse(c.Sidecar.RootResourceID); err != nil {
+			v.addf("sidecar.root_resource_id", "must be a resource ID, got %q", c.Sidecar.RootResourceID)
+		}
+	}
+	v.nonNegative("sidecar.refresh_seconds", c.Sidecar.RefreshSeconds)
+	v.positive("sidecar.retry_seconds", c.Sidecar.RetrySeconds)
+	v.tls("sidecar.tls", c.Sidecar.TLS, false)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// ValidateSidecar checks the settings the "sidecar" subcommand cannot start without
+func (c *Config) ValidateSidecar() error {
+	v := &validator{}
+	v.required("sidecar.upstream", c.Sidecar.Upstream, "to run the sidecar")
+	v.required("sidecar.root_resource_id", c.Sidecar.RootResourceID, "to run the sidecar")
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadDefaults(t *testing.T) *Config {
+	clearIAMEnvVars(t)
+	cfg, err := Load()
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestValidate_Defaults(t *testing.T) {
+	cfg := loadDefaults(t)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		problem string
+	}{
+		{"port zero", func(c *Config) { c.Server.Port = 0 }, "server.port: must be between 1 and 65535, got 0"},
+		{"port too large", func(c *Config) { c.Server.Port = 70000 }, "server.port: must be between 1 and 65535, got 70000"},
+		{"negative cache ttl", func(c *Config) { c.Cache.Enabled = true; c.Cache.Type = "memory"; c.Cache.TTLSeconds = -1 }, "cache.ttl_seconds: must be positive, got -1"},
+		{"redis without address", func(c *Config) { c.Cache.Enabled = true; c.Cache.Type = "redis"; c.Cache.Redis.Address = "" }, "cache.redis.address: is required when cache.type is redis"},
+		{"redis cluster without addresses", func(c *Config) { c.Cache.Enabled = true; c.Cache.Type = "redis"; c.Cache.Redis.Mode = "cluster" }, "cache.redis.addresses: is required when cache.redis.mode is cluster"},
+		{"redis cluster with db", func(c *Config) {
+			c.Cache.Enabled = true
+			c.Cache.Type = "redis"
+			c.Cache.Redis.Mode = "cluster"
+			c.Cache.Redis.Addresses = []string{"redis-0:6379"}
+			c.Cache.Redis.DB = 1
+		}, "cache.redis.db: is not supported when cache.redis.mode is cluster"},
+		{"redis sentinel without master", func(c *Config) {
+			c.Cache.Enabled = true
+			c.Cache.Type = "redis"
+			c.Cache.Redis.Mode = "sentinel"
+			c.Cache.Redis.Addresses = []string{"sentinel-0:26379"}
+		}, "cache.redis.master_name: is required when cache.redis.mode is sentinel"},
+		{"redis min idle above pool size", func(c *Config) {
+			c.Cache.Enabled = true
+			c.Cache.Type = "redis"
+			c.Cache.Redis.PoolSize = 5
+			c.Cache.Redis.MinIdleConns = 10
+		}, "cache.redis.min_idle_conns: must not exceed cache.redis.pool_size (5), got 10"},
+		{"unknown cache type", func(c *Config) { c.Cache.Type = "memcached" }, `cache.type: unsupported value "memcached" (valid: none, memory, redis)`},
+		{"max idle above max conns", func(c *Config) { c.Database.MaxConns = 5; c.Database.MaxIdle = 10 }, "database.max_idle: must not exceed database.max_conns (5), got 10"},
+		{"unknown database driver", func(c *Config) { c.Database.Driver = "mysql" }, `database.driver: unsupported value "mysql" (valid: postgres, sqlite)`},
+		{"sqlite with replica", func(c *Config) { c.Database.Driver = "sqlite"; c.Database.ReplicaDSN = "host=replica" }, "database.replica_dsn: is not supported when database.driver is sqlite"},
+		{"unknown replication mode", func(c *Config) { c.Replication.Mode = "multi-writer" }, `replication.mode: unsupported value "multi-writer" (valid: single-writer)`},
+		{"single writer without region", func(c *Config) { c.Replication.Mode = "single-writer" }, "replication.region: is required when replication.mode is single-writer"},
+		{"unknown log level", func(c *Config) { c.Log.Level = "verbose" }, `log.level: unsupported value "verbose" (valid: debug, info, warn, warning, error)`},
+		{"sample rate above one", func(c *Config) { c.DecisionLog.SampleRate = 2 }, "decision_log.sample_rate: must be between 0 and 1, got 2"},
+		{"file sink without path", func(c *Config) {
+			c.DecisionLog.Enabled = true
+			c.DecisionLog.Sink = "file"
+			c.DecisionLog.FilePath = ""
+		}, "decision_log.file_path: is required when decision_log.sink is file"},
+		{"negative integrity interval", func(c *Config) { c.Integrity.IntervalMinutes = -5 }, "integrity.interval_minutes: must not be negative, got -5"},
+		{"purge without retention", func(c *Config) { c.Retention.Days = 0; c.Retention.PurgeIntervalMinutes = 60 }, "retention.days: is required when retention.purge_interval_minutes is set"},
+		{"scim without token", func(c *Config) { c.SCIM.Enabled = true }, "scim.token: is required when scim.enabled is set"},
+		{"server tls without key", func(c *Config) { c.Server.TLS.Enabled = true; c.Server.TLS.CertFile = "cert.pem" }, "server.tls.key_file: is required when server.tls.enabled is set"},
+		{"unknown failure mode", func(c *Config) { c.Evaluator.FailureMode = "ignore" }, `evaluator.failure_mode: unsupported value "ignore" (valid: closed, open)`},
+		{"unknown shadow backend", func(c *Config) {
+			c.Evaluator.Shadow.Enabled = true
+			c.Evaluator.Shadow.Backend = "cedar"
+		}, `evaluator.shadow.backend: unsupported value "cedar" (valid: native, opa)`},
+		{"shadow sample rate above one", func(c *Config) {
+			c.Evaluator.Shadow.Enabled = true
+			c.Evaluator.Shadow.SampleRate = 1.5
+		}, "evaluator.shadow.sample_rate: must be between 0 and 1, got 1.5"},
+		{"negative slow query threshold", func(c *Config) { c.Database.SlowQueryMS = -1 }, "database.slow_query_ms: must not be negative, got -1"},
+		{"negative policy limit", func(c *Config) { c.PolicyLimits.MaxMembers = -1 }, "policy_limits.max_members: must not be negative, got -1"},
+		{"policy limit override without resource", func(c *Config) {
+			c.PolicyLimits.Overrides = []PolicyLimitOverride{{ResourceID: "org", MaxBindings: 10}}
+		}, `policy_limits.overrides[0].resource_id: must be a resource ID, got "org"`},
+		{"policy limit override deeper than hierarchy", func(c *Config) {
+			c.PolicyLimits.Overrides = []PolicyLimitOverride{{ResourceID: "5a8f0c1e-7d3b-4c2a-9e6f-1b2c3d4e5f60", MaxDepth: 40}}
+		}, "policy_limits.overrides[0].max_depth: must not exceed resource.max_depth (32), got 40"},
+		{"sidecar root not an ID", func(c *Config) { c.Sidecar.RootResourceID = "org" }, `sidecar.root_resource_id: must be a resource ID, got "org"`},
+		{"oidc without audiences", func(c *Config) { c.OIDC.Enabled = true; c.OIDC.IssuerURL = "https://accounts.example.com" }, "oidc.audiences: at least one audience is required when oidc.enabled is set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadDefaults(t)
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+			assert.Equal(t, []string{tt.problem}, validationErr.Problems)
+		})
+	}
+}
+
+func TestValidate_AggregatesProblems(t *testing.T) {
+	cfg := loadDefaults(t)
+	cfg.Server.Port = 0
+	cfg.Log.Format = "xml"
+	cfg.Operations.Workers = 0
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "invalid configuration:\n"+
+		"  - server.port: must be between 1 and 65535, got 0\n"+
+		`  - log.format: unsupported value "xml" (valid: json, text)`+"\n"+
+		"  - operations.workers: must be positive, got 0", err.Error())
+}
+
+func TestValidate_IgnoresDisabledSections(t *testing.T) {
+	cfg := loadDefaults(t)
+	cfg.Cache.Enabled = false
+	cfg.Cache.Type = "redis"
+	cfg.Cache.Redis.Address = ""
+	cfg.LDAP.URL = ""
+	cfg.OIDC.IssuerURL = ""
+
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateSidecar(t *testing.T) {
+	cfg := loadDefaults(t)
+
+	err := cfg.ValidateSidecar()
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{
+		"sidecar.upstream: is required to run the sidecar",
+		"sidecar.root_resource_id: is required to run the sidecar",
+	}, validationErr.Problems)
+
+	cfg.Sidecar.Upstream = "iam.internal:8081"
+	cfg.Sidecar.RootResourceID = "5a8f0c1e-7d3b-4c2a-9e6f-1b2c3d4e5f60"
+	assert.NoError(t, cfg.ValidateSidecar())
+}
+
+func TestValidate_SQLiteIgnoresPostgresSettings(t *testing.T) {
+	cfg := loadDefaults(t)
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.SQLitePath = ":memory:"
+	cfg.Database.Host = ""
+	cfg.Database.Port = 0
+
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoad_RejectsInvalidConfig(t *testing.T) {
+	clearIAMEnvVars(t)
+	os.Setenv("IAM_SERVER_PORT", "0")
+	os.Setenv("IAM_CACHE_ENABLED", "true")
+	os.Setenv("IAM_CACHE_TYPE", "redis")
+	os.Setenv("IAM_CACHE_REDIS_ADDRESS", " ")
+	defer clearIAMEnvVars(t)
+
+	cfg, err := Load()
+	assert.Nil(t, cfg)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, []string{
+		"server.port: must be between 1 and 65535, got 0",
+		"cache.redis.address: is required when cache.type is redis",
+	}, validationErr.Problems)
+}
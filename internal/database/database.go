@@ -1,36 +1,50 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database/sqlite"
 	"github.com/pguia/iam/internal/domain"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Database drivers selected by database.driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // Embedded database for local development and tests
 )
 
 // Database wraps the gorm.DB connection
 type Database struct {
 	*gorm.DB
+
+	driver  string
+	reader  *gorm.DB     // Read replica connection; nil without a replica
+	replica *replicaPool // Replica pool with failover to the primary
+	logger  *slog.Logger
 }
 
-// New creates a new database connection
-func New(cfg *config.DatabaseConfig) (*Database, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host,
-		cfg.Port,
-		cfg.User,
-		cfg.Password,
-		cfg.DBName,
-		cfg.SSLMode,
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Error),
+// New creates a new database connection; a nil logger uses slog.Default()
+func New(cfg *config.DatabaseConfig, logger *slog.Logger) (*Database, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	dialector, err := Dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: newGormLogger(logger),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -43,8 +57,17 @@ func New(cfg *config.DatabaseConfig) (*Database, error) {
 	}
 
 	// Set connection pool settings
-	sqlDB.SetMaxOpenConns(cfg.MaxConns)
-	sqlDB.SetMaxIdleConns(cfg.MaxIdle)
+	configurePool(sqlDB, cfg)
+
+	slowQuery := time.Duration(cfg.SlowQueryMS) * time.Millisecond
+	if err := registerSlowQueryLogger(db, slowQuery, logger); err != nil {
+		return nil, fmt.Errorf("failed to register slow query logger: %w", err)
+	}
+
+	if cfg.Driver == DriverSQLite {
+		logger.Info("Using embedded SQLite database", "path", cfg.SQLitePath)
+		return &Database{DB: db, driver: DriverSQLite, logger: logger}, nil
+	}
 
 	// Enable UUID extension
 	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
@@ -62,31 +85,237 @@ func New(cfg *config.DatabaseConfig) (*Database, error) {
 		}
 	}
 
-	return &Database{DB: db}, nil
+	database := &Database{DB: db, driver: DriverPostgres, logger: logger}
+
+	if cfg.ReplicaDSN != "" {
+		if err := database.openReplica(cfg, sqlDB); err != nil {
+			return nil, err
+		}
+		logger.Info("Read replica configured", "healthy", database.replica.Healthy())
+	}
+
+	return database, nil
 }
 
-// AutoMigrate runs automatic migration for all models
+// openReplica connects the read replica. The connection is lazy so a replica that is
+// down at startup does not prevent the service from starting; reads use the primary
+// until the health check sees the replica.
+func (db *Database) openReplica(cfg *config.DatabaseConfig, primary *sql.DB) error {
+	replicaDB, err := gorm.Open(postgres.Open(cfg.ReplicaDSN), &gorm.Config{
+		Logger:               newGormLogger(db.logger),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open read replica: %w", err)
+	}
+
+	replicaSQL, err := replicaDB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying replica sql.DB: %w", err)
+	}
+	configurePool(replicaSQL, cfg)
+
+	pool := newReplicaPool(replicaSQL, primary, time.Duration(cfg.ReplicaHealthCheckSeconds)*time.Second, db.logger)
+
+	reader, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{
+		Logger:               newGormLogger(db.logger),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		pool.Close()
+		return fmt.Errorf("failed to initialize read replica: %w", err)
+	}
+	if err := registerSlowQueryLogger(reader, time.Duration(cfg.SlowQueryMS)*time.Millisecond, db.logger); err != nil {
+		pool.Close()
+		return fmt.Errorf("failed to register slow query logger on read replica: %w", err)
+	}
+
+	if window := time.Duration(cfg.ReplicaReadYourWritesSeconds) * time.Second; window > 0 {
+		if err := registerReadYourWrites(db.DB, pool, window); err != nil {
+			pool.Close()
+			return fmt.Errorf("failed to register read-your-writes callbacks: %w", err)
+		}
+	}
+
+	db.reader = reader
+	db.replica = pool
+	return nil
+}
+
+// registerReadYourWrites makes every successful write through the primary send the replica
+// pool's reads to the primary for window. Otherwise a check right after a revocation could read
+// the grant from a lagging replica and cache it again after the write cleared the cache.
+func registerReadYourWrites(primary *gorm.DB, pool *replicaPool, window time.Duration) error {
+	pin := func(tx *gorm.DB) {
+		if tx.Error == nil {
+			pool.readYourWrites(window)
+		}
+	}
+	callbacks := primary.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("replica:read_your_writes", pin); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("replica:read_your_writes", pin); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("replica:read_your_writes", pin); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("replica:read_your_writes", pin)
+}
+
+// Dialector returns the gorm dialector of the driver selected by cfg.Driver
+func Dialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case DriverPostgres, "":
+		return postgres.Open(DSN(cfg)), nil
+	case DriverSQLite:
+		return sqlite.Open(cfg.SQLitePath), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver: %s (valid: postgres, sqlite)", cfg.Driver)
+	}
+}
+
+// DSN returns the connection string of the primary database. Values are quoted, so passwords
+// may contain spaces and quotes; cfg.Params is appended verbatim.
+func DSN(cfg *config.DatabaseConfig) string {
+	params := []struct{ key, value string }{
+		{"host", cfg.Host},
+		{"port", strconv.Itoa(cfg.Port)},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.DBName},
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+		{"search_path", cfg.SearchPath},
+	}
+	if cfg.StatementTimeoutSeconds > 0 {
+		// Sent as a run-time parameter, so it applies to every connection of the pool
+		params = append(params, struct{ key, value string }{"statement_timeout", strconv.Itoa(cfg.StatementTimeoutSeconds * 1000)})
+	}
+
+	parts := make([]string, 0, len(params)+1)
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		parts = append(parts, p.key+"="+quoteDSNValue(p.value))
+	}
+	if params := strings.TrimSpace(cfg.Params); params != "" {
+		parts = append(parts, params)
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes a keyword/value connection string value containing spaces, quotes or backslashes
+func quoteDSNValue(value string) string {
+	if !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// configurePool applies the connection pool settings of cfg
+func configurePool(sqlDB *sql.DB, cfg *config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdle)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second)
+}
+
+// newGormLogger routes gorm's error logs through the structured logger
+func newGormLogger(logger *slog.Logger) gormlogger.Interface {
+	return gormlogger.New(slog.NewLogLogger(logger.Handler(), slog.LevelError), gormlogger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  gormlogger.Error,
+		IgnoreRecordNotFoundError: true,
+	})
+}
+
+// PoolStats returns the statistics of the connection pools by name: "primary" and, with a read
+// replica, "replica"
+func (db *Database) PoolStats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats, 2)
+	if sqlDB, err := db.DB.DB(); err == nil {
+		stats["primary"] = sqlDB.Stats()
+	}
+	if db.replica != nil {
+		stats["replica"] = db.replica.replica.Stats()
+	}
+	return stats
+}
+
+// Reader returns the connection for read-only queries: the read replica when one is
+// configured (failing over to the primary while it is down), otherwise the primary
+func (db *Database) Reader() *gorm.DB {
+	if db.reader != nil {
+		return db.reader
+	}
+	return db.DB
+}
+
+// bindingMembersIndex is the GIN index the members containment queries read (0022_binding_members_index)
+const bindingMembersIndex = "CREATE INDEX IF NOT EXISTS idx_bindings_members ON bindings USING gin (members jsonb_path_ops)"
+
+// models are the tables of the schema. The versioned migrations create the same columns, which
+// TestDatabase_MigrateMatchesModels checks.
+var models = []interface{}{
+	&domain.Resource{},
+	&domain.Permission{},
+	&domain.Role{},
+	&domain.Policy{},
+	&domain.Binding{},
+	&domain.Condition{},
+	&domain.PolicyRevision{},
+	&domain.DecisionLog{},
+	&domain.ResourceClosure{},
+	&domain.Operation{},
+	&domain.User{},
+	&domain.Group{},
+	&domain.AccessRecommendation{},
+	&domain.GrantConstraint{},
+	&domain.ResourceTag{},
+	&domain.IdempotencyKey{},
+	&domain.AccessRequest{},
+	&domain.AccessReview{},
+	&domain.AccessReviewItem{},
+	&domain.EvaluationGrant{},
+	&domain.PrincipalAlias{},
+}
+
+// AutoMigrate runs GORM automatic migration for all models.
+// It is kept for tests and local experiments; deployments use the versioned SQL migrations (Migrate).
 func (db *Database) AutoMigrate() error {
-	log.Println("Running database migrations...")
-
-	err := db.DB.AutoMigrate(
-		&domain.Resource{},
-		&domain.Permission{},
-		&domain.Role{},
-		&domain.Policy{},
-		&domain.Binding{},
-		&domain.Condition{},
-	)
+	db.logger.Info("Running database migrations")
+
+	err := db.DB.AutoMigrate(models...)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
+	// Indexes the model tags cannot express; see the versioned migration creating each
+	if db.driver != DriverSQLite {
+		if err := db.DB.Exec(bindingMembersIndex).Error; err != nil {
+			return fmt.Errorf("failed to create binding members index: %w", err)
+		}
+	}
+
+	db.logger.Info("Database migrations completed successfully")
 	return nil
 }
 
 // Close closes the database connection
 func (db *Database) Close() error {
+	if db.replica != nil {
+		if err := db.replica.Close(); err != nil {
+			db.logger.Error("Failed to close read replica", "error", err)
+		}
+	}
+
 	sqlDB, err := db.DB.DB()
 	if err != nil {
 		return err
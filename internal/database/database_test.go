@@ -1,32 +1,26 @@
 package database
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"os"
+	"net"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database/sqlite"
+	"github.com/pguia/iam/internal/testharness/testenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func getTestDatabaseConfig() *config.DatabaseConfig {
-	host := os.Getenv("TEST_DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
-	return &config.DatabaseConfig{
-		Host:     host,
-		Port:     5432,
-		User:     "postgres",
-		Password: "postgres",
-		DBName:   "iam_db",
-		SSLMode:  "disable",
-		MaxConns: 25,
-		MaxIdle:  5,
-	}
+// getTestDatabaseConfig returns the settings of the test Postgres server (see testenv)
+func getTestDatabaseConfig(t *testing.T) *config.DatabaseConfig {
+	cfg := testenv.PostgresServer(t)
+	cfg.MaxConns = 25
+	cfg.MaxIdle = 5
+	return &cfg
 }
 
 // setupTestSchema creates a unique schema for test isolation and switches to it
@@ -47,9 +41,9 @@ func setupTestSchema(t *testing.T, db *Database) string {
 }
 
 func TestNew_Success(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 	defer db.Close()
@@ -73,16 +67,16 @@ func TestNew_InvalidConfig(t *testing.T) {
 		MaxIdle:  5,
 	}
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	assert.Error(t, err)
 	assert.Nil(t, db)
 	assert.Contains(t, err.Error(), "failed to connect to database")
 }
 
 func TestDatabase_Ping(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 	defer db.Close()
@@ -96,9 +90,9 @@ func TestDatabase_Ping(t *testing.T) {
 }
 
 func TestDatabase_AutoMigrate(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 	defer db.Close()
@@ -142,12 +136,92 @@ func TestDatabase_AutoMigrate(t *testing.T) {
 	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'conditions'", schemaName).Scan(&tableCount).Error
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), tableCount)
+
+	// Check policy_revisions table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'policy_revisions'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check decision_logs table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'decision_logs'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check resource_closure table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'resource_closure'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check operations table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'operations'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check users table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'users'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check groups table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'groups'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check group_members table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'group_members'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check access_recommendations table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'access_recommendations'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check grant_constraints table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'grant_constraints'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check resource_tags table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'resource_tags'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check idempotency_keys table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'idempotency_keys'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check access_requests table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'access_requests'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check access_reviews table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'access_reviews'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check access_review_items table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'access_review_items'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check evaluation_grants table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'evaluation_grants'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
+
+	// Check principal_aliases table
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'principal_aliases'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), tableCount)
 }
 
 func TestDatabase_Close(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 
@@ -164,11 +238,11 @@ func TestDatabase_Close(t *testing.T) {
 }
 
 func TestDatabase_ConnectionPoolSettings(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 	cfg.MaxConns = 50
 	cfg.MaxIdle = 10
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 	defer db.Close()
@@ -188,9 +262,9 @@ func TestDatabase_ConnectionPoolSettings(t *testing.T) {
 }
 
 func TestDatabase_ExtensionsCreated(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
-	db, err := New(cfg)
+	db, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db)
 	defer db.Close()
@@ -211,10 +285,10 @@ func TestDatabase_ExtensionsCreated(t *testing.T) {
 }
 
 func TestDatabase_MultipleConnections(t *testing.T) {
-	cfg := getTestDatabaseConfig()
+	cfg := getTestDatabaseConfig(t)
 
 	// Create first connection
-	db1, err := New(cfg)
+	db1, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db1)
 	defer db1.Close()
@@ -223,7 +297,7 @@ func TestDatabase_MultipleConnections(t *testing.T) {
 	setupTestSchema(t, db1)
 
 	// Create second connection
-	db2, err := New(cfg)
+	db2, err := New(cfg, nil)
 	require.NoError(t, err)
 	require.NotNil(t, db2)
 	defer db2.Close()
@@ -253,10 +327,10 @@ func TestDatabase_DifferentDatabases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cfg := getTestDatabaseConfig()
+			cfg := getTestDatabaseConfig(t)
 			cfg.DBName = tt.dbname
 
-			db, err := New(cfg)
+			db, err := New(cfg, nil)
 			require.NoError(t, err)
 			require.NotNil(t, db)
 			defer db.Close()
@@ -288,10 +362,10 @@ func TestDatabase_SSLModeOptions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cfg := getTestDatabaseConfig()
+			cfg := getTestDatabaseConfig(t)
 			cfg.SSLMode = tt.sslmode
 
-			db, err := New(cfg)
+			db, err := New(cfg, nil)
 			// We expect this to work with disable and might work with prefer
 			// depending on server config
 			if err != nil {
@@ -313,6 +387,65 @@ func TestDatabase_SSLModeOptions(t *testing.T) {
 	}
 }
 
+func TestDSN(t *testing.T) {
+	cfg := &config.DatabaseConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "iam",
+		Password: `it's a \secret`,
+		DBName:   "iam_db",
+		SSLMode:  "disable",
+	}
+	assert.Equal(t, `host=localhost port=5432 user=iam password='it\'s a \\secret' dbname=iam_db sslmode=disable`, DSN(cfg))
+
+	cfg.Password = ""
+	cfg.SSLMode = "verify-full"
+	cfg.SSLRootCert = "/etc/iam/db/ca.pem"
+	cfg.SSLCert = "/etc/iam/db/client.pem"
+	cfg.SSLKey = "/etc/iam/db/client-key.pem"
+	cfg.SearchPath = "iam,public"
+	cfg.StatementTimeoutSeconds = 30
+	cfg.Params = " application_name=iam "
+	assert.Equal(t, "host=localhost port=5432 user=iam dbname=iam_db sslmode=verify-full "+
+		"sslrootcert=/etc/iam/db/ca.pem sslcert=/etc/iam/db/client.pem sslkey=/etc/iam/db/client-key.pem "+
+		"search_path=iam,public statement_timeout=30000 application_name=iam", DSN(cfg))
+}
+
+func TestDialector(t *testing.T) {
+	dialector, err := Dialector(&config.DatabaseConfig{Host: "localhost", Port: 5432})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", dialector.Name())
+
+	dialector, err = Dialector(&config.DatabaseConfig{Driver: DriverSQLite, SQLitePath: ":memory:"})
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite", dialector.Name())
+
+	_, err = Dialector(&config.DatabaseConfig{Driver: "mysql"})
+	assert.ErrorContains(t, err, "unknown database driver: mysql")
+}
+
+func TestNew_SQLiteNotCompiled(t *testing.T) {
+	if sqlite.Available {
+		t.Skip("built with the sqlite tag")
+	}
+	_, err := New(&config.DatabaseConfig{Driver: DriverSQLite, SQLitePath: ":memory:"}, nil)
+	assert.ErrorIs(t, err, sqlite.ErrNotCompiled)
+}
+
+func TestDatabase_StatementTimeout(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+	cfg.StatementTimeoutSeconds = 7
+	cfg.ConnMaxLifetimeSeconds = 60
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var timeout string
+	require.NoError(t, db.Raw("SHOW statement_timeout").Scan(&timeout).Error)
+	assert.Equal(t, "7s", timeout)
+}
+
 func TestIsExtensionExistsError(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -348,3 +481,99 @@ func TestIsExtensionExistsError(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabase_ReaderWithoutReplica(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Without a replica, reads go to the primary
+	assert.Same(t, db.DB, db.Reader())
+}
+
+func TestDatabase_ReaderWithReplica(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+	// Use the primary as its own replica
+	cfg.ReplicaDSN = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.NotSame(t, db.DB, db.Reader())
+	assert.True(t, db.replica.Healthy())
+
+	var one int
+	require.NoError(t, db.Reader().Raw("SELECT 1").Scan(&one).Error)
+	assert.Equal(t, 1, one)
+}
+
+func TestDatabase_ReaderAfterWrite(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+	cfg.ReplicaDSN = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+	cfg.ReplicaReadYourWritesSeconds = 60
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	schema := setupTestSchema(t, db)
+	db.replica.primaryUntil.Store(0) // Creating the schema was a write too
+
+	require.True(t, db.replica.Healthy())
+	assert.Same(t, db.replica.replica, db.replica.current())
+
+	// Reads follow a write to the primary for the configured window
+	require.NoError(t, db.Exec("CREATE TABLE "+schema+".writes (id int)").Error)
+	assert.Same(t, db.replica.primary, db.replica.current())
+}
+
+func TestDatabase_ReaderFailsOverToPrimary(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+	// Nothing listens on port 1, so the replica is down from the start
+	cfg.ReplicaDSN = fmt.Sprintf("host=%s port=1 user=%s password=%s dbname=%s sslmode=%s connect_timeout=1",
+		cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.False(t, db.replica.Healthy())
+
+	var one int
+	require.NoError(t, db.Reader().Raw("SELECT 1").Scan(&one).Error)
+	assert.Equal(t, 1, one)
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "Bad connection",
+			err:      fmt.Errorf("query failed: %w", driver.ErrBadConn),
+			expected: true,
+		},
+		{
+			name:     "Network error",
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			expected: true,
+		},
+		{
+			name:     "Query error",
+			err:      fmt.Errorf("ERROR: relation \"missing\" does not exist (SQLSTATE 42P01)"),
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isConnectionError(tt.err))
+		})
+	}
+}
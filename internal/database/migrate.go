@@ -0,0 +1,260 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key serializing migrations across replicas
+const migrationLockID = 7245301
+
+// errSQLiteMigrations is returned by the versioned migration commands on SQLite databases
+var errSQLiteMigrations = errors.New("versioned migrations require the postgres driver; sqlite databases are created from the models")
+
+// migrationFilePattern matches files such as 0002_add_principals.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change loaded from the embedded migrations directory
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the schema_migrations bookkeeping table
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// LoadMigrations returns the embedded migrations ordered by version
+func LoadMigrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies all pending migrations in version order.
+// Each migration runs in its own transaction under an advisory lock, so concurrent
+// instances starting at the same time apply every migration exactly once.
+// The migrations are written for Postgres; SQLite databases are created from the models instead.
+func (db *Database) Migrate() error {
+	if db.driver == DriverSQLite {
+		return db.AutoMigrate()
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+
+	if err := db.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		ran, err := db.applyMigration(m)
+		if err != nil {
+			return err
+		}
+		if ran {
+			db.logger.Info("Applied migration", "version", m.Version, "name", m.Name)
+			applied++
+		}
+	}
+
+	db.logger.Info("Database migrations completed successfully", "applied", applied)
+	return nil
+}
+
+func (db *Database) applyMigration(m Migration) (bool, error) {
+	ran := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to read migration state: %w", err)
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Exec(m.Up).Error; err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		record := schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		ran = true
+		return nil
+	})
+	return ran, err
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first
+func (db *Database) MigrateDown(steps int) error {
+	if db.driver == DriverSQLite {
+		return errSQLiteMigrations
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	if err := db.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var applied []schemaMigration
+	if err := db.DB.Order("version DESC").Limit(steps).Find(&applied).Error; err != nil {
+		return fmt.Errorf("failed to read migration state: %w", err)
+	}
+
+	for _, record := range applied {
+		m, ok := byVersion[record.Version]
+		if !ok {
+			return fmt.Errorf("applied migration %d_%s is missing from this build", record.Version, record.Name)
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return err
+		}
+		db.logger.Info("Reverted migration", "version", m.Version, "name", m.Name)
+	}
+
+	return nil
+}
+
+// MigrationStatus lists all known migrations and whether they have been applied
+func (db *Database) MigrationStatus() ([]MigrationStatus, error) {
+	if db.driver == DriverSQLite {
+		return nil, errSQLiteMigrations
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var records []schemaMigration
+	if err := db.DB.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read migration state: %w", err)
+	}
+	appliedAt := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		appliedAt[record.Version] = record.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := appliedAt[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "initial_schema", migrations[0].Name)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up, "migration %d has no up script", m.Version)
+		assert.NotEmpty(t, m.Down, "migration %d has no down script", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoadMigrations_Ordering(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("SELECT 2")},
+		"m/0001_first.up.sql":    {Data: []byte("SELECT 1")},
+		"m/0001_first.down.sql":  {Data: []byte("SELECT -1")},
+		"m/0010_tenth.up.sql":    {Data: []byte("SELECT 10")},
+		"m/0010_tenth.down.sql":  {Data: []byte("SELECT -10")},
+		"m/0002_second.down.sql": {Data: []byte("SELECT -2")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+	assert.Equal(t, []int{1, 2, 10}, []int{migrations[0].Version, migrations[1].Version, migrations[2].Version})
+	assert.Equal(t, "SELECT 1", migrations[0].Up)
+	assert.Equal(t, "SELECT -1", migrations[0].Down)
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "Bad file name",
+			fsys: fstest.MapFS{"m/initial.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name: "Missing up script",
+			fsys: fstest.MapFS{"m/0001_first.down.sql": {Data: []byte("SELECT 1")}},
+		},
+		{
+			name: "Conflicting names",
+			fsys: fstest.MapFS{
+				"m/0001_first.up.sql":   {Data: []byte("SELECT 1")},
+				"m/0001_other.up.sql":   {Data: []byte("SELECT 1")},
+				"m/0001_first.down.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.fsys, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDatabase_Migrate(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Use unique schema for isolation
+	schemaName := setupTestSchema(t, db)
+
+	require.NoError(t, db.Migrate())
+
+	for _, table := range []string{"resources", "permissions", "roles", "role_permissions", "policies", "bindings", "conditions", "policy_revisions", "schema_migrations"} {
+		var tableCount int64
+		err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", schemaName, table).Scan(&tableCount).Error
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), tableCount, "table %s should exist", table)
+	}
+
+	// Running again is a no-op
+	require.NoError(t, db.Migrate())
+
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, "migration %d should be applied", status.Version)
+		assert.NotNil(t, status.AppliedAt)
+	}
+}
+
+// Test: The migrations create every column the models map, under the models' names
+func TestDatabase_MigrateMatchesModels(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Use unique schema for isolation
+	schemaName := setupTestSchema(t, db)
+
+	require.NoError(t, db.Migrate())
+
+	columns := func(table string) []string {
+		var names []string
+		err := db.DB.Raw("SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", schemaName, table).Scan(&names).Error
+		require.NoError(t, err)
+		return names
+	}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db.DB}
+		require.NoError(t, stmt.Parse(model))
+
+		migrated := columns(stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" {
+				assert.Contains(t, migrated, field.DBName, "column %s.%s", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, relationship := range stmt.Schema.Relationships.Relations {
+			if relationship.JoinTable == nil {
+				continue
+			}
+			migrated := columns(relationship.JoinTable.Table)
+			for _, field := range relationship.JoinTable.Fields {
+				assert.Contains(t, migrated, field.DBName, "column %s.%s", relationship.JoinTable.Table, field.DBName)
+			}
+		}
+	}
+}
+
+// Test: Databases migrated before 0001 was fixed get their policy etag columns renamed
+func TestDatabase_MigrateRenamesPolicyETag(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Use unique schema for isolation
+	schemaName := setupTestSchema(t, db)
+
+	require.NoError(t, db.Migrate())
+	require.NoError(t, db.DB.Exec("ALTER TABLE policies RENAME COLUMN e_tag TO etag").Error)
+	require.NoError(t, db.DB.Exec("ALTER TABLE policy_revisions RENAME COLUMN e_tag TO etag").Error)
+	require.NoError(t, db.DB.Exec("DELETE FROM schema_migrations WHERE name = 'policy_etag_column'").Error)
+
+	require.NoError(t, db.Migrate())
+
+	for _, table := range []string{"policies", "policy_revisions"} {
+		var names []string
+		err := db.DB.Raw("SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?", schemaName, table).Scan(&names).Error
+		require.NoError(t, err)
+		assert.Contains(t, names, "e_tag")
+		assert.NotContains(t, names, "etag")
+	}
+}
+
+func TestDatabase_MigrateAdoptsAutoMigratedSchema(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Use unique schema for isolation
+	setupTestSchema(t, db)
+
+	// A database created by the old AutoMigrate startup path
+	require.NoError(t, db.AutoMigrate())
+	assert.NoError(t, db.Migrate())
+}
+
+func TestDatabase_MigrateDown(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	db, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Use unique schema for isolation
+	schemaName := setupTestSchema(t, db)
+
+	require.NoError(t, db.Migrate())
+
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+	require.NoError(t, db.MigrateDown(len(migrations)))
+
+	var tableCount int64
+	err = db.DB.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = 'resources'", schemaName).Scan(&tableCount).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), tableCount)
+
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.False(t, status.Applied)
+	}
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS policy_revisions;
+DROP TABLE IF EXISTS conditions;
+DROP TABLE IF EXISTS bindings;
+DROP TABLE IF EXISTS policies;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS resources;
@@ -0,0 +1,108 @@
+-- Initial schema. Statements are idempotent so databases previously created
+-- by GORM AutoMigrate are adopted without changes.
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+CREATE TABLE IF NOT EXISTS resources (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    type        varchar(100) NOT NULL,
+    name        varchar(255) NOT NULL,
+    parent_id   uuid,
+    attributes  jsonb,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    deleted_at  timestamptz,
+    CONSTRAINT fk_resources_children FOREIGN KEY (parent_id) REFERENCES resources (id)
+);
+CREATE INDEX IF NOT EXISTS idx_resources_type ON resources (type);
+CREATE INDEX IF NOT EXISTS idx_resources_parent_id ON resources (parent_id);
+CREATE INDEX IF NOT EXISTS idx_resources_attributes ON resources USING gin (attributes);
+CREATE INDEX IF NOT EXISTS idx_resources_deleted_at ON resources (deleted_at);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        varchar(255) NOT NULL,
+    description text,
+    service     varchar(100),
+    created_at  timestamptz NOT NULL,
+    deleted_at  timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_name ON permissions (name);
+CREATE INDEX IF NOT EXISTS idx_permissions_service ON permissions (service);
+CREATE INDEX IF NOT EXISTS idx_permissions_deleted_at ON permissions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        varchar(255) NOT NULL,
+    title       varchar(255) NOT NULL,
+    description text,
+    is_custom   boolean NOT NULL DEFAULT false,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    deleted_at  timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+CREATE INDEX IF NOT EXISTS idx_roles_deleted_at ON roles (deleted_at);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       uuid NOT NULL,
+    permission_id uuid NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles (id),
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions (id)
+);
+
+CREATE TABLE IF NOT EXISTS policies (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    resource_id uuid NOT NULL,
+    e_tag       varchar(64),
+    version     bigint NOT NULL DEFAULT 1,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    deleted_at  timestamptz,
+    CONSTRAINT fk_resources_policies FOREIGN KEY (resource_id) REFERENCES resources (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_policies_resource_id ON policies (resource_id);
+CREATE INDEX IF NOT EXISTS idx_policies_deleted_at ON policies (deleted_at);
+
+CREATE TABLE IF NOT EXISTS bindings (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    policy_id   uuid NOT NULL,
+    role_id     uuid NOT NULL,
+    members     jsonb NOT NULL,
+    created_at  timestamptz NOT NULL,
+    deleted_at  timestamptz,
+    CONSTRAINT fk_policies_bindings FOREIGN KEY (policy_id) REFERENCES policies (id),
+    CONSTRAINT fk_bindings_role FOREIGN KEY (role_id) REFERENCES roles (id)
+);
+CREATE INDEX IF NOT EXISTS idx_bindings_policy_id ON bindings (policy_id);
+CREATE INDEX IF NOT EXISTS idx_bindings_role_id ON bindings (role_id);
+CREATE INDEX IF NOT EXISTS idx_bindings_deleted_at ON bindings (deleted_at);
+
+CREATE TABLE IF NOT EXISTS conditions (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    binding_id  uuid NOT NULL,
+    title       varchar(255),
+    description text,
+    expression  text NOT NULL,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    deleted_at  timestamptz,
+    CONSTRAINT fk_bindings_condition FOREIGN KEY (binding_id) REFERENCES bindings (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conditions_binding_id ON conditions (binding_id);
+CREATE INDEX IF NOT EXISTS idx_conditions_deleted_at ON conditions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS policy_revisions (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    policy_id   uuid NOT NULL,
+    resource_id uuid NOT NULL,
+    revision    bigint NOT NULL,
+    e_tag       varchar(64),
+    bindings    jsonb NOT NULL,
+    author      varchar(255),
+    created_at  timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_policy_revisions_policy_revision ON policy_revisions (policy_id, revision);
+CREATE INDEX IF NOT EXISTS idx_policy_revisions_resource_id ON policy_revisions (resource_id);
@@ -0,0 +1,2 @@
+-- Permissions removed from a service's catalog are flagged instead of deleted
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS deprecated boolean NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+-- Optional log of every permission check (see decision_log in the configuration)
+CREATE TABLE IF NOT EXISTS decision_logs (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    principal   varchar(255) NOT NULL,
+    resource_id uuid NOT NULL,
+    permission  varchar(255) NOT NULL,
+    allowed     boolean NOT NULL,
+    reason      text,
+    error       text,
+    latency_us  bigint NOT NULL,
+    created_at  timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_decision_logs_principal ON decision_logs (principal);
+CREATE INDEX IF NOT EXISTS idx_decision_logs_resource_id ON decision_logs (resource_id);
+CREATE INDEX IF NOT EXISTS idx_decision_logs_created_at ON decision_logs (created_at);
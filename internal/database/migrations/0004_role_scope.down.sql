@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_roles_scope_resource_id;
+ALTER TABLE roles DROP COLUMN IF EXISTS scope_resource_id;
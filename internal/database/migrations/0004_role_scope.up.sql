@@ -0,0 +1,3 @@
+-- Custom roles may be scoped to a resource subtree
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS scope_resource_id uuid;
+CREATE INDEX IF NOT EXISTS idx_roles_scope_resource_id ON roles (scope_resource_id);
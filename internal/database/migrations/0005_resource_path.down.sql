@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_resources_path;
+ALTER TABLE resources DROP COLUMN IF EXISTS path;
@@ -0,0 +1,16 @@
+-- Materialized path of every resource: "/<root id>/.../<id>/"
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS path text NOT NULL DEFAULT '';
+
+WITH RECURSIVE paths AS (
+    SELECT id, '/' || id::text || '/' AS path, 1 AS depth
+    FROM resources
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT r.id, p.path || r.id::text || '/', p.depth + 1
+    FROM resources r
+    INNER JOIN paths p ON r.parent_id = p.id
+    WHERE p.depth < 1000
+)
+UPDATE resources SET path = paths.path FROM paths WHERE resources.id = paths.id;
+
+CREATE INDEX IF NOT EXISTS idx_resources_path ON resources (path text_pattern_ops);
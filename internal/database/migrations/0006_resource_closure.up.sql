@@ -0,0 +1,22 @@
+-- Closure table of the resource hierarchy: one row per (ancestor, descendant) pair, including (id, id, 0)
+CREATE TABLE IF NOT EXISTS resource_closure (
+    ancestor_id   uuid NOT NULL,
+    descendant_id uuid NOT NULL,
+    depth         bigint NOT NULL,
+    PRIMARY KEY (ancestor_id, descendant_id)
+);
+CREATE INDEX IF NOT EXISTS idx_resource_closure_descendant_id ON resource_closure (descendant_id);
+
+-- Live resources are linked to their live ancestors; a deleted resource keeps only its own subtree
+INSERT INTO resource_closure (ancestor_id, descendant_id, depth)
+WITH RECURSIVE closure AS (
+    SELECT id AS ancestor_id, id AS descendant_id, 0 AS depth
+    FROM resources
+    UNION ALL
+    SELECT c.ancestor_id, r.id, c.depth + 1
+    FROM resources r
+    INNER JOIN closure c ON r.parent_id = c.descendant_id
+    WHERE r.deleted_at IS NULL AND c.depth < 1000
+)
+SELECT ancestor_id, descendant_id, depth FROM closure
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,17 @@
+-- Long-running operations executed in the background and polled by clients
+CREATE TABLE IF NOT EXISTS operations (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    type        varchar(100) NOT NULL,
+    state       varchar(20) NOT NULL,
+    target      varchar(255),
+    completed   bigint NOT NULL DEFAULT 0,
+    total       bigint NOT NULL DEFAULT 0,
+    error       text,
+    result      jsonb,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    finished_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_operations_type ON operations (type);
+CREATE INDEX IF NOT EXISTS idx_operations_state ON operations (state);
+CREATE INDEX IF NOT EXISTS idx_operations_created_at ON operations (created_at);
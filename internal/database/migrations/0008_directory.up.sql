@@ -0,0 +1,32 @@
+-- Users and groups provisioned from an identity provider (SCIM)
+CREATE TABLE IF NOT EXISTS users (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    external_id  varchar(255),
+    user_name    varchar(255) NOT NULL,
+    display_name varchar(255),
+    email        varchar(255),
+    active       boolean NOT NULL DEFAULT true,
+    created_at   timestamptz NOT NULL,
+    updated_at   timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_user_name ON users (user_name);
+CREATE INDEX IF NOT EXISTS idx_users_external_id ON users (external_id);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    external_id  varchar(255),
+    display_name varchar(255) NOT NULL,
+    created_at   timestamptz NOT NULL,
+    updated_at   timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_display_name ON groups (display_name);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON groups (external_id);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    user_id  uuid NOT NULL,
+    group_id uuid NOT NULL,
+    PRIMARY KEY (user_id, group_id),
+    CONSTRAINT fk_group_members_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_group_members_group FOREIGN KEY (group_id) REFERENCES groups (id)
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_group_id ON group_members (group_id);
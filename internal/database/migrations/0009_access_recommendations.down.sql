@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_decision_logs_allowed_created_at;
+DROP TABLE IF EXISTS access_recommendations;
@@ -0,0 +1,20 @@
+-- Least-privilege recommendations produced by the access analyzer from the decision log
+CREATE TABLE IF NOT EXISTS access_recommendations (
+    id                 uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    principal          varchar(255) NOT NULL,
+    resource_id        uuid NOT NULL,
+    binding_id         uuid NOT NULL,
+    role               varchar(255) NOT NULL,
+    action             varchar(20) NOT NULL,
+    suggested_role     varchar(255),
+    used_permissions   jsonb NOT NULL,
+    unused_permissions jsonb NOT NULL,
+    last_used_at       timestamptz,
+    observed_since     timestamptz NOT NULL,
+    created_at         timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_access_recommendations_principal ON access_recommendations (principal);
+CREATE INDEX IF NOT EXISTS idx_access_recommendations_resource_id ON access_recommendations (resource_id);
+
+-- The analyzer aggregates allowed decisions over a time window
+CREATE INDEX IF NOT EXISTS idx_decision_logs_allowed_created_at ON decision_logs (created_at) WHERE allowed;
@@ -0,0 +1 @@
+ALTER TABLE bindings DROP COLUMN IF EXISTS annotations;
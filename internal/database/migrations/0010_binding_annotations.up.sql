@@ -0,0 +1,2 @@
+-- Free-form binding annotations, e.g. policy lint suppressions
+ALTER TABLE bindings ADD COLUMN IF NOT EXISTS annotations jsonb;
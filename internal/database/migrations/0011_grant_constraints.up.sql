@@ -0,0 +1,11 @@
+-- Roles delegated administrators may grant on a resource subtree
+CREATE TABLE IF NOT EXISTS grant_constraints (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    resource_id   uuid NOT NULL,
+    members       jsonb NOT NULL,
+    allowed_roles jsonb NOT NULL,
+    description   text,
+    created_at    timestamptz NOT NULL,
+    updated_at    timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_grant_constraints_resource_id ON grant_constraints (resource_id);
@@ -0,0 +1,11 @@
+-- Key/value tags on resources, looked up by key and value
+CREATE TABLE IF NOT EXISTS resource_tags (
+    resource_id uuid NOT NULL,
+    key         varchar(63) NOT NULL,
+    value       varchar(255) NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    PRIMARY KEY (resource_id, key),
+    CONSTRAINT fk_resources_tags FOREIGN KEY (resource_id) REFERENCES resources (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_resource_tags_key_value ON resource_tags (key, value);
@@ -0,0 +1,12 @@
+-- Results of mutating requests sent with an idempotency key, replayed to retries until expires_at
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    method      varchar(100) NOT NULL,
+    key         varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    response    jsonb,
+    completed   boolean NOT NULL DEFAULT false,
+    created_at  timestamptz NOT NULL,
+    expires_at  timestamptz NOT NULL,
+    PRIMARY KEY (method, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_decision_logs_role_created_at;
+ALTER TABLE decision_logs DROP COLUMN IF EXISTS role;
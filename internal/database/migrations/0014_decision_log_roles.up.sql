@@ -0,0 +1,3 @@
+-- Role that granted an allowed check, for role usage analytics
+ALTER TABLE decision_logs ADD COLUMN IF NOT EXISTS role varchar(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_decision_logs_role_created_at ON decision_logs (role, created_at) WHERE role <> '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_permissions_deprecated;
+ALTER TABLE permissions DROP COLUMN IF EXISTS replacement_name;
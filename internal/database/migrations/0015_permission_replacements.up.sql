@@ -0,0 +1,3 @@
+-- Permission that supersedes a deprecated one
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS replacement_name varchar(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_permissions_deprecated ON permissions (name) WHERE deprecated;
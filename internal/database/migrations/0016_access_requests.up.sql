@@ -0,0 +1,19 @@
+-- Requests for a role on a resource, approved or rejected by the resource's approvers
+CREATE TABLE IF NOT EXISTS access_requests (
+    id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    resource_id    uuid NOT NULL,
+    role_id        uuid NOT NULL,
+    principal      text NOT NULL,
+    justification  text,
+    status         text NOT NULL,
+    expires_at     timestamptz,
+    reviewed_by    text,
+    reviewed_at    timestamptz,
+    review_comment text,
+    binding_id     uuid,
+    created_at     timestamptz NOT NULL,
+    updated_at     timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_access_requests_resource_id ON access_requests (resource_id);
+CREATE INDEX IF NOT EXISTS idx_access_requests_principal ON access_requests (principal);
+CREATE INDEX IF NOT EXISTS idx_access_requests_status ON access_requests (status);
@@ -0,0 +1,38 @@
+-- Recertification campaigns over a resource subtree
+CREATE TABLE IF NOT EXISTS access_reviews (
+    id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    resource_id      uuid NOT NULL,
+    title            text NOT NULL,
+    reviewers        jsonb NOT NULL,
+    status           text NOT NULL,
+    due_at           timestamptz,
+    revoke_undecided boolean NOT NULL DEFAULT false,
+    created_by       text,
+    closed_by        text,
+    closed_at        timestamptz,
+    revoked          integer NOT NULL DEFAULT 0,
+    created_at       timestamptz NOT NULL,
+    updated_at       timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_access_reviews_resource_id ON access_reviews (resource_id);
+CREATE INDEX IF NOT EXISTS idx_access_reviews_status ON access_reviews (status);
+
+-- One item per member of every binding in the campaign's subtree
+CREATE TABLE IF NOT EXISTS access_review_items (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_id   uuid NOT NULL,
+    resource_id uuid NOT NULL,
+    binding_id  uuid NOT NULL,
+    role_id     uuid NOT NULL,
+    member      text NOT NULL,
+    condition   text,
+    decision    text NOT NULL,
+    decided_by  text,
+    decided_at  timestamptz,
+    comment     text,
+    created_at  timestamptz NOT NULL,
+    updated_at  timestamptz NOT NULL,
+    CONSTRAINT fk_access_reviews_items FOREIGN KEY (review_id) REFERENCES access_reviews (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_access_review_items_review_id ON access_review_items (review_id);
+CREATE INDEX IF NOT EXISTS idx_access_review_items_decision ON access_review_items (decision);
@@ -0,0 +1,35 @@
+-- Evaluation read model: one row per (binding, member, permission) of every live binding
+CREATE TABLE IF NOT EXISTS evaluation_grants (
+    binding_id           uuid NOT NULL,
+    member               varchar(255) NOT NULL,
+    permission           varchar(255) NOT NULL,
+    resource_id          uuid NOT NULL,
+    role_id              uuid NOT NULL,
+    role_name            varchar(255) NOT NULL,
+    condition_id         uuid,
+    condition_expression text,
+    PRIMARY KEY (binding_id, member, permission)
+);
+CREATE INDEX IF NOT EXISTS idx_evaluation_grants_lookup ON evaluation_grants (resource_id, permission, member);
+CREATE INDEX IF NOT EXISTS idx_evaluation_grants_role_id ON evaluation_grants (role_id);
+
+-- Live bindings of live policies and roles grant each live permission of their role to each member
+INSERT INTO evaluation_grants (binding_id, member, permission, resource_id, role_id, role_name, condition_id, condition_expression)
+SELECT
+    b.id,
+    CASE WHEN m.member LIKE 'domain:%' THEN lower(m.member) ELSE m.member END,
+    p.name,
+    pol.resource_id,
+    r.id,
+    r.name,
+    c.id,
+    c.expression
+FROM bindings b
+INNER JOIN policies pol ON pol.id = b.policy_id AND pol.deleted_at IS NULL
+INNER JOIN roles r ON r.id = b.role_id AND r.deleted_at IS NULL
+INNER JOIN role_permissions rp ON rp.role_id = r.id
+INNER JOIN permissions p ON p.id = rp.permission_id AND p.deleted_at IS NULL
+CROSS JOIN LATERAL jsonb_array_elements_text(b.members) AS m(member)
+LEFT JOIN conditions c ON c.binding_id = b.id AND c.deleted_at IS NULL
+WHERE b.deleted_at IS NULL
+ON CONFLICT DO NOTHING;
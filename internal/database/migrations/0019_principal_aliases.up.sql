@@ -0,0 +1,10 @@
+-- Alias identities linked to their canonical principal, e.g. after an email domain migration
+CREATE TABLE IF NOT EXISTS principal_aliases (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    alias      text NOT NULL,
+    principal  text NOT NULL,
+    created_by text,
+    created_at timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_principal_aliases_alias ON principal_aliases (alias);
+CREATE INDEX IF NOT EXISTS idx_principal_aliases_principal ON principal_aliases (principal);
@@ -0,0 +1,8 @@
+ALTER TABLE bindings DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE bindings DROP COLUMN IF EXISTS created_by;
+ALTER TABLE policies DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE policies DROP COLUMN IF EXISTS created_by;
+ALTER TABLE roles DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE roles DROP COLUMN IF EXISTS created_by;
+ALTER TABLE resources DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE resources DROP COLUMN IF EXISTS created_by;
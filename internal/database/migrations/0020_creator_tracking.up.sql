@@ -0,0 +1,9 @@
+-- Principals that created and last changed resources, roles, policies and bindings
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS updated_by text;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS updated_by text;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS updated_by text;
+ALTER TABLE bindings ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE bindings ADD COLUMN IF NOT EXISTS updated_by text;
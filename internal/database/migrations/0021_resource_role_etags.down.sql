@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP COLUMN IF EXISTS e_tag;
+ALTER TABLE resources DROP COLUMN IF EXISTS e_tag;
@@ -0,0 +1,5 @@
+-- ETags of resources and roles for optimistic concurrency control
+ALTER TABLE resources ADD COLUMN IF NOT EXISTS e_tag varchar(64);
+UPDATE resources SET e_tag = gen_random_uuid()::text WHERE e_tag IS NULL;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS e_tag varchar(64);
+UPDATE roles SET e_tag = gen_random_uuid()::text WHERE e_tag IS NULL;
@@ -0,0 +1,3 @@
+-- Containment index on binding members, for the queries listing the bindings of a principal
+-- (members @> '["user:alice@example.com"]')
+CREATE INDEX IF NOT EXISTS idx_bindings_members ON bindings USING gin (members jsonb_path_ops);
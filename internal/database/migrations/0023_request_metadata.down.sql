@@ -0,0 +1,4 @@
+ALTER TABLE policy_revisions DROP COLUMN IF EXISTS request_id;
+ALTER TABLE policy_revisions DROP COLUMN IF EXISTS service;
+ALTER TABLE decision_logs DROP COLUMN IF EXISTS service;
+ALTER TABLE decision_logs DROP COLUMN IF EXISTS request_id;
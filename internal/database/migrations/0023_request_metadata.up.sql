@@ -0,0 +1,5 @@
+-- Request ID and calling service of the checks and changes made through WithRequestMetadata
+ALTER TABLE decision_logs ADD COLUMN IF NOT EXISTS request_id varchar(128) NOT NULL DEFAULT '';
+ALTER TABLE decision_logs ADD COLUMN IF NOT EXISTS service varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE policy_revisions ADD COLUMN IF NOT EXISTS service varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE policy_revisions ADD COLUMN IF NOT EXISTS request_id varchar(128) NOT NULL DEFAULT '';
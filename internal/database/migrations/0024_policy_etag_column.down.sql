@@ -0,0 +1,2 @@
+-- 0001 creates e_tag, which the models read, so the column is kept
+SELECT 1;
@@ -0,0 +1,19 @@
+-- The models read the ETags of policies and policy revisions from e_tag, the column 0001 created
+-- as etag before it was fixed
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['policies', 'policy_revisions'] LOOP
+        IF EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = t AND column_name = 'etag') THEN
+            IF EXISTS (SELECT 1 FROM information_schema.columns
+                       WHERE table_schema = current_schema() AND table_name = t AND column_name = 'e_tag') THEN
+                EXECUTE format('UPDATE %I SET e_tag = etag WHERE e_tag IS NULL', t);
+                EXECUTE format('ALTER TABLE %I DROP COLUMN etag', t);
+            ELSE
+                EXECUTE format('ALTER TABLE %I RENAME COLUMN etag TO e_tag', t);
+            END IF;
+        END IF;
+    END LOOP;
+END $$;
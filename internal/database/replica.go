@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaPool is a gorm connection pool that sends queries to a read replica and
+// fails over to the primary while the replica is unreachable. A background health
+// check moves traffic back once the replica answers pings again.
+type replicaPool struct {
+	replica      *sql.DB
+	primary      *sql.DB
+	healthy      atomic.Bool
+	primaryUntil atomic.Int64 // Unix nanoseconds until which reads use the primary after a write
+	logger       *slog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplicaPool(replica, primary *sql.DB, healthCheck time.Duration, logger *slog.Logger) *replicaPool {
+	p := &replicaPool{
+		replica: replica,
+		primary: primary,
+		logger:  logger,
+		stop:    make(chan struct{}),
+	}
+
+	p.healthy.Store(replica.Ping() == nil)
+	if !p.healthy.Load() {
+		logger.Warn("Read replica unreachable, serving reads from the primary")
+	}
+
+	if healthCheck > 0 {
+		go p.monitor(healthCheck)
+	}
+
+	return p
+}
+
+// Healthy reports whether reads are currently served by the replica
+func (p *replicaPool) Healthy() bool {
+	return p.healthy.Load()
+}
+
+func (p *replicaPool) current() *sql.DB {
+	if p.healthy.Load() && time.Now().UnixNano() >= p.primaryUntil.Load() {
+		return p.replica
+	}
+	return p.primary
+}
+
+// readYourWrites sends reads to the primary for window, so they see a write the replica may
+// not have applied yet
+func (p *replicaPool) readYourWrites(window time.Duration) {
+	until := time.Now().Add(window).UnixNano()
+	for {
+		current := p.primaryUntil.Load()
+		if current >= until || p.primaryUntil.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
+// markDown switches reads to the primary after a connection-level replica failure
+func (p *replicaPool) markDown(err error) bool {
+	if !isConnectionError(err) {
+		return false
+	}
+	if p.healthy.CompareAndSwap(true, false) {
+		p.logger.Warn("Read replica failed, failing over to the primary", "error", err)
+	}
+	return true
+}
+
+func (p *replicaPool) monitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			up := p.replica.Ping() == nil
+			if was := p.healthy.Swap(up); was != up {
+				if up {
+					p.logger.Info("Read replica recovered, serving reads from the replica")
+				} else {
+					p.logger.Warn("Read replica unreachable, serving reads from the primary")
+				}
+			}
+		}
+	}
+}
+
+// Close stops the health check and closes the replica connections (the primary is owned by the caller)
+func (p *replicaPool) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	return p.replica.Close()
+}
+
+// GetDBConn lets gorm's DB() return the pool currently serving reads
+func (p *replicaPool) GetDBConn() (*sql.DB, error) {
+	return p.current(), nil
+}
+
+func (p *replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	db := p.current()
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil && db == p.replica && p.markDown(err) {
+		return p.primary.PrepareContext(ctx, query)
+	}
+	return stmt, err
+}
+
+func (p *replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db := p.current()
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil && db == p.replica && p.markDown(err) {
+		return p.primary.ExecContext(ctx, query, args...)
+	}
+	return result, err
+}
+
+func (p *replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := p.current()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil && db == p.replica && p.markDown(err) {
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (p *replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	// The error of a *sql.Row is only known on Scan, so rely on the health state alone
+	return p.current().QueryRowContext(ctx, query, args...)
+}
+
+// isConnectionError reports whether err means the server could not be reached,
+// as opposed to a query error that would fail on the primary too
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaPool_ReadYourWrites(t *testing.T) {
+	pool := &replicaPool{replica: &sql.DB{}, primary: &sql.DB{}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	pool.healthy.Store(true)
+	assert.Same(t, pool.replica, pool.current())
+
+	pool.readYourWrites(time.Hour)
+	assert.Same(t, pool.primary, pool.current())
+
+	// A shorter window does not cut the current one short
+	pool.readYourWrites(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	assert.Same(t, pool.primary, pool.current())
+
+	pool.primaryUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	assert.Same(t, pool.replica, pool.current())
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// slowQueryStartKey holds the start time of a statement in its gorm instance
+const slowQueryStartKey = "slow_query:start"
+
+// slowQueryLogger is a gorm plugin logging the statements slower than threshold. Statements are
+// logged with their placeholders, never their bound parameters, which may hold principals,
+// condition values or credentials.
+type slowQueryLogger struct {
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+// Name identifies the plugin to gorm
+func (p *slowQueryLogger) Name() string {
+	return "iam:slow_query_logger"
+}
+
+// Initialize times every statement run through db
+func (p *slowQueryLogger) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	start, end := p.Name()+":start", p.Name()+":end"
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register(start, p.start),
+		callbacks.Create().After("gorm:create").Register(end, p.end),
+		callbacks.Query().Before("gorm:query").Register(start, p.start),
+		callbacks.Query().After("gorm:query").Register(end, p.end),
+		callbacks.Update().Before("gorm:update").Register(start, p.start),
+		callbacks.Update().After("gorm:update").Register(end, p.end),
+		callbacks.Delete().Before("gorm:delete").Register(start, p.start),
+		callbacks.Delete().After("gorm:delete").Register(end, p.end),
+		callbacks.Row().Before("gorm:row").Register(start, p.start),
+		callbacks.Row().After("gorm:row").Register(end, p.end),
+		callbacks.Raw().Before("gorm:raw").Register(start, p.start),
+		callbacks.Raw().After("gorm:raw").Register(end, p.end),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *slowQueryLogger) start(db *gorm.DB) {
+	db.InstanceSet(slowQueryStartKey, time.Now())
+}
+
+func (p *slowQueryLogger) end(db *gorm.DB) {
+	value, ok := db.InstanceGet(slowQueryStartKey)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(value.(time.Time))
+	if elapsed < p.threshold {
+		return
+	}
+
+	attrs := []any{
+		"duration", elapsed,
+		"sql", db.Statement.SQL.String(),
+		"params", len(db.Statement.Vars),
+		"rows", db.RowsAffected,
+	}
+	if db.Statement.Table != "" {
+		attrs = append(attrs, "table", db.Statement.Table)
+	}
+	if db.Error != nil {
+		attrs = append(attrs, "error", db.Error)
+	}
+	p.logger.Warn("Slow query", attrs...)
+}
+
+// registerSlowQueryLogger logs the statements of db slower than threshold; 0 disables it
+func registerSlowQueryLogger(db *gorm.DB, threshold time.Duration, logger *slog.Logger) error {
+	if threshold <= 0 {
+		return nil
+	}
+	return db.Use(&slowQueryLogger{threshold: threshold, logger: logger})
+}
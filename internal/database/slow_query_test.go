@@ -0,0 +1,68 @@
+package database
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteDatabase opens an SQLite database logging to the returned buffer
+func newSQLiteDatabase(t *testing.T, slowQueryMS int) (*Database, *bytes.Buffer) {
+	if !sqlite.Available {
+		t.Skip("needs -tags sqlite")
+	}
+	var logs bytes.Buffer
+	db, err := New(&config.DatabaseConfig{
+		Driver:      DriverSQLite,
+		SQLitePath:  filepath.Join(t.TempDir(), "iam.db"),
+		MaxConns:    2,
+		MaxIdle:     1,
+		SlowQueryMS: slowQueryMS,
+	}, slog.New(slog.NewTextHandler(&logs, nil)))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, &logs
+}
+
+func TestSlowQueryLogger(t *testing.T) {
+	db, logs := newSQLiteDatabase(t, 0)
+	// Any statement is slower than a nanosecond
+	require.NoError(t, registerSlowQueryLogger(db.DB, time.Nanosecond, db.logger))
+
+	require.NoError(t, db.Exec("CREATE TABLE secrets (name TEXT, value TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO secrets (name, value) VALUES (?, ?)", "token", "s3cr3t-value").Error)
+	var value string
+	require.NoError(t, db.Raw("SELECT value FROM secrets WHERE name = ?", "token").Scan(&value).Error)
+	assert.Equal(t, "s3cr3t-value", value)
+
+	assert.Contains(t, logs.String(), `msg="Slow query"`)
+	assert.Contains(t, logs.String(), "SELECT value FROM secrets WHERE name = ?")
+	assert.Contains(t, logs.String(), "params=2")
+	assert.NotContains(t, logs.String(), "s3cr3t-value", "bound parameters are redacted")
+	assert.NotContains(t, logs.String(), "token")
+}
+
+func TestSlowQueryLogger_BelowThreshold(t *testing.T) {
+	db, logs := newSQLiteDatabase(t, 60000)
+
+	require.NoError(t, db.Exec("CREATE TABLE things (name TEXT)").Error)
+	assert.NotContains(t, logs.String(), "Slow query")
+}
+
+func TestDatabase_PoolStats(t *testing.T) {
+	db, _ := newSQLiteDatabase(t, 0)
+	require.NoError(t, db.Exec("SELECT 1").Error)
+
+	stats := db.PoolStats()
+	require.Contains(t, stats, "primary")
+	assert.NotContains(t, stats, "replica")
+	assert.Equal(t, 2, stats["primary"].MaxOpenConnections)
+	assert.Equal(t, 1, stats["primary"].Idle)
+}
@@ -0,0 +1,121 @@
+// Package sqlite provides the embedded SQLite database used for local development and tests
+// instead of Postgres (database.driver: sqlite).
+//
+// The driver (github.com/glebarez/sqlite, pure Go) is only compiled in with the sqlite build tag:
+//
+//	go build -tags sqlite ./...
+//
+// The models are written for Postgres, so the dialect adds shims: UUID primary keys are
+// generated in Go instead of by gen_random_uuid(), and Postgres-only index options
+// (expression operator classes, GIN) are dropped when tables are created. JSONB columns
+// are stored as JSON text, which SQLite's JSON functions query.
+package sqlite
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotCompiled is returned when opening a SQLite database in a binary built without the sqlite tag
+var ErrNotCompiled = errors.New("sqlite support is not compiled in; build with -tags sqlite")
+
+// DSN returns the connection string of the database file at path, with foreign keys enforced
+// and writers waiting for a locked database. ":memory:" becomes a uniquely named in-memory
+// database shared by the connections of the pool.
+func DSN(path string) string {
+	if path == ":memory:" {
+		path = "file:iam-" + uuid.NewString() + "?mode=memory&cache=shared"
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// postgresDefaults are column defaults calling Postgres functions SQLite lacks
+var postgresDefaults = map[string]bool{
+	"gen_random_uuid()":  true,
+	"uuid_generate_v4()": true,
+}
+
+var uuidType = reflect.TypeOf(uuid.UUID{})
+
+// adaptSchema rewrites the cached schema of model so SQLite can create its table
+func adaptSchema(db *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	for _, field := range stmt.Schema.Fields {
+		if postgresDefaults[field.DefaultValue] {
+			field.HasDefaultValue = false
+			field.DefaultValue = ""
+			field.DefaultValueInterface = nil
+		}
+		// Indexes are parsed from the struct tag when tables are created
+		if tag := field.Tag.Get("gorm"); tag != "" {
+			field.Tag = reflect.StructTag(strings.Replace(string(field.Tag), tag, sqliteGormTag(tag), 1))
+		}
+	}
+	return nil
+}
+
+// sqliteGormTag drops the index options of a gorm tag that only Postgres understands:
+// expressions with operator classes (e.g. "path text_pattern_ops") and index methods (e.g. GIN)
+func sqliteGormTag(tag string) string {
+	settings := strings.Split(tag, ";")
+	for i, setting := range settings {
+		key, value, ok := strings.Cut(setting, ":")
+		if !ok {
+			continue
+		}
+		if name := strings.ToUpper(strings.TrimSpace(key)); name != "INDEX" && name != "UNIQUEINDEX" {
+			continue
+		}
+		options := strings.Split(value, ",")
+		kept := options[:1]
+		for _, option := range options[1:] {
+			name, _, _ := strings.Cut(option, ":")
+			switch strings.ToUpper(strings.TrimSpace(name)) {
+			case "EXPRESSION", "TYPE":
+			default:
+				kept = append(kept, option)
+			}
+		}
+		settings[i] = key + ":" + strings.Join(kept, ",")
+	}
+	return strings.Join(settings, ";")
+}
+
+// assignUUIDs sets zero UUID primary keys of the created records, standing in for the
+// gen_random_uuid() column defaults of Postgres
+func assignUUIDs(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if field.FieldType != uuidType {
+			continue
+		}
+		switch value := db.Statement.ReflectValue; value.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < value.Len(); i++ {
+				assignUUID(db, field, reflect.Indirect(value.Index(i)))
+			}
+		case reflect.Struct:
+			assignUUID(db, field, value)
+		}
+	}
+}
+
+func assignUUID(db *gorm.DB, field *schema.Field, record reflect.Value) {
+	if _, zero := field.ValueOf(db.Statement.Context, record); zero {
+		db.AddError(field.Set(db.Statement.Context, record, uuid.New()))
+	}
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestDSN(t *testing.T) {
+	assert.Equal(t, "iam.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", DSN("iam.db"))
+	assert.Equal(t, "file:iam.db?mode=ro&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", DSN("file:iam.db?mode=ro"))
+
+	memory := DSN(":memory:")
+	assert.True(t, strings.HasPrefix(memory, "file:iam-"), memory)
+	assert.Contains(t, memory, "?mode=memory&cache=shared&")
+	assert.NotEqual(t, memory, DSN(":memory:"), "each in-memory database is private")
+}
+
+func TestSQLiteGormTag(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{"type:text;not null;default:'';index:idx_resources_path,expression:path text_pattern_ops", "type:text;not null;default:'';index:idx_resources_path"},
+		{"type:jsonb;index:idx_resources_attributes,type:gin", "type:jsonb;index:idx_resources_attributes"},
+		{"uniqueIndex:idx_roles_name,sort:desc", "uniqueIndex:idx_roles_name,sort:desc"},
+		{"type:uuid;primary_key;default:gen_random_uuid()", "type:uuid;primary_key;default:gen_random_uuid()"},
+		{"index", "index"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sqliteGormTag(tt.tag), tt.tag)
+	}
+}
+
+type shimModel struct {
+	ID   uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Path string    `gorm:"type:text;index:idx_shim_path,expression:path text_pattern_ops"`
+}
+
+func TestAdaptSchema(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, adaptSchema(db, &shimModel{}))
+
+	stmt := &gorm.Statement{DB: db}
+	require.NoError(t, stmt.Parse(&shimModel{}))
+	id := stmt.Schema.LookUpField("ID")
+	assert.False(t, id.HasDefaultValue)
+	assert.Empty(t, id.DefaultValue)
+
+	indexes := stmt.Schema.ParseIndexes()
+	require.Len(t, indexes, 1)
+	assert.Equal(t, "idx_shim_path", indexes[0].Name)
+	assert.Empty(t, indexes[0].Type)
+	require.Len(t, indexes[0].Fields, 1)
+	assert.Empty(t, indexes[0].Fields[0].Expression)
+}
+
+func TestAssignUUIDs(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("iam:assign_uuids", assignUUIDs))
+
+	existing := uuid.New()
+	records := []shimModel{{}, {ID: existing}}
+	require.NoError(t, db.Create(&records).Error)
+	assert.NotEqual(t, uuid.Nil, records[0].ID)
+	assert.Equal(t, existing, records[1].ID)
+
+	record := shimModel{}
+	require.NoError(t, db.Create(&record).Error)
+	assert.NotEqual(t, uuid.Nil, record.ID)
+}
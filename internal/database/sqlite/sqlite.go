@@ -0,0 +1,71 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Available reports whether the SQLite driver is compiled in
+const Available = true
+
+// Open returns the dialector of the SQLite database file at path (":memory:" for a
+// database that lives as long as the connection pool)
+func Open(path string) gorm.Dialector {
+	return &dialector{Dialector: sqlite.Open(DSN(path))}
+}
+
+// dialector adds the Postgres shims to the SQLite dialector
+type dialector struct {
+	gorm.Dialector
+}
+
+func (d *dialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	return db.Callback().Create().Before("gorm:create").Register("iam:assign_uuids", assignUUIDs)
+}
+
+func (d *dialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator{Migrator: d.Dialector.Migrator(db), db: db}
+}
+
+// SavePoint and RollbackTo keep nested transactions working through the wrapper
+func (d *dialector) SavePoint(tx *gorm.DB, name string) error {
+	return d.Dialector.(gorm.SavePointerDialectorInterface).SavePoint(tx, name)
+}
+
+func (d *dialector) RollbackTo(tx *gorm.DB, name string) error {
+	return d.Dialector.(gorm.SavePointerDialectorInterface).RollbackTo(tx, name)
+}
+
+// migrator adapts the schemas of the migrated models before tables are created
+type migrator struct {
+	gorm.Migrator
+	db *gorm.DB
+}
+
+func (m migrator) AutoMigrate(values ...interface{}) error {
+	if err := m.adapt(values); err != nil {
+		return err
+	}
+	return m.Migrator.AutoMigrate(values...)
+}
+
+func (m migrator) CreateTable(values ...interface{}) error {
+	if err := m.adapt(values); err != nil {
+		return err
+	}
+	return m.Migrator.CreateTable(values...)
+}
+
+func (m migrator) adapt(values []interface{}) error {
+	for _, value := range values {
+		if err := adaptSchema(m.db, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build !sqlite
+
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Available reports whether the SQLite driver is compiled in
+const Available = false
+
+// Open returns a dialector failing with ErrNotCompiled
+func Open(path string) gorm.Dialector {
+	return unavailable{}
+}
+
+type unavailable struct{}
+
+func (unavailable) Name() string                                          { return "sqlite" }
+func (unavailable) Initialize(*gorm.DB) error                             { return ErrNotCompiled }
+func (unavailable) Migrator(*gorm.DB) gorm.Migrator                       { return nil }
+func (unavailable) DataTypeOf(*schema.Field) string                       { return "" }
+func (unavailable) DefaultValueOf(*schema.Field) clause.Expression        { return clause.Expr{} }
+func (unavailable) BindVarTo(clause.Writer, *gorm.Statement, interface{}) {}
+func (unavailable) QuoteTo(clause.Writer, string)                         {}
+func (unavailable) Explain(sql string, vars ...interface{}) string        { return sql }
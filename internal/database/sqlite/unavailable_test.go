@@ -0,0 +1,17 @@
+//go:build !sqlite
+
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOpen_NotCompiled(t *testing.T) {
+	assert.False(t, Available)
+
+	_, err := gorm.Open(Open(":memory:"), &gorm.Config{})
+	assert.ErrorIs(t, err, ErrNotCompiled)
+}
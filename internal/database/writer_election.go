@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// writerLockID is the advisory lock key held by the writer of a single-writer deployment
+const writerLockID = 7245302
+
+// writerApplicationName prefixes the application_name of the session holding the writer lock,
+// so the other deployments can tell which region holds it
+const writerApplicationName = "iam-writer:"
+
+// regionLocalTables are written by every deployment of a single-writer deployment: they record
+// what happened in a region, not who has access
+var regionLocalTables = map[string]bool{
+	"decision_logs":    true,
+	"operations":       true,
+	"idempotency_keys": true,
+}
+
+// WriterElection elects the one deployment accepting writes among deployments in several regions
+// sharing a primary database. The writer holds a session-level advisory lock on a dedicated
+// connection of the primary; the others retry every interval and take over once the writer stops
+// or its session ends. While a deployment is not the writer, the write guard registered by
+// NewWriterElection fails its writes with a *domain.NotWriterError naming the writer's region.
+//
+// The primary releases the lock of a failed session before the writer notices, so two regions
+// could both hold it for a while. The writer therefore only writes within one interval of the
+// last check of its session, and a new writer waits one interval after taking the lock before it
+// writes: the two never write at the same time, but for statements already running.
+type WriterElection struct {
+	db       *sql.DB
+	region   string
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex // Serializes campaigns, session checks and resigning
+	conn      *sql.Conn  // Session holding the lock while this deployment is the writer
+	writer    atomic.Bool
+	leader    atomic.Value // Region of the writer seen by the last campaign lost, a string
+	verified  atomic.Int64 // Unix nanoseconds at which the last successful check of the session began
+	accepting atomic.Int64 // Unix nanoseconds from which the writer accepts writes
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWriterElection creates the writer election of region and guards the writes of the primary
+// with it. Writes fail until Start wins the election.
+func (db *Database) NewWriterElection(region string, interval time.Duration) (*WriterElection, error) {
+	if db.driver == DriverSQLite {
+		return nil, errors.New("single-writer mode requires the postgres driver")
+	}
+	primary, err := db.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	e := &WriterElection{
+		db:       primary,
+		region:   region,
+		interval: interval,
+		logger:   db.logger,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	e.leader.Store("")
+	if err := registerWriteGuard(db.DB, e.Check); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Start campaigns once, so a deployment starting alone accepts writes after one interval, then
+// every interval until Stop
+func (e *WriterElection) Start() {
+	e.campaign()
+	go e.run()
+}
+
+// Stop ends the campaigns and releases the writer lock, so another region takes over at its next
+// campaign instead of after the session times out. It waits for a running campaign to finish or
+// ctx to expire.
+func (e *WriterElection) Stop(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.resign(ctx)
+	return nil
+}
+
+// IsWriter reports whether this deployment holds the writer lock
+func (e *WriterElection) IsWriter() bool {
+	return e.writer.Load()
+}
+
+// Writer returns the region of the writer: this region while it holds the lock, otherwise the
+// region seen holding it at the last campaign, or "" when none did
+func (e *WriterElection) Writer() string {
+	if e.writer.Load() {
+		return e.region
+	}
+	return e.leader.Load().(string)
+}
+
+// Check returns nil while this deployment is the writer, and a *domain.NotWriterError otherwise.
+// Writes are refused during the first interval after the lock was taken, and when the session
+// holding it was last checked more than an interval ago and a new check fails.
+func (e *WriterElection) Check() error {
+	if e.writer.Load() && e.now().UnixNano() >= e.accepting.Load() && e.fresh() {
+		return nil
+	}
+	return &domain.NotWriterError{Region: e.region, Writer: e.Writer()}
+}
+
+// fresh reports whether the session holding the lock was checked within the last interval,
+// checking it again otherwise
+func (e *WriterElection) fresh() bool {
+	if e.now().UnixNano()-e.verified.Load() < int64(e.interval) {
+		return true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return false
+	}
+	// A campaign may have checked it while this waited for the lock
+	if e.now().UnixNano()-e.verified.Load() < int64(e.interval) {
+		return true
+	}
+	return e.verify()
+}
+
+// verify pings the session holding the lock, recording when the check began, and gives the lock
+// up when the session failed. e.mu must be held.
+func (e *WriterElection) verify() bool {
+	start := e.now()
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+
+	if err := e.conn.PingContext(ctx); err != nil {
+		e.writer.Store(false)
+		discard(e.conn)
+		e.conn = nil
+		e.logger.Error("Lost the writer lock; writes are refused until it is won again", "region", e.region, "error", err)
+		return false
+	}
+	e.verified.Store(start.UnixNano())
+	return true
+}
+
+func (e *WriterElection) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			e.campaign()
+		}
+	}
+}
+
+// campaign checks that the writer still holds its session, or tries to take the lock. The lock
+// is released by the server when the session ends, which another region may notice up to an
+// interval before this one: Check covers that window.
+func (e *WriterElection) campaign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn != nil && e.verify() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		e.logger.Warn("Writer election failed", "region", e.region, "error", err)
+		return
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", writerLockID).Scan(&acquired); err != nil {
+		// The lock may have been granted before the error, so the session cannot be reused
+		discard(conn)
+		e.logger.Warn("Writer election failed", "region", e.region, "error", err)
+		return
+	}
+	if !acquired {
+		conn.Close()
+		e.observe(ctx)
+		return
+	}
+
+	// Label the session, so the other regions can name the writer
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('application_name', $1, false)", writerApplicationName+e.region); err != nil {
+		discard(conn)
+		e.logger.Warn("Writer election failed", "region", e.region, "error", err)
+		return
+	}
+	// The previous writer may still write until an interval after it last checked its session
+	now := e.now()
+	e.conn = conn
+	e.verified.Store(now.UnixNano())
+	e.accepting.Store(now.Add(e.interval).UnixNano())
+	e.writer.Store(true)
+	e.leader.Store(e.region)
+	e.logger.Info("Elected the writer; accepting writes after one interval", "region", e.region, "interval", e.interval)
+}
+
+// observe records the region of the session holding the writer lock
+func (e *WriterElection) observe(ctx context.Context) {
+	var name string
+	err := e.db.QueryRowContext(ctx, `
+		SELECT a.application_name
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.classid = 0 AND l.objid = $1 AND l.objsubid = 1`,
+		writerLockID).Scan(&name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		e.logger.Warn("Failed to find the writer", "region", e.region, "error", err)
+		return
+	}
+
+	leader := strings.TrimPrefix(name, writerApplicationName)
+	if previous := e.leader.Swap(leader); previous != leader && leader != "" {
+		e.logger.Info("Writes are accepted by another region", "region", e.region, "writer", leader)
+	}
+}
+
+// resign releases the writer lock and closes its session
+func (e *WriterElection) resign(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return
+	}
+	e.writer.Store(false)
+	if _, err := e.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", writerLockID); err != nil {
+		e.logger.Warn("Failed to release the writer lock; it is released when the session closes", "error", err)
+	}
+	discard(e.conn)
+	e.conn = nil
+	e.logger.Info("Resigned as the writer", "region", e.region)
+}
+
+// discard closes the session of conn instead of returning it to the pool, where it would keep any
+// session-level lock it holds
+func discard(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// registerWriteGuard fails the writes through primary with the error of check, except those of
+// region-local tables and statements starting with SELECT, such as advisory locks
+func registerWriteGuard(primary *gorm.DB, check func() error) error {
+	guard := func(tx *gorm.DB) {
+		if tx.Error != nil || regionLocalTables[tx.Statement.Table] {
+			return
+		}
+		if err := check(); err != nil {
+			tx.AddError(err)
+		}
+	}
+	raw := func(tx *gorm.DB) {
+		statement := strings.TrimSpace(tx.Statement.SQL.String())
+		if len(statement) >= 6 && strings.EqualFold(statement[:6], "SELECT") {
+			return
+		}
+		guard(tx)
+	}
+	callbacks := primary.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("replication:single_writer", guard); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("replication:single_writer", guard); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("replication:single_writer", guard); err != nil {
+		return err
+	}
+	return callbacks.Raw().Before("gorm:raw").Register("replication:single_writer", raw)
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGuard(t *testing.T) {
+	db, _ := newSQLiteDatabase(t, 0)
+	require.NoError(t, db.Exec("CREATE TABLE bindings (id TEXT)").Error)
+	require.NoError(t, db.Exec("CREATE TABLE decision_logs (id TEXT)").Error)
+
+	var check error = &domain.NotWriterError{Region: "us-east-1", Writer: "eu-west-1"}
+	require.NoError(t, registerWriteGuard(db.DB, func() error { return check }))
+
+	err := db.Exec("INSERT INTO bindings (id) VALUES (?)", "b1").Error
+	assert.ErrorIs(t, err, domain.ErrNotWriter)
+	assert.ErrorContains(t, err, "send them to region eu-west-1")
+	assert.ErrorIs(t, db.Table("bindings").Create(map[string]interface{}{"id": "b2"}).Error, domain.ErrNotWriter)
+	assert.ErrorIs(t, db.Exec("DELETE FROM bindings").Error, domain.ErrNotWriter)
+
+	// Reads and region-local tables are not guarded
+	var count int64
+	require.NoError(t, db.Raw("SELECT count(*) FROM bindings").Scan(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	require.NoError(t, db.Table("decision_logs").Create(map[string]interface{}{"id": "d1"}).Error)
+
+	// The writer writes
+	check = nil
+	require.NoError(t, db.Exec("INSERT INTO bindings (id) VALUES (?)", "b1").Error)
+}
+
+func TestWriterElection(t *testing.T) {
+	cfg := getTestDatabaseConfig(t)
+
+	eu, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer eu.Close()
+	us, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer us.Close()
+
+	// Campaigns are run by the test, and time is advanced by it
+	clock := time.Now()
+	now := func() time.Time { return clock }
+	euElection, err := eu.NewWriterElection("eu-west-1", time.Hour)
+	require.NoError(t, err)
+	euElection.now = now
+	usElection, err := us.NewWriterElection("us-east-1", time.Hour)
+	require.NoError(t, err)
+	usElection.now = now
+
+	euElection.Start()
+	defer euElection.Stop(context.Background())
+	require.True(t, euElection.IsWriter())
+	assert.Equal(t, "eu-west-1", euElection.Writer())
+	assert.ErrorIs(t, euElection.Check(), domain.ErrNotWriter, "a new writer waits an interval")
+	clock = clock.Add(time.Hour)
+
+	usElection.Start()
+	defer usElection.Stop(context.Background())
+	assert.False(t, usElection.IsWriter())
+	assert.Equal(t, "eu-west-1", usElection.Writer())
+	err = us.Exec("CREATE TEMPORARY TABLE writes (id int)").Error
+	var notWriter *domain.NotWriterError
+	require.ErrorAs(t, err, &notWriter)
+	assert.Equal(t, "eu-west-1", notWriter.Writer)
+	require.NoError(t, eu.Exec("CREATE TEMPORARY TABLE writes (id int)").Error)
+
+	// The writer keeps the lock across campaigns, and hands it over when it stops
+	euElection.campaign()
+	assert.True(t, euElection.IsWriter())
+	require.NoError(t, euElection.Stop(context.Background()))
+	assert.False(t, euElection.IsWriter())
+	assert.Error(t, eu.Exec("CREATE TEMPORARY TABLE more_writes (id int)").Error)
+
+	usElection.campaign()
+	assert.True(t, usElection.IsWriter())
+	assert.Equal(t, "us-east-1", usElection.Writer())
+	assert.Error(t, us.Exec("CREATE TEMPORARY TABLE us_writes (id int)").Error)
+	clock = clock.Add(time.Hour)
+	require.NoError(t, us.Exec("CREATE TEMPORARY TABLE us_writes (id int)").Error)
+}
+
+// Test: The writer writes from one interval after taking the lock, and only within one interval
+// of the last check of its session
+func TestWriterElection_Check(t *testing.T) {
+	clock := time.Now()
+	e := &WriterElection{region: "eu-west-1", interval: 5 * time.Second, now: func() time.Time { return clock }}
+	e.leader.Store("")
+	assert.ErrorIs(t, e.Check(), domain.ErrNotWriter)
+
+	// Elected, with its session just checked
+	e.writer.Store(true)
+	e.verified.Store(clock.UnixNano())
+	e.accepting.Store(clock.Add(5 * time.Second).UnixNano())
+	assert.ErrorIs(t, e.Check(), domain.ErrNotWriter)
+
+	clock = clock.Add(4 * time.Second)
+	assert.ErrorIs(t, e.Check(), domain.ErrNotWriter)
+	clock = clock.Add(time.Second)
+	e.verified.Store(clock.Add(-4 * time.Second).UnixNano())
+	assert.NoError(t, e.Check())
+
+	// The session was last checked an interval ago and can no longer be
+	clock = clock.Add(time.Second)
+	var notWriter *domain.NotWriterError
+	require.ErrorAs(t, e.Check(), &notWriter)
+	assert.Equal(t, "eu-west-1", notWriter.Writer)
+}
+
+func TestNewWriterElection_SQLite(t *testing.T) {
+	db, _ := newSQLiteDatabase(t, 0)
+
+	_, err := db.NewWriterElection("eu-west-1", time.Second)
+	assert.ErrorContains(t, err, "requires the postgres driver")
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Access request statuses
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved"
+	AccessRequestRejected  = "rejected"
+	AccessRequestCancelled = "cancelled"
+)
+
+// AccessRequest is a principal's request for a role on a resource. A principal holding
+// iam.accessRequests.approve on the resource approves or rejects it; approval creates the
+// binding, which expires at ExpiresAt when set.
+type AccessRequest struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ResourceID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"resource_id"`
+	RoleID        uuid.UUID  `gorm:"type:uuid;not null" json:"role_id"`
+	Principal     string     `gorm:"not null;index" json:"principal"` // e.g. "user:alice@example.com"
+	Justification string     `gorm:"type:text" json:"justification"`
+	Status        string     `gorm:"not null;index" json:"status"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // Expiry of the granted binding
+	ReviewedBy    string     `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	ReviewComment string     `gorm:"type:text" json:"review_comment,omitempty"`
+	BindingID     *uuid.UUID `gorm:"type:uuid" json:"binding_id,omitempty"` // Binding created on approval
+	CreatedAt     time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"not null" json:"updated_at"`
+}
+
+// TableName specifies the table name for AccessRequest
+func (AccessRequest) TableName() string {
+	return "access_requests"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (r *AccessRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
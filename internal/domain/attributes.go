@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+)
+
+// Attributes are the free-form key/values of a resource, stored as a JSON object. Numbers read
+// from the database are json.Number, so large integers keep their precision.
+type Attributes map[string]interface{}
+
+// Value implements driver.Valuer; nil attributes are stored as NULL
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string]interface{}(a))
+	return string(data), err
+}
+
+// Scan implements sql.Scanner; NULL is read as empty attributes
+func (a *Attributes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = Attributes{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("failed to scan attributes of type %T", value)
+	}
+
+	attributes := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&attributes); err != nil {
+		return fmt.Errorf("invalid attributes: %w", err)
+	}
+	*a = attributes
+	return nil
+}
+
+// Patch returns a copy of the attributes with a merge patch applied: each key of patch replaces
+// the attribute of the same name, and keys whose value is nil (JSON null) are removed. Keys
+// missing from patch are kept, so callers changing different keys do not overwrite each other.
+func (a Attributes) Patch(patch map[string]interface{}) Attributes {
+	patched := make(Attributes, len(a)+len(patch))
+	maps.Copy(patched, a)
+	for key, value := range patch {
+		if value == nil {
+			delete(patched, key)
+			continue
+		}
+		patched[key] = value
+	}
+	return patched
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,8 +19,12 @@ type Binding struct {
 	Role      *Role          `gorm:"foreignKey:RoleID" json:"role,omitempty"`
 	Members   datatypes.JSON `gorm:"type:jsonb;not null" json:"members"` // Array of strings: ["user:alice@example.com", "group:admins"]
 	Condition *Condition     `gorm:"foreignKey:BindingID" json:"condition,omitempty"`
-	CreatedAt time.Time      `gorm:"not null" json:"created_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// Free-form key/values, e.g. {"iam.lint/suppress": "public-access"}
+	Annotations datatypes.JSON `gorm:"type:jsonb" json:"annotations,omitempty"`
+	CreatedAt   time.Time      `gorm:"not null" json:"created_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedBy   string         `json:"created_by,omitempty"` // Principal that created the binding; empty for the server
+	UpdatedBy   string         `json:"updated_by,omitempty"` // Principal of the latest change; bindings are replaced rather than changed, except to remove a member
 }
 
 // TableName specifies the table name for Binding
@@ -45,16 +50,57 @@ func (b *Binding) GetMembers() ([]string, error) {
 	return members, nil
 }
 
-// HasMember checks if a principal is in the members list
-func (b *Binding) HasMember(principal string) bool {
+// GetAnnotations unmarshals the Annotations JSON to a map; bindings without annotations return nil
+func (b *Binding) GetAnnotations() (map[string]string, error) {
+	if len(b.Annotations) == 0 {
+		return nil, nil
+	}
+	var annotations map[string]string
+	if err := json.Unmarshal(b.Annotations, &annotations); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+// ParseMembers returns the members parsed by ParseMember; it fails if the Members JSON is not
+// an array of strings or a member does not follow the grammar
+func (b *Binding) ParseMembers() ([]Principal, error) {
 	members, err := b.GetMembers()
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("invalid members: %w", err)
+	}
+	parsed := make([]Principal, len(members))
+	for i, member := range members {
+		if parsed[i], err = ParseMember(member); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// HasMember checks if a principal is in the members list, directly or through a domain member.
+// It fails if the principal or a member is invalid, rather than hiding corrupted members.
+func (b *Binding) HasMember(principal string) (bool, error) {
+	return b.HasAnyMember([]string{principal})
+}
+
+// HasAnyMember checks if the binding grants to any of the principals, e.g. a user and its groups
+func (b *Binding) HasAnyMember(principals []string) (bool, error) {
+	for _, principal := range principals {
+		if _, err := ParseMember(principal); err != nil {
+			return false, err
+		}
+	}
+	members, err := b.ParseMembers()
+	if err != nil {
+		return false, err
 	}
 	for _, member := range members {
-		if member == principal {
-			return true
+		for _, principal := range principals {
+			if MemberMatches(member.String(), principal) {
+				return true, nil
+			}
 		}
 	}
-	return false
+	return false, nil
 }
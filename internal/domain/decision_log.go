@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DecisionLog records the outcome of a single permission check, for security forensics
+type DecisionLog struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Principal  string    `gorm:"type:varchar(255);not null;index" json:"principal"`
+	ResourceID uuid.UUID `gorm:"type:uuid;not null;index" json:"resource_id"`
+	Permission string    `gorm:"type:varchar(255);not null" json:"permission"`
+	Allowed    bool      `gorm:"not null" json:"allowed"`
+	Reason     string    `gorm:"type:text" json:"reason"`
+	Role       string    `gorm:"type:varchar(255);not null;default:''" json:"role,omitempty"`       // Role that granted an allowed check, if known
+	Error      string    `gorm:"type:text" json:"error,omitempty"`                                  // Set when the check failed to evaluate
+	LatencyUS  int64     `gorm:"not null" json:"latency_us"`                                        // Evaluation time in microseconds
+	RequestID  string    `gorm:"type:varchar(128);not null;default:''" json:"request_id,omitempty"` // x-request-id of the check, when known
+	Service    string    `gorm:"type:varchar(255);not null;default:''" json:"service,omitempty"`    // Principal of the service that made the check, when known
+	CreatedAt  time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+// TableName specifies the table name for DecisionLog
+func (DecisionLog) TableName() string {
+	return "decision_logs"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (d *DecisionLog) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
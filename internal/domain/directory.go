@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// User is a person provisioned from an identity provider (e.g. via SCIM)
+type User struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ExternalID  string    `gorm:"type:varchar(255);index" json:"external_id,omitempty"`    // Identifier assigned by the identity provider
+	UserName    string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"user_name"` // Usually the email address
+	DisplayName string    `gorm:"type:varchar(255)" json:"display_name,omitempty"`
+	Email       string    `gorm:"type:varchar(255)" json:"email,omitempty"`
+	Active      bool      `gorm:"not null;default:true" json:"active"` // Inactive users keep direct bindings but lose group memberships
+	Groups      []Group   `gorm:"many2many:group_members;" json:"groups,omitempty"`
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName specifies the table name for User
+func (User) TableName() string {
+	return "users"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
+
+// Principal returns the binding member naming the user, e.g. "user:alice@example.com"
+func (u *User) Principal() string {
+	return PrincipalTypeUser + ":" + u.UserName
+}
+
+// Group is a set of users provisioned from an identity provider. Bindings granted to
+// the group's principal apply to all of its active members.
+type Group struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ExternalID  string    `gorm:"type:varchar(255);index" json:"external_id,omitempty"`
+	DisplayName string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"display_name"` // e.g. "engineering@example.com"
+	Members     []User    `gorm:"many2many:group_members;" json:"members,omitempty"`
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName specifies the table name for Group
+func (Group) TableName() string {
+	return "groups"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (g *Group) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
+
+// Principal returns the binding member naming the group, e.g. "group:engineering@example.com"
+func (g *Group) Principal() string {
+	return PrincipalTypeGroup + ":" + g.DisplayName
+}
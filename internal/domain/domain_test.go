@@ -1,53 +1,60 @@
 package domain
 
 import (
-	"fmt"
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/database/sqlite"
+	"github.com/pguia/iam/internal/testharness/testenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// setupTestDB creates a test database connection
+// setupTestDB creates the tables in a new schema of the test Postgres server (see testenv).
+// TEST_DB_DRIVER=sqlite uses an embedded SQLite database instead (needs -tags sqlite).
 func setupTestDB(t *testing.T) *gorm.DB {
-	// Get test database connection string from env or use default
-	dbHost := os.Getenv("TEST_DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
+	if os.Getenv("TEST_DB_DRIVER") == "sqlite" {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "iam.db")), &gorm.Config{})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		migrateTestDB(t, db)
+		return db
 	}
 
-	dsn := fmt.Sprintf("host=%s port=5432 user=postgres password=postgres dbname=iam_db sslmode=disable",
-		dbHost)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	require.NoError(t, err)
-
-	// Create a unique schema for this test to avoid conflicts
-	schemaName := fmt.Sprintf("test_%s", uuid.New().String()[:8])
-	db.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schemaName))
-	db.Exec(fmt.Sprintf("SET search_path TO %s", schemaName))
+	db := testenv.OpenPostgres(t)
+	migrateTestDB(t, db)
+	return db
+}
 
-	// Auto-migrate all tables
-	err = db.AutoMigrate(
+// migrateTestDB creates the tables of all models
+func migrateTestDB(t *testing.T, db *gorm.DB) {
+	err := db.AutoMigrate(
 		&Resource{},
 		&Permission{},
 		&Role{},
 		&Policy{},
 		&Binding{},
 		&Condition{},
+		&PolicyRevision{},
+		&DecisionLog{},
+		&ResourceClosure{},
+		&Operation{},
+		&User{},
+		&Group{},
+		&AccessRecommendation{},
+		&GrantConstraint{},
+		&ResourceTag{},
+		&IdempotencyKey{},
 	)
 	require.NoError(t, err)
-
-	// Cleanup after test
-	t.Cleanup(func() {
-		db.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schemaName))
-	})
-
-	return db
 }
 
 // Test Role domain model
@@ -309,6 +316,29 @@ func TestResource_GetAncestors_SingleParent(t *testing.T) {
 }
 
 // Test Binding domain model
+func TestResource_AncestorIDs(t *testing.T) {
+	org, folder, project := uuid.New(), uuid.New(), uuid.New()
+	path := ResourcePath(ResourcePath(ResourcePath("", org), folder), project)
+	assert.Equal(t, "/"+org.String()+"/"+folder.String()+"/"+project.String()+"/", path)
+
+	resource := &Resource{ID: project, Path: path}
+	ids, err := resource.AncestorIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{folder, org}, ids)
+
+	root := &Resource{ID: org, Path: ResourcePath("", org)}
+	ids, err = root.AncestorIDs()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	ids, err = (&Resource{}).AncestorIDs()
+	assert.NoError(t, err)
+	assert.Nil(t, ids)
+
+	_, err = (&Resource{Path: "/not-a-uuid/" + project.String() + "/"}).AncestorIDs()
+	assert.Error(t, err)
+}
+
 func TestBinding_TableName(t *testing.T) {
 	binding := Binding{}
 	assert.Equal(t, "bindings", binding.TableName())
@@ -371,16 +401,53 @@ func TestBinding_GetMembers_InvalidJSON(t *testing.T) {
 	assert.Nil(t, members)
 }
 
+func TestBinding_GetAnnotations(t *testing.T) {
+	binding := &Binding{Annotations: []byte(`{"iam.lint/suppress": "public-access"}`)}
+	annotations, err := binding.GetAnnotations()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"iam.lint/suppress": "public-access"}, annotations)
+
+	annotations, err = (&Binding{}).GetAnnotations()
+	assert.NoError(t, err)
+	assert.Nil(t, annotations)
+}
+
+func TestPolicyRevision_KeepsAnnotations(t *testing.T) {
+	policy := &Policy{Bindings: []Binding{
+		{RoleID: uuid.New(), Members: []byte(`["user:alice@example.com"]`), Annotations: []byte(`{"team": "storage"}`)},
+		{RoleID: uuid.New(), Members: []byte(`["user:bob@example.com"]`)},
+	}}
+	revision, err := NewPolicyRevision(policy, "")
+	assert.NoError(t, err)
+
+	bindings, err := revision.ToBindings()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"team": "storage"}`, string(bindings[0].Annotations))
+	assert.Empty(t, bindings[1].Annotations)
+}
+
+// hasMember calls binding.HasMember, failing the test on error
+func hasMember(t *testing.T, binding *Binding, principal string) bool {
+	t.Helper()
+	ok, err := binding.HasMember(principal)
+	require.NoError(t, err)
+	return ok
+}
+
 func TestBinding_HasMember(t *testing.T) {
 	binding := &Binding{
 		Members: []byte(`["user:alice@example.com", "user:bob@example.com", "group:admins"]`),
 	}
 
-	assert.True(t, binding.HasMember("user:alice@example.com"))
-	assert.True(t, binding.HasMember("user:bob@example.com"))
-	assert.True(t, binding.HasMember("group:admins"))
-	assert.False(t, binding.HasMember("user:charlie@example.com"))
-	assert.False(t, binding.HasMember(""))
+	assert.True(t, hasMember(t, binding, "user:alice@example.com"))
+	assert.True(t, hasMember(t, binding, "user:bob@example.com"))
+	assert.True(t, hasMember(t, binding, "group:admins"))
+	assert.False(t, hasMember(t, binding, "user:charlie@example.com"))
+
+	_, err := binding.HasMember("")
+	assert.ErrorIs(t, err, ErrInvalidPrincipal)
+	_, err = binding.HasMember("alice@example.com")
+	assert.ErrorIs(t, err, ErrInvalidPrincipal)
 }
 
 func TestBinding_HasMember_EmptyMembers(t *testing.T) {
@@ -388,7 +455,7 @@ func TestBinding_HasMember_EmptyMembers(t *testing.T) {
 		Members: []byte(`[]`),
 	}
 
-	assert.False(t, binding.HasMember("user:alice@example.com"))
+	assert.False(t, hasMember(t, binding, "user:alice@example.com"))
 }
 
 func TestBinding_HasMember_InvalidJSON(t *testing.T) {
@@ -396,7 +463,66 @@ func TestBinding_HasMember_InvalidJSON(t *testing.T) {
 		Members: []byte(`invalid`),
 	}
 
-	assert.False(t, binding.HasMember("user:alice@example.com"))
+	ok, err := binding.HasMember("user:alice@example.com")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestBinding_HasMember_InvalidMember(t *testing.T) {
+	binding := &Binding{
+		Members: []byte(`["user:alice@example.com", "user:bob smith"]`),
+	}
+
+	ok, err := binding.HasMember("user:alice@example.com")
+	assert.ErrorIs(t, err, ErrInvalidPrincipal)
+	assert.False(t, ok)
+}
+
+func TestBinding_HasMember_Domain(t *testing.T) {
+	binding := &Binding{
+		Members: []byte(`["domain:example.com"]`),
+	}
+
+	assert.True(t, hasMember(t, binding, "user:alice@example.com"))
+	assert.True(t, hasMember(t, binding, "user:Bob@EXAMPLE.com"))
+	assert.True(t, hasMember(t, binding, "domain:example.com"))
+	assert.False(t, hasMember(t, binding, "user:alice@sub.example.com"))
+	assert.False(t, hasMember(t, binding, "user:alice@other.com"))
+	assert.False(t, hasMember(t, binding, "group:admins@example.com"))
+}
+
+func TestPrincipalDomain(t *testing.T) {
+	tests := []struct {
+		principal string
+		expected  string
+	}{
+		{"user:alice@example.com", "example.com"},
+		{"user:alice@Example.COM", "example.com"},
+		{"user:first.last+tag@mail.example.org", "mail.example.org"},
+		{"group:admins@example.com", ""},
+		{"serviceAccount:sa@project.iam.gserviceaccount.com", ""},
+		{"user:alice", ""},
+		{"user:alice@", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PrincipalDomain(tt.principal))
+		})
+	}
+
+	assert.Equal(t, "domain:example.com", DomainPrincipal("user:alice@example.com"))
+	assert.Empty(t, DomainPrincipal("group:admins@example.com"))
+}
+
+func TestMemberMatches(t *testing.T) {
+	assert.True(t, MemberMatches("user:alice@example.com", "user:alice@example.com"))
+	assert.True(t, MemberMatches("domain:example.com", "user:alice@example.com"))
+	assert.True(t, MemberMatches("domain:EXAMPLE.com", "user:alice@example.com"))
+	assert.False(t, MemberMatches("domain:", "user:alice@"))
+	assert.False(t, MemberMatches("domain:example.com", "user:alice@notexample.com"))
+	assert.False(t, MemberMatches("user:bob@example.com", "user:alice@example.com"))
 }
 
 // Test Condition domain model
@@ -553,3 +679,45 @@ func TestDomain_ResourceHierarchy(t *testing.T) {
 	assert.Equal(t, parent.ID, loadedChild.Parent.ID)
 	assert.Equal(t, "parent", loadedChild.Parent.Name)
 }
+
+func TestGrantConstraint_AppliesToAndAllows(t *testing.T) {
+	constraint := &GrantConstraint{
+		Members:      []byte(`["user:lead@example.com", "domain:eng.example.com"]`),
+		AllowedRoles: []byte(`["roles/storage.viewer"]`),
+	}
+
+	assert.True(t, constraint.AppliesTo("user:lead@example.com"))
+	assert.True(t, constraint.AppliesTo("user:bob@eng.example.com"))
+	assert.False(t, constraint.AppliesTo("user:bob@example.com"))
+
+	assert.True(t, constraint.Allows("roles/storage.viewer"))
+	assert.False(t, constraint.Allows("roles/owner"))
+}
+
+func TestAttributes_Patch(t *testing.T) {
+	attributes := Attributes{"region": "eu", "tier": "gold"}
+
+	patched := attributes.Patch(map[string]interface{}{"region": "us", "tier": nil, "owner": "storage"})
+	assert.Equal(t, Attributes{"region": "us", "owner": "storage"}, patched)
+	assert.Equal(t, Attributes{"region": "eu", "tier": "gold"}, attributes, "the original is left unchanged")
+
+	assert.Equal(t, Attributes{"owner": "storage"}, Attributes(nil).Patch(map[string]interface{}{"owner": "storage"}))
+}
+
+func TestAttributes_ValueAndScan(t *testing.T) {
+	value, err := Attributes{"size": 9007199254740993}.Value()
+	require.NoError(t, err)
+
+	var scanned Attributes
+	require.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, Attributes{"size": json.Number("9007199254740993")}, scanned, "large integers keep their precision")
+
+	value, err = Attributes(nil).Value()
+	require.NoError(t, err)
+	assert.Nil(t, value)
+	require.NoError(t, scanned.Scan(nil))
+	assert.Equal(t, Attributes{}, scanned)
+
+	assert.Error(t, scanned.Scan(42))
+	assert.Error(t, scanned.Scan("[1]"))
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// EvaluationGrant is one row of the evaluation read model: a permission granted to a member on a
+// resource by a binding, with the binding's condition copied in. The table is derived from
+// policies, bindings, conditions and roles, and is rewritten in the same transaction as every
+// change to them, so a permission check is a single indexed lookup.
+type EvaluationGrant struct {
+	BindingID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"binding_id"`
+	Member              string     `gorm:"type:varchar(255);primaryKey;index:idx_evaluation_grants_lookup,priority:3" json:"member"` // See GrantMember
+	Permission          string     `gorm:"type:varchar(255);primaryKey;index:idx_evaluation_grants_lookup,priority:2" json:"permission"`
+	ResourceID          uuid.UUID  `gorm:"type:uuid;not null;index:idx_evaluation_grants_lookup,priority:1" json:"resource_id"`
+	RoleID              uuid.UUID  `gorm:"type:uuid;not null;index" json:"role_id"`
+	RoleName            string     `gorm:"type:varchar(255);not null" json:"role_name"`
+	ConditionID         *uuid.UUID `gorm:"type:uuid" json:"condition_id,omitempty"`
+	ConditionExpression string     `gorm:"type:text" json:"condition_expression,omitempty"`
+}
+
+// TableName specifies the table name for EvaluationGrant
+func (EvaluationGrant) TableName() string {
+	return "evaluation_grants"
+}
+
+// Conditional reports whether the grant only applies when its condition holds
+func (g *EvaluationGrant) Conditional() bool {
+	return g.ConditionID != nil
+}
+
+// GrantMember is the key a binding member is stored under in the evaluation read model. Domains
+// are lower-cased, since "domain:Example.com" grants to every user of example.com.
+func GrantMember(member string) string {
+	if name, ok := strings.CutPrefix(member, PrincipalTypeDomain+":"); ok {
+		return PrincipalTypeDomain + ":" + strings.ToLower(name)
+	}
+	return member
+}
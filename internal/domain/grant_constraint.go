@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GrantConstraint limits the roles its members may grant or revoke on a resource and its
+// descendants, e.g. so a team lead with iam.policies.update on a project can only hand out
+// viewer and editor roles. Constraints on a resource and its ancestors all apply.
+type GrantConstraint struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ResourceID   uuid.UUID      `gorm:"type:uuid;not null;index" json:"resource_id"`
+	Members      datatypes.JSON `gorm:"type:jsonb;not null" json:"members"`       // Array of principals, e.g. ["user:lead@example.com", "domain:example.com"]
+	AllowedRoles datatypes.JSON `gorm:"type:jsonb;not null" json:"allowed_roles"` // Array of role names
+	Description  string         `gorm:"type:text" json:"description"`
+	CreatedAt    time.Time      `gorm:"not null" json:"created_at"`
+	UpdatedAt    time.Time      `gorm:"not null" json:"updated_at"`
+}
+
+// TableName specifies the table name for GrantConstraint
+func (GrantConstraint) TableName() string {
+	return "grant_constraints"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (c *GrantConstraint) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// GetMembers unmarshals the Members JSON to a string slice
+func (c *GrantConstraint) GetMembers() ([]string, error) {
+	var members []string
+	if err := json.Unmarshal(c.Members, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetAllowedRoles unmarshals the AllowedRoles JSON to a string slice
+func (c *GrantConstraint) GetAllowedRoles() ([]string, error) {
+	var roles []string
+	if err := json.Unmarshal(c.AllowedRoles, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// AppliesTo reports whether principal is one of the constraint's members, directly or
+// through a domain member
+func (c *GrantConstraint) AppliesTo(principal string) bool {
+	members, err := c.GetMembers()
+	if err != nil {
+		return false
+	}
+	for _, member := range members {
+		if MemberMatches(member, principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the constraint lets its members grant role
+func (c *GrantConstraint) Allows(role string) bool {
+	roles, err := c.GetAllowedRoles()
+	if err != nil {
+		return false
+	}
+	for _, allowed := range roles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
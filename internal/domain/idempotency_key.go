@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// IdempotencyKey records a mutating request sent with a client-chosen key, so a retry with the
+// same key returns the original result instead of repeating the mutation
+type IdempotencyKey struct {
+	Method      string         `gorm:"type:varchar(100);primaryKey" json:"method"` // e.g. "CreateResource"
+	Key         string         `gorm:"type:varchar(255);primaryKey" json:"key"`
+	Fingerprint string         `gorm:"type:varchar(64);not null" json:"fingerprint"` // SHA-256 of the request
+	Response    datatypes.JSON `gorm:"type:jsonb" json:"response,omitempty"`         // Set once the request completed
+	Completed   bool           `gorm:"not null;default:false" json:"completed"`
+	CreatedAt   time.Time      `gorm:"not null" json:"created_at"`
+	ExpiresAt   time.Time      `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName specifies the table name for IdempotencyKey
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// OperationState is the lifecycle state of a long-running operation
+type OperationState string
+
+const (
+	OperationPending   OperationState = "pending"   // Queued, waiting for a worker
+	OperationRunning   OperationState = "running"   // Being executed by a worker
+	OperationSucceeded OperationState = "succeeded" // Finished; Result holds its output
+	OperationFailed    OperationState = "failed"    // Finished; Error holds the reason
+)
+
+// Operation tracks a long-running request, such as a bulk import or a subtree delete,
+// executed in the background so clients can poll for its outcome
+type Operation struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Type       string         `gorm:"type:varchar(100);not null;index" json:"type"` // e.g., "DeleteResourceTree"
+	State      OperationState `gorm:"type:varchar(20);not null;index" json:"state"`
+	Target     string         `gorm:"type:varchar(255)" json:"target,omitempty"` // What the operation acts on, e.g. a resource ID
+	Completed  int64          `gorm:"not null;default:0" json:"completed"`       // Items processed so far
+	Total      int64          `gorm:"not null;default:0" json:"total"`           // Items to process; 0 while unknown
+	Error      string         `gorm:"type:text" json:"error,omitempty"`
+	Result     datatypes.JSON `gorm:"type:jsonb" json:"result,omitempty"`
+	CreatedAt  time.Time      `gorm:"not null;index" json:"created_at"`
+	UpdatedAt  time.Time      `gorm:"not null" json:"updated_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// TableName specifies the table name for Operation
+func (Operation) TableName() string {
+	return "operations"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (o *Operation) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// Done reports whether the operation has finished, successfully or not
+func (o *Operation) Done() bool {
+	return o.State == OperationSucceeded || o.State == OperationFailed
+}
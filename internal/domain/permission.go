@@ -9,12 +9,15 @@ import (
 
 // Permission represents a specific action that can be performed
 type Permission struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name        string         `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"` // e.g., "storage.buckets.create"
-	Description string         `gorm:"type:text" json:"description"`
-	Service     string         `gorm:"type:varchar(100);index" json:"service"` // e.g., "storage", "compute"
-	CreatedAt   time.Time      `gorm:"not null" json:"created_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"` // e.g., "storage.buckets.create"
+	Description string    `gorm:"type:text" json:"description"`
+	Service     string    `gorm:"type:varchar(100);index" json:"service"`   // e.g., "storage", "compute"
+	Deprecated  bool      `gorm:"not null;default:false" json:"deprecated"` // Dropped from the service's catalog; still granted
+	// Permission to grant instead of a deprecated one, if any
+	ReplacementName string         `gorm:"type:varchar(255);not null;default:''" json:"replacement_name,omitempty"`
+	CreatedAt       time.Time      `gorm:"not null" json:"created_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 // TableName specifies the table name for Permission
@@ -18,6 +18,21 @@ type Policy struct {
 	CreatedAt  time.Time      `gorm:"not null" json:"created_at"`
 	UpdatedAt  time.Time      `gorm:"not null" json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedBy  string         `json:"created_by,omitempty"` // Principal that created the policy; empty for the server
+	UpdatedBy  string         `json:"updated_by,omitempty"` // Principal of the latest change, including to its bindings
+
+	// Computed when the policy is returned by the API; not stored
+	Metadata *PolicyMetadata `gorm:"-" json:"metadata,omitempty"`
+}
+
+// PolicyMetadata summarizes a policy for display, so clients need not recompute it
+type PolicyMetadata struct {
+	Bindings       int       `json:"bindings"`
+	Members        int       `json:"members"`          // Distinct members across all bindings
+	Roles          []string  `json:"roles"`            // Names of the roles granted, sorted
+	PublicMembers  bool      `json:"public_members"`   // Whether allUsers or allAuthenticatedUsers is bound
+	LastModifiedBy string    `json:"last_modified_by"` // Author of the latest revision, when known
+	LastModifiedAt time.Time `json:"last_modified_at"`
 }
 
 // TableName specifies the table name for Policy
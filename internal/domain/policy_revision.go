@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrRevisionImmutable is returned when attempting to modify a stored policy revision
+var ErrRevisionImmutable = errors.New("policy revisions are immutable")
+
+// PolicyRevision is an immutable snapshot of a policy at a given version
+type PolicyRevision struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PolicyID   uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_policy_revisions_policy_revision" json:"policy_id"`
+	ResourceID uuid.UUID      `gorm:"type:uuid;not null;index" json:"resource_id"`
+	Revision   int            `gorm:"not null;uniqueIndex:idx_policy_revisions_policy_revision" json:"revision"` // Policy version captured by this snapshot
+	ETag       string         `gorm:"type:varchar(64)" json:"etag"`
+	Bindings   datatypes.JSON `gorm:"type:jsonb;not null" json:"bindings"`                               // Array of BindingSnapshot
+	Author     string         `gorm:"type:varchar(255)" json:"author"`                                   // Principal that made the change, when known
+	Service    string         `gorm:"type:varchar(255);not null;default:''" json:"service,omitempty"`    // Service that made the change on behalf of Author, when known
+	RequestID  string         `gorm:"type:varchar(128);not null;default:''" json:"request_id,omitempty"` // x-request-id of the change, when known
+	CreatedAt  time.Time      `gorm:"not null" json:"created_at"`
+}
+
+// BindingSnapshot is the stored form of a binding inside a policy revision
+type BindingSnapshot struct {
+	RoleID      uuid.UUID          `json:"role_id"`
+	Members     []string           `json:"members"`
+	Condition   *ConditionSnapshot `json:"condition,omitempty"`
+	Annotations map[string]string  `json:"annotations,omitempty"`
+}
+
+// ConditionSnapshot is the stored form of a binding condition inside a policy revision
+type ConditionSnapshot struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Expression  string `json:"expression"`
+}
+
+// TableName specifies the table name for PolicyRevision
+func (PolicyRevision) TableName() string {
+	return "policy_revisions"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (r *PolicyRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeUpdate hook rejects any modification of a stored revision
+func (r *PolicyRevision) BeforeUpdate(tx *gorm.DB) error {
+	return ErrRevisionImmutable
+}
+
+// BeforeDelete hook rejects deletion of a stored revision
+func (r *PolicyRevision) BeforeDelete(tx *gorm.DB) error {
+	return ErrRevisionImmutable
+}
+
+// NewPolicyRevision snapshots the current state of a policy and its bindings
+func NewPolicyRevision(policy *Policy, author string) (*PolicyRevision, error) {
+	snapshots := make([]BindingSnapshot, 0, len(policy.Bindings))
+	for i := range policy.Bindings {
+		members, err := policy.Bindings[i].GetMembers()
+		if err != nil {
+			return nil, err
+		}
+
+		annotations, err := policy.Bindings[i].GetAnnotations()
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot := BindingSnapshot{
+			RoleID:      policy.Bindings[i].RoleID,
+			Members:     members,
+			Annotations: annotations,
+		}
+		if c := policy.Bindings[i].Condition; c != nil {
+			snapshot.Condition = &ConditionSnapshot{
+				Title:       c.Title,
+				Description: c.Description,
+				Expression:  c.Expression,
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PolicyRevision{
+		PolicyID:   policy.ID,
+		ResourceID: policy.ResourceID,
+		Revision:   policy.Version,
+		ETag:       policy.ETag,
+		Bindings:   datatypes.JSON(data),
+		Author:     author,
+	}, nil
+}
+
+// GetBindings unmarshals the bindings snapshot
+func (r *PolicyRevision) GetBindings() ([]BindingSnapshot, error) {
+	var snapshots []BindingSnapshot
+	if err := json.Unmarshal(r.Bindings, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// ToBindings rebuilds new (unsaved) bindings from the snapshot
+func (r *PolicyRevision) ToBindings() ([]Binding, error) {
+	snapshots, err := r.GetBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]Binding, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		members, err := json.Marshal(snapshot.Members)
+		if err != nil {
+			return nil, err
+		}
+
+		binding := Binding{
+			RoleID:  snapshot.RoleID,
+			Members: datatypes.JSON(members),
+		}
+		if len(snapshot.Annotations) > 0 {
+			annotations, err := json.Marshal(snapshot.Annotations)
+			if err != nil {
+				return nil, err
+			}
+			binding.Annotations = datatypes.JSON(annotations)
+		}
+		if snapshot.Condition != nil {
+			binding.Condition = &Condition{
+				Title:       snapshot.Condition.Title,
+				Description: snapshot.Condition.Description,
+				Expression:  snapshot.Condition.Expression,
+			}
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return bindings, nil
+}
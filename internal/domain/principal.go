@@ -0,0 +1,178 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Principal type prefixes
+const (
+	PrincipalTypeUser           = "user"
+	PrincipalTypeGroup          = "group"
+	PrincipalTypeServiceAccount = "serviceAccount"
+	PrincipalTypeDomain         = "domain"
+)
+
+// PrincipalDomain returns the email domain of a user principal (lower-cased),
+// e.g. "example.com" for "user:alice@Example.com", or "" for other principals
+func PrincipalDomain(principal string) string {
+	email, ok := strings.CutPrefix(principal, PrincipalTypeUser+":")
+	if !ok {
+		return ""
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// DomainPrincipal returns the domain principal matching all users of a user principal's
+// domain, e.g. "domain:example.com" for "user:alice@example.com", or "" for other principals
+func DomainPrincipal(principal string) string {
+	domain := PrincipalDomain(principal)
+	if domain == "" {
+		return ""
+	}
+	return PrincipalTypeDomain + ":" + domain
+}
+
+// MemberMatches reports whether a binding member grants to principal.
+// Members match exactly, "domain:example.com" matches every user:...@example.com, allUsers
+// matches every caller and allAuthenticatedUsers every caller with a principal.
+func MemberMatches(member, principal string) bool {
+	switch member {
+	case principal, MemberAllUsers:
+		return true
+	case MemberAllAuthenticatedUsers:
+		return principal != ""
+	}
+
+	domain, ok := strings.CutPrefix(member, PrincipalTypeDomain+":")
+	if !ok || domain == "" {
+		return false
+	}
+	return strings.EqualFold(domain, PrincipalDomain(principal))
+}
+
+// Members granting to every caller, authenticated or not, and to every authenticated caller
+const (
+	MemberAllUsers              = "allUsers"
+	MemberAllAuthenticatedUsers = "allAuthenticatedUsers"
+)
+
+// IsPublicMember reports whether member is allUsers or allAuthenticatedUsers
+func IsPublicMember(member string) bool {
+	return member == MemberAllUsers || member == MemberAllAuthenticatedUsers
+}
+
+// MaxPrincipalLength is the longest principal or member accepted, in bytes
+const MaxPrincipalLength = 320
+
+// ErrInvalidPrincipal is returned for principals and members that do not follow the grammar
+var ErrInvalidPrincipal = errors.New("invalid principal")
+
+// Principal is a parsed principal or binding member, e.g. {user alice@example.com}. The special
+// members allUsers and allAuthenticatedUsers have their name as Type and no ID.
+type Principal struct {
+	Type string
+	ID   string
+}
+
+// String returns the principal as written, e.g. "user:alice@example.com"
+func (p Principal) String() string {
+	if p.ID == "" {
+		return p.Type
+	}
+	return p.Type + ":" + p.ID
+}
+
+// ParsePrincipal parses the principal of a caller:
+//
+//	principal = ("user" | "serviceAccount" | "group") ":" id
+//	id        = 1*idchar | 1*idchar "@" dns-name
+//	idchar    = any printable, non-space character but ":" and "@"
+//	dns-name  = label *("." label), labels of letters, digits and inner "-", at most 63 long
+//
+// Principals are at most MaxPrincipalLength bytes long.
+func ParsePrincipal(s string) (Principal, error) {
+	p, err := ParseMember(s)
+	if err != nil {
+		return Principal{}, err
+	}
+	switch p.Type {
+	case PrincipalTypeUser, PrincipalTypeServiceAccount, PrincipalTypeGroup:
+		return p, nil
+	}
+	return Principal{}, fmt.Errorf("%w %q: %s is only valid as a binding member", ErrInvalidPrincipal, s, p.Type)
+}
+
+// ParseMember parses a binding member: a principal, "domain:" dns-name, or one of the special
+// members allUsers and allAuthenticatedUsers
+func ParseMember(s string) (Principal, error) {
+	if len(s) > MaxPrincipalLength {
+		return Principal{}, fmt.Errorf("%w: longer than %d bytes", ErrInvalidPrincipal, MaxPrincipalLength)
+	}
+	if s == MemberAllUsers || s == MemberAllAuthenticatedUsers {
+		return Principal{Type: s}, nil
+	}
+
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok {
+		return Principal{}, fmt.Errorf("%w %q: expected type:id", ErrInvalidPrincipal, s)
+	}
+	var err error
+	switch typ {
+	case PrincipalTypeUser, PrincipalTypeServiceAccount, PrincipalTypeGroup:
+		err = validatePrincipalID(id)
+	case PrincipalTypeDomain:
+		err = validateDNSName(id)
+	default:
+		err = fmt.Errorf("unknown type %q", typ)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w %q: %v", ErrInvalidPrincipal, s, err)
+	}
+	return Principal{Type: typ, ID: id}, nil
+}
+
+// validatePrincipalID checks the id of a user, service account or group
+func validatePrincipalID(id string) error {
+	name, host, hasHost := strings.Cut(id, "@")
+	if name == "" {
+		return errors.New("empty id")
+	}
+	for _, r := range name {
+		if r == ':' || r == '@' || r == utf8.RuneError || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("invalid character %q in id", r)
+		}
+	}
+	if hasHost {
+		return validateDNSName(host)
+	}
+	return nil
+}
+
+// validateDNSName checks a domain name, e.g. "example.com"
+func validateDNSName(name string) error {
+	if name == "" {
+		return errors.New("empty domain")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid domain %q", name)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid domain %q", name)
+		}
+		for _, c := range []byte(label) {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid domain %q", name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PrincipalAlias links an alias identity to its canonical principal, e.g. the
+// user:alice@example.com a user had before a domain migration to the current
+// user:alice@corp.example.com. Bindings to either identity grant to both.
+type PrincipalAlias struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Alias     string    `gorm:"not null;uniqueIndex" json:"alias"`
+	Principal string    `gorm:"not null;index" json:"principal"` // Canonical principal
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// TableName specifies the table name for PrincipalAlias
+func (PrincipalAlias) TableName() string {
+	return "principal_aliases"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (a *PrincipalAlias) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMember(t *testing.T) {
+	tests := []struct {
+		member   string
+		expected Principal
+		valid    bool
+	}{
+		{"user:alice@example.com", Principal{"user", "alice@example.com"}, true},
+		{"user:alice", Principal{"user", "alice"}, true},
+		{"user:first.last+tag@mail.example.org", Principal{"user", "first.last+tag@mail.example.org"}, true},
+		{"serviceAccount:sa@project.iam.gserviceaccount.com", Principal{"serviceAccount", "sa@project.iam.gserviceaccount.com"}, true},
+		{"serviceAccount:1234567890", Principal{"serviceAccount", "1234567890"}, true},
+		{"group:admins", Principal{"group", "admins"}, true},
+		{"group:eng-team@example.com", Principal{"group", "eng-team@example.com"}, true},
+		{"domain:Example.com", Principal{"domain", "Example.com"}, true},
+		{"allUsers", Principal{Type: "allUsers"}, true},
+		{"allAuthenticatedUsers", Principal{Type: "allAuthenticatedUsers"}, true},
+
+		{"", Principal{}, false},
+		{"alice@example.com", Principal{}, false},
+		{"user:", Principal{}, false},
+		{"user:@example.com", Principal{}, false},
+		{"user:alice@", Principal{}, false},
+		{"user:alice@example..com", Principal{}, false},
+		{"user:alice@-example.com", Principal{}, false},
+		{"user:alice@bob@example.com", Principal{}, false},
+		{"user:alice smith", Principal{}, false},
+		{"user:alice\n", Principal{}, false},
+		{"user:alice:admin", Principal{}, false},
+		{"user:\xff", Principal{}, false},
+		{"User:alice", Principal{}, false},
+		{"robot:r2d2", Principal{}, false},
+		{"domain:", Principal{}, false},
+		{"domain:example_com", Principal{}, false},
+		{"domain:" + strings.Repeat("a", 64) + ".com", Principal{}, false},
+		{"allusers", Principal{}, false},
+		{"user:" + strings.Repeat("a", MaxPrincipalLength), Principal{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.member, func(t *testing.T) {
+			p, err := ParseMember(tt.member)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidPrincipal)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, p)
+			assert.Equal(t, tt.member, p.String())
+		})
+	}
+}
+
+func TestParsePrincipal(t *testing.T) {
+	p, err := ParsePrincipal("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, Principal{"user", "alice@example.com"}, p)
+
+	// Members that are not principals of a caller
+	for _, member := range []string{"domain:example.com", "allUsers", "allAuthenticatedUsers"} {
+		_, err := ParsePrincipal(member)
+		assert.ErrorIs(t, err, ErrInvalidPrincipal, member)
+	}
+}
+
+// FuzzParseMember checks that parsing never panics, that valid members round-trip, and that the
+// principals of callers are the members other than domains and the special members
+func FuzzParseMember(f *testing.F) {
+	for _, seed := range []string{
+		"user:alice@example.com", "user:alice", "group:admins", "serviceAccount:sa@p.iam.example.com",
+		"domain:example.com", "allUsers", "allAuthenticatedUsers",
+		"", ":", "user:", "user:@", "user:a@b@c", "domain:-a.com", "user:\x00", "user:élève@example.fr",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		member, err := ParseMember(s)
+		principal, perr := ParsePrincipal(s)
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidPrincipal)
+			require.Error(t, perr, "a principal must be a valid member")
+			return
+		}
+
+		require.Equal(t, s, member.String(), "valid members round-trip")
+		require.LessOrEqual(t, len(s), MaxPrincipalLength)
+		require.NotContains(t, member.ID, ":")
+		reparsed, err := ParseMember(member.String())
+		require.NoError(t, err)
+		require.Equal(t, member, reparsed)
+
+		switch member.Type {
+		case PrincipalTypeUser, PrincipalTypeServiceAccount, PrincipalTypeGroup:
+			require.NoError(t, perr)
+			require.Equal(t, member, principal)
+		default:
+			require.ErrorIs(t, perr, ErrInvalidPrincipal)
+		}
+	})
+}
+
+// FuzzBindingMembers checks GetMembers and HasMember on arbitrary Members JSON: neither panics,
+// HasMember fails whenever the JSON or a member is invalid instead of granting to no one, and a
+// binding with valid members grants to each of them
+func FuzzBindingMembers(f *testing.F) {
+	f.Add([]byte(`["user:alice@example.com","group:admins"]`), "user:alice@example.com")
+	f.Add([]byte(`["domain:example.com"]`), "user:bob@EXAMPLE.com")
+	f.Add([]byte(`["allUsers"]`), "user:alice")
+	f.Add([]byte(`[]`), "group:admins")
+	f.Add([]byte(`null`), "user:alice")
+	f.Add([]byte(`invalid`), "user:alice")
+	f.Add([]byte(`[1, "user:alice"]`), "user:alice")
+	f.Add([]byte(`["user:bob smith"]`), "user:bob")
+	f.Add([]byte(`{"members": ["user:alice"]}`), "")
+
+	f.Fuzz(func(t *testing.T, members []byte, principal string) {
+		binding := &Binding{Members: members}
+
+		granted, err := binding.HasMember(principal)
+		list, jsonErr := binding.GetMembers()
+		_, principalErr := ParseMember(principal)
+		parsed, membersErr := binding.ParseMembers()
+
+		switch {
+		case principalErr != nil:
+			require.ErrorIs(t, err, ErrInvalidPrincipal)
+		case jsonErr != nil:
+			require.Error(t, err, "corrupted members must not read as no members")
+			require.Error(t, membersErr)
+		case membersErr != nil:
+			require.ErrorIs(t, err, ErrInvalidPrincipal)
+		default:
+			require.NoError(t, err)
+			require.Len(t, parsed, len(list))
+
+			expected := false
+			for _, member := range list {
+				expected = expected || MemberMatches(member, principal)
+
+				// Every valid member is granted, and through a copy of the binding that only holds it
+				ok, err := binding.HasMember(member)
+				require.NoError(t, err)
+				require.True(t, ok, member)
+				single, _ := json.Marshal([]string{member})
+				ok, err = (&Binding{Members: single}).HasMember(member)
+				require.NoError(t, err)
+				require.True(t, ok, member)
+			}
+			require.Equal(t, expected, granted)
+		}
+		if err != nil {
+			require.False(t, granted)
+		}
+	})
+}
+
+func TestMemberMatches_DomainProperty(t *testing.T) {
+	// A domain member grants to exactly the users of its domain, whatever the case
+	users := []string{"user:alice@example.com", "user:Bob@Example.COM", "user:carol@sub.example.com", "user:dave", "group:eng@example.com"}
+	for _, user := range users {
+		expected := strings.EqualFold(PrincipalDomain(user), "example.com")
+		assert.Equal(t, expected, MemberMatches("domain:example.com", user), user)
+		assert.Equal(t, expected, MemberMatches("domain:EXAMPLE.com", user), user)
+	}
+}
+
+// FuzzMemberMatches checks that the parser and the matcher agree: a member that does not parse
+// grants to no principal, and every member that parses grants to some principal, the public
+// members to all of them
+func FuzzMemberMatches(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"user:alice@example.com", "user:alice@example.com"},
+		{"group:admins", "user:alice"},
+		{"domain:Example.com", "user:bob@example.com"},
+		{"allUsers", "serviceAccount:ci@example.iam"},
+		{"allAuthenticatedUsers", "group:admins"},
+		{"allusers", "user:alice"},
+		{"domain:", "user:alice@"},
+		{"user:alice smith", "user:alice smith"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, s, principal string) {
+		if _, err := ParsePrincipal(principal); err != nil {
+			return
+		}
+		member, err := ParseMember(s)
+		if err != nil {
+			require.False(t, MemberMatches(s, principal), "invalid members grant to no one")
+			return
+		}
+
+		switch member.Type {
+		case MemberAllUsers, MemberAllAuthenticatedUsers:
+			require.True(t, MemberMatches(s, principal))
+		case PrincipalTypeDomain:
+			require.True(t, MemberMatches(s, "user:someone@"+member.ID))
+		default:
+			require.True(t, MemberMatches(s, s))
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// RecommendationAction is the change an access recommendation suggests
+type RecommendationAction string
+
+const (
+	RecommendRemoveMember RecommendationAction = "remove_member" // The member used none of the role's permissions
+	RecommendReplaceRole  RecommendationAction = "replace_role"  // A smaller existing role covers the permissions used
+	RecommendReviewRole   RecommendationAction = "review_role"   // Some permissions are unused but no smaller role fits
+)
+
+// AccessRecommendation suggests trimming a grant whose permissions went unused, based on the
+// allowed checks recorded in the decision log since ObservedSince
+type AccessRecommendation struct {
+	ID                uuid.UUID            `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Principal         string               `gorm:"type:varchar(255);not null;index" json:"principal"`
+	ResourceID        uuid.UUID            `gorm:"type:uuid;not null;index" json:"resource_id"` // Resource whose policy holds the binding
+	BindingID         uuid.UUID            `gorm:"type:uuid;not null" json:"binding_id"`
+	Role              string               `gorm:"type:varchar(255);not null" json:"role"`
+	Action            RecommendationAction `gorm:"type:varchar(20);not null" json:"action"`
+	SuggestedRole     string               `gorm:"type:varchar(255)" json:"suggested_role,omitempty"` // Set for replace_role
+	UsedPermissions   datatypes.JSON       `gorm:"type:jsonb;not null" json:"used_permissions"`       // Array of permission names
+	UnusedPermissions datatypes.JSON       `gorm:"type:jsonb;not null" json:"unused_permissions"`     // Array of permission names
+	LastUsedAt        *time.Time           `json:"last_used_at,omitempty"`
+	ObservedSince     time.Time            `gorm:"not null" json:"observed_since"`
+	CreatedAt         time.Time            `gorm:"not null" json:"created_at"`
+}
+
+// TableName specifies the table name for AccessRecommendation
+func (AccessRecommendation) TableName() string {
+	return "access_recommendations"
+}
+
+// BeforeCreate hook to generate UUID if not set
+func (r *AccessRecommendation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// GetUnusedPermissions unmarshals the UnusedPermissions JSON to a string slice
+func (r *AccessRecommendation) GetUnusedPermissions() ([]string, error) {
+	var permissions []string
+	if err := json.Unmarshal(r.UnusedPermissions, &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
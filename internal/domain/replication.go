@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotWriter is returned by writes of a deployment that does not hold the writer lock of a
+// single-writer deployment (replication.mode "single-writer")
+var ErrNotWriter = errors.New("this deployment is not the writer")
+
+// NotWriterError names the region accepting writes, so the caller can send the write there.
+// It wraps ErrNotWriter so callers can use errors.Is.
+type NotWriterError struct {
+	Region string // Region of the deployment refusing the write
+	Writer string // Region of the writer; empty while no deployment holds the writer lock
+}
+
+func (e *NotWriterError) Error() string {
+	if e.Writer == "" {
+		return fmt.Sprintf("%s: region %s does not accept writes and no writer is elected", ErrNotWriter, e.Region)
+	}
+	return fmt.Sprintf("%s: region %s does not accept writes; send them to region %s", ErrNotWriter, e.Region, e.Writer)
+}
+
+func (e *NotWriterError) Unwrap() error {
+	return ErrNotWriter
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,17 +11,22 @@ import (
 
 // Resource represents a resource in the system (hierarchical)
 type Resource struct {
-	ID         uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Type       string            `gorm:"type:varchar(100);not null;index" json:"type"` // e.g., "project", "organization", "bucket"
-	Name       string            `gorm:"type:varchar(255);not null" json:"name"`
-	ParentID   *uuid.UUID        `gorm:"type:uuid;index" json:"parent_id,omitempty"`
-	Parent     *Resource         `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
-	Children   []Resource        `gorm:"foreignKey:ParentID" json:"children,omitempty"`
-	Attributes map[string]string `gorm:"type:jsonb;serializer:json" json:"attributes"`
-	Policies   []Policy          `gorm:"foreignKey:ResourceID" json:"policies,omitempty"`
-	CreatedAt  time.Time         `gorm:"not null" json:"created_at"`
-	UpdatedAt  time.Time         `gorm:"not null" json:"updated_at"`
-	DeletedAt  gorm.DeletedAt    `gorm:"index" json:"deleted_at,omitempty"`
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Type       string         `gorm:"type:varchar(100);not null;index" json:"type"` // e.g., "project", "organization", "bucket"
+	Name       string         `gorm:"type:varchar(255);not null" json:"name"`
+	ParentID   *uuid.UUID     `gorm:"type:uuid;index" json:"parent_id,omitempty"`
+	Path       string         `gorm:"type:text;not null;default:'';index:idx_resources_path,expression:path text_pattern_ops" json:"path,omitempty"` // "/<root id>/.../<id>/", maintained by the repository
+	Parent     *Resource      `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
+	Children   []Resource     `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+	Attributes Attributes     `gorm:"type:jsonb;index:idx_resources_attributes,type:gin" json:"attributes"` // GIN index serves containment (@>) queries
+	Policies   []Policy       `gorm:"foreignKey:ResourceID" json:"policies,omitempty"`
+	Tags       []ResourceTag  `gorm:"foreignKey:ResourceID;constraint:OnDelete:CASCADE" json:"tags,omitempty"`
+	CreatedAt  time.Time      `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time      `gorm:"not null" json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedBy  string         `json:"created_by,omitempty"`         // Principal that created the resource; empty for the server
+	UpdatedBy  string         `json:"updated_by,omitempty"`         // Principal of the latest change
+	ETag       string         `gorm:"type:varchar(64)" json:"etag"` // For optimistic concurrency control
 }
 
 // TableName specifies the table name for Resource
@@ -27,20 +34,73 @@ func (Resource) TableName() string {
 	return "resources"
 }
 
-// BeforeCreate hook to generate UUID if not set
+// BeforeCreate hook to generate UUID and ETag if not set
 func (r *Resource) BeforeCreate(tx *gorm.DB) error {
 	if r.ID == uuid.Nil {
 		r.ID = uuid.New()
 	}
+	if r.ETag == "" {
+		r.ETag = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeUpdate hook to update ETag on changes; it is set as a column so that updates of
+// individual columns, such as tags or attribute patches, change it too
+func (r *Resource) BeforeUpdate(tx *gorm.DB) error {
+	tx.Statement.SetColumn("ETag", uuid.New().String())
 	return nil
 }
 
+// TagMap returns the resource's tags as key/values; it is empty, not nil, without tags
+func (r *Resource) TagMap() map[string]string {
+	tags := make(map[string]string, len(r.Tags))
+	for _, tag := range r.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+// ResourcePath returns the materialized path of a resource below a parent with the given path
+func ResourcePath(parentPath string, id uuid.UUID) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return parentPath + id.String() + "/"
+}
+
+// AncestorIDs returns the IDs in the resource's materialized path, ordered from parent to root.
+// It returns nil when the path is not set.
+func (r *Resource) AncestorIDs() ([]uuid.UUID, error) {
+	parts := strings.Split(strings.Trim(r.Path, "/"), "/")
+	if r.Path == "" || len(parts) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(parts)-1)
+	for i := len(parts) - 2; i >= 0; i-- {
+		id, err := uuid.Parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource path %q: %w", r.Path, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // GetAncestors returns all ancestors of the resource (parent, grandparent, etc.)
 func (r *Resource) GetAncestors(db *gorm.DB) ([]Resource, error) {
 	var ancestors []Resource
 	current := r
+	visited := map[uuid.UUID]bool{r.ID: true}
 
 	for current.ParentID != nil {
+		// Stop on corrupt cyclic data instead of looping forever
+		if visited[*current.ParentID] {
+			return ancestors, fmt.Errorf("resource hierarchy cycle detected at %s", *current.ParentID)
+		}
+		visited[*current.ParentID] = true
+
 		var parent Resource
 		if err := db.First(&parent, current.ParentID).Error; err != nil {
 			return ancestors, err
@@ -51,3 +111,32 @@ func (r *Resource) GetAncestors(db *gorm.DB) ([]Resource, error) {
 
 	return ancestors, nil
 }
+
+// ResourceClosure links a resource to each of its ancestors (and itself, at depth 0),
+// so a whole subtree can be read without walking the hierarchy
+type ResourceClosure struct {
+	AncestorID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"ancestor_id"`
+	DescendantID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"descendant_id"`
+	Depth        int       `gorm:"not null" json:"depth"` // Levels between ancestor and descendant
+}
+
+// TableName specifies the table name for ResourceClosure
+func (ResourceClosure) TableName() string {
+	return "resource_closure"
+}
+
+// ResourceTag is a key/value label on a resource, e.g. env=prod. Unlike attributes, tags are
+// stored in their own indexed table, so resources can be looked up by tag, and are exposed to
+// conditions as resource.tags.
+type ResourceTag struct {
+	ResourceID uuid.UUID `gorm:"type:uuid;primaryKey" json:"resource_id"`
+	Key        string    `gorm:"type:varchar(63);primaryKey;index:idx_resource_tags_key_value,priority:1" json:"key"`
+	Value      string    `gorm:"type:varchar(255);not null;default:'';index:idx_resource_tags_key_value,priority:2" json:"value"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
+}
+
+// TableName specifies the table name for ResourceTag
+func (ResourceTag) TableName() string {
+	return "resource_tags"
+}
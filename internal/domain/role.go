@@ -9,15 +9,20 @@ import (
 
 // Role represents a collection of permissions
 type Role struct {
-	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name        string         `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"` // e.g., "roles/storage.admin"
-	Title       string         `gorm:"type:varchar(255);not null" json:"title"`
-	Description string         `gorm:"type:text" json:"description"`
-	Permissions []Permission   `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
-	IsCustom    bool           `gorm:"default:false;not null" json:"is_custom"` // true for custom roles, false for predefined
-	CreatedAt   time.Time      `gorm:"not null" json:"created_at"`
-	UpdatedAt   time.Time      `gorm:"not null" json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string       `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"` // e.g., "roles/storage.admin"
+	Title       string       `gorm:"type:varchar(255);not null" json:"title"`
+	Description string       `gorm:"type:text" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+	IsCustom    bool         `gorm:"default:false;not null" json:"is_custom"` // true for custom roles, false for predefined
+	// Resource whose subtree the custom role belongs to; nil for global roles
+	ScopeResourceID *uuid.UUID     `gorm:"type:uuid;index" json:"scope_resource_id,omitempty"`
+	CreatedAt       time.Time      `gorm:"not null" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"not null" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedBy       string         `json:"created_by,omitempty"`         // Principal that created the role; empty for the server
+	UpdatedBy       string         `json:"updated_by,omitempty"`         // Principal of the latest change
+	ETag            string         `gorm:"type:varchar(64)" json:"etag"` // For optimistic concurrency control
 }
 
 // TableName specifies the table name for Role
@@ -25,11 +30,20 @@ func (Role) TableName() string {
 	return "roles"
 }
 
-// BeforeCreate hook to generate UUID if not set
+// BeforeCreate hook to generate UUID and ETag if not set
 func (r *Role) BeforeCreate(tx *gorm.DB) error {
 	if r.ID == uuid.Nil {
 		r.ID = uuid.New()
 	}
+	if r.ETag == "" {
+		r.ETag = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeUpdate hook to update ETag on changes
+func (r *Role) BeforeUpdate(tx *gorm.DB) error {
+	tx.Statement.SetColumn("ETag", uuid.New().String())
 	return nil
 }
 
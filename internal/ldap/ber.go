@@ -0,0 +1,166 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER tags used by the LDAP messages this client sends and receives (RFC 4511)
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagBoolean     = 0x01
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	tagBindRequest       = 0x60 // [APPLICATION 0] constructed
+	tagBindResponse      = 0x61 // [APPLICATION 1] constructed
+	tagUnbindRequest     = 0x42 // [APPLICATION 2] primitive
+	tagSearchRequest     = 0x63 // [APPLICATION 3] constructed
+	tagSearchResultEntry = 0x64 // [APPLICATION 4] constructed
+	tagSearchResultDone  = 0x65 // [APPLICATION 5] constructed
+	tagSearchResultRef   = 0x73 // [APPLICATION 19] constructed
+
+	tagSimpleAuth  = 0x80 // [0] primitive
+	tagFilterAnd   = 0xa0 // [0] constructed
+	tagFilterEqual = 0xa3 // [3] constructed
+)
+
+// maxElementSize bounds a single response element so a misbehaving server cannot exhaust memory
+const maxElementSize = 16 << 20
+
+var errMalformed = errors.New("malformed BER element")
+
+// element is a decoded BER tag-length-value
+type element struct {
+	tag     byte
+	content []byte
+}
+
+// encode returns the BER encoding of a tag and its content
+func encode(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := append([]byte{tag}, encodeLength(n)...)
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var digits []byte
+	for v := n; v > 0; v >>= 8 {
+		digits = append([]byte{byte(v)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+func encodeInt(tag byte, v int) []byte {
+	// Minimal two's complement encoding of a non-negative value
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return encode(tag, content)
+}
+
+func encodeString(tag byte, s string) []byte {
+	return encode(tag, []byte(s))
+}
+
+// readElement reads one BER element from r
+func readElement(r *bufio.Reader) (element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+
+	length := int(first)
+	if first&0x80 != 0 {
+		digits := int(first &^ 0x80)
+		if digits == 0 || digits > 4 {
+			return element{}, errMalformed
+		}
+		length = 0
+		for i := 0; i < digits; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return element{}, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxElementSize {
+		return element{}, fmt.Errorf("BER element of %d bytes exceeds limit", length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return element{}, err
+	}
+	return element{tag: tag, content: content}, nil
+}
+
+// children decodes the elements nested in a constructed element
+func (e element) children() ([]element, error) {
+	var elements []element
+	data := e.content
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errMalformed
+		}
+		tag, first := data[0], data[1]
+		data = data[2:]
+
+		length := int(first)
+		if first&0x80 != 0 {
+			digits := int(first &^ 0x80)
+			if digits == 0 || digits > 4 || len(data) < digits {
+				return nil, errMalformed
+			}
+			length = 0
+			for _, b := range data[:digits] {
+				length = length<<8 | int(b)
+			}
+			data = data[digits:]
+		}
+		if length > len(data) {
+			return nil, errMalformed
+		}
+		elements = append(elements, element{tag: tag, content: data[:length]})
+		data = data[length:]
+	}
+	return elements, nil
+}
+
+// int decodes an INTEGER or ENUMERATED element
+func (e element) int() (int, error) {
+	if len(e.content) == 0 || len(e.content) > 4 {
+		return 0, errMalformed
+	}
+	v := int(int8(e.content[0]))
+	for _, b := range e.content[1:] {
+		v = v<<8 | int(b)
+	}
+	return v, nil
+}
@@ -0,0 +1,283 @@
+// Package ldap implements the small subset of LDAPv3 (RFC 4511) needed to resolve a user's
+// groups from an LDAP or Active Directory server: simple bind and equality searches.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// resultSuccess is the LDAPResult code of a successful operation
+const resultSuccess = 0
+
+// Entry is a search result
+type Entry struct {
+	DN         string
+	Attributes map[string][]string // Keyed by the attribute name as returned by the server
+}
+
+// Get returns the values of an attribute, matching its name case-insensitively
+func (e *Entry) Get(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// ResultError is a non-success LDAPResult returned by the server
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap result code %d: %s", e.Code, e.Message)
+}
+
+// Conn is a connection to an LDAP server. It is not safe for concurrent use.
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int
+}
+
+// Dial connects to an ldap:// or ldaps:// URL. ctx bounds the whole lifetime of the
+// connection: its deadline applies to every later request.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %w", err)
+	}
+
+	host := u.Host
+	var dialer net.Dialer
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: config}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return &Conn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Close sends an unbind request and closes the connection
+func (c *Conn) Close() error {
+	c.send(encode(tagUnbindRequest))
+	return c.conn.Close()
+}
+
+// Bind authenticates with a DN and password
+func (c *Conn) Bind(dn, password string) error {
+	id, err := c.send(encode(tagBindRequest,
+		encodeInt(tagInteger, 3),
+		encodeString(tagOctetString, dn),
+		encodeString(tagSimpleAuth, password),
+	))
+	if err != nil {
+		return err
+	}
+
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != tagBindResponse {
+		return fmt.Errorf("unexpected ldap response tag 0x%x to bind", op.tag)
+	}
+	return result(op)
+}
+
+// Search returns the entries below baseDN whose attributes equal the given values.
+// Only the requested attributes are returned.
+func (c *Conn) Search(baseDN string, equal map[string]string, attributes []string) ([]Entry, error) {
+	var filters [][]byte
+	for attribute, value := range equal {
+		filters = append(filters, encode(tagFilterEqual,
+			encodeString(tagOctetString, attribute),
+			encodeString(tagOctetString, value),
+		))
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("search requires at least one filter")
+	}
+	filter := filters[0]
+	if len(filters) > 1 {
+		filter = encode(tagFilterAnd, filters...)
+	}
+
+	var attributeList [][]byte
+	for _, attribute := range attributes {
+		attributeList = append(attributeList, encodeString(tagOctetString, attribute))
+	}
+
+	id, err := c.send(encode(tagSearchRequest,
+		encodeString(tagOctetString, baseDN),
+		encodeInt(tagEnumerated, 2), // wholeSubtree
+		encodeInt(tagEnumerated, 0), // neverDerefAliases
+		encodeInt(tagInteger, 0),    // no size limit
+		encodeInt(tagInteger, 0),    // no time limit
+		encode(tagBoolean, []byte{0}),
+		filter,
+		encode(tagSequence, attributeList...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case tagSearchResultEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case tagSearchResultRef:
+			// Referrals to other servers are not followed
+		case tagSearchResultDone:
+			return entries, result(op)
+		default:
+			return nil, fmt.Errorf("unexpected ldap response tag 0x%x to search", op.tag)
+		}
+	}
+}
+
+// send writes an LDAPMessage wrapping op and returns its message ID
+func (c *Conn) send(op []byte) (int, error) {
+	c.messageID++
+	message := encode(tagSequence, encodeInt(tagInteger, c.messageID), op)
+	if _, err := c.conn.Write(message); err != nil {
+		return 0, fmt.Errorf("failed to send ldap request: %w", err)
+	}
+	return c.messageID, nil
+}
+
+// receive reads the next LDAPMessage, which must answer message id, and returns its protocol op
+func (c *Conn) receive(id int) (element, error) {
+	message, err := readElement(c.reader)
+	if err != nil {
+		return element{}, fmt.Errorf("failed to read ldap response: %w", err)
+	}
+	if message.tag != tagSequence {
+		return element{}, errMalformed
+	}
+	parts, err := message.children()
+	if err != nil || len(parts) < 2 {
+		return element{}, errMalformed
+	}
+	got, err := parts[0].int()
+	if err != nil {
+		return element{}, err
+	}
+	if got != id {
+		return element{}, fmt.Errorf("unexpected ldap message id %d, expected %d", got, id)
+	}
+	return parts[1], nil
+}
+
+// result converts the LDAPResult in a response op to an error
+func result(op element) error {
+	parts, err := op.children()
+	if err != nil || len(parts) < 3 {
+		return errMalformed
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: string(parts[2].content)}
+	}
+	return nil
+}
+
+// parseEntry decodes a SearchResultEntry
+func parseEntry(op element) (Entry, error) {
+	parts, err := op.children()
+	if err != nil || len(parts) != 2 {
+		return Entry{}, errMalformed
+	}
+	entry := Entry{DN: string(parts[0].content), Attributes: make(map[string][]string)}
+
+	attributes, err := parts[1].children()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, attribute := range attributes {
+		fields, err := attribute.children()
+		if err != nil || len(fields) != 2 {
+			return Entry{}, errMalformed
+		}
+		values, err := fields[1].children()
+		if err != nil {
+			return Entry{}, err
+		}
+		name := string(fields[0].content)
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], string(value.content))
+		}
+	}
+	return entry, nil
+}
+
+// FirstRDNValue returns the value of the first relative distinguished name of dn,
+// e.g. "Engineering" for "CN=Engineering,OU=Groups,DC=example,DC=com"
+func FirstRDNValue(dn string) string {
+	var value strings.Builder
+	inValue := false
+	for i := 0; i < len(dn); i++ {
+		switch c := dn[i]; {
+		case c == '\\' && i+1 < len(dn):
+			i++
+			if inValue {
+				value.WriteByte(dn[i])
+			}
+		case c == ',' || c == '+':
+			return strings.TrimSpace(value.String())
+		case c == '=' && !inValue:
+			inValue = true
+		case inValue:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
@@ -0,0 +1,102 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// userPrincipalPrefix is the prefix of the principals whose groups are looked up
+const userPrincipalPrefix = "user:"
+
+// Resolver resolves the groups of user principals from an LDAP or Active Directory server.
+// A user "user:<id>" is looked up by UserAttribute = <id>; each DN in its GroupAttribute
+// (memberOf by default) becomes the principal "group:<first RDN value><GroupSuffix>".
+type Resolver struct {
+	cfg     config.LDAPConfig
+	timeout time.Duration
+	tls     *tls.Config
+}
+
+// NewResolver creates an LDAP group resolver
+func NewResolver(cfg *config.LDAPConfig) (*Resolver, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("ldap.url is required")
+	}
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap.base_dn is required")
+	}
+
+	resolved := *cfg
+	if resolved.UserAttribute == "" {
+		resolved.UserAttribute = "mail"
+	}
+	if resolved.GroupAttribute == "" {
+		resolved.GroupAttribute = "memberOf"
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	return &Resolver{
+		cfg:     resolved,
+		timeout: timeout,
+		tls:     &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+	}, nil
+}
+
+// GroupsOf returns the group principals of a user principal. Other principal types and
+// users missing from the directory have no groups. Every lookup opens a new connection
+// and is bounded by the configured timeout.
+func (r *Resolver) GroupsOf(principal string) ([]string, error) {
+	identifier, ok := strings.CutPrefix(principal, userPrincipalPrefix)
+	if !ok || identifier == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	conn, err := Dial(ctx, r.cfg.URL, r.tls)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if r.cfg.BindDN != "" {
+		if err := conn.Bind(r.cfg.BindDN, r.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind to ldap server: %w", err)
+		}
+	}
+
+	filter := map[string]string{r.cfg.UserAttribute: identifier}
+	if r.cfg.UserObjectClass != "" {
+		filter["objectClass"] = r.cfg.UserObjectClass
+	}
+	entries, err := conn.Search(r.cfg.BaseDN, filter, []string{r.cfg.GroupAttribute})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search ldap directory: %w", err)
+	}
+
+	var groups []string
+	seen := make(map[string]bool)
+	for i := range entries {
+		for _, dn := range entries[i].Get(r.cfg.GroupAttribute) {
+			name := FirstRDNValue(dn)
+			if name == "" {
+				continue
+			}
+			group := "group:" + name + r.cfg.GroupSuffix
+			if !seen[group] {
+				seen[group] = true
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups, nil
+}
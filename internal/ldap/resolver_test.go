@@ -0,0 +1,199 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer answers bind and search requests over a real TCP connection
+type fakeServer struct {
+	listener net.Listener
+	password string
+	groups   map[string][]string // mail -> memberOf DNs
+	delay    time.Duration
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeServer{listener: listener, groups: make(map[string][]string)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		message, err := readElement(reader)
+		if err != nil {
+			return
+		}
+		parts, _ := message.children()
+		id, _ := parts[0].int()
+		op := parts[1]
+		fields, _ := op.children()
+
+		reply := func(ops ...[]byte) {
+			for _, op := range ops {
+				conn.Write(encode(tagSequence, encodeInt(tagInteger, id), op))
+			}
+		}
+		ldapResult := func(tag byte, code int, message string) []byte {
+			return encode(tag, encodeInt(tagEnumerated, code), encodeString(tagOctetString, ""), encodeString(tagOctetString, message))
+		}
+
+		switch op.tag {
+		case tagUnbindRequest:
+			return
+		case tagBindRequest:
+			if string(fields[2].content) != s.password {
+				reply(ldapResult(tagBindResponse, 49, "invalid credentials"))
+				continue
+			}
+			reply(ldapResult(tagBindResponse, resultSuccess, ""))
+		case tagSearchRequest:
+			time.Sleep(s.delay)
+
+			// The filter is either a single equality match or an AND of them
+			filter := fields[6]
+			equalities := []element{filter}
+			if filter.tag == tagFilterAnd {
+				equalities, _ = filter.children()
+			}
+			var mail string
+			for _, equality := range equalities {
+				pair, _ := equality.children()
+				if string(pair[0].content) == "mail" {
+					mail = string(pair[1].content)
+				}
+			}
+
+			dns, ok := s.groups[mail]
+			if ok {
+				var values [][]byte
+				for _, dn := range dns {
+					values = append(values, encodeString(tagOctetString, dn))
+				}
+				reply(encode(tagSearchResultEntry,
+					encodeString(tagOctetString, "CN="+mail+",DC=example,DC=com"),
+					encode(tagSequence, encode(tagSequence,
+						encodeString(tagOctetString, "memberOf"),
+						encode(tagSet, values...),
+					)),
+				))
+			}
+			reply(ldapResult(tagSearchResultDone, resultSuccess, ""))
+		}
+	}
+}
+
+func TestResolver_GroupsOf(t *testing.T) {
+	server := newFakeServer(t)
+	server.password = "secret"
+	server.groups["alice@example.com"] = []string{
+		"CN=Engineering,OU=Groups,DC=example,DC=com",
+		"CN=On\\,Call,OU=Groups,DC=example,DC=com",
+		"CN=Engineering,OU=Legacy,DC=example,DC=com",
+	}
+
+	resolver, err := NewResolver(&config.LDAPConfig{
+		URL:             server.url(),
+		BindDN:          "CN=iam,DC=example,DC=com",
+		BindPassword:    "secret",
+		BaseDN:          "DC=example,DC=com",
+		UserObjectClass: "person",
+		GroupSuffix:     "@example.com",
+	})
+	require.NoError(t, err)
+
+	groups, err := resolver.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group:Engineering@example.com", "group:On,Call@example.com"}, groups)
+
+	groups, err = resolver.GroupsOf("user:bob@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	// Only users are looked up
+	groups, err = resolver.GroupsOf("serviceAccount:ci@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestResolver_BindFailure(t *testing.T) {
+	server := newFakeServer(t)
+	server.password = "secret"
+
+	resolver, err := NewResolver(&config.LDAPConfig{
+		URL:          server.url(),
+		BindDN:       "CN=iam,DC=example,DC=com",
+		BindPassword: "wrong",
+		BaseDN:       "DC=example,DC=com",
+	})
+	require.NoError(t, err)
+
+	_, err = resolver.GroupsOf("user:alice@example.com")
+	var resultErr *ResultError
+	require.ErrorAs(t, err, &resultErr)
+	assert.Equal(t, 49, resultErr.Code)
+}
+
+func TestResolver_Timeout(t *testing.T) {
+	server := newFakeServer(t)
+	server.delay = 2 * time.Second
+
+	resolver, err := NewResolver(&config.LDAPConfig{URL: server.url(), BaseDN: "DC=example,DC=com", TimeoutSeconds: 1})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = resolver.GroupsOf("user:alice@example.com")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNewResolver_Validation(t *testing.T) {
+	_, err := NewResolver(&config.LDAPConfig{BaseDN: "DC=example,DC=com"})
+	assert.ErrorContains(t, err, "ldap.url")
+
+	_, err = NewResolver(&config.LDAPConfig{URL: "ldap://localhost"})
+	assert.ErrorContains(t, err, "ldap.base_dn")
+}
+
+func TestFirstRDNValue(t *testing.T) {
+	assert.Equal(t, "Engineering", FirstRDNValue("CN=Engineering,OU=Groups,DC=example,DC=com"))
+	assert.Equal(t, "Sales, EMEA", FirstRDNValue(`cn=Sales\, EMEA,ou=groups`))
+	assert.Equal(t, "admins", FirstRDNValue("cn=admins"))
+	assert.Empty(t, FirstRDNValue(""))
+}
+
+func TestEncodeLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 255, 256, 70000} {
+		data := encode(tagOctetString, make([]byte, n))
+		e, err := readElement(bufio.NewReader(bytes.NewReader(data)))
+		require.NoError(t, err)
+		assert.Len(t, e.content, n)
+	}
+}
@@ -0,0 +1,83 @@
+// Package logging builds the service's structured logger and carries
+// per-request fields through a context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// Log output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type loggerKey struct{}
+
+// New creates a logger writing to w with the configured level and format
+func New(cfg *config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	logger, _, err := NewLeveled(cfg, w)
+	return logger, err
+}
+
+// NewLeveled is like New and also returns the logger's level, which can be changed at runtime
+func NewLeveled(cfg *config.LogConfig, w io.Writer) (*slog.Logger, *slog.LevelVar, error) {
+	parsed, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	level := new(slog.LevelVar)
+	level.Set(parsed)
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), level, nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), level, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported log format %q (must be %q or %q)", cfg.Format, FormatJSON, FormatText)
+	}
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error" (case-insensitive; empty means info)
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unsupported log level %q", level)
+	}
+}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithFields returns a context whose logger adds the given key/value pairs to every record,
+// e.g. WithFields(ctx, "method", info.FullMethod, "principal", caller) in a request interceptor
+func WithFields(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
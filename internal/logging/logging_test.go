@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&config.LogConfig{Level: "warn", Format: "json"}, &buf)
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	logger.Warn("kept", "principal", "user:alice@example.com")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "user:alice@example.com", record["principal"])
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&config.LogConfig{Level: "debug", Format: "text"}, &buf)
+	require.NoError(t, err)
+
+	logger.Debug("hello", "key", "value")
+	assert.Contains(t, buf.String(), "level=DEBUG")
+	assert.Contains(t, buf.String(), "key=value")
+}
+
+func TestNewLeveled_ChangeLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, level, err := NewLeveled(&config.LogConfig{Level: "info", Format: "text"}, &buf)
+	require.NoError(t, err)
+
+	logger.Debug("dropped")
+	assert.Empty(t, buf.String())
+
+	level.Set(slog.LevelDebug)
+	logger.Debug("kept")
+	assert.Contains(t, buf.String(), "msg=kept")
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(&config.LogConfig{Level: "verbose"}, &bytes.Buffer{})
+	assert.Error(t, err)
+
+	_, err = New(&config.LogConfig{Format: "xml"}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"DEBUG": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		level, err := ParseLevel(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, level, input)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&config.LogConfig{}, &buf)
+	require.NoError(t, err)
+
+	ctx := WithLogger(context.Background(), logger)
+	ctx = WithFields(ctx, "method", "/iam.v1.IAMService/CheckPermission")
+	FromContext(ctx).Info("request handled")
+
+	assert.Contains(t, buf.String(), `"method":"/iam.v1.IAMService/CheckPermission"`)
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+}
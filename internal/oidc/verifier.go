@@ -0,0 +1,371 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256, PS256 and ES256
+	_ "crypto/sha512" // SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// maxResponseSize bounds discovery and JWKS responses
+const maxResponseSize = 1 << 20
+
+// minKeyRefreshInterval limits how often a token signed with an unknown key triggers a JWKS
+// refresh, so forged key IDs cannot make the verifier hammer the identity provider
+const minKeyRefreshInterval = 10 * time.Second
+
+// Verifier verifies OpenID Connect ID tokens signed by an identity provider and maps their
+// claims to principals. Signing keys are fetched from the provider's JWKS endpoint and cached.
+type Verifier struct {
+	cfg     config.OIDCConfig
+	skew    time.Duration
+	keysTTL time.Duration
+	http    *http.Client
+	now     func() time.Time
+
+	mu          sync.Mutex
+	jwksURL     string
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time // Last refresh, successful or not
+	refreshErr  error     // Error of the last refresh
+}
+
+// Identity is the principal an ID token was issued to
+type Identity struct {
+	Principal string   // "user:<claim>" or "serviceAccount:<claim>"
+	Groups    []string // "group:<name>" principals of the groups claim
+	Expiry    time.Time
+}
+
+// NewVerifier creates an ID token verifier. Keys are discovered on the first verification.
+func NewVerifier(cfg *config.OIDCConfig) (*Verifier, error) {
+	if cfg.IssuerURL == "" {
+		return nil, fmt.Errorf("oidc.issuer_url is required")
+	}
+	if len(cfg.Audiences) == 0 {
+		return nil, fmt.Errorf("oidc.audiences is required")
+	}
+
+	resolved := *cfg
+	if resolved.PrincipalClaim == "" {
+		resolved.PrincipalClaim = "email"
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	keysTTL := time.Duration(cfg.JWKSCacheSeconds) * time.Second
+	if keysTTL <= 0 {
+		keysTTL = time.Hour
+	}
+
+	return &Verifier{
+		cfg:     resolved,
+		skew:    time.Duration(cfg.ClockSkewSeconds) * time.Second,
+		keysTTL: keysTTL,
+		http:    &http.Client{Timeout: timeout},
+		now:     time.Now,
+		jwksURL: cfg.JWKSURL,
+	}, nil
+}
+
+// VerifyPrincipal verifies an ID token and returns the principal it was issued to, the groups
+// it asserts and when it expires
+func (v *Verifier) VerifyPrincipal(token string) (string, []string, time.Time, error) {
+	identity, err := v.Verify(context.Background(), token)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return identity.Principal, identity.Groups, identity.Expiry, nil
+}
+
+// Verify checks the token's signature, issuer, audience and validity period and maps its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return v.identity(claims)
+}
+
+// identity validates the claims of a token with a valid signature and maps them to an identity
+func (v *Verifier) identity(claims map[string]interface{}) (*Identity, error) {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.IssuerURL {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !v.audienceAccepted(claims["aud"]) {
+		return nil, fmt.Errorf("token audience not accepted")
+	}
+
+	now := v.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if now.After(exp.Add(v.skew)) {
+		return nil, fmt.Errorf("token expired at %s", exp.Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.skew).Before(nbf) {
+		return nil, fmt.Errorf("token not valid before %s", nbf.Format(time.RFC3339))
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified && v.cfg.PrincipalClaim == "email" {
+		return nil, fmt.Errorf("token email is not verified")
+	}
+
+	subject, _ := claims[v.cfg.PrincipalClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %s claim", v.cfg.PrincipalClaim)
+	}
+	identity := &Identity{Principal: "user:" + subject, Groups: []string{}, Expiry: exp}
+	for _, suffix := range v.cfg.ServiceAccountSuffixes {
+		if suffix != "" && strings.HasSuffix(subject, suffix) {
+			identity.Principal = "serviceAccount:" + subject
+			break
+		}
+	}
+
+	if v.cfg.GroupsClaim != "" {
+		for _, group := range stringList(claims[v.cfg.GroupsClaim]) {
+			if !strings.HasPrefix(group, "group:") {
+				group = "group:" + group + v.cfg.GroupSuffix
+			}
+			identity.Groups = append(identity.Groups, group)
+		}
+	}
+	return identity, nil
+}
+
+// audienceAccepted reports whether the aud claim, a string or a list, holds an accepted audience
+func (v *Verifier) audienceAccepted(aud interface{}) bool {
+	for _, audience := range stringList(aud) {
+		for _, accepted := range v.cfg.Audiences {
+			if audience == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the signing key with the given ID, refreshing the key set, at most once per
+// minKeyRefreshInterval, when it is stale or does not contain the key
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	stale := v.keys == nil || now.Sub(v.fetchedAt) > v.keysTTL
+	if key, ok := v.lookup(kid); ok && !stale {
+		return key, nil
+	}
+	if now.Sub(v.attemptedAt) >= minKeyRefreshInterval {
+		v.attemptedAt = now
+		v.refreshErr = v.refreshKeys(ctx)
+	}
+	// Previous keys keep verifying while the provider is unreachable
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	if v.refreshErr != nil {
+		return nil, v.refreshErr
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID; a token without key ID matches the only key of a single-key set
+func (v *Verifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// refreshKeys fetches the key set, discovering its URL from the issuer on first use
+func (v *Verifier) refreshKeys(ctx context.Context) error {
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimRight(v.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, url, &discovery); err != nil {
+			return fmt.Errorf("failed to discover oidc provider: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return fmt.Errorf("oidc provider metadata has no jwks_uri")
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	data, err := v.get(ctx, v.jwksURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return err
+	}
+	v.keys = keys
+	v.fetchedAt = v.now()
+	return nil
+}
+
+func (v *Verifier) getJSON(ctx context.Context, url string, result interface{}) error {
+	data, err := v.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (v *Verifier) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// signingHashes maps the accepted JWS algorithms to their hash. Only asymmetric algorithms are
+// accepted: "none" and HMAC would let anyone who knows the public key forge tokens.
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// ecCurveBits is the curve size each ECDSA algorithm requires
+var ecCurveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+// errInvalidSignature is returned for signatures that do not verify
+var errInvalidSignature = errors.New("invalid token signature")
+
+// verifySignature checks the JWS signature of signed
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	hashID, ok := signingHashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hashID.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("signing key is not an rsa key")
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(rsaKey, hashID, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hashID, digest, signature, nil)
+		}
+		if err != nil {
+			return errInvalidSignature
+		}
+	default:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve.Params().BitSize != ecCurveBits[alg] {
+			return fmt.Errorf("signing key does not match algorithm %s", alg)
+		}
+		size := (ecCurveBits[alg] + 7) / 8
+		if len(signature) != 2*size {
+			return errInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errInvalidSignature
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate decodes a JWT NumericDate (seconds since the epoch)
+func numericDate(v interface{}) (time.Time, bool) {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// stringList decodes a claim holding a string or a list of strings
+func stringList(v interface{}) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
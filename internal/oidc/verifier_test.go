@@ -0,0 +1,263 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider is an identity provider serving discovery metadata and a JWK Set
+type testProvider struct {
+	server    *httptest.Server
+	rsaKey    *rsa.PrivateKey
+	ecKey     *ecdsa.PrivateKey
+	jwksCalls atomic.Int32
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p := &testProvider{rsaKey: rsaKey, ecKey: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.server.URL, "jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksCalls.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa-1", "use": "sig",
+				"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec-1", "crv": "P-256",
+				"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+			{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))},
+		}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) verifier(t *testing.T) *Verifier {
+	v, err := NewVerifier(&config.OIDCConfig{
+		IssuerURL:              p.server.URL,
+		Audiences:              []string{"my-app"},
+		PrincipalClaim:         "email",
+		ServiceAccountSuffixes: []string{".iam.example.com"},
+		GroupsClaim:            "groups",
+		GroupSuffix:            "@example.com",
+		ClockSkewSeconds:       60,
+	})
+	require.NoError(t, err)
+	return v
+}
+
+// claims returns valid claims for alice
+func (p *testProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            p.server.URL,
+		"aud":            "my-app",
+		"sub":            "1234",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         []string{"eng", "group:ops@example.com"},
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (p *testProvider) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, p.rsaKey, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	require.NoError(t, err)
+	return signed + "." + b64(signature)
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier(t)
+
+	for _, tc := range []struct{ alg, kid string }{{"RS256", "rsa-1"}, {"PS256", "rsa-1"}, {"ES256", "ec-1"}} {
+		t.Run(tc.alg, func(t *testing.T) {
+			identity, err := v.Verify(t.Context(), p.sign(t, tc.alg, tc.kid, p.claims()))
+			require.NoError(t, err)
+			assert.Equal(t, "user:alice@example.com", identity.Principal)
+			assert.Equal(t, []string{"group:eng@example.com", "group:ops@example.com"}, identity.Groups)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), identity.Expiry, time.Minute)
+		})
+	}
+
+	// Keys are fetched once and cached
+	assert.Equal(t, int32(1), p.jwksCalls.Load())
+}
+
+func TestVerifier_ServiceAccount(t *testing.T) {
+	p := newTestProvider(t)
+	claims := p.claims()
+	claims["email"] = "ci@project.iam.example.com"
+	delete(claims, "groups")
+
+	principal, groups, _, err := p.verifier(t).VerifyPrincipal(p.sign(t, "RS256", "rsa-1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, "serviceAccount:ci@project.iam.example.com", principal)
+	assert.Empty(t, groups)
+}
+
+func TestVerifier_Rejects(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier(t)
+
+	tests := []struct {
+		name   string
+		token  func() string
+		errMsg string
+	}{
+		{"malformed", func() string { return "not-a-jwt" }, "malformed token"},
+		{"wrong issuer", func() string {
+			claims := p.claims()
+			claims["iss"] = "https://evil.example.com"
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "unexpected issuer"},
+		{"wrong audience", func() string {
+			claims := p.claims()
+			claims["aud"] = []string{"other-app"}
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "audience"},
+		{"expired", func() string {
+			claims := p.claims()
+			claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "token expired"},
+		{"not yet valid", func() string {
+			claims := p.claims()
+			claims["nbf"] = time.Now().Add(10 * time.Minute).Unix()
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "not valid before"},
+		{"unverified email", func() string {
+			claims := p.claims()
+			claims["email_verified"] = false
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "not verified"},
+		{"missing principal claim", func() string {
+			claims := p.claims()
+			delete(claims, "email")
+			return p.sign(t, "RS256", "rsa-1", claims)
+		}, "no email claim"},
+		{"tampered claims", func() string {
+			token := p.sign(t, "RS256", "rsa-1", p.claims())
+			parts := strings.Split(token, ".")
+			claims := p.claims()
+			claims["email"] = "mallory@example.com"
+			payload, _ := json.Marshal(claims)
+			return parts[0] + "." + b64(payload) + "." + parts[2]
+		}, "invalid token signature"},
+		{"alg none", func() string {
+			header, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa-1"})
+			payload, _ := json.Marshal(p.claims())
+			return b64(header) + "." + b64(payload) + "."
+		}, "unsupported signing algorithm"},
+		{"key of another algorithm", func() string {
+			token := p.sign(t, "ES256", "ec-1", p.claims())
+			parts := strings.Split(token, ".")
+			header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "rsa-1"})
+			return b64(header) + "." + parts[1] + "." + parts[2]
+		}, "does not match algorithm"},
+		{"unknown key", func() string { return p.sign(t, "RS256", "rsa-2", p.claims()) }, "unknown signing key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(t.Context(), tt.token())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestVerifier_KeyRefresh(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier(t)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	_, err := v.Verify(t.Context(), p.sign(t, "RS256", "rsa-1", p.claims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), p.jwksCalls.Load())
+
+	// Unknown keys refresh the set at most once per minKeyRefreshInterval
+	for i := 0; i < 3; i++ {
+		_, err = v.Verify(t.Context(), p.sign(t, "RS256", "rotated", p.claims()))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(1), p.jwksCalls.Load())
+
+	now = now.Add(minKeyRefreshInterval)
+	_, err = v.Verify(t.Context(), p.sign(t, "RS256", "rotated", p.claims()))
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), p.jwksCalls.Load())
+
+	// Known keys keep verifying while the provider is down
+	p.server.Close()
+	now = now.Add(2 * time.Hour)
+	claims := p.claims()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	_, err = v.Verify(t.Context(), p.sign(t, "RS256", "rsa-1", claims))
+	assert.NoError(t, err)
+}
+
+func TestNewVerifier_Validation(t *testing.T) {
+	_, err := NewVerifier(&config.OIDCConfig{Audiences: []string{"app"}})
+	assert.EqualError(t, err, "oidc.issuer_url is required")
+
+	_, err = NewVerifier(&config.OIDCConfig{IssuerURL: "https://accounts.example.com"})
+	assert.EqualError(t, err, "oidc.audiences is required")
+}
+
+func TestParseKeySet_RejectsWeakKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "weak", "n": b64(weak.N.Bytes()), "e": "AQAB"},
+	}})
+	_, err = parseKeySet(data)
+	assert.ErrorContains(t, err, "at least 2048 bits")
+}
@@ -0,0 +1,140 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// ErrUndefined is returned by Evaluate when the queried document is undefined for the input
+var ErrUndefined = errors.New("opa: document is undefined")
+
+// maxResponseSize bounds a response body so a misbehaving server cannot exhaust memory
+const maxResponseSize = 16 << 20
+
+// Client talks to the REST API of an Open Policy Agent server, typically a sidecar
+// (https://www.openpolicyagent.org/docs/latest/rest-api/)
+type Client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// NewClient creates an OPA client
+func NewClient(cfg *config.OPAConfig) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("evaluator.opa.url is required")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid evaluator.opa.url: %w", err)
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	return &Client{
+		url:   strings.TrimRight(cfg.URL, "/"),
+		token: cfg.Token,
+		http:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// PutPolicy creates or replaces the Rego module stored under id
+func (c *Client) PutPolicy(ctx context.Context, id, module string) error {
+	req, err := c.newRequest(ctx, http.MethodPut, "/v1/policies/"+url.PathEscape(id), strings.NewReader(module))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	if _, err := c.do(req); err != nil {
+		return fmt.Errorf("failed to upload policy %s: %w", id, err)
+	}
+	return nil
+}
+
+// Evaluate queries the document at path, e.g. "iam/authz/decision", with input and decodes it
+// into result. It returns ErrUndefined when the document is undefined.
+func (c *Client) Evaluate(ctx context.Context, path string, input, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/data/"+strings.Trim(path, "/"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	data, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate %s: %w", path, err)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("failed to decode opa response: %w", err)
+	}
+	if len(response.Result) == 0 {
+		return ErrUndefined
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends req and returns the response body, turning OPA error responses into errors
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var opaErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Errors  []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(data, &opaErr) == nil && opaErr.Message != "" {
+			msg := opaErr.Message
+			for _, detail := range opaErr.Errors {
+				msg += "; " + detail.Message
+			}
+			return nil, fmt.Errorf("opa returned %s (%s): %s", resp.Status, opaErr.Code, msg)
+		}
+		return nil, fmt.Errorf("opa returned %s", resp.Status)
+	}
+	return data, nil
+}
@@ -0,0 +1,96 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer serves the policy and data APIs of OPA
+type fakeServer struct {
+	*httptest.Server
+	policies map[string]string
+	auth     []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{policies: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/policies/iam-authz":
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": "invalid_parameter", "message": "error(s) occurred while compiling module(s)",
+				"errors": [{"message": "rego_parse_error: unexpected eof token"}]}`))
+			return
+		}
+		s.policies["iam-authz"] = string(body)
+		w.Write([]byte(`{}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/iam/authz/decision":
+		var request struct {
+			Input struct {
+				Permission string `json:"permission"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"allow": request.Input.Permission == "storage.objects.read"},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/iam/authz/missing":
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestClient_PutPolicy(t *testing.T) {
+	server := newFakeServer(t)
+	client, err := NewClient(&config.OPAConfig{URL: server.URL + "/", Token: "secret"})
+	require.NoError(t, err)
+
+	require.NoError(t, client.PutPolicy(context.Background(), "iam-authz", "package iam.authz"))
+	assert.Equal(t, "package iam.authz", server.policies["iam-authz"])
+	assert.Equal(t, []string{"Bearer secret"}, server.auth)
+
+	err = client.PutPolicy(context.Background(), "iam-authz", "invalid")
+	assert.ErrorContains(t, err, "rego_parse_error: unexpected eof token")
+}
+
+func TestClient_Evaluate(t *testing.T) {
+	server := newFakeServer(t)
+	client, err := NewClient(&config.OPAConfig{URL: server.URL})
+	require.NoError(t, err)
+
+	var decision struct {
+		Allow bool `json:"allow"`
+	}
+	require.NoError(t, client.Evaluate(context.Background(), "iam/authz/decision",
+		map[string]string{"permission": "storage.objects.read"}, &decision))
+	assert.True(t, decision.Allow)
+	assert.Equal(t, []string{""}, server.auth)
+
+	err = client.Evaluate(context.Background(), "iam/authz/missing", nil, &decision)
+	assert.ErrorIs(t, err, ErrUndefined)
+
+	err = client.Evaluate(context.Background(), "iam/other", nil, &decision)
+	assert.ErrorContains(t, err, "500 Internal Server Error")
+}
+
+func TestNewClient_RequiresURL(t *testing.T) {
+	_, err := NewClient(&config.OPAConfig{})
+	assert.ErrorContains(t, err, "evaluator.opa.url is required")
+}
@@ -0,0 +1,460 @@
+// Package openapi generates an OpenAPI v3 document of the IAM API from its protobuf definition, so
+// client teams can generate SDKs in languages without a gRPC toolchain.
+//
+// The document describes the gRPC-JSON mapping of every RPC, POST /<package>.<service>/<method>
+// with the request message as body, as served by a transcoding proxy in front of the gRPC server
+// such as Envoy's grpc_json_transcoder. Messages follow the proto3 JSON mapping: fields are named
+// in lowerCamelCase, 64-bit integers are strings and timestamps RFC 3339 strings.
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lines of the protobuf subset the API is written in
+var (
+	packagePattern = regexp.MustCompile(`^package\s+([\w.]+)\s*;$`)
+	messagePattern = regexp.MustCompile(`^message\s+(\w+)\s*\{(\s*\})?$`)
+	servicePattern = regexp.MustCompile(`^service\s+(\w+)\s*\{$`)
+	oneofPattern   = regexp.MustCompile(`^oneof\s+(\w+)\s*\{$`)
+	rpcPattern     = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*;$`)
+	fieldPattern   = regexp.MustCompile(`^(repeated\s+)?(map\s*<\s*(\w+)\s*,\s*([\w.]+)\s*>|[\w.]+)\s+(\w+)\s*=\s*\d+\s*(\[[^\]]*\])?\s*;$`)
+	ignoredPattern = regexp.MustCompile(`^(syntax|option|import|reserved)\b.*;$`)
+)
+
+// file is a parsed protobuf file
+type file struct {
+	pkg      string
+	services []*service
+	messages map[string]*message // By full name within the package, e.g. "Outer.Inner"
+}
+
+type service struct {
+	name string
+	rpcs []*rpc
+}
+
+type rpc struct {
+	name            string
+	tag             string // Section comment preceding the RPC in the service
+	request         string
+	response        string
+	clientStreaming bool
+	serverStreaming bool
+}
+
+type message struct {
+	name        string // Full name within the package
+	description string
+	fields      []*field
+	oneofs      map[string][]string // Names of the fields of each oneof
+}
+
+type field struct {
+	name        string
+	typ         string // Type as written; the value type of maps
+	key         string // Key type of maps
+	repeated    bool
+	description string
+}
+
+// Generate returns the OpenAPI document, in YAML, of the services and messages of a protobuf file
+func Generate(proto []byte) ([]byte, error) {
+	f, err := parse(proto)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := f.document()
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// parse reads the services and messages of a protobuf file. Declarations must be one per line, as
+// in the API's files; anything else fails, so the document never silently misses a change.
+func parse(proto []byte) (*file, error) {
+	f := &file{messages: map[string]*message{}}
+
+	var (
+		comments []string   // Comment lines before the current line
+		scopes   []string   // Names of the enclosing messages
+		kinds    []string   // "message", "oneof" or "service" per open block
+		current  *service   // Service being parsed
+		tag      string     // Section of the RPCs being parsed
+		messages []*message // Enclosing messages
+		oneof    string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(proto))
+	for number := 1; scanner.Scan(); number++ {
+		line, trailing := splitComment(scanner.Text())
+		if line == "" {
+			if trailing != "" {
+				comments = append(comments, trailing)
+			} else {
+				comments = nil
+			}
+			continue
+		}
+		leading := strings.Join(comments, "\n")
+		description := strings.Trim(leading+"\n"+trailing, "\n")
+		comments = nil
+
+		switch {
+		case packagePattern.MatchString(line):
+			f.pkg = packagePattern.FindStringSubmatch(line)[1]
+		case ignoredPattern.MatchString(line):
+		case servicePattern.MatchString(line):
+			current = &service{name: servicePattern.FindStringSubmatch(line)[1]}
+			f.services = append(f.services, current)
+			kinds = append(kinds, "service")
+		case current != nil && rpcPattern.MatchString(line):
+			// Comments inside the service name the section of the RPCs that follow
+			if leading != "" {
+				tag = leading
+			}
+			m := rpcPattern.FindStringSubmatch(line)
+			current.rpcs = append(current.rpcs, &rpc{
+				name:            m[1],
+				tag:             tag,
+				request:         m[3],
+				response:        m[5],
+				clientStreaming: m[2] != "",
+				serverStreaming: m[4] != "",
+			})
+		case messagePattern.MatchString(line):
+			match := messagePattern.FindStringSubmatch(line)
+			name := match[1]
+			full := strings.Join(append(scopes, name), ".")
+			m := &message{name: full, description: description, oneofs: map[string][]string{}}
+			f.messages[full] = m
+			if match[2] != "" {
+				break
+			}
+			scopes = append(scopes, name)
+			messages = append(messages, m)
+			kinds = append(kinds, "message")
+		case len(messages) > 0 && oneofPattern.MatchString(line):
+			oneof = oneofPattern.FindStringSubmatch(line)[1]
+			kinds = append(kinds, "oneof")
+		case len(messages) > 0 && fieldPattern.MatchString(line):
+			m := fieldPattern.FindStringSubmatch(line)
+			fd := &field{name: m[5], typ: m[2], repeated: m[1] != "", description: description}
+			if m[3] != "" {
+				fd.key, fd.typ = m[3], m[4]
+			}
+			parent := messages[len(messages)-1]
+			parent.fields = append(parent.fields, fd)
+			if oneof != "" {
+				parent.oneofs[oneof] = append(parent.oneofs[oneof], fd.name)
+			}
+		case line == "}" && len(kinds) > 0:
+			switch kinds[len(kinds)-1] {
+			case "service":
+				current, tag = nil, ""
+			case "message":
+				scopes = scopes[:len(scopes)-1]
+				messages = messages[:len(messages)-1]
+			case "oneof":
+				oneof = ""
+			}
+			kinds = kinds[:len(kinds)-1]
+		default:
+			return nil, fmt.Errorf("line %d: unsupported declaration %q", number, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(kinds) > 0 {
+		return nil, fmt.Errorf("unterminated %s", kinds[len(kinds)-1])
+	}
+	return f, nil
+}
+
+// splitComment splits a line into its declaration and its comment, both trimmed
+func splitComment(line string) (string, string) {
+	declaration, comment, _ := strings.Cut(line, "//")
+	return strings.TrimSpace(declaration), strings.TrimSpace(comment)
+}
+
+// document builds the OpenAPI document of the file
+func (f *file) document() (*object, error) {
+	paths := &object{}
+	var tags []string
+	seen := map[string]bool{}
+	for _, s := range f.services {
+		for _, r := range s.rpcs {
+			request, err := f.resolve(r.request, nil)
+			if err != nil {
+				return nil, fmt.Errorf("rpc %s: %w", r.name, err)
+			}
+			response, err := f.resolve(r.response, nil)
+			if err != nil {
+				return nil, fmt.Errorf("rpc %s: %w", r.name, err)
+			}
+
+			operation := &object{}
+			operation.set("operationId", r.name)
+			if r.tag != "" {
+				operation.set("tags", []string{r.tag})
+				if !seen[r.tag] {
+					seen[r.tag] = true
+					tags = append(tags, r.tag)
+				}
+			}
+			var notes []string
+			if r.clientStreaming {
+				notes = append(notes, "Client streaming: the body is a stream of request messages.")
+			}
+			if r.serverStreaming {
+				notes = append(notes, "Server streaming: the response is a stream of response messages.")
+			}
+			if len(notes) > 0 {
+				operation.set("description", strings.Join(notes, " "))
+			}
+			operation.set("requestBody", obj(
+				"required", true,
+				"content", obj("application/json", obj("schema", ref(request))),
+			))
+			operation.set("responses", obj(
+				"200", obj(
+					"description", "OK",
+					"content", obj("application/json", obj("schema", ref(response))),
+				),
+				"default", obj(
+					"description", "The gRPC status of a failed call",
+					"content", obj("application/json", obj("schema", ref("Status"))),
+				),
+			))
+			paths.set(fmt.Sprintf("/%s.%s/%s", f.pkg, s.name, r.name), obj("post", operation))
+		}
+	}
+
+	names := make([]string, 0, len(f.messages))
+	for name := range f.messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	schemas := &object{}
+	for _, name := range names {
+		schema, err := f.schema(f.messages[name])
+		if err != nil {
+			return nil, err
+		}
+		schemas.set(name, schema)
+	}
+	schemas.set("Status", obj(
+		"type", "object",
+		"description", "Error of a failed call, as the gRPC status of the google.rpc.Status message",
+		"properties", obj(
+			"code", obj("type", "integer", "format", "int32", "description", "gRPC status code, e.g. 7 for PERMISSION_DENIED"),
+			"message", obj("type", "string"),
+			"details", obj("type", "array", "items", obj("type", "object", "additionalProperties", true)),
+		),
+	))
+
+	tagList := make([]*object, len(tags))
+	for i, tag := range tags {
+		tagList[i] = obj("name", tag)
+	}
+	return obj(
+		"openapi", "3.0.3",
+		"info", obj(
+			"title", "IAM API",
+			"version", f.pkg,
+			"description", "Generated from api/proto/iam/v1/iam.proto by `make openapi`; do not edit.\n\n"+
+				"Each RPC is a POST of its request message to /<package>.<service>/<method>, the gRPC-JSON "+
+				"mapping served by a transcoding proxy in front of the gRPC server, such as Envoy's "+
+				"grpc_json_transcoder. Messages follow the proto3 JSON mapping: fields are named in "+
+				"lowerCamelCase, 64-bit integers are strings and timestamps RFC 3339 strings.",
+		),
+		"tags", tagList,
+		"paths", paths,
+		"components", obj("schemas", schemas),
+	), nil
+}
+
+// schema returns the schema of a message
+func (f *file) schema(m *message) (*object, error) {
+	schema := obj("type", "object")
+	description := m.description
+	oneofs := make([]string, 0, len(m.oneofs))
+	for name := range m.oneofs {
+		oneofs = append(oneofs, name)
+	}
+	sort.Strings(oneofs)
+	for _, name := range oneofs {
+		fields := make([]string, len(m.oneofs[name]))
+		for i, fd := range m.oneofs[name] {
+			fields[i] = jsonName(fd)
+		}
+		note := fmt.Sprintf("At most one of %s is set.", strings.Join(fields, ", "))
+		description = strings.TrimSpace(description + "\n\n" + note)
+	}
+	if description != "" {
+		schema.set("description", description)
+	}
+
+	properties := &object{}
+	scope := strings.Split(m.name, ".")
+	for _, fd := range m.fields {
+		property, err := f.fieldSchema(fd, scope)
+		if err != nil {
+			return nil, fmt.Errorf("message %s field %s: %w", m.name, fd.name, err)
+		}
+		properties.set(jsonName(fd.name), property)
+	}
+	schema.set("properties", properties)
+	return schema, nil
+}
+
+// fieldSchema returns the schema of a field of a message nested in scope
+func (f *file) fieldSchema(fd *field, scope []string) (*object, error) {
+	value, err := f.typeSchema(fd.typ, scope)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fd.key != "":
+		value = obj("type", "object", "additionalProperties", value)
+	case fd.repeated:
+		value = obj("type", "array", "items", value)
+	}
+	if fd.description != "" {
+		// Siblings of $ref are ignored, so references are wrapped to carry a description
+		if value.get("$ref") != nil {
+			value = obj("allOf", []*object{value})
+		}
+		value.set("description", fd.description)
+	}
+	return value, nil
+}
+
+// typeSchema returns the schema of a scalar, well-known or message type
+func (f *file) typeSchema(typ string, scope []string) (*object, error) {
+	switch typ {
+	case "string":
+		return obj("type", "string"), nil
+	case "bool":
+		return obj("type", "boolean"), nil
+	case "int32", "sint32", "sfixed32":
+		return obj("type", "integer", "format", "int32"), nil
+	case "uint32", "fixed32":
+		return obj("type", "integer", "format", "int64"), nil
+	case "int64", "sint64", "sfixed64", "uint64", "fixed64":
+		return obj("type", "string", "format", "int64"), nil
+	case "double":
+		return obj("type", "number", "format", "double"), nil
+	case "float":
+		return obj("type", "number", "format", "float"), nil
+	case "bytes":
+		return obj("type", "string", "format", "byte"), nil
+	case "google.protobuf.Timestamp":
+		return obj("type", "string", "format", "date-time"), nil
+	case "google.protobuf.Struct":
+		return obj("type", "object", "additionalProperties", true), nil
+	case "google.protobuf.FieldMask":
+		return obj("type", "string", "description", "Comma-separated field paths"), nil
+	}
+	name, err := f.resolve(typ, scope)
+	if err != nil {
+		return nil, err
+	}
+	return ref(name), nil
+}
+
+// resolve returns the full name of a message type referenced from scope, searching the innermost
+// scope first as protoc does
+func (f *file) resolve(typ string, scope []string) (string, error) {
+	typ = strings.TrimPrefix(typ, f.pkg+".")
+	for i := len(scope); i >= 0; i-- {
+		name := strings.Join(append(scope[:i:i], typ), ".")
+		if _, ok := f.messages[name]; ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown type %s", typ)
+}
+
+// jsonName returns the proto3 JSON name of a field, e.g. "resourceId" for "resource_id"
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper && 'a' <= r && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(r)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+func ref(name string) *object {
+	return obj("$ref", "#/components/schemas/"+name)
+}
+
+// object is a YAML mapping keeping its keys in insertion order
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// obj returns an object of alternating keys and values
+func obj(pairs ...interface{}) *object {
+	o := &object{}
+	for i := 0; i < len(pairs); i += 2 {
+		o.set(pairs[i].(string), pairs[i+1])
+	}
+	return o
+}
+
+func (o *object) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) get(key string) interface{} {
+	return o.values[key]
+}
+
+// MarshalYAML encodes the object as a mapping in insertion order
+func (o *object) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range o.keys {
+		var value yaml.Node
+		if err := value.Encode(o.values[key]); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &value)
+	}
+	return node, nil
+}
@@ -0,0 +1,112 @@
+package openapi
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	protoPath    = "../../api/proto/iam/v1/iam.proto"
+	documentPath = "../../api/openapi/iam.yaml"
+)
+
+// Test: The checked-in document is the one generated from the proto; run `make openapi` after
+// changing the API
+func TestGenerate_InSync(t *testing.T) {
+	proto, err := os.ReadFile(protoPath)
+	require.NoError(t, err)
+	generated, err := Generate(proto)
+	require.NoError(t, err)
+	checkedIn, err := os.ReadFile(documentPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(generated), string(checkedIn), "api/openapi/iam.yaml is stale, run make openapi")
+}
+
+// Test: Every RPC has a path, and the messages of policies have schemas
+func TestGenerate_Document(t *testing.T) {
+	proto, err := os.ReadFile(protoPath)
+	require.NoError(t, err)
+	generated, err := Generate(proto)
+	require.NoError(t, err)
+
+	var document struct {
+		OpenAPI    string                 `yaml:"openapi"`
+		Paths      map[string]interface{} `yaml:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	require.NoError(t, yaml.Unmarshal(generated, &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	parsed, err := parse(proto)
+	require.NoError(t, err)
+	for _, s := range parsed.services {
+		for _, r := range s.rpcs {
+			assert.Contains(t, document.Paths, "/"+parsed.pkg+"."+s.name+"/"+r.name)
+		}
+	}
+	for _, name := range []string{"Policy", "Binding", "Role", "Condition", "Status"} {
+		assert.Contains(t, document.Components.Schemas, name)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	proto := `syntax = "proto3";
+package demo.v1;
+import "google/protobuf/timestamp.proto";
+
+service Demo {
+  // Reading
+  rpc GetThing(GetThingRequest) returns (Thing);
+}
+
+message GetThingRequest {}
+
+// A thing
+message Thing {
+  string thing_id = 1; // Unique
+  int64 size = 2;
+  repeated Part parts = 3;
+  map<string, string> labels = 4;
+  google.protobuf.Timestamp created_at = 5;
+  message Part {
+    bool optional = 1;
+  }
+}
+`
+	generated, err := Generate([]byte(proto))
+	require.NoError(t, err)
+
+	var document map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(generated, &document))
+	operation := document["paths"].(map[string]interface{})["/demo.v1.Demo/GetThing"].(map[string]interface{})["post"].(map[string]interface{})
+	assert.Equal(t, "GetThing", operation["operationId"])
+	assert.Equal(t, []interface{}{"Reading"}, operation["tags"])
+
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Contains(t, schemas, "GetThingRequest")
+	assert.Contains(t, schemas, "Thing.Part")
+	thing := schemas["Thing"].(map[string]interface{})
+	assert.Equal(t, "A thing", thing["description"])
+	properties := thing["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "description": "Unique"}, properties["thingId"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "int64"}, properties["size"])
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/Thing.Part"}}, properties["parts"])
+	assert.Equal(t, map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}, properties["labels"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, properties["createdAt"])
+}
+
+// Test: Declarations outside the supported subset fail instead of being left out of the document
+func TestGenerate_Unsupported(t *testing.T) {
+	_, err := Generate([]byte("package demo.v1;\nenum State {\n  UNKNOWN = 0;\n}\n"))
+	assert.Error(t, err)
+
+	_, err = Generate([]byte("package demo.v1;\nmessage Thing {\n  Missing missing = 1;\n}\n"))
+	assert.Error(t, err)
+}
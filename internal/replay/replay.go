@@ -0,0 +1,194 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/service"
+)
+
+// ReadEntries reads the decision log entries written by the file sink, one JSON object per line
+func ReadEntries(r io.Reader) ([]domain.DecisionLog, error) {
+	var entries []domain.DecisionLog
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry domain.DecisionLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: invalid decision log entry: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Diff is a recorded check the evaluator decided differently, or failed to evaluate
+type Diff struct {
+	Recorded  domain.DecisionLog `json:"recorded"`
+	Allowed   bool               `json:"allowed"`
+	Reason    string             `json:"reason"`
+	Error     string             `json:"error,omitempty"`
+	LatencyUS int64              `json:"latency_us"`
+}
+
+// LatencySummary describes a distribution of check latencies
+type LatencySummary struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// Report summarizes a replay
+type Report struct {
+	Checks         int64 // Entries replayed
+	Matched        int64 // Checks decided as recorded
+	NewlyAllowed   int64 // Checks recorded as denied and now allowed
+	NewlyDenied    int64 // Checks recorded as allowed and now denied
+	Errors         int64 // Checks the evaluator failed to evaluate
+	RecordedErrors int64 // Checks that had failed when recorded; their decisions are not compared
+
+	// Latencies of the checks evaluated successfully both when recorded and when replayed
+	Recorded LatencySummary
+	Replayed LatencySummary
+}
+
+// Diverged returns the number of checks decided differently than recorded
+func (r *Report) Diverged() int64 {
+	return r.NewlyAllowed + r.NewlyDenied
+}
+
+// Options tune a replay
+type Options struct {
+	Concurrency int        // Checks evaluated at once; 1 if zero
+	OnDiff      func(Diff) // Called for every diff, from one goroutine at a time
+}
+
+// Replay evaluates every recorded check with evaluator and compares the decisions and latencies
+// with the recorded ones. The decision log does not record the condition context of checks, so
+// checks are replayed without one; conditions reading request.* may decide them differently.
+func Replay(entries []domain.DecisionLog, evaluator service.PermissionEvaluator, opts Options) *Report {
+	concurrency := max(opts.Concurrency, 1)
+
+	var (
+		mu       sync.Mutex
+		report   = &Report{}
+		recorded []time.Duration
+		replayed []time.Duration
+	)
+	record := func(entry domain.DecisionLog, result service.CheckResult, err error, latency time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		report.Checks++
+		diff := Diff{Recorded: entry, Allowed: result.Allowed, Reason: result.Reason, LatencyUS: latency.Microseconds()}
+		if err != nil {
+			report.Errors++
+			diff.Error = err.Error()
+		} else {
+			if entry.Error != "" {
+				report.RecordedErrors++
+				return
+			}
+			recorded = append(recorded, time.Duration(entry.LatencyUS)*time.Microsecond)
+			replayed = append(replayed, latency)
+			switch {
+			case result.Allowed == entry.Allowed:
+				report.Matched++
+				return
+			case result.Allowed:
+				report.NewlyAllowed++
+			default:
+				report.NewlyDenied++
+			}
+		}
+		if opts.OnDiff != nil {
+			opts.OnDiff(diff)
+		}
+	}
+
+	work := make(chan domain.DecisionLog)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range work {
+				start := time.Now()
+				result, err := evaluator.Check(entry.Principal, entry.ResourceID, entry.Permission, nil)
+				record(entry, result, err, time.Since(start))
+			}
+		}()
+	}
+	for _, entry := range entries {
+		work <- entry
+	}
+	close(work)
+	wg.Wait()
+
+	report.Recorded = summarize(recorded)
+	report.Replayed = summarize(replayed)
+	return report
+}
+
+// summarize computes the summary of latencies, which it sorts
+func summarize(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	slices.Sort(latencies)
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	return LatencySummary{
+		Mean: total / time.Duration(len(latencies)),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P99:  percentile(99),
+		Max:  latencies[len(latencies)-1],
+	}
+}
+
+// WriteReport writes report as text
+func WriteReport(w io.Writer, report *Report) error {
+	_, err := fmt.Fprintf(w, `checks replayed:   %d
+matched:           %d
+newly allowed:     %d
+newly denied:      %d
+errors:            %d
+recorded failures: %d (not compared)
+
+latency    recorded     replayed
+  mean     %-12s %s
+  p50      %-12s %s
+  p90      %-12s %s
+  p99      %-12s %s
+  max      %-12s %s
+`,
+		report.Checks, report.Matched, report.NewlyAllowed, report.NewlyDenied, report.Errors, report.RecordedErrors,
+		report.Recorded.Mean, report.Replayed.Mean,
+		report.Recorded.P50, report.Replayed.P50,
+		report.Recorded.P90, report.Replayed.P90,
+		report.Recorded.P99, report.Replayed.P99,
+		report.Recorded.Max, report.Replayed.Max,
+	)
+	return err
+}
@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEvaluator allows the permissions of allowed and fails the checks of failing
+type fakeEvaluator struct {
+	service.PermissionEvaluator
+	allowed map[string]bool
+	failing map[string]bool
+}
+
+func (e *fakeEvaluator) Check(principal string, resourceID uuid.UUID, permission string, context map[string]string) (service.CheckResult, error) {
+	if e.failing[permission] {
+		return service.CheckResult{}, errors.New("database unavailable")
+	}
+	return service.CheckResult{Allowed: e.allowed[permission]}, nil
+}
+
+func TestReadEntries(t *testing.T) {
+	resourceID := uuid.New()
+	input := `{"principal":"user:alice@example.com","resource_id":"` + resourceID.String() + `","permission":"storage.buckets.get","allowed":true,"latency_us":120}
+
+{"principal":"user:bob@example.com","resource_id":"` + resourceID.String() + `","permission":"storage.buckets.get","allowed":false,"latency_us":80}
+`
+	entries, err := ReadEntries(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "user:alice@example.com", entries[0].Principal)
+	assert.Equal(t, resourceID, entries[1].ResourceID)
+	assert.Equal(t, int64(80), entries[1].LatencyUS)
+
+	_, err = ReadEntries(strings.NewReader("{}\nnot json\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestReplay(t *testing.T) {
+	resourceID := uuid.New()
+	entry := func(permission string, allowed bool, recordedErr string) domain.DecisionLog {
+		return domain.DecisionLog{
+			Principal:  "user:alice@example.com",
+			ResourceID: resourceID,
+			Permission: permission,
+			Allowed:    allowed,
+			Error:      recordedErr,
+			LatencyUS:  1000,
+		}
+	}
+	entries := []domain.DecisionLog{
+		entry("storage.buckets.get", true, ""),
+		entry("storage.buckets.list", false, ""),
+		entry("storage.buckets.delete", true, ""),
+		entry("storage.buckets.create", false, ""),
+		entry("storage.buckets.update", false, "timeout"),
+		entry("storage.buckets.setIamPolicy", false, ""),
+	}
+	evaluator := &fakeEvaluator{
+		allowed: map[string]bool{"storage.buckets.get": true, "storage.buckets.create": true},
+		failing: map[string]bool{"storage.buckets.setIamPolicy": true},
+	}
+
+	var diffs []Diff
+	report := Replay(entries, evaluator, Options{Concurrency: 3, OnDiff: func(diff Diff) { diffs = append(diffs, diff) }})
+	assert.Equal(t, int64(6), report.Checks)
+	assert.Equal(t, int64(2), report.Matched)
+	assert.Equal(t, int64(1), report.NewlyAllowed)
+	assert.Equal(t, int64(1), report.NewlyDenied)
+	assert.Equal(t, int64(2), report.Diverged())
+	assert.Equal(t, int64(1), report.Errors)
+	assert.Equal(t, int64(1), report.RecordedErrors)
+	assert.Equal(t, time.Millisecond, report.Recorded.P99)
+	assert.Positive(t, report.Replayed.Max)
+
+	permissions := make([]string, 0, len(diffs))
+	for _, diff := range diffs {
+		permissions = append(permissions, diff.Recorded.Permission)
+	}
+	assert.ElementsMatch(t, []string{"storage.buckets.delete", "storage.buckets.create", "storage.buckets.setIamPolicy"}, permissions)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteReport(&out, report))
+	assert.Contains(t, out.String(), "newly allowed:     1")
+}
+
+func TestSummarize(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	summary := summarize(latencies)
+	assert.Equal(t, 50*time.Millisecond, summary.P50)
+	assert.Equal(t, 90*time.Millisecond, summary.P90)
+	assert.Equal(t, 99*time.Millisecond, summary.P99)
+	assert.Equal(t, 100*time.Millisecond, summary.Max)
+	assert.Equal(t, 50500*time.Microsecond, summary.Mean)
+	assert.Equal(t, LatencySummary{}, summarize(nil))
+}
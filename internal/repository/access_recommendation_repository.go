@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// AccessRecommendationRepository stores the results of the latest access analysis
+type AccessRecommendationRepository interface {
+	ReplaceAll(recommendations []domain.AccessRecommendation) error
+	List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.AccessRecommendation, error)
+}
+
+type accessRecommendationRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewAccessRecommendationRepository creates a new access recommendation repository
+func NewAccessRecommendationRepository(db *gorm.DB, opts ...Option) AccessRecommendationRepository {
+	o := applyOptions(db, opts)
+	return &accessRecommendationRepository{db: db, reader: o.reader}
+}
+
+// ReplaceAll atomically replaces the stored recommendations with those of a new analysis
+func (r *accessRecommendationRepository) ReplaceAll(recommendations []domain.AccessRecommendation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&domain.AccessRecommendation{}).Error; err != nil {
+			return err
+		}
+		if len(recommendations) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&recommendations, 100).Error
+	})
+}
+
+// List returns recommendations ordered by principal, optionally filtered by principal and resource
+func (r *accessRecommendationRepository) List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.AccessRecommendation, error) {
+	var recommendations []domain.AccessRecommendation
+	query := r.reader.Model(&domain.AccessRecommendation{}).Order("principal, resource_id, role")
+
+	if principal != "" {
+		query = query.Where("principal = ?", principal)
+	}
+
+	if resourceID != nil {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&recommendations).Error
+	return recommendations, err
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestAccessRecommendationRepository_ReplaceAllAndList(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccessRecommendationRepository(db)
+
+	resourceID := uuid.New()
+	recommendation := func(principal string, resourceID uuid.UUID) domain.AccessRecommendation {
+		return domain.AccessRecommendation{
+			Principal:         principal,
+			ResourceID:        resourceID,
+			BindingID:         uuid.New(),
+			Role:              "roles/storage.admin",
+			Action:            domain.RecommendRemoveMember,
+			UsedPermissions:   datatypes.JSON(`[]`),
+			UnusedPermissions: datatypes.JSON(`["storage.objects.delete"]`),
+			ObservedSince:     time.Now().AddDate(0, 0, -90),
+		}
+	}
+
+	require.NoError(t, repo.ReplaceAll([]domain.AccessRecommendation{
+		recommendation("user:alice@example.com", resourceID),
+		recommendation("user:bob@example.com", resourceID),
+		recommendation("user:alice@example.com", uuid.New()),
+	}))
+
+	all, err := repo.List("", nil, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	byBoth, err := repo.List("user:alice@example.com", &resourceID, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, byBoth, 1)
+
+	// A new analysis replaces the previous results
+	require.NoError(t, repo.ReplaceAll([]domain.AccessRecommendation{recommendation("user:carol@example.com", resourceID)}))
+	all, err = repo.List("", nil, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "user:carol@example.com", all[0].Principal)
+
+	require.NoError(t, repo.ReplaceAll(nil))
+	all, err = repo.List("", nil, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
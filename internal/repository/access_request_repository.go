@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// AccessRequestRepository stores requests for roles and their reviews
+type AccessRequestRepository interface {
+	Create(request *domain.AccessRequest) error
+	GetByID(id uuid.UUID) (*domain.AccessRequest, error)
+	List(filter AccessRequestFilter, limit, offset int) ([]domain.AccessRequest, error)
+	// Transition saves the status, review and binding of a request that is still in status from
+	Transition(request *domain.AccessRequest, from string) error
+}
+
+// AccessRequestFilter restricts access request listings; zero fields match everything
+type AccessRequestFilter struct {
+	ResourceID *uuid.UUID
+	Principal  string
+	RoleID     *uuid.UUID
+	Status     string
+}
+
+type accessRequestRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewAccessRequestRepository creates a new access request repository
+func NewAccessRequestRepository(db *gorm.DB, opts ...Option) AccessRequestRepository {
+	o := applyOptions(db, opts)
+	return &accessRequestRepository{db: db, reader: o.reader}
+}
+
+func (r *accessRequestRepository) Create(request *domain.AccessRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *accessRequestRepository) GetByID(id uuid.UUID) (*domain.AccessRequest, error) {
+	var request domain.AccessRequest
+	// Read from the primary so a review sees the latest status
+	err := r.db.First(&request, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// List returns requests oldest first
+func (r *accessRequestRepository) List(filter AccessRequestFilter, limit, offset int) ([]domain.AccessRequest, error) {
+	var requests []domain.AccessRequest
+	query := r.reader.Model(&domain.AccessRequest{}).Order("created_at, id")
+
+	if filter.ResourceID != nil {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.Principal != "" {
+		query = query.Where("principal = ?", filter.Principal)
+	}
+	if filter.RoleID != nil {
+		query = query.Where("role_id = ?", filter.RoleID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&requests).Error
+	return requests, err
+}
+
+func (r *accessRequestRepository) Transition(request *domain.AccessRequest, from string) error {
+	result := r.db.Model(request).
+		Where("status = ?", from).
+		Select("status", "reviewed_by", "reviewed_at", "review_comment", "binding_id", "updated_at").
+		Updates(request)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessRequestResolved
+	}
+	return nil
+}
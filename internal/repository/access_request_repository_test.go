@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessRequestRepository_CreateListTransition(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccessRequestRepository(db)
+
+	projectID, roleID := uuid.New(), uuid.New()
+	request := &domain.AccessRequest{
+		ResourceID:    projectID,
+		RoleID:        roleID,
+		Principal:     "user:alice@example.com",
+		Justification: "on-call",
+		Status:        domain.AccessRequestPending,
+	}
+	require.NoError(t, repo.Create(request))
+	require.NoError(t, repo.Create(&domain.AccessRequest{
+		ResourceID: projectID,
+		RoleID:     roleID,
+		Principal:  "user:bob@example.com",
+		Status:     domain.AccessRequestRejected,
+	}))
+	require.NoError(t, repo.Create(&domain.AccessRequest{
+		ResourceID: uuid.New(),
+		RoleID:     roleID,
+		Principal:  "user:alice@example.com",
+		Status:     domain.AccessRequestPending,
+	}))
+
+	found, err := repo.GetByID(request.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "on-call", found.Justification)
+
+	onProject, err := repo.List(AccessRequestFilter{ResourceID: &projectID}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, onProject, 2)
+
+	pending, err := repo.List(AccessRequestFilter{Principal: "user:alice@example.com", Status: domain.AccessRequestPending}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	// Approving a pending request
+	now := time.Now()
+	bindingID := uuid.New()
+	found.Status = domain.AccessRequestApproved
+	found.ReviewedBy = "user:lead@example.com"
+	found.ReviewedAt = &now
+	found.BindingID = &bindingID
+	require.NoError(t, repo.Transition(found, domain.AccessRequestPending))
+
+	approved, err := repo.GetByID(request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessRequestApproved, approved.Status)
+	assert.Equal(t, "user:lead@example.com", approved.ReviewedBy)
+	assert.Equal(t, bindingID, *approved.BindingID)
+
+	// A second review finds it resolved
+	approved.Status = domain.AccessRequestRejected
+	assert.ErrorIs(t, repo.Transition(approved, domain.AccessRequestPending), ErrAccessRequestResolved)
+
+	missing, err := repo.GetByID(uuid.New())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
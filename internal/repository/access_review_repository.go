@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// accessReviewItemBatchSize is the number of items inserted per statement when a review is created
+const accessReviewItemBatchSize = 500
+
+// AccessReviewRepository stores access review campaigns and their items
+type AccessReviewRepository interface {
+	// Create stores a review together with its items
+	Create(review *domain.AccessReview, items []domain.AccessReviewItem) error
+	GetByID(id uuid.UUID) (*domain.AccessReview, error)
+	List(resourceID *uuid.UUID, status string, limit, offset int) ([]domain.AccessReview, error)
+	// ListDue returns the open reviews due before the given time
+	ListDue(before time.Time) ([]domain.AccessReview, error)
+	// Close saves the closing fields of a review that is still open
+	Close(review *domain.AccessReview) error
+	GetItem(id uuid.UUID) (*domain.AccessReviewItem, error)
+	ListItems(reviewID uuid.UUID, decision string, limit, offset int) ([]domain.AccessReviewItem, error)
+	// Decide saves the decision of an item of an open review
+	Decide(item *domain.AccessReviewItem) error
+}
+
+type accessReviewRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewAccessReviewRepository creates a new access review repository
+func NewAccessReviewRepository(db *gorm.DB, opts ...Option) AccessReviewRepository {
+	o := applyOptions(db, opts)
+	return &accessReviewRepository{db: db, reader: o.reader}
+}
+
+func (r *accessReviewRepository) Create(review *domain.AccessReview, items []domain.AccessReviewItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for i := range items {
+			items[i].ReviewID = review.ID
+		}
+		return tx.CreateInBatches(items, accessReviewItemBatchSize).Error
+	})
+}
+
+func (r *accessReviewRepository) GetByID(id uuid.UUID) (*domain.AccessReview, error) {
+	var review domain.AccessReview
+	// Read from the primary so decisions and closing see the latest status
+	err := r.db.First(&review, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// List returns reviews oldest first, optionally only those on resourceID or with status
+func (r *accessReviewRepository) List(resourceID *uuid.UUID, status string, limit, offset int) ([]domain.AccessReview, error) {
+	var reviews []domain.AccessReview
+	query := r.reader.Model(&domain.AccessReview{}).Order("created_at, id")
+
+	if resourceID != nil {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&reviews).Error
+	return reviews, err
+}
+
+func (r *accessReviewRepository) ListDue(before time.Time) ([]domain.AccessReview, error) {
+	var reviews []domain.AccessReview
+	err := r.db.Where("status = ? AND due_at < ?", domain.AccessReviewOpen, before).
+		Order("due_at, id").Find(&reviews).Error
+	return reviews, err
+}
+
+func (r *accessReviewRepository) Close(review *domain.AccessReview) error {
+	result := r.db.Model(review).
+		Where("status = ?", domain.AccessReviewOpen).
+		Select("status", "closed_by", "closed_at", "revoked", "updated_at").
+		Updates(review)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessReviewClosed
+	}
+	return nil
+}
+
+func (r *accessReviewRepository) GetItem(id uuid.UUID) (*domain.AccessReviewItem, error) {
+	var item domain.AccessReviewItem
+	err := r.db.First(&item, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListItems returns the items of a review by resource, role and member, optionally only those with decision
+func (r *accessReviewRepository) ListItems(reviewID uuid.UUID, decision string, limit, offset int) ([]domain.AccessReviewItem, error) {
+	var items []domain.AccessReviewItem
+	query := r.reader.Where("review_id = ?", reviewID).Order("resource_id, role_id, member, id")
+
+	if decision != "" {
+		query = query.Where("decision = ?", decision)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&items).Error
+	return items, err
+}
+
+func (r *accessReviewRepository) Decide(item *domain.AccessReviewItem) error {
+	open := r.db.Model(&domain.AccessReview{}).Select("1").
+		Where("access_reviews.id = access_review_items.review_id AND access_reviews.status = ?", domain.AccessReviewOpen)
+	result := r.db.Model(item).
+		Where("EXISTS (?)", open).
+		Select("decision", "decided_by", "decided_at", "comment", "updated_at").
+		Updates(item)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessReviewClosed
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessReviewRepository_Lifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAccessReviewRepository(db)
+
+	projectID, roleID, bindingID := uuid.New(), uuid.New(), uuid.New()
+	due := time.Now().Add(-time.Minute)
+	review := &domain.AccessReview{
+		ResourceID: projectID,
+		Title:      "Q3 recertification",
+		Reviewers:  []byte(`["user:lead@example.com"]`),
+		Status:     domain.AccessReviewOpen,
+		DueAt:      &due,
+	}
+	items := []domain.AccessReviewItem{
+		{ResourceID: projectID, BindingID: bindingID, RoleID: roleID, Member: "user:alice@example.com", Decision: domain.ReviewDecisionPending},
+		{ResourceID: projectID, BindingID: bindingID, RoleID: roleID, Member: "user:bob@example.com", Decision: domain.ReviewDecisionPending},
+	}
+	require.NoError(t, repo.Create(review, items))
+	require.NoError(t, repo.Create(&domain.AccessReview{
+		ResourceID: uuid.New(),
+		Title:      "not due",
+		Reviewers:  []byte(`[]`),
+		Status:     domain.AccessReviewOpen,
+	}, nil))
+
+	found, err := repo.GetByID(review.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.True(t, found.IsReviewer("user:lead@example.com"))
+
+	onProject, err := repo.List(&projectID, domain.AccessReviewOpen, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, onProject, 1)
+
+	dueReviews, err := repo.ListDue(time.Now())
+	require.NoError(t, err)
+	require.Len(t, dueReviews, 1)
+	assert.Equal(t, review.ID, dueReviews[0].ID)
+
+	stored, err := repo.ListItems(review.ID, "", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, "user:alice@example.com", stored[0].Member)
+
+	// Deciding on an item of an open review
+	item, err := repo.GetItem(stored[0].ID)
+	require.NoError(t, err)
+	now := time.Now()
+	item.Decision = domain.ReviewDecisionRevoked
+	item.DecidedBy = "user:lead@example.com"
+	item.DecidedAt = &now
+	require.NoError(t, repo.Decide(item))
+
+	revoked, err := repo.ListItems(review.ID, domain.ReviewDecisionRevoked, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, revoked, 1)
+	assert.Equal(t, "user:lead@example.com", revoked[0].DecidedBy)
+
+	// Closing once, after which decisions are rejected
+	found.Status = domain.AccessReviewClosed
+	found.ClosedAt = &now
+	found.Revoked = 1
+	require.NoError(t, repo.Close(found))
+	assert.ErrorIs(t, repo.Close(found), ErrAccessReviewClosed)
+	item.Decision = domain.ReviewDecisionApproved
+	assert.ErrorIs(t, repo.Decide(item), ErrAccessReviewClosed)
+
+	closed, err := repo.GetByID(review.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessReviewClosed, closed.Status)
+	assert.Equal(t, 1, closed.Revoked)
+}
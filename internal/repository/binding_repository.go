@@ -1,39 +1,91 @@
 package repository
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// BindingRepository handles binding data operations
+// BindingRepository handles binding data operations. Its listings return bindings oldest first,
+// ties broken by ID, so that their pages are stable.
 type BindingRepository interface {
 	Create(binding *domain.Binding) error
 	GetByID(id uuid.UUID) (*domain.Binding, error)
 	Delete(id uuid.UUID) error
 	ListByResourceID(resourceID uuid.UUID, limit, offset int) ([]domain.Binding, error)
 	ListByPrincipal(principal string, limit, offset int) ([]domain.Binding, error)
+	ListByRole(roleID uuid.UUID) ([]domain.Binding, error)
+	RoleUsage(roleIDs []uuid.UUID) ([]RoleBindingUsage, error)
 	GetByPolicyAndPrincipal(policyID uuid.UUID, principal string) ([]domain.Binding, error)
+	CreateBatch(policy *domain.Policy, bindings []domain.Binding) error
+	DeleteBatch(policy *domain.Policy, ids []uuid.UUID) error
+	RemoveMember(member string, policyIDs []uuid.UUID, updatedBy string) ([]MemberRemoval, error)
+	Search(query BindingSearch, limit, offset int) ([]domain.Binding, int64, error)
+	PurgeDeleted(before time.Time) (int64, error)
+}
+
+// RoleBindingUsage counts the bindings of a role and the distinct members they grant it to
+type RoleBindingUsage struct {
+	RoleID     uuid.UUID
+	Bindings   int64
+	Principals int64 // Distinct members, e.g. users, groups and domains
+}
+
+// MemberRemoval describes a member removed from a binding by RemoveMember
+type MemberRemoval struct {
+	PolicyID  uuid.UUID
+	BindingID uuid.UUID
+	RoleID    uuid.UUID
+	Deleted   bool // The binding had no other member and was deleted with its condition
+}
+
+// BindingSearch selects bindings across all resources; empty fields match every binding
+type BindingSearch struct {
+	Member     string    // Case-insensitive substring of a member, e.g. "@example.com"
+	Role       string    // Exact role name, e.g. "roles/viewer"
+	ResourceID uuid.UUID // Bindings on this resource and its descendants
+	Condition  string    // Case-insensitive substring of the condition's title or expression
 }
 
 type bindingRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	reader *gorm.DB
 }
 
 // NewBindingRepository creates a new binding repository
-func NewBindingRepository(db *gorm.DB) BindingRepository {
-	return &bindingRepository{db: db}
+func NewBindingRepository(db *gorm.DB, opts ...Option) BindingRepository {
+	o := applyOptions(db, opts)
+	return &bindingRepository{db: db, reader: o.reader}
 }
 
+// Create creates a binding without its condition; conditions are saved through ConditionRepository.
+// A binding created with a condition grants nothing in the evaluation read model until its
+// condition is saved, so it is never evaluated as unconditional.
 func (r *bindingRepository) Create(binding *domain.Binding) error {
-	return r.db.Create(binding).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Condition").Create(binding).Error; err != nil {
+			return err
+		}
+		if binding.Condition != nil {
+			return nil
+		}
+		return reindexGrants(tx, "id = ?", binding.ID)
+	})
 }
 
 func (r *bindingRepository) GetByID(id uuid.UUID) (*domain.Binding, error) {
 	var binding domain.Binding
-	err := r.db.Preload("Role").Preload("Role.Permissions").Preload("Condition").
+	err := r.reader.Preload("Role").Preload("Role.Permissions").Preload("Condition").
 		First(&binding, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -45,12 +97,17 @@ func (r *bindingRepository) GetByID(id uuid.UUID) (*domain.Binding, error) {
 }
 
 func (r *bindingRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&domain.Binding{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.Binding{}, id).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "id = ?", id)
+	})
 }
 
 func (r *bindingRepository) ListByResourceID(resourceID uuid.UUID, limit, offset int) ([]domain.Binding, error) {
 	var bindings []domain.Binding
-	query := r.db.Model(&domain.Binding{}).
+	query := r.reader.Model(&domain.Binding{}).
 		Preload("Role").Preload("Role.Permissions").Preload("Condition").
 		Joins("JOIN policies ON policies.id = bindings.policy_id").
 		Where("policies.resource_id = ?", resourceID)
@@ -63,15 +120,22 @@ func (r *bindingRepository) ListByResourceID(resourceID uuid.UUID, limit, offset
 		query = query.Offset(offset)
 	}
 
-	err := query.Find(&bindings).Error
+	err := byCreation(query, "bindings").Find(&bindings).Error
 	return bindings, err
 }
 
+// ListByPrincipal lists bindings granting to principal or the identities linked to it as
+// principal aliases, including bindings to their domains (domain:example.com) for users
 func (r *bindingRepository) ListByPrincipal(principal string, limit, offset int) ([]domain.Binding, error) {
+	linked, err := linkedPrincipals(r.reader, principal)
+	if err != nil {
+		return nil, err
+	}
+
 	var bindings []domain.Binding
-	query := r.db.Model(&domain.Binding{}).
+	query := r.reader.Model(&domain.Binding{}).
 		Preload("Role").Preload("Role.Permissions").Preload("Condition").
-		Where("members @> ?", `["`+principal+`"]`)
+		Where(memberCondition(r.reader, append([]string{principal}, linked...)...))
 
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -81,14 +145,305 @@ func (r *bindingRepository) ListByPrincipal(principal string, limit, offset int)
 		query = query.Offset(offset)
 	}
 
-	err := query.Find(&bindings).Error
+	err = byCreation(query, "bindings").Find(&bindings).Error
 	return bindings, err
 }
 
+// ListByRole lists every binding of a role with its policy, oldest first
+func (r *bindingRepository) ListByRole(roleID uuid.UUID) ([]domain.Binding, error) {
+	var bindings []domain.Binding
+	err := byCreation(r.reader.Preload("Policy").Preload("Condition").Where("role_id = ?", roleID), "bindings").
+		Find(&bindings).Error
+	return bindings, err
+}
+
+// RoleUsage counts the bindings and distinct members of each role; roles without bindings are
+// omitted. Members are counted in Go so the query is the same on every dialect.
+func (r *bindingRepository) RoleUsage(roleIDs []uuid.UUID) ([]RoleBindingUsage, error) {
+	if len(roleIDs) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		RoleID  uuid.UUID
+		Members datatypes.JSON
+	}
+	err := r.reader.Model(&domain.Binding{}).Select("role_id, members").
+		Where("role_id IN ?", roleIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []RoleBindingUsage
+	index := make(map[uuid.UUID]int)
+	members := make(map[uuid.UUID]map[string]bool)
+	for _, row := range rows {
+		i, ok := index[row.RoleID]
+		if !ok {
+			i = len(usage)
+			index[row.RoleID] = i
+			usage = append(usage, RoleBindingUsage{RoleID: row.RoleID})
+			members[row.RoleID] = make(map[string]bool)
+		}
+		usage[i].Bindings++
+
+		var list []string
+		if err := json.Unmarshal(row.Members, &list); err != nil {
+			return nil, fmt.Errorf("invalid members of a binding of role %s: %w", row.RoleID, err)
+		}
+		for _, member := range list {
+			members[row.RoleID][member] = true
+		}
+	}
+	for i := range usage {
+		usage[i].Principals = int64(len(members[usage[i].RoleID]))
+	}
+	return usage, nil
+}
+
 func (r *bindingRepository) GetByPolicyAndPrincipal(policyID uuid.UUID, principal string) ([]domain.Binding, error) {
 	var bindings []domain.Binding
-	err := r.db.Where("policy_id = ? AND members @> ?", policyID, `["`+principal+`"]`).
+	err := r.reader.Where("policy_id = ?", policyID).Where(memberCondition(r.reader, principal)).
 		Preload("Role").Preload("Role.Permissions").Preload("Condition").
 		Find(&bindings).Error
 	return bindings, err
 }
+
+// CreateBatch creates all bindings on the policy, together with their conditions, and bumps the
+// policy version once, in a single transaction
+func (r *bindingRepository) CreateBatch(policy *domain.Policy, bindings []domain.Binding) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range bindings {
+			bindings[i].PolicyID = policy.ID
+		}
+
+		if len(bindings) > 0 {
+			if err := tx.Create(&bindings).Error; err != nil {
+				return err
+			}
+			ids := make([]uuid.UUID, len(bindings))
+			for i := range bindings {
+				ids[i] = bindings[i].ID
+			}
+			if err := reindexGrants(tx, "id IN ?", ids); err != nil {
+				return err
+			}
+		}
+
+		return tx.Omit(clause.Associations).Save(policy).Error
+	})
+}
+
+// DeleteBatch deletes the given bindings of the policy and their conditions, and bumps the policy
+// version once, in a single transaction.
+// The whole batch is rolled back if any binding does not belong to the policy.
+func (r *bindingRepository) DeleteBatch(policy *domain.Policy, ids []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			result := tx.Where("policy_id = ? AND id IN ?", policy.ID, ids).Delete(&domain.Binding{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(ids)) {
+				return fmt.Errorf("expected to delete %d bindings, deleted %d", len(ids), result.RowsAffected)
+			}
+			if err := tx.Where("binding_id IN ?", ids).Delete(&domain.Condition{}).Error; err != nil {
+				return err
+			}
+			if err := reindexGrants(tx, "id IN ?", ids); err != nil {
+				return err
+			}
+		}
+
+		return tx.Omit(clause.Associations).Save(policy).Error
+	})
+}
+
+// RemoveMember removes member from every binding of the policies in a single transaction,
+// deleting the bindings left without members with their conditions, and bumps the version of
+// each changed policy once. Only exact members are removed; domain members are kept. updatedBy is
+// recorded as the latest editor of the changed bindings and policies.
+func (r *bindingRepository) RemoveMember(member string, policyIDs []uuid.UUID, updatedBy string) ([]MemberRemoval, error) {
+	var removals []MemberRemoval
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		removals = nil
+		var bindings []domain.Binding
+		if err := tx.Where("policy_id IN ?", policyIDs).Where(jsonArrayContains(tx, "members", member)).
+			Order("policy_id, created_at, id").Find(&bindings).Error; err != nil {
+			return err
+		}
+		if len(bindings) == 0 {
+			return nil
+		}
+
+		var deleted []uuid.UUID
+		changed := make([]uuid.UUID, 0, len(bindings))
+		policies := make(map[uuid.UUID]bool)
+		for _, binding := range bindings {
+			members, err := binding.GetMembers()
+			if err != nil {
+				return fmt.Errorf("invalid members of binding %s: %w", binding.ID, err)
+			}
+			kept := slices.DeleteFunc(members, func(m string) bool { return m == member })
+
+			removal := MemberRemoval{PolicyID: binding.PolicyID, BindingID: binding.ID, RoleID: binding.RoleID}
+			if len(kept) == 0 {
+				removal.Deleted = true
+				deleted = append(deleted, binding.ID)
+			} else {
+				membersJSON, err := json.Marshal(kept)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&domain.Binding{}).Where("id = ?", binding.ID).
+					Updates(map[string]interface{}{"members": datatypes.JSON(membersJSON), "updated_by": updatedBy}).Error; err != nil {
+					return err
+				}
+			}
+			removals = append(removals, removal)
+			changed = append(changed, binding.ID)
+			policies[binding.PolicyID] = true
+		}
+
+		if len(deleted) > 0 {
+			if err := tx.Where("id IN ?", deleted).Delete(&domain.Binding{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("binding_id IN ?", deleted).Delete(&domain.Condition{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := reindexGrants(tx, "id IN ?", changed); err != nil {
+			return err
+		}
+
+		var changedPolicies []domain.Policy
+		if err := tx.Where("id IN ?", slices.Collect(maps.Keys(policies))).Find(&changedPolicies).Error; err != nil {
+			return err
+		}
+		for i := range changedPolicies {
+			changedPolicies[i].UpdatedBy = updatedBy
+			if err := tx.Omit(clause.Associations).Save(&changedPolicies[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removals, nil
+}
+
+// Search returns the bindings matching query with their role, condition and policy, oldest
+// first, with the total number of matches
+func (r *bindingRepository) Search(search BindingSearch, limit, offset int) ([]domain.Binding, int64, error) {
+	query := r.reader.Model(&domain.Binding{}).
+		Joins("JOIN policies ON policies.id = bindings.policy_id AND policies.deleted_at IS NULL").
+		Joins("JOIN resources ON resources.id = policies.resource_id AND resources.deleted_at IS NULL")
+
+	if search.Member != "" {
+		query = query.Where(jsonArrayElementLike(query, "bindings.members"), containsPattern(search.Member))
+	}
+	if search.Role != "" {
+		query = query.Joins("JOIN roles ON roles.id = bindings.role_id").Where("roles.name = ?", search.Role)
+	}
+	if search.ResourceID != uuid.Nil {
+		query = query.Where("resources.path LIKE (SELECT path FROM resources AS root WHERE root.id = ? AND root.deleted_at IS NULL) || '%'",
+			search.ResourceID)
+	}
+	if search.Condition != "" {
+		pattern := containsPattern(search.Condition)
+		query = query.Joins("JOIN conditions ON conditions.binding_id = bindings.id AND conditions.deleted_at IS NULL").
+			Where(ilike(query, "conditions.title")+" OR "+ilike(query, "conditions.expression"), pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	var bindings []domain.Binding
+	query = query.Preload("Policy").Preload("Role").Preload("Role.Permissions").Preload("Condition")
+	err := byCreation(query, "bindings").Find(&bindings).Error
+	return bindings, total, err
+}
+
+// PurgeDeleted hard-deletes bindings deleted before the given time with their conditions, and
+// conditions deleted on their own before then. It returns the number of purged bindings.
+func (r *bindingRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("deleted_at < ?", before).Delete(&domain.Condition{}).Error; err != nil {
+			return fmt.Errorf("failed to purge conditions: %w", err)
+		}
+		err := tx.Exec("DELETE FROM conditions WHERE binding_id IN (SELECT id FROM bindings WHERE deleted_at < ?)", before).Error
+		if err != nil {
+			return fmt.Errorf("failed to purge conditions: %w", err)
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", before).Delete(&domain.Binding{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// containsPattern is a LIKE pattern matching s anywhere, with LIKE wildcards in s escaped
+func containsPattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// CheckMembersIndex returns ErrMembersIndexMissing when the bindings table of a Postgres database
+// has no GIN index on members, which the containment queries of ListByPrincipal and
+// GetByPolicyAndPrincipal need to avoid scanning every binding. The index is created by the
+// versioned migrations; databases created by AutoMigrate before it existed lack it. SQLite
+// databases always scan and are not checked.
+func CheckMembersIndex(db *gorm.DB) error {
+	if isSQLite(db) {
+		return nil
+	}
+	var indexes int64
+	err := db.Raw(`SELECT count(*) FROM pg_indexes WHERE schemaname = current_schema() AND tablename = 'bindings' AND indexdef LIKE '%USING gin (members%'`).
+		Scan(&indexes).Error
+	if err != nil {
+		return err
+	}
+	if indexes == 0 {
+		return ErrMembersIndexMissing
+	}
+	return nil
+}
+
+// memberCondition matches bindings whose members contain one of the principals or, for users,
+// their domain. On Postgres each member is a containment test (members @> '["user:..."]') that
+// reads the GIN index on members, the tests of several members being combined with a bitmap OR;
+// SQLite scans the bindings.
+func memberCondition(db *gorm.DB, principals ...string) *gorm.DB {
+	members := make([]string, 0, 2*len(principals))
+	for _, principal := range principals {
+		members = append(members, principal)
+		if domainMember := domain.DomainPrincipal(principal); domainMember != "" && !slices.Contains(members, domainMember) {
+			members = append(members, domainMember)
+		}
+	}
+
+	cond := db.Where(jsonArrayContains(db, "members", members[0]))
+	for _, member := range members[1:] {
+		cond = cond.Or(jsonArrayContains(db, "members", member))
+	}
+	return cond
+}
+
+// memberJSON encodes a single-member JSON array for containment (@>) queries
+func memberJSON(member string) string {
+	data, _ := json.Marshal([]string{member})
+	return string(data)
+}
@@ -1,12 +1,14 @@
 package repository
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestBindingRepository_Create(t *testing.T) {
@@ -279,6 +281,173 @@ func TestBindingRepository_ListByPrincipal(t *testing.T) {
 	assert.Empty(t, retrieved)
 }
 
+func TestBindingRepository_ListByRole(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	project := &domain.Resource{Type: "project", Name: "proj"}
+	bucket := &domain.Resource{Type: "bucket", Name: "bucket"}
+	require.NoError(t, resourceRepo.Create(project))
+	require.NoError(t, resourceRepo.Create(bucket))
+	projectPolicy := &domain.Policy{ResourceID: project.ID}
+	bucketPolicy := &domain.Policy{ResourceID: bucket.ID}
+	require.NoError(t, policyRepo.Create(projectPolicy))
+	require.NoError(t, policyRepo.Create(bucketPolicy))
+
+	viewer := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	editor := &domain.Role{Name: "roles/editor", Title: "Editor"}
+	require.NoError(t, roleRepo.Create(viewer))
+	require.NoError(t, roleRepo.Create(editor))
+
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: projectPolicy.ID, RoleID: viewer.ID, Members: []byte(`["user:alice@example.com"]`),
+	}))
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: bucketPolicy.ID, RoleID: viewer.ID, Members: []byte(`["group:eng@example.com"]`),
+	}))
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: bucketPolicy.ID, RoleID: editor.ID, Members: []byte(`["user:bob@example.com"]`),
+	}))
+
+	bindings, err := bindingRepo.ListByRole(viewer.ID)
+	require.NoError(t, err)
+	require.Len(t, bindings, 2)
+	for _, binding := range bindings {
+		assert.Equal(t, viewer.ID, binding.RoleID)
+		require.NotNil(t, binding.Policy)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{project.ID, bucket.ID},
+		[]uuid.UUID{bindings[0].Policy.ResourceID, bindings[1].Policy.ResourceID})
+
+	bindings, err = bindingRepo.ListByRole(uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, bindings)
+}
+
+func TestBindingRepository_RoleUsage(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	project := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(project))
+	policy := &domain.Policy{ResourceID: project.ID}
+	require.NoError(t, policyRepo.Create(policy))
+
+	viewer := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	editor := &domain.Role{Name: "roles/editor", Title: "Editor"}
+	unused := &domain.Role{Name: "roles/unused", Title: "Unused"}
+	require.NoError(t, roleRepo.Create(viewer))
+	require.NoError(t, roleRepo.Create(editor))
+	require.NoError(t, roleRepo.Create(unused))
+
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: policy.ID, RoleID: viewer.ID, Members: []byte(`["user:alice@example.com", "group:eng@example.com"]`),
+	}))
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: policy.ID, RoleID: viewer.ID, Members: []byte(`["user:alice@example.com"]`),
+	}))
+	require.NoError(t, bindingRepo.Create(&domain.Binding{
+		PolicyID: policy.ID, RoleID: editor.ID, Members: []byte(`["user:bob@example.com"]`),
+	}))
+
+	usage, err := bindingRepo.RoleUsage([]uuid.UUID{viewer.ID, unused.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []RoleBindingUsage{{RoleID: viewer.ID, Bindings: 2, Principals: 2}}, usage)
+
+	usage, err = bindingRepo.RoleUsage(nil)
+	require.NoError(t, err)
+	assert.Empty(t, usage)
+}
+
+func TestBindingRepository_ListByPrincipal_Domain(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID}
+	require.NoError(t, policyRepo.Create(policy))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	direct := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	domainWide := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["domain:example.com"]`)}
+	otherDomain := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["domain:other.com"]`)}
+	require.NoError(t, bindingRepo.Create(direct))
+	require.NoError(t, bindingRepo.Create(domainWide))
+	require.NoError(t, bindingRepo.Create(otherDomain))
+
+	// Alice gets her direct binding and the example.com domain binding
+	retrieved, err := bindingRepo.ListByPrincipal("user:alice@example.com", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+
+	// Any other example.com user gets the domain binding
+	retrieved, err = bindingRepo.ListByPrincipal("user:bob@Example.com", 0, 0)
+	assert.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, domainWide.ID, retrieved[0].ID)
+
+	// Domain bindings only apply to users
+	retrieved, err = bindingRepo.ListByPrincipal("group:admins@example.com", 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, retrieved)
+
+	// Scoped to a policy
+	retrieved, err = bindingRepo.GetByPolicyAndPrincipal(policy.ID, "user:carol@other.com")
+	assert.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, otherDomain.ID, retrieved[0].ID)
+}
+
+func TestBindingRepository_ListByPrincipal_Aliases(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	aliasRepo := NewPrincipalAliasRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID}
+	require.NoError(t, policyRepo.Create(policy))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	before := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	after := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["domain:corp.example.com"]`)}
+	require.NoError(t, bindingRepo.Create(before))
+	require.NoError(t, bindingRepo.Create(after))
+
+	retrieved, err := bindingRepo.ListByPrincipal("user:alice@corp.example.com", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, retrieved, 1)
+
+	// Once linked, each identity gets the bindings of the other, including its domain's
+	require.NoError(t, aliasRepo.Create(&domain.PrincipalAlias{Alias: "user:alice@example.com", Principal: "user:alice@corp.example.com"}))
+	retrieved, err = bindingRepo.ListByPrincipal("user:alice@corp.example.com", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+
+	retrieved, err = bindingRepo.ListByPrincipal("user:alice@example.com", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+}
+
 func TestBindingRepository_ListByPrincipal_WithPagination(t *testing.T) {
 	db := setupTestDB(t)
 	bindingRepo := NewBindingRepository(db)
@@ -428,3 +597,300 @@ func TestBindingRepository_Create_WithCondition(t *testing.T) {
 	assert.Equal(t, "Test Condition", retrieved.Condition.Title)
 	assert.Equal(t, "Only during business hours", retrieved.Condition.Description)
 }
+
+func TestBindingRepository_CreateBatch(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	// Create dependencies
+	resource := &domain.Resource{Type: "project", Name: "batch"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+	originalETag := policy.ETag
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	bindings := []domain.Binding{
+		{RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)},
+		{RoleID: role.ID, Members: []byte(`["user:bob@example.com"]`)},
+		{RoleID: role.ID, Members: []byte(`["group:devs@example.com"]`)},
+	}
+
+	err := bindingRepo.CreateBatch(policy, bindings)
+	assert.NoError(t, err)
+
+	// Verify all bindings were created on the policy
+	retrieved, err := bindingRepo.ListByResourceID(resource.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved, 3)
+
+	// Verify the policy version was bumped exactly once
+	updated, err := policyRepo.GetByID(policy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.NotEqual(t, originalETag, updated.ETag)
+}
+
+func TestBindingRepository_DeleteBatch(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	// Create dependencies
+	resource := &domain.Resource{Type: "project", Name: "batch"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	b1 := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	b2 := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:bob@example.com"]`)}
+	b3 := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:charlie@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(b1))
+	require.NoError(t, bindingRepo.Create(b2))
+	require.NoError(t, bindingRepo.Create(b3))
+
+	err := bindingRepo.DeleteBatch(policy, []uuid.UUID{b1.ID, b2.ID})
+	assert.NoError(t, err)
+
+	// Verify only the untouched binding remains
+	remaining, err := bindingRepo.ListByResourceID(resource.ID, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, b3.ID, remaining[0].ID)
+
+	updated, err := policyRepo.GetByID(policy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+}
+
+func TestBindingRepository_DeleteBatch_RollsBackOnUnknownBinding(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	// Create dependencies
+	resource := &domain.Resource{Type: "project", Name: "batch"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	binding := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(binding))
+
+	err := bindingRepo.DeleteBatch(policy, []uuid.UUID{binding.ID, uuid.New()})
+	assert.Error(t, err)
+
+	// Verify nothing was deleted
+	retrieved, err := bindingRepo.GetByID(binding.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, retrieved)
+}
+
+func TestBindingRepository_RemoveMember(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	conditionRepo := NewConditionRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "offboarding"}
+	require.NoError(t, resourceRepo.Create(resource))
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+	otherResource := &domain.Resource{Type: "project", Name: "other"}
+	require.NoError(t, resourceRepo.Create(otherResource))
+	other := &domain.Policy{ResourceID: otherResource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(other))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	shared := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com", "user:bob@example.com"]`)}
+	alone := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	domainWide := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["domain:example.com"]`)}
+	elsewhere := &domain.Binding{PolicyID: other.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	for _, binding := range []*domain.Binding{shared, alone, domainWide, elsewhere} {
+		require.NoError(t, bindingRepo.Create(binding))
+	}
+	condition := &domain.Condition{BindingID: alone.ID, Title: "weekdays", Expression: `resource.type == "project"`}
+	require.NoError(t, conditionRepo.Create(condition))
+
+	removals, err := bindingRepo.RemoveMember("user:alice@example.com", []uuid.UUID{policy.ID}, "user:admin@example.com")
+	require.NoError(t, err)
+	require.Len(t, removals, 2)
+	byBinding := map[uuid.UUID]MemberRemoval{}
+	for _, removal := range removals {
+		byBinding[removal.BindingID] = removal
+	}
+	assert.False(t, byBinding[shared.ID].Deleted)
+	assert.True(t, byBinding[alone.ID].Deleted)
+
+	// Bob keeps the shared binding, and the binding left without members is gone with its condition
+	kept, err := bindingRepo.GetByID(shared.ID)
+	require.NoError(t, err)
+	members, err := kept.GetMembers()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:bob@example.com"}, members)
+	assert.Equal(t, "user:admin@example.com", kept.UpdatedBy)
+	deleted, err := bindingRepo.GetByID(alone.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+	deletedCondition, err := conditionRepo.GetByBindingID(alone.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deletedCondition)
+
+	// The domain binding and other policies are untouched
+	retrieved, err := bindingRepo.ListByPrincipal("user:alice@example.com", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+
+	updated, err := policyRepo.GetByID(policy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	assert.Equal(t, "user:admin@example.com", updated.UpdatedBy)
+	untouched, err := policyRepo.GetByID(other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, untouched.Version)
+
+	removals, err = bindingRepo.RemoveMember("user:alice@example.com", []uuid.UUID{policy.ID}, "user:admin@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, removals)
+}
+
+func TestBindingRepository_Search(t *testing.T) {
+	db := setupTestDB(t)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	// org -> project, plus an unrelated project
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, resourceRepo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "proj", ParentID: &org.ID}
+	require.NoError(t, resourceRepo.Create(project))
+	other := &domain.Resource{Type: "project", Name: "other"}
+	require.NoError(t, resourceRepo.Create(other))
+
+	viewer := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(viewer))
+	editor := &domain.Role{Name: "roles/editor", Title: "Editor"}
+	require.NoError(t, roleRepo.Create(editor))
+
+	bind := func(resource *domain.Resource, role *domain.Role, members string) *domain.Binding {
+		policy, err := policyRepo.GetByResourceID(resource.ID)
+		require.NoError(t, err)
+		if policy == nil {
+			policy = &domain.Policy{ResourceID: resource.ID}
+			require.NoError(t, policyRepo.Create(policy))
+		}
+		binding := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(members)}
+		require.NoError(t, bindingRepo.Create(binding))
+		return binding
+	}
+	orgViewers := bind(org, viewer, `["user:alice@example.com", "group:ops"]`)
+	projectEditors := bind(project, editor, `["user:bob@example.com"]`)
+	otherViewers := bind(other, viewer, `["user:carol@partner.io"]`)
+	require.NoError(t, db.Create(&domain.Condition{
+		BindingID:  projectEditors.ID,
+		Title:      "Business hours",
+		Expression: "request.time.hour >= 9",
+	}).Error)
+
+	ids := func(bindings []domain.Binding) []uuid.UUID {
+		result := make([]uuid.UUID, len(bindings))
+		for i, b := range bindings {
+			result[i] = b.ID
+		}
+		return result
+	}
+
+	// Member substrings are case-insensitive
+	bindings, total, err := bindingRepo.Search(BindingSearch{Member: "@EXAMPLE.com"}, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, []uuid.UUID{orgViewers.ID, projectEditors.ID}, ids(bindings))
+	require.NotNil(t, bindings[1].Policy)
+	assert.Equal(t, project.ID, bindings[1].Policy.ResourceID)
+
+	// LIKE wildcards are matched literally
+	_, total, err = bindingRepo.Search(BindingSearch{Member: "%"}, 0, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	bindings, _, err = bindingRepo.Search(BindingSearch{Role: "roles/viewer"}, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{orgViewers.ID, otherViewers.ID}, ids(bindings))
+
+	// A resource matches its own bindings and those of its descendants
+	bindings, _, err = bindingRepo.Search(BindingSearch{ResourceID: org.ID}, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{orgViewers.ID, projectEditors.ID}, ids(bindings))
+
+	bindings, _, err = bindingRepo.Search(BindingSearch{Condition: "request.time"}, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{projectEditors.ID}, ids(bindings))
+	require.NotNil(t, bindings[0].Condition)
+
+	// Criteria are combined
+	_, total, err = bindingRepo.Search(BindingSearch{Role: "roles/viewer", ResourceID: project.ID}, 0, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	// Pagination keeps the total of all matches
+	bindings, total, err = bindingRepo.Search(BindingSearch{Member: ":"}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []uuid.UUID{projectEditors.ID}, ids(bindings))
+}
+
+func TestCheckMembersIndex(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, CheckMembersIndex(db))
+	if isSQLite(db) {
+		return
+	}
+
+	require.NoError(t, db.Exec("DROP INDEX idx_bindings_members").Error)
+	assert.ErrorIs(t, CheckMembersIndex(db), ErrMembersIndexMissing)
+}
+
+// TestBindingRepository_ListByPrincipal_QueryPlan checks with EXPLAIN that the member containment
+// conditions read the GIN index on members; sequential scans are disabled since the table is small
+func TestBindingRepository_ListByPrincipal_QueryPlan(t *testing.T) {
+	db := setupTestDB(t)
+	if isSQLite(db) {
+		t.Skip("SQLite has no index on JSON array elements")
+	}
+
+	var plan []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL enable_seqscan = off").Error; err != nil {
+			return err
+		}
+		query := tx.Session(&gorm.Session{DryRun: true}).Model(&domain.Binding{}).
+			Where(memberCondition(tx, "user:alice@example.com", "group:admins")).Find(&[]domain.Binding{})
+		return tx.Raw("EXPLAIN "+query.Statement.SQL.String(), query.Statement.Vars...).Scan(&plan).Error
+	})
+	require.NoError(t, err)
+	assert.Contains(t, strings.Join(plan, "\n"), "idx_bindings_members")
+}
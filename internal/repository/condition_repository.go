@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// ConditionRepository handles binding condition data operations
+type ConditionRepository interface {
+	Create(condition *domain.Condition) error
+	GetByBindingID(bindingID uuid.UUID) (*domain.Condition, error)
+	Update(condition *domain.Condition) error
+	Delete(id uuid.UUID) error
+}
+
+type conditionRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewConditionRepository creates a new condition repository
+func NewConditionRepository(db *gorm.DB, opts ...Option) ConditionRepository {
+	o := applyOptions(db, opts)
+	return &conditionRepository{db: db, reader: o.reader}
+}
+
+func (r *conditionRepository) Create(condition *domain.Condition) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(condition).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "id = ?", condition.BindingID)
+	})
+}
+
+func (r *conditionRepository) GetByBindingID(bindingID uuid.UUID) (*domain.Condition, error) {
+	var condition domain.Condition
+	err := r.reader.Where("binding_id = ?", bindingID).First(&condition).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &condition, nil
+}
+
+func (r *conditionRepository) Update(condition *domain.Condition) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(condition).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "id = ?", condition.BindingID)
+	})
+}
+
+func (r *conditionRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.Condition{}, id).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "id IN (SELECT binding_id FROM conditions WHERE id = ?)", id)
+	})
+}
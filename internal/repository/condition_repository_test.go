@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewConditionRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	roleRepo := NewRoleRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "conditions"}
+	require.NoError(t, resourceRepo.Create(resource))
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	binding := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(binding))
+
+	condition := &domain.Condition{
+		BindingID:  binding.ID,
+		Title:      "Business hours",
+		Expression: "request.time.getHours() >= 9",
+	}
+	require.NoError(t, repo.Create(condition))
+	assert.NotEqual(t, uuid.Nil, condition.ID)
+
+	retrieved, err := repo.GetByBindingID(binding.ID)
+	assert.NoError(t, err)
+	require.NotNil(t, retrieved)
+	assert.Equal(t, "Business hours", retrieved.Title)
+
+	// Bindings preload their condition
+	loaded, err := bindingRepo.GetByID(binding.ID)
+	assert.NoError(t, err)
+	require.NotNil(t, loaded.Condition)
+	assert.Equal(t, condition.ID, loaded.Condition.ID)
+
+	retrieved.Expression = "request.time.getHours() >= 8"
+	require.NoError(t, repo.Update(retrieved))
+	updated, err := repo.GetByBindingID(binding.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "request.time.getHours() >= 8", updated.Expression)
+
+	require.NoError(t, repo.Delete(condition.ID))
+	deleted, err := repo.GetByBindingID(binding.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, deleted)
+}
+
+func TestConditionRepository_GetByBindingID_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewConditionRepository(db)
+
+	condition, err := repo.GetByBindingID(uuid.New())
+	assert.NoError(t, err)
+	assert.Nil(t, condition)
+}
+
+func TestBindingRepository_DeleteBatch_DeletesConditions(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewConditionRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	roleRepo := NewRoleRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "conditions"}
+	require.NoError(t, resourceRepo.Create(resource))
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	bindings := []domain.Binding{{
+		RoleID:    role.ID,
+		Members:   []byte(`["user:alice@example.com"]`),
+		Condition: &domain.Condition{Title: "Prod only", Expression: `context.env == "prod"`},
+	}}
+	require.NoError(t, bindingRepo.CreateBatch(policy, bindings))
+
+	created, err := repo.GetByBindingID(bindings[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, created)
+
+	require.NoError(t, bindingRepo.DeleteBatch(policy, []uuid.UUID{bindings[0].ID}))
+
+	deleted, err := repo.GetByBindingID(bindings[0].ID)
+	assert.NoError(t, err)
+	assert.Nil(t, deleted)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// DecisionLogRepository stores the permission check decision log
+type DecisionLogRepository interface {
+	CreateBatch(entries []domain.DecisionLog) error
+	List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.DecisionLog, error)
+	PermissionUsage(since time.Time) ([]PermissionUsage, error)
+	RoleUsage(roles []string) ([]RoleGrantUsage, error)
+}
+
+// PermissionUsage summarizes the allowed checks of one permission by one principal on one resource
+type PermissionUsage struct {
+	Principal    string
+	ResourceID   uuid.UUID
+	ResourcePath string // Materialized path of the resource; empty for resources created before paths existed
+	Permission   string
+	Count        int64
+	LastUsedAt   time.Time
+}
+
+// RoleGrantUsage summarizes the allowed checks granted by one role
+type RoleGrantUsage struct {
+	Role       string
+	Count      int64
+	LastUsedAt time.Time
+}
+
+type decisionLogRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewDecisionLogRepository creates a new decision log repository
+func NewDecisionLogRepository(db *gorm.DB, opts ...Option) DecisionLogRepository {
+	o := applyOptions(db, opts)
+	return &decisionLogRepository{db: db, reader: o.reader}
+}
+
+func (r *decisionLogRepository) CreateBatch(entries []domain.DecisionLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db.Create(&entries).Error
+}
+
+// List returns decisions newest first, optionally filtered by principal and resource
+func (r *decisionLogRepository) List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.DecisionLog, error) {
+	var entries []domain.DecisionLog
+	query := r.reader.Model(&domain.DecisionLog{}).Order("created_at DESC")
+
+	if principal != "" {
+		query = query.Where("principal = ?", principal)
+	}
+
+	if resourceID != nil {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&entries).Error
+	return entries, err
+}
+
+// PermissionUsage aggregates the allowed decisions recorded since the given time
+func (r *decisionLogRepository) PermissionUsage(since time.Time) ([]PermissionUsage, error) {
+	var rows []struct {
+		PermissionUsage
+		LastUsedAt scannedTime
+	}
+	err := r.reader.Model(&domain.DecisionLog{}).
+		Select("decision_logs.principal, decision_logs.resource_id, COALESCE(resources.path, '') AS resource_path, "+
+			"decision_logs.permission, COUNT(*) AS count, MAX(decision_logs.created_at) AS last_used_at").
+		Joins("LEFT JOIN resources ON resources.id = decision_logs.resource_id").
+		Where("decision_logs.allowed AND decision_logs.created_at >= ?", since).
+		Group("decision_logs.principal, decision_logs.resource_id, resources.path, decision_logs.permission").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]PermissionUsage, len(rows))
+	for i, row := range rows {
+		usage[i] = row.PermissionUsage
+		usage[i].LastUsedAt = row.LastUsedAt.Time
+	}
+	return usage, nil
+}
+
+// RoleUsage aggregates the recorded checks granted by each of the named roles; roles that never
+// granted a recorded check are omitted
+func (r *decisionLogRepository) RoleUsage(roles []string) ([]RoleGrantUsage, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	var rows []struct {
+		RoleGrantUsage
+		LastUsedAt scannedTime
+	}
+	err := r.reader.Model(&domain.DecisionLog{}).
+		Select("role, COUNT(*) AS count, MAX(created_at) AS last_used_at").
+		Where("allowed AND role IN ?", roles).
+		Group("role").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]RoleGrantUsage, len(rows))
+	for i, row := range rows {
+		usage[i] = row.RoleGrantUsage
+		usage[i].LastUsedAt = row.LastUsedAt.Time
+	}
+	return usage, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionLogRepository_CreateBatchAndList(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewDecisionLogRepository(db)
+
+	resourceID := uuid.New()
+	entries := []domain.DecisionLog{
+		{Principal: "user:alice@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true, LatencyUS: 120},
+		{Principal: "user:bob@example.com", ResourceID: resourceID, Permission: "storage.buckets.delete", Allowed: false, LatencyUS: 80},
+		{Principal: "user:alice@example.com", ResourceID: uuid.New(), Permission: "storage.buckets.get", Allowed: false, LatencyUS: 95},
+	}
+	require.NoError(t, repo.CreateBatch(entries))
+	require.NoError(t, repo.CreateBatch(nil))
+
+	all, err := repo.List("", nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	byPrincipal, err := repo.List("user:alice@example.com", nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, byPrincipal, 2)
+
+	byBoth, err := repo.List("user:alice@example.com", &resourceID, 0, 0)
+	assert.NoError(t, err)
+	require.Len(t, byBoth, 1)
+	assert.True(t, byBoth[0].Allowed)
+
+	page, err := repo.List("", nil, 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+}
+
+func TestDecisionLogRepository_PermissionUsage(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewDecisionLogRepository(db)
+
+	resourceID := uuid.New()
+	require.NoError(t, repo.CreateBatch([]domain.DecisionLog{
+		{Principal: "user:alice@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true},
+		{Principal: "user:alice@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true},
+		{Principal: "user:alice@example.com", ResourceID: resourceID, Permission: "storage.buckets.delete", Allowed: false},
+		{Principal: "user:bob@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true},
+	}))
+
+	usage, err := repo.PermissionUsage(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	for _, u := range usage {
+		assert.Equal(t, "storage.buckets.get", u.Permission)
+		assert.Equal(t, resourceID, u.ResourceID)
+		if u.Principal == "user:alice@example.com" {
+			assert.Equal(t, int64(2), u.Count)
+		}
+	}
+
+	usage, err = repo.PermissionUsage(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, usage)
+}
+
+func TestDecisionLogRepository_RoleUsage(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewDecisionLogRepository(db)
+
+	resourceID := uuid.New()
+	earlier := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	latest := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repo.CreateBatch([]domain.DecisionLog{
+		{Principal: "user:alice@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true, Role: "roles/viewer", CreatedAt: earlier},
+		{Principal: "user:bob@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true, Role: "roles/viewer", CreatedAt: latest},
+		{Principal: "user:carol@example.com", ResourceID: resourceID, Permission: "storage.buckets.get", Allowed: true, Role: "roles/editor", CreatedAt: latest},
+		{Principal: "user:dave@example.com", ResourceID: resourceID, Permission: "storage.buckets.delete", Allowed: false, CreatedAt: latest},
+	}))
+
+	usage, err := repo.RoleUsage([]string{"roles/viewer", "roles/owner"})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, "roles/viewer", usage[0].Role)
+	assert.Equal(t, int64(2), usage[0].Count)
+	assert.True(t, latest.Equal(usage[0].LastUsedAt), "last used at %v, want %v", usage[0].LastUsedAt, latest)
+}
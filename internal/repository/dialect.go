@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The helpers below build the conditions Postgres expresses with JSONB operators and ILIKE,
+// so the repositories also run on the embedded SQLite database (database.driver: sqlite).
+
+// isSQLite reports whether db is an embedded SQLite database
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// jsonArrayContains returns a condition and its argument matching rows whose JSON array
+// column contains value
+func jsonArrayContains(db *gorm.DB, column, value string) (string, interface{}) {
+	if isSQLite(db) {
+		return "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE json_each.value = ?)", value
+	}
+	return column + " @> ?", memberJSON(value)
+}
+
+// jsonArrayElementLike returns a condition matching rows with an element of the JSON array
+// column that matches a containsPattern, ignoring case
+func jsonArrayElementLike(db *gorm.DB, column string) string {
+	if isSQLite(db) {
+		return "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE json_each.value LIKE ? ESCAPE '\\')"
+	}
+	return "EXISTS (SELECT 1 FROM jsonb_array_elements_text(" + column + ") AS member WHERE member ILIKE ?)"
+}
+
+// ilike returns a condition matching column against a containsPattern, ignoring case
+func ilike(db *gorm.DB, column string) string {
+	if isSQLite(db) {
+		// LIKE ignores the case of ASCII letters in SQLite
+		return column + " LIKE ? ESCAPE '\\'"
+	}
+	return column + " ILIKE ?"
+}
+
+// jsonObjectContains restricts query to rows whose JSON object column holds every key/value of object
+func jsonObjectContains(query *gorm.DB, column string, object map[string]interface{}) *gorm.DB {
+	if !isSQLite(query) {
+		return query.Where(column+" @> ?", datatypes.JSONMap(object))
+	}
+	for key, value := range object {
+		data, _ := json.Marshal(value)
+		query = query.Where("EXISTS (SELECT 1 FROM json_each("+column+") WHERE json_each.key = ? AND json_each.value IS json_extract(?, '$'))",
+			key, string(data))
+	}
+	return query
+}
+
+// snapshotTxOptions returns the options of read-only transactions whose queries must all see the
+// same state of the database; SQLite transactions are serializable already
+func snapshotTxOptions(db *gorm.DB) *sql.TxOptions {
+	if isSQLite(db) {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+}
+
+// forUpdate locks the rows query reads until the end of its transaction; SQLite transactions are
+// serializable already
+func forUpdate(query *gorm.DB) *gorm.DB {
+	if isSQLite(query) {
+		return query
+	}
+	return query.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// greatest returns the largest of the columns, ignoring NULLs like Postgres' GREATEST. The
+// first column must not be NULL; SQLite's MAX is NULL when any argument is.
+func greatest(db *gorm.DB, columns ...string) string {
+	if !isSQLite(db) {
+		return "GREATEST(" + strings.Join(columns, ", ") + ")"
+	}
+	args := make([]string, len(columns))
+	args[0] = columns[0]
+	for i, column := range columns[1:] {
+		args[i+1] = "COALESCE(" + column + ", " + columns[0] + ")"
+	}
+	return "MAX(" + strings.Join(args, ", ") + ")"
+}
+
+// sqliteTimeLayouts are the formats SQLite returns timestamps computed by expressions in, which
+// lose the column type the driver parses times by
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// scannedTime scans a timestamp computed by an expression, e.g. MAX(created_at)
+type scannedTime struct {
+	time.Time
+}
+
+func (t *scannedTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	case string:
+		for _, layout := range sqliteTimeLayouts {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				t.Time = parsed
+				return nil
+			}
+		}
+		return fmt.Errorf("unsupported timestamp %q", v)
+	default:
+		return fmt.Errorf("unsupported timestamp type %T", value)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, which GORM requires of fields with a custom Scan
+func (t scannedTime) Value() (driver.Value, error) {
+	return t.Time, nil
+}
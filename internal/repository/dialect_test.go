@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// sqliteDialector builds SQL like the SQLite driver without a database
+type sqliteDialector struct {
+	tests.DummyDialector
+}
+
+func (sqliteDialector) Name() string {
+	return "sqlite"
+}
+
+func dryRunDB(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestMemberCondition_Dialects(t *testing.T) {
+	cases := []struct {
+		name      string
+		dialector gorm.Dialector
+		sql       string
+		vars      []interface{}
+	}{
+		{
+			"postgres",
+			tests.DummyDialector{},
+			"(members @> ? OR members @> ?)",
+			[]interface{}{`["user:alice@example.com"]`, `["domain:example.com"]`},
+		},
+		{
+			"sqlite",
+			sqliteDialector{},
+			"(EXISTS (SELECT 1 FROM json_each(members) WHERE json_each.value = ?) OR EXISTS (SELECT 1 FROM json_each(members) WHERE json_each.value = ?))",
+			[]interface{}{"user:alice@example.com", "domain:example.com"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t, tt.dialector)
+			var bindings []domain.Binding
+			stmt := db.Where(memberCondition(db, "user:alice@example.com")).Find(&bindings).Statement
+			assert.Contains(t, stmt.SQL.String(), tt.sql)
+			assert.Equal(t, tt.vars, stmt.Vars)
+		})
+	}
+}
+
+func TestJSONObjectContains_Dialects(t *testing.T) {
+	var resources []domain.Resource
+
+	db := dryRunDB(t, tests.DummyDialector{})
+	stmt := jsonObjectContains(db.Model(&domain.Resource{}), "attributes", map[string]interface{}{"env": "prod"}).Find(&resources).Statement
+	assert.Contains(t, stmt.SQL.String(), "attributes @> ?")
+
+	db = dryRunDB(t, sqliteDialector{})
+	stmt = jsonObjectContains(db.Model(&domain.Resource{}), "attributes", map[string]interface{}{"env": "prod"}).Find(&resources).Statement
+	assert.Contains(t, stmt.SQL.String(), "EXISTS (SELECT 1 FROM json_each(attributes) WHERE json_each.key = ? AND json_each.value IS json_extract(?, '$'))")
+	assert.Equal(t, []interface{}{"env", `"prod"`}, stmt.Vars)
+}
+
+func TestILike_Dialects(t *testing.T) {
+	assert.Equal(t, "conditions.title ILIKE ?", ilike(dryRunDB(t, tests.DummyDialector{}), "conditions.title"))
+	assert.Equal(t, `conditions.title LIKE ? ESCAPE '\'`, ilike(dryRunDB(t, sqliteDialector{}), "conditions.title"))
+}
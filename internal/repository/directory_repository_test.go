@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewUserRepository(db)
+
+	alice := &domain.User{UserName: "alice@example.com", ExternalID: "00u1", Active: true}
+	bob := &domain.User{UserName: "bob@example.com", Active: true}
+	require.NoError(t, repo.Create(alice))
+	require.NoError(t, repo.Create(bob))
+
+	got, err := repo.GetByUserName("alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, got.ID)
+
+	users, total, err := repo.List(DirectoryFilter{Attribute: "external_id", Value: "00u1"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice@example.com", users[0].UserName)
+
+	users, total, err = repo.List(DirectoryFilter{}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, users, 1)
+	assert.Equal(t, "bob@example.com", users[0].UserName)
+
+	_, _, err = repo.List(DirectoryFilter{Attribute: "password", Value: "x"}, 10, 0)
+	assert.Error(t, err)
+
+	got.DisplayName = "Alice"
+	require.NoError(t, repo.Update(got))
+	got, err = repo.GetByID(alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", got.DisplayName)
+
+	require.NoError(t, repo.Delete(alice.ID))
+	got, err = repo.GetByID(alice.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestGroupRepository_Members(t *testing.T) {
+	db := setupTestDB(t)
+	users := NewUserRepository(db)
+	groups := NewGroupRepository(db)
+
+	alice := &domain.User{UserName: "alice@example.com", Active: true}
+	bob := &domain.User{UserName: "bob@example.com", Active: true}
+	require.NoError(t, users.Create(alice))
+	require.NoError(t, users.Create(bob))
+
+	engineering := &domain.Group{DisplayName: "engineering"}
+	oncall := &domain.Group{DisplayName: "oncall"}
+	require.NoError(t, groups.Create(engineering))
+	require.NoError(t, groups.Create(oncall))
+
+	require.NoError(t, groups.AddMembers(engineering.ID, []uuid.UUID{alice.ID, bob.ID}))
+	require.NoError(t, groups.AddMembers(engineering.ID, []uuid.UUID{alice.ID})) // already a member
+	require.NoError(t, groups.AddMembers(oncall.ID, []uuid.UUID{alice.ID}))
+
+	got, err := groups.GetByID(engineering.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Members, 2)
+
+	memberOf, err := groups.ListByMember("alice@example.com")
+	require.NoError(t, err)
+	require.Len(t, memberOf, 2)
+	assert.Equal(t, "engineering", memberOf[0].DisplayName)
+
+	// Inactive users keep their memberships but do not inherit group bindings
+	alice.Active = false
+	require.NoError(t, users.Update(alice))
+	memberOf, err = groups.ListByMember("alice@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, memberOf)
+
+	require.NoError(t, groups.RemoveMembers(engineering.ID, []uuid.UUID{bob.ID}))
+	memberOf, err = groups.ListByMember("bob@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, memberOf)
+
+	require.NoError(t, groups.ReplaceMembers(oncall.ID, []uuid.UUID{bob.ID}))
+	got, err = groups.GetByID(oncall.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Members, 1)
+	assert.Equal(t, bob.ID, got.Members[0].ID)
+
+	// Deleting a user or group removes its memberships
+	require.NoError(t, users.Delete(bob.ID))
+	got, err = groups.GetByID(oncall.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Members)
+
+	require.NoError(t, groups.Delete(engineering.ID))
+	got, err = groups.GetByID(engineering.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrHierarchyCycle is returned when a parent change would make a resource its own ancestor
+	ErrHierarchyCycle = errors.New("resource hierarchy cycle")
+	// ErrHierarchyTooDeep is returned when a resource hierarchy would exceed the maximum depth
+	ErrHierarchyTooDeep = errors.New("resource hierarchy too deep")
+	// ErrRoleInUse is returned when deleting a role that bindings still reference
+	ErrRoleInUse = errors.New("role is in use")
+	// ErrAccessRequestResolved is returned when an access request is no longer in the expected
+	// status, e.g. because another approver reviewed it first
+	ErrAccessRequestResolved = errors.New("access request was already resolved")
+	// ErrAccessReviewClosed is returned when deciding on or closing an access review that is closed
+	ErrAccessReviewClosed = errors.New("access review is closed")
+	// ErrETagMismatch is returned when updating a resource or role that changed since it was read
+	ErrETagMismatch = errors.New("etag mismatch")
+	// ErrMembersIndexMissing is returned by CheckMembersIndex when the bindings table has no GIN
+	// index on members
+	ErrMembersIndexMissing = errors.New("bindings members index is missing")
+)
+
+// maxReportedBindings caps the binding IDs listed in a RoleInUseError
+const maxReportedBindings = 100
+
+// HierarchyError describes an invalid resource hierarchy change.
+// It wraps ErrHierarchyCycle or ErrHierarchyTooDeep so callers can use errors.Is.
+type HierarchyError struct {
+	ResourceID uuid.UUID
+	ParentID   uuid.UUID
+	Depth      int // Resulting depth of the deepest affected resource (depth errors only)
+	MaxDepth   int
+	Err        error
+}
+
+func (e *HierarchyError) Error() string {
+	if errors.Is(e.Err, ErrHierarchyTooDeep) {
+		return fmt.Sprintf("%s: setting parent %s on resource %s yields depth %d (max %d)",
+			e.Err, e.ParentID, e.ResourceID, e.Depth, e.MaxDepth)
+	}
+	return fmt.Sprintf("%s: resource %s cannot have parent %s", e.Err, e.ResourceID, e.ParentID)
+}
+
+func (e *HierarchyError) Unwrap() error {
+	return e.Err
+}
+
+// RoleInUseError lists the bindings that prevent a role from being deleted.
+// It wraps ErrRoleInUse so callers can use errors.Is.
+type RoleInUseError struct {
+	RoleID     uuid.UUID
+	BindingIDs []uuid.UUID // Up to 100 referencing bindings
+	Total      int64       // Number of referencing bindings
+}
+
+func (e *RoleInUseError) Error() string {
+	ids := make([]string, len(e.BindingIDs))
+	for i, id := range e.BindingIDs {
+		ids[i] = id.String()
+	}
+	more := ""
+	if e.Total > int64(len(e.BindingIDs)) {
+		more = fmt.Sprintf(" and %d more", e.Total-int64(len(e.BindingIDs)))
+	}
+	return fmt.Sprintf("%s: role %s is referenced by %d binding(s): %s%s",
+		ErrRoleInUse, e.RoleID, e.Total, strings.Join(ids, ", "), more)
+}
+
+func (e *RoleInUseError) Unwrap() error {
+	return ErrRoleInUse
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// EvaluationGrantRepository reads the evaluation read model (see domain.EvaluationGrant). The
+// model is written by the policy, binding, condition, role and permission repositories, in the
+// transaction of each change it derives from.
+type EvaluationGrantRepository interface {
+	// Lookup returns the grants of permission to any of members on any of resourceIDs.
+	// Members are matched by their domain.GrantMember key.
+	Lookup(resourceIDs []uuid.UUID, permission string, members []string) ([]domain.EvaluationGrant, error)
+	// AuthorizedChildren returns a page of the children of parentID, ordered by name and ID, on
+	// which permission may be granted to any of members, either on the child itself or on chain,
+	// the parent followed by its ancestors
+	AuthorizedChildren(parentID uuid.UUID, chain []uuid.UUID, permission string, members []string, limit, offset int) ([]AuthorizedChild, error)
+}
+
+// AuthorizedChild is a child resource returned by AuthorizedChildren
+type AuthorizedChild struct {
+	Resource    domain.Resource
+	Conditional bool // Only conditional grants apply, so the permission still has to be checked
+}
+
+type evaluationGrantRepository struct {
+	reader *gorm.DB
+}
+
+// NewEvaluationGrantRepository creates a new evaluation grant repository
+func NewEvaluationGrantRepository(db *gorm.DB, opts ...Option) EvaluationGrantRepository {
+	o := applyOptions(db, opts)
+	return &evaluationGrantRepository{reader: o.reader}
+}
+
+func (r *evaluationGrantRepository) Lookup(resourceIDs []uuid.UUID, permission string, members []string) ([]domain.EvaluationGrant, error) {
+	if len(resourceIDs) == 0 || len(members) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(members))
+	for i, member := range members {
+		keys[i] = domain.GrantMember(member)
+	}
+
+	var grants []domain.EvaluationGrant
+	err := r.reader.Where("resource_id IN ? AND permission = ? AND member IN ?", resourceIDs, permission, keys).
+		Find(&grants).Error
+	return grants, err
+}
+
+func (r *evaluationGrantRepository) AuthorizedChildren(parentID uuid.UUID, chain []uuid.UUID, permission string, members []string, limit, offset int) ([]AuthorizedChild, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(members))
+	for i, member := range members {
+		keys[i] = domain.GrantMember(member)
+	}
+
+	// A grant on the parent or an ancestor is inherited by every child
+	inherited, err := r.Lookup(chain, permission, members)
+	if err != nil {
+		return nil, err
+	}
+	unconditional := slices.ContainsFunc(inherited, func(grant domain.EvaluationGrant) bool { return !grant.Conditional() })
+
+	query := r.reader.Model(&domain.Resource{}).Preload("Tags").Where("parent_id = ?", parentID)
+	if len(inherited) == 0 {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM evaluation_grants WHERE evaluation_grants.resource_id = resources.id AND evaluation_grants.permission = ? AND evaluation_grants.member IN ?)",
+			permission, keys,
+		)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	var children []domain.Resource
+	if err := query.Order("name, id").Find(&children).Error; err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	// Children are conditional unless an unconditional grant applies to them
+	granted := make(map[uuid.UUID]bool, len(children))
+	if !unconditional {
+		ids := make([]uuid.UUID, len(children))
+		for i := range children {
+			ids[i] = children[i].ID
+		}
+		grants, err := r.Lookup(ids, permission, members)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			if !grant.Conditional() {
+				granted[grant.ResourceID] = true
+			}
+		}
+	}
+	authorized := make([]AuthorizedChild, len(children))
+	for i := range children {
+		authorized[i] = AuthorizedChild{Resource: children[i], Conditional: !unconditional && !granted[children[i].ID]}
+	}
+	return authorized, nil
+}
+
+// grantIndexBatchSize is the number of bindings whose grants are rewritten per statement
+const grantIndexBatchSize = 500
+
+// reindexGrants rewrites the evaluation grants of the bindings matching query, deleted or not, so
+// deleted bindings lose theirs. It runs in the transaction of the write that changed them.
+func reindexGrants(tx *gorm.DB, query string, args ...interface{}) error {
+	var bindingIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&domain.Binding{}).Where(query, args...).Pluck("id", &bindingIDs).Error; err != nil {
+		return fmt.Errorf("failed to reindex grants: %w", err)
+	}
+	for start := 0; start < len(bindingIDs); start += grantIndexBatchSize {
+		end := min(start+grantIndexBatchSize, len(bindingIDs))
+		if err := indexBindings(tx, bindingIDs[start:end]); err != nil {
+			return fmt.Errorf("failed to reindex grants: %w", err)
+		}
+	}
+	return nil
+}
+
+// indexBindings replaces the evaluation grants of the given bindings with those of their current
+// state. Bindings that are deleted, or whose policy or role is deleted, grant nothing.
+func indexBindings(tx *gorm.DB, bindingIDs []uuid.UUID) error {
+	if err := tx.Where("binding_id IN ?", bindingIDs).Delete(&domain.EvaluationGrant{}).Error; err != nil {
+		return err
+	}
+
+	var bindings []domain.Binding
+	err := tx.Preload("Policy").Preload("Role").Preload("Role.Permissions").Preload("Condition").
+		Where("id IN ?", bindingIDs).Find(&bindings).Error
+	if err != nil {
+		return err
+	}
+
+	var grants []domain.EvaluationGrant
+	for i := range bindings {
+		bindingGrants, err := evaluationGrants(&bindings[i])
+		if err != nil {
+			return err
+		}
+		grants = append(grants, bindingGrants...)
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(grants, purgeBatchSize).Error
+}
+
+// evaluationGrants expands a binding loaded with its policy, role, permissions and condition
+func evaluationGrants(binding *domain.Binding) ([]domain.EvaluationGrant, error) {
+	if binding.Policy == nil || binding.Role == nil {
+		return nil, nil
+	}
+	members, err := binding.GetMembers()
+	if err != nil {
+		return nil, fmt.Errorf("invalid members of binding %s: %w", binding.ID, err)
+	}
+
+	var grants []domain.EvaluationGrant
+	seen := make(map[[2]string]bool)
+	for _, member := range members {
+		member = domain.GrantMember(member)
+		for _, permission := range binding.Role.Permissions {
+			key := [2]string{member, permission.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			grant := domain.EvaluationGrant{
+				BindingID:  binding.ID,
+				Member:     member,
+				Permission: permission.Name,
+				ResourceID: binding.Policy.ResourceID,
+				RoleID:     binding.Role.ID,
+				RoleName:   binding.Role.Name,
+			}
+			if binding.Condition != nil {
+				conditionID := binding.Condition.ID
+				grant.ConditionID = &conditionID
+				grant.ConditionExpression = binding.Condition.Expression
+			}
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluationGrantRepository_FollowsWrites(t *testing.T) {
+	db := setupTestDB(t)
+	grantRepo := NewEvaluationGrantRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	conditionRepo := NewConditionRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	resource := &domain.Resource{Type: "bucket", Name: "data"}
+	require.NoError(t, resourceRepo.Create(resource))
+	policy := &domain.Policy{ResourceID: resource.ID}
+	require.NoError(t, policyRepo.Create(policy))
+
+	read := &domain.Permission{Name: "storage.objects.get", Service: "storage"}
+	require.NoError(t, permRepo.Create(read))
+	write := &domain.Permission{Name: "storage.objects.create", Service: "storage"}
+	require.NoError(t, permRepo.Create(write))
+	role := &domain.Role{Name: "roles/storage.reader", Title: "Reader"}
+	require.NoError(t, roleRepo.Create(role))
+	require.NoError(t, roleRepo.AddPermissions(role.ID, []uuid.UUID{read.ID}))
+
+	lookup := func(permission string, members ...string) []domain.EvaluationGrant {
+		grants, err := grantRepo.Lookup([]uuid.UUID{resource.ID}, permission, members)
+		require.NoError(t, err)
+		return grants
+	}
+
+	binding := &domain.Binding{
+		PolicyID: policy.ID,
+		RoleID:   role.ID,
+		Members:  []byte(`["user:alice@example.com", "domain:Example.com"]`),
+	}
+	require.NoError(t, bindingRepo.Create(binding))
+
+	grants := lookup("storage.objects.get", "user:alice@example.com")
+	require.Len(t, grants, 1)
+	assert.Equal(t, "roles/storage.reader", grants[0].RoleName)
+	assert.False(t, grants[0].Conditional())
+	assert.Len(t, lookup("storage.objects.get", "domain:example.com"), 1, "domains are stored lower-cased")
+	assert.Empty(t, lookup("storage.objects.get", "user:bob@other.com"))
+	assert.Empty(t, lookup("storage.objects.create", "user:alice@example.com"))
+
+	// Role permission changes
+	require.NoError(t, roleRepo.AddPermissions(role.ID, []uuid.UUID{write.ID}))
+	assert.Len(t, lookup("storage.objects.create", "user:alice@example.com"), 1)
+	require.NoError(t, roleRepo.RemovePermissions(role.ID, []uuid.UUID{write.ID}))
+	assert.Empty(t, lookup("storage.objects.create", "user:alice@example.com"))
+
+	// Condition changes
+	condition := &domain.Condition{BindingID: binding.ID, Title: "business hours", Expression: "request.time.getHours() < 18"}
+	require.NoError(t, conditionRepo.Create(condition))
+	grants = lookup("storage.objects.get", "user:alice@example.com")
+	require.Len(t, grants, 1)
+	assert.Equal(t, condition.ID, *grants[0].ConditionID)
+	condition.Expression = "request.time.getHours() < 17"
+	require.NoError(t, conditionRepo.Update(condition))
+	assert.Equal(t, "request.time.getHours() < 17", lookup("storage.objects.get", "user:alice@example.com")[0].ConditionExpression)
+	require.NoError(t, conditionRepo.Delete(condition.ID))
+	assert.False(t, lookup("storage.objects.get", "user:alice@example.com")[0].Conditional())
+
+	// A binding created with a condition grants nothing until its condition is saved
+	conditional := &domain.Binding{
+		PolicyID:  policy.ID,
+		RoleID:    role.ID,
+		Members:   []byte(`["user:bob@example.com"]`),
+		Condition: &domain.Condition{Expression: "false"},
+	}
+	require.NoError(t, bindingRepo.Create(conditional))
+	assert.Empty(t, lookup("storage.objects.get", "user:bob@example.com"))
+	require.NoError(t, conditionRepo.Create(&domain.Condition{BindingID: conditional.ID, Expression: "false"}))
+	assert.Len(t, lookup("storage.objects.get", "user:bob@example.com"), 1)
+
+	// Policy deletion and restore
+	require.NoError(t, policyRepo.Delete(policy.ID))
+	assert.Empty(t, lookup("storage.objects.get", "user:alice@example.com"))
+	require.NoError(t, policyRepo.Undelete(policy.ID))
+	assert.Len(t, lookup("storage.objects.get", "user:alice@example.com"), 1)
+
+	// Permission and binding deletion
+	require.NoError(t, permRepo.Delete(read.ID))
+	assert.Empty(t, lookup("storage.objects.get", "user:alice@example.com"))
+	require.NoError(t, roleRepo.AddPermissions(role.ID, []uuid.UUID{write.ID}))
+	require.NoError(t, bindingRepo.Delete(binding.ID))
+	assert.Empty(t, lookup("storage.objects.create", "user:alice@example.com"))
+	assert.Len(t, lookup("storage.objects.create", "user:bob@example.com"), 1)
+
+	// Cascading role deletion
+	_, err := roleRepo.DeleteCascade(role.ID)
+	require.NoError(t, err)
+	assert.Empty(t, lookup("storage.objects.create", "user:bob@example.com"))
+}
+
+func TestEvaluationGrantRepository_AuthorizedChildren(t *testing.T) {
+	db := setupTestDB(t)
+	grantRepo := NewEvaluationGrantRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	conditionRepo := NewConditionRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	read := &domain.Permission{Name: "storage.objects.get", Service: "storage"}
+	require.NoError(t, permRepo.Create(read))
+	role := &domain.Role{Name: "roles/storage.reader", Title: "Reader"}
+	require.NoError(t, roleRepo.Create(role))
+	require.NoError(t, roleRepo.AddPermissions(role.ID, []uuid.UUID{read.ID}))
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, resourceRepo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "project", ParentID: &org.ID}
+	require.NoError(t, resourceRepo.Create(project))
+	buckets := make(map[string]*domain.Resource)
+	for _, name := range []string{"d", "c", "b", "a"} {
+		bucket := &domain.Resource{Type: "bucket", Name: name, ParentID: &project.ID}
+		require.NoError(t, resourceRepo.Create(bucket))
+		buckets[name] = bucket
+	}
+	grant := func(resource *domain.Resource, member, expression string) {
+		policy, err := policyRepo.GetByResourceID(resource.ID)
+		require.NoError(t, err)
+		if policy == nil {
+			policy = &domain.Policy{ResourceID: resource.ID}
+			require.NoError(t, policyRepo.Create(policy))
+		}
+		binding := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["` + member + `"]`)}
+		require.NoError(t, bindingRepo.Create(binding))
+		if expression != "" {
+			require.NoError(t, conditionRepo.Create(&domain.Condition{BindingID: binding.ID, Expression: expression}))
+		}
+	}
+	grant(buckets["a"], "user:alice@example.com", "")
+	grant(buckets["c"], "domain:example.com", "")
+	grant(buckets["d"], "user:alice@example.com", "false")
+
+	chain := []uuid.UUID{project.ID, org.ID}
+	list := func(members []string, limit, offset int) ([]string, []bool) {
+		children, err := grantRepo.AuthorizedChildren(project.ID, chain, "storage.objects.get", members, limit, offset)
+		require.NoError(t, err)
+		var names []string
+		var conditional []bool
+		for _, child := range children {
+			names = append(names, child.Resource.Name)
+			conditional = append(conditional, child.Conditional)
+		}
+		return names, conditional
+	}
+
+	alice := []string{"user:alice@example.com", "domain:example.com"}
+	names, conditional := list(alice, 0, 0)
+	assert.Equal(t, []string{"a", "c", "d"}, names)
+	assert.Equal(t, []bool{false, false, true}, conditional)
+	names, _ = list(alice, 2, 1)
+	assert.Equal(t, []string{"c", "d"}, names)
+	names, _ = list([]string{"user:bob@other.com"}, 0, 0)
+	assert.Empty(t, names)
+
+	// A grant on an ancestor applies to every child, conditionally if its condition must hold
+	grant(org, "user:bob@other.com", "false")
+	names, conditional = list([]string{"user:bob@other.com"}, 0, 0)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names)
+	assert.Equal(t, []bool{true, true, true, true}, conditional)
+	grant(project, "user:bob@other.com", "")
+	_, conditional = list([]string{"user:bob@other.com"}, 0, 0)
+	assert.Equal(t, []bool{false, false, false, false}, conditional)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// GrantConstraintRepository stores the roles delegated administrators may grant
+type GrantConstraintRepository interface {
+	Create(constraint *domain.GrantConstraint) error
+	GetByID(id uuid.UUID) (*domain.GrantConstraint, error)
+	Update(constraint *domain.GrantConstraint) error
+	Delete(id uuid.UUID) error
+	List(resourceID *uuid.UUID, limit, offset int) ([]domain.GrantConstraint, error)
+	ListByResources(resourceIDs []uuid.UUID) ([]domain.GrantConstraint, error)
+}
+
+type grantConstraintRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewGrantConstraintRepository creates a new grant constraint repository
+func NewGrantConstraintRepository(db *gorm.DB, opts ...Option) GrantConstraintRepository {
+	o := applyOptions(db, opts)
+	return &grantConstraintRepository{db: db, reader: o.reader}
+}
+
+func (r *grantConstraintRepository) Create(constraint *domain.GrantConstraint) error {
+	return r.db.Create(constraint).Error
+}
+
+func (r *grantConstraintRepository) GetByID(id uuid.UUID) (*domain.GrantConstraint, error) {
+	var constraint domain.GrantConstraint
+	err := r.reader.First(&constraint, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &constraint, nil
+}
+
+func (r *grantConstraintRepository) Update(constraint *domain.GrantConstraint) error {
+	return r.db.Save(constraint).Error
+}
+
+func (r *grantConstraintRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&domain.GrantConstraint{}, id).Error
+}
+
+// List returns constraints oldest first, optionally only those defined on resourceID
+func (r *grantConstraintRepository) List(resourceID *uuid.UUID, limit, offset int) ([]domain.GrantConstraint, error) {
+	var constraints []domain.GrantConstraint
+	query := r.reader.Model(&domain.GrantConstraint{}).Order("created_at, id")
+
+	if resourceID != nil {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&constraints).Error
+	return constraints, err
+}
+
+// ListByResources returns the constraints defined on any of the resources, e.g. a resource and its ancestors
+func (r *grantConstraintRepository) ListByResources(resourceIDs []uuid.UUID) ([]domain.GrantConstraint, error) {
+	var constraints []domain.GrantConstraint
+	if len(resourceIDs) == 0 {
+		return constraints, nil
+	}
+	// Read from the primary so a new constraint is enforced immediately
+	err := r.db.Where("resource_id IN ?", resourceIDs).Order("created_at, id").Find(&constraints).Error
+	return constraints, err
+}
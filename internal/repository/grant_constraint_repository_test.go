@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantConstraintRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewGrantConstraintRepository(db)
+
+	orgID, projectID := uuid.New(), uuid.New()
+	constraint := &domain.GrantConstraint{
+		ResourceID:   orgID,
+		Members:      []byte(`["user:lead@example.com"]`),
+		AllowedRoles: []byte(`["roles/storage.viewer"]`),
+	}
+	require.NoError(t, repo.Create(constraint))
+	require.NoError(t, repo.Create(&domain.GrantConstraint{
+		ResourceID:   projectID,
+		Members:      []byte(`["user:dev@example.com"]`),
+		AllowedRoles: []byte(`[]`),
+	}))
+	require.NoError(t, repo.Create(&domain.GrantConstraint{
+		ResourceID:   uuid.New(),
+		Members:      []byte(`["user:other@example.com"]`),
+		AllowedRoles: []byte(`[]`),
+	}))
+
+	found, err := repo.GetByID(constraint.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.True(t, found.Allows("roles/storage.viewer"))
+
+	all, err := repo.List(nil, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	onOrg, err := repo.List(&orgID, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, onOrg, 1)
+
+	hierarchy, err := repo.ListByResources([]uuid.UUID{projectID, orgID})
+	require.NoError(t, err)
+	assert.Len(t, hierarchy, 2)
+
+	found.AllowedRoles = []byte(`["roles/storage.viewer", "roles/storage.editor"]`)
+	require.NoError(t, repo.Update(found))
+	updated, err := repo.GetByID(constraint.ID)
+	require.NoError(t, err)
+	assert.True(t, updated.Allows("roles/storage.editor"))
+
+	require.NoError(t, repo.Delete(constraint.ID))
+	deleted, err := repo.GetByID(constraint.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+}
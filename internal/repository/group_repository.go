@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// GroupRepository handles provisioned group data operations
+type GroupRepository interface {
+	Create(group *domain.Group) error
+	GetByID(id uuid.UUID) (*domain.Group, error)
+	Update(group *domain.Group) error
+	Delete(id uuid.UUID) error
+	List(filter DirectoryFilter, limit, offset int) ([]domain.Group, int64, error)
+	AddMembers(groupID uuid.UUID, userIDs []uuid.UUID) error
+	RemoveMembers(groupID uuid.UUID, userIDs []uuid.UUID) error
+	ReplaceMembers(groupID uuid.UUID, userIDs []uuid.UUID) error
+	ListByMember(userName string) ([]domain.Group, error)
+}
+
+type groupRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewGroupRepository creates a new group repository
+func NewGroupRepository(db *gorm.DB, opts ...Option) GroupRepository {
+	o := applyOptions(db, opts)
+	return &groupRepository{db: db, reader: o.reader}
+}
+
+// Create creates a group with its initial members
+func (r *groupRepository) Create(group *domain.Group) error {
+	return r.db.Omit("Members.*").Create(group).Error
+}
+
+func (r *groupRepository) GetByID(id uuid.UUID) (*domain.Group, error) {
+	var group domain.Group
+	err := r.db.Preload("Members").First(&group, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *groupRepository) Update(group *domain.Group) error {
+	// Members are managed through AddMembers, RemoveMembers and ReplaceMembers
+	return r.db.Omit("Members").Save(group).Error
+}
+
+// Delete removes a group and its memberships
+func (r *groupRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Group{}, id).Error
+	})
+}
+
+// List returns groups ordered by display name, with the total number of matches
+func (r *groupRepository) List(filter DirectoryFilter, limit, offset int) ([]domain.Group, int64, error) {
+	query, err := filter.apply(r.reader.Model(&domain.Group{}), "display_name", "external_id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	var groups []domain.Group
+	err = query.Preload("Members").Order("display_name").Find(&groups).Error
+	return groups, total, err
+}
+
+// AddMembers adds users to a group; existing members are ignored
+func (r *groupRepository) AddMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	for _, userID := range userIDs {
+		err := r.db.Exec(
+			"INSERT INTO group_members (user_id, group_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			userID, groupID,
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveMembers removes users from a group
+func (r *groupRepository) RemoveMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return r.db.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id IN ?", groupID, userIDs).Error
+}
+
+// ReplaceMembers makes userIDs the complete member list of a group
+func (r *groupRepository) ReplaceMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", groupID).Error; err != nil {
+			return err
+		}
+		return NewGroupRepository(tx).AddMembers(groupID, userIDs)
+	})
+}
+
+// ListByMember returns the groups an active user belongs to
+func (r *groupRepository) ListByMember(userName string) ([]domain.Group, error) {
+	var groups []domain.Group
+	err := r.reader.
+		Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Joins("JOIN users ON users.id = group_members.user_id").
+		Where("users.user_name = ? AND users.active", userName).
+		Order("groups.display_name").
+		Find(&groups).Error
+	return groups, err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyRepository stores the idempotency keys of mutating requests
+type IdempotencyRepository interface {
+	Reserve(record *domain.IdempotencyKey) (bool, error)
+	Get(method, key string) (*domain.IdempotencyKey, error)
+	Complete(method, key string, response datatypes.JSON, expiresAt time.Time) error
+	Release(method, key string) error
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+// NewIdempotencyRepository creates a new idempotency repository. Keys are always read from the
+// primary, since a retry typically follows its original request within seconds.
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve inserts record unless an unexpired record with the same method and key exists,
+// replacing an expired one. It reports whether record was inserted.
+func (r *idempotencyRepository) Reserve(record *domain.IdempotencyKey) (bool, error) {
+	var inserted bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("method = ? AND key = ? AND expires_at <= ?", record.Method, record.Key, time.Now()).
+			Delete(&domain.IdempotencyKey{}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		inserted = result.RowsAffected == 1
+		return result.Error
+	})
+	return inserted, err
+}
+
+func (r *idempotencyRepository) Get(method, key string) (*domain.IdempotencyKey, error) {
+	var record domain.IdempotencyKey
+	err := r.db.Where("method = ? AND key = ?", method, key).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Complete stores the response of a reserved request, to be replayed until expiresAt
+func (r *idempotencyRepository) Complete(method, key string, response datatypes.JSON, expiresAt time.Time) error {
+	return r.db.Model(&domain.IdempotencyKey{}).
+		Where("method = ? AND key = ?", method, key).
+		Updates(map[string]interface{}{"response": response, "completed": true, "expires_at": expiresAt}).Error
+}
+
+// Release deletes a reservation, letting a retry execute the request again
+func (r *idempotencyRepository) Release(method, key string) error {
+	return r.db.Where("method = ? AND key = ?", method, key).Delete(&domain.IdempotencyKey{}).Error
+}
+
+// DeleteExpired deletes the records that expired before the given time
+func (r *idempotencyRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", before).Delete(&domain.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
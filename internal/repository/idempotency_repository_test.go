@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepository_ReserveAndComplete(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIdempotencyRepository(db)
+
+	record := func(expiresAt time.Time) *domain.IdempotencyKey {
+		return &domain.IdempotencyKey{
+			Method:      "CreateResource",
+			Key:         "key-1",
+			Fingerprint: "abc",
+			CreatedAt:   time.Now(),
+			ExpiresAt:   expiresAt,
+		}
+	}
+
+	reserved, err := repo.Reserve(record(time.Now().Add(time.Minute)))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	reserved, err = repo.Reserve(record(time.Now().Add(time.Minute)))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+
+	require.NoError(t, repo.Complete("CreateResource", "key-1", []byte(`{"name":"web"}`), time.Now().Add(time.Hour)))
+	stored, err := repo.Get("CreateResource", "key-1")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.True(t, stored.Completed)
+	assert.JSONEq(t, `{"name":"web"}`, string(stored.Response))
+
+	missing, err := repo.Get("CreateBinding", "key-1")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, repo.Release("CreateResource", "key-1"))
+	reserved, err = repo.Reserve(record(time.Now().Add(-time.Second)))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// An expired record is replaced on the next reservation
+	reserved, err = repo.Reserve(record(time.Now().Add(time.Minute)))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	deleted, err := repo.DeleteExpired(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of dangling references found by IntegrityRepository
+const (
+	DanglingBindingRole    = "binding-role"      // Live binding of a live policy granting a deleted or missing role
+	DanglingBindingPolicy  = "binding-policy"    // Live binding of a deleted or missing policy
+	DanglingPolicyResource = "policy-resource"   // Live policy of a deleted or missing resource
+	DanglingConditionOwner = "condition-binding" // Live condition of a deleted or missing binding
+)
+
+// DanglingReference is a live row referencing a row that is soft-deleted or missing
+type DanglingReference struct {
+	Kind        string
+	ID          uuid.UUID  // The binding, policy or condition
+	ResourceID  *uuid.UUID // Resource whose policy holds the row, when known
+	ReferenceID uuid.UUID  // The role, policy, resource or binding it references
+	Deleted     bool       // The referenced row is soft-deleted, rather than missing
+}
+
+// BoundMembers are the members of a live binding of a live policy
+type BoundMembers struct {
+	BindingID  uuid.UUID
+	ResourceID uuid.UUID
+	Members    []byte // JSON array, as in domain.Binding
+}
+
+// IntegrityRepository finds rows left inconsistent by soft deletes, interrupted changes or manual
+// edits of the database. It reads the primary, so recent changes are not reported as dangling.
+type IntegrityRepository interface {
+	DanglingReferences() ([]DanglingReference, error)
+	BoundMembers() ([]BoundMembers, error)
+	GroupNames() ([]string, error)
+}
+
+type integrityRepository struct {
+	db *gorm.DB
+}
+
+// NewIntegrityRepository creates a new integrity repository
+func NewIntegrityRepository(db *gorm.DB) IntegrityRepository {
+	return &integrityRepository{db: db}
+}
+
+// danglingReferenceQueries select, per kind, the id, resource_id, reference_id and deleted
+// columns of the live rows whose reference is soft-deleted or missing
+var danglingReferenceQueries = []struct {
+	kind  string
+	query string
+}{
+	{DanglingBindingRole, `
+		SELECT b.id, p.resource_id, b.role_id AS reference_id, r.id IS NOT NULL AS deleted
+		FROM bindings b
+		JOIN policies p ON p.id = b.policy_id AND p.deleted_at IS NULL
+		LEFT JOIN roles r ON r.id = b.role_id
+		WHERE b.deleted_at IS NULL AND (r.id IS NULL OR r.deleted_at IS NOT NULL)
+		ORDER BY b.id`},
+	{DanglingBindingPolicy, `
+		SELECT b.id, p.resource_id, b.policy_id AS reference_id, p.id IS NOT NULL AS deleted
+		FROM bindings b
+		LEFT JOIN policies p ON p.id = b.policy_id
+		WHERE b.deleted_at IS NULL AND (p.id IS NULL OR p.deleted_at IS NOT NULL)
+		ORDER BY b.id`},
+	{DanglingPolicyResource, `
+		SELECT p.id, p.resource_id, p.resource_id AS reference_id, r.id IS NOT NULL AS deleted
+		FROM policies p
+		LEFT JOIN resources r ON r.id = p.resource_id
+		WHERE p.deleted_at IS NULL AND (r.id IS NULL OR r.deleted_at IS NOT NULL)
+		ORDER BY p.id`},
+	{DanglingConditionOwner, `
+		SELECT c.id, p.resource_id, c.binding_id AS reference_id, b.id IS NOT NULL AS deleted
+		FROM conditions c
+		LEFT JOIN bindings b ON b.id = c.binding_id
+		LEFT JOIN policies p ON p.id = b.policy_id
+		WHERE c.deleted_at IS NULL AND (b.id IS NULL OR b.deleted_at IS NOT NULL)
+		ORDER BY c.id`},
+}
+
+// DanglingReferences returns the dangling references of every kind, grouped by kind
+func (r *integrityRepository) DanglingReferences() ([]DanglingReference, error) {
+	var references []DanglingReference
+	for _, q := range danglingReferenceQueries {
+		var rows []struct {
+			ID          uuid.UUID
+			ResourceID  *uuid.UUID
+			ReferenceID uuid.UUID
+			Deleted     bool
+		}
+		if err := r.db.Raw(q.query).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			references = append(references, DanglingReference{
+				Kind:        q.kind,
+				ID:          row.ID,
+				ResourceID:  row.ResourceID,
+				ReferenceID: row.ReferenceID,
+				Deleted:     row.Deleted,
+			})
+		}
+	}
+	return references, nil
+}
+
+// BoundMembers returns the members of the live bindings of live policies on live resources
+func (r *integrityRepository) BoundMembers() ([]BoundMembers, error) {
+	var bound []BoundMembers
+	err := r.db.Raw(`
+		SELECT b.id AS binding_id, p.resource_id, b.members
+		FROM bindings b
+		JOIN policies p ON p.id = b.policy_id AND p.deleted_at IS NULL
+		JOIN resources r ON r.id = p.resource_id AND r.deleted_at IS NULL
+		WHERE b.deleted_at IS NULL
+		ORDER BY b.id`).Scan(&bound).Error
+	return bound, err
+}
+
+// GroupNames returns the display names of the provisioned groups
+func (r *integrityRepository) GroupNames() ([]string, error) {
+	var names []string
+	err := r.db.Raw("SELECT display_name FROM groups ORDER BY display_name").Scan(&names).Error
+	return names, err
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityRepository_DanglingReferences(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIntegrityRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+
+	viewer := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	retired := &domain.Role{Name: "roles/retired", Title: "Retired"}
+	require.NoError(t, roleRepo.Create(viewer))
+	require.NoError(t, roleRepo.Create(retired))
+
+	// A healthy project, a project granting a deleted role, a deleted bucket with its policy and
+	// a deleted policy with its binding
+	healthy := &domain.Resource{Type: "project", Name: "healthy"}
+	stale := &domain.Resource{Type: "project", Name: "stale"}
+	bucket := &domain.Resource{Type: "bucket", Name: "logs"}
+	unshared := &domain.Resource{Type: "bucket", Name: "unshared"}
+	for _, resource := range []*domain.Resource{healthy, stale, bucket, unshared} {
+		require.NoError(t, resourceRepo.Create(resource))
+	}
+	policies := map[*domain.Resource]*domain.Policy{}
+	for _, resource := range []*domain.Resource{healthy, stale, bucket, unshared} {
+		policy := &domain.Policy{ResourceID: resource.ID}
+		require.NoError(t, policyRepo.Create(policy))
+		policies[resource] = policy
+	}
+	staleBinding := &domain.Binding{PolicyID: policies[stale].ID, RoleID: retired.ID, Members: []byte(`["group:former@example.com"]`)}
+	unsharedBinding := &domain.Binding{PolicyID: policies[unshared].ID, RoleID: viewer.ID, Members: []byte(`["user:alice@example.com"]`)}
+	for _, binding := range []*domain.Binding{
+		{PolicyID: policies[healthy].ID, RoleID: viewer.ID, Members: []byte(`["group:sre@example.com", "user:bob@example.com"]`)},
+		staleBinding,
+		unsharedBinding,
+	} {
+		require.NoError(t, db.Create(binding).Error)
+	}
+	// A binding deleted on its own leaves its condition behind
+	removed := &domain.Binding{PolicyID: policies[healthy].ID, RoleID: viewer.ID, Members: []byte(`["user:carol@example.com"]`)}
+	require.NoError(t, db.Create(removed).Error)
+	condition := &domain.Condition{BindingID: removed.ID, Expression: `resource.type == "bucket"`}
+	require.NoError(t, db.Create(condition).Error)
+	require.NoError(t, db.Delete(&domain.Binding{}, removed.ID).Error)
+
+	// Soft-deleted directly: the role repository refuses to delete a role in use
+	require.NoError(t, db.Delete(&domain.Role{}, retired.ID).Error)
+	require.NoError(t, resourceRepo.Delete(bucket.ID))
+	require.NoError(t, policyRepo.Delete(policies[unshared].ID))
+
+	references, err := repo.DanglingReferences()
+	require.NoError(t, err)
+	require.Len(t, references, 4)
+
+	assert.Equal(t, DanglingBindingRole, references[0].Kind)
+	assert.Equal(t, staleBinding.ID, references[0].ID)
+	assert.Equal(t, retired.ID, references[0].ReferenceID)
+	assert.Equal(t, stale.ID, *references[0].ResourceID)
+	assert.True(t, references[0].Deleted)
+
+	assert.Equal(t, DanglingBindingPolicy, references[1].Kind)
+	assert.Equal(t, unsharedBinding.ID, references[1].ID)
+	assert.Equal(t, policies[unshared].ID, references[1].ReferenceID)
+	assert.True(t, references[1].Deleted)
+
+	assert.Equal(t, DanglingPolicyResource, references[2].Kind)
+	assert.Equal(t, policies[bucket].ID, references[2].ID)
+	assert.Equal(t, bucket.ID, references[2].ReferenceID)
+	assert.True(t, references[2].Deleted)
+
+	assert.Equal(t, DanglingConditionOwner, references[3].Kind)
+	assert.Equal(t, condition.ID, references[3].ID)
+	assert.Equal(t, removed.ID, references[3].ReferenceID)
+	assert.Equal(t, healthy.ID, *references[3].ResourceID)
+	assert.True(t, references[3].Deleted)
+
+	// Only the bindings that still apply are listed with their members
+	bound, err := repo.BoundMembers()
+	require.NoError(t, err)
+	assert.Len(t, bound, 2)
+	for _, members := range bound {
+		assert.Contains(t, []string{healthy.ID.String(), stale.ID.String()}, members.ResourceID.String())
+	}
+
+	require.NoError(t, db.Create(&domain.Group{DisplayName: "sre@example.com"}).Error)
+	names, err := repo.GroupNames()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sre@example.com"}, names)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// OperationRepository stores long-running operations
+type OperationRepository interface {
+	Create(operation *domain.Operation) error
+	GetByID(id uuid.UUID) (*domain.Operation, error)
+	Update(operation *domain.Operation) error
+	UpdateProgress(id uuid.UUID, completed, total int64) error
+	List(operationType string, state domain.OperationState, limit, offset int) ([]domain.Operation, error)
+	FailUnfinished(reason string) (int64, error)
+}
+
+type operationRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewOperationRepository creates a new operation repository
+func NewOperationRepository(db *gorm.DB, opts ...Option) OperationRepository {
+	o := applyOptions(db, opts)
+	return &operationRepository{db: db, reader: o.reader}
+}
+
+func (r *operationRepository) Create(operation *domain.Operation) error {
+	return r.db.Create(operation).Error
+}
+
+func (r *operationRepository) GetByID(id uuid.UUID) (*domain.Operation, error) {
+	var operation domain.Operation
+	// Read from the primary: clients poll right after starting an operation
+	err := r.db.First(&operation, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &operation, nil
+}
+
+func (r *operationRepository) Update(operation *domain.Operation) error {
+	return r.db.Save(operation).Error
+}
+
+// UpdateProgress records how many items an operation has processed
+func (r *operationRepository) UpdateProgress(id uuid.UUID, completed, total int64) error {
+	return r.db.Model(&domain.Operation{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"completed": completed, "total": total}).Error
+}
+
+// List returns operations newest first, optionally filtered by type and state
+func (r *operationRepository) List(operationType string, state domain.OperationState, limit, offset int) ([]domain.Operation, error) {
+	var operations []domain.Operation
+	query := r.reader.Model(&domain.Operation{}).Order("created_at DESC")
+
+	if operationType != "" {
+		query = query.Where("type = ?", operationType)
+	}
+
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&operations).Error
+	return operations, err
+}
+
+// FailUnfinished marks every pending or running operation as failed, e.g. operations
+// interrupted by a restart, and returns how many were updated
+func (r *operationRepository) FailUnfinished(reason string) (int64, error) {
+	result := r.db.Model(&domain.Operation{}).
+		Where("state IN ?", []domain.OperationState{domain.OperationPending, domain.OperationRunning}).
+		Updates(map[string]interface{}{
+			"state":       domain.OperationFailed,
+			"error":       reason,
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
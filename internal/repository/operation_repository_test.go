@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationRepository_Lifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOperationRepository(db)
+
+	operation := &domain.Operation{Type: "DeleteResourceTree", State: domain.OperationPending, Target: "org"}
+	require.NoError(t, repo.Create(operation))
+
+	require.NoError(t, repo.UpdateProgress(operation.ID, 5, 10))
+	got, err := repo.GetByID(operation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), got.Completed)
+	assert.Equal(t, int64(10), got.Total)
+
+	got.State = domain.OperationSucceeded
+	got.Result = []byte(`{"deleted":10}`)
+	require.NoError(t, repo.Update(got))
+
+	got, err = repo.GetByID(operation.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Done())
+	assert.JSONEq(t, `{"deleted":10}`, string(got.Result))
+}
+
+func TestOperationRepository_ListAndFailUnfinished(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOperationRepository(db)
+
+	require.NoError(t, repo.Create(&domain.Operation{Type: "Import", State: domain.OperationRunning}))
+	require.NoError(t, repo.Create(&domain.Operation{Type: "Import", State: domain.OperationPending}))
+	require.NoError(t, repo.Create(&domain.Operation{Type: "Export", State: domain.OperationSucceeded}))
+
+	imports, err := repo.List("Import", "", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, imports, 2)
+
+	failed, err := repo.FailUnfinished("interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), failed)
+
+	failedOps, err := repo.List("", domain.OperationFailed, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, failedOps, 2)
+	assert.Equal(t, "interrupted", failedOps[0].Error)
+	assert.NotNil(t, failedOps[0].FinishedAt)
+
+	missing, err := repo.GetByID(uuid.New())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// Option configures optional repository behaviour
+type Option func(*options)
+
+type options struct {
+	reader  *gorm.DB
+	closure bool
+}
+
+// WithReader routes the repository's read-only queries (GetByID, List, hierarchy
+// lookups, ...) to reader, typically a read replica. Writes, and the reads that
+// validate a write, always use the primary connection.
+func WithReader(reader *gorm.DB) Option {
+	return func(o *options) {
+		o.reader = reader
+	}
+}
+
+// WithClosureTable makes the resource repository read subtrees from the
+// resource_closure table instead of walking the hierarchy with recursive queries.
+// The closure table is maintained on every write either way.
+func WithClosureTable(enabled bool) Option {
+	return func(o *options) {
+		o.closure = enabled
+	}
+}
+
+// applyOptions resolves opts; reads default to the primary connection
+func applyOptions(db *gorm.DB, opts []Option) options {
+	o := options{reader: db}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.reader == nil {
+		o.reader = db
+	}
+	return o
+}
+
+// prepared returns a session of db running its queries as prepared statements, cached per
+// connection and shared by every session of db. Sessions of readers whose connection pool is not
+// a plain *sql.DB, like the replica pool with failover to the primary, are returned unchanged: a
+// prepared statement would pin their queries to the database it was prepared on.
+func prepared(db *gorm.DB) *gorm.DB {
+	if _, ok := db.Statement.ConnPool.(*sql.DB); !ok {
+		return db
+	}
+	return db.Session(&gorm.Session{PrepareStmt: true})
+}
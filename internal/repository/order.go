@@ -0,0 +1,10 @@
+package repository
+
+import "gorm.io/gorm"
+
+// byCreation orders the rows of table by creation, then ID. It is the order of every paginated
+// List method: rows created at the same instant keep their relative order from one request to
+// the next, so pages read with limit and offset neither repeat nor skip rows.
+func byCreation(query *gorm.DB, table string) *gorm.DB {
+	return query.Order(table + ".created_at, " + table + ".id")
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pageIDs reads every page of a listing of pageSize rows and returns the IDs in the order read
+func pageIDs(t *testing.T, pageSize int, list func(limit, offset int) ([]uuid.UUID, error)) []uuid.UUID {
+	t.Helper()
+	var ids []uuid.UUID
+	for offset := 0; ; offset += pageSize {
+		page, err := list(pageSize, offset)
+		require.NoError(t, err)
+		ids = append(ids, page...)
+		if len(page) < pageSize {
+			return ids
+		}
+	}
+}
+
+// creationOrder returns the IDs of rows created at older and the IDs of rows created at once
+// afterwards in the order every List returns them: oldest first, ties broken by ID
+func creationOrder(older uuid.UUID, ties []uuid.UUID) []uuid.UUID {
+	sorted := slices.Clone(ties)
+	slices.SortFunc(sorted, func(a, b uuid.UUID) int {
+		return slices.Compare(a[:], b[:])
+	})
+	return append([]uuid.UUID{older}, sorted...)
+}
+
+func TestListOrder(t *testing.T) {
+	db := setupTestDB(t)
+	resourceRepo := NewResourceRepository(db)
+	permissionRepo := NewPermissionRepository(db)
+	roleRepo := NewRoleRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	bindingRepo := NewBindingRepository(db)
+
+	// One row created an hour ago, then rows created at the same instant in a random ID order
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	created := func(i int) time.Time {
+		if i == 0 {
+			return now.Add(-time.Hour)
+		}
+		return now
+	}
+	const rows = 6
+
+	parent := &domain.Resource{Type: "folder", Name: "order-parent", CreatedAt: now.Add(-2 * time.Hour)}
+	require.NoError(t, resourceRepo.Create(parent))
+	var resources, permissions, roles, policies []uuid.UUID
+	for i := range rows {
+		resource := &domain.Resource{Type: "project", Name: fmt.Sprintf("order-%d", i), ParentID: &parent.ID, CreatedAt: created(i)}
+		require.NoError(t, resourceRepo.Create(resource))
+		resources = append(resources, resource.ID)
+
+		permission := &domain.Permission{Name: fmt.Sprintf("order.items.get%d", i), Service: "order", CreatedAt: created(i)}
+		require.NoError(t, permissionRepo.Create(permission))
+		permissions = append(permissions, permission.ID)
+
+		role := &domain.Role{Name: fmt.Sprintf("roles/order.role%d", i), Title: "Order role", CreatedAt: created(i)}
+		require.NoError(t, roleRepo.Create(role))
+		roles = append(roles, role.ID)
+
+		policy := &domain.Policy{ResourceID: resource.ID, Version: 1, CreatedAt: created(i)}
+		require.NoError(t, policyRepo.Create(policy))
+		policies = append(policies, policy.ID)
+	}
+
+	var bindings []uuid.UUID
+	for i := range rows {
+		binding := &domain.Binding{PolicyID: policies[0], RoleID: roles[0], Members: []byte(`["user:alice@example.com"]`), CreatedAt: created(i)}
+		require.NoError(t, bindingRepo.Create(binding))
+		bindings = append(bindings, binding.ID)
+	}
+
+	ids := func(n int, id func(i int) uuid.UUID) []uuid.UUID {
+		out := make([]uuid.UUID, n)
+		for i := range out {
+			out[i] = id(i)
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		expected []uuid.UUID
+		list     func(limit, offset int) ([]uuid.UUID, error)
+	}{
+		{"resources", resources, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := resourceRepo.List(&parent.ID, "", nil, nil, limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"permissions", permissions, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := permissionRepo.List("order", limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"roles", roles, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := roleRepo.List(true, nil, limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"policies", policies, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := policyRepo.List(&parent.ID, limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"policies with details", policies, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := policyRepo.ListWithDetails(&parent.ID, limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"bindings by resource", bindings, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := bindingRepo.ListByResourceID(resources[0], limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"bindings by principal", bindings, func(limit, offset int) ([]uuid.UUID, error) {
+			list, err := bindingRepo.ListByPrincipal("user:alice@example.com", limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+		{"bindings search", bindings, func(limit, offset int) ([]uuid.UUID, error) {
+			list, _, err := bindingRepo.Search(BindingSearch{Member: "alice"}, limit, offset)
+			return ids(len(list), func(i int) uuid.UUID { return list[i].ID }), err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := creationOrder(tt.expected[0], tt.expected[1:])
+			for _, pageSize := range []int{1, 2, 4} {
+				assert.Equal(t, expected, pageIDs(t, pageSize, tt.list), "page size %d", pageSize)
+			}
+		})
+	}
+}
@@ -2,13 +2,15 @@ package repository
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"gorm.io/gorm"
 )
 
-// PermissionRepository handles permission data operations
+// PermissionRepository handles permission data operations. List returns permissions oldest
+// first, ties broken by ID, so that its pages are stable.
 type PermissionRepository interface {
 	Create(permission *domain.Permission) error
 	GetByID(id uuid.UUID) (*domain.Permission, error)
@@ -16,15 +18,28 @@ type PermissionRepository interface {
 	Delete(id uuid.UUID) error
 	List(service string, limit, offset int) ([]domain.Permission, error)
 	GetByIDs(ids []uuid.UUID) ([]domain.Permission, error)
+	SyncService(service string, permissions []domain.Permission) (*PermissionSyncResult, error)
+	SetDeprecated(id uuid.UUID, deprecated bool, replacementName string) error
+	ListDeprecated() ([]domain.Permission, error)
+}
+
+// PermissionSyncResult lists the permission names changed by SyncService
+type PermissionSyncResult struct {
+	Created    []string // New permissions
+	Updated    []string // Existing permissions whose description changed or that were restored
+	Deprecated []string // Permissions no longer in the catalog
+	Unchanged  []string
 }
 
 type permissionRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	reader *gorm.DB
 }
 
 // NewPermissionRepository creates a new permission repository
-func NewPermissionRepository(db *gorm.DB) PermissionRepository {
-	return &permissionRepository{db: db}
+func NewPermissionRepository(db *gorm.DB, opts ...Option) PermissionRepository {
+	o := applyOptions(db, opts)
+	return &permissionRepository{db: db, reader: o.reader}
 }
 
 func (r *permissionRepository) Create(permission *domain.Permission) error {
@@ -33,7 +48,7 @@ func (r *permissionRepository) Create(permission *domain.Permission) error {
 
 func (r *permissionRepository) GetByID(id uuid.UUID) (*domain.Permission, error) {
 	var permission domain.Permission
-	err := r.db.First(&permission, id).Error
+	err := r.reader.First(&permission, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -45,7 +60,7 @@ func (r *permissionRepository) GetByID(id uuid.UUID) (*domain.Permission, error)
 
 func (r *permissionRepository) GetByName(name string) (*domain.Permission, error) {
 	var permission domain.Permission
-	err := r.db.Where("name = ?", name).First(&permission).Error
+	err := r.reader.Where("name = ?", name).First(&permission).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -56,12 +71,20 @@ func (r *permissionRepository) GetByName(name string) (*domain.Permission, error
 }
 
 func (r *permissionRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&domain.Permission{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.Permission{}, id).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, grantsOfPermissions, []uuid.UUID{id})
+	})
 }
 
+// grantsOfPermissions selects the bindings of roles granting any of a list of permissions
+const grantsOfPermissions = "role_id IN (SELECT role_id FROM role_permissions WHERE permission_id IN ?)"
+
 func (r *permissionRepository) List(service string, limit, offset int) ([]domain.Permission, error) {
 	var permissions []domain.Permission
-	query := r.db.Model(&domain.Permission{})
+	query := r.reader.Model(&domain.Permission{})
 
 	if service != "" {
 		query = query.Where("service = ?", service)
@@ -75,12 +98,120 @@ func (r *permissionRepository) List(service string, limit, offset int) ([]domain
 		query = query.Offset(offset)
 	}
 
-	err := query.Find(&permissions).Error
+	err := byCreation(query, "permissions").Find(&permissions).Error
 	return permissions, err
 }
 
 func (r *permissionRepository) GetByIDs(ids []uuid.UUID) ([]domain.Permission, error) {
 	var permissions []domain.Permission
-	err := r.db.Where("id IN ?", ids).Find(&permissions).Error
+	err := r.reader.Where("id IN ?", ids).Find(&permissions).Error
+	return permissions, err
+}
+
+// SyncService makes the stored permissions of service match its declared catalog, in a single
+// transaction. Missing permissions are created, descriptions are updated, and permissions
+// dropped from the catalog are flagged as deprecated rather than deleted, since roles may still
+// grant them. Deprecated or deleted permissions that reappear in the catalog are restored.
+func (r *permissionRepository) SyncService(service string, permissions []domain.Permission) (*PermissionSyncResult, error) {
+	result := &PermissionSyncResult{}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Include soft-deleted rows: names are unique across them too
+		var existing []domain.Permission
+		names := make([]string, len(permissions))
+		for i := range permissions {
+			names[i] = permissions[i].Name
+		}
+		if err := tx.Unscoped().Where("service = ? OR name IN ?", service, names).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		byName := make(map[string]*domain.Permission, len(existing))
+		for i := range existing {
+			byName[existing[i].Name] = &existing[i]
+		}
+
+		declared := make(map[string]bool, len(permissions))
+		var restored []uuid.UUID
+		for _, def := range permissions {
+			declared[def.Name] = true
+
+			current, ok := byName[def.Name]
+			if !ok {
+				permission := &domain.Permission{Name: def.Name, Description: def.Description, Service: service}
+				if err := tx.Create(permission).Error; err != nil {
+					return err
+				}
+				result.Created = append(result.Created, def.Name)
+				continue
+			}
+
+			if current.Description == def.Description && current.Service == service &&
+				!current.Deprecated && !current.DeletedAt.Valid {
+				result.Unchanged = append(result.Unchanged, def.Name)
+				continue
+			}
+
+			err := tx.Unscoped().Model(current).Updates(map[string]interface{}{
+				"description":      def.Description,
+				"service":          service,
+				"deprecated":       false,
+				"replacement_name": "",
+				"deleted_at":       nil,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if current.DeletedAt.Valid {
+				restored = append(restored, current.ID)
+			}
+			result.Updated = append(result.Updated, def.Name)
+		}
+
+		for _, current := range existing {
+			if current.Service != service || declared[current.Name] || current.Deprecated || current.DeletedAt.Valid {
+				continue
+			}
+			if err := tx.Model(&current).Update("deprecated", true).Error; err != nil {
+				return err
+			}
+			result.Deprecated = append(result.Deprecated, current.Name)
+		}
+
+		// Roles granting restored permissions grant them again
+		if len(restored) == 0 {
+			return nil
+		}
+		return reindexGrants(tx, grantsOfPermissions, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetDeprecated flags or unflags a permission as deprecated. replacementName names the
+// permission to grant instead; it is cleared when the permission is no longer deprecated.
+func (r *permissionRepository) SetDeprecated(id uuid.UUID, deprecated bool, replacementName string) error {
+	if !deprecated {
+		replacementName = ""
+	}
+	result := r.db.Model(&domain.Permission{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"deprecated":       deprecated,
+		"replacement_name": replacementName,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("permission not found: %s", id)
+	}
+	return nil
+}
+
+// ListDeprecated lists the deprecated permissions by name
+func (r *permissionRepository) ListDeprecated() ([]domain.Permission, error) {
+	var permissions []domain.Permission
+	err := r.reader.Where("deprecated").Order("name").Find(&permissions).Error
 	return permissions, err
 }
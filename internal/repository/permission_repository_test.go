@@ -311,3 +311,87 @@ func TestPermissionRepository_Create_DuplicateName(t *testing.T) {
 	err = repo.Create(perm2)
 	assert.Error(t, err) // Should fail due to unique constraint
 }
+
+func TestPermissionRepository_SyncService(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPermissionRepository(db)
+
+	// An older catalog
+	require.NoError(t, repo.Create(&domain.Permission{Name: "storage.buckets.get", Description: "old", Service: "storage"}))
+	require.NoError(t, repo.Create(&domain.Permission{Name: "storage.buckets.list", Description: "List buckets", Service: "storage"}))
+	require.NoError(t, repo.Create(&domain.Permission{Name: "storage.buckets.legacy", Service: "storage"}))
+	require.NoError(t, repo.Create(&domain.Permission{Name: "compute.instances.get", Service: "compute"}))
+	deleted := &domain.Permission{Name: "storage.objects.get", Service: "storage"}
+	require.NoError(t, repo.Create(deleted))
+	require.NoError(t, repo.Delete(deleted.ID))
+
+	result, err := repo.SyncService("storage", []domain.Permission{
+		{Name: "storage.buckets.get", Description: "Get buckets"},
+		{Name: "storage.buckets.list", Description: "List buckets"},
+		{Name: "storage.buckets.create", Description: "Create buckets"},
+		{Name: "storage.objects.get", Description: "Get objects"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.create"}, result.Created)
+	assert.ElementsMatch(t, []string{"storage.buckets.get", "storage.objects.get"}, result.Updated)
+	assert.Equal(t, []string{"storage.buckets.legacy"}, result.Deprecated)
+	assert.Equal(t, []string{"storage.buckets.list"}, result.Unchanged)
+
+	legacy, err := repo.GetByName("storage.buckets.legacy")
+	require.NoError(t, err)
+	require.NotNil(t, legacy)
+	assert.True(t, legacy.Deprecated)
+
+	restored, err := repo.GetByName("storage.objects.get")
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Equal(t, deleted.ID, restored.ID)
+
+	// Other services are untouched
+	compute, err := repo.GetByName("compute.instances.get")
+	require.NoError(t, err)
+	assert.False(t, compute.Deprecated)
+
+	// Syncing the same catalog again is a no-op
+	again, err := repo.SyncService("storage", []domain.Permission{
+		{Name: "storage.buckets.get", Description: "Get buckets"},
+		{Name: "storage.buckets.list", Description: "List buckets"},
+		{Name: "storage.buckets.create", Description: "Create buckets"},
+		{Name: "storage.objects.get", Description: "Get objects"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, again.Created)
+	assert.Empty(t, again.Updated)
+	assert.Empty(t, again.Deprecated)
+	assert.Len(t, again.Unchanged, 4)
+}
+
+func TestPermissionRepository_SetDeprecated(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPermissionRepository(db)
+
+	legacy := &domain.Permission{Name: "storage.buckets.getIamPolicy", Service: "storage"}
+	require.NoError(t, repo.Create(legacy))
+	require.NoError(t, repo.Create(&domain.Permission{Name: "storage.buckets.getPolicy", Service: "storage"}))
+
+	require.NoError(t, repo.SetDeprecated(legacy.ID, true, "storage.buckets.getPolicy"))
+
+	deprecated, err := repo.ListDeprecated()
+	require.NoError(t, err)
+	require.Len(t, deprecated, 1)
+	assert.Equal(t, "storage.buckets.getIamPolicy", deprecated[0].Name)
+	assert.Equal(t, "storage.buckets.getPolicy", deprecated[0].ReplacementName)
+
+	// Undeprecating clears the replacement
+	require.NoError(t, repo.SetDeprecated(legacy.ID, false, "storage.buckets.getPolicy"))
+	retrieved, err := repo.GetByID(legacy.ID)
+	require.NoError(t, err)
+	assert.False(t, retrieved.Deprecated)
+	assert.Empty(t, retrieved.ReplacementName)
+
+	deprecated, err = repo.ListDeprecated()
+	require.NoError(t, err)
+	assert.Empty(t, deprecated)
+
+	assert.Error(t, repo.SetDeprecated(uuid.New(), true, ""))
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// countQueries registers a callback counting every SELECT issued through db
+func countQueries(b *testing.B, db *gorm.DB) *atomic.Int64 {
+	var count atomic.Int64
+	err := db.Callback().Query().After("gorm:query").Register("bench:count_queries", func(*gorm.DB) {
+		count.Add(1)
+	})
+	require.NoError(b, err)
+	return &count
+}
+
+// seedPolicies creates n policies under a single parent, each with bindingsPerPolicy bindings
+// to distinct roles
+func seedPolicies(b *testing.B, db *gorm.DB, n, bindingsPerPolicy int) *domain.Resource {
+	resourceRepo := NewResourceRepository(db)
+	roleRepo := NewRoleRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	permissionRepo := NewPermissionRepository(db)
+
+	permission := &domain.Permission{Name: "storage.buckets.get", Service: "storage"}
+	require.NoError(b, permissionRepo.Create(permission))
+
+	parent := &domain.Resource{Type: "organization", Name: "bench-org"}
+	require.NoError(b, resourceRepo.Create(parent))
+
+	for i := 0; i < n; i++ {
+		resource := &domain.Resource{Type: "project", Name: fmt.Sprintf("project-%d", i), ParentID: &parent.ID}
+		require.NoError(b, resourceRepo.Create(resource))
+		policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+		require.NoError(b, policyRepo.Create(policy))
+
+		for j := 0; j < bindingsPerPolicy; j++ {
+			role := &domain.Role{
+				Name:        fmt.Sprintf("roles/bench.%d.%d", i, j),
+				Title:       "Bench",
+				Permissions: []domain.Permission{*permission},
+			}
+			require.NoError(b, roleRepo.Create(role))
+			require.NoError(b, bindingRepo.Create(&domain.Binding{
+				PolicyID: policy.ID,
+				RoleID:   role.ID,
+				Members:  []byte(`["user:alice@example.com"]`),
+			}))
+		}
+	}
+	return parent
+}
+
+// BenchmarkPolicyRepository_List_RoleLookups measures List followed by the per-binding role
+// lookups callers need to render full policies
+func BenchmarkPolicyRepository_List_RoleLookups(b *testing.B) {
+	db := setupTestDB(b)
+	parent := seedPolicies(b, db, 20, 5)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+	queries := countQueries(b, db)
+
+	b.ResetTimer()
+	queries.Store(0)
+	for i := 0; i < b.N; i++ {
+		policies, err := policyRepo.List(&parent.ID, 0, 0)
+		require.NoError(b, err)
+		for _, policy := range policies {
+			for _, binding := range policy.Bindings {
+				_, err := roleRepo.GetByID(binding.RoleID)
+				require.NoError(b, err)
+			}
+		}
+	}
+	b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+}
+
+// BenchmarkPolicyRepository_ListWithDetails measures the same listing done with a constant
+// number of queries
+func BenchmarkPolicyRepository_ListWithDetails(b *testing.B) {
+	db := setupTestDB(b)
+	parent := seedPolicies(b, db, 20, 5)
+	policyRepo := NewPolicyRepository(db)
+	queries := countQueries(b, db)
+
+	b.ResetTimer()
+	queries.Store(0)
+	for i := 0; i < b.N; i++ {
+		policies, err := policyRepo.ListWithDetails(&parent.ID, 0, 0)
+		require.NoError(b, err)
+		require.Len(b, policies, 20)
+	}
+	b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+}
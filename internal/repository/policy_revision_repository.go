@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// PolicyRevisionRepository handles policy revision history
+type PolicyRevisionRepository interface {
+	Create(revision *domain.PolicyRevision) error
+	GetByRevision(policyID uuid.UUID, revision int) (*domain.PolicyRevision, error)
+	List(policyID uuid.UUID, limit, offset int) ([]domain.PolicyRevision, error)
+}
+
+type policyRevisionRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewPolicyRevisionRepository creates a new policy revision repository
+func NewPolicyRevisionRepository(db *gorm.DB, opts ...Option) PolicyRevisionRepository {
+	o := applyOptions(db, opts)
+	return &policyRevisionRepository{db: db, reader: o.reader}
+}
+
+func (r *policyRevisionRepository) Create(revision *domain.PolicyRevision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *policyRevisionRepository) GetByRevision(policyID uuid.UUID, revision int) (*domain.PolicyRevision, error) {
+	var rev domain.PolicyRevision
+	err := r.reader.Where("policy_id = ? AND revision = ?", policyID, revision).First(&rev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// List returns revisions newest first
+func (r *policyRevisionRepository) List(policyID uuid.UUID, limit, offset int) ([]domain.PolicyRevision, error) {
+	var revisions []domain.PolicyRevision
+	query := r.reader.Model(&domain.PolicyRevision{}).
+		Where("policy_id = ?", policyID).
+		Order("revision DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&revisions).Error
+	return revisions, err
+}
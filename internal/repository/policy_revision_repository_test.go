@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyRevisionRepository_CreateAndGet(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPolicyRevisionRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	roleRepo := NewRoleRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "history"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+
+	policy := &domain.Policy{
+		ResourceID: resource.ID,
+		Version:    1,
+		Bindings: []domain.Binding{
+			{RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)},
+		},
+	}
+	require.NoError(t, policyRepo.Create(policy))
+
+	revision, err := domain.NewPolicyRevision(policy, "user:admin@example.com")
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(revision))
+
+	retrieved, err := repo.GetByRevision(policy.ID, 1)
+	assert.NoError(t, err)
+	require.NotNil(t, retrieved)
+	assert.Equal(t, policy.ETag, retrieved.ETag)
+	assert.Equal(t, "user:admin@example.com", retrieved.Author)
+
+	bindings, err := retrieved.ToBindings()
+	assert.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, role.ID, bindings[0].RoleID)
+	granted, err := bindings[0].HasMember("user:alice@example.com")
+	assert.NoError(t, err)
+	assert.True(t, granted)
+
+	// Unknown revision
+	missing, err := repo.GetByRevision(policy.ID, 99)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestPolicyRevisionRepository_List(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPolicyRevisionRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "history"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	for version := 1; version <= 3; version++ {
+		policy.Version = version
+		revision, err := domain.NewPolicyRevision(policy, "")
+		require.NoError(t, err)
+		require.NoError(t, repo.Create(revision))
+	}
+
+	// Newest first
+	revisions, err := repo.List(policy.ID, 0, 0)
+	assert.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, 3, revisions[0].Revision)
+	assert.Equal(t, 1, revisions[2].Revision)
+
+	// Pagination
+	revisions, err = repo.List(policy.ID, 1, 1)
+	assert.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, 2, revisions[0].Revision)
+}
+
+func TestPolicyRevisionRepository_Immutable(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPolicyRevisionRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "project", Name: "history"}
+	require.NoError(t, resourceRepo.Create(resource))
+
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	revision, err := domain.NewPolicyRevision(policy, "")
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(revision))
+
+	revision.Author = "user:mallory@example.com"
+	assert.ErrorIs(t, db.Save(revision).Error, domain.ErrRevisionImmutable)
+	assert.ErrorIs(t, db.Delete(revision).Error, domain.ErrRevisionImmutable)
+}
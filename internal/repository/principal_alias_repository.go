@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// PrincipalAliasRepository stores the alias identities linked to canonical principals
+type PrincipalAliasRepository interface {
+	Create(alias *domain.PrincipalAlias) error
+	GetByAlias(alias string) (*domain.PrincipalAlias, error)
+	Delete(alias string) error
+	List(principal string, limit, offset int) ([]domain.PrincipalAlias, error)
+	AliasesOf(principal string) ([]string, error)
+}
+
+type principalAliasRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewPrincipalAliasRepository creates a new principal alias repository
+func NewPrincipalAliasRepository(db *gorm.DB, opts ...Option) PrincipalAliasRepository {
+	o := applyOptions(db, opts)
+	return &principalAliasRepository{db: db, reader: o.reader}
+}
+
+func (r *principalAliasRepository) Create(alias *domain.PrincipalAlias) error {
+	return r.db.Create(alias).Error
+}
+
+// GetByAlias reads from the primary so links are checked against the latest state
+func (r *principalAliasRepository) GetByAlias(alias string) (*domain.PrincipalAlias, error) {
+	var link domain.PrincipalAlias
+	err := r.db.Where("alias = ?", alias).First(&link).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *principalAliasRepository) Delete(alias string) error {
+	return r.db.Where("alias = ?", alias).Delete(&domain.PrincipalAlias{}).Error
+}
+
+// List returns links ordered by alias, optionally only those of a canonical principal
+func (r *principalAliasRepository) List(principal string, limit, offset int) ([]domain.PrincipalAlias, error) {
+	var links []domain.PrincipalAlias
+	query := r.reader.Model(&domain.PrincipalAlias{}).Order("alias")
+
+	if principal != "" {
+		query = query.Where("principal = ?", principal)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&links).Error
+	return links, err
+}
+
+// AliasesOf returns the identities linked to principal, excluding principal itself: the
+// aliases of a canonical principal, or the canonical principal and its other aliases
+func (r *principalAliasRepository) AliasesOf(principal string) ([]string, error) {
+	return linkedPrincipals(r.reader, principal)
+}
+
+// linkedPrincipals returns the identities linked to principal through principal_aliases,
+// excluding principal itself
+func linkedPrincipals(db *gorm.DB, principal string) ([]string, error) {
+	var links []domain.PrincipalAlias
+	err := db.Where("principal = ? OR alias = ? OR principal IN (?)", principal, principal,
+		db.Model(&domain.PrincipalAlias{}).Select("principal").Where("alias = ?", principal)).
+		Order("alias").Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{principal: true}
+	var linked []string
+	for _, link := range links {
+		for _, identity := range []string{link.Principal, link.Alias} {
+			if !seen[identity] {
+				seen[identity] = true
+				linked = append(linked, identity)
+			}
+		}
+	}
+	return linked, nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipalAliasRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPrincipalAliasRepository(db)
+
+	const canonical = "user:alice@corp.example.com"
+	require.NoError(t, repo.Create(&domain.PrincipalAlias{Alias: "user:alice@example.com", Principal: canonical}))
+	require.NoError(t, repo.Create(&domain.PrincipalAlias{Alias: "user:alice@legacy.example.com", Principal: canonical}))
+	require.NoError(t, repo.Create(&domain.PrincipalAlias{Alias: "user:bob@example.com", Principal: "user:bob@corp.example.com"}))
+
+	// Aliases are unique
+	assert.Error(t, repo.Create(&domain.PrincipalAlias{Alias: "user:alice@example.com", Principal: "user:other@example.com"}))
+
+	found, err := repo.GetByAlias("user:alice@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, canonical, found.Principal)
+
+	missing, err := repo.GetByAlias(canonical)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	all, err := repo.List("", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	links, err := repo.List(canonical, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "user:alice@example.com", links[0].Alias)
+
+	// A canonical principal is linked to its aliases, and an alias to the canonical principal
+	// and the other aliases
+	linked, err := repo.AliasesOf(canonical)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user:alice@example.com", "user:alice@legacy.example.com"}, linked)
+
+	linked, err = repo.AliasesOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{canonical, "user:alice@legacy.example.com"}, linked)
+
+	linked, err = repo.AliasesOf("user:carol@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, linked)
+
+	require.NoError(t, repo.Delete("user:alice@example.com"))
+	linked, err = repo.AliasesOf(canonical)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user:alice@legacy.example.com"}, linked)
+}
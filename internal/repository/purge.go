@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize is the number of rows hard-deleted per transaction by PurgeDeleted
+const purgeBatchSize = 500
+
+// purgePolicies hard-deletes policies with all of their bindings and conditions, deleted or not
+func purgePolicies(tx *gorm.DB, policyIDs []uuid.UUID) error {
+	if len(policyIDs) == 0 {
+		return nil
+	}
+	err := tx.Exec("DELETE FROM conditions WHERE binding_id IN (SELECT id FROM bindings WHERE policy_id IN ?)", policyIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to purge conditions: %w", err)
+	}
+	err = tx.Exec("DELETE FROM evaluation_grants WHERE binding_id IN (SELECT id FROM bindings WHERE policy_id IN ?)", policyIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to purge evaluation grants: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM bindings WHERE policy_id IN ?", policyIDs).Error; err != nil {
+		return fmt.Errorf("failed to purge bindings: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM policies WHERE id IN ?", policyIDs).Error; err != nil {
+		return fmt.Errorf("failed to purge policies: %w", err)
+	}
+	return nil
+}
@@ -2,40 +2,124 @@ package repository
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"gorm.io/gorm"
 )
 
-// ResourceRepository handles resource data operations
+// ResourceRepository handles resource data operations. List returns resources oldest first, ties
+// broken by ID, so that its pages are stable.
 type ResourceRepository interface {
 	Create(resource *domain.Resource) error
+	// CreateWithPolicy creates a resource and its policy, with the policy's bindings, in one transaction
+	CreateWithPolicy(resource *domain.Resource, policy *domain.Policy) error
 	GetByID(id uuid.UUID) (*domain.Resource, error)
+	// Update saves a resource; it fails with ErrETagMismatch when the resource changed since it was read
 	Update(resource *domain.Resource) error
 	Delete(id uuid.UUID) error
-	List(parentID *uuid.UUID, resourceType string, limit, offset int) ([]domain.Resource, error)
+	List(parentID *uuid.UUID, resourceType string, attributes map[string]interface{}, tags map[string]string, limit, offset int) ([]domain.Resource, error)
+	// PatchAttributes applies a merge patch to the attributes of a resource (see
+	// domain.Attributes.Patch) in one transaction, so concurrent patches of different keys all apply
+	PatchAttributes(id uuid.UUID, patch map[string]interface{}, updatedBy string) error
+	// SetTags replaces the tags of a resource, recording updatedBy as its latest editor
+	SetTags(id uuid.UUID, tags map[string]string, updatedBy string) error
 	GetChildren(id uuid.UUID) ([]domain.Resource, error)
+	// ListByName returns the resources named name under parentID, or the roots named name when
+	// parentID is nil, reading the primary. Names are not unique, so several may be returned.
+	ListByName(parentID *uuid.UUID, name string) ([]domain.Resource, error)
 	GetAncestors(id uuid.UUID) ([]domain.Resource, error)
 	GetDescendants(id uuid.UUID) ([]domain.Resource, error)
+	ListChanges(since time.Time, after uuid.UUID, limit int) ([]ResourceChange, error)
+	GetSnapshot(root uuid.UUID) (*ResourceSnapshot, error)
+	GetDeleted(id uuid.UUID) (*domain.Resource, error)
+	Undelete(id uuid.UUID) error
+	PurgeDeleted(before time.Time) (int64, error)
 }
 
+// ResourceChange is a resource whose row or policy changed at ChangedAt. Deleted resources are
+// included so that consumers of the change feed can drop them.
+type ResourceChange struct {
+	Resource  domain.Resource // With its parent
+	Policy    *domain.Policy  // With bindings, roles, permissions and conditions; nil if it has none
+	ChangedAt time.Time
+}
+
+// ResourceSnapshot is a subtree, with the ancestors it inherits from, read in one transaction
+type ResourceSnapshot struct {
+	Resources []domain.Resource // The root's ancestors, the root and its descendants, with their tags
+	Policies  []domain.Policy   // Of those resources, with bindings, roles, permissions and conditions
+	Roles     []domain.Role     // Granted by the policies, with their permissions
+	Revision  int64             // Time of the last change to any resource, policy or role, in nanoseconds since the epoch
+}
+
+// DefaultMaxHierarchyDepth is the maximum hierarchy depth used when none is configured
+const DefaultMaxHierarchyDepth = 32
+
 type resourceRepository struct {
-	db *gorm.DB
+	db       *gorm.DB
+	reader   *gorm.DB
+	maxDepth int
+	closure  bool // Read subtrees from resource_closure
 }
 
 // NewResourceRepository creates a new resource repository
-func NewResourceRepository(db *gorm.DB) ResourceRepository {
-	return &resourceRepository{db: db}
+func NewResourceRepository(db *gorm.DB, opts ...Option) ResourceRepository {
+	return NewResourceRepositoryWithMaxDepth(db, DefaultMaxHierarchyDepth, opts...)
+}
+
+// NewResourceRepositoryWithMaxDepth creates a new resource repository that rejects
+// hierarchies deeper than maxDepth levels (a root resource has depth 1)
+func NewResourceRepositoryWithMaxDepth(db *gorm.DB, maxDepth int, opts ...Option) ResourceRepository {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxHierarchyDepth
+	}
+	o := applyOptions(db, opts)
+	return &resourceRepository{db: db, reader: o.reader, maxDepth: maxDepth, closure: o.closure}
 }
 
 func (r *resourceRepository) Create(resource *domain.Resource) error {
-	return r.db.Create(resource).Error
+	return r.CreateWithPolicy(resource, nil)
+}
+
+func (r *resourceRepository) CreateWithPolicy(resource *domain.Resource, policy *domain.Policy) error {
+	if err := r.validateHierarchy(resource, false); err != nil {
+		return err
+	}
+	if resource.ID == uuid.Nil {
+		resource.ID = uuid.New()
+	}
+
+	path, err := r.pathOf(r.db, resource)
+	if err != nil {
+		return err
+	}
+	resource.Path = path
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(resource).Error; err != nil {
+			return err
+		}
+		if err := r.linkSubtree(tx, resource.ID, resource.ParentID); err != nil {
+			return err
+		}
+		if policy == nil {
+			return nil
+		}
+
+		policy.ResourceID = resource.ID
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "policy_id = ?", policy.ID)
+	})
 }
 
 func (r *resourceRepository) GetByID(id uuid.UUID) (*domain.Resource, error) {
 	var resource domain.Resource
-	err := r.db.Preload("Parent").First(&resource, id).Error
+	err := r.reader.Preload("Parent").Preload("Tags").First(&resource, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -45,17 +129,310 @@ func (r *resourceRepository) GetByID(id uuid.UUID) (*domain.Resource, error) {
 	return &resource, nil
 }
 
+// GetDeleted gets a soft-deleted resource; nil when it does not exist or is not deleted
+func (r *resourceRepository) GetDeleted(id uuid.UUID) (*domain.Resource, error) {
+	var resource domain.Resource
+	err := r.reader.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&resource).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// Undelete restores a soft-deleted resource whose parent is not deleted and links its subtree
+// back to its ancestors. Descendants deleted on their own stay deleted.
+func (r *resourceRepository) Undelete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var resource domain.Resource
+		err := tx.Unscoped().Select("id", "parent_id").Where("id = ? AND deleted_at IS NOT NULL", id).First(&resource).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("deleted resource not found: %s", id)
+			}
+			return err
+		}
+
+		if resource.ParentID != nil {
+			var parents int64
+			if err := tx.Model(&domain.Resource{}).Where("id = ?", *resource.ParentID).Count(&parents).Error; err != nil {
+				return err
+			}
+			if parents == 0 {
+				return fmt.Errorf("parent resource %s is deleted", *resource.ParentID)
+			}
+		}
+
+		err = tx.Unscoped().Model(&domain.Resource{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		return r.linkSubtree(tx, id, resource.ParentID)
+	})
+}
+
+// PurgeDeleted hard-deletes resources deleted before the given time together with their tags,
+// closure rows, policy, bindings and conditions, and returns the number of purged resources.
+// A deleted resource is kept while another resource, deleted or not, still has it as parent.
+func (r *resourceRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	for {
+		var ids []uuid.UUID
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(&domain.Resource{}).
+				Where("deleted_at < ?", before).
+				Where("NOT EXISTS (SELECT 1 FROM resources AS child WHERE child.parent_id = resources.id)").
+				Limit(purgeBatchSize).Pluck("id", &ids).Error
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+
+			var policyIDs []uuid.UUID
+			if err := tx.Unscoped().Model(&domain.Policy{}).Where("resource_id IN ?", ids).Pluck("id", &policyIDs).Error; err != nil {
+				return err
+			}
+			if err := purgePolicies(tx, policyIDs); err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM resource_closure WHERE ancestor_id IN ? OR descendant_id IN ?", ids, ids).Error; err != nil {
+				return fmt.Errorf("failed to purge resource closure: %w", err)
+			}
+			// Tags are removed by ON DELETE CASCADE
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&domain.Resource{}).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += int64(len(ids))
+		// Purging leaves may make their deleted parents purgeable in the next round
+		if len(ids) == 0 {
+			return purged, nil
+		}
+	}
+}
+
 func (r *resourceRepository) Update(resource *domain.Resource) error {
-	return r.db.Save(resource).Error
+	if err := r.validateHierarchy(resource, true); err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var current domain.Resource
+		err := forUpdate(tx).Select("id", "parent_id", "path", "e_tag").Where("id = ?", resource.ID).Limit(1).Find(&current).Error
+		if err != nil {
+			return fmt.Errorf("failed to get resource: %w", err)
+		}
+		if current.ID != uuid.Nil && resource.ETag != "" && current.ETag != resource.ETag {
+			return fmt.Errorf("resource has been modified, %w", ErrETagMismatch)
+		}
+		oldPath := current.Path
+
+		path, err := r.pathOf(tx, resource)
+		if err != nil {
+			return err
+		}
+		resource.Path = path
+
+		// Tags are replaced with SetTags only
+		if err := tx.Omit("Tags").Save(resource).Error; err != nil {
+			return err
+		}
+
+		if current.ID != uuid.Nil && !sameParent(current.ParentID, resource.ParentID) {
+			if err := r.detachSubtree(tx, resource.ID); err != nil {
+				return err
+			}
+			if err := r.linkSubtree(tx, resource.ID, resource.ParentID); err != nil {
+				return err
+			}
+		}
+
+		if oldPath == "" || oldPath == path {
+			return nil
+		}
+
+		// Re-parenting moves the whole subtree: rewrite the prefix of every descendant's path
+		err = tx.Unscoped().Model(&domain.Resource{}).
+			Where("path LIKE ? AND id <> ?", oldPath+"%", resource.ID).
+			Update("path", gorm.Expr("? || substr(path, ?)", path, len(oldPath)+1)).Error
+		if err != nil {
+			return fmt.Errorf("failed to update descendant paths: %w", err)
+		}
+		return nil
+	})
+}
+
+// sameParent reports whether two parent references point at the same resource
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// linkSubtree adds closure rows linking the subtree rooted at id (its own row is
+// created if missing) to parentID and every ancestor of parentID
+func (r *resourceRepository) linkSubtree(tx *gorm.DB, id uuid.UUID, parentID *uuid.UUID) error {
+	err := tx.Exec(`
+		INSERT INTO resource_closure (ancestor_id, descendant_id, depth)
+		VALUES (?, ?, 0)
+		ON CONFLICT DO NOTHING
+	`, id, id).Error
+	if err != nil {
+		return fmt.Errorf("failed to link resource: %w", err)
+	}
+
+	if parentID == nil {
+		return nil
+	}
+
+	err = tx.Exec(`
+		INSERT INTO resource_closure (ancestor_id, descendant_id, depth)
+		SELECT a.ancestor_id, d.descendant_id, a.depth + d.depth + 1
+		FROM resource_closure a
+		CROSS JOIN resource_closure d
+		WHERE a.descendant_id = ? AND d.ancestor_id = ?
+		ON CONFLICT DO NOTHING
+	`, *parentID, id).Error
+	if err != nil {
+		return fmt.Errorf("failed to link resource subtree: %w", err)
+	}
+	return nil
+}
+
+// detachSubtree removes the closure rows linking the subtree rooted at id to the
+// ancestors of id, keeping the links within the subtree
+func (r *resourceRepository) detachSubtree(tx *gorm.DB, id uuid.UUID) error {
+	err := tx.Exec(`
+		DELETE FROM resource_closure
+		WHERE descendant_id IN (SELECT descendant_id FROM resource_closure WHERE ancestor_id = ?)
+		  AND ancestor_id IN (SELECT ancestor_id FROM resource_closure WHERE descendant_id = ? AND depth > 0)
+	`, id, id).Error
+	if err != nil {
+		return fmt.Errorf("failed to detach resource subtree: %w", err)
+	}
+	return nil
+}
+
+// pathOf computes the materialized path of a resource from its parent's path
+func (r *resourceRepository) pathOf(db *gorm.DB, resource *domain.Resource) (string, error) {
+	if resource.ParentID == nil {
+		return domain.ResourcePath("", resource.ID), nil
+	}
+
+	var parent domain.Resource
+	if err := db.Select("id", "path").First(&parent, *resource.ParentID).Error; err != nil {
+		return "", fmt.Errorf("failed to get parent resource: %w", err)
+	}
+	if parent.Path != "" {
+		return domain.ResourcePath(parent.Path, resource.ID), nil
+	}
+
+	// Parent predates materialized paths; rebuild its path from the hierarchy
+	ancestors, err := r.ancestorsByHierarchy(db, parent.ID)
+	if err != nil {
+		return "", err
+	}
+	path := ""
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		path = domain.ResourcePath(path, ancestors[i].ID)
+	}
+	return domain.ResourcePath(domain.ResourcePath(path, parent.ID), resource.ID), nil
+}
+
+// validateHierarchy rejects parent assignments that would create a cycle or exceed the max depth
+func (r *resourceRepository) validateHierarchy(resource *domain.Resource, existing bool) error {
+	if resource.ParentID == nil {
+		return nil
+	}
+	parentID := *resource.ParentID
+
+	if parentID == resource.ID {
+		return &HierarchyError{ResourceID: resource.ID, ParentID: parentID, Err: ErrHierarchyCycle}
+	}
+
+	// Validate against the primary so a lagging replica cannot hide a cycle
+	parentAncestors, err := r.ancestors(r.db, parentID)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range parentAncestors {
+		if ancestor.ID == resource.ID {
+			return &HierarchyError{ResourceID: resource.ID, ParentID: parentID, Err: ErrHierarchyCycle}
+		}
+	}
+
+	// Depth of the resource itself: parent's ancestors + parent + resource
+	depth := len(parentAncestors) + 2
+
+	// Moving an existing resource also moves its subtree
+	if existing {
+		height, err := r.subtreeHeight(resource.ID)
+		if err != nil {
+			return err
+		}
+		depth += height
+	}
+
+	if depth > r.maxDepth {
+		return &HierarchyError{
+			ResourceID: resource.ID,
+			ParentID:   parentID,
+			Depth:      depth,
+			MaxDepth:   r.maxDepth,
+			Err:        ErrHierarchyTooDeep,
+		}
+	}
+
+	return nil
+}
+
+// subtreeHeight returns the number of levels below a resource (0 for a leaf)
+func (r *resourceRepository) subtreeHeight(id uuid.UUID) (int, error) {
+	var height int
+
+	if r.closure {
+		err := r.db.Model(&domain.ResourceClosure{}).
+			Select("COALESCE(MAX(depth), 0)").
+			Where("ancestor_id = ?", id).
+			Scan(&height).Error
+		return height, err
+	}
+
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT id, 0 AS depth
+			FROM resources
+			WHERE id = ?
+			UNION ALL
+			SELECT r.id, d.depth + 1
+			FROM resources r
+			INNER JOIN descendants d ON r.parent_id = d.id
+			WHERE r.deleted_at IS NULL AND d.depth < ?
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM descendants
+	`
+
+	err := r.db.Raw(query, id, r.maxDepth).Scan(&height).Error
+	return height, err
 }
 
 func (r *resourceRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&domain.Resource{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&domain.Resource{}, id).Error; err != nil {
+			return err
+		}
+		// Descendants of a deleted resource are no longer reachable from its ancestors
+		return r.detachSubtree(tx, id)
+	})
 }
 
-func (r *resourceRepository) List(parentID *uuid.UUID, resourceType string, limit, offset int) ([]domain.Resource, error) {
+func (r *resourceRepository) List(parentID *uuid.UUID, resourceType string, attributes map[string]interface{}, tags map[string]string, limit, offset int) ([]domain.Resource, error) {
 	var resources []domain.Resource
-	query := r.db.Model(&domain.Resource{})
+	query := r.reader.Model(&domain.Resource{}).Preload("Tags")
 
 	if parentID != nil {
 		query = query.Where("parent_id = ?", parentID)
@@ -65,6 +442,19 @@ func (r *resourceRepository) List(parentID *uuid.UUID, resourceType string, limi
 		query = query.Where("type = ?", resourceType)
 	}
 
+	if len(attributes) > 0 {
+		// JSONB containment: every given key/value must be present on the resource
+		query = jsonObjectContains(query, "attributes", attributes)
+	}
+
+	// Every given tag must be set on the resource; served by idx_resource_tags_key_value
+	for key, value := range tags {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM resource_tags WHERE resource_tags.resource_id = resources.id AND resource_tags.key = ? AND resource_tags.value = ?)",
+			key, value,
+		)
+	}
+
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -73,56 +463,339 @@ func (r *resourceRepository) List(parentID *uuid.UUID, resourceType string, limi
 		query = query.Offset(offset)
 	}
 
-	err := query.Find(&resources).Error
+	err := byCreation(query, "resources").Find(&resources).Error
 	return resources, err
 }
 
+// PatchAttributes applies a merge patch to the attributes of a resource (see
+// domain.Attributes.Patch). The row is locked while the patch is applied, so concurrent patches
+// of different keys are all kept.
+func (r *resourceRepository) PatchAttributes(id uuid.UUID, patch map[string]interface{}, updatedBy string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var resource domain.Resource
+		err := forUpdate(tx).Select("id", "attributes").First(&resource, "id = ?", id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("resource not found: %s", id)
+			}
+			return err
+		}
+
+		return tx.Model(&domain.Resource{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"attributes": resource.Attributes.Patch(patch),
+			"updated_at": time.Now(),
+			"updated_by": updatedBy,
+		}).Error
+	})
+}
+
+// SetTags replaces the tags of a resource and bumps its update time
+func (r *resourceRepository) SetTags(id uuid.UUID, tags map[string]string, updatedBy string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.Resource{}).Where("id = ?", id).
+			Updates(map[string]interface{}{"updated_at": time.Now(), "updated_by": updatedBy})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update resource: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("resource not found: %s", id)
+		}
+
+		if err := tx.Where("resource_id = ?", id).Delete(&domain.ResourceTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete resource tags: %w", err)
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+
+		rows := make([]domain.ResourceTag, 0, len(tags))
+		for key, value := range tags {
+			rows = append(rows, domain.ResourceTag{ResourceID: id, Key: key, Value: value})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("failed to create resource tags: %w", err)
+		}
+		return nil
+	})
+}
+
 func (r *resourceRepository) GetChildren(id uuid.UUID) ([]domain.Resource, error) {
 	var children []domain.Resource
-	err := r.db.Where("parent_id = ?", id).Find(&children).Error
+	err := r.reader.Where("parent_id = ?", id).Find(&children).Error
 	return children, err
 }
 
+func (r *resourceRepository) ListByName(parentID *uuid.UUID, name string) ([]domain.Resource, error) {
+	var resources []domain.Resource
+	query := r.db.Where("name = ?", name)
+	if parentID != nil {
+		query = query.Where("parent_id = ?", *parentID)
+	} else {
+		query = query.Where("parent_id IS NULL")
+	}
+	err := byCreation(query, "resources").Find(&resources).Error
+	return resources, err
+}
+
+// GetAncestors returns the ancestors of a resource ordered from its parent to the root
 func (r *resourceRepository) GetAncestors(id uuid.UUID) ([]domain.Resource, error) {
+	return r.ancestors(r.reader, id)
+}
+
+// ancestors reads the ancestors named by the resource's materialized path, falling back
+// to walking the hierarchy for resources whose path has not been set
+func (r *resourceRepository) ancestors(db *gorm.DB, id uuid.UUID) ([]domain.Resource, error) {
+	var resource domain.Resource
+	if err := db.Select("id", "path").First(&resource, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ids, err := resource.AncestorIDs()
+	if err != nil {
+		return nil, err
+	}
+	if resource.Path == "" {
+		return r.ancestorsByHierarchy(db, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var found []domain.Resource
+	if err := db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]domain.Resource, len(found))
+	for _, ancestor := range found {
+		byID[ancestor.ID] = ancestor
+	}
+
+	// Like the hierarchy walk, stop at the first deleted ancestor
+	ancestors := make([]domain.Resource, 0, len(ids))
+	for _, ancestorID := range ids {
+		ancestor, ok := byID[ancestorID]
+		if !ok {
+			break
+		}
+		ancestors = append(ancestors, ancestor)
+	}
+	return ancestors, nil
+}
+
+// ancestorsByHierarchy walks parent links, ordered from parent to root
+func (r *resourceRepository) ancestorsByHierarchy(db *gorm.DB, id uuid.UUID) ([]domain.Resource, error) {
 	var ancestors []domain.Resource
 
-	// Use recursive CTE to get all ancestors
+	// Use recursive CTE to get all ancestors (bounded by max depth to survive corrupt cyclic data)
 	query := `
 		WITH RECURSIVE ancestors AS (
-			SELECT id, type, name, parent_id, attributes, created_at, updated_at, deleted_at
+			SELECT id, type, name, parent_id, path, attributes, created_at, updated_at, deleted_at, 0 AS depth
 			FROM resources
 			WHERE id = ?
 			UNION ALL
-			SELECT r.id, r.type, r.name, r.parent_id, r.attributes, r.created_at, r.updated_at, r.deleted_at
+			SELECT r.id, r.type, r.name, r.parent_id, r.path, r.attributes, r.created_at, r.updated_at, r.deleted_at, a.depth + 1
 			FROM resources r
 			INNER JOIN ancestors a ON r.id = a.parent_id
-			WHERE r.deleted_at IS NULL
+			WHERE r.deleted_at IS NULL AND a.depth < ?
 		)
-		SELECT * FROM ancestors WHERE id != ?
+		SELECT id, type, name, parent_id, path, attributes, created_at, updated_at, deleted_at
+		FROM ancestors
+		WHERE id != ?
+		ORDER BY depth
 	`
 
-	err := r.db.Raw(query, id, id).Scan(&ancestors).Error
+	err := db.Raw(query, id, r.maxDepth, id).Scan(&ancestors).Error
 	return ancestors, err
 }
 
 func (r *resourceRepository) GetDescendants(id uuid.UUID) ([]domain.Resource, error) {
+	return r.descendants(r.reader, id)
+}
+
+// descendants reads the descendants of a resource, nearest first when the closure table is used
+func (r *resourceRepository) descendants(db *gorm.DB, id uuid.UUID) ([]domain.Resource, error) {
 	var descendants []domain.Resource
 
-	// Use recursive CTE to get all descendants
+	if r.closure {
+		err := db.
+			Joins("INNER JOIN resource_closure rc ON rc.descendant_id = resources.id").
+			Where("rc.ancestor_id = ? AND rc.depth BETWEEN 1 AND ?", id, r.maxDepth).
+			Order("rc.depth").
+			Find(&descendants).Error
+		return descendants, err
+	}
+
+	// Use recursive CTE to get all descendants (bounded by max depth to survive corrupt cyclic data)
 	query := `
 		WITH RECURSIVE descendants AS (
-			SELECT id, type, name, parent_id, attributes, created_at, updated_at, deleted_at
+			SELECT id, type, name, parent_id, path, attributes, created_at, updated_at, deleted_at, 0 AS depth
 			FROM resources
 			WHERE id = ?
 			UNION ALL
-			SELECT r.id, r.type, r.name, r.parent_id, r.attributes, r.created_at, r.updated_at, r.deleted_at
+			SELECT r.id, r.type, r.name, r.parent_id, r.path, r.attributes, r.created_at, r.updated_at, r.deleted_at, d.depth + 1
 			FROM resources r
 			INNER JOIN descendants d ON r.parent_id = d.id
-			WHERE r.deleted_at IS NULL
+			WHERE r.deleted_at IS NULL AND d.depth < ?
 		)
-		SELECT * FROM descendants WHERE id != ?
+		SELECT id, type, name, parent_id, path, attributes, created_at, updated_at, deleted_at FROM descendants WHERE id != ?
 	`
 
-	err := r.db.Raw(query, id, id).Scan(&descendants).Error
+	err := db.Raw(query, id, r.maxDepth, id).Scan(&descendants).Error
 	return descendants, err
 }
+
+// snapshotChunkSize is the number of resources whose tags and policies are read per query by GetSnapshot
+const snapshotChunkSize = 1000
+
+// GetSnapshot reads the subtree of root and its ancestors from the primary in one read-only
+// transaction, so the resources, policies and revision are consistent with each other. It
+// returns nil when root does not exist.
+func (r *resourceRepository) GetSnapshot(root uuid.UUID) (*ResourceSnapshot, error) {
+	var snapshot *ResourceSnapshot
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var resource domain.Resource
+		if err := tx.First(&resource, root).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		ancestors, err := r.ancestors(tx, root)
+		if err != nil {
+			return fmt.Errorf("failed to get ancestors: %w", err)
+		}
+		descendants, err := r.descendants(tx, root)
+		if err != nil {
+			return fmt.Errorf("failed to get descendants: %w", err)
+		}
+
+		snapshot = &ResourceSnapshot{Resources: make([]domain.Resource, 0, len(ancestors)+1+len(descendants))}
+		snapshot.Resources = append(snapshot.Resources, ancestors...)
+		snapshot.Resources = append(snapshot.Resources, resource)
+		snapshot.Resources = append(snapshot.Resources, descendants...)
+
+		byID := make(map[uuid.UUID]*domain.Resource, len(snapshot.Resources))
+		ids := make([]uuid.UUID, len(snapshot.Resources))
+		for i := range snapshot.Resources {
+			byID[snapshot.Resources[i].ID] = &snapshot.Resources[i]
+			ids[i] = snapshot.Resources[i].ID
+		}
+		for start := 0; start < len(ids); start += snapshotChunkSize {
+			chunk := ids[start:min(start+snapshotChunkSize, len(ids))]
+
+			var tags []domain.ResourceTag
+			if err := tx.Where("resource_id IN ?", chunk).Find(&tags).Error; err != nil {
+				return fmt.Errorf("failed to get tags: %w", err)
+			}
+			for _, tag := range tags {
+				byID[tag.ResourceID].Tags = append(byID[tag.ResourceID].Tags, tag)
+			}
+
+			var policies []domain.Policy
+			err := tx.Preload("Bindings").Preload("Bindings.Role").Preload("Bindings.Role.Permissions").
+				Preload("Bindings.Condition").Where("resource_id IN ?", chunk).Find(&policies).Error
+			if err != nil {
+				return fmt.Errorf("failed to get policies: %w", err)
+			}
+			snapshot.Policies = append(snapshot.Policies, policies...)
+		}
+
+		seen := make(map[uuid.UUID]bool)
+		for i := range snapshot.Policies {
+			for _, binding := range snapshot.Policies[i].Bindings {
+				if binding.Role != nil && !seen[binding.Role.ID] {
+					seen[binding.Role.ID] = true
+					snapshot.Roles = append(snapshot.Roles, *binding.Role)
+				}
+			}
+		}
+
+		snapshot.Revision, err = revision(tx)
+		return err
+	}, snapshotTxOptions(r.db))
+	return snapshot, err
+}
+
+// revision returns the time of the last change to a resource, policy or role, which only grows
+// as changes commit
+func revision(db *gorm.DB) (int64, error) {
+	var latest int64
+	for _, table := range []string{"resources", "policies", "roles"} {
+		var changedAt scannedTime
+		query := "SELECT MAX(" + greatest(db, "updated_at", "deleted_at") + ") FROM " + table
+		if err := db.Raw(query).Row().Scan(&changedAt); err != nil {
+			return 0, fmt.Errorf("failed to get revision of %s: %w", table, err)
+		}
+		if !changedAt.IsZero() {
+			latest = max(latest, changedAt.UnixNano())
+		}
+	}
+	return latest, nil
+}
+
+// ListChanges returns up to limit resources changed after (since, after), ordered by change time and
+// ID so that the last change of a page is the position of the next one. A resource changes when it
+// is created, updated or deleted and when its policy is.
+func (r *resourceRepository) ListChanges(since time.Time, after uuid.UUID, limit int) ([]ResourceChange, error) {
+	var page []struct {
+		ID        uuid.UUID
+		ChangedAt scannedTime
+	}
+	// NULLs are ignored, so missing policies and deletion times do not count
+	query := `
+		SELECT id, changed_at FROM (
+			SELECT r.id, ` + greatest(r.reader, "r.updated_at", "r.deleted_at", "p.updated_at", "p.deleted_at") + ` AS changed_at
+			FROM resources r
+			LEFT JOIN policies p ON p.resource_id = r.id
+		) changes
+		WHERE changed_at > ? OR (changed_at = ? AND id > ?)
+		ORDER BY changed_at, id
+		LIMIT ?
+	`
+	if err := r.reader.Raw(query, since, since, after, limit).Scan(&page).Error; err != nil {
+		return nil, fmt.Errorf("failed to list resource changes: %w", err)
+	}
+	if len(page) == 0 {
+		return []ResourceChange{}, nil
+	}
+
+	ids := make([]uuid.UUID, len(page))
+	for i, row := range page {
+		ids[i] = row.ID
+	}
+
+	var resources []domain.Resource
+	err := r.reader.Unscoped().Preload("Parent", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("id IN ?", ids).Find(&resources).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed resources: %w", err)
+	}
+	var policies []domain.Policy
+	err = r.reader.Preload("Bindings").Preload("Bindings.Role").Preload("Bindings.Role.Permissions").
+		Preload("Bindings.Condition").Where("resource_id IN ?", ids).Find(&policies).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed policies: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*domain.Resource, len(resources))
+	for i := range resources {
+		byID[resources[i].ID] = &resources[i]
+	}
+	policyOf := make(map[uuid.UUID]*domain.Policy, len(policies))
+	for i := range policies {
+		policyOf[policies[i].ResourceID] = &policies[i]
+	}
+
+	changes := make([]ResourceChange, 0, len(page))
+	for _, row := range page {
+		resource, ok := byID[row.ID]
+		if !ok {
+			continue
+		}
+		changes = append(changes, ResourceChange{Resource: *resource, Policy: policyOf[row.ID], ChangedAt: row.ChangedAt.Time})
+	}
+	return changes, nil
+}
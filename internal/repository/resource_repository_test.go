@@ -2,11 +2,13 @@ package repository
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
 )
 
 func TestResourceRepository_Create(t *testing.T) {
@@ -16,7 +18,7 @@ func TestResourceRepository_Create(t *testing.T) {
 	resource := &domain.Resource{
 		Type: "project",
 		Name: "my-project",
-		Attributes: map[string]string{
+		Attributes: map[string]interface{}{
 			"region": "us-west-1",
 		},
 	}
@@ -50,6 +52,42 @@ func TestResourceRepository_Create_WithParent(t *testing.T) {
 	assert.Equal(t, parent.ID, *child.ParentID)
 }
 
+func TestResourceRepository_CreateWithPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+	roleRepo := NewRoleRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	read := &domain.Permission{Name: "storage.objects.get", Service: "storage"}
+	require.NoError(t, permRepo.Create(read))
+	role := &domain.Role{Name: "roles/owner", Title: "Owner"}
+	require.NoError(t, roleRepo.Create(role))
+	require.NoError(t, roleRepo.AddPermissions(role.ID, []uuid.UUID{read.ID}))
+
+	resource := &domain.Resource{Type: "project", Name: "my-project"}
+	policy := &domain.Policy{Version: 1, Bindings: []domain.Binding{
+		{RoleID: role.ID, Members: datatypes.JSON(`["user:alice@example.com"]`)},
+	}}
+	require.NoError(t, repo.CreateWithPolicy(resource, policy))
+	assert.Equal(t, resource.ID, policy.ResourceID)
+
+	stored, err := NewPolicyRepository(db).GetByResourceID(resource.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	require.Len(t, stored.Bindings, 1)
+	grants, err := NewEvaluationGrantRepository(db).Lookup([]uuid.UUID{resource.ID}, "storage.objects.get", []string{"user:alice@example.com"})
+	require.NoError(t, err)
+	assert.Len(t, grants, 1)
+
+	// A binding that cannot be created, here without members, rolls the resource back
+	orphan := &domain.Resource{Type: "project", Name: "orphan"}
+	invalid := &domain.Policy{Bindings: []domain.Binding{{RoleID: role.ID}}}
+	assert.Error(t, repo.CreateWithPolicy(orphan, invalid))
+	found, err := repo.GetByID(orphan.ID)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
+
 func TestResourceRepository_GetByID(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewResourceRepository(db)
@@ -58,7 +96,7 @@ func TestResourceRepository_GetByID(t *testing.T) {
 	resource := &domain.Resource{
 		Type: "bucket",
 		Name: "data-bucket",
-		Attributes: map[string]string{
+		Attributes: map[string]interface{}{
 			"location": "europe-west1",
 		},
 	}
@@ -127,7 +165,7 @@ func TestResourceRepository_Update(t *testing.T) {
 
 	// Update the resource
 	resource.Name = "web-server-updated"
-	resource.Attributes = map[string]string{
+	resource.Attributes = map[string]interface{}{
 		"environment": "production",
 	}
 	err = repo.Update(resource)
@@ -184,7 +222,7 @@ func TestResourceRepository_List(t *testing.T) {
 	}
 
 	// List all resources
-	retrieved, err := repo.List(nil, "", 0, 0)
+	retrieved, err := repo.List(nil, "", nil, nil, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 3)
 }
@@ -208,7 +246,7 @@ func TestResourceRepository_List_FilterByType(t *testing.T) {
 	}
 
 	// List only projects
-	retrieved, err := repo.List(nil, "project", 0, 0)
+	retrieved, err := repo.List(nil, "project", nil, nil, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 2)
 	for _, r := range retrieved {
@@ -216,7 +254,7 @@ func TestResourceRepository_List_FilterByType(t *testing.T) {
 	}
 
 	// List only buckets
-	retrieved, err = repo.List(nil, "bucket", 0, 0)
+	retrieved, err = repo.List(nil, "bucket", nil, nil, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 2)
 	for _, r := range retrieved {
@@ -224,6 +262,137 @@ func TestResourceRepository_List_FilterByType(t *testing.T) {
 	}
 }
 
+func TestResourceRepository_List_FilterByAttributes(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	// Create resources with typed attributes
+	resources := []*domain.Resource{
+		{Type: "bucket", Name: "prod-eu", Attributes: map[string]interface{}{"env": "prod", "region": "eu", "replicas": 3}},
+		{Type: "bucket", Name: "prod-us", Attributes: map[string]interface{}{"env": "prod", "region": "us", "replicas": 1}},
+		{Type: "bucket", Name: "dev-eu", Attributes: map[string]interface{}{"env": "dev", "region": "eu", "public": true}},
+		{Type: "bucket", Name: "no-attrs"},
+	}
+
+	for _, resource := range resources {
+		require.NoError(t, repo.Create(resource))
+	}
+
+	// Single key/value
+	retrieved, err := repo.List(nil, "", map[string]interface{}{"env": "prod"}, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+
+	// Multiple key/values must all match
+	retrieved, err = repo.List(nil, "", map[string]interface{}{"env": "prod", "region": "eu"}, nil, 0, 0)
+	assert.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, "prod-eu", retrieved[0].Name)
+
+	// Typed (non-string) values round-trip and can be queried
+	retrieved, err = repo.List(nil, "", map[string]interface{}{"public": true}, nil, 0, 0)
+	assert.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, "dev-eu", retrieved[0].Name)
+	assert.Equal(t, true, retrieved[0].Attributes["public"])
+
+	// Combined with type filter
+	retrieved, err = repo.List(nil, "project", map[string]interface{}{"env": "prod"}, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, retrieved)
+}
+
+func TestResourceRepository_SetTags(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	prod := &domain.Resource{Type: "bucket", Name: "prod"}
+	dev := &domain.Resource{Type: "bucket", Name: "dev"}
+	require.NoError(t, repo.Create(prod))
+	require.NoError(t, repo.Create(dev))
+
+	require.NoError(t, repo.SetTags(prod.ID, map[string]string{"env": "prod", "team": "storage"}, ""))
+	require.NoError(t, repo.SetTags(dev.ID, map[string]string{"env": "dev", "team": "storage"}, ""))
+
+	retrieved, err := repo.GetByID(prod.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "storage"}, retrieved.TagMap())
+
+	// Updating the resource keeps its tags
+	retrieved.Name = "prod-renamed"
+	require.NoError(t, repo.Update(retrieved))
+
+	// Filtering by tags
+	listed, err := repo.List(nil, "", nil, map[string]string{"env": "prod"}, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "prod-renamed", listed[0].Name)
+	assert.Equal(t, "storage", listed[0].TagMap()["team"])
+
+	listed, err = repo.List(nil, "", nil, map[string]string{"team": "storage"}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	// Tags are replaced as a whole
+	require.NoError(t, repo.SetTags(prod.ID, map[string]string{"tier": "gold"}, "user:alice@example.com"))
+	retrieved, err = repo.GetByID(prod.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tier": "gold"}, retrieved.TagMap())
+	assert.Equal(t, "user:alice@example.com", retrieved.UpdatedBy)
+
+	require.NoError(t, repo.SetTags(prod.ID, nil, ""))
+	retrieved, err = repo.GetByID(prod.ID)
+	require.NoError(t, err)
+	assert.Empty(t, retrieved.Tags)
+
+	assert.Error(t, repo.SetTags(uuid.New(), map[string]string{"env": "prod"}, ""))
+}
+
+func TestResourceRepository_Update_StaleETag(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "bucket", Name: "data"}
+	require.NoError(t, repo.Create(resource))
+	stale, err := repo.GetByID(resource.ID)
+	require.NoError(t, err)
+
+	// Any change, including to tags, gives the resource a new etag
+	require.NoError(t, repo.SetTags(resource.ID, map[string]string{"env": "prod"}, ""))
+	current, err := repo.GetByID(resource.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, stale.ETag, current.ETag)
+
+	stale.Name = "renamed"
+	assert.ErrorIs(t, repo.Update(stale), ErrETagMismatch)
+
+	current.Name = "renamed"
+	require.NoError(t, repo.Update(current))
+	retrieved, err := repo.GetByID(resource.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", retrieved.Name)
+	assert.Equal(t, current.ETag, retrieved.ETag)
+}
+
+func TestResourceRepository_PatchAttributes(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "bucket", Name: "data", Attributes: domain.Attributes{"region": "eu", "tier": "gold"}}
+	require.NoError(t, repo.Create(resource))
+
+	// Two callers changing different keys from the same read both keep their change
+	require.NoError(t, repo.PatchAttributes(resource.ID, map[string]interface{}{"region": "us"}, "user:alice@example.com"))
+	require.NoError(t, repo.PatchAttributes(resource.ID, map[string]interface{}{"owner": "storage", "tier": nil}, "user:bob@example.com"))
+
+	retrieved, err := repo.GetByID(resource.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Attributes{"region": "us", "owner": "storage"}, retrieved.Attributes)
+	assert.Equal(t, "user:bob@example.com", retrieved.UpdatedBy)
+
+	assert.ErrorContains(t, repo.PatchAttributes(uuid.New(), map[string]interface{}{"region": "us"}, ""), "resource not found")
+}
+
 func TestResourceRepository_List_FilterByParent(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewResourceRepository(db)
@@ -255,7 +424,7 @@ func TestResourceRepository_List_FilterByParent(t *testing.T) {
 	require.NoError(t, err)
 
 	// List children of parent
-	retrieved, err := repo.List(&parent.ID, "", 0, 0)
+	retrieved, err := repo.List(&parent.ID, "", nil, nil, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 2)
 	for _, r := range retrieved {
@@ -278,17 +447,17 @@ func TestResourceRepository_List_WithPagination(t *testing.T) {
 	}
 
 	// Test limit
-	retrieved, err := repo.List(nil, "", 5, 0)
+	retrieved, err := repo.List(nil, "", nil, nil, 5, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 5)
 
 	// Test offset
-	retrieved, err = repo.List(nil, "", 5, 5)
+	retrieved, err = repo.List(nil, "", nil, nil, 5, 5)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 5)
 
 	// Test limit and offset
-	retrieved, err = repo.List(nil, "", 3, 7)
+	retrieved, err = repo.List(nil, "", nil, nil, 3, 7)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 3)
 }
@@ -345,6 +514,32 @@ func TestResourceRepository_GetChildren_NoChildren(t *testing.T) {
 	assert.Empty(t, children)
 }
 
+func TestResourceRepository_ListByName(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	root := &domain.Resource{Type: "organization", Name: "acme"}
+	require.NoError(t, repo.Create(root))
+	child := &domain.Resource{Type: "project", Name: "acme", ParentID: &root.ID}
+	require.NoError(t, repo.Create(child))
+	other := &domain.Resource{Type: "project", Name: "web", ParentID: &root.ID}
+	require.NoError(t, repo.Create(other))
+
+	roots, err := repo.ListByName(nil, "acme")
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	assert.Equal(t, root.ID, roots[0].ID)
+
+	children, err := repo.ListByName(&root.ID, "acme")
+	require.NoError(t, err)
+	require.Len(t, children, 1)
+	assert.Equal(t, child.ID, children[0].ID)
+
+	missing, err := repo.ListByName(&child.ID, "web")
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
 func TestResourceRepository_GetAncestors(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewResourceRepository(db)
@@ -376,15 +571,61 @@ func TestResourceRepository_GetAncestors(t *testing.T) {
 	// Get ancestors of project
 	ancestors, err := repo.GetAncestors(project.ID)
 	assert.NoError(t, err)
-	assert.Len(t, ancestors, 2)
+	require.Len(t, ancestors, 2)
 
-	// Verify ancestor IDs (should be folder and org)
-	ancestorIDs := make(map[uuid.UUID]bool)
-	for _, a := range ancestors {
-		ancestorIDs[a.ID] = true
-	}
-	assert.True(t, ancestorIDs[folder.ID])
-	assert.True(t, ancestorIDs[org.ID])
+	// Ancestors are ordered from parent to root
+	assert.Equal(t, folder.ID, ancestors[0].ID)
+	assert.Equal(t, org.ID, ancestors[1].ID)
+	assert.Equal(t, "/"+org.ID.String()+"/"+folder.ID.String()+"/"+project.ID.String()+"/", project.Path)
+}
+
+func TestResourceRepository_Update_MovesSubtreePaths(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	orgA := &domain.Resource{Type: "organization", Name: "org-a"}
+	require.NoError(t, repo.Create(orgA))
+	orgB := &domain.Resource{Type: "organization", Name: "org-b"}
+	require.NoError(t, repo.Create(orgB))
+	folder := &domain.Resource{Type: "folder", Name: "folder", ParentID: &orgA.ID}
+	require.NoError(t, repo.Create(folder))
+	project := &domain.Resource{Type: "project", Name: "project", ParentID: &folder.ID}
+	require.NoError(t, repo.Create(project))
+
+	// Move the folder, and with it the project, under org B
+	folder.ParentID = &orgB.ID
+	require.NoError(t, repo.Update(folder))
+
+	moved, err := repo.GetByID(project.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "/"+orgB.ID.String()+"/"+folder.ID.String()+"/"+project.ID.String()+"/", moved.Path)
+
+	ancestors, err := repo.GetAncestors(project.ID)
+	require.NoError(t, err)
+	require.Len(t, ancestors, 2)
+	assert.Equal(t, folder.ID, ancestors[0].ID)
+	assert.Equal(t, orgB.ID, ancestors[1].ID)
+}
+
+func TestResourceRepository_GetAncestors_WithoutPath(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	folder := &domain.Resource{Type: "folder", Name: "folder", ParentID: &org.ID}
+	require.NoError(t, repo.Create(folder))
+	project := &domain.Resource{Type: "project", Name: "project", ParentID: &folder.ID}
+	require.NoError(t, repo.Create(project))
+
+	// Rows created before materialized paths fall back to walking the hierarchy
+	require.NoError(t, db.Model(&domain.Resource{}).Where("1 = 1").Update("path", "").Error)
+
+	ancestors, err := repo.GetAncestors(project.ID)
+	require.NoError(t, err)
+	require.Len(t, ancestors, 2)
+	assert.Equal(t, folder.ID, ancestors[0].ID)
+	assert.Equal(t, org.ID, ancestors[1].ID)
 }
 
 func TestResourceRepository_GetAncestors_NoParent(t *testing.T) {
@@ -456,6 +697,48 @@ func TestResourceRepository_GetDescendants(t *testing.T) {
 	assert.True(t, descendantIDs[project2.ID])
 }
 
+func TestResourceRepository_GetDescendants_ClosureTable(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db, WithClosureTable(true))
+	recursive := NewResourceRepository(db)
+
+	// org -> folder -> project, plus a second org
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	otherOrg := &domain.Resource{Type: "organization", Name: "other-org"}
+	require.NoError(t, repo.Create(otherOrg))
+	folder := &domain.Resource{Type: "folder", Name: "folder", ParentID: &org.ID}
+	require.NoError(t, repo.Create(folder))
+	project := &domain.Resource{Type: "project", Name: "project", ParentID: &folder.ID}
+	require.NoError(t, repo.Create(project))
+
+	descendantIDs := func(r ResourceRepository, id uuid.UUID) []uuid.UUID {
+		descendants, err := r.GetDescendants(id)
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, 0, len(descendants))
+		for _, d := range descendants {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uuid.UUID{folder.ID, project.ID}, descendantIDs(repo, org.ID))
+	assert.ElementsMatch(t, descendantIDs(recursive, org.ID), descendantIDs(repo, org.ID))
+
+	// Moving the folder moves the project with it
+	folder.ParentID = &otherOrg.ID
+	require.NoError(t, repo.Update(folder))
+	assert.Empty(t, descendantIDs(repo, org.ID))
+	assert.Equal(t, []uuid.UUID{folder.ID, project.ID}, descendantIDs(repo, otherOrg.ID))
+	assert.ElementsMatch(t, descendantIDs(recursive, otherOrg.ID), descendantIDs(repo, otherOrg.ID))
+
+	// Deleting the folder hides its subtree from the org
+	require.NoError(t, repo.Delete(folder.ID))
+	assert.Empty(t, descendantIDs(repo, otherOrg.ID))
+	assert.ElementsMatch(t, descendantIDs(recursive, otherOrg.ID), descendantIDs(repo, otherOrg.ID))
+	assert.Equal(t, []uuid.UUID{project.ID}, descendantIDs(repo, folder.ID))
+}
+
 func TestResourceRepository_GetDescendants_NoChildren(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewResourceRepository(db)
@@ -524,3 +807,247 @@ func TestResourceRepository_ComplexHierarchy(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, children, 2) // project1 and project2
 }
+
+func TestResourceRepository_Update_RejectsSelfParent(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	resource := &domain.Resource{Type: "folder", Name: "self"}
+	require.NoError(t, repo.Create(resource))
+
+	resource.ParentID = &resource.ID
+	err := repo.Update(resource)
+	assert.ErrorIs(t, err, ErrHierarchyCycle)
+}
+
+func TestResourceRepository_Update_RejectsCycle(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	// Create hierarchy: org -> folder -> project
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+
+	folder := &domain.Resource{Type: "folder", Name: "folder", ParentID: &org.ID}
+	require.NoError(t, repo.Create(folder))
+
+	project := &domain.Resource{Type: "project", Name: "project", ParentID: &folder.ID}
+	require.NoError(t, repo.Create(project))
+
+	// Move org under its own descendant
+	org.ParentID = &project.ID
+	err := repo.Update(org)
+	assert.ErrorIs(t, err, ErrHierarchyCycle)
+
+	var hierarchyErr *HierarchyError
+	require.ErrorAs(t, err, &hierarchyErr)
+	assert.Equal(t, org.ID, hierarchyErr.ResourceID)
+	assert.Equal(t, project.ID, hierarchyErr.ParentID)
+
+	// Verify the stored hierarchy is unchanged
+	ancestors, err := repo.GetAncestors(project.ID)
+	assert.NoError(t, err)
+	assert.Len(t, ancestors, 2)
+}
+
+func TestResourceRepository_MaxDepth(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepositoryWithMaxDepth(db, 3)
+
+	level1 := &domain.Resource{Type: "organization", Name: "l1"}
+	require.NoError(t, repo.Create(level1))
+
+	level2 := &domain.Resource{Type: "folder", Name: "l2", ParentID: &level1.ID}
+	require.NoError(t, repo.Create(level2))
+
+	level3 := &domain.Resource{Type: "project", Name: "l3", ParentID: &level2.ID}
+	require.NoError(t, repo.Create(level3))
+
+	// Fourth level exceeds the limit on create
+	level4 := &domain.Resource{Type: "bucket", Name: "l4", ParentID: &level3.ID}
+	err := repo.Create(level4)
+	assert.ErrorIs(t, err, ErrHierarchyTooDeep)
+
+	// Moving a subtree counts its height too
+	other := &domain.Resource{Type: "organization", Name: "other"}
+	require.NoError(t, repo.Create(other))
+	level1.ParentID = &other.ID
+	err = repo.Update(level1)
+	assert.ErrorIs(t, err, ErrHierarchyTooDeep)
+}
+
+func TestResourceRepository_ListChanges(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+	policyRepo := NewPolicyRepository(db)
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "proj", ParentID: &org.ID}
+	require.NoError(t, repo.Create(project))
+	bucket := &domain.Resource{Type: "bucket", Name: "bucket", ParentID: &project.ID}
+	require.NoError(t, repo.Create(bucket))
+	require.NoError(t, policyRepo.Create(&domain.Policy{ResourceID: project.ID}))
+
+	changes, err := repo.ListChanges(time.Time{}, uuid.Nil, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	for _, change := range changes {
+		if change.Resource.ID == project.ID {
+			assert.NotNil(t, change.Policy)
+		} else {
+			assert.Nil(t, change.Policy)
+		}
+	}
+
+	// Pages continue after the last change
+	first, err := repo.ListChanges(time.Time{}, uuid.Nil, 2)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	last := first[1]
+	rest, err := repo.ListChanges(last.ChangedAt, last.Resource.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, changes[2].Resource.ID, rest[0].Resource.ID)
+
+	// Deletions are changes
+	require.NoError(t, repo.Delete(bucket.ID))
+	changes, err = repo.ListChanges(changes[2].ChangedAt, changes[2].Resource.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, bucket.ID, changes[0].Resource.ID)
+	assert.True(t, changes[0].Resource.DeletedAt.Valid)
+}
+
+func TestResourceRepository_GetSnapshot(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	roleRepo := NewRoleRepository(db)
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "proj", ParentID: &org.ID}
+	require.NoError(t, repo.Create(project))
+	bucket := &domain.Resource{Type: "bucket", Name: "bucket", ParentID: &project.ID}
+	require.NoError(t, repo.Create(bucket))
+	other := &domain.Resource{Type: "project", Name: "other", ParentID: &org.ID}
+	require.NoError(t, repo.Create(other))
+	require.NoError(t, repo.SetTags(bucket.ID, map[string]string{"env": "prod"}, ""))
+
+	role := &domain.Role{Name: "roles/viewer", Title: "Viewer"}
+	require.NoError(t, roleRepo.Create(role))
+	for _, resource := range []*domain.Resource{org, bucket, other} {
+		require.NoError(t, policyRepo.Create(&domain.Policy{ResourceID: resource.ID, Bindings: []domain.Binding{
+			{RoleID: role.ID, Members: datatypes.JSON(`["user:alice@example.com"]`)},
+		}}))
+	}
+
+	snapshot, err := repo.GetSnapshot(project.ID)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+	ids := make([]uuid.UUID, len(snapshot.Resources))
+	for i := range snapshot.Resources {
+		ids[i] = snapshot.Resources[i].ID
+	}
+	assert.Equal(t, []uuid.UUID{org.ID, project.ID, bucket.ID}, ids)
+	assert.Equal(t, map[string]string{"env": "prod"}, snapshot.Resources[2].TagMap())
+
+	require.Len(t, snapshot.Policies, 2, "the policies of org and bucket, not of other")
+	require.Len(t, snapshot.Roles, 1)
+	assert.Equal(t, "roles/viewer", snapshot.Roles[0].Name)
+	require.NotNil(t, snapshot.Policies[0].Bindings[0].Role)
+	assert.Positive(t, snapshot.Revision)
+
+	// Changes raise the revision
+	project.Name = "renamed"
+	require.NoError(t, repo.Update(project))
+	later, err := repo.GetSnapshot(project.ID)
+	require.NoError(t, err)
+	assert.Greater(t, later.Revision, snapshot.Revision)
+
+	missing, err := repo.GetSnapshot(uuid.New())
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestResourceRepository_Undelete(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "proj", ParentID: &org.ID}
+	require.NoError(t, repo.Create(project))
+
+	require.NoError(t, repo.Delete(org.ID))
+	deleted, err := repo.GetDeleted(org.ID)
+	require.NoError(t, err)
+	require.NotNil(t, deleted)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	// A child cannot be restored under a deleted parent
+	require.NoError(t, repo.Delete(project.ID))
+	assert.ErrorContains(t, repo.Undelete(project.ID), "is deleted")
+
+	require.NoError(t, repo.Undelete(org.ID))
+	require.NoError(t, repo.Undelete(project.ID))
+	restored, err := repo.GetByID(project.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+
+	// The restored subtree is linked to its ancestors again
+	descendants, err := repo.GetDescendants(org.ID)
+	require.NoError(t, err)
+	require.Len(t, descendants, 1)
+	assert.Equal(t, project.ID, descendants[0].ID)
+
+	notDeleted, err := repo.GetDeleted(org.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, notDeleted)
+	assert.Error(t, repo.Undelete(org.ID))
+}
+
+func TestResourceRepository_PurgeDeleted(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewResourceRepository(db)
+	policyRepo := NewPolicyRepository(db)
+
+	org := &domain.Resource{Type: "organization", Name: "org"}
+	require.NoError(t, repo.Create(org))
+	project := &domain.Resource{Type: "project", Name: "proj", ParentID: &org.ID}
+	require.NoError(t, repo.Create(project))
+	live := &domain.Resource{Type: "project", Name: "live", ParentID: &org.ID}
+	require.NoError(t, repo.Create(live))
+	require.NoError(t, policyRepo.Create(&domain.Policy{ResourceID: project.ID}))
+	require.NoError(t, repo.SetTags(project.ID, map[string]string{"env": "prod"}, ""))
+
+	require.NoError(t, repo.Delete(project.ID))
+	require.NoError(t, repo.Delete(org.ID))
+
+	// Nothing was deleted before the cutoff
+	purged, err := repo.PurgeDeleted(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	// The organization is kept while its live child references it
+	purged, err = repo.PurgeDeleted(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	gone, err := repo.GetDeleted(project.ID)
+	require.NoError(t, err)
+	assert.Nil(t, gone)
+	kept, err := repo.GetDeleted(org.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, kept)
+
+	var rows int64
+	require.NoError(t, db.Unscoped().Model(&domain.Policy{}).Where("resource_id = ?", project.ID).Count(&rows).Error)
+	assert.Zero(t, rows)
+
+	// Purging the child makes its deleted parent purgeable in the same run
+	require.NoError(t, repo.Delete(live.ID))
+	purged, err = repo.PurgeDeleted(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
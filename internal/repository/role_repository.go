@@ -2,32 +2,45 @@ package repository
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// RoleRepository handles role data operations
+// RoleRepository handles role data operations. List returns roles oldest first, ties broken by
+// ID, so that its pages are stable; the other listings have their own documented order.
 type RoleRepository interface {
 	Create(role *domain.Role) error
 	GetByID(id uuid.UUID) (*domain.Role, error)
 	GetByName(name string) (*domain.Role, error)
+	// Update saves a role; it fails with ErrETagMismatch when the role changed since it was read
 	Update(role *domain.Role) error
 	Delete(id uuid.UUID) error
-	List(includeCustom bool, limit, offset int) ([]domain.Role, error)
+	DeleteCascade(id uuid.UUID) ([]uuid.UUID, error)
+	List(includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error)
+	ListByPermission(permission string, includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error)
+	ListWithDeprecatedPermissions(limit, offset int) ([]domain.Role, error)
 	AddPermissions(roleID uuid.UUID, permissionIDs []uuid.UUID) error
 	RemovePermissions(roleID uuid.UUID, permissionIDs []uuid.UUID) error
 	GetPermissions(roleID uuid.UUID) ([]domain.Permission, error)
+	GetDeleted(id uuid.UUID) (*domain.Role, error)
+	Undelete(id uuid.UUID) error
+	PurgeDeleted(before time.Time) (int64, error)
 }
 
 type roleRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	reader *gorm.DB
 }
 
 // NewRoleRepository creates a new role repository
-func NewRoleRepository(db *gorm.DB) RoleRepository {
-	return &roleRepository{db: db}
+func NewRoleRepository(db *gorm.DB, opts ...Option) RoleRepository {
+	o := applyOptions(db, opts)
+	return &roleRepository{db: db, reader: o.reader}
 }
 
 func (r *roleRepository) Create(role *domain.Role) error {
@@ -36,7 +49,7 @@ func (r *roleRepository) Create(role *domain.Role) error {
 
 func (r *roleRepository) GetByID(id uuid.UUID) (*domain.Role, error) {
 	var role domain.Role
-	err := r.db.Preload("Permissions").First(&role, id).Error
+	err := r.reader.Preload("Permissions").First(&role, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -48,7 +61,7 @@ func (r *roleRepository) GetByID(id uuid.UUID) (*domain.Role, error) {
 
 func (r *roleRepository) GetByName(name string) (*domain.Role, error) {
 	var role domain.Role
-	err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	err := r.reader.Preload("Permissions").Where("name = ?", name).First(&role).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -59,21 +72,158 @@ func (r *roleRepository) GetByName(name string) (*domain.Role, error) {
 }
 
 func (r *roleRepository) Update(role *domain.Role) error {
-	return r.db.Save(role).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var current domain.Role
+		if err := forUpdate(tx).Select("id", "e_tag").Where("id = ?", role.ID).Limit(1).Find(&current).Error; err != nil {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		if current.ID != uuid.Nil && role.ETag != "" && current.ETag != role.ETag {
+			return fmt.Errorf("role has been modified, %w", ErrETagMismatch)
+		}
+		if err := tx.Save(role).Error; err != nil {
+			return err
+		}
+		return reindexGrants(tx, "role_id = ?", role.ID)
+	})
 }
 
+// Delete deletes a role. It fails with a *RoleInUseError while bindings reference the role,
+// since those bindings would otherwise silently grant nothing.
 func (r *roleRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&domain.Role{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var total int64
+		if err := tx.Model(&domain.Binding{}).Where("role_id = ?", id).Count(&total).Error; err != nil {
+			return err
+		}
+		if total > 0 {
+			var bindingIDs []uuid.UUID
+			err := tx.Model(&domain.Binding{}).Where("role_id = ?", id).
+				Order("created_at").Limit(maxReportedBindings).Pluck("id", &bindingIDs).Error
+			if err != nil {
+				return err
+			}
+			return &RoleInUseError{RoleID: id, BindingIDs: bindingIDs, Total: total}
+		}
+
+		return tx.Delete(&domain.Role{}, id).Error
+	})
+}
+
+// DeleteCascade deletes a role together with the bindings (and their conditions) that
+// reference it, in a single transaction. The version of every affected policy is bumped
+// once; their IDs are returned so callers can record revisions.
+func (r *roleRepository) DeleteCascade(id uuid.UUID) ([]uuid.UUID, error) {
+	var policyIDs []uuid.UUID
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var bindings []domain.Binding
+		if err := tx.Select("id", "policy_id").Where("role_id = ?", id).Find(&bindings).Error; err != nil {
+			return err
+		}
+
+		if len(bindings) > 0 {
+			bindingIDs := make([]uuid.UUID, len(bindings))
+			seen := make(map[uuid.UUID]bool)
+			for i, binding := range bindings {
+				bindingIDs[i] = binding.ID
+				if !seen[binding.PolicyID] {
+					seen[binding.PolicyID] = true
+					policyIDs = append(policyIDs, binding.PolicyID)
+				}
+			}
+
+			if err := tx.Where("binding_id IN ?", bindingIDs).Delete(&domain.Condition{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", bindingIDs).Delete(&domain.Binding{}).Error; err != nil {
+				return err
+			}
+			if err := reindexGrants(tx, "id IN ?", bindingIDs); err != nil {
+				return err
+			}
+
+			var policies []domain.Policy
+			if err := tx.Where("id IN ?", policyIDs).Find(&policies).Error; err != nil {
+				return err
+			}
+			for i := range policies {
+				if err := tx.Omit(clause.Associations).Save(&policies[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Delete(&domain.Role{}, id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policyIDs, nil
+}
+
+// List lists roles. When scopeIDs is non-nil, only global roles and roles scoped to one of
+// scopeIDs are returned; a nil scopeIDs returns roles of every scope.
+func (r *roleRepository) List(includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error) {
+	var roles []domain.Role
+	query := r.reader.Model(&domain.Role{}).Preload("Permissions")
+
+	if !includeCustom {
+		query = query.Where("is_custom = ?", false)
+	}
+
+	if scopeIDs != nil {
+		query = query.Where("scope_resource_id IS NULL OR scope_resource_id IN ?", scopeIDs)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := byCreation(query, "roles").Find(&roles).Error
+	return roles, err
 }
 
-func (r *roleRepository) List(includeCustom bool, limit, offset int) ([]domain.Role, error) {
+// ListByPermission lists the roles granting permission, least privileged (fewest permissions) first
+func (r *roleRepository) ListByPermission(permission string, includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error) {
 	var roles []domain.Role
-	query := r.db.Model(&domain.Role{}).Preload("Permissions")
+	query := r.reader.Model(&domain.Role{}).Preload("Permissions").
+		Where(`EXISTS (SELECT 1 FROM role_permissions JOIN permissions ON permissions.id = role_permissions.permission_id
+			WHERE role_permissions.role_id = roles.id AND permissions.name = ? AND permissions.deleted_at IS NULL)`, permission)
 
 	if !includeCustom {
 		query = query.Where("is_custom = ?", false)
 	}
 
+	if scopeIDs != nil {
+		query = query.Where("scope_resource_id IS NULL OR scope_resource_id IN ?", scopeIDs)
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.
+		Order(`(SELECT COUNT(*) FROM role_permissions JOIN permissions ON permissions.id = role_permissions.permission_id
+			WHERE role_permissions.role_id = roles.id AND permissions.deleted_at IS NULL), roles.name`).
+		Find(&roles).Error
+	return roles, err
+}
+
+// ListWithDeprecatedPermissions lists the roles granting at least one deprecated permission, by
+// name, with all their permissions
+func (r *roleRepository) ListWithDeprecatedPermissions(limit, offset int) ([]domain.Role, error) {
+	var roles []domain.Role
+	query := r.reader.Model(&domain.Role{}).Preload("Permissions").
+		Where(`EXISTS (SELECT 1 FROM role_permissions JOIN permissions ON permissions.id = role_permissions.permission_id
+			WHERE role_permissions.role_id = roles.id AND permissions.deprecated AND permissions.deleted_at IS NULL)`)
+
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -82,7 +232,7 @@ func (r *roleRepository) List(includeCustom bool, limit, offset int) ([]domain.R
 		query = query.Offset(offset)
 	}
 
-	err := query.Find(&roles).Error
+	err := query.Order("roles.name").Find(&roles).Error
 	return roles, err
 }
 
@@ -97,7 +247,12 @@ func (r *roleRepository) AddPermissions(roleID uuid.UUID, permissionIDs []uuid.U
 		return err
 	}
 
-	return r.db.Model(&role).Association("Permissions").Append(&permissions)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Append(&permissions); err != nil {
+			return err
+		}
+		return reindexGrants(tx, "role_id = ?", roleID)
+	})
 }
 
 func (r *roleRepository) RemovePermissions(roleID uuid.UUID, permissionIDs []uuid.UUID) error {
@@ -111,14 +266,76 @@ func (r *roleRepository) RemovePermissions(roleID uuid.UUID, permissionIDs []uui
 		return err
 	}
 
-	return r.db.Model(&role).Association("Permissions").Delete(&permissions)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Delete(&permissions); err != nil {
+			return err
+		}
+		return reindexGrants(tx, "role_id = ?", roleID)
+	})
 }
 
 func (r *roleRepository) GetPermissions(roleID uuid.UUID) ([]domain.Permission, error) {
 	var role domain.Role
-	err := r.db.Preload("Permissions").First(&role, roleID).Error
+	err := r.reader.Preload("Permissions").First(&role, roleID).Error
 	if err != nil {
 		return nil, err
 	}
 	return role.Permissions, nil
 }
+
+// GetDeleted gets a soft-deleted role with its permissions; nil when it does not exist or is not deleted
+func (r *roleRepository) GetDeleted(id uuid.UUID) (*domain.Role, error) {
+	var role domain.Role
+	err := r.reader.Unscoped().Preload("Permissions").Where("id = ? AND deleted_at IS NOT NULL", id).First(&role).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Undelete restores a soft-deleted role with its permissions. Bindings deleted together with the
+// role by DeleteCascade are not restored.
+func (r *roleRepository) Undelete(id uuid.UUID) error {
+	result := r.db.Unscoped().Model(&domain.Role{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("deleted role not found: %s", id)
+	}
+	return nil
+}
+
+// PurgeDeleted hard-deletes roles deleted before the given time together with their permission
+// assignments, and returns the number of purged roles. A deleted role is kept while a binding,
+// deleted or not, still references it.
+func (r *roleRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	for {
+		var ids []uuid.UUID
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(&domain.Role{}).
+				Where("deleted_at < ?", before).
+				Where("NOT EXISTS (SELECT 1 FROM bindings WHERE bindings.role_id = roles.id)").
+				Limit(purgeBatchSize).Pluck("id", &ids).Error
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM role_permissions WHERE role_id IN ?", ids).Error; err != nil {
+				return fmt.Errorf("failed to purge role permissions: %w", err)
+			}
+			return tx.Unscoped().Where("id IN ?", ids).Delete(&domain.Role{}).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += int64(len(ids))
+		if len(ids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
@@ -1,54 +1,69 @@
 package repository
 
 import (
-	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/database/sqlite"
 	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/testharness/testenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// setupTestDB creates a test database connection
-func setupTestDB(t *testing.T) *gorm.DB {
-	// Get test database connection string from env or use default
-	dbHost := os.Getenv("TEST_DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
+// setupTestDB creates the tables in a new schema of the test Postgres server (see testenv).
+// TEST_DB_DRIVER=sqlite uses an embedded SQLite database instead (needs -tags sqlite).
+func setupTestDB(t testing.TB) *gorm.DB {
+	if os.Getenv("TEST_DB_DRIVER") == "sqlite" {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "iam.db")), &gorm.Config{})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		migrateTestDB(t, db)
+		return db
 	}
 
-	dsn := fmt.Sprintf("host=%s port=5432 user=postgres password=postgres dbname=iam_db sslmode=disable",
-		dbHost)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	require.NoError(t, err)
-
-	// Create a unique schema for this test to avoid conflicts
-	schemaName := fmt.Sprintf("test_%s", uuid.New().String()[:8])
-	db.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schemaName))
-	db.Exec(fmt.Sprintf("SET search_path TO %s", schemaName))
+	db := testenv.OpenPostgres(t)
+	migrateTestDB(t, db)
+	return db
+}
 
-	// Auto-migrate all tables
-	err = db.AutoMigrate(
+// migrateTestDB creates the tables of all models and the indexes their tags cannot express
+func migrateTestDB(t testing.TB, db *gorm.DB) {
+	err := db.AutoMigrate(
 		&domain.Resource{},
 		&domain.Permission{},
 		&domain.Role{},
 		&domain.Policy{},
 		&domain.Binding{},
 		&domain.Condition{},
+		&domain.PolicyRevision{},
+		&domain.DecisionLog{},
+		&domain.ResourceClosure{},
+		&domain.Operation{},
+		&domain.User{},
+		&domain.Group{},
+		&domain.AccessRecommendation{},
+		&domain.GrantConstraint{},
+		&domain.ResourceTag{},
+		&domain.IdempotencyKey{},
+		&domain.AccessRequest{},
+		&domain.AccessReview{},
+		&domain.AccessReviewItem{},
+		&domain.EvaluationGrant{},
+		&domain.PrincipalAlias{},
 	)
 	require.NoError(t, err)
-
-	// Cleanup after test
-	t.Cleanup(func() {
-		db.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", schemaName))
-	})
-
-	return db
+	if !isSQLite(db) {
+		require.NoError(t, db.Exec("CREATE INDEX IF NOT EXISTS idx_bindings_members ON bindings USING gin (members jsonb_path_ops)").Error)
+	}
 }
 
 func TestRoleRepository_Create(t *testing.T) {
@@ -158,6 +173,34 @@ func TestRoleRepository_Update(t *testing.T) {
 	assert.Equal(t, "Full access to network resources", retrieved.Description)
 }
 
+func TestRoleRepository_Update_StaleETag(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+
+	role := &domain.Role{Name: "roles/network.admin", Title: "Network Admin", IsCustom: true}
+	require.NoError(t, repo.Create(role))
+	require.NotEmpty(t, role.ETag)
+
+	// Two callers read the role; the first update changes its etag
+	first, err := repo.GetByID(role.ID)
+	require.NoError(t, err)
+	second, err := repo.GetByID(role.ID)
+	require.NoError(t, err)
+
+	first.Title = "Network Administrator"
+	require.NoError(t, repo.Update(first))
+	assert.NotEqual(t, role.ETag, first.ETag)
+
+	second.Description = "Manage network resources"
+	assert.ErrorIs(t, repo.Update(second), ErrETagMismatch)
+
+	retrieved, err := repo.GetByID(role.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Network Administrator", retrieved.Title)
+	assert.Empty(t, retrieved.Description)
+	assert.Equal(t, first.ETag, retrieved.ETag)
+}
+
 func TestRoleRepository_Delete(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewRoleRepository(db)
@@ -187,6 +230,144 @@ func TestRoleRepository_Delete(t *testing.T) {
 	assert.Nil(t, retrieved)
 }
 
+func TestRoleRepository_Delete_InUse(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	bindingRepo := NewBindingRepository(db)
+
+	role := &domain.Role{Name: "roles/in.use", Title: "In Use", IsCustom: true}
+	require.NoError(t, repo.Create(role))
+
+	resource := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(resource))
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+	binding := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(binding))
+
+	err := repo.Delete(role.ID)
+	var inUse *RoleInUseError
+	require.ErrorAs(t, err, &inUse)
+	assert.ErrorIs(t, err, ErrRoleInUse)
+	assert.Equal(t, int64(1), inUse.Total)
+	assert.Equal(t, []uuid.UUID{binding.ID}, inUse.BindingIDs)
+
+	// The role is still there
+	retrieved, err := repo.GetByID(role.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, retrieved)
+}
+
+func TestRoleRepository_Undelete(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	perm := &domain.Permission{Name: "storage.read", Service: "storage"}
+	require.NoError(t, permRepo.Create(perm))
+	role := &domain.Role{Name: "roles/reader", Title: "Reader"}
+	require.NoError(t, repo.Create(role))
+	require.NoError(t, repo.AddPermissions(role.ID, []uuid.UUID{perm.ID}))
+	require.NoError(t, repo.Delete(role.ID))
+
+	deleted, err := repo.GetDeleted(role.ID)
+	require.NoError(t, err)
+	require.NotNil(t, deleted)
+	assert.Len(t, deleted.Permissions, 1)
+
+	require.NoError(t, repo.Undelete(role.ID))
+	restored, err := repo.GetByID(role.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restored)
+	assert.Len(t, restored.Permissions, 1)
+
+	assert.ErrorContains(t, repo.Undelete(role.ID), "deleted role not found")
+}
+
+func TestRoleRepository_PurgeDeleted(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	permRepo := NewPermissionRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	bindingRepo := NewBindingRepository(db)
+
+	perm := &domain.Permission{Name: "storage.read", Service: "storage"}
+	require.NoError(t, permRepo.Create(perm))
+	unused := &domain.Role{Name: "roles/unused", Title: "Unused"}
+	require.NoError(t, repo.Create(unused))
+	require.NoError(t, repo.AddPermissions(unused.ID, []uuid.UUID{perm.ID}))
+	bound := &domain.Role{Name: "roles/bound", Title: "Bound"}
+	require.NoError(t, repo.Create(bound))
+
+	resource := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(resource))
+	policy := &domain.Policy{ResourceID: resource.ID}
+	require.NoError(t, policyRepo.Create(policy))
+	require.NoError(t, bindingRepo.Create(&domain.Binding{PolicyID: policy.ID, RoleID: bound.ID, Members: []byte(`["user:alice@example.com"]`)}))
+
+	require.NoError(t, repo.Delete(unused.ID))
+	_, err := repo.DeleteCascade(bound.ID)
+	require.NoError(t, err)
+
+	// The deleted binding still references the bound role until bindings are purged
+	purged, err := repo.PurgeDeleted(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	purgedBindings, err := bindingRepo.PurgeDeleted(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purgedBindings)
+	purged, err = repo.PurgeDeleted(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+}
+
+func TestRoleRepository_DeleteCascade(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	policyRepo := NewPolicyRepository(db)
+	resourceRepo := NewResourceRepository(db)
+	bindingRepo := NewBindingRepository(db)
+	conditionRepo := NewConditionRepository(db)
+
+	role := &domain.Role{Name: "roles/doomed", Title: "Doomed", IsCustom: true}
+	require.NoError(t, repo.Create(role))
+	other := &domain.Role{Name: "roles/kept", Title: "Kept", IsCustom: true}
+	require.NoError(t, repo.Create(other))
+
+	resource := &domain.Resource{Type: "project", Name: "proj"}
+	require.NoError(t, resourceRepo.Create(resource))
+	policy := &domain.Policy{ResourceID: resource.ID, Version: 1}
+	require.NoError(t, policyRepo.Create(policy))
+
+	doomed := &domain.Binding{PolicyID: policy.ID, RoleID: role.ID, Members: []byte(`["user:alice@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(doomed))
+	require.NoError(t, conditionRepo.Create(&domain.Condition{BindingID: doomed.ID, Expression: "true"}))
+	kept := &domain.Binding{PolicyID: policy.ID, RoleID: other.ID, Members: []byte(`["user:bob@example.com"]`)}
+	require.NoError(t, bindingRepo.Create(kept))
+
+	policyIDs, err := repo.DeleteCascade(role.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{policy.ID}, policyIDs)
+
+	retrieved, err := repo.GetByID(role.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, retrieved)
+
+	updated, err := policyRepo.GetByID(policy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	require.Len(t, updated.Bindings, 1)
+	assert.Equal(t, kept.ID, updated.Bindings[0].ID)
+
+	condition, err := conditionRepo.GetByBindingID(doomed.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, condition)
+}
+
 func TestRoleRepository_List(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewRoleRepository(db)
@@ -205,14 +386,87 @@ func TestRoleRepository_List(t *testing.T) {
 	}
 
 	// List all roles
-	retrieved, err := repo.List(true, 0, 0)
+	retrieved, err := repo.List(true, nil, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 4)
 
 	// List only predefined roles
-	retrieved, err = repo.List(false, 0, 0)
+	retrieved, err = repo.List(false, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved, 2)
+}
+
+func TestRoleRepository_List_ByScope(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+
+	orgID := uuid.New()
+	otherOrgID := uuid.New()
+	roles := []*domain.Role{
+		{Name: "roles/viewer", Title: "Viewer"},
+		{Name: "roles/acme.auditor", Title: "Auditor", IsCustom: true, ScopeResourceID: &orgID},
+		{Name: "roles/globex.auditor", Title: "Auditor", IsCustom: true, ScopeResourceID: &otherOrgID},
+	}
+	for _, role := range roles {
+		require.NoError(t, repo.Create(role))
+	}
+
+	retrieved, err := repo.List(true, []uuid.UUID{orgID}, 0, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 2)
+	for _, role := range retrieved {
+		assert.NotEqual(t, "roles/globex.auditor", role.Name)
+	}
+
+	// An empty scope list only matches global roles
+	retrieved, err = repo.List(true, []uuid.UUID{}, 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved, 1)
+}
+
+func TestRoleRepository_ListByPermission(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	permissionIDs := map[string]uuid.UUID{}
+	for _, name := range []string{"storage.objects.get", "storage.objects.delete", "storage.buckets.delete"} {
+		perm := &domain.Permission{Name: name, Service: "storage"}
+		require.NoError(t, permRepo.Create(perm))
+		permissionIDs[name] = perm.ID
+	}
+
+	create := func(name string, isCustom bool, permissions ...string) {
+		role := &domain.Role{Name: name, Title: name, IsCustom: isCustom}
+		require.NoError(t, repo.Create(role))
+		ids := make([]uuid.UUID, len(permissions))
+		for i, permission := range permissions {
+			ids[i] = permissionIDs[permission]
+		}
+		require.NoError(t, repo.AddPermissions(role.ID, ids))
+	}
+	create("roles/storage.admin", false, "storage.objects.get", "storage.objects.delete", "storage.buckets.delete")
+	create("roles/storage.objectAdmin", false, "storage.objects.get", "storage.objects.delete")
+	create("roles/storage.viewer", false, "storage.objects.get")
+	create("roles/cleanup", true, "storage.objects.delete")
+
+	// Least privileged first
+	retrieved, err := repo.ListByPermission("storage.objects.delete", true, nil, 0, 0)
+	require.NoError(t, err)
+	names := make([]string, len(retrieved))
+	for i, role := range retrieved {
+		names[i] = role.Name
+	}
+	assert.Equal(t, []string{"roles/cleanup", "roles/storage.objectAdmin", "roles/storage.admin"}, names)
+
+	retrieved, err = repo.ListByPermission("storage.objects.delete", false, nil, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, "roles/storage.objectAdmin", retrieved[0].Name)
+
+	retrieved, err = repo.ListByPermission("compute.instances.delete", true, nil, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, retrieved)
 }
 
 func TestRoleRepository_List_WithPagination(t *testing.T) {
@@ -231,17 +485,17 @@ func TestRoleRepository_List_WithPagination(t *testing.T) {
 	}
 
 	// Test limit
-	retrieved, err := repo.List(true, 5, 0)
+	retrieved, err := repo.List(true, nil, 5, 0)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 5)
 
 	// Test offset
-	retrieved, err = repo.List(true, 5, 5)
+	retrieved, err = repo.List(true, nil, 5, 5)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 5)
 
 	// Test limit and offset
-	retrieved, err = repo.List(true, 3, 7)
+	retrieved, err = repo.List(true, nil, 3, 7)
 	assert.NoError(t, err)
 	assert.Len(t, retrieved, 3)
 }
@@ -401,3 +655,36 @@ func TestRoleRepository_GetPermissions_RoleNotFound(t *testing.T) {
 	_, err := repo.GetPermissions(uuid.New())
 	assert.Error(t, err)
 }
+
+func TestRoleRepository_ListWithDeprecatedPermissions(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewRoleRepository(db)
+	permRepo := NewPermissionRepository(db)
+
+	current := &domain.Permission{Name: "storage.buckets.get", Service: "storage"}
+	legacy := &domain.Permission{Name: "storage.buckets.getIamPolicy", Service: "storage"}
+	require.NoError(t, permRepo.Create(current))
+	require.NoError(t, permRepo.Create(legacy))
+	require.NoError(t, permRepo.SetDeprecated(legacy.ID, true, "storage.buckets.get"))
+
+	create := func(name string, permissions ...uuid.UUID) {
+		role := &domain.Role{Name: name, Title: name}
+		require.NoError(t, repo.Create(role))
+		require.NoError(t, repo.AddPermissions(role.ID, permissions))
+	}
+	create("roles/storage.viewer", current.ID)
+	create("roles/storage.legacyAdmin", current.ID, legacy.ID)
+	create("roles/storage.auditor", legacy.ID)
+
+	retrieved, err := repo.ListWithDeprecatedPermissions(0, 0)
+	require.NoError(t, err)
+	require.Len(t, retrieved, 2)
+	assert.Equal(t, "roles/storage.auditor", retrieved[0].Name)
+	assert.Equal(t, "roles/storage.legacyAdmin", retrieved[1].Name)
+	assert.Len(t, retrieved[1].Permissions, 2)
+
+	retrieved, err = repo.ListWithDeprecatedPermissions(1, 1)
+	require.NoError(t, err)
+	require.Len(t, retrieved, 1)
+	assert.Equal(t, "roles/storage.legacyAdmin", retrieved[0].Name)
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/gorm"
+)
+
+// UserRepository handles provisioned user data operations
+type UserRepository interface {
+	Create(user *domain.User) error
+	GetByID(id uuid.UUID) (*domain.User, error)
+	GetByUserName(userName string) (*domain.User, error)
+	Update(user *domain.User) error
+	Delete(id uuid.UUID) error
+	List(filter DirectoryFilter, limit, offset int) ([]domain.User, int64, error)
+}
+
+// DirectoryFilter restricts user and group listings to an exact attribute match
+type DirectoryFilter struct {
+	Attribute string // Column name, e.g. "user_name", "external_id", "display_name"; empty lists everything
+	Value     string
+}
+
+// apply adds the filter to query, rejecting attributes not in allowed
+func (f DirectoryFilter) apply(query *gorm.DB, allowed ...string) (*gorm.DB, error) {
+	if f.Attribute == "" {
+		return query, nil
+	}
+	for _, column := range allowed {
+		if f.Attribute == column {
+			return query.Where(column+" = ?", f.Value), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported filter attribute %q", f.Attribute)
+}
+
+type userRepository struct {
+	db     *gorm.DB
+	reader *gorm.DB
+}
+
+// NewUserRepository creates a new user repository
+func NewUserRepository(db *gorm.DB, opts ...Option) UserRepository {
+	o := applyOptions(db, opts)
+	return &userRepository{db: db, reader: o.reader}
+}
+
+func (r *userRepository) Create(user *domain.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *userRepository) GetByID(id uuid.UUID) (*domain.User, error) {
+	var user domain.User
+	err := r.db.Preload("Groups").First(&user, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) GetByUserName(userName string) (*domain.User, error) {
+	var user domain.User
+	err := r.reader.Preload("Groups").Where("user_name = ?", userName).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Update(user *domain.User) error {
+	// Group memberships are managed through the group repository
+	return r.db.Omit("Groups").Save(user).Error
+}
+
+// Delete removes a user and its group memberships
+func (r *userRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.User{}, id).Error
+	})
+}
+
+// List returns users ordered by user name, with the total number of matches
+func (r *userRepository) List(filter DirectoryFilter, limit, offset int) ([]domain.User, int64, error) {
+	query, err := filter.apply(r.reader.Model(&domain.User{}), "user_name", "external_id", "email")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	var users []domain.User
+	err = query.Preload("Groups").Order("user_name").Find(&users).Error
+	return users, total, err
+}
@@ -0,0 +1,689 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/service"
+)
+
+// BasePath is the path prefix of every SCIM endpoint
+const BasePath = "/scim/v2"
+
+const (
+	contentType = "application/scim+json"
+
+	defaultCount = 100
+	maxCount     = 1000
+
+	// maxBodyBytes limits request bodies; large group PUTs carry every member
+	maxBodyBytes = 10 << 20
+)
+
+// Handler serves the SCIM 2.0 Users, Groups and ServiceProviderConfig endpoints.
+// Every request must carry the configured bearer token.
+type Handler struct {
+	directory *service.DirectoryService
+	token     string
+	logger    *slog.Logger
+	mux       *http.ServeMux
+}
+
+// NewHandler creates a SCIM handler. A nil logger uses slog.Default().
+func NewHandler(directory *service.DirectoryService, token string, logger *slog.Logger) *Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	h := &Handler{directory: directory, token: token, logger: logger, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("GET "+BasePath+"/ServiceProviderConfig", h.serviceProviderConfig)
+
+	h.mux.HandleFunc("GET "+BasePath+"/Users", h.listUsers)
+	h.mux.HandleFunc("POST "+BasePath+"/Users", h.createUser)
+	h.mux.HandleFunc("GET "+BasePath+"/Users/{id}", h.getUser)
+	h.mux.HandleFunc("PUT "+BasePath+"/Users/{id}", h.replaceUser)
+	h.mux.HandleFunc("PATCH "+BasePath+"/Users/{id}", h.patchUser)
+	h.mux.HandleFunc("DELETE "+BasePath+"/Users/{id}", h.deleteUser)
+
+	h.mux.HandleFunc("GET "+BasePath+"/Groups", h.listGroups)
+	h.mux.HandleFunc("POST "+BasePath+"/Groups", h.createGroup)
+	h.mux.HandleFunc("GET "+BasePath+"/Groups/{id}", h.getGroup)
+	h.mux.HandleFunc("PUT "+BasePath+"/Groups/{id}", h.replaceGroup)
+	h.mux.HandleFunc("PATCH "+BasePath+"/Groups/{id}", h.patchGroup)
+	h.mux.HandleFunc("DELETE "+BasePath+"/Groups/{id}", h.deleteGroup)
+
+	return h
+}
+
+// ServeHTTP authenticates the request and dispatches it
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		h.writeError(w, http.StatusUnauthorized, "", "missing or invalid bearer token")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) serviceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+	h.write(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{SchemaSPConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxCount},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a static bearer token",
+		}},
+	})
+}
+
+// =============== Users ===============
+
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query().Get("filter"), userFilterAttributes)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count, err := parsePage(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	users, total, err := h.directory.ListUsers(filter, max(count, 1), startIndex-1)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	resources := make([]*User, 0, len(users))
+	for i := range users {
+		if len(resources) == count {
+			break
+		}
+		resources = append(resources, toUser(&users[i], baseURL(r)))
+	}
+	h.writeList(w, total, startIndex, resources, len(resources))
+}
+
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var in User
+	if !h.decode(w, r, &in) {
+		return
+	}
+	if in.UserName == "" {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	user := &domain.User{}
+	fromUser(&in, user)
+	created, err := h.directory.CreateUser(user)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.write(w, http.StatusCreated, toUser(created, baseURL(r)))
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.lookupUser(w, r)
+	if !ok {
+		return
+	}
+	h.write(w, http.StatusOK, toUser(user, baseURL(r)))
+}
+
+func (h *Handler) replaceUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.lookupUser(w, r)
+	if !ok {
+		return
+	}
+	var in User
+	if !h.decode(w, r, &in) {
+		return
+	}
+	if in.UserName == "" {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	fromUser(&in, user)
+	h.saveUser(w, r, user)
+}
+
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.lookupUser(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchRequest
+	if !h.decode(w, r, &patch) {
+		return
+	}
+
+	for _, op := range patch.Operations {
+		if err := applyUserPatch(user, op); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	h.saveUser(w, r, user)
+}
+
+func (h *Handler) saveUser(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	user.Groups = nil
+	updated, err := h.directory.UpdateUser(user)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.write(w, http.StatusOK, toUser(updated, baseURL(r)))
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.directory.DeleteUser(id); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupUser loads the user named by the request path, writing a 404 if it does not exist
+func (h *Handler) lookupUser(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	user, err := h.directory.GetUser(id)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return nil, false
+	}
+	if user == nil {
+		h.writeError(w, http.StatusNotFound, "", fmt.Sprintf("user %s not found", id))
+		return nil, false
+	}
+	return user, true
+}
+
+// applyUserPatch applies one PATCH operation to a user. Attributes the directory does not
+// store, such as phone numbers, are ignored so identity providers can send full profiles.
+func applyUserPatch(user *domain.User, op PatchOperation) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return setUserAttribute(user, op.Path, nil)
+	default:
+		return fmt.Errorf("unsupported patch operation %q", op.Op)
+	}
+
+	if op.Path != "" {
+		return setUserAttribute(user, op.Path, op.Value)
+	}
+
+	// Without a path the value holds the attributes to set
+	values, ok := op.Value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("patch value must be an object when no path is given")
+	}
+	for attribute, value := range values {
+		if err := setUserAttribute(user, attribute, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUserAttribute sets a user attribute from a PATCH value; a nil value clears it
+func setUserAttribute(user *domain.User, path string, value interface{}) error {
+	switch strings.ToLower(path) {
+	case "active":
+		if value == nil {
+			return fmt.Errorf("active cannot be removed")
+		}
+		active, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+	case "username":
+		userName, _ := value.(string)
+		if userName == "" {
+			return fmt.Errorf("userName is required")
+		}
+		user.UserName = userName
+	case "displayname", "name.formatted":
+		user.DisplayName, _ = value.(string)
+	case "externalid":
+		user.ExternalID, _ = value.(string)
+	case "emails", `emails[type eq "work"].value`, `emails[primary eq true].value`:
+		email, err := parseEmail(value)
+		if err != nil {
+			return err
+		}
+		user.Email = email
+	}
+	return nil
+}
+
+// parseEmail accepts an email address or a list of SCIM email objects
+func parseEmail(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		var emails []Email
+		if err := json.Unmarshal(data, &emails); err != nil {
+			return "", fmt.Errorf("invalid emails value: %w", err)
+		}
+		return primaryEmail(emails), nil
+	default:
+		return "", fmt.Errorf("invalid emails value")
+	}
+}
+
+// parseBool accepts JSON booleans and the "True"/"False" strings Azure AD sends
+func parseBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid boolean %q", v)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("invalid boolean value")
+	}
+}
+
+// =============== Groups ===============
+
+func (h *Handler) listGroups(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query().Get("filter"), groupFilterAttributes)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	startIndex, count, err := parsePage(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	groups, total, err := h.directory.ListGroups(filter, max(count, 1), startIndex-1)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+
+	// Identity providers exclude members when they only need to match groups
+	excludeMembers := strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+	resources := make([]*Group, 0, len(groups))
+	for i := range groups {
+		if len(resources) == count {
+			break
+		}
+		group := toGroup(&groups[i], baseURL(r))
+		if excludeMembers {
+			group.Members = nil
+		}
+		resources = append(resources, group)
+	}
+	h.writeList(w, total, startIndex, resources, len(resources))
+}
+
+func (h *Handler) createGroup(w http.ResponseWriter, r *http.Request) {
+	var in Group
+	if !h.decode(w, r, &in) {
+		return
+	}
+	if in.DisplayName == "" {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	memberIDs, err := referenceIDs(in.Members)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	group, err := h.directory.CreateGroup(in.DisplayName, in.ExternalID, memberIDs)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.write(w, http.StatusCreated, toGroup(group, baseURL(r)))
+}
+
+func (h *Handler) getGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	group, err := h.directory.GetGroup(id)
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	if group == nil {
+		h.writeError(w, http.StatusNotFound, "", fmt.Sprintf("group %s not found", id))
+		return
+	}
+	h.write(w, http.StatusOK, toGroup(group, baseURL(r)))
+}
+
+func (h *Handler) replaceGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	var in Group
+	if !h.decode(w, r, &in) {
+		return
+	}
+	if in.DisplayName == "" {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	memberIDs, err := referenceIDs(in.Members)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if _, err := h.directory.UpdateGroup(id, in.DisplayName, in.ExternalID); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	if err := h.directory.ReplaceGroupMembers(id, memberIDs); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.getGroup(w, r)
+}
+
+func (h *Handler) patchGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	var patch PatchRequest
+	if !h.decode(w, r, &patch) {
+		return
+	}
+
+	for _, op := range patch.Operations {
+		if err := h.applyGroupPatch(id, op); err != nil {
+			var invalid *invalidPatchError
+			if errors.As(err, &invalid) {
+				h.writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			} else {
+				h.writeServiceError(w, err)
+			}
+			return
+		}
+	}
+	h.getGroup(w, r)
+}
+
+func (h *Handler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.directory.DeleteGroup(id); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidPatchError reports a malformed PATCH operation
+type invalidPatchError struct {
+	msg string
+}
+
+func (e *invalidPatchError) Error() string {
+	return e.msg
+}
+
+func invalidPatch(format string, args ...interface{}) error {
+	return &invalidPatchError{msg: fmt.Sprintf(format, args...)}
+}
+
+// applyGroupPatch applies one PATCH operation to a group. Membership operations take
+// effect immediately, so later operations see the members earlier ones added.
+func (h *Handler) applyGroupPatch(id uuid.UUID, op PatchOperation) error {
+	operation := strings.ToLower(op.Op)
+	path := strings.TrimSpace(op.Path)
+
+	// Okta and Azure AD remove single members with a value filter, e.g. members[value eq "<id>"]
+	if operation == "remove" && strings.HasPrefix(strings.ToLower(path), "members[") {
+		filter, err := parseFilter(strings.TrimSuffix(path[len("members["):], "]"), map[string]string{"value": "value"})
+		if err != nil {
+			return invalidPatch("invalid members filter: %v", err)
+		}
+		memberID, err := uuid.Parse(filter.Value)
+		if err != nil {
+			return invalidPatch("invalid member id %q", filter.Value)
+		}
+		return h.directory.RemoveGroupMembers(id, []uuid.UUID{memberID})
+	}
+
+	switch {
+	case strings.EqualFold(path, "members"):
+		memberIDs, err := patchMemberIDs(op.Value)
+		if err != nil {
+			return err
+		}
+		switch operation {
+		case "add":
+			return h.directory.AddGroupMembers(id, memberIDs)
+		case "remove":
+			if op.Value == nil {
+				return h.directory.ReplaceGroupMembers(id, nil)
+			}
+			return h.directory.RemoveGroupMembers(id, memberIDs)
+		case "replace":
+			return h.directory.ReplaceGroupMembers(id, memberIDs)
+		}
+		return invalidPatch("unsupported patch operation %q", op.Op)
+
+	case operation != "add" && operation != "replace":
+		return invalidPatch("unsupported patch operation %q on %q", op.Op, path)
+
+	case path == "":
+		// Without a path the value holds the attributes to set
+		values, ok := op.Value.(map[string]interface{})
+		if !ok {
+			return invalidPatch("patch value must be an object when no path is given")
+		}
+		for attribute, value := range values {
+			if err := h.applyGroupPatch(id, PatchOperation{Op: op.Op, Path: attribute, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case strings.EqualFold(path, "displayName"), strings.EqualFold(path, "externalId"):
+		group, err := h.directory.GetGroup(id)
+		if err != nil {
+			return err
+		}
+		if group == nil {
+			return fmt.Errorf("group %s %w", id, service.ErrDirectoryNotFound)
+		}
+		value, _ := op.Value.(string)
+		if strings.EqualFold(path, "displayName") {
+			if value == "" {
+				return invalidPatch("displayName is required")
+			}
+			group.DisplayName = value
+		} else {
+			group.ExternalID = value
+		}
+		_, err = h.directory.UpdateGroup(id, group.DisplayName, group.ExternalID)
+		return err
+
+	default:
+		return invalidPatch("unsupported patch path %q", path)
+	}
+}
+
+// patchMemberIDs parses the member list of a members PATCH operation
+func patchMemberIDs(value interface{}) ([]uuid.UUID, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, invalidPatch("invalid members value")
+	}
+	var references []Reference
+	if err := json.Unmarshal(data, &references); err != nil {
+		// A single member may be sent as an object rather than a list
+		var reference Reference
+		if err := json.Unmarshal(data, &reference); err != nil {
+			return nil, invalidPatch("invalid members value")
+		}
+		references = []Reference{reference}
+	}
+	ids, err := referenceIDs(references)
+	if err != nil {
+		return nil, invalidPatch("%v", err)
+	}
+	return ids, nil
+}
+
+// referenceIDs parses the user IDs of member references
+func referenceIDs(references []Reference) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(references))
+	for _, reference := range references {
+		id, err := uuid.Parse(reference.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid member id %q", reference.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// =============== Helpers ===============
+
+// baseURL returns the absolute URL of the SCIM endpoints as seen by the client
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + BasePath
+}
+
+// parsePage reads the 1-based startIndex and the count query parameters
+func parsePage(r *http.Request) (startIndex, count int, err error) {
+	startIndex, count = 1, defaultCount
+	if v := r.URL.Query().Get("startIndex"); v != "" {
+		if startIndex, err = strconv.Atoi(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid startIndex %q", v)
+		}
+		// RFC 7644: values less than 1 are interpreted as 1
+		startIndex = max(startIndex, 1)
+	}
+	if v := r.URL.Query().Get("count"); v != "" {
+		if count, err = strconv.Atoi(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid count %q", v)
+		}
+		count = min(max(count, 0), maxCount)
+	}
+	return startIndex, count, nil
+}
+
+// pathID parses the resource ID in the request path, writing a 404 if it is not a UUID
+func (h *Handler) pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "", fmt.Sprintf("resource %s not found", r.PathValue("id")))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// decode reads a JSON request body, writing a 400 if it is malformed
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "", "request body too large")
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("invalid JSON: %v", err))
+		return false
+	}
+	return true
+}
+
+func (h *Handler) writeList(w http.ResponseWriter, total int64, startIndex int, resources interface{}, n int) {
+	h.write(w, http.StatusOK, &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: n,
+		Resources:    resources,
+	})
+}
+
+// writeServiceError maps directory service errors to SCIM errors
+func (h *Handler) writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDirectoryNotFound):
+		h.writeError(w, http.StatusNotFound, "", err.Error())
+	case errors.Is(err, service.ErrDirectoryConflict):
+		h.writeError(w, http.StatusConflict, "uniqueness", err.Error())
+	default:
+		h.logger.Error("SCIM request failed", "error", err)
+		h.writeError(w, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	h.write(w, status, &Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func (h *Handler) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Warn("Failed to write SCIM response", "error", err)
+	}
+}
@@ -0,0 +1,344 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "s3cret"
+
+// memDirectory is an in-memory user and group store
+type memDirectory struct {
+	users   map[uuid.UUID]domain.User
+	groups  map[uuid.UUID]domain.Group
+	members map[uuid.UUID]map[uuid.UUID]bool // group ID -> user IDs
+}
+
+func newMemDirectory() *memDirectory {
+	return &memDirectory{
+		users:   make(map[uuid.UUID]domain.User),
+		groups:  make(map[uuid.UUID]domain.Group),
+		members: make(map[uuid.UUID]map[uuid.UUID]bool),
+	}
+}
+
+type memUserRepository struct{ d *memDirectory }
+
+func (r memUserRepository) Create(user *domain.User) error {
+	user.ID = uuid.New()
+	user.CreatedAt, user.UpdatedAt = time.Now(), time.Now()
+	r.d.users[user.ID] = *user
+	return nil
+}
+
+func (r memUserRepository) GetByID(id uuid.UUID) (*domain.User, error) {
+	user, ok := r.d.users[id]
+	if !ok {
+		return nil, nil
+	}
+	for groupID, members := range r.d.members {
+		if members[id] {
+			user.Groups = append(user.Groups, r.d.groups[groupID])
+		}
+	}
+	return &user, nil
+}
+
+func (r memUserRepository) GetByUserName(userName string) (*domain.User, error) {
+	for id, user := range r.d.users {
+		if user.UserName == userName {
+			return r.GetByID(id)
+		}
+	}
+	return nil, nil
+}
+
+func (r memUserRepository) Update(user *domain.User) error {
+	user.UpdatedAt = time.Now()
+	r.d.users[user.ID] = *user
+	return nil
+}
+
+func (r memUserRepository) Delete(id uuid.UUID) error {
+	delete(r.d.users, id)
+	for _, members := range r.d.members {
+		delete(members, id)
+	}
+	return nil
+}
+
+func (r memUserRepository) List(filter repository.DirectoryFilter, limit, offset int) ([]domain.User, int64, error) {
+	var users []domain.User
+	for id, user := range r.d.users {
+		if filter.Attribute == "user_name" && user.UserName != filter.Value {
+			continue
+		}
+		found, _ := r.GetByID(id)
+		users = append(users, *found)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	total := int64(len(users))
+	users = users[min(offset, len(users)):]
+	return users[:min(limit, len(users))], total, nil
+}
+
+type memGroupRepository struct{ d *memDirectory }
+
+func (r memGroupRepository) Create(group *domain.Group) error {
+	group.ID = uuid.New()
+	group.CreatedAt, group.UpdatedAt = time.Now(), time.Now()
+	r.d.groups[group.ID] = *group
+	r.d.members[group.ID] = make(map[uuid.UUID]bool)
+	return nil
+}
+
+func (r memGroupRepository) GetByID(id uuid.UUID) (*domain.Group, error) {
+	group, ok := r.d.groups[id]
+	if !ok {
+		return nil, nil
+	}
+	group.Members = nil
+	for userID := range r.d.members[id] {
+		group.Members = append(group.Members, r.d.users[userID])
+	}
+	sort.Slice(group.Members, func(i, j int) bool { return group.Members[i].UserName < group.Members[j].UserName })
+	return &group, nil
+}
+
+func (r memGroupRepository) Update(group *domain.Group) error {
+	group.UpdatedAt = time.Now()
+	r.d.groups[group.ID] = *group
+	return nil
+}
+
+func (r memGroupRepository) Delete(id uuid.UUID) error {
+	delete(r.d.groups, id)
+	delete(r.d.members, id)
+	return nil
+}
+
+func (r memGroupRepository) List(filter repository.DirectoryFilter, limit, offset int) ([]domain.Group, int64, error) {
+	var groups []domain.Group
+	for id, group := range r.d.groups {
+		if filter.Attribute == "display_name" && group.DisplayName != filter.Value {
+			continue
+		}
+		found, _ := r.GetByID(id)
+		groups = append(groups, *found)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].DisplayName < groups[j].DisplayName })
+	total := int64(len(groups))
+	groups = groups[min(offset, len(groups)):]
+	return groups[:min(limit, len(groups))], total, nil
+}
+
+func (r memGroupRepository) AddMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	for _, id := range userIDs {
+		r.d.members[groupID][id] = true
+	}
+	return nil
+}
+
+func (r memGroupRepository) RemoveMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	for _, id := range userIDs {
+		delete(r.d.members[groupID], id)
+	}
+	return nil
+}
+
+func (r memGroupRepository) ReplaceMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	r.d.members[groupID] = make(map[uuid.UUID]bool)
+	return r.AddMembers(groupID, userIDs)
+}
+
+func (r memGroupRepository) ListByMember(userName string) ([]domain.Group, error) {
+	var groups []domain.Group
+	for groupID, members := range r.d.members {
+		for userID := range members {
+			if user := r.d.users[userID]; user.UserName == userName && user.Active {
+				groups = append(groups, r.d.groups[groupID])
+			}
+		}
+	}
+	return groups, nil
+}
+
+func newTestHandler() (*Handler, *service.DirectoryService) {
+	d := newMemDirectory()
+	directory := service.NewDirectoryService(memUserRepository{d}, memGroupRepository{d}, service.NewNoopCache())
+	return NewHandler(directory, testToken, nil), directory
+}
+
+// do sends an authenticated request and decodes the JSON response into out
+func do(t *testing.T, h http.Handler, method, path, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, BasePath+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	}
+	return rec.Code
+}
+
+func createUser(t *testing.T, h http.Handler, userName string) *User {
+	t.Helper()
+	var user User
+	body := `{"schemas":["` + SchemaUser + `"],"userName":"` + userName + `","name":{"givenName":"Alice","familyName":"Smith"},` +
+		`"emails":[{"value":"` + userName + `","primary":true}],"active":true}`
+	require.Equal(t, http.StatusCreated, do(t, h, http.MethodPost, "/Users", body, &user))
+	return &user
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	h, _ := newTestHandler()
+
+	for _, header := range []string{"", "Bearer wrong", "Basic " + testToken} {
+		req := httptest.NewRequest(http.MethodGet, BasePath+"/Users", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, header)
+	}
+}
+
+func TestHandler_Users(t *testing.T) {
+	h, _ := newTestHandler()
+
+	user := createUser(t, h, "alice@example.com")
+	assert.Equal(t, "Alice Smith", user.DisplayName)
+	assert.Equal(t, "alice@example.com", user.Emails[0].Value)
+	assert.True(t, *user.Active)
+	assert.Equal(t, "http://example.com"+BasePath+"/Users/"+user.ID, user.Meta.Location)
+
+	var scimErr Error
+	body := `{"userName":"alice@example.com"}`
+	assert.Equal(t, http.StatusConflict, do(t, h, http.MethodPost, "/Users", body, &scimErr))
+	assert.Equal(t, "uniqueness", scimErr.ScimType)
+
+	createUser(t, h, "bob@example.com")
+
+	// Identity providers look users up by userName before creating them
+	var list ListResponse
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, `/Users?filter=userName+eq+"bob@example.com"`, "", &list))
+	assert.Equal(t, int64(1), list.TotalResults)
+
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/Users?startIndex=2&count=1", "", &list))
+	assert.Equal(t, int64(2), list.TotalResults)
+	assert.Equal(t, 2, list.StartIndex)
+	assert.Equal(t, 1, list.ItemsPerPage)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodGet, `/Users?filter=title+co+"eng"`, "", &scimErr))
+	assert.Equal(t, "invalidFilter", scimErr.ScimType)
+
+	var got User
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/Users/"+user.ID, "", &got))
+	assert.Equal(t, "alice@example.com", got.UserName)
+
+	// Azure AD sends attribute paths and boolean strings
+	patch := `{"schemas":["` + SchemaPatchOp + `"],"Operations":[` +
+		`{"op":"Replace","path":"active","value":"False"},` +
+		`{"op":"Replace","path":"emails[type eq \"work\"].value","value":"alice@corp.example.com"}]}`
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPatch, "/Users/"+user.ID, patch, &got))
+	assert.False(t, *got.Active)
+	assert.Equal(t, "alice@corp.example.com", got.Emails[0].Value)
+
+	// Okta sends the attributes as the value
+	patch = `{"schemas":["` + SchemaPatchOp + `"],"Operations":[{"op":"replace","value":{"active":true}}]}`
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPatch, "/Users/"+user.ID, patch, &got))
+	assert.True(t, *got.Active)
+
+	body = `{"schemas":["` + SchemaUser + `"],"userName":"alice.smith@example.com","displayName":"Alice","active":true}`
+	var replaced User
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPut, "/Users/"+user.ID, body, &replaced))
+	assert.Equal(t, "alice.smith@example.com", replaced.UserName)
+	assert.Empty(t, replaced.Emails)
+
+	assert.Equal(t, http.StatusNoContent, do(t, h, http.MethodDelete, "/Users/"+user.ID, "", nil))
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/Users/"+user.ID, "", &scimErr))
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodDelete, "/Users/"+user.ID, "", &scimErr))
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/Users/not-a-uuid", "", &scimErr))
+}
+
+func TestHandler_Groups(t *testing.T) {
+	h, directory := newTestHandler()
+
+	alice := createUser(t, h, "alice@example.com")
+	bob := createUser(t, h, "bob@example.com")
+
+	var group Group
+	body := `{"schemas":["` + SchemaGroup + `"],"displayName":"engineering","members":[{"value":"` + alice.ID + `"}]}`
+	require.Equal(t, http.StatusCreated, do(t, h, http.MethodPost, "/Groups", body, &group))
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, "alice@example.com", group.Members[0].Display)
+
+	groups, err := directory.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group:engineering"}, groups)
+
+	patch := `{"schemas":["` + SchemaPatchOp + `"],"Operations":[` +
+		`{"op":"add","path":"members","value":[{"value":"` + bob.ID + `"}]},` +
+		`{"op":"remove","path":"members[value eq \"` + alice.ID + `\"]"}]}`
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPatch, "/Groups/"+group.ID, patch, &group))
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, bob.ID, group.Members[0].Value)
+
+	groups, err = directory.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	patch = `{"schemas":["` + SchemaPatchOp + `"],"Operations":[{"op":"replace","value":{"displayName":"platform"}}]}`
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPatch, "/Groups/"+group.ID, patch, &group))
+	assert.Equal(t, "platform", group.DisplayName)
+
+	var list ListResponse
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, `/Groups?filter=displayName+eq+"platform"&excludedAttributes=members`, "", &list))
+	assert.Equal(t, int64(1), list.TotalResults)
+	assert.NotContains(t, list.Resources.([]interface{})[0], "members")
+
+	body = `{"schemas":["` + SchemaGroup + `"],"displayName":"platform","members":[{"value":"` + alice.ID + `"},{"value":"` + bob.ID + `"}]}`
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPut, "/Groups/"+group.ID, body, &group))
+	assert.Len(t, group.Members, 2)
+
+	var scimErr Error
+	patch = `{"schemas":["` + SchemaPatchOp + `"],"Operations":[{"op":"add","path":"members","value":[{"value":"nope"}]}]}`
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPatch, "/Groups/"+group.ID, patch, &scimErr))
+
+	assert.Equal(t, http.StatusNoContent, do(t, h, http.MethodDelete, "/Groups/"+group.ID, "", nil))
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodPatch, "/Groups/"+group.ID, `{"Operations":[{"op":"add","path":"members","value":[]}]}`, &scimErr))
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := parseFilter(`userName eq "alice@example.com"`, userFilterAttributes)
+	require.NoError(t, err)
+	assert.Equal(t, repository.DirectoryFilter{Attribute: "user_name", Value: "alice@example.com"}, filter)
+
+	filter, err = parseFilter(`externalId EQ "00u1"`, userFilterAttributes)
+	require.NoError(t, err)
+	assert.Equal(t, "external_id", filter.Attribute)
+
+	filter, err = parseFilter("", userFilterAttributes)
+	require.NoError(t, err)
+	assert.Empty(t, filter.Attribute)
+
+	for _, invalid := range []string{`userName co "alice"`, `displayName eq "x"`, `userName eq alice`, "userName"} {
+		_, err := parseFilter(invalid, userFilterAttributes)
+		assert.Error(t, err, invalid)
+	}
+}
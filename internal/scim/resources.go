@@ -0,0 +1,234 @@
+// Package scim implements a SCIM 2.0 (RFC 7643, RFC 7644) server so identity providers
+// such as Okta or Azure AD can provision users and groups into the IAM directory.
+package scim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// SCIM schema URNs
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// Meta holds resource metadata
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// Email is a user's email address
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Name is a user's name components; only the formatted name is stored
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Reference points at a related resource, e.g. a group member or a user's group
+type Reference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is the SCIM representation of a provisioned user
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *Name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []Email     `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Groups      []Reference `json:"groups,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// Group is the SCIM representation of a provisioned group
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// ListResponse is the envelope of query results
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// PatchRequest is a PATCH request body
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, remove or replace operation
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Error is a SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// toUser converts a directory user to its SCIM representation
+func toUser(user *domain.User, baseURL string) *User {
+	active := user.Active
+	result := &User{
+		Schemas:     []string{SchemaUser},
+		ID:          user.ID.String(),
+		ExternalID:  user.ExternalID,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     baseURL + "/Users/" + user.ID.String(),
+		},
+	}
+	if user.DisplayName != "" {
+		result.Name = &Name{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		result.Emails = []Email{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range user.Groups {
+		result.Groups = append(result.Groups, Reference{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     baseURL + "/Groups/" + group.ID.String(),
+		})
+	}
+	return result
+}
+
+// fromUser copies the writable attributes of a SCIM user onto a directory user
+func fromUser(in *User, user *domain.User) {
+	user.UserName = in.UserName
+	user.ExternalID = in.ExternalID
+	user.DisplayName = in.DisplayName
+	if user.DisplayName == "" && in.Name != nil {
+		user.DisplayName = in.Name.Formatted
+		if user.DisplayName == "" {
+			user.DisplayName = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+		}
+	}
+	user.Email = primaryEmail(in.Emails)
+	user.Active = in.Active == nil || *in.Active
+}
+
+// primaryEmail returns the primary email, or the first one
+func primaryEmail(emails []Email) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// toGroup converts a directory group to its SCIM representation
+func toGroup(group *domain.Group, baseURL string) *Group {
+	result := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          group.ID.String(),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     baseURL + "/Groups/" + group.ID.String(),
+		},
+	}
+	for _, member := range group.Members {
+		result.Members = append(result.Members, Reference{
+			Value:   member.ID.String(),
+			Display: member.UserName,
+			Ref:     baseURL + "/Users/" + member.ID.String(),
+		})
+	}
+	return result
+}
+
+// userFilterAttributes maps the lower-cased user attributes accepted in filters to directory columns
+var userFilterAttributes = map[string]string{
+	"username":     "user_name",
+	"externalid":   "external_id",
+	"emails":       "email",
+	"emails.value": "email",
+}
+
+// groupFilterAttributes maps the lower-cased group attributes accepted in filters to directory columns
+var groupFilterAttributes = map[string]string{
+	"displayname": "display_name",
+	"externalid":  "external_id",
+}
+
+// parseFilter parses the equality filters identity providers send, e.g. `userName eq "alice"`
+func parseFilter(filter string, attributes map[string]string) (repository.DirectoryFilter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return repository.DirectoryFilter{}, nil
+	}
+
+	attribute, rest, ok := strings.Cut(filter, " ")
+	if !ok {
+		return repository.DirectoryFilter{}, fmt.Errorf("invalid filter %q", filter)
+	}
+	operator, value, ok := strings.Cut(strings.TrimSpace(rest), " ")
+	if !ok || !strings.EqualFold(operator, "eq") {
+		return repository.DirectoryFilter{}, fmt.Errorf("unsupported filter %q: only eq is supported", filter)
+	}
+
+	column, ok := attributes[strings.ToLower(attribute)]
+	if !ok {
+		return repository.DirectoryFilter{}, fmt.Errorf("unsupported filter attribute %q", attribute)
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return repository.DirectoryFilter{}, fmt.Errorf("filter value must be a quoted string: %q", filter)
+	}
+	value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+
+	return repository.DirectoryFilter{Attribute: column, Value: value}, nil
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// OperationAnalyzeAccess is the operation type of AnalyzeAccess
+const OperationAnalyzeAccess = "AnalyzeAccess"
+
+// defaultAnalysisLookbackDays is the decision log window analyzed when none is given
+const defaultAnalysisLookbackDays = 90
+
+// ErrAccessAnalysisDisabled is returned by the access analysis APIs unless the decision log is stored in the database
+var ErrAccessAnalysisDisabled = errors.New("access analysis requires the decision log with the db sink")
+
+// AnalyzeAccessResult is the result of an AnalyzeAccess operation
+type AnalyzeAccessResult struct {
+	Bindings        int64 `json:"bindings"`        // Bindings analyzed
+	Recommendations int   `json:"recommendations"` // Recommendations stored
+}
+
+// SetAccessAnalysis enables AnalyzeAccess and ListAccessRecommendations, which compare the
+// permissions granted by bindings with the allowed checks recorded in the decision log.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetAccessAnalysis(decisions repository.DecisionLogRepository, recommendations repository.AccessRecommendationRepository) {
+	s.decisionRepo = decisions
+	s.recommendationRepo = recommendations
+}
+
+// AnalyzeAccess starts a long-running operation that compares each member's granted permissions
+// with those it used in the last lookbackDays (default 90) and replaces the stored
+// recommendations with the grants that can be trimmed.
+//
+// Usage is only recorded for the principals that made the checks, so bindings to groups and
+// domains are not analyzed. With decision_log.sample_rate below 1 rarely used permissions may
+// be reported as unused.
+func (s *IAMService) AnalyzeAccess(lookbackDays int) (*domain.Operation, error) {
+	if err := s.authorize("AnalyzeAccess", nil); err != nil {
+		return nil, err
+	}
+
+	if s.decisionRepo == nil || s.recommendationRepo == nil {
+		return nil, ErrAccessAnalysisDisabled
+	}
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+	if lookbackDays <= 0 {
+		lookbackDays = defaultAnalysisLookbackDays
+	}
+	since := time.Now().AddDate(0, 0, -lookbackDays)
+
+	return s.operations.Submit(OperationAnalyzeAccess, fmt.Sprintf("%d days", lookbackDays), func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		recommendations, analyzed, err := s.analyzeAccess(ctx, since, progress)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.recommendationRepo.ReplaceAll(recommendations); err != nil {
+			return nil, fmt.Errorf("failed to store recommendations: %w", err)
+		}
+		return &AnalyzeAccessResult{Bindings: analyzed, Recommendations: len(recommendations)}, nil
+	})
+}
+
+// ListAccessRecommendations lists the recommendations of the latest analysis,
+// optionally filtered by principal and by the resource holding the binding
+func (s *IAMService) ListAccessRecommendations(
+	principal string,
+	resourceID *uuid.UUID,
+	pageSize, offset int,
+) ([]domain.AccessRecommendation, error) {
+	if err := s.authorize("ListAccessRecommendations", resourceID); err != nil {
+		return nil, err
+	}
+
+	if s.recommendationRepo == nil {
+		return nil, ErrAccessAnalysisDisabled
+	}
+	return s.recommendationRepo.List(principal, resourceID, pageSize, offset)
+}
+
+// analyzeAccess builds recommendations for every individual member of every binding
+func (s *IAMService) analyzeAccess(ctx context.Context, since time.Time, progress ProgressFunc) ([]domain.AccessRecommendation, int64, error) {
+	usage, err := s.decisionRepo.PermissionUsage(since)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to aggregate decision log: %w", err)
+	}
+	usageByPrincipal := make(map[string][]repository.PermissionUsage)
+	for _, u := range usage {
+		usageByPrincipal[u.Principal] = append(usageByPrincipal[u.Principal], u)
+	}
+
+	policies, err := s.policyRepo.ListWithDetails(nil, 0, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list policies: %w", err)
+	}
+	roles, err := s.roleRepo.List(true, nil, 0, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	var total int64
+	for i := range policies {
+		total += int64(len(policies[i].Bindings))
+	}
+
+	var recommendations []domain.AccessRecommendation
+	var analyzed int64
+	for i := range policies {
+		policy := &policies[i]
+		for j := range policy.Bindings {
+			if err := ctx.Err(); err != nil {
+				return nil, analyzed, err
+			}
+			binding := &policy.Bindings[j]
+			analyzed++
+			progress(analyzed, total)
+
+			if binding.Role == nil {
+				continue
+			}
+			members, err := binding.GetMembers()
+			if err != nil {
+				return nil, analyzed, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+			}
+			for _, member := range members {
+				if !individualPrincipal(member) {
+					continue
+				}
+				if rec := s.recommend(policy, binding, member, usageByPrincipal[member], roles, since); rec != nil {
+					recommendations = append(recommendations, *rec)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Principal != recommendations[j].Principal {
+			return recommendations[i].Principal < recommendations[j].Principal
+		}
+		return recommendations[i].Role < recommendations[j].Role
+	})
+	return recommendations, analyzed, nil
+}
+
+// recommend compares one member's grant with its usage on the policy's resource and subtree.
+// It returns nil when every permission of the role was used.
+func (s *IAMService) recommend(
+	policy *domain.Policy,
+	binding *domain.Binding,
+	member string,
+	usage []repository.PermissionUsage,
+	roles []domain.Role,
+	since time.Time,
+) *domain.AccessRecommendation {
+	granted := make(map[string]bool, len(binding.Role.Permissions))
+	for _, permission := range binding.Role.Permissions {
+		granted[permission.Name] = true
+	}
+	if len(granted) == 0 {
+		return nil
+	}
+
+	var subtreePath string
+	if policy.Resource != nil {
+		subtreePath = policy.Resource.Path
+	}
+
+	used := make(map[string]bool)
+	var lastUsed *time.Time
+	for i := range usage {
+		u := &usage[i]
+		inSubtree := u.ResourceID == policy.ResourceID ||
+			(subtreePath != "" && strings.HasPrefix(u.ResourcePath, subtreePath))
+		if !inSubtree || !granted[u.Permission] {
+			continue
+		}
+		used[u.Permission] = true
+		if lastUsed == nil || u.LastUsedAt.After(*lastUsed) {
+			lastUsed = &u.LastUsedAt
+		}
+	}
+	if len(used) == len(granted) {
+		return nil
+	}
+
+	rec := &domain.AccessRecommendation{
+		Principal:         member,
+		ResourceID:        policy.ResourceID,
+		BindingID:         binding.ID,
+		Role:              binding.Role.Name,
+		UsedPermissions:   permissionNamesJSON(used, nil),
+		UnusedPermissions: permissionNamesJSON(granted, used),
+		LastUsedAt:        lastUsed,
+		ObservedSince:     since,
+	}
+
+	switch {
+	case len(used) == 0:
+		rec.Action = domain.RecommendRemoveMember
+	default:
+		rec.Action = domain.RecommendReviewRole
+		if role := s.smallestCoveringRole(roles, used, len(granted), policy); role != nil {
+			rec.Action = domain.RecommendReplaceRole
+			rec.SuggestedRole = role.Name
+		}
+	}
+	return rec
+}
+
+// smallestCoveringRole returns the role with the fewest permissions, fewer than maxPermissions,
+// that grants every used permission and may be bound on the policy's resource
+func (s *IAMService) smallestCoveringRole(roles []domain.Role, used map[string]bool, maxPermissions int, policy *domain.Policy) *domain.Role {
+	var best *domain.Role
+	for i := range roles {
+		role := &roles[i]
+		if len(role.Permissions) >= maxPermissions || len(role.Permissions) < len(used) {
+			continue
+		}
+		if best != nil && (len(role.Permissions) > len(best.Permissions) ||
+			(len(role.Permissions) == len(best.Permissions) && role.Name > best.Name)) {
+			continue
+		}
+		if !roleApplicable(role, policy, s.attachmentRules) {
+			continue
+		}
+
+		covered := 0
+		for _, permission := range role.Permissions {
+			if used[permission.Name] {
+				covered++
+			}
+		}
+		if covered == len(used) {
+			best = role
+		}
+	}
+	return best
+}
+
+// roleApplicable reports whether role may be bound on the policy's resource: a custom role must
+// be scoped to the resource or one of its ancestors, and attachment rules must allow its type
+func roleApplicable(role *domain.Role, policy *domain.Policy, rules AttachmentRules) bool {
+	if policy.Resource == nil {
+		return role.ScopeResourceID == nil
+	}
+	if role.ScopeResourceID != nil && !strings.Contains(policy.Resource.Path, "/"+role.ScopeResourceID.String()+"/") {
+		return false
+	}
+	return rules.Allows(role.Name, policy.Resource.Type)
+}
+
+// individualPrincipal reports whether member names a single caller whose checks are logged
+// under the same principal, unlike groups and domains
+func individualPrincipal(member string) bool {
+	return !strings.HasPrefix(member, domain.PrincipalTypeGroup+":") &&
+		!strings.HasPrefix(member, domain.PrincipalTypeDomain+":")
+}
+
+// permissionNamesJSON returns the names in set that are not in skip as a sorted JSON array
+func permissionNamesJSON(set, skip map[string]bool) []byte {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	data, _ := json.Marshal(names)
+	return data
+}
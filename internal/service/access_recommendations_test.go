@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// stubDecisionLogRepository returns fixed permission and role usage
+type stubDecisionLogRepository struct {
+	usage     []repository.PermissionUsage
+	roleUsage []repository.RoleGrantUsage
+}
+
+func (r *stubDecisionLogRepository) CreateBatch(entries []domain.DecisionLog) error { return nil }
+
+func (r *stubDecisionLogRepository) List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.DecisionLog, error) {
+	return nil, nil
+}
+
+func (r *stubDecisionLogRepository) PermissionUsage(since time.Time) ([]repository.PermissionUsage, error) {
+	return r.usage, nil
+}
+
+func (r *stubDecisionLogRepository) RoleUsage(roles []string) ([]repository.RoleGrantUsage, error) {
+	return r.roleUsage, nil
+}
+
+// memRecommendationRepository keeps the recommendations of the latest analysis in memory
+type memRecommendationRepository struct {
+	mu              sync.Mutex
+	recommendations []domain.AccessRecommendation
+}
+
+func (r *memRecommendationRepository) ReplaceAll(recommendations []domain.AccessRecommendation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recommendations = recommendations
+	return nil
+}
+
+func (r *memRecommendationRepository) List(principal string, resourceID *uuid.UUID, limit, offset int) ([]domain.AccessRecommendation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.AccessRecommendation
+	for _, rec := range r.recommendations {
+		if (principal == "" || rec.Principal == principal) && (resourceID == nil || rec.ResourceID == *resourceID) {
+			result = append(result, rec)
+		}
+	}
+	return result, nil
+}
+
+func testRole(name string, permissions ...string) domain.Role {
+	role := domain.Role{ID: uuid.New(), Name: name}
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, domain.Permission{ID: uuid.New(), Name: permission})
+	}
+	return role
+}
+
+func testBinding(role *domain.Role, members ...string) domain.Binding {
+	return domain.Binding{ID: uuid.New(), RoleID: role.ID, Role: role, Members: toJSON(members)}
+}
+
+func TestIAMService_AnalyzeAccess(t *testing.T) {
+	projectID := uuid.New()
+	bucketID := uuid.New()
+	projectPath := domain.ResourcePath("", projectID)
+	bucketPath := domain.ResourcePath(projectPath, bucketID)
+
+	admin := testRole("roles/storage.admin", "storage.buckets.get", "storage.buckets.list", "storage.buckets.delete")
+	viewer := testRole("roles/storage.viewer", "storage.buckets.get", "storage.buckets.list")
+	reader := testRole("roles/storage.reader", "storage.buckets.get")
+	editor := testRole("roles/storage.editor", "storage.buckets.get", "storage.buckets.delete")
+
+	policies := []domain.Policy{{
+		ID:         uuid.New(),
+		ResourceID: projectID,
+		Resource:   &domain.Resource{ID: projectID, Type: "project", Path: projectPath},
+		Bindings: []domain.Binding{
+			testBinding(&admin, "user:alice@example.com", "user:bob@example.com", "user:carol@example.com", "user:dave@example.com", "group:ops@example.com"),
+		},
+	}}
+
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	roleRepo.On("List", true, mock.Anything, 0, 0).Return([]domain.Role{admin, viewer, reader, editor}, nil)
+	policyRepo.On("ListWithDetails", (*uuid.UUID)(nil), 0, 0).Return(policies, nil)
+
+	lastUsed := time.Now().Add(-time.Hour)
+	decisions := &stubDecisionLogRepository{usage: []repository.PermissionUsage{
+		// alice reads and lists buckets below the project: viewer is enough
+		{Principal: "user:alice@example.com", ResourceID: bucketID, ResourcePath: bucketPath, Permission: "storage.buckets.get", Count: 3, LastUsedAt: lastUsed},
+		{Principal: "user:alice@example.com", ResourceID: bucketID, ResourcePath: bucketPath, Permission: "storage.buckets.list", Count: 1, LastUsedAt: lastUsed},
+		// bob uses every permission of the role
+		{Principal: "user:bob@example.com", ResourceID: projectID, ResourcePath: projectPath, Permission: "storage.buckets.get", LastUsedAt: lastUsed},
+		{Principal: "user:bob@example.com", ResourceID: projectID, ResourcePath: projectPath, Permission: "storage.buckets.list", LastUsedAt: lastUsed},
+		{Principal: "user:bob@example.com", ResourceID: bucketID, ResourcePath: bucketPath, Permission: "storage.buckets.delete", LastUsedAt: lastUsed},
+		// carol only uses the role elsewhere
+		{Principal: "user:carol@example.com", ResourceID: uuid.New(), ResourcePath: domain.ResourcePath("", uuid.New()), Permission: "storage.buckets.get", LastUsedAt: lastUsed},
+		// dave lists and deletes buckets: no smaller role grants both
+		{Principal: "user:dave@example.com", ResourceID: bucketID, ResourcePath: bucketPath, Permission: "storage.buckets.list", LastUsedAt: lastUsed},
+		{Principal: "user:dave@example.com", ResourceID: bucketID, ResourcePath: bucketPath, Permission: "storage.buckets.delete", LastUsedAt: lastUsed},
+	}}
+	recommendations := &memRecommendationRepository{}
+
+	service := NewIAMService(
+		new(MockResourceRepository),
+		new(MockPermissionRepository),
+		roleRepo,
+		policyRepo,
+		new(MockBindingRepository),
+		new(MockPolicyRevisionRepository),
+		new(MockConditionRepository),
+		new(MockPermissionEvaluator),
+		NewNoopCache(),
+	)
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 10}, newMemOperationRepository(), nil)
+	defer runner.Stop(context.Background())
+	service.SetOperationRunner(runner)
+	service.SetAccessAnalysis(decisions, recommendations)
+
+	operation, err := service.AnalyzeAccess(0)
+	require.NoError(t, err)
+	assert.Equal(t, OperationAnalyzeAccess, operation.Type)
+	assert.Equal(t, "90 days", operation.Target)
+
+	done := waitForOperation(t, runner, operation.ID)
+	require.Equal(t, domain.OperationSucceeded, done.State, done.Error)
+	assert.JSONEq(t, `{"bindings": 1, "recommendations": 3}`, string(done.Result))
+
+	recs, err := service.ListAccessRecommendations("", nil, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, recs, 3)
+
+	alice := recs[0]
+	assert.Equal(t, "user:alice@example.com", alice.Principal)
+	assert.Equal(t, domain.RecommendReplaceRole, alice.Action)
+	assert.Equal(t, "roles/storage.viewer", alice.SuggestedRole)
+	assert.Equal(t, projectID, alice.ResourceID)
+	assert.JSONEq(t, `["storage.buckets.get", "storage.buckets.list"]`, string(alice.UsedPermissions))
+	assert.JSONEq(t, `["storage.buckets.delete"]`, string(alice.UnusedPermissions))
+	require.NotNil(t, alice.LastUsedAt)
+
+	carol := recs[1]
+	assert.Equal(t, "user:carol@example.com", carol.Principal)
+	assert.Equal(t, domain.RecommendRemoveMember, carol.Action)
+	assert.Nil(t, carol.LastUsedAt)
+	assert.JSONEq(t, `[]`, string(carol.UsedPermissions))
+
+	dave := recs[2]
+	assert.Equal(t, "user:dave@example.com", dave.Principal)
+	assert.Equal(t, domain.RecommendReviewRole, dave.Action)
+	assert.Empty(t, dave.SuggestedRole)
+
+	byPrincipal, err := service.ListAccessRecommendations("user:carol@example.com", nil, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, byPrincipal, 1)
+}
+
+func TestIAMService_AnalyzeAccess_Disabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.AnalyzeAccess(30)
+	assert.ErrorIs(t, err, ErrAccessAnalysisDisabled)
+
+	_, err = service.ListAccessRecommendations("", nil, 0, 0)
+	assert.ErrorIs(t, err, ErrAccessAnalysisDisabled)
+
+	service.SetAccessAnalysis(&stubDecisionLogRepository{}, &memRecommendationRepository{})
+	_, err = service.AnalyzeAccess(30)
+	assert.ErrorIs(t, err, ErrOperationsDisabled)
+}
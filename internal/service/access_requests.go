@@ -0,0 +1,267 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"gorm.io/datatypes"
+)
+
+// ErrAccessRequestsDisabled is returned by the access request APIs when no repository is configured
+var ErrAccessRequestsDisabled = errors.New("access requests are not enabled")
+
+// SetAccessRequests enables the access request workflow.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetAccessRequests(requests repository.AccessRequestRepository) {
+	s.accessRequestRepo = requests
+}
+
+// CreateAccessRequest asks for roleID on resourceID for principal, optionally until expiresAt.
+// Caller views may only request access for their caller; an empty principal means the caller.
+func (s *IAMService) CreateAccessRequest(
+	resourceID, roleID uuid.UUID,
+	principal, justification string,
+	expiresAt *time.Time,
+) (*domain.AccessRequest, error) {
+	if s.accessRequestRepo == nil {
+		return nil, ErrAccessRequestsDisabled
+	}
+
+	if s.callerView {
+		if s.caller == "" {
+			return nil, ErrUnauthenticated
+		}
+		if principal == "" {
+			principal = s.caller
+		}
+		if principal != s.caller {
+			return nil, fmt.Errorf("%w: %s cannot request access for %s", ErrPermissionDenied, s.caller, principal)
+		}
+	}
+	if principal == "" {
+		return nil, fmt.Errorf("principal is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiry %s is in the past", expiresAt.Format(time.RFC3339))
+	}
+
+	resource, err := s.resourceRepo.GetByID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+	role, err := s.roleRepo.GetByID(roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role not found")
+	}
+	if err := s.validateRoleScopes(resourceID, []domain.Binding{{RoleID: roleID}}); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.accessRequestRepo.List(repository.AccessRequestFilter{
+		ResourceID: &resourceID,
+		Principal:  principal,
+		RoleID:     &roleID,
+		Status:     domain.AccessRequestPending,
+	}, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access requests: %w", err)
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("access request %s for %s on this resource is already pending", pending[0].ID, role.Name)
+	}
+
+	request := &domain.AccessRequest{
+		ResourceID:    resourceID,
+		RoleID:        roleID,
+		Principal:     principal,
+		Justification: justification,
+		Status:        domain.AccessRequestPending,
+		ExpiresAt:     expiresAt,
+	}
+	if err := s.accessRequestRepo.Create(request); err != nil {
+		return nil, fmt.Errorf("failed to create access request: %w", err)
+	}
+	return request, nil
+}
+
+// GetAccessRequest gets an access request by ID. Requesters may always read their own requests.
+func (s *IAMService) GetAccessRequest(id uuid.UUID) (*domain.AccessRequest, error) {
+	if s.accessRequestRepo == nil {
+		return nil, ErrAccessRequestsDisabled
+	}
+
+	request, err := s.accessRequestRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, s.authorize("GetAccessRequest", nil)
+	}
+	if !s.callerView || request.Principal != s.caller {
+		if err := s.authorize("GetAccessRequest", &request.ResourceID); err != nil {
+			return nil, err
+		}
+	}
+	return request, nil
+}
+
+// ListAccessRequests lists access requests, oldest first. Listing the caller's own requests
+// needs no permission; other listings require iam.accessRequests.list on resourceID, or on the
+// root resource when resourceID is nil.
+func (s *IAMService) ListAccessRequests(filter repository.AccessRequestFilter, pageSize, offset int) ([]domain.AccessRequest, error) {
+	if !s.callerView || filter.Principal != s.caller || s.caller == "" {
+		if err := s.authorize("ListAccessRequests", filter.ResourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.accessRequestRepo == nil {
+		return nil, ErrAccessRequestsDisabled
+	}
+	return s.accessRequestRepo.List(filter, pageSize, offset)
+}
+
+// ApproveAccessRequest approves a pending access request and binds its role to the requester
+// on its resource, with a request.time condition when the request expires. The approver needs
+// iam.accessRequests.approve on the resource, cannot approve their own request and is subject
+// to their grant constraints; the binding is recorded in a policy revision authored by the
+// approver.
+func (s *IAMService) ApproveAccessRequest(id uuid.UUID, comment string) (*domain.AccessRequest, error) {
+	request, err := s.reviewableAccessRequest("ApproveAccessRequest", id)
+	if err != nil {
+		return nil, err
+	}
+
+	var condition *domain.Condition
+	if request.ExpiresAt != nil {
+		if !request.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("access request %s expired at %s", id, request.ExpiresAt.Format(time.RFC3339))
+		}
+		condition = &domain.Condition{
+			Title:       "Access request " + id.String(),
+			Description: "Expires the access granted by the request",
+			Expression:  fmt.Sprintf("request.time < timestamp(%q)", request.ExpiresAt.UTC().Format(time.RFC3339)),
+		}
+	}
+	members, err := json.Marshal([]string{request.Principal})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal members: %w", err)
+	}
+	granted := domain.Binding{RoleID: request.RoleID, Members: datatypes.JSON(members), Condition: condition}
+	if err := s.authorizeGrants(request.ResourceID, GrantChange{Add: []domain.Binding{granted}}); err != nil {
+		return nil, err
+	}
+
+	// Claim the request first so concurrent approvals create a single binding
+	pending := *request
+	now := time.Now()
+	request.Status = domain.AccessRequestApproved
+	request.ReviewedBy = s.caller
+	request.ReviewedAt = &now
+	request.ReviewComment = comment
+	if err := s.accessRequestRepo.Transition(request, domain.AccessRequestPending); err != nil {
+		return nil, fmt.Errorf("failed to approve access request: %w", err)
+	}
+
+	// The approver was authorized above, not for iam.bindings.create
+	granter := *s
+	granter.callerView = false
+	granter.dryRun = false
+	binding, err := granter.CreateBinding(request.ResourceID, request.RoleID, []string{request.Principal}, condition)
+	if err != nil {
+		if reopenErr := s.accessRequestRepo.Transition(&pending, domain.AccessRequestApproved); reopenErr != nil {
+			return nil, fmt.Errorf("%w (and failed to reopen the access request: %v)", err, reopenErr)
+		}
+		return nil, err
+	}
+
+	request.BindingID = &binding.ID
+	if err := s.accessRequestRepo.Transition(request, domain.AccessRequestApproved); err != nil {
+		return nil, fmt.Errorf("failed to record binding of access request: %w", err)
+	}
+	return request, nil
+}
+
+// RejectAccessRequest rejects a pending access request; it requires the same permission as approving it
+func (s *IAMService) RejectAccessRequest(id uuid.UUID, comment string) (*domain.AccessRequest, error) {
+	request, err := s.reviewableAccessRequest("RejectAccessRequest", id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	request.Status = domain.AccessRequestRejected
+	request.ReviewedBy = s.caller
+	request.ReviewedAt = &now
+	request.ReviewComment = comment
+	if err := s.accessRequestRepo.Transition(request, domain.AccessRequestPending); err != nil {
+		return nil, fmt.Errorf("failed to reject access request: %w", err)
+	}
+	return request, nil
+}
+
+// CancelAccessRequest withdraws a pending access request. Caller views may only cancel their own requests.
+func (s *IAMService) CancelAccessRequest(id uuid.UUID) (*domain.AccessRequest, error) {
+	if s.accessRequestRepo == nil {
+		return nil, ErrAccessRequestsDisabled
+	}
+
+	request, err := s.accessRequestRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, fmt.Errorf("access request not found")
+	}
+	if s.callerView && request.Principal != s.caller {
+		return nil, fmt.Errorf("%w: only %s can cancel access request %s", ErrPermissionDenied, request.Principal, id)
+	}
+
+	now := time.Now()
+	request.Status = domain.AccessRequestCancelled
+	request.ReviewedAt = &now
+	if err := s.accessRequestRepo.Transition(request, domain.AccessRequestPending); err != nil {
+		return nil, fmt.Errorf("failed to cancel access request: %w", err)
+	}
+	return request, nil
+}
+
+// reviewableAccessRequest loads a pending access request and authorizes method on its resource.
+// Requesters cannot review their own requests.
+func (s *IAMService) reviewableAccessRequest(method string, id uuid.UUID) (*domain.AccessRequest, error) {
+	if s.accessRequestRepo == nil {
+		return nil, ErrAccessRequestsDisabled
+	}
+
+	request, err := s.accessRequestRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		if err := s.authorize(method, nil); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("access request not found")
+	}
+	if err := s.authorize(method, &request.ResourceID); err != nil {
+		return nil, err
+	}
+	if s.callerView && request.Principal == s.caller {
+		return nil, fmt.Errorf("%w: %s cannot review their own access request", ErrPermissionDenied, s.caller)
+	}
+	if request.Status != domain.AccessRequestPending {
+		return nil, fmt.Errorf("%w: access request %s is %s", repository.ErrAccessRequestResolved, id, request.Status)
+	}
+	return request, nil
+}
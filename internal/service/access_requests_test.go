@@ -0,0 +1,227 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memAccessRequestRepository is an in-memory AccessRequestRepository
+type memAccessRequestRepository struct {
+	mu       sync.Mutex
+	requests []domain.AccessRequest
+}
+
+func (r *memAccessRequestRepository) Create(request *domain.AccessRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if request.ID == uuid.Nil {
+		request.ID = uuid.New()
+	}
+	r.requests = append(r.requests, *request)
+	return nil
+}
+
+func (r *memAccessRequestRepository) GetByID(id uuid.UUID) (*domain.AccessRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.requests {
+		if r.requests[i].ID == id {
+			request := r.requests[i]
+			return &request, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAccessRequestRepository) List(filter repository.AccessRequestFilter, limit, offset int) ([]domain.AccessRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.AccessRequest
+	for _, request := range r.requests {
+		if (filter.ResourceID == nil || request.ResourceID == *filter.ResourceID) &&
+			(filter.Principal == "" || request.Principal == filter.Principal) &&
+			(filter.RoleID == nil || request.RoleID == *filter.RoleID) &&
+			(filter.Status == "" || request.Status == filter.Status) {
+			result = append(result, request)
+		}
+	}
+	return result, nil
+}
+
+func (r *memAccessRequestRepository) Transition(request *domain.AccessRequest, from string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.requests {
+		if r.requests[i].ID == request.ID {
+			if r.requests[i].Status != from {
+				return repository.ErrAccessRequestResolved
+			}
+			r.requests[i] = *request
+			return nil
+		}
+	}
+	return repository.ErrAccessRequestResolved
+}
+
+// accessRequestFixture is a project where user:lead@example.com may approve access requests
+// and user:alice@example.com may request roles/storage.viewer
+type accessRequestFixture struct {
+	service    *IAMService
+	projectID  uuid.UUID
+	viewer     domain.Role
+	policyID   uuid.UUID
+	evaluator  *MockPermissionEvaluator
+	requests   *memAccessRequestRepository
+	revisions  []*domain.PolicyRevision
+	conditions []*domain.Condition
+}
+
+func newAccessRequestFixture(t *testing.T) *accessRequestFixture {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	f := &accessRequestFixture{
+		service:   service,
+		projectID: uuid.New(),
+		viewer:    testRole("roles/storage.viewer", "storage.buckets.get"),
+		policyID:  uuid.New(),
+		evaluator: new(MockPermissionEvaluator),
+		requests:  &memAccessRequestRepository{},
+	}
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, f.evaluator)
+	require.NoError(t, err)
+	service.SetAdminAuthorizer(authorizer)
+	service.SetAccessRequests(f.requests)
+	f.evaluator.On("CheckPermission", "user:lead@example.com", f.projectID, mock.Anything, map[string]string(nil)).
+		Return(true, "granted", nil)
+	f.evaluator.On("CheckPermission", mock.Anything, f.projectID, mock.Anything, map[string]string(nil)).
+		Return(false, "denied", nil)
+
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	resourceRepo.On("GetByID", f.projectID).Return(&domain.Resource{ID: f.projectID, Type: "project"}, nil)
+	service.roleRepo.(*MockRoleRepository).On("GetByID", f.viewer.ID).Return(&f.viewer, nil)
+	policyRepo.On("GetByResourceID", f.projectID).Return(&domain.Policy{ID: f.policyID, ResourceID: f.projectID}, nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", f.policyID).Return(&domain.Policy{ID: f.policyID, ResourceID: f.projectID, Version: 2}, nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Binding).ID = uuid.New()
+	})
+	bindingRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Binding{ID: uuid.New(), PolicyID: f.policyID, RoleID: f.viewer.ID}, nil)
+	service.conditionRepo.(*MockConditionRepository).On("Create", mock.AnythingOfType("*domain.Condition")).
+		Return(nil).Run(func(args mock.Arguments) {
+		f.conditions = append(f.conditions, args.Get(0).(*domain.Condition))
+	})
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).
+		Return(nil).Run(func(args mock.Arguments) {
+		f.revisions = append(f.revisions, args.Get(0).(*domain.PolicyRevision))
+	})
+	return f
+}
+
+func TestIAMService_AccessRequestApproval(t *testing.T) {
+	f := newAccessRequestFixture(t)
+	alice := f.service.AsCaller("user:alice@example.com")
+	lead := f.service.AsCaller("user:lead@example.com")
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	request, err := alice.CreateAccessRequest(f.projectID, f.viewer.ID, "", "incident 42", &expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, "user:alice@example.com", request.Principal)
+	assert.Equal(t, domain.AccessRequestPending, request.Status)
+
+	// Requesters cannot duplicate pending requests or request access for others
+	_, err = alice.CreateAccessRequest(f.projectID, f.viewer.ID, "", "again", nil)
+	assert.ErrorContains(t, err, "already pending")
+	_, err = alice.CreateAccessRequest(f.projectID, f.viewer.ID, "user:bob@example.com", "", nil)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// Requesters read and list their own requests without a permission
+	own, err := alice.GetAccessRequest(request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, request.ID, own.ID)
+	listed, err := alice.ListAccessRequests(repository.AccessRequestFilter{Principal: "user:alice@example.com"}, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+	_, err = f.service.AsCaller("user:bob@example.com").GetAccessRequest(request.ID)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// Only approvers other than the requester may approve
+	_, err = f.service.AsCaller("user:bob@example.com").ApproveAccessRequest(request.ID, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	f.service.bindingRepo.(*MockBindingRepository).AssertNotCalled(t, "Create", mock.Anything)
+
+	approved, err := lead.ApproveAccessRequest(request.ID, "approved for the incident")
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessRequestApproved, approved.Status)
+	assert.Equal(t, "user:lead@example.com", approved.ReviewedBy)
+	require.NotNil(t, approved.BindingID)
+
+	// The binding expires with the request and its revision names the approver
+	require.Len(t, f.conditions, 1)
+	assert.Equal(t, `request.time < timestamp("`+expiresAt.UTC().Format(time.RFC3339)+`")`, f.conditions[0].Expression)
+	require.Len(t, f.revisions, 1)
+	assert.Equal(t, "user:lead@example.com", f.revisions[0].Author)
+
+	stored, err := f.service.GetAccessRequest(request.ID)
+	require.NoError(t, err)
+	assert.Equal(t, approved.BindingID, stored.BindingID)
+
+	_, err = lead.ApproveAccessRequest(request.ID, "")
+	assert.ErrorIs(t, err, repository.ErrAccessRequestResolved)
+}
+
+func TestIAMService_AccessRequestSelfApproval(t *testing.T) {
+	f := newAccessRequestFixture(t)
+	lead := f.service.AsCaller("user:lead@example.com")
+
+	request, err := lead.CreateAccessRequest(f.projectID, f.viewer.ID, "", "", nil)
+	require.NoError(t, err)
+	_, err = lead.ApproveAccessRequest(request.ID, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorContains(t, err, "own access request")
+}
+
+func TestIAMService_AccessRequestRejectAndCancel(t *testing.T) {
+	f := newAccessRequestFixture(t)
+	alice := f.service.AsCaller("user:alice@example.com")
+	lead := f.service.AsCaller("user:lead@example.com")
+
+	rejected, err := alice.CreateAccessRequest(f.projectID, f.viewer.ID, "", "", nil)
+	require.NoError(t, err)
+	rejected, err = lead.RejectAccessRequest(rejected.ID, "use the shared dashboard")
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessRequestRejected, rejected.Status)
+	assert.Equal(t, "use the shared dashboard", rejected.ReviewComment)
+
+	cancelled, err := alice.CreateAccessRequest(f.projectID, f.viewer.ID, "", "", nil)
+	require.NoError(t, err)
+	_, err = f.service.AsCaller("user:bob@example.com").CancelAccessRequest(cancelled.ID)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	cancelled, err = alice.CancelAccessRequest(cancelled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessRequestCancelled, cancelled.Status)
+
+	_, err = lead.ApproveAccessRequest(cancelled.ID, "")
+	assert.ErrorIs(t, err, repository.ErrAccessRequestResolved)
+	pending, err := lead.ListAccessRequests(repository.AccessRequestFilter{ResourceID: &f.projectID, Status: domain.AccessRequestPending}, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	f.service.bindingRepo.(*MockBindingRepository).AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestIAMService_AccessRequestsDisabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.CreateAccessRequest(uuid.New(), uuid.New(), "user:alice@example.com", "", nil)
+	assert.ErrorIs(t, err, ErrAccessRequestsDisabled)
+	_, err = service.ApproveAccessRequest(uuid.New(), "")
+	assert.ErrorIs(t, err, ErrAccessRequestsDisabled)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+)
+
+// AccessReviewCloser periodically closes the access reviews whose due time has passed
+type AccessReviewCloser struct {
+	service  *IAMService
+	interval time.Duration
+	logger   *slog.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewAccessReviewCloser creates a closer running every interval. A nil logger uses slog.Default().
+func NewAccessReviewCloser(service *IAMService, interval time.Duration, logger *slog.Logger) *AccessReviewCloser {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &AccessReviewCloser{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the first pass after one interval and then every interval until Stop
+func (c *AccessReviewCloser) Start() {
+	go c.run()
+}
+
+// Stop waits for a running pass to finish and the closer to exit, or for ctx to expire
+func (c *AccessReviewCloser) Stop(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *AccessReviewCloser) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.close()
+		}
+	}
+}
+
+func (c *AccessReviewCloser) close() {
+	closed, err := c.service.CloseDueAccessReviews()
+	if errors.Is(err, domain.ErrNotWriter) {
+		// The writer's region closes them
+		c.logger.Debug("Closing due access reviews skipped", "error", err)
+		return
+	}
+	if err != nil {
+		c.logger.Error("Closing due access reviews failed", "closed", closed, "error", err)
+		return
+	}
+	if closed > 0 {
+		c.logger.Info("Closed due access reviews", "closed", closed)
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"gorm.io/datatypes"
+)
+
+// ErrAccessReviewsDisabled is returned by the access review APIs when no repository is configured
+var ErrAccessReviewsDisabled = errors.New("access reviews are not enabled")
+
+// MaxAccessReviewItems is the maximum number of grants an access review may cover
+const MaxAccessReviewItems = 50000
+
+// SetAccessReviews enables access review campaigns.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetAccessReviews(reviews repository.AccessReviewRepository) {
+	s.accessReviewRepo = reviews
+}
+
+// CreateAccessReview opens a review of every binding member on resourceID and its descendants.
+// Reviewers (principals or domain members) decide on the items; when dueAt is set, the review
+// closer closes the review after it. With revokeUndecided, items still pending on close are
+// revoked instead of kept.
+func (s *IAMService) CreateAccessReview(
+	resourceID uuid.UUID,
+	title string,
+	reviewers []string,
+	dueAt *time.Time,
+	revokeUndecided bool,
+) (*domain.AccessReview, error) {
+	if err := s.authorize("CreateAccessReview", &resourceID); err != nil {
+		return nil, err
+	}
+
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+	if title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if len(reviewers) == 0 {
+		return nil, fmt.Errorf("access review requires at least one reviewer")
+	}
+
+	resource, err := s.resourceRepo.GetByID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	items, err := s.accessReviewItems(resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewersJSON, err := json.Marshal(reviewers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reviewers: %w", err)
+	}
+	review := &domain.AccessReview{
+		ResourceID:      resourceID,
+		Title:           title,
+		Reviewers:       datatypes.JSON(reviewersJSON),
+		Status:          domain.AccessReviewOpen,
+		DueAt:           dueAt,
+		RevokeUndecided: revokeUndecided,
+		CreatedBy:       s.caller,
+	}
+	if err := s.accessReviewRepo.Create(review, items); err != nil {
+		return nil, fmt.Errorf("failed to create access review: %w", err)
+	}
+	return review, nil
+}
+
+// accessReviewItems returns a pending item per member of every binding on resourceID and its descendants
+func (s *IAMService) accessReviewItems(resourceID uuid.UUID) ([]domain.AccessReviewItem, error) {
+	descendants, err := s.resourceRepo.GetDescendants(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get descendants: %w", err)
+	}
+	resourceIDs := make([]uuid.UUID, 0, len(descendants)+1)
+	resourceIDs = append(resourceIDs, resourceID)
+	for i := range descendants {
+		resourceIDs = append(resourceIDs, descendants[i].ID)
+	}
+
+	var items []domain.AccessReviewItem
+	for _, id := range resourceIDs {
+		policy, err := s.policyRepo.GetByResourceID(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy: %w", err)
+		}
+		if policy == nil {
+			continue
+		}
+		for _, binding := range policy.Bindings {
+			members, err := binding.GetMembers()
+			if err != nil {
+				return nil, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+			}
+			var condition string
+			if binding.Condition != nil {
+				condition = binding.Condition.Expression
+			}
+			for _, member := range members {
+				items = append(items, domain.AccessReviewItem{
+					ResourceID: id,
+					BindingID:  binding.ID,
+					RoleID:     binding.RoleID,
+					Member:     member,
+					Condition:  condition,
+					Decision:   domain.ReviewDecisionPending,
+				})
+			}
+		}
+		if len(items) > MaxAccessReviewItems {
+			return nil, fmt.Errorf("access review would cover more than %d grants; review a smaller subtree", MaxAccessReviewItems)
+		}
+	}
+	return items, nil
+}
+
+// GetAccessReview gets an access review by ID. Its reviewers may always read it.
+func (s *IAMService) GetAccessReview(id uuid.UUID) (*domain.AccessReview, error) {
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+	return s.readableAccessReview("GetAccessReview", id)
+}
+
+// ListAccessReviews lists access reviews, optionally only those on resourceID or with status
+func (s *IAMService) ListAccessReviews(resourceID *uuid.UUID, status string, pageSize, offset int) ([]domain.AccessReview, error) {
+	if err := s.authorize("ListAccessReviews", resourceID); err != nil {
+		return nil, err
+	}
+
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+	return s.accessReviewRepo.List(resourceID, status, pageSize, offset)
+}
+
+// ListAccessReviewItems lists the items of an access review, optionally only those with decision.
+// Its reviewers may always list them.
+func (s *IAMService) ListAccessReviewItems(reviewID uuid.UUID, decision string, pageSize, offset int) ([]domain.AccessReviewItem, error) {
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+	review, err := s.readableAccessReview("ListAccessReviewItems", reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		return nil, fmt.Errorf("access review not found")
+	}
+	return s.accessReviewRepo.ListItems(reviewID, decision, pageSize, offset)
+}
+
+// DecideAccessReviewItem approves or revokes an item of an open access review. Caller views must
+// be a reviewer of the review and cannot decide on their own access.
+func (s *IAMService) DecideAccessReviewItem(itemID uuid.UUID, decision, comment string) (*domain.AccessReviewItem, error) {
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+	if decision != domain.ReviewDecisionApproved && decision != domain.ReviewDecisionRevoked {
+		return nil, fmt.Errorf("decision must be %q or %q", domain.ReviewDecisionApproved, domain.ReviewDecisionRevoked)
+	}
+
+	item, err := s.accessReviewRepo.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("access review item not found")
+	}
+	review, err := s.accessReviewRepo.GetByID(item.ReviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		return nil, fmt.Errorf("access review not found")
+	}
+
+	if s.callerView {
+		if s.caller == "" {
+			return nil, ErrUnauthenticated
+		}
+		if !review.IsReviewer(s.caller) {
+			return nil, fmt.Errorf("%w: %s is not a reviewer of access review %s", ErrPermissionDenied, s.caller, review.ID)
+		}
+		if !domain.IsPublicMember(item.Member) && domain.MemberMatches(item.Member, s.caller) {
+			return nil, fmt.Errorf("%w: %s cannot review their own access", ErrPermissionDenied, s.caller)
+		}
+	}
+	if review.Status != domain.AccessReviewOpen {
+		return nil, fmt.Errorf("%w: %s", repository.ErrAccessReviewClosed, review.ID)
+	}
+
+	now := time.Now()
+	item.Decision = decision
+	item.DecidedBy = s.caller
+	item.DecidedAt = &now
+	item.Comment = comment
+	if err := s.accessReviewRepo.Decide(item); err != nil {
+		return nil, fmt.Errorf("failed to record decision: %w", err)
+	}
+	return item, nil
+}
+
+// CloseAccessReview closes an open access review and removes every revoked member from the
+// bindings that still grant it the reviewed role under the same condition. Bindings left
+// without members are deleted. Each changed policy gets a revision authored by the caller.
+func (s *IAMService) CloseAccessReview(id uuid.UUID) (*domain.AccessReview, error) {
+	if s.accessReviewRepo == nil {
+		return nil, ErrAccessReviewsDisabled
+	}
+
+	review, err := s.accessReviewRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		if err := s.authorize("CloseAccessReview", nil); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("access review not found")
+	}
+	if err := s.authorize("CloseAccessReview", &review.ResourceID); err != nil {
+		return nil, err
+	}
+	if review.Status != domain.AccessReviewOpen {
+		return nil, fmt.Errorf("%w: %s", repository.ErrAccessReviewClosed, review.ID)
+	}
+	return s.closeAccessReview(review)
+}
+
+// CloseDueAccessReviews closes the open access reviews whose due time has passed, returning how
+// many were closed. A review that fails to close is retried on the next call.
+func (s *IAMService) CloseDueAccessReviews() (int, error) {
+	if s.accessReviewRepo == nil {
+		return 0, ErrAccessReviewsDisabled
+	}
+
+	due, err := s.accessReviewRepo.ListDue(time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due access reviews: %w", err)
+	}
+	var errs []error
+	closed := 0
+	for i := range due {
+		if _, err := s.closeAccessReview(&due[i]); err != nil {
+			errs = append(errs, fmt.Errorf("access review %s: %w", due[i].ID, err))
+			continue
+		}
+		closed++
+	}
+	return closed, errors.Join(errs...)
+}
+
+// closeAccessReview revokes the review's revoked grants, then marks it closed. Revoking is
+// idempotent, so a review whose close failed halfway can be closed again.
+func (s *IAMService) closeAccessReview(review *domain.AccessReview) (*domain.AccessReview, error) {
+	items, err := s.accessReviewRepo.ListItems(review.ID, "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access review items: %w", err)
+	}
+
+	revoked := make(map[uuid.UUID]map[grantKey]bool)
+	for _, item := range items {
+		if item.Decision == domain.ReviewDecisionRevoked ||
+			(item.Decision == domain.ReviewDecisionPending && review.RevokeUndecided) {
+			if revoked[item.ResourceID] == nil {
+				revoked[item.ResourceID] = make(map[grantKey]bool)
+			}
+			revoked[item.ResourceID][grantKey{item.RoleID, item.Member, item.Condition}] = true
+		}
+	}
+
+	// The caller was authorized to close the review, not for iam.policies.update
+	revoker := *s
+	revoker.callerView = false
+	revoker.dryRun = false
+	removed := 0
+	for resourceID, grants := range revoked {
+		n, err := revoker.revokeGrants(resourceID, grants)
+		if err != nil {
+			return nil, err
+		}
+		removed += n
+	}
+
+	now := time.Now()
+	review.Status = domain.AccessReviewClosed
+	review.ClosedBy = s.caller
+	review.ClosedAt = &now
+	review.Revoked = removed
+	if err := s.accessReviewRepo.Close(review); err != nil {
+		return nil, fmt.Errorf("failed to close access review: %w", err)
+	}
+	return review, nil
+}
+
+// revokeGrants removes the members of grants from the bindings of resourceID's policy, returning
+// how many members were removed
+func (s *IAMService) revokeGrants(resourceID uuid.UUID, grants map[grantKey]bool) (int, error) {
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get policy: %w", err)
+	}
+	if policy == nil {
+		return 0, nil
+	}
+
+	removed := 0
+	bindings := make([]domain.Binding, 0, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		members, err := binding.GetMembers()
+		if err != nil {
+			return 0, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+		}
+		var condition string
+		if binding.Condition != nil {
+			condition = binding.Condition.Expression
+		}
+		kept := make([]string, 0, len(members))
+		for _, member := range members {
+			if grants[grantKey{binding.RoleID, member, condition}] {
+				removed++
+				continue
+			}
+			kept = append(kept, member)
+		}
+		if len(kept) == 0 {
+			continue
+		}
+
+		membersJSON, err := json.Marshal(kept)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal members: %w", err)
+		}
+		rebound := domain.Binding{RoleID: binding.RoleID, Members: datatypes.JSON(membersJSON), Annotations: binding.Annotations}
+		if binding.Condition != nil {
+			rebound.Condition = &domain.Condition{
+				Title:       binding.Condition.Title,
+				Description: binding.Condition.Description,
+				Expression:  binding.Condition.Expression,
+			}
+		}
+		bindings = append(bindings, rebound)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if _, err := s.replaceBindings(policy, bindings); err != nil {
+		return 0, fmt.Errorf("failed to revoke access on resource %s: %w", resourceID, err)
+	}
+	return removed, nil
+}
+
+// readableAccessReview loads an access review, authorizing method on its resource unless the
+// caller is one of its reviewers; unknown reviews are authorized on the root resource
+func (s *IAMService) readableAccessReview(method string, id uuid.UUID) (*domain.AccessReview, error) {
+	review, err := s.accessReviewRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		return nil, s.authorize(method, nil)
+	}
+	if !s.callerView || s.caller == "" || !review.IsReviewer(s.caller) {
+		if err := s.authorize(method, &review.ResourceID); err != nil {
+			return nil, err
+		}
+	}
+	return review, nil
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memAccessReviewRepository is an in-memory AccessReviewRepository
+type memAccessReviewRepository struct {
+	mu      sync.Mutex
+	reviews []domain.AccessReview
+	items   []domain.AccessReviewItem
+}
+
+func (r *memAccessReviewRepository) Create(review *domain.AccessReview, items []domain.AccessReviewItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if review.ID == uuid.Nil {
+		review.ID = uuid.New()
+	}
+	r.reviews = append(r.reviews, *review)
+	for _, item := range items {
+		item.ID = uuid.New()
+		item.ReviewID = review.ID
+		r.items = append(r.items, item)
+	}
+	return nil
+}
+
+func (r *memAccessReviewRepository) GetByID(id uuid.UUID) (*domain.AccessReview, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.reviews {
+		if r.reviews[i].ID == id {
+			review := r.reviews[i]
+			return &review, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAccessReviewRepository) List(resourceID *uuid.UUID, status string, limit, offset int) ([]domain.AccessReview, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.AccessReview
+	for _, review := range r.reviews {
+		if (resourceID == nil || review.ResourceID == *resourceID) && (status == "" || review.Status == status) {
+			result = append(result, review)
+		}
+	}
+	return result, nil
+}
+
+func (r *memAccessReviewRepository) ListDue(before time.Time) ([]domain.AccessReview, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.AccessReview
+	for _, review := range r.reviews {
+		if review.Status == domain.AccessReviewOpen && review.DueAt != nil && review.DueAt.Before(before) {
+			result = append(result, review)
+		}
+	}
+	return result, nil
+}
+
+func (r *memAccessReviewRepository) Close(review *domain.AccessReview) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.reviews {
+		if r.reviews[i].ID == review.ID && r.reviews[i].Status == domain.AccessReviewOpen {
+			r.reviews[i] = *review
+			return nil
+		}
+	}
+	return repository.ErrAccessReviewClosed
+}
+
+func (r *memAccessReviewRepository) GetItem(id uuid.UUID) (*domain.AccessReviewItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.items {
+		if r.items[i].ID == id {
+			item := r.items[i]
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memAccessReviewRepository) ListItems(reviewID uuid.UUID, decision string, limit, offset int) ([]domain.AccessReviewItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.AccessReviewItem
+	for _, item := range r.items {
+		if item.ReviewID == reviewID && (decision == "" || item.Decision == decision) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (r *memAccessReviewRepository) Decide(item *domain.AccessReviewItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.items {
+		if r.items[i].ID == item.ID {
+			r.items[i] = *item
+			return nil
+		}
+	}
+	return repository.ErrAccessReviewClosed
+}
+
+// accessReviewFixture is a project whose policy grants roles/storage.viewer to alice and bob and
+// roles/owner to the reviewer, user:lead@example.com
+type accessReviewFixture struct {
+	service   *IAMService
+	projectID uuid.UUID
+	policyID  uuid.UUID
+	viewer    domain.Role
+	owner     domain.Role
+	reviews   *memAccessReviewRepository
+	initial   []domain.Binding
+	deleted   []uuid.UUID
+	created   []domain.Binding
+}
+
+func newAccessReviewFixture(t *testing.T) *accessReviewFixture {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	f := &accessReviewFixture{
+		service:   service,
+		projectID: uuid.New(),
+		policyID:  uuid.New(),
+		viewer:    testRole("roles/storage.viewer", "storage.buckets.get"),
+		owner:     testRole("roles/owner", "admin.all"),
+		reviews:   &memAccessReviewRepository{},
+	}
+	service.SetAccessReviews(f.reviews)
+
+	evaluator := new(MockPermissionEvaluator)
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, evaluator)
+	require.NoError(t, err)
+	service.SetAdminAuthorizer(authorizer)
+	evaluator.On("CheckPermission", "user:admin@example.com", f.projectID, mock.Anything, map[string]string(nil)).
+		Return(true, "granted", nil)
+	evaluator.On("CheckPermission", mock.Anything, f.projectID, mock.Anything, map[string]string(nil)).
+		Return(false, "denied", nil)
+
+	viewerBinding := testBinding(&f.viewer, "user:alice@example.com", "user:bob@example.com")
+	viewerBinding.Condition = &domain.Condition{ID: uuid.New(), Expression: `resource.type == "project"`}
+	f.initial = []domain.Binding{viewerBinding, testBinding(&f.owner, "user:lead@example.com")}
+	policy := &domain.Policy{ID: f.policyID, ResourceID: f.projectID, Bindings: f.initial}
+
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	conditionRepo := service.conditionRepo.(*MockConditionRepository)
+	resourceRepo.On("GetByID", f.projectID).Return(&domain.Resource{ID: f.projectID, Type: "project"}, nil)
+	resourceRepo.On("GetDescendants", f.projectID).Return([]domain.Resource{}, nil)
+	roleRepo.On("GetByID", f.viewer.ID).Return(&f.viewer, nil)
+	roleRepo.On("GetByID", f.owner.ID).Return(&f.owner, nil)
+	policyRepo.On("GetByResourceID", f.projectID).Return(policy, nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", f.policyID).Return(policy, nil)
+	bindingRepo.On("Delete", mock.AnythingOfType("uuid.UUID")).Return(nil).Run(func(args mock.Arguments) {
+		f.deleted = append(f.deleted, args.Get(0).(uuid.UUID))
+	})
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil).Run(func(args mock.Arguments) {
+		f.created = append(f.created, *args.Get(0).(*domain.Binding))
+	})
+	conditionRepo.On("Delete", mock.AnythingOfType("uuid.UUID")).Return(nil)
+	conditionRepo.On("Create", mock.AnythingOfType("*domain.Condition")).Return(nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+	return f
+}
+
+// item returns the review item of member
+func (f *accessReviewFixture) item(t *testing.T, reviewID uuid.UUID, member string) domain.AccessReviewItem {
+	items, err := f.service.ListAccessReviewItems(reviewID, "", 0, 0)
+	require.NoError(t, err)
+	for _, item := range items {
+		if item.Member == member {
+			return item
+		}
+	}
+	t.Fatalf("no review item for %s", member)
+	return domain.AccessReviewItem{}
+}
+
+// currentMembers returns the members of the bindings of the policy after the changes made since
+// the fixture was set up, by role name
+func (f *accessReviewFixture) currentMembers(t *testing.T) map[string][]string {
+	var current []domain.Binding
+	for _, binding := range f.initial {
+		if !slices.Contains(f.deleted, binding.ID) {
+			current = append(current, binding)
+		}
+	}
+	members := make(map[string][]string)
+	for _, binding := range append(current, f.created...) {
+		names, err := binding.GetMembers()
+		require.NoError(t, err)
+		role := f.viewer.Name
+		if binding.RoleID == f.owner.ID {
+			role = f.owner.Name
+		}
+		members[role] = append(members[role], names...)
+		sort.Strings(members[role])
+	}
+	return members
+}
+
+func TestIAMService_AccessReviewCampaign(t *testing.T) {
+	f := newAccessReviewFixture(t)
+	admin := f.service.AsCaller("user:admin@example.com")
+	lead := f.service.AsCaller("user:lead@example.com")
+
+	_, err := lead.CreateAccessReview(f.projectID, "Q3", []string{"user:lead@example.com"}, nil, false)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	review, err := admin.CreateAccessReview(f.projectID, "Q3", []string{"user:lead@example.com"}, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, "user:admin@example.com", review.CreatedBy)
+
+	// One item per binding member; reviewers list them without a permission
+	items, err := lead.ListAccessReviewItems(review.ID, "", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, items, 3)
+	_, err = f.service.AsCaller("user:bob@example.com").ListAccessReviewItems(review.ID, "", 0, 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	bob := f.item(t, review.ID, "user:bob@example.com")
+	assert.Equal(t, `resource.type == "project"`, bob.Condition)
+	decided, err := lead.DecideAccessReviewItem(bob.ID, domain.ReviewDecisionRevoked, "left the team")
+	require.NoError(t, err)
+	assert.Equal(t, "user:lead@example.com", decided.DecidedBy)
+	_, err = lead.DecideAccessReviewItem(f.item(t, review.ID, "user:alice@example.com").ID, domain.ReviewDecisionApproved, "")
+	require.NoError(t, err)
+
+	// Reviewers cannot decide on their own access, and others cannot decide at all
+	_, err = lead.DecideAccessReviewItem(f.item(t, review.ID, "user:lead@example.com").ID, domain.ReviewDecisionApproved, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = f.service.AsCaller("user:bob@example.com").DecideAccessReviewItem(bob.ID, domain.ReviewDecisionApproved, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = lead.DecideAccessReviewItem(bob.ID, "maybe", "")
+	assert.ErrorContains(t, err, "decision must be")
+
+	// Closing removes bob from the viewer binding, keeping its condition and the undecided owner
+	_, err = lead.CloseAccessReview(review.ID)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	closed, err := admin.CloseAccessReview(review.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.AccessReviewClosed, closed.Status)
+	assert.Equal(t, 1, closed.Revoked)
+	assert.Equal(t, map[string][]string{
+		"roles/storage.viewer": {"user:alice@example.com"},
+		"roles/owner":          {"user:lead@example.com"},
+	}, f.currentMembers(t))
+	for _, binding := range f.created {
+		if binding.RoleID == f.viewer.ID {
+			require.NotNil(t, binding.Condition)
+			assert.Equal(t, `resource.type == "project"`, binding.Condition.Expression)
+		}
+	}
+
+	_, err = lead.DecideAccessReviewItem(bob.ID, domain.ReviewDecisionApproved, "")
+	assert.ErrorIs(t, err, repository.ErrAccessReviewClosed)
+	_, err = admin.CloseAccessReview(review.ID)
+	assert.ErrorIs(t, err, repository.ErrAccessReviewClosed)
+}
+
+// Test: Due reviews are closed in the background, revoking undecided items when configured
+func TestAccessReviewCloser(t *testing.T) {
+	f := newAccessReviewFixture(t)
+	due := time.Now().Add(-time.Minute)
+	review, err := f.service.CreateAccessReview(f.projectID, "expiring", []string{"user:lead@example.com"}, &due, true)
+	require.NoError(t, err)
+	_, err = f.service.DecideAccessReviewItem(f.item(t, review.ID, "user:lead@example.com").ID, domain.ReviewDecisionApproved, "")
+	require.NoError(t, err)
+
+	closer := NewAccessReviewCloser(f.service, 10*time.Millisecond, nil)
+	closer.Start()
+	require.Eventually(t, func() bool {
+		closed, err := f.service.GetAccessReview(review.ID)
+		return err == nil && closed.Status == domain.AccessReviewClosed
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, closer.Stop(context.Background()))
+
+	closed, err := f.service.GetAccessReview(review.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, closed.Revoked)
+	assert.Equal(t, map[string][]string{"roles/owner": {"user:lead@example.com"}}, f.currentMembers(t))
+}
+
+func TestIAMService_AccessReviewsDisabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.CreateAccessReview(uuid.New(), "Q3", []string{"user:lead@example.com"}, nil, false)
+	assert.ErrorIs(t, err, ErrAccessReviewsDisabled)
+	_, err = service.CloseDueAccessReviews()
+	assert.ErrorIs(t, err, ErrAccessReviewsDisabled)
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+// Permissions guarding the IAM service's own admin APIs
+const (
+	PermResourcesCreate   = "iam.resources.create"
+	PermResourcesGet      = "iam.resources.get"
+	PermResourcesUpdate   = "iam.resources.update"
+	PermResourcesDelete   = "iam.resources.delete"
+	PermResourcesList     = "iam.resources.list"
+	PermResourcesUndelete = "iam.resources.undelete"
+	PermPermissionsCreate = "iam.permissions.create"
+	PermPermissionsGet    = "iam.permissions.get"
+	PermPermissionsList   = "iam.permissions.list"
+	PermPermissionsUpdate = "iam.permissions.update"
+	PermRolesCreate       = "iam.roles.create"
+	PermRolesGet          = "iam.roles.get"
+	PermRolesUpdate       = "iam.roles.update"
+	PermRolesDelete       = "iam.roles.delete"
+	PermRolesList         = "iam.roles.list"
+	PermRolesUndelete     = "iam.roles.undelete"
+	PermPoliciesCreate    = "iam.policies.create"
+	PermPoliciesGet       = "iam.policies.get"
+	PermPoliciesUpdate    = "iam.policies.update"
+	PermPoliciesDelete    = "iam.policies.delete"
+	PermPoliciesList      = "iam.policies.list"
+	PermPoliciesUndelete  = "iam.policies.undelete"
+	PermBindingsCreate    = "iam.bindings.create"
+	PermBindingsDelete    = "iam.bindings.delete"
+	PermBindingsList      = "iam.bindings.list"
+	PermCacheWarm         = "iam.cache.warm"
+	PermCacheGet          = "iam.cache.get"
+	PermCacheFlush        = "iam.cache.flush"
+	PermStatsGet          = "iam.evaluationStats.get"
+	PermDatabaseStatsGet  = "iam.databaseStats.get"
+	PermOperationsGet     = "iam.operations.get"
+	PermOperationsList    = "iam.operations.list"
+	PermAccessAnalyze     = "iam.recommendations.analyze"
+	PermAccessList        = "iam.recommendations.list"
+	PermGrantsCreate      = "iam.grantConstraints.create"
+	PermGrantsGet         = "iam.grantConstraints.get"
+	PermGrantsUpdate      = "iam.grantConstraints.update"
+	PermGrantsDelete      = "iam.grantConstraints.delete"
+	PermGrantsList        = "iam.grantConstraints.list"
+	PermRequestsGet       = "iam.accessRequests.get"
+	PermRequestsList      = "iam.accessRequests.list"
+	PermRequestsApprove   = "iam.accessRequests.approve"
+	PermReviewsCreate     = "iam.accessReviews.create"
+	PermReviewsGet        = "iam.accessReviews.get"
+	PermReviewsList       = "iam.accessReviews.list"
+	PermReviewsClose      = "iam.accessReviews.close"
+	PermAliasesCreate     = "iam.principalAliases.create"
+	PermAliasesDelete     = "iam.principalAliases.delete"
+	PermAliasesList       = "iam.principalAliases.list"
+	PermIntegrityScan     = "iam.integrity.scan"
+	PermIntegrityGet      = "iam.integrity.get"
+)
+
+// AdminMethodPermissions maps admin RPC names to the permission the caller must hold.
+// Every RPC is listed here or in PublicMethods; Authorize denies methods in neither.
+var AdminMethodPermissions = map[string]string{
+	"CreateResource":                     PermResourcesCreate,
+	"GetResource":                        PermResourcesGet,
+	"UpdateResource":                     PermResourcesUpdate,
+	"DeleteResource":                     PermResourcesDelete,
+	"ListResources":                      PermResourcesList,
+	"GetResourceHierarchy":               PermResourcesGet,
+	"DeleteResourceTree":                 PermResourcesDelete,
+	"UndeleteResource":                   PermResourcesUndelete,
+	"MoveResource":                       PermResourcesUpdate,
+	"SetResourceTags":                    PermResourcesUpdate,
+	"UpdateResourceAttributes":           PermResourcesUpdate,
+	"CreatePermission":                   PermPermissionsCreate,
+	"GetPermission":                      PermPermissionsGet,
+	"ListPermissions":                    PermPermissionsList,
+	"SyncServicePermissions":             PermPermissionsUpdate,
+	"DeprecatePermission":                PermPermissionsUpdate,
+	"UndeprecatePermission":              PermPermissionsUpdate,
+	"ListRolesWithDeprecatedPermissions": PermRolesList,
+	"CreateRole":                         PermRolesCreate,
+	"GetRole":                            PermRolesGet,
+	"UpdateRole":                         PermRolesUpdate,
+	"DeleteRole":                         PermRolesDelete,
+	"UndeleteRole":                       PermRolesUndelete,
+	"ListRoles":                          PermRolesList,
+	"AnalyzeRoleImpact":                  PermRolesUpdate,
+	"GetRoleUsage":                       PermRolesGet,
+	"CreatePolicy":                       PermPoliciesCreate,
+	"GetPolicy":                          PermPoliciesGet,
+	"GetEffectivePolicy":                 PermPoliciesGet,
+	"UpdatePolicy":                       PermPoliciesUpdate,
+	"DeletePolicy":                       PermPoliciesDelete,
+	"UndeletePolicy":                     PermPoliciesUndelete,
+	"ListPolicies":                       PermPoliciesList,
+	"GetPolicyRevision":                  PermPoliciesGet,
+	"ListPolicyRevisions":                PermPoliciesGet,
+	"RollbackPolicy":                     PermPoliciesUpdate,
+	"ValidatePolicy":                     PermPoliciesGet,
+	"ScanPolicies":                       PermPoliciesList,
+	"ScanIntegrity":                      PermIntegrityScan,
+	"GetIntegrityReport":                 PermIntegrityGet,
+	"ExportRelationTuples":               PermPoliciesList,
+	"WatchPolicies":                      PermPoliciesGet,
+	"GetPolicySnapshot":                  PermPoliciesGet,
+	"SetPolicy":                          PermPoliciesUpdate,
+	"ExportState":                        PermPoliciesGet,
+	"ImportState":                        PermPoliciesUpdate,
+	"ImportGCPPolicy":                    PermPoliciesUpdate,
+	"ExportGCPPolicy":                    PermPoliciesGet,
+	"ImportAWSPolicy":                    PermRolesCreate,
+	"CreateBinding":                      PermBindingsCreate,
+	"DeleteBinding":                      PermBindingsDelete,
+	"ListBindings":                       PermBindingsList,
+	"SearchBindings":                     PermBindingsList,
+	"BatchCreateBindings":                PermBindingsCreate,
+	"BatchDeleteBindings":                PermBindingsDelete,
+	"ImportBindingsCSV":                  PermBindingsCreate,
+	"WarmCache":                          PermCacheWarm,
+	"GetCacheStats":                      PermCacheGet,
+	"LookupCacheEntry":                   PermCacheGet,
+	"FlushCache":                         PermCacheFlush,
+	"GetEvaluationStats":                 PermStatsGet,
+	"GetDatabaseStats":                   PermDatabaseStatsGet,
+	"GetOperation":                       PermOperationsGet,
+	"ListOperations":                     PermOperationsList,
+	"AnalyzeAccess":                      PermAccessAnalyze,
+	"ListAccessRecommendations":          PermAccessList,
+	"CreateGrantConstraint":              PermGrantsCreate,
+	"GetGrantConstraint":                 PermGrantsGet,
+	"UpdateGrantConstraint":              PermGrantsUpdate,
+	"DeleteGrantConstraint":              PermGrantsDelete,
+	"ListGrantConstraints":               PermGrantsList,
+	"GetAccessRequest":                   PermRequestsGet,
+	"ListAccessRequests":                 PermRequestsList,
+	"ApproveAccessRequest":               PermRequestsApprove,
+	"RejectAccessRequest":                PermRequestsApprove,
+	"CreateAccessReview":                 PermReviewsCreate,
+	"GetAccessReview":                    PermReviewsGet,
+	"ListAccessReviews":                  PermReviewsList,
+	"ListAccessReviewItems":              PermReviewsGet,
+	"CloseAccessReview":                  PermReviewsClose,
+	"LinkPrincipal":                      PermAliasesCreate,
+	"UnlinkPrincipal":                    PermAliasesDelete,
+	"ListPrincipalAliases":               PermAliasesList,
+	"RewriteAliasedMembers":              PermPoliciesUpdate,
+	"RemovePrincipal":                    PermPoliciesUpdate,
+	"GetEffectivePermissions":            PermPoliciesGet,
+}
+
+// PublicMethods are the RPCs any caller may invoke: the permission checks of the data plane,
+// which reveal single decisions rather than policies, listing the children a caller may access,
+// which callers may only do for themselves, stateless utilities, access requests,
+// which callers may only create and cancel for themselves, and access review decisions, which
+// only the reviewers of a review may record
+var PublicMethods = map[string]bool{
+	"CheckPermission":              true,
+	"BatchCheckPermissions":        true,
+	"CheckPermissionOnResources":   true,
+	"CheckPermissionForPrincipals": true,
+	"TestIamPermissions":           true,
+	"ListAuthorizedChildren":       true,
+	"ValidateCondition":            true,
+	"GetVersion":                   true,
+	"CreateAccessRequest":          true,
+	"CancelAccessRequest":          true,
+	"DecideAccessReviewItem":       true,
+}
+
+var (
+	// ErrUnauthenticated is returned when an admin API is called without a caller principal
+	ErrUnauthenticated = errors.New("caller principal is required")
+	// ErrPermissionDenied is returned when the caller lacks the permission for an admin API
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// AdminAuthorizer authorizes callers of the IAM admin APIs
+type AdminAuthorizer interface {
+	// Authorize checks that caller may invoke method on the given resource.
+	// A nil resourceID targets the configured root resource (used for global objects such as roles).
+	Authorize(caller, method string, resourceID *uuid.UUID) error
+}
+
+type adminAuthorizer struct {
+	evaluator      PermissionEvaluator
+	enabled        bool
+	rootPrincipals map[string]bool
+	rootResourceID *uuid.UUID
+}
+
+// NewAdminAuthorizer creates an authorizer that enforces iam.* permissions through the evaluator
+func NewAdminAuthorizer(cfg *config.AuthzConfig, evaluator PermissionEvaluator) (AdminAuthorizer, error) {
+	a := &adminAuthorizer{
+		evaluator:      evaluator,
+		enabled:        cfg.Enabled,
+		rootPrincipals: make(map[string]bool, len(cfg.RootPrincipals)),
+	}
+
+	for _, principal := range cfg.RootPrincipals {
+		a.rootPrincipals[principal] = true
+	}
+
+	if cfg.RootResourceID != "" {
+		id, err := uuid.Parse(cfg.RootResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root resource id: %w", err)
+		}
+		a.rootResourceID = &id
+	}
+
+	return a, nil
+}
+
+func (a *adminAuthorizer) Authorize(caller, method string, resourceID *uuid.UUID) error {
+	if !a.enabled {
+		return nil
+	}
+
+	if PublicMethods[method] {
+		return nil
+	}
+	permission, guarded := AdminMethodPermissions[method]
+	if !guarded {
+		return fmt.Errorf("%w: %s is not an authorized method", ErrPermissionDenied, method)
+	}
+
+	if caller == "" {
+		return ErrUnauthenticated
+	}
+
+	// Bootstrap principals can always call admin APIs so the first admin can be created
+	if a.rootPrincipals[caller] {
+		return nil
+	}
+
+	target := resourceID
+	if target == nil {
+		target = a.rootResourceID
+	}
+	if target == nil {
+		return fmt.Errorf("%w: %s requires %s and no root resource is configured", ErrPermissionDenied, method, permission)
+	}
+
+	allowed, _, err := a.evaluator.CheckPermission(caller, *target, permission, nil)
+	if err != nil {
+		return fmt.Errorf("failed to authorize %s: %w", method, err)
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s requires %s", ErrPermissionDenied, method, permission)
+	}
+
+	return nil
+}
+
+// SetAdminAuthorizer sets the authorizer checking the admin methods of caller views (AsCaller).
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetAdminAuthorizer(authorizer AdminAuthorizer) {
+	s.authorizer = authorizer
+}
+
+// AsCaller returns a view of the service acting for caller, the authenticated principal of a
+// request. Each admin method of the view authorizes caller before doing anything, and policy
+// revisions it records name caller as their author. The transport serves every request through
+// the view of its caller; the service itself acts for the server (seeding, background jobs) and
+// is not authorized.
+func (s *IAMService) AsCaller(caller string) *IAMService {
+	view := *s
+	view.caller = caller
+	view.callerView = true
+	return &view
+}
+
+// authorize checks that the caller of a caller view may invoke method on resourceID; a nil
+// resourceID targets the root resource
+func (s *IAMService) authorize(method string, resourceID *uuid.UUID) error {
+	if !s.callerView || s.authorizer == nil {
+		return nil
+	}
+	return s.authorizer.Authorize(s.caller, method, resourceID)
+}
+
+// authorizeBindingRemoval authorizes method on the resource of the policy holding a binding,
+// including the grant constraints of removing it; unknown bindings are authorized on the root
+// resource
+func (s *IAMService) authorizeBindingRemoval(method string, bindingID uuid.UUID) error {
+	if !s.callerView {
+		return nil
+	}
+	binding, err := s.bindingRepo.GetByID(bindingID)
+	if err != nil {
+		return fmt.Errorf("failed to get binding: %w", err)
+	}
+	if binding == nil {
+		return s.authorize(method, nil)
+	}
+	policy, err := s.policyRepo.GetByID(binding.PolicyID)
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %w", err)
+	}
+	if policy == nil {
+		return s.authorize(method, nil)
+	}
+	if err := s.authorize(method, &policy.ResourceID); err != nil {
+		return err
+	}
+	return s.authorizeGrants(policy.ResourceID, GrantChange{Remove: []uuid.UUID{bindingID}})
+}
+
+// authorizeGrantConstraint authorizes method on the resource a grant constraint is defined on;
+// unknown constraints are authorized on the root resource. Methods changing the constraint
+// also require that the caller is not bound by a constraint there.
+func (s *IAMService) authorizeGrantConstraint(method string, id uuid.UUID, changes bool) error {
+	if !s.callerView || s.grantConstraintRepo == nil {
+		return nil
+	}
+	constraint, err := s.grantConstraintRepo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get grant constraint: %w", err)
+	}
+	if constraint == nil {
+		return s.authorize(method, nil)
+	}
+	if err := s.authorize(method, &constraint.ResourceID); err != nil {
+		return err
+	}
+	if changes {
+		return s.AuthorizeGrantConstraintChange(s.caller, constraint.ResourceID)
+	}
+	return nil
+}
+
+// authorizeGrants checks the grant constraints of the caller of a caller view
+func (s *IAMService) authorizeGrants(resourceID uuid.UUID, change GrantChange) error {
+	if !s.callerView {
+		return nil
+	}
+	return s.AuthorizeGrants(s.caller, resourceID, change)
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Disabled authorizer allows everything
+func TestAdminAuthorizer_Disabled(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: false}, evaluator)
+	require.NoError(t, err)
+
+	err = authorizer.Authorize("", "CreateRole", nil)
+	assert.NoError(t, err)
+	evaluator.AssertNotCalled(t, "CheckPermission")
+}
+
+// Test: Root principals bypass permission checks
+func TestAdminAuthorizer_RootPrincipal(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{
+		Enabled:        true,
+		RootPrincipals: []string{"user:root@example.com"},
+	}, evaluator)
+	require.NoError(t, err)
+
+	err = authorizer.Authorize("user:root@example.com", "CreateRole", nil)
+	assert.NoError(t, err)
+	evaluator.AssertNotCalled(t, "CheckPermission")
+}
+
+// Test: Missing caller is rejected
+func TestAdminAuthorizer_Unauthenticated(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, evaluator)
+	require.NoError(t, err)
+
+	err = authorizer.Authorize("", "UpdatePolicy", nil)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+// Test: Public methods are always allowed and unknown methods denied
+func TestAdminAuthorizer_PublicMethod(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, evaluator)
+	require.NoError(t, err)
+
+	err = authorizer.Authorize("", "CheckPermission", nil)
+	assert.NoError(t, err)
+	err = authorizer.Authorize("user:alice@example.com", "DropDatabase", nil)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+}
+
+// Test: Every RPC of the API is guarded or public
+func TestAdminMethodPermissions_CoverAPI(t *testing.T) {
+	files, err := filepath.Glob("../../api/proto/iam/v1/*.proto")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	rpc := regexp.MustCompile(`(?m)^\s*rpc\s+(\w+)\s*\(`)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		for _, match := range rpc.FindAllStringSubmatch(string(data), -1) {
+			_, guarded := AdminMethodPermissions[match[1]]
+			assert.True(t, guarded || PublicMethods[match[1]], "%s is neither guarded nor public", match[1])
+		}
+	}
+}
+
+// Test: Admin methods of a caller view reject callers without the permission before acting
+func TestIAMService_AsCaller(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	evaluator := new(MockPermissionEvaluator)
+	rootID, resourceID := uuid.New(), uuid.New()
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true, RootResourceID: rootID.String()}, evaluator)
+	require.NoError(t, err)
+	service.SetAdminAuthorizer(authorizer)
+
+	evaluator.On("CheckPermission", "user:bob@example.com", resourceID, PermResourcesUpdate, map[string]string(nil)).
+		Return(false, "denied", nil)
+	evaluator.On("CheckPermission", "user:bob@example.com", rootID, PermRolesCreate, map[string]string(nil)).
+		Return(false, "denied", nil)
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, PermResourcesGet, map[string]string(nil)).
+		Return(true, "granted", nil)
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "folder"}, nil)
+
+	_, err = service.AsCaller("user:bob@example.com").UpdateResource(resourceID, "renamed", nil, nil, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = service.AsCaller("user:bob@example.com").CreateRole("roles/custom", "Custom", "", nil, nil)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = service.AsCaller("").GetResource(resourceID)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	resourceRepo.AssertNotCalled(t, "Update", mock.Anything)
+
+	resource, err := service.AsCaller("user:alice@example.com").GetResource(resourceID)
+	require.NoError(t, err)
+	assert.Equal(t, resourceID, resource.ID)
+
+	// The service itself acts for the server
+	resource, err = service.GetResource(resourceID)
+	require.NoError(t, err)
+	assert.Equal(t, resourceID, resource.ID)
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 3)
+}
+
+// Test: Permission methods of a caller view are checked on the root resource
+func TestIAMService_AsCaller_Permissions(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	evaluator := new(MockPermissionEvaluator)
+	rootID := uuid.New()
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true, RootResourceID: rootID.String()}, evaluator)
+	require.NoError(t, err)
+	service.SetAdminAuthorizer(authorizer)
+
+	for _, permission := range []string{PermPermissionsCreate, PermPermissionsGet, PermPermissionsList} {
+		evaluator.On("CheckPermission", "user:bob@example.com", rootID, permission, map[string]string(nil)).
+			Return(false, "denied", nil)
+	}
+	bob := service.AsCaller("user:bob@example.com")
+
+	_, err = bob.CreatePermission("storage.buckets.create", "", "storage")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = bob.GetPermission(uuid.New())
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = bob.ListPermissions("storage", 10, 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 3)
+}
+
+// Test: Listing policies with their details is authorized like ListPolicies
+func TestIAMService_AsCaller_ListPoliciesWithDetails(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	evaluator := new(MockPermissionEvaluator)
+	rootID, parentID := uuid.New(), uuid.New()
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true, RootResourceID: rootID.String()}, evaluator)
+	require.NoError(t, err)
+	service.SetAdminAuthorizer(authorizer)
+
+	evaluator.On("CheckPermission", "user:bob@example.com", parentID, PermPoliciesList, map[string]string(nil)).
+		Return(false, "denied", nil)
+
+	_, err = service.AsCaller("user:bob@example.com").ListPoliciesWithDetails(&parentID, 10, 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 1)
+}
+
+// Test: Resource-scoped methods are checked on the target resource
+func TestAdminAuthorizer_ResourceScoped(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, evaluator)
+	require.NoError(t, err)
+
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, PermPoliciesUpdate, map[string]string(nil)).
+		Return(true, "granted", nil).Once()
+	err = authorizer.Authorize("user:alice@example.com", "UpdatePolicy", &resourceID)
+	assert.NoError(t, err)
+
+	evaluator.On("CheckPermission", "user:bob@example.com", resourceID, PermPoliciesUpdate, map[string]string(nil)).
+		Return(false, "denied", nil).Once()
+	err = authorizer.Authorize("user:bob@example.com", "UpdatePolicy", &resourceID)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	evaluator.AssertExpectations(t)
+}
+
+// Test: Global methods are checked on the root resource
+func TestAdminAuthorizer_GlobalUsesRootResource(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	rootID := uuid.New()
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{
+		Enabled:        true,
+		RootResourceID: rootID.String(),
+	}, evaluator)
+	require.NoError(t, err)
+
+	evaluator.On("CheckPermission", "user:alice@example.com", rootID, PermRolesCreate, map[string]string(nil)).
+		Return(true, "granted", nil)
+
+	err = authorizer.Authorize("user:alice@example.com", "CreateRole", nil)
+	assert.NoError(t, err)
+	evaluator.AssertExpectations(t)
+}
+
+// Test: Global methods are denied without a root resource
+func TestAdminAuthorizer_GlobalWithoutRootResource(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true}, evaluator)
+	require.NoError(t, err)
+
+	err = authorizer.Authorize("user:alice@example.com", "CreateRole", nil)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+}
+
+// Test: Invalid root resource id is rejected
+func TestNewAdminAuthorizer_InvalidRootResource(t *testing.T) {
+	_, err := NewAdminAuthorizer(&config.AuthzConfig{
+		Enabled:        true,
+		RootResourceID: "not-a-uuid",
+	}, new(MockPermissionEvaluator))
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrRoleNotAttachable is returned when a role is bound on a resource type its attachment rule does not allow
+var ErrRoleNotAttachable = errors.New("role cannot be bound on this resource type")
+
+// AttachmentRules maps role names to the resource types they may be bound on.
+// Roles without a rule may be bound on any resource type.
+type AttachmentRules map[string][]string
+
+// Allows reports whether role may be bound on a resource of the given type
+func (r AttachmentRules) Allows(role, resourceType string) bool {
+	types, ok := r[role]
+	if !ok {
+		return true
+	}
+	for _, t := range types {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the resource types role may be bound on, for error messages
+func (r AttachmentRules) describe(role string) string {
+	types := append([]string(nil), r[role]...)
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// SetAttachmentRules restricts the resource types roles may be bound on.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetAttachmentRules(rules AttachmentRules) {
+	s.attachmentRules = rules
+}
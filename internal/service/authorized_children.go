@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// ErrAuthorizedListingDisabled is returned by ListAuthorizedChildren when no evaluation read
+// model is configured
+var ErrAuthorizedListingDisabled = errors.New("listing authorized children requires the evaluation read model")
+
+// SetEvaluationGrants enables ListAuthorizedChildren, which filters children in the evaluation
+// read model. It must be called before the service starts handling requests.
+func (s *IAMService) SetEvaluationGrants(grants repository.EvaluationGrantRepository) {
+	s.evaluationGrantRepo = grants
+}
+
+// ListAuthorizedChildren lists the children of parentID on which principal holds permission,
+// ordered by name. Children granted through the hierarchy or an unconditional binding are
+// selected in the database; those granted only under a condition are checked by the evaluator
+// and dropped when it denies, so a page may hold fewer than pageSize children. nextOffset is the
+// offset of the next page, or 0 after the last. Callers may only list for themselves; principal
+// defaults to the caller.
+func (s *IAMService) ListAuthorizedChildren(
+	parentID uuid.UUID,
+	principal, permission string,
+	pageSize, offset int,
+) (children []domain.Resource, nextOffset int, err error) {
+	if s.evaluationGrantRepo == nil {
+		return nil, 0, ErrAuthorizedListingDisabled
+	}
+
+	if s.callerView {
+		if s.caller == "" {
+			return nil, 0, ErrUnauthenticated
+		}
+		if principal == "" {
+			principal = s.caller
+		}
+		if principal != s.caller {
+			return nil, 0, fmt.Errorf("%w: %s cannot list children for %s", ErrPermissionDenied, s.caller, principal)
+		}
+	}
+	if principal == "" {
+		return nil, 0, fmt.Errorf("principal is required")
+	}
+	if permission == "" {
+		return nil, 0, fmt.Errorf("permission is required")
+	}
+
+	parent, err := s.resourceRepo.GetByID(parentID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if parent == nil {
+		return nil, 0, fmt.Errorf("resource not found")
+	}
+	ancestors, err := s.resourceRepo.GetAncestors(parentID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	chain := make([]uuid.UUID, 0, len(ancestors)+1)
+	chain = append(chain, parentID)
+	for _, ancestor := range ancestors {
+		chain = append(chain, ancestor.ID)
+	}
+
+	members, err := s.evaluator.GrantingMembers(principal)
+	if err != nil {
+		return nil, 0, err
+	}
+	candidates, err := s.evaluationGrantRepo.AuthorizedChildren(parentID, chain, permission, members, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list authorized children: %w", err)
+	}
+	if pageSize > 0 && len(candidates) == pageSize {
+		nextOffset = offset + pageSize
+	}
+
+	// Conditions are evaluated in one batch, so the hierarchy is loaded once
+	var checks []PermissionCheck
+	for _, candidate := range candidates {
+		if candidate.Conditional {
+			checks = append(checks, PermissionCheck{ResourceID: candidate.Resource.ID, Permission: permission})
+		}
+	}
+	var results []CheckResult
+	if len(checks) > 0 {
+		results, err = s.evaluator.BatchCheckPermissions(principal, checks)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(results) != len(checks) {
+			return nil, 0, fmt.Errorf("evaluator returned %d results for %d checks", len(results), len(checks))
+		}
+	}
+
+	children = make([]domain.Resource, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Conditional {
+			allowed := results[0].Allowed
+			results = results[1:]
+			if !allowed {
+				continue
+			}
+		}
+		children = append(children, candidate.Resource)
+	}
+	return children, nextOffset, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedAuthorizedChildren returns the same candidates for every page
+type fixedAuthorizedChildren struct {
+	memEvaluationGrants
+	children []repository.AuthorizedChild
+	members  []string
+}
+
+func (f *fixedAuthorizedChildren) AuthorizedChildren(_ uuid.UUID, _ []uuid.UUID, _ string, members []string, _, _ int) ([]repository.AuthorizedChild, error) {
+	f.members = members
+	return f.children, nil
+}
+
+// Test: Children granted only under a condition are kept when the evaluator allows them
+func TestIAMService_ListAuthorizedChildren(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	evaluator := service.evaluator.(*MockPermissionEvaluator)
+
+	_, _, err := service.ListAuthorizedChildren(uuid.New(), "user:alice@example.com", "storage.buckets.get", 10, 0)
+	assert.ErrorIs(t, err, ErrAuthorizedListingDisabled)
+
+	parentID, orgID := uuid.New(), uuid.New()
+	a, b, c := domain.Resource{ID: uuid.New(), Name: "a"}, domain.Resource{ID: uuid.New(), Name: "b"}, domain.Resource{ID: uuid.New(), Name: "c"}
+	grants := &fixedAuthorizedChildren{children: []repository.AuthorizedChild{
+		{Resource: a},
+		{Resource: b, Conditional: true},
+		{Resource: c, Conditional: true},
+	}}
+	service.SetEvaluationGrants(grants)
+
+	resourceRepo.On("GetByID", parentID).Return(&domain.Resource{ID: parentID}, nil)
+	resourceRepo.On("GetAncestors", parentID).Return([]domain.Resource{{ID: orgID}}, nil)
+	members := []string{"user:alice@example.com", "domain:example.com"}
+	evaluator.On("GrantingMembers", "user:alice@example.com").Return(members, nil)
+	evaluator.On("BatchCheckPermissions", "user:alice@example.com", []PermissionCheck{
+		{ResourceID: b.ID, Permission: "storage.buckets.get"},
+		{ResourceID: c.ID, Permission: "storage.buckets.get"},
+	}).Return([]CheckResult{{Allowed: false}, {Allowed: true}}, nil)
+
+	children, next, err := service.AsCaller("user:alice@example.com").ListAuthorizedChildren(parentID, "", "storage.buckets.get", 3, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Resource{a, c}, children)
+	assert.Equal(t, 6, next, "a full page of candidates may be followed by another")
+	assert.Equal(t, members, grants.members)
+
+	_, next, err = service.ListAuthorizedChildren(parentID, "user:alice@example.com", "storage.buckets.get", 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, next)
+
+	_, _, err = service.AsCaller("user:alice@example.com").ListAuthorizedChildren(parentID, "user:bob@example.com", "storage.buckets.get", 10, 0)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, _, err = service.ListAuthorizedChildren(parentID, "user:alice@example.com", "", 10, 0)
+	assert.ErrorContains(t, err, "permission is required")
+
+	missing := uuid.New()
+	resourceRepo.On("GetByID", missing).Return(nil, nil)
+	_, _, err = service.ListAuthorizedChildren(missing, "user:alice@example.com", "storage.buckets.get", 10, 0)
+	assert.ErrorContains(t, err, "resource not found")
+}
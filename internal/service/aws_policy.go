@@ -0,0 +1,505 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// AWSPolicyDocument is an AWS IAM identity-based policy document, as returned by
+// "aws iam get-policy-version". Statement may be a single statement or a list of them.
+type AWSPolicyDocument struct {
+	Version   string         `json:"Version,omitempty"`
+	Statement []AWSStatement `json:"Statement"`
+}
+
+// AWSStatement is a statement of an AWS policy document. Only Allow statements with Action,
+// Resource and supported Condition operators can be imported; see ImportAWSPolicy.
+type AWSStatement struct {
+	Sid          string                              `json:"Sid,omitempty"`
+	Effect       string                              `json:"Effect"`
+	Action       AWSStringList                       `json:"Action,omitempty"`
+	NotAction    AWSStringList                       `json:"NotAction,omitempty"`
+	Resource     AWSStringList                       `json:"Resource,omitempty"`
+	NotResource  AWSStringList                       `json:"NotResource,omitempty"`
+	Principal    json.RawMessage                     `json:"Principal,omitempty"`
+	NotPrincipal json.RawMessage                     `json:"NotPrincipal,omitempty"`
+	Condition    map[string]map[string]AWSStringList `json:"Condition,omitempty"`
+}
+
+// AWSStringList is a policy element that is either a single value or a list of values. Numbers
+// and booleans, which conditions may use, are read as their text.
+type AWSStringList []string
+
+// UnmarshalJSON reads a single value or a list of values
+func (l *AWSStringList) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+
+	*l = make(AWSStringList, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			*l = append(*l, value)
+		case float64, bool:
+			*l = append(*l, fmt.Sprint(value))
+		default:
+			return fmt.Errorf("expected a string or a list of strings, got %s", data)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON reads a document whose Statement is a single statement or a list of them
+func (d *AWSPolicyDocument) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Version   string          `json:"Version"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	d.Version = raw.Version
+	d.Statement = nil
+
+	statement := bytes.TrimSpace(raw.Statement)
+	switch {
+	case len(statement) == 0 || bytes.Equal(statement, []byte("null")):
+		return nil
+	case statement[0] == '{':
+		d.Statement = make([]AWSStatement, 1)
+		return json.Unmarshal(statement, &d.Statement[0])
+	default:
+		return json.Unmarshal(statement, &d.Statement)
+	}
+}
+
+// AWSPolicyMapping maps the actions and resources of AWS policies to permissions and resources:
+//
+//	actions:
+//	  s3:GetObject: [storage.objects.get]
+//	  s3:ListBucket: [storage.objects.list]
+//	resources:
+//	  arn:aws:s3:::prod-data: Example Corp/Production/prod-data
+//	  arn:aws:s3:::prod-data/*: Example Corp/Production/prod-data
+//
+// Actions are matched without regard to case, and the wildcards of statements ("s3:Get*", "*")
+// expand to every mapped action they match. Resources are matched exactly, wildcards included,
+// and map to a resource path (the names of a root and its descendants, separated by "/") or ID.
+type AWSPolicyMapping struct {
+	Actions   map[string][]string `yaml:"actions"`
+	Resources map[string]string   `yaml:"resources"`
+}
+
+// AWSPolicyBinding is a binding an AWS policy statement translates to
+type AWSPolicyBinding struct {
+	Statement  string // Sid of the statement, or "statement<N>" when it has none
+	Resource   string // AWS resource the binding comes from
+	ResourceID uuid.UUID
+	Role       string
+	Members    []string
+	Condition  *SeedCondition
+}
+
+// AWSPolicyImport is the translation of an AWS policy imported by ImportAWSPolicy
+type AWSPolicyImport struct {
+	Roles      []SeedRole // One custom role per statement
+	Bindings   []AWSPolicyBinding
+	RoleCounts SeedCounts // Roles created, updated and unchanged
+}
+
+// awsPolicyVersions are the versions of the AWS policy language
+var awsPolicyVersions = []string{"", "2012-10-17", "2008-10-17"}
+
+// awsPolicyNamePattern matches the names of imported AWS policies and the Sids of their statements
+var awsPolicyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ParseAWSPolicyDocument reads an AWS policy document. The output of "aws iam get-policy-version",
+// which wraps the document in PolicyVersion.Document, is accepted as well.
+func ParseAWSPolicyDocument(r io.Reader) (*AWSPolicyDocument, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse aws policy: %w", err)
+	}
+	var wrapped struct {
+		PolicyVersion struct {
+			Document json.RawMessage `json:"Document"`
+		} `json:"PolicyVersion"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil && len(wrapped.PolicyVersion.Document) > 0 {
+		raw = wrapped.PolicyVersion.Document
+	}
+
+	document := &AWSPolicyDocument{}
+	if err := json.Unmarshal(raw, document); err != nil {
+		return nil, fmt.Errorf("failed to parse aws policy: %w", err)
+	}
+	return document, nil
+}
+
+// ParseAWSPolicyMapping reads and validates a YAML (or JSON) AWSPolicyMapping. Unknown fields are
+// rejected so that typos do not silently drop mappings.
+func ParseAWSPolicyMapping(r io.Reader) (*AWSPolicyMapping, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	mapping := &AWSPolicyMapping{}
+	if err := decoder.Decode(mapping); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse aws policy mapping: %w", err)
+	}
+
+	var problems []string
+	for _, action := range slices.Sorted(maps.Keys(mapping.Actions)) {
+		service, name, ok := strings.Cut(action, ":")
+		switch {
+		case !ok || service == "" || name == "":
+			problems = append(problems, fmt.Sprintf("action %q: name must be <service>:<action>", action))
+		case strings.ContainsAny(action, "*?"):
+			problems = append(problems, fmt.Sprintf("action %q: mapped actions cannot have wildcards", action))
+		case len(mapping.Actions[action]) == 0:
+			problems = append(problems, fmt.Sprintf("action %q: at least one permission is required", action))
+		}
+	}
+	for _, resource := range slices.Sorted(maps.Keys(mapping.Resources)) {
+		if resource == "" || mapping.Resources[resource] == "" {
+			problems = append(problems, fmt.Sprintf("resource %q: %q: names are required", resource, mapping.Resources[resource]))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid aws policy mapping:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return mapping, nil
+}
+
+// ImportAWSPolicy translates an AWS policy document attached to members into roles and bindings,
+// and applies them. Each statement becomes a custom role "roles/aws.<name>.<Sid>" (or
+// "statement<N>" without a Sid) with the permissions its actions map to, created or updated as
+// ApplySeed does, and a binding of that role to members on each resource it names, merged into
+// the resource's policy as BatchCreateBindings does. Statement conditions become the condition of
+// their bindings.
+//
+// Deny statements, NotAction, NotResource, Principal and NotPrincipal have no equivalent and are
+// rejected, as are unmapped actions and resources and unsupported condition operators; every
+// problem is reported at once, before anything is written. In a dry run the roles are validated
+// but, since they may not exist yet, the bindings are only translated.
+func (s *IAMService) ImportAWSPolicy(name string, document *AWSPolicyDocument, mapping *AWSPolicyMapping, members []string) (*AWSPolicyImport, error) {
+	if err := s.authorize("ImportAWSPolicy", nil); err != nil {
+		return nil, err
+	}
+
+	imported, err := s.translateAWSPolicy(name, document, mapping, members)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SeedResult{}
+	if err := s.seedRoles(&SeedFile{Roles: imported.Roles}, nil, result); err != nil {
+		return nil, err
+	}
+	imported.RoleCounts = result.Roles
+	if s.dryRun {
+		return imported, nil
+	}
+
+	var resourceIDs []uuid.UUID
+	byResource := make(map[uuid.UUID][]domain.Binding)
+	roleIDs := make(map[string]uuid.UUID)
+	for _, translated := range imported.Bindings {
+		roleID, ok := roleIDs[translated.Role]
+		if !ok {
+			role, err := s.roleRepo.GetByName(translated.Role)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get role %q: %w", translated.Role, err)
+			}
+			if role == nil {
+				return nil, fmt.Errorf("role %q not found", translated.Role)
+			}
+			roleID = role.ID
+			roleIDs[translated.Role] = roleID
+		}
+
+		membersJSON, err := membersJSON(translated.Members)
+		if err != nil {
+			return nil, err
+		}
+		binding := domain.Binding{RoleID: roleID, Members: membersJSON}
+		if condition := translated.Condition; condition != nil {
+			binding.Condition = &domain.Condition{Title: condition.Title, Description: condition.Description, Expression: condition.Expression}
+		}
+		if _, ok := byResource[translated.ResourceID]; !ok {
+			resourceIDs = append(resourceIDs, translated.ResourceID)
+		}
+		byResource[translated.ResourceID] = append(byResource[translated.ResourceID], binding)
+	}
+
+	for _, resourceID := range resourceIDs {
+		if _, err := s.BatchCreateBindings(resourceID, byResource[resourceID]); err != nil {
+			return nil, fmt.Errorf("resource %s: %w", resourceID, err)
+		}
+	}
+	return imported, nil
+}
+
+// translateAWSPolicy translates the statements of document, reporting every problem at once
+func (s *IAMService) translateAWSPolicy(name string, document *AWSPolicyDocument, mapping *AWSPolicyMapping, members []string) (*AWSPolicyImport, error) {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !awsPolicyNamePattern.MatchString(name) {
+		addf("policy name %q must be letters, digits, '_' and '-'", name)
+	}
+	if !slices.Contains(awsPolicyVersions, document.Version) {
+		addf("unsupported policy language version %q", document.Version)
+	}
+	if len(document.Statement) == 0 {
+		addf("at least one statement is required")
+	}
+	if len(members) == 0 {
+		addf("at least one member is required")
+	} else if _, err := membersJSON(members); err != nil {
+		addf("%v", err)
+	}
+	if mapping == nil {
+		mapping = &AWSPolicyMapping{}
+	}
+
+	imported := &AWSPolicyImport{}
+	resolver := &resourcePathResolver{s: s, resolved: make(map[string]resolvedPath)}
+	permissions := make(map[string]bool)
+	labels := make(map[string]bool)
+	for i, statement := range document.Statement {
+		label := statement.Sid
+		if label == "" {
+			label = fmt.Sprintf("statement%d", i+1)
+		} else if !awsPolicyNamePattern.MatchString(label) {
+			addf("Statement[%d]: Sid %q must be letters, digits, '_' and '-'", i, label)
+		}
+		if labels[label] {
+			addf("Statement[%d]: Sid %q is used by another statement", i, label)
+		}
+		labels[label] = true
+		addStatementf := func(format string, args ...interface{}) {
+			addf("Statement[%d]: "+format, append([]interface{}{i}, args...)...)
+		}
+
+		switch {
+		case statement.Effect == "Deny":
+			addStatementf("Deny statements are not supported: bindings only grant permissions")
+			continue
+		case statement.Effect != "Allow":
+			addStatementf("invalid Effect %q", statement.Effect)
+			continue
+		}
+		for _, unsupported := range []struct {
+			element string
+			present bool
+		}{
+			{"NotAction", len(statement.NotAction) > 0},
+			{"NotResource", len(statement.NotResource) > 0},
+			{"Principal", len(statement.Principal) > 0},
+			{"NotPrincipal", len(statement.NotPrincipal) > 0},
+		} {
+			if unsupported.present {
+				addStatementf("%s is not supported", unsupported.element)
+			}
+		}
+		if len(statement.Action) == 0 {
+			addStatementf("Action is required")
+		}
+		if len(statement.Resource) == 0 {
+			addStatementf("Resource is required")
+		}
+
+		// Actions
+		var granted []string
+		for _, action := range statement.Action {
+			matched := matchAWSActions(action, mapping.Actions)
+			if len(matched) == 0 {
+				addStatementf("action %q has no mapping", action)
+			}
+			for _, mapped := range matched {
+				granted = append(granted, mapping.Actions[mapped]...)
+			}
+		}
+		slices.Sort(granted)
+		granted = slices.Compact(granted)
+		for _, permission := range granted {
+			found, ok := permissions[permission]
+			if !ok {
+				existing, err := s.permissionRepo.GetByName(permission)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get permission %q: %w", permission, err)
+				}
+				found = existing != nil
+				permissions[permission] = found
+			}
+			if !found {
+				addStatementf("permission %q not found", permission)
+			}
+		}
+
+		// Condition
+		var condition *SeedCondition
+		if len(statement.Condition) > 0 {
+			expression, err := awsConditionExpression(statement.Condition)
+			if err == nil {
+				err = s.ValidateCondition(expression)
+			}
+			if err != nil {
+				addStatementf("%v", err)
+			} else {
+				condition = &SeedCondition{
+					Title:       label,
+					Description: fmt.Sprintf("Condition of statement %s of AWS policy %s", label, name),
+					Expression:  expression,
+				}
+			}
+		}
+
+		role := SeedRole{
+			Name:        fmt.Sprintf("roles/aws.%s.%s", name, label),
+			Title:       fmt.Sprintf("%s %s", name, label),
+			Description: fmt.Sprintf("Imported from statement %s of AWS policy %s", label, name),
+			Permissions: granted,
+		}
+		imported.Roles = append(imported.Roles, role)
+
+		// Resources
+		var resourceIDs []uuid.UUID
+		for _, resource := range statement.Resource {
+			target, ok := mapping.Resources[resource]
+			if !ok {
+				addStatementf("resource %q has no mapping", resource)
+				continue
+			}
+			resourceID, err := uuid.Parse(target)
+			if err != nil {
+				if resourceID, err = resolver.resolve(target); err != nil {
+					addStatementf("resource %q: %v", resource, err)
+					continue
+				}
+			}
+			if slices.Contains(resourceIDs, resourceID) {
+				continue
+			}
+			resourceIDs = append(resourceIDs, resourceID)
+			imported.Bindings = append(imported.Bindings, AWSPolicyBinding{
+				Statement:  label,
+				Resource:   resource,
+				ResourceID: resourceID,
+				Role:       role.Name,
+				Members:    members,
+				Condition:  condition,
+			})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid aws policy:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return imported, nil
+}
+
+// matchAWSActions returns the mapped actions an action of a statement names, in name order
+func matchAWSActions(action string, mapped map[string][]string) []string {
+	pattern := regexp.MustCompile("(?i)^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(action)) + "$")
+	var matched []string
+	for _, candidate := range slices.Sorted(maps.Keys(mapped)) {
+		if pattern.MatchString(candidate) {
+			matched = append(matched, candidate)
+		}
+	}
+	return matched
+}
+
+// awsDateOperators are the AWS date condition operators and the comparison they translate to
+var awsDateOperators = map[string]string{
+	"DateEquals":            "==",
+	"DateNotEquals":         "!=",
+	"DateLessThan":          "<",
+	"DateLessThanEquals":    "<=",
+	"DateGreaterThan":       ">",
+	"DateGreaterThanEquals": ">=",
+}
+
+// awsStringOperators are the AWS string condition operators and the comparison they translate to
+var awsStringOperators = map[string]string{
+	"StringEquals":    "==",
+	"StringNotEquals": "!=",
+}
+
+// awsConditionExpression translates the Condition of a statement to a condition expression. The
+// supported keys are aws:CurrentTime with date operators, and aws:PrincipalTag/<key> and
+// aws:ResourceTag/<key> with StringEquals and StringNotEquals, which read principal attributes and
+// resource tags. As in AWS, the operators and keys must all hold, and a key holds when any of its
+// values matches (every value, for negated operators).
+func awsConditionExpression(condition map[string]map[string]AWSStringList) (string, error) {
+	var clauses []string
+	for _, operator := range slices.Sorted(maps.Keys(condition)) {
+		keys := condition[operator]
+		for _, key := range slices.Sorted(maps.Keys(keys)) {
+			values := keys[key]
+			if len(values) == 0 {
+				return "", fmt.Errorf("condition %s %s: at least one value is required", operator, key)
+			}
+
+			var operand, comparison string
+			quote := strconv.Quote
+			if comparison = awsDateOperators[operator]; comparison != "" {
+				if key != "aws:CurrentTime" {
+					return "", fmt.Errorf("condition %s %s: only aws:CurrentTime is supported with date operators", operator, key)
+				}
+				operand = CondVarRequestTime
+				quote = func(value string) string { return "timestamp(" + strconv.Quote(value) + ")" }
+				for _, value := range values {
+					if _, err := time.Parse(time.RFC3339, value); err != nil {
+						return "", fmt.Errorf("condition %s %s: %q is not an RFC 3339 time", operator, key, value)
+					}
+				}
+			} else if comparison = awsStringOperators[operator]; comparison != "" {
+				if tag, ok := strings.CutPrefix(key, "aws:PrincipalTag/"); ok && tag != "" {
+					operand = CondVarPrincipalAttributes + "[" + strconv.Quote(tag) + "]"
+				} else if tag, ok := strings.CutPrefix(key, "aws:ResourceTag/"); ok && tag != "" {
+					operand = CondVarResourceTags + "[" + strconv.Quote(tag) + "]"
+				} else {
+					return "", fmt.Errorf("condition %s %s: only aws:PrincipalTag/<key> and aws:ResourceTag/<key> are supported with string operators", operator, key)
+				}
+			} else {
+				return "", fmt.Errorf("condition operator %s is not supported", operator)
+			}
+
+			join := " || "
+			if comparison == "!=" {
+				join = " && "
+			}
+			terms := make([]string, len(values))
+			for i, value := range values {
+				terms[i] = fmt.Sprintf("%s %s %s", operand, comparison, quote(value))
+			}
+			clause := strings.Join(terms, join)
+			if len(terms) > 1 {
+				clause = "(" + clause + ")"
+			}
+			clauses = append(clauses, clause)
+		}
+	}
+	return strings.Join(clauses, " && "), nil
+}
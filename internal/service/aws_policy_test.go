@@ -0,0 +1,222 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testAWSPolicyJSON is a policy as written by aws iam get-policy-version
+const testAWSPolicyJSON = `{
+  "PolicyVersion": {
+    "Document": {
+      "Version": "2012-10-17",
+      "Statement": [
+        {
+          "Sid": "ReadObjects",
+          "Effect": "Allow",
+          "Action": ["s3:Get*", "s3:ListBucket"],
+          "Resource": ["arn:aws:s3:::prod-data", "arn:aws:s3:::prod-data/*"]
+        },
+        {
+          "Effect": "Allow",
+          "Action": "s3:PutObject",
+          "Resource": "arn:aws:s3:::prod-data/*",
+          "Condition": {
+            "DateLessThan": {"aws:CurrentTime": "2030-01-01T00:00:00Z"},
+            "StringEquals": {"aws:PrincipalTag/team": ["data", "ml"]}
+          }
+        }
+      ]
+    },
+    "VersionId": "v3",
+    "IsDefaultVersion": true
+  }
+}`
+
+const testAWSPolicyMapping = `actions:
+  s3:GetObject: [storage.objects.get]
+  s3:GetBucketLocation: [storage.buckets.get]
+  s3:ListBucket: [storage.objects.list]
+  s3:PutObject: [storage.objects.create]
+resources:
+  arn:aws:s3:::prod-data: acme/prod-data
+  arn:aws:s3:::prod-data/*: acme/prod-data
+`
+
+func TestParseAWSPolicyDocument(t *testing.T) {
+	document, err := ParseAWSPolicyDocument(strings.NewReader(testAWSPolicyJSON))
+	require.NoError(t, err)
+	assert.Equal(t, "2012-10-17", document.Version)
+	require.Len(t, document.Statement, 2)
+	assert.Equal(t, AWSStringList{"s3:Get*", "s3:ListBucket"}, document.Statement[0].Action)
+	assert.Equal(t, AWSStringList{"s3:PutObject"}, document.Statement[1].Action)
+	assert.Equal(t, AWSStringList{"data", "ml"}, document.Statement[1].Condition["StringEquals"]["aws:PrincipalTag/team"])
+
+	// A bare document with a single statement
+	document, err = ParseAWSPolicyDocument(strings.NewReader(`{"Statement": {"Effect": "Deny", "Action": "*", "Resource": "*",
+		"Condition": {"Bool": {"aws:MultiFactorAuthPresent": false}}}}`))
+	require.NoError(t, err)
+	require.Len(t, document.Statement, 1)
+	assert.Equal(t, "Deny", document.Statement[0].Effect)
+	assert.Equal(t, AWSStringList{"false"}, document.Statement[0].Condition["Bool"]["aws:MultiFactorAuthPresent"])
+
+	_, err = ParseAWSPolicyDocument(strings.NewReader(`{"Statement": [{"Action": {"s3": "GetObject"}}]}`))
+	assert.ErrorContains(t, err, "failed to parse aws policy")
+}
+
+func TestParseAWSPolicyMapping(t *testing.T) {
+	mapping, err := ParseAWSPolicyMapping(strings.NewReader(testAWSPolicyMapping))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.get"}, mapping.Actions["s3:GetObject"])
+	assert.Equal(t, "acme/prod-data", mapping.Resources["arn:aws:s3:::prod-data/*"])
+
+	_, err = ParseAWSPolicyMapping(strings.NewReader("actions:\n  s3:Get*: [storage.objects.get]\n  GetObject: [storage.objects.get]\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `action "GetObject": name must be <service>:<action>`)
+	assert.Contains(t, err.Error(), `action "s3:Get*": mapped actions cannot have wildcards`)
+
+	_, err = ParseAWSPolicyMapping(strings.NewReader("action:\n  s3:GetObject: [storage.objects.get]\n"))
+	assert.ErrorContains(t, err, "failed to parse aws policy mapping")
+}
+
+func TestAWSConditionExpression(t *testing.T) {
+	expression, err := awsConditionExpression(map[string]map[string]AWSStringList{
+		"DateGreaterThan": {"aws:CurrentTime": {"2025-01-01T00:00:00Z"}},
+		"StringEquals":    {"aws:ResourceTag/env": {"prod"}, "aws:PrincipalTag/team": {"data", "ml"}},
+		"StringNotEquals": {"aws:ResourceTag/tier": {"restricted", "secret"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `request.time > timestamp("2025-01-01T00:00:00Z") && `+
+		`(principal.attributes["team"] == "data" || principal.attributes["team"] == "ml") && `+
+		`resource.tags["env"] == "prod" && `+
+		`(resource.tags["tier"] != "restricted" && resource.tags["tier"] != "secret")`, expression)
+
+	_, err = awsConditionExpression(map[string]map[string]AWSStringList{"IpAddress": {"aws:SourceIp": {"10.0.0.0/8"}}})
+	assert.ErrorContains(t, err, "condition operator IpAddress is not supported")
+	_, err = awsConditionExpression(map[string]map[string]AWSStringList{"StringEquals": {"aws:username": {"alice"}}})
+	assert.ErrorContains(t, err, "only aws:PrincipalTag/<key> and aws:ResourceTag/<key> are supported")
+	_, err = awsConditionExpression(map[string]map[string]AWSStringList{"DateLessThan": {"aws:CurrentTime": {"tomorrow"}}})
+	assert.ErrorContains(t, err, "is not an RFC 3339 time")
+}
+
+// newAWSPolicyTestService returns a service with the permissions of testAWSPolicyMapping and the
+// acme/prod-data resource
+func newAWSPolicyTestService() (*IAMService, *MockResourceRepository, *MockBindingRepository, domain.Resource) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+	for _, name := range []string{"storage.objects.get", "storage.buckets.get", "storage.objects.list", "storage.objects.create"} {
+		permissionRepo.On("GetByName", name).Return(&domain.Permission{ID: uuid.New(), Name: name}, nil)
+	}
+	permissionRepo.On("GetByIDs", mock.Anything).Return([]domain.Permission{}, nil)
+
+	acme := domain.Resource{ID: uuid.New(), Type: "organization", Name: "acme"}
+	bucket := domain.Resource{ID: uuid.New(), Type: "bucket", Name: "prod-data", ParentID: &acme.ID}
+	resourceRepo.On("ListByName", (*uuid.UUID)(nil), "acme").Return([]domain.Resource{acme}, nil)
+	resourceRepo.On("ListByName", &acme.ID, "prod-data").Return([]domain.Resource{bucket}, nil)
+	return service, resourceRepo, bindingRepo, bucket
+}
+
+func TestIAMService_ImportAWSPolicy_DryRun(t *testing.T) {
+	service, _, bindingRepo, bucket := newAWSPolicyTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	roleRepo.On("GetByName", "roles/aws.s3-writers.ReadObjects").Return(nil, nil)
+	roleRepo.On("GetByName", "roles/aws.s3-writers.statement2").Return(nil, nil)
+
+	document, err := ParseAWSPolicyDocument(strings.NewReader(testAWSPolicyJSON))
+	require.NoError(t, err)
+	mapping, err := ParseAWSPolicyMapping(strings.NewReader(testAWSPolicyMapping))
+	require.NoError(t, err)
+
+	imported, err := service.DryRun().ImportAWSPolicy("s3-writers", document, mapping, []string{"group:data@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, SeedCounts{Created: 2}, imported.RoleCounts)
+	require.Len(t, imported.Roles, 2)
+	assert.Equal(t, "roles/aws.s3-writers.ReadObjects", imported.Roles[0].Name)
+	assert.Equal(t, []string{"storage.buckets.get", "storage.objects.get", "storage.objects.list"}, imported.Roles[0].Permissions)
+	assert.Equal(t, []string{"storage.objects.create"}, imported.Roles[1].Permissions)
+
+	// Both resources of the first statement map to the bucket, which is granted once
+	require.Len(t, imported.Bindings, 2)
+	assert.Equal(t, bucket.ID, imported.Bindings[0].ResourceID)
+	assert.Nil(t, imported.Bindings[0].Condition)
+	assert.Equal(t, "statement2", imported.Bindings[1].Statement)
+	require.NotNil(t, imported.Bindings[1].Condition)
+	assert.Equal(t, `request.time < timestamp("2030-01-01T00:00:00Z") && `+
+		`(principal.attributes["team"] == "data" || principal.attributes["team"] == "ml")`, imported.Bindings[1].Condition.Expression)
+	bindingRepo.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+}
+
+func TestIAMService_ImportAWSPolicy_ReportsEveryProblem(t *testing.T) {
+	service, _, _, _ := newAWSPolicyTestService()
+	mapping, err := ParseAWSPolicyMapping(strings.NewReader(testAWSPolicyMapping))
+	require.NoError(t, err)
+
+	document, err := ParseAWSPolicyDocument(strings.NewReader(`{"Version": "2012-10-17", "Statement": [
+		{"Effect": "Deny", "Action": "s3:DeleteObject", "Resource": "*"},
+		{"Effect": "Allow", "NotAction": "iam:*", "Resource": "*"},
+		{"Effect": "Allow", "Action": ["s3:GetObject", "ec2:*"], "Resource": ["arn:aws:s3:::prod-data", "arn:aws:s3:::logs"],
+		 "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}
+	]}`))
+	require.NoError(t, err)
+
+	_, err = service.DryRun().ImportAWSPolicy("s3-readers", document, mapping, []string{"alice"})
+	require.Error(t, err)
+	for _, problem := range []string{
+		`invalid principal "alice"`,
+		"Statement[0]: Deny statements are not supported",
+		"Statement[1]: NotAction is not supported",
+		"Statement[1]: Action is required",
+		`Statement[2]: action "ec2:*" has no mapping`,
+		"Statement[2]: condition operator IpAddress is not supported",
+		`Statement[2]: resource "arn:aws:s3:::logs" has no mapping`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestIAMService_ImportAWSPolicy(t *testing.T) {
+	service, resourceRepo, bindingRepo, bucket := newAWSPolicyTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	// The role of the statement is created, then found to bind it
+	role := &domain.Role{ID: uuid.New(), Name: "roles/aws.s3-readers.ReadObjects", IsCustom: true}
+	roleRepo.On("GetByName", role.Name).Return(nil, nil).Once()
+	roleRepo.On("Create", mock.Anything).Return(nil).Once()
+	roleRepo.On("GetByName", role.Name).Return(role, nil)
+	roleRepo.On("GetByID", role.ID).Return(role, nil)
+
+	resourceRepo.On("GetByID", bucket.ID).Return(&bucket, nil)
+	resourceRepo.On("GetAncestors", bucket.ID).Return([]domain.Resource{}, nil)
+	policyID := uuid.New()
+	policyRepo.On("GetByResourceID", bucket.ID).Return(nil, nil)
+	policyRepo.On("Create", mock.Anything).Run(func(args mock.Arguments) { args.Get(0).(*domain.Policy).ID = policyID }).Return(nil)
+	bindingRepo.On("CreateBatch", mock.Anything, mock.MatchedBy(func(bindings []domain.Binding) bool {
+		return len(bindings) == 1 && bindings[0].RoleID == role.ID && string(bindings[0].Members) == `["group:sre@example.com"]`
+	})).Return(nil).Once()
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: bucket.ID}, nil)
+	revisionRepo.On("Create", mock.Anything).Return(nil)
+
+	mapping, err := ParseAWSPolicyMapping(strings.NewReader(testAWSPolicyMapping))
+	require.NoError(t, err)
+	document := &AWSPolicyDocument{Statement: []AWSStatement{{
+		Sid:      "ReadObjects",
+		Effect:   "Allow",
+		Action:   AWSStringList{"s3:getobject"},
+		Resource: AWSStringList{"arn:aws:s3:::prod-data/*"},
+	}}}
+
+	imported, err := service.ImportAWSPolicy("s3-readers", document, mapping, []string{"group:sre@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, SeedCounts{Created: 1}, imported.RoleCounts)
+	assert.Equal(t, []string{"storage.objects.get"}, imported.Roles[0].Permissions)
+	roleRepo.AssertExpectations(t)
+	bindingRepo.AssertExpectations(t)
+}
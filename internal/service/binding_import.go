@@ -0,0 +1,329 @@
+package service
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// DefaultBindingImportBatchSize is the number of rows of a resource ImportBindingsCSV grants in
+// one transaction when no batch size is given
+const DefaultBindingImportBatchSize = 500
+
+// BindingImportRow is a row of a bindings CSV file, granting Role to Member on a resource
+type BindingImportRow struct {
+	Line         int    // Line of the row in the file, from 1
+	ResourcePath string // Names of the root and the resources down to the resource, e.g. "acme/web/prod-data"
+	Role         string // Role name
+	Member       string
+}
+
+// BindingImportError is a row ImportBindingsCSV did not import, and why
+type BindingImportError struct {
+	BindingImportRow
+	Error string
+}
+
+// BindingImportReport summarizes an ImportBindingsCSV run
+type BindingImportReport struct {
+	Rows      int                  // Rows read, the header excluded
+	Imported  int                  // Rows granted, or that would be with DryRun
+	Unchanged int                  // Rows already granted, by the policy or an earlier row
+	Errors    []BindingImportError // Rows not imported, in file order
+}
+
+// BindingImportOptions tune ImportBindingsCSV
+type BindingImportOptions struct {
+	BatchSize int  // Rows of a resource granted in one transaction; DefaultBindingImportBatchSize if zero
+	DryRun    bool // Validate every row without granting any
+}
+
+// bindingImportHeader is the optional first row of a bindings CSV file
+var bindingImportHeader = []string{"resource", "role", "member"}
+
+// pendingImport is a resolved row waiting to be granted
+type pendingImport struct {
+	row    BindingImportRow
+	roleID uuid.UUID
+}
+
+// ImportBindingsCSV grants the rows of a CSV file of resource path, role name and member, e.g.
+//
+//	resource,role,member
+//	acme/web,roles/viewer,user:alice@example.com
+//	acme/web/prod-data,roles/storage.admin,group:sre@example.com
+//
+// as when migrating from a legacy system. The header row is optional. Resource paths name the
+// resources from a root, so resources whose name contains "/" cannot be addressed. Every row is
+// resolved and validated on its own; the rows of each resource are then granted, unconditionally,
+// BatchSize at a time with BatchCreateBindings, each batch in one transaction. When a batch is
+// rejected, the rows at fault are reported and the others retried once. Rows that fail are
+// listed in the report; the others are imported, so fixing the failed rows and importing the
+// whole file again only grants them.
+//
+// An error is returned when the file cannot be read as CSV, not for invalid rows.
+func (s *IAMService) ImportBindingsCSV(r io.Reader, opts BindingImportOptions) (*BindingImportReport, error) {
+	rows, report, err := parseBindingsCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBindingImportBatchSize
+	}
+	fail := func(row BindingImportRow, err error) {
+		report.Errors = append(report.Errors, BindingImportError{BindingImportRow: row, Error: err.Error()})
+	}
+
+	resolver := &resourcePathResolver{s: s, resolved: make(map[string]resolvedPath)}
+	roleIDs := make(map[string]uuid.UUID)
+	var resources []uuid.UUID
+	byResource := make(map[uuid.UUID][]pendingImport)
+	for _, row := range rows {
+		if _, err := domain.ParseMember(row.Member); err != nil {
+			fail(row, err)
+			continue
+		}
+		resourceID, err := resolver.resolve(row.ResourcePath)
+		if err != nil {
+			fail(row, err)
+			continue
+		}
+		roleID, ok := roleIDs[row.Role]
+		if !ok {
+			role, err := s.roleRepo.GetByName(row.Role)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get role %q: %w", row.Role, err)
+			}
+			if role == nil {
+				fail(row, fmt.Errorf("role %q not found", row.Role))
+				continue
+			}
+			roleID = role.ID
+			roleIDs[row.Role] = roleID
+		}
+
+		if _, ok := byResource[resourceID]; !ok {
+			resources = append(resources, resourceID)
+		}
+		byResource[resourceID] = append(byResource[resourceID], pendingImport{row: row, roleID: roleID})
+	}
+
+	for _, resourceID := range resources {
+		if err := s.authorize("ImportBindingsCSV", &resourceID); err != nil {
+			for _, pending := range byResource[resourceID] {
+				fail(pending.row, err)
+			}
+			continue
+		}
+		policy, err := s.policyRepo.GetByResourceID(resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy: %w", err)
+		}
+
+		// Rows already granted unconditionally, by the policy or an earlier row, are unchanged
+		granted := make(map[string]bool)
+		if policy != nil {
+			for _, binding := range policy.Bindings {
+				members, err := binding.GetMembers()
+				if binding.Condition != nil || err != nil {
+					continue
+				}
+				for _, member := range members {
+					granted[binding.RoleID.String()+" "+member] = true
+				}
+			}
+		}
+		var batch []pendingImport
+		for _, pending := range byResource[resourceID] {
+			key := pending.roleID.String() + " " + pending.row.Member
+			if granted[key] {
+				report.Unchanged++
+				continue
+			}
+			granted[key] = true
+			batch = append(batch, pending)
+		}
+
+		for chunk := range slices.Chunk(batch, batchSize) {
+			s.importBindingBatch(resourceID, chunk, opts.DryRun, report, fail)
+		}
+	}
+
+	slices.SortStableFunc(report.Errors, func(a, b BindingImportError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return report, nil
+}
+
+// importBindingBatch grants the rows of batch on a resource in one transaction. When the batch
+// is rejected, each row is validated alone, and the rows that pass are retried once without the
+// others.
+func (s *IAMService) importBindingBatch(
+	resourceID uuid.UUID,
+	batch []pendingImport,
+	dryRun bool,
+	report *BindingImportReport,
+	fail func(BindingImportRow, error),
+) {
+	target := s
+	if dryRun {
+		target = s.DryRun()
+	}
+	_, err := target.BatchCreateBindings(resourceID, importBindings(batch))
+	if err == nil {
+		report.Imported += len(batch)
+		return
+	}
+	if len(batch) == 1 {
+		fail(batch[0].row, err)
+		return
+	}
+
+	valid := make([]pendingImport, 0, len(batch))
+	for _, pending := range batch {
+		if _, rowErr := s.DryRun().BatchCreateBindings(resourceID, importBindings([]pendingImport{pending})); rowErr != nil {
+			fail(pending.row, rowErr)
+			continue
+		}
+		valid = append(valid, pending)
+	}
+	if len(valid) == 0 {
+		return
+	}
+	if len(valid) < len(batch) {
+		if _, err = target.BatchCreateBindings(resourceID, importBindings(valid)); err == nil {
+			report.Imported += len(valid)
+			return
+		}
+	}
+	// Every row is valid alone, e.g. the batch exceeds the bindings limit of the policy
+	for _, pending := range valid {
+		fail(pending.row, err)
+	}
+}
+
+// importBindings groups the members of rows into one unconditional binding per role
+func importBindings(rows []pendingImport) []domain.Binding {
+	var roles []uuid.UUID
+	members := make(map[uuid.UUID][]string)
+	for _, pending := range rows {
+		if _, ok := members[pending.roleID]; !ok {
+			roles = append(roles, pending.roleID)
+		}
+		members[pending.roleID] = append(members[pending.roleID], pending.row.Member)
+	}
+
+	bindings := make([]domain.Binding, len(roles))
+	for i, roleID := range roles {
+		encoded, _ := json.Marshal(members[roleID])
+		bindings[i] = domain.Binding{RoleID: roleID, Members: encoded}
+	}
+	return bindings
+}
+
+// parseBindingsCSV reads the rows of a bindings CSV file. Blank lines are skipped; rows without
+// exactly three non-empty fields are reported in the returned report instead of returned.
+func parseBindingsCSV(r io.Reader) ([]BindingImportRow, *BindingImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	report := &BindingImportReport{}
+	var rows []BindingImportRow
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read bindings csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if first && slices.EqualFunc(record, bindingImportHeader, strings.EqualFold) {
+			continue
+		}
+
+		report.Rows++
+		row := BindingImportRow{Line: line}
+		if len(record) != 3 {
+			report.Errors = append(report.Errors, BindingImportError{
+				BindingImportRow: row,
+				Error:            fmt.Sprintf("expected 3 fields (resource, role, member), got %d", len(record)),
+			})
+			continue
+		}
+		row.ResourcePath, row.Role, row.Member = record[0], record[1], record[2]
+		if row.ResourcePath == "" || row.Role == "" || row.Member == "" {
+			report.Errors = append(report.Errors, BindingImportError{
+				BindingImportRow: row,
+				Error:            "resource, role and member are required",
+			})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, report, nil
+}
+
+// resolvedPath is the resource a path names, or why it names none
+type resolvedPath struct {
+	id  uuid.UUID
+	err error
+}
+
+// resourcePathResolver resolves the resource paths of an import, each prefix once
+type resourcePathResolver struct {
+	s        *IAMService
+	resolved map[string]resolvedPath
+}
+
+// resolve returns the ID of the resource a path of names from a root names
+func (r *resourcePathResolver) resolve(path string) (uuid.UUID, error) {
+	path = strings.Trim(path, "/")
+	if resolved, ok := r.resolved[path]; ok {
+		return resolved.id, resolved.err
+	}
+
+	var parentID *uuid.UUID
+	name := path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		name = path[i+1:]
+		id, err := r.resolve(path[:i])
+		if err != nil {
+			return uuid.Nil, err
+		}
+		parentID = &id
+	}
+	resolved := r.lookup(path, parentID, name)
+	r.resolved[path] = resolved
+	return resolved.id, resolved.err
+}
+
+// lookup finds the resource named name under parentID, the roots when it is nil
+func (r *resourcePathResolver) lookup(path string, parentID *uuid.UUID, name string) resolvedPath {
+	if name == "" {
+		return resolvedPath{err: fmt.Errorf("invalid resource path %q: empty name", path)}
+	}
+	resources, err := r.s.resourceRepo.ListByName(parentID, name)
+	switch {
+	case err != nil:
+		return resolvedPath{err: fmt.Errorf("failed to resolve resource path %q: %w", path, err)}
+	case len(resources) == 0:
+		return resolvedPath{err: fmt.Errorf("resource path %q not found", path)}
+	case len(resources) > 1:
+		return resolvedPath{err: fmt.Errorf("resource path %q is ambiguous: %d resources are named %q", path, len(resources), name)}
+	}
+	return resolvedPath{id: resources[0].ID}
+}
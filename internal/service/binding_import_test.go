@@ -0,0 +1,115 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testBindingsCSV = `resource,role,member
+acme/web,roles/viewer,user:alice@example.com
+acme/web,roles/viewer,user:bob@example.com
+acme/web/,roles/viewer, user:alice@example.com
+acme/ghost,roles/viewer,user:carol@example.com
+acme/web,roles/nope,user:carol@example.com
+acme/web,roles/viewer,alice
+
+dup,roles/viewer,user:dan@example.com
+acme/web,roles/viewer
+`
+
+func TestIAMService_ImportBindingsCSV(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	acme := domain.Resource{ID: uuid.New(), Type: "organization", Name: "acme"}
+	web := domain.Resource{ID: uuid.New(), Type: "project", Name: "web", ParentID: &acme.ID}
+	resourceRepo.On("ListByName", (*uuid.UUID)(nil), "acme").Return([]domain.Resource{acme}, nil).Once()
+	resourceRepo.On("ListByName", &acme.ID, "web").Return([]domain.Resource{web}, nil).Once()
+	resourceRepo.On("ListByName", &acme.ID, "ghost").Return([]domain.Resource{}, nil).Once()
+	resourceRepo.On("ListByName", (*uuid.UUID)(nil), "dup").Return([]domain.Resource{{ID: uuid.New()}, {ID: uuid.New()}}, nil).Once()
+
+	viewer := &domain.Role{ID: uuid.New(), Name: "roles/viewer"}
+	roleRepo.On("GetByName", "roles/viewer").Return(viewer, nil).Once()
+	roleRepo.On("GetByName", "roles/nope").Return(nil, nil).Once()
+	roleRepo.On("GetByID", viewer.ID).Return(viewer, nil)
+
+	policyRepo.On("GetByResourceID", web.ID).Return(&domain.Policy{ID: uuid.New(), ResourceID: web.ID, Bindings: []domain.Binding{
+		{ID: uuid.New(), RoleID: viewer.ID, Members: toJSON([]string{"user:bob@example.com"})},
+	}}, nil)
+
+	report, err := service.ImportBindingsCSV(strings.NewReader(testBindingsCSV), BindingImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 8, report.Rows)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 2, report.Unchanged)
+
+	lines := make([]int, len(report.Errors))
+	for i, failed := range report.Errors {
+		lines[i] = failed.Line
+	}
+	assert.Equal(t, []int{5, 6, 7, 9, 10}, lines)
+	assert.Contains(t, report.Errors[0].Error, `resource path "acme/ghost" not found`)
+	assert.Contains(t, report.Errors[1].Error, `role "roles/nope" not found`)
+	assert.Equal(t, "alice", report.Errors[2].Member)
+	assert.Contains(t, report.Errors[3].Error, "ambiguous")
+	assert.Contains(t, report.Errors[4].Error, "expected 3 fields")
+
+	resourceRepo.AssertExpectations(t)
+	service.bindingRepo.(*MockBindingRepository).AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+}
+
+func TestIAMService_ImportBindingsCSV_IsolatesRejectedRows(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	acme := domain.Resource{ID: uuid.New(), Type: "organization", Name: "acme"}
+	resourceRepo.On("ListByName", (*uuid.UUID)(nil), "acme").Return([]domain.Resource{acme}, nil)
+	resourceRepo.On("GetByID", acme.ID).Return(&acme, nil)
+	resourceRepo.On("GetAncestors", acme.ID).Return([]domain.Resource{}, nil)
+
+	// The role is scoped to another subtree, so granting it on acme is rejected
+	other := uuid.New()
+	viewer := &domain.Role{ID: uuid.New(), Name: "roles/viewer"}
+	scoped := &domain.Role{ID: uuid.New(), Name: "roles/scoped", IsCustom: true, ScopeResourceID: &other}
+	for _, role := range []*domain.Role{viewer, scoped} {
+		roleRepo.On("GetByName", role.Name).Return(role, nil)
+		roleRepo.On("GetByID", role.ID).Return(role, nil)
+	}
+
+	policyID := uuid.New()
+	policyRepo.On("GetByResourceID", acme.ID).Return(nil, nil)
+	policyRepo.On("Create", mock.Anything).Run(func(args mock.Arguments) { args.Get(0).(*domain.Policy).ID = policyID }).Return(nil)
+	bindingRepo.On("CreateBatch", mock.Anything, mock.MatchedBy(func(bindings []domain.Binding) bool {
+		return len(bindings) == 1 && bindings[0].RoleID == viewer.ID &&
+			string(bindings[0].Members) == `["user:alice@example.com","user:bob@example.com"]`
+	})).Return(nil).Once()
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: acme.ID}, nil)
+	revisionRepo.On("Create", mock.Anything).Return(nil)
+
+	report, err := service.ImportBindingsCSV(strings.NewReader(`acme,roles/viewer,user:alice@example.com
+acme,roles/scoped,user:carol@example.com
+acme,roles/viewer,user:bob@example.com
+`), BindingImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Rows)
+	assert.Equal(t, 2, report.Imported)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 2, report.Errors[0].Line)
+	assert.Contains(t, report.Errors[0].Error, "scoped to resource")
+	bindingRepo.AssertExpectations(t)
+}
+
+func TestIAMService_ImportBindingsCSV_MalformedFile(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	_, err := service.ImportBindingsCSV(strings.NewReader("acme,\"roles/viewer,user:alice@example.com\n"), BindingImportOptions{})
+	assert.ErrorContains(t, err, "failed to read bindings csv")
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_SearchBindings(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+
+	resourceID := uuid.New()
+	found := []domain.Binding{{ID: uuid.New(), Members: toJSON([]string{"user:alice@example.com"})}}
+	bindingRepo.On("Search", repository.BindingSearch{Member: "@example.com", ResourceID: resourceID}, 50, 100).
+		Return(found, int64(101), nil)
+
+	bindings, total, err := service.SearchBindings(repository.BindingSearch{Member: " @example.com ", ResourceID: resourceID}, 50, 100)
+	require.NoError(t, err)
+	assert.Equal(t, found, bindings)
+	assert.Equal(t, int64(101), total)
+}
+
+func TestIAMService_SearchBindings_Validation(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+
+	_, _, err := service.SearchBindings(repository.BindingSearch{Member: "  "}, 10, 0)
+	assert.ErrorContains(t, err, "at least one of")
+
+	_, _, err = service.SearchBindings(repository.BindingSearch{Role: "roles/viewer"}, -1, 0)
+	assert.ErrorContains(t, err, "must not be negative")
+
+	bindingRepo.AssertNotCalled(t, "Search")
+
+	bindingRepo.On("Search", repository.BindingSearch{Condition: "request.time"}, 10, 0).
+		Return(nil, int64(0), errors.New("connection refused"))
+	_, _, err = service.SearchBindings(repository.BindingSearch{Condition: "request.time"}, 10, 0)
+	assert.ErrorContains(t, err, "failed to search bindings")
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrCacheNotInspectable is returned by the cache admin methods when the configured cache keeps
+// no entries (cache.type "none") or cannot list them
+var ErrCacheNotInspectable = errors.New("cache does not support inspection")
+
+// CacheInspector is implemented by caches whose entries can be counted, read and flushed
+type CacheInspector interface {
+	// Stats counts the current entries and the lookups served
+	Stats() (CacheStats, error)
+	// Lookup returns the entry of key, or nil when it is absent or expired
+	Lookup(key string) (*CacheEntry, error)
+	// DeleteMatching deletes the entries whose key matches and returns how many it deleted
+	DeleteMatching(match CacheKeyMatch) (int64, error)
+}
+
+// CacheStats describes the entries of a cache and how well it serves lookups
+type CacheStats struct {
+	Entries  int64
+	Hits     int64
+	Misses   int64
+	HitRate  float64          // Hits / (Hits + Misses); 0 before the first lookup
+	Prefixes map[string]int64 // Entries per key prefix, the part of the key up to its first ':'
+}
+
+func newCacheStats(hits, misses int64) CacheStats {
+	stats := CacheStats{Hits: hits, Misses: misses, Prefixes: make(map[string]int64)}
+	if hits+misses > 0 {
+		stats.HitRate = float64(hits) / float64(hits+misses)
+	}
+	return stats
+}
+
+// add counts an entry of key
+func (s *CacheStats) add(key string) {
+	prefix, _, _ := strings.Cut(key, ":")
+	s.Entries++
+	s.Prefixes[prefix]++
+}
+
+// CacheEntry is a cached value with its expiration, which is zero when the entry does not expire
+type CacheEntry struct {
+	Key       string
+	Value     interface{}
+	ExpiresAt time.Time
+}
+
+// CacheKeyMatch selects the cache keys starting with Prefix that, when Contains is set, contain
+// Contains after the prefix
+type CacheKeyMatch struct {
+	Prefix   string
+	Contains string
+}
+
+// Matches reports whether key is selected
+func (m CacheKeyMatch) Matches(key string) bool {
+	rest, ok := strings.CutPrefix(key, m.Prefix)
+	return ok && strings.Contains(rest, m.Contains)
+}
+
+// CacheFlushRequest selects the entries FlushCache deletes; exactly one field must be set
+type CacheFlushRequest struct {
+	Prefix     string     // Entries whose key starts with Prefix, e.g. "perm:" for every decision
+	ResourceID *uuid.UUID // Decisions on the resource; decisions on its descendants are kept
+	Principal  string     // Decisions for the principal, e.g. "user:alice@example.com"
+}
+
+// cacheKeyMatch returns the keys selected by the request
+func (r CacheFlushRequest) cacheKeyMatch() (CacheKeyMatch, error) {
+	set := 0
+	for _, isSet := range []bool{r.Prefix != "", r.ResourceID != nil, r.Principal != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return CacheKeyMatch{}, fmt.Errorf("exactly one of prefix, resource_id and principal is required")
+	}
+
+	switch {
+	case r.ResourceID != nil:
+		// Keys are perm:<principal>:<resource>:<permission>, see GenerateCacheKey
+		return CacheKeyMatch{Prefix: "perm:", Contains: ":" + r.ResourceID.String() + ":"}, nil
+	case r.Principal != "":
+		return CacheKeyMatch{Prefix: "perm:" + r.Principal + ":"}, nil
+	default:
+		return CacheKeyMatch{Prefix: r.Prefix}, nil
+	}
+}
+
+// inspectableCache returns the cache as a CacheInspector
+func (s *IAMService) inspectableCache() (CacheInspector, error) {
+	inspector, ok := s.cache.(CacheInspector)
+	if !ok {
+		return nil, ErrCacheNotInspectable
+	}
+	return inspector, nil
+}
+
+// GetCacheStats counts the entries of the cache, per key prefix, and its hit rate. With the redis
+// cache, entries are counted across replicas but hits and misses only for this replica.
+func (s *IAMService) GetCacheStats() (*CacheStats, error) {
+	if err := s.authorize("GetCacheStats", nil); err != nil {
+		return nil, err
+	}
+	inspector, err := s.inspectableCache()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := inspector.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// LookupCacheEntry returns the cache entry of key, or nil when there is none
+func (s *IAMService) LookupCacheEntry(key string) (*CacheEntry, error) {
+	if err := s.authorize("LookupCacheEntry", nil); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	inspector, err := s.inspectableCache()
+	if err != nil {
+		return nil, err
+	}
+	return inspector.Lookup(key)
+}
+
+// FlushCache deletes the cache entries selected by req, e.g. bad decisions for a principal,
+// and returns how many it deleted
+func (s *IAMService) FlushCache(req CacheFlushRequest) (int64, error) {
+	if err := s.authorize("FlushCache", req.ResourceID); err != nil {
+		return 0, err
+	}
+	match, err := req.cacheKeyMatch()
+	if err != nil {
+		return 0, err
+	}
+	inspector, err := s.inspectableCache()
+	if err != nil {
+		return 0, err
+	}
+	return inspector.DeleteMatching(match)
+}
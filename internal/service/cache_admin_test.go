@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheKeyMatch(t *testing.T) {
+	match := CacheKeyMatch{Prefix: "perm:", Contains: ":r1:"}
+	assert.True(t, match.Matches("perm:user:alice@example.com:r1:storage.buckets.get"))
+	assert.False(t, match.Matches("perm:user:alice@example.com:r2:storage.buckets.get"))
+	assert.False(t, match.Matches("other:user:alice@example.com:r1:storage.buckets.get"))
+	assert.True(t, CacheKeyMatch{}.Matches("anything"))
+}
+
+func TestIAMService_CacheAdmin(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.GetCacheStats()
+	assert.ErrorIs(t, err, ErrCacheNotInspectable)
+	_, err = service.FlushCache(CacheFlushRequest{Prefix: "perm:"})
+	assert.ErrorIs(t, err, ErrCacheNotInspectable)
+
+	service.cache = NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 300, MaxSize: 100, CleanupMinutes: 10})
+	bucket, project := uuid.New(), uuid.New()
+	aliceBucket := GenerateCacheKey("user:alice@example.com", bucket.String(), "storage.buckets.get")
+	service.cache.Set(aliceBucket, "roles/viewer")
+	service.cache.Set(GenerateCacheKey("user:alice@example.com", project.String(), "storage.buckets.get"), "roles/viewer")
+	service.cache.Set(GenerateCacheKey("user:bob@example.com", bucket.String(), "storage.buckets.get"), "roles/viewer")
+	service.cache.Set(GenerateCacheKey("user:alice@example.com.evil", project.String(), "storage.buckets.get"), "roles/viewer")
+	service.cache.Set("other:key", 1)
+	service.cache.Get(aliceBucket)
+	service.cache.Get("missing")
+
+	stats, err := service.GetCacheStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.Entries)
+	assert.Equal(t, map[string]int64{"perm": 4, "other": 1}, stats.Prefixes)
+	assert.Equal(t, 0.5, stats.HitRate)
+
+	entry, err := service.LookupCacheEntry(aliceBucket)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "roles/viewer", entry.Value)
+	assert.WithinDuration(t, time.Now().Add(300*time.Second), entry.ExpiresAt, time.Minute)
+	entry, err = service.LookupCacheEntry("missing")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+
+	_, err = service.FlushCache(CacheFlushRequest{})
+	assert.ErrorContains(t, err, "exactly one of")
+	_, err = service.FlushCache(CacheFlushRequest{Prefix: "perm:", Principal: "user:bob@example.com"})
+	assert.ErrorContains(t, err, "exactly one of")
+
+	deleted, err := service.FlushCache(CacheFlushRequest{ResourceID: &bucket})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	deleted, err = service.FlushCache(CacheFlushRequest{Principal: "user:alice@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "principals sharing a prefix are kept")
+
+	deleted, err = service.FlushCache(CacheFlushRequest{Prefix: "other:"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	stats, err = service.GetCacheStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Entries)
+}
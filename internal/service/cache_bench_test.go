@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+// benchCacheKeys returns n permission cache keys spread over principals and resources
+func benchCacheKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = GenerateCacheKey(fmt.Sprintf("user:%d@example.com", i%500), uuid.NewString(), "storage.objects.read")
+	}
+	return keys
+}
+
+// benchmarkMemoryCache runs parallel permission-check traffic in which one operation in
+// writeEvery is a Set (none when 0) and the others are Gets, against caches with each shard count.
+// A single shard behaves like the former cache with one lock over one map.
+func benchmarkMemoryCache(b *testing.B, writeEvery int) {
+	keys := benchCacheKeys(8192)
+
+	for _, shards := range []int{1, 8, 32, 128} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			cache := NewCacheService(&config.CacheConfig{
+				Enabled:        true,
+				TTLSeconds:     300,
+				MaxSize:        len(keys) * 2,
+				CleanupMinutes: 10,
+				Shards:         shards,
+			})
+			for _, key := range keys {
+				cache.Set(key, true)
+			}
+
+			var worker atomic.Int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(worker.Add(1)) * 7919
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if writeEvery > 0 && i%writeEvery == 0 {
+						cache.Set(key, true)
+					} else {
+						cache.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemoryCache_Read measures a read-only workload, as when hot decisions are cached
+func BenchmarkMemoryCache_Read(b *testing.B) {
+	benchmarkMemoryCache(b, 0)
+}
+
+// BenchmarkMemoryCache_Mixed measures checks where one in ten misses and caches its decision
+func BenchmarkMemoryCache_Mixed(b *testing.B) {
+	benchmarkMemoryCache(b, 10)
+}
+
+// BenchmarkMemoryCache_WriteHeavy measures a cold cache where every other check is a miss
+func BenchmarkMemoryCache_WriteHeavy(b *testing.B) {
+	benchmarkMemoryCache(b, 2)
+}
@@ -4,59 +4,116 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/tlsconfig"
 	"github.com/redis/go-redis/v9"
 )
 
 // redisCache is a distributed cache implementation using Redis
 // Use this for stateless deployments with multiple replicas
 type redisCache struct {
-	client *redis.Client
-	ttl    time.Duration
+	client redis.UniversalClient
+	prefix string       // Prepended to every key
+	ttl    atomic.Int64 // time.Duration
 	ctx    context.Context
+	hits   atomic.Int64 // Lookups of this replica only
+	misses atomic.Int64
 }
 
 // NewRedisCache creates a new Redis-backed cache service
 // This ensures cache consistency across multiple service instances
 func NewRedisCache(cfg *config.RedisCacheConfig) (CacheService, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.Address,
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx := context.Background()
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	return &redisCache{
+	cache := &redisCache{
 		client: client,
-		ttl:    time.Duration(cfg.TTLSeconds) * time.Second,
+		prefix: cfg.KeyPrefix,
 		ctx:    ctx,
-	}, nil
+	}
+	cache.SetTTL(time.Duration(cfg.TTLSeconds) * time.Second)
+	return cache, nil
+}
+
+// newRedisClient creates the client of cfg.Mode: a single server, a cluster, or the master
+// monitored by sentinels
+func newRedisClient(cfg *config.RedisCacheConfig) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addresses,
+		MasterName:       cfg.MasterName,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		PoolTimeout:      seconds(cfg.PoolTimeoutSeconds),
+		ConnMaxIdleTime:  seconds(cfg.ConnMaxIdleTimeSeconds),
+		ConnMaxLifetime:  seconds(cfg.ConnMaxLifetimeSeconds),
+		DialTimeout:      seconds(cfg.DialTimeoutSeconds),
+		ReadTimeout:      seconds(cfg.ReadTimeoutSeconds),
+		WriteTimeout:     seconds(cfg.ReadTimeoutSeconds),
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := tlsconfig.Client(&cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis tls configuration: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch strings.ToLower(cfg.Mode) {
+	case "cluster":
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case "sentinel":
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case "standalone", "":
+		opts.Addrs = []string{cfg.Address}
+		return redis.NewClient(opts.Simple()), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s (valid: standalone, cluster, sentinel)", cfg.Mode)
+	}
+}
+
+// seconds converts a number of seconds from the configuration; 0 keeps the client default
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
 }
 
 func (c *redisCache) Get(key string) (interface{}, bool) {
-	val, err := c.client.Get(c.ctx, key).Result()
+	val, err := c.client.Get(c.ctx, c.prefix+key).Result()
 	if err == redis.Nil {
+		c.misses.Add(1)
 		return nil, false
 	}
 	if err != nil {
 		// Log error but don't fail - just cache miss
+		c.misses.Add(1)
 		return nil, false
 	}
 
 	// Deserialize the value
-	var result bool
+	var result interface{}
 	if err := json.Unmarshal([]byte(val), &result); err != nil {
+		c.misses.Add(1)
 		return nil, false
 	}
 
+	c.hits.Add(1)
 	return result, true
 }
 
@@ -69,22 +126,105 @@ func (c *redisCache) Set(key string, value interface{}) {
 	}
 
 	// Set with TTL
-	c.client.Set(c.ctx, key, data, c.ttl)
+	c.client.Set(c.ctx, c.prefix+key, data, time.Duration(c.ttl.Load()))
+}
+
+// SetTTL changes the TTL of entries set from now on
+func (c *redisCache) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
 }
 
 func (c *redisCache) Delete(key string) {
-	c.client.Del(c.ctx, key)
+	c.client.Del(c.ctx, c.prefix+key)
 }
 
+// Clear deletes the permission entries under the key prefix
 func (c *redisCache) Clear() {
-	// Clear all keys with our prefix (be careful in production!)
-	// In production, you might want to use a specific key pattern
-	iter := c.client.Scan(c.ctx, 0, "perm:*", 0).Iterator()
-	for iter.Next(c.ctx) {
-		c.client.Del(c.ctx, iter.Val())
+	c.DeleteMatching(CacheKeyMatch{Prefix: "perm:"})
+}
+
+// scan calls fn with the keys matching pattern. In a cluster every master is scanned, since each
+// holds part of the keyspace.
+func (c *redisCache) scan(pattern string, fn func(ctx context.Context, client *redis.Client, key string)) error {
+	scan := func(ctx context.Context, client *redis.Client) error {
+		iter := client.Scan(ctx, 0, pattern, 0).Iterator()
+		for iter.Next(ctx) {
+			fn(ctx, client, iter.Val())
+		}
+		return iter.Err()
+	}
+
+	switch client := c.client.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachMaster(c.ctx, scan)
+	case *redis.Client:
+		return scan(c.ctx, client)
+	}
+	return nil
+}
+
+// Stats counts the entries under the key prefix with a scan of the keyspace. Hits and misses
+// are those of this replica since it started.
+func (c *redisCache) Stats() (CacheStats, error) {
+	var mu sync.Mutex
+	stats := newCacheStats(c.hits.Load(), c.misses.Load())
+	err := c.scan(redisGlobEscaper.Replace(c.prefix)+"*", func(_ context.Context, _ *redis.Client, key string) {
+		mu.Lock()
+		stats.add(strings.TrimPrefix(key, c.prefix))
+		mu.Unlock()
+	})
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to scan redis cache: %w", err)
+	}
+	return stats, nil
+}
+
+// Lookup returns the entry of key without counting a hit or miss
+func (c *redisCache) Lookup(key string) (*CacheEntry, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(c.ctx, c.prefix+key)
+	ttl := pipe.PTTL(c.ctx, c.prefix+key)
+	if _, err := pipe.Exec(c.ctx); err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read redis cache: %w", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(get.Val()), &value); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %q: %w", key, err)
+	}
+	entry := &CacheEntry{Key: key, Value: value}
+	if ttl.Val() > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl.Val())
 	}
+	return entry, nil
 }
 
+// DeleteMatching deletes the entries whose key matches
+func (c *redisCache) DeleteMatching(match CacheKeyMatch) (int64, error) {
+	var deleted atomic.Int64
+	err := c.scan(redisMatchPattern(c.prefix, match), func(ctx context.Context, client *redis.Client, key string) {
+		deleted.Add(client.Del(ctx, key).Val())
+	})
+	if err != nil {
+		return deleted.Load(), fmt.Errorf("failed to flush redis cache: %w", err)
+	}
+	return deleted.Load(), nil
+}
+
+// redisMatchPattern returns the SCAN MATCH pattern of the keys under prefix matching match
+func redisMatchPattern(prefix string, match CacheKeyMatch) string {
+	pattern := redisGlobEscaper.Replace(prefix+match.Prefix) + "*"
+	if match.Contains != "" {
+		pattern += redisGlobEscaper.Replace(match.Contains) + "*"
+	}
+	return pattern
+}
+
+// redisGlobEscaper escapes the characters SCAN MATCH patterns treat specially
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // Close closes the Redis connection
 func (c *redisCache) Close() error {
 	return c.client.Close()
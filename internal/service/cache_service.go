@@ -2,7 +2,9 @@ package service
 
 import (
 	"fmt"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pguia/iam/internal/config"
@@ -16,27 +18,54 @@ type CacheService interface {
 	Clear()
 }
 
+// TTLSetter is implemented by caches whose entry TTL can be changed at runtime
+type TTLSetter interface {
+	SetTTL(ttl time.Duration)
+}
+
 type cacheEntry struct {
 	value      interface{}
 	expiration time.Time
 }
 
+// DefaultCacheShards is the number of shards of the memory cache when none is configured
+const DefaultCacheShards = 32
+
+// cacheShard is one independently locked part of the memory cache
+type cacheShard struct {
+	mu   sync.RWMutex
+	data map[string]cacheEntry
+	_    [32]byte // pads the shard to a 64-byte cache line so neighbouring locks do not false-share
+}
+
+// cacheService is an in-memory cache split into shards, each with its own lock, so concurrent
+// checks on different keys rarely contend. The entry limit applies to the whole cache, approximately under concurrent sets.
 type cacheService struct {
 	cfg     *config.CacheConfig
-	data    map[string]cacheEntry
-	mu      sync.RWMutex
+	shards  []cacheShard
+	mask    uint64
+	seed    maphash.Seed
+	size    atomic.Int64
 	enabled bool
-	ttl     time.Duration
+	ttl     atomic.Int64 // time.Duration
+	hits    atomic.Int64
+	misses  atomic.Int64
 }
 
 // NewCacheService creates a new cache service
 func NewCacheService(cfg *config.CacheConfig) CacheService {
+	n := cacheShardCount(cfg.Shards)
 	cs := &cacheService{
 		cfg:     cfg,
-		data:    make(map[string]cacheEntry),
+		shards:  make([]cacheShard, n),
+		mask:    uint64(n - 1),
+		seed:    maphash.MakeSeed(),
 		enabled: cfg.Enabled,
-		ttl:     time.Duration(cfg.TTLSeconds) * time.Second,
 	}
+	for i := range cs.shards {
+		cs.shards[i].data = make(map[string]cacheEntry)
+	}
+	cs.ttl.Store(int64(time.Duration(cfg.TTLSeconds) * time.Second))
 
 	// Start cleanup goroutine
 	if cs.enabled {
@@ -46,24 +75,43 @@ func NewCacheService(cfg *config.CacheConfig) CacheService {
 	return cs
 }
 
+// cacheShardCount rounds the configured shard count up to a power of two
+func cacheShardCount(shards int) int {
+	if shards <= 0 {
+		shards = DefaultCacheShards
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	return n
+}
+
+func (c *cacheService) shard(key string) *cacheShard {
+	return &c.shards[maphash.String(c.seed, key)&c.mask]
+}
+
 func (c *cacheService) Get(key string) (interface{}, bool) {
 	if !c.enabled {
 		return nil, false
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	entry, exists := c.data[key]
+	shard := c.shard(key)
+	shard.mu.RLock()
+	entry, exists := shard.data[key]
+	shard.mu.RUnlock()
 	if !exists {
+		c.misses.Add(1)
 		return nil, false
 	}
 
 	// Check if expired
 	if time.Now().After(entry.expiration) {
+		c.misses.Add(1)
 		return nil, false
 	}
 
+	c.hits.Add(1)
 	return entry.value, true
 }
 
@@ -72,25 +120,37 @@ func (c *cacheService) Set(key string, value interface{}) {
 		return
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Check max size
-	if len(c.data) >= c.cfg.MaxSize {
-		// Simple eviction: remove expired entries
-		c.evictExpired()
+	entry := cacheEntry{
+		value:      value,
+		expiration: time.Now().Add(time.Duration(c.ttl.Load())),
+	}
 
-		// If still at max, clear oldest entries (simplified)
-		if len(c.data) >= c.cfg.MaxSize {
-			// In production, use LRU eviction
-			c.data = make(map[string]cacheEntry)
+	shard := c.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.data[key]; !exists {
+		// Check max size
+		if c.size.Load() >= int64(c.cfg.MaxSize) {
+			// Simple eviction: remove expired entries of this shard
+			c.evictExpired(shard)
+
+			// If still at max, clear this shard (simplified)
+			if c.size.Load() >= int64(c.cfg.MaxSize) {
+				// In production, use LRU eviction
+				c.size.Add(-int64(len(shard.data)))
+				shard.data = make(map[string]cacheEntry)
+			}
 		}
+		c.size.Add(1)
 	}
 
-	c.data[key] = cacheEntry{
-		value:      value,
-		expiration: time.Now().Add(c.ttl),
-	}
+	shard.data[key] = entry
+}
+
+// SetTTL changes the TTL of entries set from now on
+func (c *cacheService) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
 }
 
 func (c *cacheService) Delete(key string) {
@@ -98,15 +158,70 @@ func (c *cacheService) Delete(key string) {
 		return
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.data, key)
+	shard := c.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, exists := shard.data[key]; exists {
+		delete(shard.data, key)
+		c.size.Add(-1)
+	}
 }
 
 func (c *cacheService) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.data = make(map[string]cacheEntry)
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		c.size.Add(-int64(len(shard.data)))
+		shard.data = make(map[string]cacheEntry)
+		shard.mu.Unlock()
+	}
+}
+
+// Stats counts the unexpired entries per key prefix
+func (c *cacheService) Stats() (CacheStats, error) {
+	stats := newCacheStats(c.hits.Load(), c.misses.Load())
+	now := time.Now()
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.RLock()
+		for key, entry := range shard.data {
+			if !now.After(entry.expiration) {
+				stats.add(key)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return stats, nil
+}
+
+// Lookup returns the entry of key without counting a hit or miss
+func (c *cacheService) Lookup(key string) (*CacheEntry, error) {
+	shard := c.shard(key)
+	shard.mu.RLock()
+	entry, exists := shard.data[key]
+	shard.mu.RUnlock()
+	if !exists || time.Now().After(entry.expiration) {
+		return nil, nil
+	}
+	return &CacheEntry{Key: key, Value: entry.value, ExpiresAt: entry.expiration}, nil
+}
+
+// DeleteMatching deletes the entries whose key matches
+func (c *cacheService) DeleteMatching(match CacheKeyMatch) (int64, error) {
+	var deleted int64
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		for key := range shard.data {
+			if match.Matches(key) {
+				delete(shard.data, key)
+				deleted++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	c.size.Add(-deleted)
+	return deleted, nil
 }
 
 func (c *cacheService) cleanup() {
@@ -114,17 +229,22 @@ func (c *cacheService) cleanup() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		c.mu.Lock()
-		c.evictExpired()
-		c.mu.Unlock()
+		for i := range c.shards {
+			shard := &c.shards[i]
+			shard.mu.Lock()
+			c.evictExpired(shard)
+			shard.mu.Unlock()
+		}
 	}
 }
 
-func (c *cacheService) evictExpired() {
+// evictExpired removes the expired entries of shard, which must be locked
+func (c *cacheService) evictExpired(shard *cacheShard) {
 	now := time.Now()
-	for key, entry := range c.data {
+	for key, entry := range shard.data {
 		if now.After(entry.expiration) {
-			delete(c.data, key)
+			delete(shard.data, key)
+			c.size.Add(-1)
 		}
 	}
 }
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/pguia/iam/internal/config"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Test NoopCache - should never cache anything
@@ -364,3 +367,100 @@ func TestMemoryCache_ComplexValues(t *testing.T) {
 	assert.Equal(t, 1, retrievedMap["one"])
 	assert.Equal(t, 2, retrievedMap["two"])
 }
+
+// Test Memory Cache - shard counts are rounded up to a power of two
+func TestCacheShardCount(t *testing.T) {
+	assert.Equal(t, DefaultCacheShards, cacheShardCount(0))
+	assert.Equal(t, 1, cacheShardCount(1))
+	assert.Equal(t, 8, cacheShardCount(5))
+	assert.Equal(t, 64, cacheShardCount(64))
+}
+
+// Test Memory Cache - the size limit applies across all shards
+func TestMemoryCache_ShardedMaxSize(t *testing.T) {
+	cache := NewCacheService(&config.CacheConfig{
+		Type:           "memory",
+		Enabled:        true,
+		TTLSeconds:     300,
+		MaxSize:        50,
+		CleanupMinutes: 10,
+		Shards:         8,
+	}).(*cacheService)
+
+	for i := 0; i < 50; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), i)
+	}
+	assert.EqualValues(t, 50, cache.size.Load())
+	for i := 0; i < 50; i++ {
+		_, found := cache.Get(fmt.Sprintf("key%d", i))
+		assert.True(t, found)
+	}
+
+	// Overwriting does not grow the cache
+	cache.Set("key0", 100)
+	assert.EqualValues(t, 50, cache.size.Load())
+
+	for i := 50; i < 200; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), i)
+		assert.LessOrEqual(t, cache.size.Load(), int64(50))
+	}
+	_, found := cache.Get("key199")
+	assert.True(t, found)
+
+	cache.Delete("key199")
+	cache.Delete("key199")
+	total := 0
+	for i := range cache.shards {
+		total += len(cache.shards[i].data)
+	}
+	assert.EqualValues(t, total, cache.size.Load())
+
+	cache.Clear()
+	assert.EqualValues(t, 0, cache.size.Load())
+}
+
+// Test: Each redis mode creates its client, with the pool settings applied; nothing is dialed
+func TestNewRedisClient_Modes(t *testing.T) {
+	standalone, err := newRedisClient(&config.RedisCacheConfig{
+		Address:            "cache:6379",
+		DB:                 2,
+		PoolSize:           50,
+		MinIdleConns:       5,
+		ReadTimeoutSeconds: 1,
+	})
+	require.NoError(t, err)
+	defer standalone.Close()
+	client, ok := standalone.(*redis.Client)
+	require.True(t, ok)
+	assert.Equal(t, "cache:6379", client.Options().Addr)
+	assert.Equal(t, 2, client.Options().DB)
+	assert.Equal(t, 50, client.Options().PoolSize)
+	assert.Equal(t, 5, client.Options().MinIdleConns)
+	assert.Equal(t, time.Second, client.Options().WriteTimeout)
+
+	cluster, err := newRedisClient(&config.RedisCacheConfig{Mode: "cluster", Addresses: []string{"redis-0:6379", "redis-1:6379"}})
+	require.NoError(t, err)
+	defer cluster.Close()
+	clusterClient, ok := cluster.(*redis.ClusterClient)
+	require.True(t, ok)
+	assert.Equal(t, []string{"redis-0:6379", "redis-1:6379"}, clusterClient.Options().Addrs)
+
+	sentinel, err := newRedisClient(&config.RedisCacheConfig{Mode: "sentinel", Addresses: []string{"sentinel-0:26379"}, MasterName: "cache"})
+	require.NoError(t, err)
+	defer sentinel.Close()
+	assert.IsType(t, &redis.Client{}, sentinel)
+
+	_, err = newRedisClient(&config.RedisCacheConfig{Mode: "ring"})
+	assert.ErrorContains(t, err, "unknown redis mode")
+}
+
+func TestRedisGlobEscaper(t *testing.T) {
+	assert.Equal(t, "prod:", redisGlobEscaper.Replace("prod:"))
+	assert.Equal(t, `env\*\[1\]\?:`, redisGlobEscaper.Replace("env*[1]?:"))
+}
+
+func TestRedisMatchPattern(t *testing.T) {
+	assert.Equal(t, `iam:perm:*`, redisMatchPattern("iam:", CacheKeyMatch{Prefix: "perm:"}))
+	assert.Equal(t, `iam:perm:*:r1:*`, redisMatchPattern("iam:", CacheKeyMatch{Prefix: "perm:", Contains: ":r1:"}))
+	assert.Equal(t, `perm:group:a\*:*`, redisMatchPattern("", CacheKeyMatch{Prefix: "perm:group:a*:"}))
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+// DefaultMaxTrackedPairs bounds the number of principal/resource pairs a CheckTracker counts
+const DefaultMaxTrackedPairs = 10000
+
+// WarmupTarget is a principal/resource pair whose permissions are precomputed
+type WarmupTarget struct {
+	Principal  string
+	ResourceID uuid.UUID
+}
+
+// WarmupResult summarizes a cache warm-up run
+type WarmupResult struct {
+	Targets  int           // Pairs processed
+	Entries  int           // Granted permissions written to the cache
+	Failures int           // Pairs or permissions that could not be evaluated
+	Duration time.Duration // Wall time of the run
+}
+
+// CheckTracker counts permission checks per principal/resource pair
+type CheckTracker struct {
+	mu       sync.Mutex
+	counts   map[WarmupTarget]int64
+	maxPairs int
+}
+
+// NewCheckTracker creates a tracker that counts at most maxPairs distinct pairs.
+// Once full, checks on pairs not already tracked are ignored.
+func NewCheckTracker(maxPairs int) *CheckTracker {
+	if maxPairs <= 0 {
+		maxPairs = DefaultMaxTrackedPairs
+	}
+	return &CheckTracker{
+		counts:   make(map[WarmupTarget]int64),
+		maxPairs: maxPairs,
+	}
+}
+
+// Record counts a permission check
+func (t *CheckTracker) Record(principal string, resourceID uuid.UUID) {
+	key := WarmupTarget{Principal: principal, ResourceID: resourceID}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, tracked := t.counts[key]; !tracked && len(t.counts) >= t.maxPairs {
+		return
+	}
+	t.counts[key]++
+}
+
+// Top returns the n most frequently checked pairs, most frequent first
+func (t *CheckTracker) Top(n int) []WarmupTarget {
+	if n <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	targets := make([]WarmupTarget, 0, len(t.counts))
+	counts := make(map[WarmupTarget]int64, len(t.counts))
+	for target, count := range t.counts {
+		targets = append(targets, target)
+		counts[target] = count
+	}
+	t.mu.Unlock()
+
+	sort.Slice(targets, func(i, j int) bool {
+		if counts[targets[i]] != counts[targets[j]] {
+			return counts[targets[i]] > counts[targets[j]]
+		}
+		// Deterministic order for ties
+		if targets[i].Principal != targets[j].Principal {
+			return targets[i].Principal < targets[j].Principal
+		}
+		return targets[i].ResourceID.String() < targets[j].ResourceID.String()
+	})
+
+	if len(targets) > n {
+		targets = targets[:n]
+	}
+	return targets
+}
+
+// trackingEvaluator records every CheckPermission call and batched check in a CheckTracker
+type trackingEvaluator struct {
+	PermissionEvaluator
+	tracker *CheckTracker
+}
+
+// NewTrackingEvaluator wraps evaluator so checked pairs are counted for cache warm-up
+func NewTrackingEvaluator(evaluator PermissionEvaluator, tracker *CheckTracker) PermissionEvaluator {
+	return &trackingEvaluator{
+		PermissionEvaluator: evaluator,
+		tracker:             tracker,
+	}
+}
+
+func (te *trackingEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	te.tracker.Record(principal, resourceID)
+	return te.PermissionEvaluator.CheckPermission(principal, resourceID, permission, context)
+}
+
+func (te *trackingEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	te.tracker.Record(principal, resourceID)
+	return te.PermissionEvaluator.Check(principal, resourceID, permission, context)
+}
+
+func (te *trackingEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	for _, check := range checks {
+		te.tracker.Record(principal, check.ResourceID)
+	}
+	return te.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+}
+
+func (te *trackingEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	for _, principal := range principals {
+		te.tracker.Record(principal, resourceID)
+	}
+	return te.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+}
+
+// CacheWarmer precomputes permission checks for hot principals so the first
+// real checks after a start or a cache flush are served from the cache
+type CacheWarmer struct {
+	evaluator   PermissionEvaluator
+	tracker     *CheckTracker
+	principals  []string
+	resources   []uuid.UUID
+	topPairs    int
+	concurrency int
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	running bool
+
+	stopped  chan struct{}
+	stopOnce sync.Once
+	inflight sync.WaitGroup
+}
+
+// NewCacheWarmer creates a cache warmer.
+// evaluator should be the untracked evaluator so warm-up checks do not skew the tracker;
+// tracker may be nil when hot pairs are only configured statically; a nil logger uses slog.Default().
+func NewCacheWarmer(cfg *config.CacheWarmupConfig, evaluator PermissionEvaluator, tracker *CheckTracker, logger *slog.Logger) (*CacheWarmer, error) {
+	w := &CacheWarmer{
+		evaluator:   evaluator,
+		tracker:     tracker,
+		principals:  cfg.Principals,
+		topPairs:    cfg.TopPairs,
+		concurrency: cfg.Concurrency,
+		logger:      logger,
+		stopped:     make(chan struct{}),
+	}
+
+	if w.logger == nil {
+		w.logger = slog.Default()
+	}
+
+	if w.concurrency <= 0 {
+		w.concurrency = 1
+	}
+
+	for _, raw := range cfg.Resources {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid warm-up resource id %q: %w", raw, err)
+		}
+		w.resources = append(w.resources, id)
+	}
+
+	return w, nil
+}
+
+// Targets returns the configured hot pairs followed by the most frequently checked pairs
+func (w *CacheWarmer) Targets() []WarmupTarget {
+	seen := make(map[WarmupTarget]bool)
+	var targets []WarmupTarget
+
+	add := func(target WarmupTarget) {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	for _, principal := range w.principals {
+		for _, resourceID := range w.resources {
+			add(WarmupTarget{Principal: principal, ResourceID: resourceID})
+		}
+	}
+
+	if w.tracker != nil {
+		for _, target := range w.tracker.Top(w.topPairs) {
+			add(target)
+		}
+	}
+
+	return targets
+}
+
+// Warm precomputes the given pairs, or Targets() when none are given.
+// Each effective permission is checked through the evaluator, which caches grants
+// exactly as a live check would (including condition evaluation).
+func (w *CacheWarmer) Warm(targets []WarmupTarget) WarmupResult {
+	if len(targets) == 0 {
+		targets = w.Targets()
+	}
+
+	start := time.Now()
+	result := WarmupResult{Targets: len(targets)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan WarmupTarget)
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				entries, failures := w.warmTarget(target)
+				mu.Lock()
+				result.Entries += entries
+				result.Failures += failures
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, target := range targets {
+		select {
+		case jobs <- target:
+		case <-w.stopped:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// WarmAsync runs Warm in the background and logs the result.
+// It returns false if a warm-up is already running or the warmer is stopped.
+func (w *CacheWarmer) WarmAsync(targets []WarmupTarget) bool {
+	w.mu.Lock()
+	if w.running || w.isStopped() {
+		w.mu.Unlock()
+		return false
+	}
+	w.running = true
+	w.inflight.Add(1)
+	w.mu.Unlock()
+
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			w.running = false
+			w.mu.Unlock()
+			w.inflight.Done()
+		}()
+
+		result := w.Warm(targets)
+		w.logger.Info("Cache warm-up finished",
+			"targets", result.Targets, "entries", result.Entries,
+			"failures", result.Failures, "duration", result.Duration)
+	}()
+
+	return true
+}
+
+// Stop makes running warm-ups finish the pairs in progress and skip the rest, then waits for
+// background warm-ups to return or ctx to expire. The warmer cannot be restarted.
+func (w *CacheWarmer) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	w.stopOnce.Do(func() { close(w.stopped) })
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *CacheWarmer) isStopped() bool {
+	select {
+	case <-w.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *CacheWarmer) warmTarget(target WarmupTarget) (entries, failures int) {
+	permissions, _, err := w.evaluator.GetEffectivePermissions(target.Principal, target.ResourceID)
+	if err != nil {
+		return 0, 1
+	}
+
+	for _, permission := range permissions {
+		allowed, _, err := w.evaluator.CheckPermission(target.Principal, target.ResourceID, permission, nil)
+		if err != nil {
+			failures++
+			continue
+		}
+		if allowed {
+			entries++
+		}
+	}
+
+	return entries, failures
+}
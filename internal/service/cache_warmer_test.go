@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTracker_Top(t *testing.T) {
+	tracker := NewCheckTracker(10)
+	hot := uuid.New()
+	warm := uuid.New()
+	cold := uuid.New()
+
+	for i := 0; i < 5; i++ {
+		tracker.Record("user:alice@example.com", hot)
+	}
+	for i := 0; i < 3; i++ {
+		tracker.Record("user:bob@example.com", warm)
+	}
+	tracker.Record("user:carol@example.com", cold)
+
+	top := tracker.Top(2)
+	require.Len(t, top, 2)
+	assert.Equal(t, WarmupTarget{Principal: "user:alice@example.com", ResourceID: hot}, top[0])
+	assert.Equal(t, WarmupTarget{Principal: "user:bob@example.com", ResourceID: warm}, top[1])
+
+	assert.Nil(t, tracker.Top(0))
+	assert.Len(t, tracker.Top(100), 3)
+}
+
+func TestCheckTracker_MaxPairs(t *testing.T) {
+	tracker := NewCheckTracker(1)
+	first := uuid.New()
+
+	tracker.Record("user:alice@example.com", first)
+	tracker.Record("user:bob@example.com", uuid.New()) // Ignored, tracker is full
+	tracker.Record("user:alice@example.com", first)
+
+	top := tracker.Top(10)
+	require.Len(t, top, 1)
+	assert.Equal(t, "user:alice@example.com", top[0].Principal)
+}
+
+func TestTrackingEvaluator_RecordsChecks(t *testing.T) {
+	inner := new(MockPermissionEvaluator)
+	tracker := NewCheckTracker(10)
+	evaluator := NewTrackingEvaluator(inner, tracker)
+	resourceID := uuid.New()
+
+	inner.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).
+		Return(true, "granted", nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, []WarmupTarget{{Principal: "user:alice@example.com", ResourceID: resourceID}}, tracker.Top(1))
+}
+
+func TestNewCacheWarmer_InvalidResource(t *testing.T) {
+	_, err := NewCacheWarmer(&config.CacheWarmupConfig{Resources: []string{"not-a-uuid"}}, new(MockPermissionEvaluator), nil, nil)
+	assert.Error(t, err)
+}
+
+func TestCacheWarmer_Targets(t *testing.T) {
+	r1 := uuid.New()
+	r2 := uuid.New()
+	tracked := uuid.New()
+
+	tracker := NewCheckTracker(10)
+	tracker.Record("user:alice@example.com", r1) // Already configured, not duplicated
+	tracker.Record("user:bob@example.com", tracked)
+	tracker.Record("user:bob@example.com", tracked)
+
+	warmer, err := NewCacheWarmer(&config.CacheWarmupConfig{
+		Principals: []string{"user:alice@example.com"},
+		Resources:  []string{r1.String(), r2.String()},
+		TopPairs:   2,
+	}, new(MockPermissionEvaluator), tracker, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []WarmupTarget{
+		{Principal: "user:alice@example.com", ResourceID: r1},
+		{Principal: "user:alice@example.com", ResourceID: r2},
+		{Principal: "user:bob@example.com", ResourceID: tracked},
+	}, warmer.Targets())
+}
+
+func TestCacheWarmer_Warm(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	missing := uuid.New()
+
+	evaluator.On("GetEffectivePermissions", "user:alice@example.com", resourceID).
+		Return([]string{"storage.buckets.get", "storage.buckets.list"}, []string{"roles/viewer"}, nil)
+	evaluator.On("GetEffectivePermissions", "user:alice@example.com", missing).
+		Return(nil, nil, errors.New("resource not found"))
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).
+		Return(true, "granted", nil)
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.list", map[string]string(nil)).
+		Return(false, "condition not met", nil)
+
+	warmer, err := NewCacheWarmer(&config.CacheWarmupConfig{
+		Principals:  []string{"user:alice@example.com"},
+		Resources:   []string{resourceID.String(), missing.String()},
+		Concurrency: 2,
+	}, evaluator, nil, nil)
+	require.NoError(t, err)
+
+	result := warmer.Warm(nil)
+
+	assert.Equal(t, 2, result.Targets)
+	assert.Equal(t, 1, result.Entries)
+	assert.Equal(t, 1, result.Failures)
+	evaluator.AssertExpectations(t)
+}
+
+func TestCacheWarmer_WarmPopulatesCache(t *testing.T) {
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache)
+
+	resourceID := uuid.New()
+	policy := &domain.Policy{
+		ResourceID: resourceID,
+		Bindings: []domain.Binding{{
+			Members: toJSON([]string{"user:alice@example.com"}),
+			Role: &domain.Role{
+				Name:        "roles/storage.viewer",
+				Permissions: []domain.Permission{{Name: "storage.buckets.get"}},
+			},
+		}},
+	}
+
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	warmer, err := NewCacheWarmer(&config.CacheWarmupConfig{Concurrency: 1}, evaluator, nil, nil)
+	require.NoError(t, err)
+
+	result := warmer.Warm([]WarmupTarget{{Principal: "user:alice@example.com", ResourceID: resourceID}})
+	assert.Equal(t, 1, result.Entries)
+
+	cached, found := cache.Get(GenerateCacheKey("user:alice@example.com", resourceID.String(), "storage.buckets.get"))
+	assert.True(t, found)
+	assert.Equal(t, "roles/storage.viewer", cached)
+}
+
+func TestCacheWarmer_WarmAsync(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+
+	var calls int32
+	release := make(chan struct{})
+	evaluator.On("GetEffectivePermissions", "user:alice@example.com", resourceID).
+		Run(func(mock.Arguments) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+		}).
+		Return([]string{}, []string{}, nil)
+
+	warmer, err := NewCacheWarmer(&config.CacheWarmupConfig{}, evaluator, nil, nil)
+	require.NoError(t, err)
+
+	targets := []WarmupTarget{{Principal: "user:alice@example.com", ResourceID: resourceID}}
+	assert.True(t, warmer.WarmAsync(targets))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, 10*time.Millisecond)
+
+	// A second run is rejected while the first is in progress
+	assert.False(t, warmer.WarmAsync(targets))
+
+	close(release)
+	assert.Eventually(t, func() bool { return warmer.WarmAsync(targets) }, time.Second, 10*time.Millisecond)
+}
+
+func TestCacheWarmer_Stop(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	first := uuid.New()
+	second := uuid.New()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	evaluator.On("GetEffectivePermissions", "user:alice@example.com", first).
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return([]string{}, []string{}, nil)
+
+	warmer, err := NewCacheWarmer(&config.CacheWarmupConfig{Concurrency: 1}, evaluator, nil, nil)
+	require.NoError(t, err)
+
+	assert.True(t, warmer.WarmAsync([]WarmupTarget{
+		{Principal: "user:alice@example.com", ResourceID: first},
+		{Principal: "user:alice@example.com", ResourceID: second},
+	}))
+	<-started
+
+	// Stop times out while a pair is still being warmed
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, warmer.Stop(ctx), context.DeadlineExceeded)
+
+	// Once the pair in progress finishes, the remaining pair is skipped
+	close(release)
+	assert.NoError(t, warmer.Stop(context.Background()))
+	evaluator.AssertNotCalled(t, "GetEffectivePermissions", "user:alice@example.com", second)
+
+	// A stopped warmer does not start new runs
+	assert.False(t, warmer.WarmAsync(nil))
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+)
+
+// Variables available to condition (CEL) expressions
+//
+//	request.time         timestamp  time of the permission check (UTC)
+//	request.ip           string     caller IP address
+//	principal.id         string     checked principal, e.g. "user:alice@example.com"
+//	principal.attributes map        principal attributes, e.g. principal.attributes.department
+//	resource.type        string     type of the checked resource, e.g. "bucket"
+//	resource.name        string     name of the checked resource
+//	resource.attributes  map        attributes of the checked resource
+//	resource.tags        map        tags of the checked resource, e.g. resource.tags['env'] == 'prod'
+//	context              map        arbitrary key/values passed to CheckPermission
+const (
+	CondVarRequestTime         = "request.time"
+	CondVarRequestIP           = "request.ip"
+	CondVarPrincipalID         = "principal.id"
+	CondVarPrincipalAttributes = "principal.attributes"
+	CondVarResourceType        = "resource.type"
+	CondVarResourceName        = "resource.name"
+	CondVarResourceAttributes  = "resource.attributes"
+	CondVarResourceTags        = "resource.tags"
+	CondVarContext             = "context"
+)
+
+// Reserved CheckPermission context keys that populate request attributes
+const (
+	ContextKeyRequestTime = "request.time" // RFC 3339; defaults to the time of the check
+	ContextKeyCallerIP    = "request.ip"
+
+	// ContextKeyPrincipalAttributePrefix prefixes context keys supplying principal attributes,
+	// e.g. "principal.department"; attributes of a PrincipalAttributeProvider take precedence
+	ContextKeyPrincipalAttributePrefix = "principal."
+)
+
+// conditionSchema lists the fields of each root variable; nil means any key is allowed
+var conditionSchema = map[string]map[string]bool{
+	"request":   {"time": true, "ip": true},
+	"principal": {"id": true, "attributes": true},
+	"resource":  {"type": true, "name": true, "attributes": true, "tags": true},
+	"context":   nil,
+}
+
+// celGlobals are CEL literals and global functions/macros accepted in expressions
+var celGlobals = map[string]bool{
+	"true": true, "false": true, "null": true, "in": true,
+	"has": true, "size": true, "matches": true, "type": true,
+	"int": true, "uint": true, "double": true, "string": true, "bytes": true, "bool": true,
+	"timestamp": true, "duration": true, "dyn": true,
+}
+
+// ConditionContext is the typed input passed to condition evaluation
+type ConditionContext struct {
+	RequestTime         time.Time
+	CallerIP            string
+	Principal           string
+	PrincipalAttributes map[string]string
+	ResourceType        string
+	ResourceName        string
+	ResourceAttributes  map[string]interface{}
+	ResourceTags        map[string]string
+	Values              map[string]string // Remaining CheckPermission context key/values
+
+	principalResolved bool // PrincipalAttributes include the attributes of the attribute providers
+}
+
+// NewConditionContext builds the evaluation context for a check of principal on resource
+func NewConditionContext(principal string, resource *domain.Resource, context map[string]string) *ConditionContext {
+	ctx := &ConditionContext{
+		RequestTime:         time.Now().UTC(),
+		Principal:           principal,
+		PrincipalAttributes: make(map[string]string),
+		Values:              make(map[string]string, len(context)),
+	}
+
+	if resource != nil {
+		ctx.ResourceType = resource.Type
+		ctx.ResourceName = resource.Name
+		ctx.ResourceAttributes = resource.Attributes
+		ctx.ResourceTags = resource.TagMap()
+	}
+
+	for key, value := range context {
+		switch key {
+		case ContextKeyRequestTime:
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				ctx.RequestTime = t.UTC()
+			}
+		case ContextKeyCallerIP:
+			ctx.CallerIP = value
+		case contextKeyTokenGroups, contextKeyConsistency, contextKeyRequestID, contextKeyCallerService:
+			// Options of the check, not condition inputs
+		default:
+			if name, ok := strings.CutPrefix(key, ContextKeyPrincipalAttributePrefix); ok && name != "" {
+				ctx.PrincipalAttributes[name] = value
+				continue
+			}
+			ctx.Values[key] = value
+		}
+	}
+
+	return ctx
+}
+
+// Variables returns the context as CEL activation variables
+func (c *ConditionContext) Variables() map[string]interface{} {
+	attributes := c.ResourceAttributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	tags := c.ResourceTags
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	principalAttrs := c.PrincipalAttributes
+	if principalAttrs == nil {
+		principalAttrs = map[string]string{}
+	}
+
+	return map[string]interface{}{
+		"request": map[string]interface{}{
+			"time": c.RequestTime,
+			"ip":   c.CallerIP,
+		},
+		"principal": map[string]interface{}{
+			"id":         c.Principal,
+			"attributes": principalAttrs,
+		},
+		"resource": map[string]interface{}{
+			"type":       c.ResourceType,
+			"name":       c.ResourceName,
+			"attributes": attributes,
+			"tags":       tags,
+		},
+		"context": c.Values,
+	}
+}
+
+var (
+	conditionStringLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	conditionMacroBinding  = regexp.MustCompile(`\.(?:all|exists|exists_one|map|filter)\(\s*([A-Za-z_]\w*)\s*,`)
+)
+
+// ValidateConditionExpression checks an expression against the condition schema.
+// It rejects unbalanced brackets, references to undeclared variables or fields and
+// expressions that do not compile as CEL returning a bool.
+func ValidateConditionExpression(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return fmt.Errorf("condition expression is required")
+	}
+
+	// Blank out string literals so their contents are not parsed as references
+	stripped := conditionStringLiteral.ReplaceAllStringFunc(expression, func(lit string) string {
+		return strings.Repeat(" ", len(lit))
+	})
+	if strings.ContainsAny(stripped, `"'`) {
+		return fmt.Errorf("unterminated string literal in condition expression")
+	}
+
+	if err := checkBalanced(stripped); err != nil {
+		return err
+	}
+
+	// Comprehension macros bind local variables, e.g. resource.attributes.all(k, k != "")
+	bound := make(map[string]bool)
+	for _, match := range conditionMacroBinding.FindAllStringSubmatch(stripped, -1) {
+		bound[match[1]] = true
+	}
+
+	for _, ref := range scanReferences(stripped) {
+		root := ref.path[0]
+		if bound[root] || celGlobals[root] {
+			continue
+		}
+
+		fields, declared := conditionSchema[root]
+		if !declared {
+			return fmt.Errorf("undeclared reference %q in condition expression", root)
+		}
+
+		// Bare root variable, or a map whose keys are not declared up front
+		if len(ref.path) == 1 || fields == nil {
+			continue
+		}
+
+		// The segment after the root must be a declared field unless it is a method call on the root
+		if !fields[ref.path[1]] && !(len(ref.path) == 2 && ref.call) {
+			return fmt.Errorf("undeclared field %q on %q in condition expression", ref.path[1], root)
+		}
+	}
+
+	_, err := compileCondition(expression)
+	return err
+}
+
+// readsPrincipalAttributes reports whether expression may read principal.attributes, i.e.
+// references them or the whole principal variable
+func readsPrincipalAttributes(expression string) bool {
+	stripped := conditionStringLiteral.ReplaceAllStringFunc(expression, func(lit string) string {
+		return strings.Repeat(" ", len(lit))
+	})
+	for _, ref := range scanReferences(stripped) {
+		if ref.path[0] == "principal" && (len(ref.path) == 1 || ref.path[1] == "attributes") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBalanced verifies parentheses, brackets and braces are balanced
+func checkBalanced(expression string) error {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var stack []rune
+
+	for _, r := range expression {
+		switch r {
+		case '(', '[', '{':
+			stack = append(stack, r)
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != pairs[r] {
+				return fmt.Errorf("unbalanced %q in condition expression", r)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q in condition expression", stack[len(stack)-1])
+	}
+	return nil
+}
+
+// conditionRef is a dotted identifier path found in an expression, e.g. resource.attributes.env
+type conditionRef struct {
+	path []string
+	call bool // followed by an argument list
+}
+
+// scanReferences extracts identifier paths that start a member chain.
+// Identifiers that follow a '.' (fields, methods) or a digit (numeric literals) are part of
+// a preceding token and are not reported on their own.
+func scanReferences(expression string) []conditionRef {
+	var refs []conditionRef
+	n := len(expression)
+
+	for i := 0; i < n; {
+		if !isIdentStart(expression[i]) || (i > 0 && (isIdentChar(expression[i-1]) || expression[i-1] == '.')) {
+			i++
+			continue
+		}
+
+		var ref conditionRef
+		for {
+			start := i
+			for i < n && isIdentChar(expression[i]) {
+				i++
+			}
+			ref.path = append(ref.path, expression[start:i])
+
+			j := skipSpaces(expression, i)
+			if j < n && expression[j] == '.' {
+				k := skipSpaces(expression, j+1)
+				if k < n && isIdentStart(expression[k]) {
+					i = k
+					continue
+				}
+			}
+			break
+		}
+
+		j := skipSpaces(expression, i)
+		ref.call = j < n && expression[j] == '('
+		refs = append(refs, ref)
+	}
+
+	return refs
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
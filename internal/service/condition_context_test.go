@@ -0,0 +1,148 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test: Condition context is built from the resource and request context
+func TestNewConditionContext(t *testing.T) {
+	resource := &domain.Resource{
+		Type:       "bucket",
+		Name:       "prod-data",
+		Attributes: map[string]interface{}{"env": "prod"},
+		Tags:       []domain.ResourceTag{{Key: "cost-center", Value: "cc-42"}},
+	}
+
+	ctx := NewConditionContext("user:alice@example.com", resource, map[string]string{
+		ContextKeyRequestTime:  "2025-01-02T10:00:00Z",
+		ContextKeyCallerIP:     "10.0.0.1",
+		"team":                 "storage",
+		"principal.department": "finance",
+	})
+
+	assert.Equal(t, time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC), ctx.RequestTime)
+	assert.Equal(t, "10.0.0.1", ctx.CallerIP)
+	assert.Equal(t, "bucket", ctx.ResourceType)
+	assert.Equal(t, "prod-data", ctx.ResourceName)
+	assert.Equal(t, "prod", ctx.ResourceAttributes["env"])
+	assert.Equal(t, map[string]string{"team": "storage"}, ctx.Values)
+	assert.Equal(t, map[string]string{"department": "finance"}, ctx.PrincipalAttributes)
+
+	vars := ctx.Variables()
+	assert.Equal(t, "10.0.0.1", vars["request"].(map[string]interface{})["ip"])
+	assert.Equal(t, "bucket", vars["resource"].(map[string]interface{})["type"])
+	assert.Equal(t, "storage", vars["context"].(map[string]string)["team"])
+	assert.Equal(t, "user:alice@example.com", vars["principal"].(map[string]interface{})["id"])
+	assert.Equal(t, "finance", vars["principal"].(map[string]interface{})["attributes"].(map[string]string)["department"])
+	assert.Equal(t, "cc-42", vars["resource"].(map[string]interface{})["tags"].(map[string]string)["cost-center"])
+}
+
+// Test: Request time defaults to now when absent or invalid
+func TestNewConditionContext_DefaultRequestTime(t *testing.T) {
+	before := time.Now().UTC()
+	ctx := NewConditionContext("", nil, map[string]string{ContextKeyRequestTime: "not-a-time"})
+
+	assert.False(t, ctx.RequestTime.Before(before))
+	assert.Empty(t, ctx.ResourceType)
+	assert.NotNil(t, ctx.Variables()["resource"].(map[string]interface{})["attributes"])
+	assert.NotNil(t, ctx.Variables()["resource"].(map[string]interface{})["tags"])
+}
+
+// Test: Expressions are validated against the schema
+func TestValidateConditionExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{"request time", `request.time.getHours() >= 9 && request.time.getHours() < 17`, false},
+		{"resource attributes", `resource.attributes.env == "prod"`, false},
+		{"principal attributes", `principal.attributes.clearance in ["secret", "top-secret"] && principal.id != ""`, false},
+		{"undeclared principal field", `principal.department == "finance"`, true},
+		{"resource tags", `resource.tags['env'] == 'prod' && has(resource.tags.team)`, false},
+		{"context values", `context.team in ["storage", "compute"]`, false},
+		{"macros and functions", `has(resource.attributes.owner) && size(context) > 0`, false},
+		{"comprehension variable", `resource.attributes.all(k, k != "")`, false},
+		{"string contents ignored", `resource.type == "user.name"`, false},
+		{"empty", `  `, true},
+		{"undeclared variable", `user.email == "a@example.com"`, true},
+		{"undeclared field", `request.method == "GET"`, true},
+		{"unbalanced parentheses", `(request.ip == "10.0.0.1"`, true},
+		{"unterminated string", `resource.name == "oops`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConditionExpression(tt.expression)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// Test: Conditions are evaluated as CEL over the condition context
+func TestEvaluateCondition(t *testing.T) {
+	resource := &domain.Resource{
+		Type:       "bucket",
+		Attributes: map[string]interface{}{"env": "prod", "classification": "internal"},
+		Tags:       []domain.ResourceTag{{Key: "env", Value: "prod"}},
+	}
+	condCtx := NewConditionContext("user:alice@example.com", resource, map[string]string{
+		ContextKeyRequestTime:  "2025-01-02T10:00:00Z",
+		"principal.department": "finance",
+		"team":                 "storage",
+	})
+
+	tests := []struct {
+		name       string
+		expression string
+		holds      bool
+	}{
+		{"resource tag matches", `resource.tags['env'] == 'prod'`, true},
+		{"resource tag differs", `resource.tags['env'] == 'dev'`, false},
+		{"principal attribute", `principal.attributes.department == "finance"`, true},
+		{"principal attribute differs", `principal.attributes.department == "sales"`, false},
+		{"resource attribute", `resource.attributes.env == "prod" && resource.type == "bucket"`, true},
+		{"resource attribute by index", `resource.attributes['classification'] != 'restricted'`, true},
+		{"missing resource attribute does not hold", `resource.attributes['owner'] != 'bob'`, false},
+		{"guarded missing resource attribute", `!has(resource.attributes.owner) || resource.attributes.owner != 'bob'`, true},
+		{"request time", `request.time.getHours() >= 9 && request.time.getHours() < 17`, true},
+		{"request time outside", `request.time < timestamp("2024-01-01T00:00:00Z")`, false},
+		{"context value", `context.team in ["storage", "compute"]`, true},
+		{"missing attribute does not hold", `principal.attributes.clearance == "secret"`, false},
+		{"guarded missing attribute", `!has(principal.attributes.clearance)`, true},
+		{"invalid expression does not hold", `resource.type ==`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.holds, evaluateCondition(&domain.Condition{Expression: tt.expression}, condCtx))
+		})
+	}
+
+	assert.True(t, evaluateCondition(nil, condCtx))
+}
+
+// Test: Expressions that are not boolean CEL are rejected
+func TestValidateConditionExpression_CEL(t *testing.T) {
+	assert.ErrorContains(t, ValidateConditionExpression(`resource.name + "x"`), "must return a bool")
+	assert.ErrorContains(t, ValidateConditionExpression(`resource.type == = "bucket"`), "invalid condition expression")
+	assert.NoError(t, ValidateConditionExpression(`resource.tags['env'] == 'prod'`))
+}
+
+// Test: Only conditions that can read principal attributes need them fetched
+func TestReadsPrincipalAttributes(t *testing.T) {
+	assert.True(t, readsPrincipalAttributes(`principal.attributes.department == "finance"`))
+	assert.True(t, readsPrincipalAttributes(`has(principal.attributes.clearance)`))
+	assert.True(t, readsPrincipalAttributes(`size(principal) > 0`))
+	assert.False(t, readsPrincipalAttributes(`principal.type == "user"`))
+	assert.False(t, readsPrincipalAttributes(`resource.tags['owner'] == "principal.attributes"`))
+	assert.False(t, readsPrincipalAttributes(`request.time.getHours() >= 9`))
+}
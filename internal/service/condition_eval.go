@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// conditionCostLimit bounds the work of one condition evaluation, so that an expensive
+// comprehension over large attribute maps cannot stall a check
+const conditionCostLimit = 100000
+
+// maxCompiledConditions bounds the programs kept by the condition compiler
+const maxCompiledConditions = 10000
+
+// conditionEnv declares the root variables of conditionSchema. Their fields are checked by
+// ValidateConditionExpression; CEL sees them as maps of dynamic values.
+var conditionEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("context", cel.MapType(cel.StringType, cel.StringType)),
+	)
+})
+
+// conditionPrograms caches compiled conditions by expression; bindings share few expressions
+var conditionPrograms = struct {
+	mu       sync.Mutex
+	programs map[string]cel.Program
+}{programs: make(map[string]cel.Program)}
+
+// compileCondition type-checks expression and returns its program. The expression must
+// evaluate to a bool.
+func compileCondition(expression string) (cel.Program, error) {
+	conditionPrograms.mu.Lock()
+	program, ok := conditionPrograms.programs[expression]
+	conditionPrograms.mu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	env, err := conditionEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create condition environment: %w", err)
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid condition expression: %w", issues.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("condition expression must return a bool, not %s", ast.OutputType())
+	}
+	program, err = env.Program(ast, cel.CostLimit(conditionCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition expression: %w", err)
+	}
+
+	conditionPrograms.mu.Lock()
+	// Start over rather than track recency, like the client decision cache
+	if len(conditionPrograms.programs) >= maxCompiledConditions {
+		conditionPrograms.programs = make(map[string]cel.Program)
+	}
+	conditionPrograms.programs[expression] = program
+	conditionPrograms.mu.Unlock()
+	return program, nil
+}
+
+// evaluateCondition evaluates a binding condition against the condition context. A condition
+// that does not compile, fails at runtime (e.g. reads a missing attribute) or does not return
+// true does not hold, so its binding grants nothing.
+func evaluateCondition(condition *domain.Condition, condCtx *ConditionContext) bool {
+	if condition == nil || condition.Expression == "" {
+		return true
+	}
+	program, err := compileCondition(condition.Expression)
+	if err != nil {
+		return false
+	}
+	result, _, err := program.Eval(condCtx.Variables())
+	if err != nil {
+		return false
+	}
+	holds, ok := result.Value().(bool)
+	return ok && holds
+}
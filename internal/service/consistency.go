@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Consistency levels of CheckPermission
+const (
+	// ConsistencyMinimizeLatency serves a check from the decision cache and the read replica
+	// when they are configured, so it may miss a change made moments before. It is the default.
+	ConsistencyMinimizeLatency = "minimize_latency"
+	// ConsistencyFullyConsistent skips the decision cache, the evaluation read model and the
+	// local replicas of policies, and reads resources and policies from the primary database, so
+	// the check sees every binding committed before it started. Group memberships still come from
+	// the group resolvers, including their caches.
+	ConsistencyFullyConsistent = "fully_consistent"
+)
+
+// contextKeyConsistency marks the context of a fully consistent check. Callers cannot supply it,
+// IAMService removes it from the contexts of other checks.
+const contextKeyConsistency = "check.consistency"
+
+// withConsistency returns a copy of context carrying consistency; an empty consistency is
+// ConsistencyMinimizeLatency
+func withConsistency(context map[string]string, consistency string) (map[string]string, error) {
+	scoped := withoutReservedKeys(context)
+	switch consistency {
+	case "", ConsistencyMinimizeLatency:
+		return scoped, nil
+	case ConsistencyFullyConsistent:
+		if scoped == nil {
+			scoped = make(map[string]string, 1)
+		}
+		scoped[contextKeyConsistency] = consistency
+		return scoped, nil
+	default:
+		return nil, fmt.Errorf("consistency must be %q or %q", ConsistencyMinimizeLatency, ConsistencyFullyConsistent)
+	}
+}
+
+// fullyConsistent reports whether the check of context must skip caches and replicas
+func fullyConsistent(context map[string]string) bool {
+	return context[contextKeyConsistency] == ConsistencyFullyConsistent
+}
+
+// CheckPermissionWithConsistency checks a permission like CheckPermission at a consistency level,
+// ConsistencyFullyConsistent e.g. right after granting a role, when a check served from the cache
+// or a lagging replica could still deny it
+func (s *IAMService) CheckPermissionWithConsistency(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	consistency string,
+	context map[string]string,
+) (bool, string, error) {
+	scoped, err := withConsistency(context, consistency)
+	if err != nil {
+		return false, "", err
+	}
+	return s.evaluator.CheckPermission(principal, resourceID, permission, s.withRequestMetadata(scoped))
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithConsistency(t *testing.T) {
+	context, err := withConsistency(map[string]string{"ticket": "OPS-1", contextKeyConsistency: ConsistencyFullyConsistent}, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ticket": "OPS-1"}, context, "callers cannot supply the consistency key")
+	assert.False(t, fullyConsistent(context))
+
+	context, err = withConsistency(nil, ConsistencyMinimizeLatency)
+	require.NoError(t, err)
+	assert.False(t, fullyConsistent(context))
+
+	context, err = withConsistency(nil, ConsistencyFullyConsistent)
+	require.NoError(t, err)
+	assert.True(t, fullyConsistent(context))
+
+	_, err = withConsistency(nil, "eventually")
+	assert.ErrorContains(t, err, "consistency must be")
+}
+
+// Test: A fully consistent check skips the cached decision and reads the primary
+func TestCheckPermission_FullyConsistent(t *testing.T) {
+	replicaResources, replicaPolicies := new(MockResourceRepository), new(MockPolicyRepository)
+	primaryResources, primaryPolicies := new(MockResourceRepository), new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(replicaResources, replicaPolicies, new(MockPermissionRepository), NewTestMemoryCache(),
+		WithPrimaryReads(primaryResources, primaryPolicies))
+
+	resourceID, roleID := uuid.New(), uuid.New()
+	resource := &domain.Resource{ID: resourceID, Type: "bucket", Name: "test-bucket"}
+	role := &domain.Role{ID: roleID, Name: "roles/storage.viewer", Permissions: []domain.Permission{{ID: uuid.New(), Name: "storage.objects.read"}}}
+	granted := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Bindings: []domain.Binding{
+		{ID: uuid.New(), RoleID: roleID, Role: role, Members: toJSON([]string{"user:alice@example.com"})},
+	}}
+	// The binding was revoked on the primary and the replica lags behind
+	revoked := &domain.Policy{ID: granted.ID, ResourceID: resourceID}
+
+	replicaResources.On("GetByID", resourceID).Return(resource, nil).Once()
+	replicaResources.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil).Once()
+	replicaPolicies.On("GetByResourceID", resourceID).Return(granted, nil).Once()
+	primaryResources.On("GetByID", resourceID).Return(resource, nil)
+	primaryResources.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	primaryPolicies.On("GetByResourceID", resourceID).Return(revoked, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Contains(t, reason, "cached")
+
+	consistent, err := withConsistency(nil, ConsistencyFullyConsistent)
+	require.NoError(t, err)
+	allowed, reason, err = evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", consistent)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.NotContains(t, reason, "cached")
+
+	replicaResources.AssertExpectations(t)
+	replicaPolicies.AssertExpectations(t)
+	primaryPolicies.AssertCalled(t, "GetByResourceID", resourceID)
+
+	// The fully consistent denial evicted the cached grant, and the replica caught up
+	replicaResources.On("GetByID", resourceID).Return(resource, nil).Once()
+	replicaResources.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil).Once()
+	replicaPolicies.On("GetByResourceID", resourceID).Return(revoked, nil).Once()
+	allowed, reason, err = evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.NotContains(t, reason, "cached")
+}
+
+func TestIAMService_CheckPermissionWithConsistency(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	evaluator := service.evaluator.(*MockPermissionEvaluator)
+
+	resourceID := uuid.New()
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get",
+		map[string]string{"ticket": "OPS-1", contextKeyConsistency: ConsistencyFullyConsistent}).
+		Return(true, "Permission granted", nil)
+
+	allowed, _, err := service.CheckPermissionWithConsistency("user:alice@example.com", resourceID, "storage.buckets.get",
+		ConsistencyFullyConsistent, map[string]string{"ticket": "OPS-1"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, _, err = service.CheckPermissionWithConsistency("user:alice@example.com", resourceID, "storage.buckets.get", "strong", nil)
+	assert.Error(t, err)
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 1)
+}
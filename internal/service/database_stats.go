@@ -0,0 +1,28 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrDatabaseStatsUnavailable is returned by GetDatabaseStats when no connection pool reports them
+var ErrDatabaseStatsUnavailable = errors.New("database statistics are not available")
+
+// SetDatabaseStats enables GetDatabaseStats with the function returning the statistics of the
+// connection pools by name, e.g. Database.PoolStats. It must be called before the service starts
+// handling requests.
+func (s *IAMService) SetDatabaseStats(poolStats func() map[string]sql.DBStats) {
+	s.poolStats = poolStats
+}
+
+// GetDatabaseStats returns the statistics of the database connection pools by name: connections
+// open, in use and idle, and how often and how long queries waited for a connection
+func (s *IAMService) GetDatabaseStats() (map[string]sql.DBStats, error) {
+	if err := s.authorize("GetDatabaseStats", nil); err != nil {
+		return nil, err
+	}
+	if s.poolStats == nil {
+		return nil, ErrDatabaseStatsUnavailable
+	}
+	return s.poolStats(), nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_GetDatabaseStats(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.GetDatabaseStats()
+	assert.ErrorIs(t, err, ErrDatabaseStatsUnavailable)
+
+	service.SetDatabaseStats(func() map[string]sql.DBStats {
+		return map[string]sql.DBStats{"primary": {OpenConnections: 3, InUse: 1, Idle: 2, WaitCount: 7}}
+	})
+	stats, err := service.GetDatabaseStats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats["primary"].InUse)
+	assert.Equal(t, int64(7), stats["primary"].WaitCount)
+}
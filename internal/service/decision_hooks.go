@@ -0,0 +1,351 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+// CheckRequest is a permission check as seen by decision hooks. Hooks may only change Context.
+type CheckRequest struct {
+	Principal  string
+	ResourceID uuid.UUID
+	Permission string
+	Context    map[string]string // A copy hooks may change, e.g. to derive values for conditions
+}
+
+// DecisionHook runs around the evaluation of every data-plane permission check. Hooks run in
+// the configured order before a check and in reverse order after it. GetEffectivePermissions
+// lists grants rather than deciding a check, so it does not run hooks.
+type DecisionHook interface {
+	// BeforeCheck runs before the check is evaluated and may change its context. A non-nil
+	// result decides the check without evaluating it or running later hooks, e.g. to deny
+	// callers outside an IP allowlist; an error fails the check.
+	BeforeCheck(req *CheckRequest) (*CheckResult, error)
+	// AfterCheck returns the result to use for a decided check, e.g. to veto an allowed check
+	AfterCheck(req *CheckRequest, result CheckResult) CheckResult
+}
+
+// DecisionHookFactory creates a hook from the options of its evaluator.hooks entry
+type DecisionHookFactory func(options map[string]string) (DecisionHook, error)
+
+var (
+	decisionHookFactoriesMu sync.RWMutex
+	decisionHookFactories   = map[string]DecisionHookFactory{
+		"ip_allowlist": newIPAllowlistHook,
+	}
+)
+
+// RegisterDecisionHook makes a hook available to evaluator.hooks under name. Deployments call it
+// from an init function of a package linked into their build of the server. It panics when name
+// is already registered.
+func RegisterDecisionHook(name string, factory DecisionHookFactory) {
+	decisionHookFactoriesMu.Lock()
+	defer decisionHookFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("service: RegisterDecisionHook factory is nil")
+	}
+	if _, dup := decisionHookFactories[name]; dup {
+		panic("service: RegisterDecisionHook called twice for hook " + name)
+	}
+	decisionHookFactories[name] = factory
+}
+
+// DecisionHookNames returns the names of the registered decision hooks, sorted
+func DecisionHookNames() []string {
+	decisionHookFactoriesMu.RLock()
+	defer decisionHookFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(decisionHookFactories))
+	for name := range decisionHookFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDecisionHooks creates the hooks of evaluator.hooks, in order
+func NewDecisionHooks(cfgs []config.DecisionHookConfig) ([]DecisionHook, error) {
+	hooks := make([]DecisionHook, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		decisionHookFactoriesMu.RLock()
+		factory, ok := decisionHookFactories[cfg.Name]
+		decisionHookFactoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown decision hook %q (registered: %s)", cfg.Name, strings.Join(DecisionHookNames(), ", "))
+		}
+
+		hook, err := factory(cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("decision hook %q: %w", cfg.Name, err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// hookedEvaluator runs decision hooks around every check
+type hookedEvaluator struct {
+	PermissionEvaluator
+	hooks []DecisionHook
+}
+
+// NewHookedEvaluator wraps evaluator so every check runs through hooks. It returns evaluator
+// unchanged without hooks.
+func NewHookedEvaluator(evaluator PermissionEvaluator, hooks ...DecisionHook) PermissionEvaluator {
+	if len(hooks) == 0 {
+		return evaluator
+	}
+	return &hookedEvaluator{
+		PermissionEvaluator: evaluator,
+		hooks:               hooks,
+	}
+}
+
+// before runs the BeforeCheck hooks of a check. It returns the number of hooks that ran, so
+// only those run after the check, and the result of the hook that decided it, if any.
+func (he *hookedEvaluator) before(req *CheckRequest) (int, *CheckResult, error) {
+	for i, hook := range he.hooks {
+		decided, err := hook.BeforeCheck(req)
+		if err != nil {
+			return i + 1, nil, err
+		}
+		if decided != nil {
+			return i + 1, decided, nil
+		}
+	}
+	return len(he.hooks), nil, nil
+}
+
+// after runs the AfterCheck hooks of the first ran hooks, in reverse order
+func (he *hookedEvaluator) after(req *CheckRequest, ran int, result CheckResult) CheckResult {
+	for i := ran - 1; i >= 0; i-- {
+		result = he.hooks[i].AfterCheck(req, result)
+	}
+	return result
+}
+
+func (he *hookedEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(he.Check(principal, resourceID, permission, context))
+}
+
+func (he *hookedEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	req := &CheckRequest{Principal: principal, ResourceID: resourceID, Permission: permission, Context: maps.Clone(context)}
+	ran, decided, err := he.before(req)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	if decided != nil {
+		return he.after(req, ran, *decided), nil
+	}
+
+	result, err := he.PermissionEvaluator.Check(principal, resourceID, permission, req.Context)
+	if err != nil {
+		return result, err
+	}
+	return he.after(req, ran, result), nil
+}
+
+// BatchCheckPermissions runs the hooks of each check; the checks no hook decided are evaluated
+// in one batch
+func (he *hookedEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	reqs := make([]*CheckRequest, len(checks))
+	ran := make([]int, len(checks))
+	results := make([]CheckResult, len(checks))
+	var pending []PermissionCheck
+	var pendingIdx []int
+	for i, check := range checks {
+		reqs[i] = &CheckRequest{Principal: principal, ResourceID: check.ResourceID, Permission: check.Permission, Context: maps.Clone(check.Context)}
+		n, decided, err := he.before(reqs[i])
+		if err != nil {
+			return nil, err
+		}
+		ran[i] = n
+		if decided != nil {
+			results[i] = *decided
+			continue
+		}
+		pending = append(pending, PermissionCheck{ResourceID: check.ResourceID, Permission: check.Permission, Context: reqs[i].Context})
+		pendingIdx = append(pendingIdx, i)
+	}
+
+	if len(pending) > 0 {
+		evaluated, err := he.PermissionEvaluator.BatchCheckPermissions(principal, pending)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range pendingIdx {
+			results[i] = evaluated[j]
+		}
+	}
+
+	for i := range results {
+		results[i] = he.after(reqs[i], ran[i], results[i])
+	}
+	return results, nil
+}
+
+// CheckPermissionForPrincipals runs the hooks of each principal's check; the checks no hook
+// decided are evaluated together
+func (he *hookedEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	reqs := make([]*CheckRequest, len(principals))
+	ran := make([]int, len(principals))
+	results := make([]CheckResult, len(principals))
+	var pending []string
+	var pendingIdx []int
+	for i, principal := range principals {
+		reqs[i] = &CheckRequest{Principal: principal, ResourceID: resourceID, Permission: permission, Context: maps.Clone(context)}
+		n, decided, err := he.before(reqs[i])
+		if err != nil {
+			return nil, err
+		}
+		ran[i] = n
+		if decided != nil {
+			results[i] = *decided
+			continue
+		}
+		pending = append(pending, principal)
+		pendingIdx = append(pendingIdx, i)
+	}
+
+	// Hooks may rewrite the context of each check, so the principals are only evaluated together
+	// when their contexts are still the same
+	if len(pending) > 0 {
+		shared := true
+		for _, i := range pendingIdx {
+			shared = shared && maps.Equal(reqs[i].Context, reqs[pendingIdx[0]].Context)
+		}
+		if shared {
+			evaluated, err := he.PermissionEvaluator.CheckPermissionForPrincipals(pending, resourceID, permission, reqs[pendingIdx[0]].Context)
+			if err != nil {
+				return nil, err
+			}
+			for j, i := range pendingIdx {
+				results[i] = evaluated[j]
+			}
+		} else {
+			for _, i := range pendingIdx {
+				result, err := he.PermissionEvaluator.Check(principals[i], resourceID, permission, reqs[i].Context)
+				if err != nil {
+					return nil, err
+				}
+				results[i] = result
+			}
+		}
+	}
+
+	for i := range results {
+		results[i] = he.after(reqs[i], ran[i], results[i])
+	}
+	return results, nil
+}
+
+// TestPermissions checks each permission as a batch, so hooks decide every permission
+func (he *hookedEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	if len(permissions) == 0 {
+		return []string{}, nil
+	}
+
+	checks := make([]PermissionCheck, len(permissions))
+	for i, permission := range permissions {
+		checks[i] = PermissionCheck{ResourceID: resourceID, Permission: permission, Context: context}
+	}
+	results, err := he.BatchCheckPermissions(principal, checks)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make([]string, 0, len(permissions))
+	for i, result := range results {
+		if result.Allowed {
+			granted = append(granted, permissions[i])
+		}
+	}
+	return granted, nil
+}
+
+// ipAllowlistHook denies checks whose caller IP (request.ip) is outside a set of networks
+type ipAllowlistHook struct {
+	prefixes     []netip.Prefix
+	allowMissing bool
+}
+
+// newIPAllowlistHook creates the ip_allowlist hook. Options: "cidrs", a comma-separated list of
+// networks, and "allow_missing" ("true" to evaluate checks without request.ip normally).
+func newIPAllowlistHook(options map[string]string) (DecisionHook, error) {
+	hook := &ipAllowlistHook{}
+	for _, cidr := range strings.Split(options["cidrs"], ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+		}
+		hook.prefixes = append(hook.prefixes, prefix.Masked())
+	}
+	if len(hook.prefixes) == 0 {
+		return nil, fmt.Errorf("cidrs is required")
+	}
+
+	switch options["allow_missing"] {
+	case "", "false":
+	case "true":
+		hook.allowMissing = true
+	default:
+		return nil, fmt.Errorf("invalid allow_missing %q (valid: true, false)", options["allow_missing"])
+	}
+	return hook, nil
+}
+
+func (h *ipAllowlistHook) BeforeCheck(req *CheckRequest) (*CheckResult, error) {
+	ip := req.Context[ContextKeyCallerIP]
+	if ip == "" {
+		if h.allowMissing {
+			return nil, nil
+		}
+		return &CheckResult{Allowed: false, Reason: "denied by ip_allowlist: request.ip is required"}, nil
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err == nil {
+		addr = addr.Unmap()
+		for _, prefix := range h.prefixes {
+			if prefix.Contains(addr) {
+				return nil, nil
+			}
+		}
+	}
+	return &CheckResult{Allowed: false, Reason: fmt.Sprintf("denied by ip_allowlist: %s is not an allowed network", ip)}, nil
+}
+
+func (h *ipAllowlistHook) AfterCheck(_ *CheckRequest, result CheckResult) CheckResult {
+	return result
+}
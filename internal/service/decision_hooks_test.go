@@ -0,0 +1,183 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcHook is a DecisionHook made of functions; nil functions do nothing
+type funcHook struct {
+	before func(req *CheckRequest) (*CheckResult, error)
+	after  func(req *CheckRequest, result CheckResult) CheckResult
+}
+
+func (h funcHook) BeforeCheck(req *CheckRequest) (*CheckResult, error) {
+	if h.before == nil {
+		return nil, nil
+	}
+	return h.before(req)
+}
+
+func (h funcHook) AfterCheck(req *CheckRequest, result CheckResult) CheckResult {
+	if h.after == nil {
+		return result
+	}
+	return h.after(req, result)
+}
+
+func TestHookedEvaluator_Check(t *testing.T) {
+	inner := new(MockPermissionEvaluator)
+	resourceID, lockedID := uuid.New(), uuid.New()
+
+	var order []string
+	derive := funcHook{
+		before: func(req *CheckRequest) (*CheckResult, error) {
+			order = append(order, "derive")
+			req.Context["department"] = "storage"
+			return nil, nil
+		},
+		after: func(_ *CheckRequest, result CheckResult) CheckResult {
+			order = append(order, "derive after")
+			return result
+		},
+	}
+	veto := funcHook{
+		after: func(req *CheckRequest, result CheckResult) CheckResult {
+			order = append(order, "veto after")
+			if req.ResourceID == lockedID {
+				return CheckResult{Allowed: false, Reason: "resource is locked"}
+			}
+			return result
+		},
+	}
+	evaluator := NewHookedEvaluator(inner, derive, veto)
+
+	context := map[string]string{"request.ip": "10.0.0.1"}
+	derived := map[string]string{"request.ip": "10.0.0.1", "department": "storage"}
+	inner.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", derived).Return(true, "granted", nil)
+	inner.On("CheckPermission", "user:alice@example.com", lockedID, "storage.buckets.get", derived).Return(true, "granted", nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", context)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, []string{"derive", "veto after", "derive after"}, order)
+	assert.Len(t, context, 1, "the caller's context is not changed")
+
+	allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", lockedID, "storage.buckets.get", context)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, "resource is locked", reason)
+
+	assert.Same(t, inner, NewHookedEvaluator(inner))
+}
+
+func TestHookedEvaluator_BatchCheckPermissions(t *testing.T) {
+	inner := new(MockPermissionEvaluator)
+	allowlist, err := newIPAllowlistHook(map[string]string{"cidrs": "10.0.0.0/8"})
+	require.NoError(t, err)
+	evaluator := NewHookedEvaluator(inner, allowlist)
+
+	resourceID := uuid.New()
+	internal := map[string]string{"request.ip": "10.1.2.3"}
+	external := map[string]string{"request.ip": "203.0.113.7"}
+	// Only the check the hook did not decide is evaluated
+	inner.On("BatchCheckPermissions", "user:alice@example.com", []PermissionCheck{
+		{ResourceID: resourceID, Permission: "storage.buckets.get", Context: internal},
+	}).Return([]CheckResult{{Allowed: true}}, nil)
+
+	results, err := evaluator.BatchCheckPermissions("user:alice@example.com", []PermissionCheck{
+		{ResourceID: resourceID, Permission: "storage.buckets.delete", Context: external},
+		{ResourceID: resourceID, Permission: "storage.buckets.get", Context: internal},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.False(t, results[0].Allowed)
+	assert.Contains(t, results[0].Reason, "ip_allowlist")
+	assert.True(t, results[1].Allowed)
+
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"storage.buckets.get"}, external)
+	require.NoError(t, err)
+	assert.Empty(t, granted)
+	inner.AssertNumberOfCalls(t, "BatchCheckPermissions", 1)
+}
+
+func TestHookedEvaluator_CheckPermissionForPrincipals(t *testing.T) {
+	inner := new(MockPermissionEvaluator)
+	denyBob := funcHook{before: func(req *CheckRequest) (*CheckResult, error) {
+		if req.Principal == "user:bob@example.com" {
+			return &CheckResult{Reason: "bob is suspended"}, nil
+		}
+		return nil, nil
+	}}
+	evaluator := NewHookedEvaluator(inner, denyBob)
+
+	// Only the principals the hook did not decide are evaluated, together
+	resourceID := uuid.New()
+	inner.On("CheckPermissionForPrincipals", []string{"user:alice@example.com", "user:carol@example.com"}, resourceID,
+		"docs.documents.edit", map[string]string{"team": "docs"}).Return([]CheckResult{{Allowed: true}, {Allowed: false}}, nil).Once()
+
+	results, err := evaluator.CheckPermissionForPrincipals(
+		[]string{"user:alice@example.com", "user:bob@example.com", "user:carol@example.com"},
+		resourceID, "docs.documents.edit", map[string]string{"team": "docs"})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].Allowed)
+	assert.Equal(t, "bob is suspended", results[1].Reason)
+	assert.False(t, results[2].Allowed)
+	inner.AssertExpectations(t)
+}
+
+func TestIPAllowlistHook(t *testing.T) {
+	hook, err := newIPAllowlistHook(map[string]string{"cidrs": "10.0.0.0/8, 2001:db8::/32"})
+	require.NoError(t, err)
+
+	for ip, allowed := range map[string]bool{
+		"10.20.30.40":        true,
+		"::ffff:10.20.30.40": true,
+		"2001:db8::1":        true,
+		"192.168.1.1":        false,
+		"not-an-ip":          false,
+		"":                   false,
+	} {
+		decided, err := hook.BeforeCheck(&CheckRequest{Context: map[string]string{ContextKeyCallerIP: ip}})
+		require.NoError(t, err)
+		assert.Equal(t, allowed, decided == nil, "ip %q", ip)
+	}
+
+	hook, err = newIPAllowlistHook(map[string]string{"cidrs": "10.0.0.0/8", "allow_missing": "true"})
+	require.NoError(t, err)
+	decided, err := hook.BeforeCheck(&CheckRequest{})
+	require.NoError(t, err)
+	assert.Nil(t, decided)
+
+	_, err = newIPAllowlistHook(map[string]string{})
+	assert.ErrorContains(t, err, "cidrs is required")
+	_, err = newIPAllowlistHook(map[string]string{"cidrs": "10.0.0.0/33"})
+	assert.ErrorContains(t, err, "invalid cidr")
+	_, err = newIPAllowlistHook(map[string]string{"cidrs": "10.0.0.0/8", "allow_missing": "yes"})
+	assert.ErrorContains(t, err, "invalid allow_missing")
+}
+
+func TestNewDecisionHooks(t *testing.T) {
+	RegisterDecisionHook("test_noop", func(map[string]string) (DecisionHook, error) { return funcHook{}, nil })
+	assert.Panics(t, func() {
+		RegisterDecisionHook("test_noop", func(map[string]string) (DecisionHook, error) { return funcHook{}, nil })
+	})
+	assert.Contains(t, DecisionHookNames(), "ip_allowlist")
+
+	hooks, err := NewDecisionHooks([]config.DecisionHookConfig{
+		{Name: "ip_allowlist", Options: map[string]string{"cidrs": "10.0.0.0/8"}},
+		{Name: "test_noop"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, hooks, 2)
+
+	_, err = NewDecisionHooks([]config.DecisionHookConfig{{Name: "missing"}})
+	assert.ErrorContains(t, err, `unknown decision hook "missing"`)
+	_, err = NewDecisionHooks([]config.DecisionHookConfig{{Name: "ip_allowlist"}})
+	assert.ErrorContains(t, err, `decision hook "ip_allowlist": cidrs is required`)
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// DecisionSink persists batches of decision log entries.
+// Write is only called from the DecisionLogger's background goroutine.
+type DecisionSink interface {
+	Write(entries []domain.DecisionLog) error
+	Close() error
+}
+
+// NewDecisionSink creates the sink selected by cfg.Sink ("db" or "file").
+// Other backends (e.g. a message queue) can implement DecisionSink and be passed to NewDecisionLogger directly.
+func NewDecisionSink(cfg *config.DecisionLogConfig, repo repository.DecisionLogRepository) (DecisionSink, error) {
+	switch strings.ToLower(cfg.Sink) {
+	case "db", "":
+		return NewRepositoryDecisionSink(repo), nil
+	case "file":
+		sink, err := NewFileDecisionSink(cfg.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create decision log file sink: %w", err)
+		}
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown decision log sink: %s (valid: db, file)", cfg.Sink)
+	}
+}
+
+// repositorySink writes decisions to the decision_logs table
+type repositorySink struct {
+	repo repository.DecisionLogRepository
+}
+
+// NewRepositoryDecisionSink creates a sink storing decisions in the database
+func NewRepositoryDecisionSink(repo repository.DecisionLogRepository) DecisionSink {
+	return &repositorySink{repo: repo}
+}
+
+func (s *repositorySink) Write(entries []domain.DecisionLog) error {
+	return s.repo.CreateBatch(entries)
+}
+
+func (s *repositorySink) Close() error {
+	return nil
+}
+
+// fileSink appends decisions to a file as JSON lines
+type fileSink struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileDecisionSink creates a sink appending one JSON object per decision to path
+func NewFileDecisionSink(path string) (DecisionSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("decision log file path is required")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *fileSink) Write(entries []domain.DecisionLog) error {
+	for i := range entries {
+		if err := s.enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// DecisionLogger records permission check decisions asynchronously.
+// Entries are buffered and written to the sink in batches by a background goroutine;
+// when the buffer is full new entries are dropped rather than slowing down checks.
+type DecisionLogger struct {
+	sink          DecisionSink
+	sampleRate    atomic.Uint64 // math.Float64bits of the sample rate
+	batchSize     int
+	flushInterval time.Duration
+	logger        *slog.Logger
+	sample        func() float64
+
+	entries   chan domain.DecisionLog
+	dropped   atomic.Int64
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDecisionLogger creates a decision logger writing to sink and starts its background writer.
+// A nil logger uses slog.Default().
+func NewDecisionLogger(cfg *config.DecisionLogConfig, sink DecisionSink, logger *slog.Logger) *DecisionLogger {
+	l := &DecisionLogger{
+		sink:          sink,
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		logger:        logger,
+		sample:        rand.Float64,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	l.SetSampleRate(cfg.SampleRate)
+
+	if l.logger == nil {
+		l.logger = slog.Default()
+	}
+	if l.batchSize <= 0 {
+		l.batchSize = 100
+	}
+	if l.flushInterval <= 0 {
+		l.flushInterval = time.Second
+	}
+
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	l.entries = make(chan domain.DecisionLog, bufferSize)
+
+	go l.run()
+	return l
+}
+
+// Record queues a decision. Denied and failed checks are always recorded;
+// allowed checks are sampled at the configured rate.
+func (l *DecisionLogger) Record(entry domain.DecisionLog) {
+	if entry.Allowed && entry.Error == "" {
+		if rate := math.Float64frombits(l.sampleRate.Load()); rate < 1 && l.sample() >= rate {
+			return
+		}
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+		if l.dropped.Add(1) == 1 {
+			l.logger.Warn("Decision log buffer full; dropping entries")
+		}
+	}
+}
+
+// SetSampleRate changes the fraction of allowed checks recorded
+func (l *DecisionLogger) SetSampleRate(rate float64) {
+	l.sampleRate.Store(math.Float64bits(rate))
+}
+
+// Dropped returns the number of entries dropped because the buffer was full
+func (l *DecisionLogger) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close flushes buffered entries and closes the sink
+func (l *DecisionLogger) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		err = l.sink.Close()
+		if dropped := l.Dropped(); dropped > 0 {
+			l.logger.Warn("Decision log entries dropped", "count", dropped)
+		}
+	})
+	return err
+}
+
+func (l *DecisionLogger) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]domain.DecisionLog, 0, l.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := l.sink.Write(batch); err != nil {
+			l.logger.Error("Failed to write decision log", "entries", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+	add := func(entry domain.DecisionLog) {
+		batch = append(batch, entry)
+		if len(batch) >= l.batchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case entry := <-l.entries:
+			add(entry)
+		case <-ticker.C:
+			flush()
+		case <-l.stop:
+			for {
+				select {
+				case entry := <-l.entries:
+					add(entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// decisionLoggingEvaluator records every CheckPermission call and batched check in a DecisionLogger
+type decisionLoggingEvaluator struct {
+	PermissionEvaluator
+	log *DecisionLogger
+}
+
+// NewDecisionLoggingEvaluator wraps evaluator so every permission check is written to the decision log
+func NewDecisionLoggingEvaluator(evaluator PermissionEvaluator, log *DecisionLogger) PermissionEvaluator {
+	return &decisionLoggingEvaluator{
+		PermissionEvaluator: evaluator,
+		log:                 log,
+	}
+}
+
+func (de *decisionLoggingEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(de.Check(principal, resourceID, permission, context))
+}
+
+func (de *decisionLoggingEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	start := time.Now()
+	result, err := de.PermissionEvaluator.Check(principal, resourceID, permission, context)
+
+	entry := domain.DecisionLog{
+		Principal:  principal,
+		ResourceID: resourceID,
+		Permission: permission,
+		Allowed:    result.Allowed,
+		Reason:     result.Reason,
+		Role:       result.Role,
+		LatencyUS:  time.Since(start).Microseconds(),
+		RequestID:  context[contextKeyRequestID],
+		Service:    context[contextKeyCallerService],
+		CreatedAt:  start,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	de.log.Record(entry)
+
+	return result, err
+}
+
+func (de *decisionLoggingEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	start := time.Now()
+	results, err := de.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+
+	// The batch shares its loads, so each check is logged with the average latency
+	var latency int64
+	if len(checks) > 0 {
+		latency = time.Since(start).Microseconds() / int64(len(checks))
+	}
+	for i, check := range checks {
+		entry := domain.DecisionLog{
+			Principal:  principal,
+			ResourceID: check.ResourceID,
+			Permission: check.Permission,
+			LatencyUS:  latency,
+			RequestID:  check.Context[contextKeyRequestID],
+			Service:    check.Context[contextKeyCallerService],
+			CreatedAt:  start,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Allowed = results[i].Allowed
+			entry.Reason = results[i].Reason
+			entry.Role = results[i].Role
+		}
+		de.log.Record(entry)
+	}
+
+	return results, err
+}
+
+func (de *decisionLoggingEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	start := time.Now()
+	results, err := de.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+
+	// The checks share their loads, so each is logged with the average latency
+	var latency int64
+	if len(principals) > 0 {
+		latency = time.Since(start).Microseconds() / int64(len(principals))
+	}
+	for i, principal := range principals {
+		entry := domain.DecisionLog{
+			Principal:  principal,
+			ResourceID: resourceID,
+			Permission: permission,
+			LatencyUS:  latency,
+			RequestID:  context[contextKeyRequestID],
+			Service:    context[contextKeyCallerService],
+			CreatedAt:  start,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Allowed = results[i].Allowed
+			entry.Reason = results[i].Reason
+			entry.Role = results[i].Role
+		}
+		de.log.Record(entry)
+	}
+
+	return results, err
+}
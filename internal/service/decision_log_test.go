@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink collects written decisions
+type memorySink struct {
+	mu      sync.Mutex
+	entries []domain.DecisionLog
+	closed  bool
+}
+
+func (s *memorySink) Write(entries []domain.DecisionLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestDecisionLoggingEvaluator_RecordsChecks(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	sink := &memorySink{}
+	decisions := NewDecisionLogger(&config.DecisionLogConfig{SampleRate: 1}, sink, nil)
+	logged := NewDecisionLoggingEvaluator(evaluator, decisions)
+
+	resourceID := uuid.New()
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", mock.Anything).
+		Return(true, "granted", nil)
+	evaluator.On("CheckPermission", "user:bob@example.com", resourceID, "storage.buckets.get", mock.Anything).
+		Return(false, "Error fetching policy", errors.New("db down"))
+
+	allowed, _, err := logged.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	_, _, err = logged.CheckPermission("user:bob@example.com", resourceID, "storage.buckets.get", nil)
+	assert.Error(t, err)
+
+	require.NoError(t, decisions.Close())
+	assert.True(t, sink.closed)
+	require.Len(t, sink.entries, 2)
+	assert.Equal(t, "user:alice@example.com", sink.entries[0].Principal)
+	assert.True(t, sink.entries[0].Allowed)
+	assert.Equal(t, "granted", sink.entries[0].Reason)
+	assert.Equal(t, resourceID, sink.entries[0].ResourceID)
+	assert.False(t, sink.entries[0].CreatedAt.IsZero())
+	assert.False(t, sink.entries[1].Allowed)
+	assert.Equal(t, "db down", sink.entries[1].Error)
+}
+
+func TestDecisionLoggingEvaluator_RecordsBatchChecks(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	sink := &memorySink{}
+	decisions := NewDecisionLogger(&config.DecisionLogConfig{SampleRate: 1}, sink, nil)
+	logged := NewDecisionLoggingEvaluator(evaluator, decisions)
+
+	checks := []PermissionCheck{
+		{ResourceID: uuid.New(), Permission: "storage.buckets.get"},
+		{ResourceID: uuid.New(), Permission: "storage.buckets.delete"},
+	}
+	evaluator.On("BatchCheckPermissions", "user:alice@example.com", checks).
+		Return([]CheckResult{{Allowed: true, Reason: "granted", Role: "roles/viewer"}, {Reason: "denied"}}, nil)
+
+	results, err := logged.BatchCheckPermissions("user:alice@example.com", checks)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	require.NoError(t, decisions.Close())
+	require.Len(t, sink.entries, 2)
+	assert.Equal(t, checks[0].ResourceID, sink.entries[0].ResourceID)
+	assert.True(t, sink.entries[0].Allowed)
+	assert.Equal(t, "roles/viewer", sink.entries[0].Role)
+	assert.Equal(t, "storage.buckets.delete", sink.entries[1].Permission)
+	assert.False(t, sink.entries[1].Allowed)
+	assert.Equal(t, "denied", sink.entries[1].Reason)
+}
+
+// Test: Checks served from the cache are logged with the role that granted them
+func TestDecisionLoggingEvaluator_RecordsCachedRole(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+	sink := &memorySink{}
+	decisions := NewDecisionLogger(&config.DecisionLogConfig{SampleRate: 1}, sink, nil)
+	logged := NewDecisionLoggingEvaluator(NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache), decisions)
+
+	resourceID := uuid.New()
+	admin := testRole("roles/storage.admin", "storage.buckets.get")
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket"}, nil).Once()
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil).Once()
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ResourceID: resourceID, Bindings: []domain.Binding{
+		testBinding(&admin, "user:alice@example.com"),
+	}}, nil).Once()
+
+	for range 2 {
+		allowed, _, err := logged.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	require.NoError(t, decisions.Close())
+	require.Len(t, sink.entries, 2)
+	assert.Equal(t, fmt.Sprintf(grantedViaRoleReason, "roles/storage.admin", resourceID), sink.entries[0].Reason)
+	assert.Equal(t, "Permission granted (cached)", sink.entries[1].Reason)
+	for _, entry := range sink.entries {
+		assert.Equal(t, "roles/storage.admin", entry.Role)
+	}
+}
+
+func TestDecisionLogger_SamplesAllowedOnly(t *testing.T) {
+	sink := &memorySink{}
+	decisions := NewDecisionLogger(&config.DecisionLogConfig{SampleRate: 0.5}, sink, nil)
+	decisions.sample = func() float64 { return 0.9 }
+
+	decisions.Record(domain.DecisionLog{Principal: "user:alice@example.com", Allowed: true})
+	decisions.Record(domain.DecisionLog{Principal: "user:bob@example.com", Allowed: false})
+	decisions.Record(domain.DecisionLog{Principal: "user:carol@example.com", Allowed: true, Error: "boom"})
+
+	require.NoError(t, decisions.Close())
+	require.Len(t, sink.entries, 2)
+	assert.Equal(t, "user:bob@example.com", sink.entries[0].Principal)
+	assert.Equal(t, "user:carol@example.com", sink.entries[1].Principal)
+}
+
+func TestDecisionLogger_DropsWhenBufferFull(t *testing.T) {
+	sink := &memorySink{}
+	decisions := &DecisionLogger{
+		sink:    sink,
+		logger:  slog.Default(),
+		entries: make(chan domain.DecisionLog, 1),
+	}
+
+	decisions.Record(domain.DecisionLog{Principal: "user:alice@example.com"})
+	decisions.Record(domain.DecisionLog{Principal: "user:bob@example.com"})
+
+	assert.Equal(t, int64(1), decisions.Dropped())
+}
+
+func TestFileDecisionSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	sink, err := NewDecisionSink(&config.DecisionLogConfig{Sink: "file", FilePath: path}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write([]domain.DecisionLog{
+		{Principal: "user:alice@example.com", Permission: "storage.buckets.get", Allowed: true},
+		{Principal: "user:bob@example.com", Permission: "storage.buckets.get"},
+	}))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var lines []domain.DecisionLog
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry domain.DecisionLog
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		lines = append(lines, entry)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "user:bob@example.com", lines[1].Principal)
+}
+
+func TestNewDecisionSink_Invalid(t *testing.T) {
+	_, err := NewDecisionSink(&config.DecisionLogConfig{Sink: "kafka"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewDecisionSink(&config.DecisionLogConfig{Sink: "file"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// CreatorMember stands for the principal creating a resource in the members of a default binding
+const CreatorMember = "creator"
+
+// DefaultBinding grants a role on each new resource of a type
+type DefaultBinding struct {
+	Role    string
+	Members []string // CreatorMember is replaced by the creating principal
+}
+
+// DefaultBindings maps resource types to the bindings of the baseline policy of their new resources
+type DefaultBindings map[string][]DefaultBinding
+
+// SetDefaultBindings configures the baseline policy CreateResource gives new resources of each type.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetDefaultBindings(bindings DefaultBindings) {
+	s.defaultBindings = bindings
+}
+
+// baselinePolicy builds the policy of a new resource from the default bindings of its type; nil
+// when none apply. Bindings granting the creator only are left out when there is no creator.
+// Roles must exist and be bindable on the resource, as for any binding, but the grants are not
+// authorized against the creator: they are the operator's.
+func (s *IAMService) baselinePolicy(resource *domain.Resource, creator string) (*domain.Policy, error) {
+	defaults := s.defaultBindings[resource.Type]
+	if len(defaults) == 0 {
+		return nil, nil
+	}
+
+	var scopes map[uuid.UUID]bool
+	var bindings []domain.Binding
+	for i, binding := range defaults {
+		members := make([]string, 0, len(binding.Members))
+		for _, member := range binding.Members {
+			if member == CreatorMember {
+				member = creator
+			}
+			if member != "" {
+				members = append(members, member)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		role, err := s.roleRepo.GetByName(binding.Role)
+		if err != nil {
+			return nil, fmt.Errorf("default binding %d: failed to get role: %w", i, err)
+		}
+		if role == nil {
+			return nil, fmt.Errorf("default binding %d: role %s not found", i, binding.Role)
+		}
+		if !s.attachmentRules.Allows(role.Name, resource.Type) {
+			return nil, fmt.Errorf("default binding %d: %w: role %s may only be bound on %s resources, not %s",
+				i, ErrRoleNotAttachable, role.Name, s.attachmentRules.describe(role.Name), resource.Type)
+		}
+		if role.ScopeResourceID != nil {
+			// The new resource is in the scopes of its parent and the parent's ancestors
+			if scopes == nil && resource.ParentID != nil {
+				if scopes, err = s.resourceScopes(*resource.ParentID); err != nil {
+					return nil, err
+				}
+			}
+			if !scopes[*role.ScopeResourceID] {
+				return nil, fmt.Errorf("default binding %d: %w: role %s is scoped to resource %s",
+					i, ErrRoleOutOfScope, role.Name, *role.ScopeResourceID)
+			}
+		}
+
+		encoded, err := membersJSON(members)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, domain.Binding{RoleID: role.ID, Members: encoded, CreatedBy: creator, UpdatedBy: creator})
+	}
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+
+	bindings, err := normalizeBindings(bindings)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Policy{Version: 1, Bindings: bindings, CreatedBy: creator, UpdatedBy: creator}, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_CreateResource_DefaultBindings(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	owner := testRole("roles/owner", "resourcemanager.projects.delete")
+	viewer := testRole("roles/viewer", "resourcemanager.projects.get")
+	roleRepo.On("GetByName", "roles/owner").Return(&owner, nil)
+	roleRepo.On("GetByName", "roles/viewer").Return(&viewer, nil)
+	roleRepo.On("GetByName", "roles/missing").Return(nil, nil)
+	service.SetDefaultBindings(DefaultBindings{
+		"project": {
+			{Role: "roles/owner", Members: []string{CreatorMember}},
+			{Role: "roles/viewer", Members: []string{"group:auditors@example.com", CreatorMember}},
+		},
+		"bucket": {{Role: "roles/missing", Members: []string{"group:auditors@example.com"}}},
+	})
+
+	var created *domain.Policy
+	resourceRepo.On("CreateWithPolicy", mock.AnythingOfType("*domain.Resource"), mock.AnythingOfType("*domain.Policy")).
+		Return(nil).Once().Run(func(args mock.Arguments) {
+		created = args.Get(1).(*domain.Policy)
+		created.ID = uuid.New()
+	})
+	policyRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Policy{Version: 1}, nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	_, err := service.AsCaller("user:alice@example.com").CreateResource("project", "web", nil, nil, nil, "")
+	require.NoError(t, err)
+	require.Len(t, created.Bindings, 2)
+	assert.Equal(t, owner.ID, created.Bindings[0].RoleID)
+	assert.JSONEq(t, `["user:alice@example.com"]`, string(created.Bindings[0].Members))
+	assert.JSONEq(t, `["group:auditors@example.com", "user:alice@example.com"]`, string(created.Bindings[1].Members))
+
+	// Without a creator, bindings granting only the creator are left out
+	resourceRepo.On("CreateWithPolicy", mock.AnythingOfType("*domain.Resource"), mock.AnythingOfType("*domain.Policy")).
+		Return(nil).Once().Run(func(args mock.Arguments) {
+		created = args.Get(1).(*domain.Policy)
+		created.ID = uuid.New()
+	})
+	_, err = service.CreateResource("project", "api", nil, nil, nil, "")
+	require.NoError(t, err)
+	require.Len(t, created.Bindings, 1)
+	assert.Equal(t, viewer.ID, created.Bindings[0].RoleID)
+
+	// Types without default bindings are created without a policy
+	resourceRepo.On("Create", mock.AnythingOfType("*domain.Resource")).Return(nil).Once()
+	_, err = service.CreateResource("folder", "team", nil, nil, nil, "")
+	require.NoError(t, err)
+
+	_, err = service.CreateResource("bucket", "data", nil, nil, nil, "")
+	assert.ErrorContains(t, err, "role roles/missing not found")
+	_, err = service.AsCaller("user:alice@example.com").CreateResource("project", "web", nil, nil, nil, "user:bob@example.com")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	resourceRepo.AssertExpectations(t)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+var (
+	// ErrDirectoryNotFound is returned when a provisioned user or group does not exist
+	ErrDirectoryNotFound = errors.New("not found")
+	// ErrDirectoryConflict is returned when a user name or group name is already taken
+	ErrDirectoryConflict = errors.New("already exists")
+)
+
+// DirectoryService manages users and groups provisioned from an identity provider.
+// Group membership changes take effect immediately: the permission cache is cleared
+// and bindings granted to a group apply to its active members.
+type DirectoryService struct {
+	users  repository.UserRepository
+	groups repository.GroupRepository
+	cache  CacheService
+}
+
+// NewDirectoryService creates a new directory service
+func NewDirectoryService(users repository.UserRepository, groups repository.GroupRepository, cache CacheService) *DirectoryService {
+	return &DirectoryService{users: users, groups: groups, cache: cache}
+}
+
+// GroupsOf returns the group principals of an active user principal.
+// It implements GroupResolver.
+func (s *DirectoryService) GroupsOf(principal string) ([]string, error) {
+	userName, ok := strings.CutPrefix(principal, domain.PrincipalTypeUser+":")
+	if !ok {
+		return nil, nil
+	}
+
+	groups, err := s.groups.ListByMember(userName)
+	if err != nil {
+		return nil, err
+	}
+	principals := make([]string, len(groups))
+	for i := range groups {
+		principals[i] = groups[i].Principal()
+	}
+	return principals, nil
+}
+
+// =============== Users ===============
+
+// CreateUser provisions a user
+func (s *DirectoryService) CreateUser(user *domain.User) (*domain.User, error) {
+	if user.UserName == "" {
+		return nil, fmt.Errorf("user name is required")
+	}
+
+	existing, err := s.users.GetByUserName(user.UserName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("user %s %w", user.UserName, ErrDirectoryConflict)
+	}
+
+	if err := s.users.Create(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// GetUser gets a user with its groups, or nil if it does not exist
+func (s *DirectoryService) GetUser(id uuid.UUID) (*domain.User, error) {
+	return s.users.GetByID(id)
+}
+
+// ListUsers lists users with the total number of matches
+func (s *DirectoryService) ListUsers(filter repository.DirectoryFilter, pageSize, offset int) ([]domain.User, int64, error) {
+	return s.users.List(filter, pageSize, offset)
+}
+
+// UpdateUser replaces the attributes of a user. Renaming or deactivating a user
+// changes the group memberships its permission checks see.
+func (s *DirectoryService) UpdateUser(user *domain.User) (*domain.User, error) {
+	if user.UserName == "" {
+		return nil, fmt.Errorf("user name is required")
+	}
+
+	existing, err := s.users.GetByID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("user %s %w", user.ID, ErrDirectoryNotFound)
+	}
+
+	if user.UserName != existing.UserName {
+		other, err := s.users.GetByUserName(user.UserName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if other != nil {
+			return nil, fmt.Errorf("user %s %w", user.UserName, ErrDirectoryConflict)
+		}
+	}
+
+	user.CreatedAt = existing.CreatedAt
+	if err := s.users.Update(user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if user.UserName != existing.UserName || user.Active != existing.Active {
+		s.cache.Clear()
+	}
+	return s.users.GetByID(user.ID)
+}
+
+// DeleteUser deprovisions a user, removing it from all groups
+func (s *DirectoryService) DeleteUser(id uuid.UUID) error {
+	existing, err := s.users.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("user %s %w", id, ErrDirectoryNotFound)
+	}
+
+	if err := s.users.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// =============== Groups ===============
+
+// CreateGroup provisions a group with its initial members
+func (s *DirectoryService) CreateGroup(displayName, externalID string, memberIDs []uuid.UUID) (*domain.Group, error) {
+	if displayName == "" {
+		return nil, fmt.Errorf("group display name is required")
+	}
+	if err := s.checkGroupName(displayName, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	group := &domain.Group{DisplayName: displayName, ExternalID: externalID}
+	if err := s.groups.Create(group); err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+	if err := s.groups.AddMembers(group.ID, memberIDs); err != nil {
+		return nil, fmt.Errorf("failed to add group members: %w", err)
+	}
+	if len(memberIDs) > 0 {
+		s.cache.Clear()
+	}
+	return s.groups.GetByID(group.ID)
+}
+
+// GetGroup gets a group with its members, or nil if it does not exist
+func (s *DirectoryService) GetGroup(id uuid.UUID) (*domain.Group, error) {
+	return s.groups.GetByID(id)
+}
+
+// ListGroups lists groups with the total number of matches
+func (s *DirectoryService) ListGroups(filter repository.DirectoryFilter, pageSize, offset int) ([]domain.Group, int64, error) {
+	return s.groups.List(filter, pageSize, offset)
+}
+
+// UpdateGroup renames a group. Bindings name groups by display name, so a renamed
+// group no longer matches bindings granted to its old name.
+func (s *DirectoryService) UpdateGroup(id uuid.UUID, displayName, externalID string) (*domain.Group, error) {
+	group, err := s.requireGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if displayName == "" {
+		return nil, fmt.Errorf("group display name is required")
+	}
+	if displayName != group.DisplayName {
+		if err := s.checkGroupName(displayName, id); err != nil {
+			return nil, err
+		}
+	}
+
+	renamed := displayName != group.DisplayName
+	group.DisplayName = displayName
+	group.ExternalID = externalID
+	if err := s.groups.Update(group); err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	if renamed {
+		s.cache.Clear()
+	}
+	return s.groups.GetByID(id)
+}
+
+// DeleteGroup deprovisions a group
+func (s *DirectoryService) DeleteGroup(id uuid.UUID) error {
+	if _, err := s.requireGroup(id); err != nil {
+		return err
+	}
+	if err := s.groups.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// AddGroupMembers adds users to a group
+func (s *DirectoryService) AddGroupMembers(id uuid.UUID, userIDs []uuid.UUID) error {
+	return s.changeMembers(id, func() error { return s.groups.AddMembers(id, userIDs) })
+}
+
+// RemoveGroupMembers removes users from a group
+func (s *DirectoryService) RemoveGroupMembers(id uuid.UUID, userIDs []uuid.UUID) error {
+	return s.changeMembers(id, func() error { return s.groups.RemoveMembers(id, userIDs) })
+}
+
+// ReplaceGroupMembers makes userIDs the complete member list of a group
+func (s *DirectoryService) ReplaceGroupMembers(id uuid.UUID, userIDs []uuid.UUID) error {
+	return s.changeMembers(id, func() error { return s.groups.ReplaceMembers(id, userIDs) })
+}
+
+// changeMembers applies a membership change to an existing group and clears the cache
+func (s *DirectoryService) changeMembers(id uuid.UUID, change func() error) error {
+	if _, err := s.requireGroup(id); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return fmt.Errorf("failed to update group members: %w", err)
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// requireGroup gets a group, returning ErrDirectoryNotFound if it does not exist
+func (s *DirectoryService) requireGroup(id uuid.UUID) (*domain.Group, error) {
+	group, err := s.groups.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	if group == nil {
+		return nil, fmt.Errorf("group %s %w", id, ErrDirectoryNotFound)
+	}
+	return group, nil
+}
+
+// checkGroupName returns ErrDirectoryConflict if another group already uses displayName
+func (s *DirectoryService) checkGroupName(displayName string, id uuid.UUID) error {
+	groups, _, err := s.groups.List(repository.DirectoryFilter{Attribute: "display_name", Value: displayName}, 1, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+	if len(groups) > 0 && groups[0].ID != id {
+		return fmt.Errorf("group %s %w", displayName, ErrDirectoryConflict)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockUserRepository is a mock implementation of UserRepository
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) Create(user *domain.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetByID(id uuid.UUID) (*domain.User, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetByUserName(userName string) (*domain.User, error) {
+	args := m.Called(userName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) Update(user *domain.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) List(filter repository.DirectoryFilter, limit, offset int) ([]domain.User, int64, error) {
+	args := m.Called(filter, limit, offset)
+	return args.Get(0).([]domain.User), args.Get(1).(int64), args.Error(2)
+}
+
+// MockGroupRepository is a mock implementation of GroupRepository
+type MockGroupRepository struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepository) Create(group *domain.Group) error {
+	args := m.Called(group)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) GetByID(id uuid.UUID) (*domain.Group, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Group), args.Error(1)
+}
+
+func (m *MockGroupRepository) Update(group *domain.Group) error {
+	args := m.Called(group)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) List(filter repository.DirectoryFilter, limit, offset int) ([]domain.Group, int64, error) {
+	args := m.Called(filter, limit, offset)
+	return args.Get(0).([]domain.Group), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockGroupRepository) AddMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	args := m.Called(groupID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) RemoveMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	args := m.Called(groupID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) ReplaceMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	args := m.Called(groupID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) ListByMember(userName string) ([]domain.Group, error) {
+	args := m.Called(userName)
+	return args.Get(0).([]domain.Group), args.Error(1)
+}
+
+// countingCache records how often the cache is cleared
+type countingCache struct {
+	CacheService
+	clears int
+}
+
+func (c *countingCache) Clear() {
+	c.clears++
+}
+
+func TestDirectoryService_GroupsOf(t *testing.T) {
+	groups := new(MockGroupRepository)
+	directory := NewDirectoryService(new(MockUserRepository), groups, NewNoopCache())
+
+	groups.On("ListByMember", "alice@example.com").Return([]domain.Group{
+		{DisplayName: "engineering"},
+		{DisplayName: "oncall"},
+	}, nil)
+
+	principals, err := directory.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group:engineering", "group:oncall"}, principals)
+
+	// Only users belong to groups
+	principals, err = directory.GroupsOf("serviceAccount:ci@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, principals)
+
+	groups.AssertExpectations(t)
+}
+
+func TestDirectoryService_CreateUser_Conflict(t *testing.T) {
+	users := new(MockUserRepository)
+	directory := NewDirectoryService(users, new(MockGroupRepository), NewNoopCache())
+
+	users.On("GetByUserName", "alice@example.com").Return(&domain.User{ID: uuid.New()}, nil)
+
+	_, err := directory.CreateUser(&domain.User{UserName: "alice@example.com"})
+	assert.ErrorIs(t, err, ErrDirectoryConflict)
+	users.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestDirectoryService_UpdateUser_Deactivate(t *testing.T) {
+	users := new(MockUserRepository)
+	cache := &countingCache{CacheService: NewNoopCache()}
+	directory := NewDirectoryService(users, new(MockGroupRepository), cache)
+
+	id := uuid.New()
+	users.On("GetByID", id).Return(&domain.User{ID: id, UserName: "alice@example.com", Active: true}, nil).Once()
+	users.On("Update", mock.AnythingOfType("*domain.User")).Return(nil)
+	users.On("GetByID", id).Return(&domain.User{ID: id, UserName: "alice@example.com", Active: false}, nil)
+
+	updated, err := directory.UpdateUser(&domain.User{ID: id, UserName: "alice@example.com", Active: false})
+	require.NoError(t, err)
+	assert.False(t, updated.Active)
+
+	// Deactivation drops the user's group access, so cached decisions are stale
+	assert.Equal(t, 1, cache.clears)
+}
+
+func TestDirectoryService_UpdateUser_NotFound(t *testing.T) {
+	users := new(MockUserRepository)
+	directory := NewDirectoryService(users, new(MockGroupRepository), NewNoopCache())
+
+	id := uuid.New()
+	users.On("GetByID", id).Return(nil, nil)
+
+	_, err := directory.UpdateUser(&domain.User{ID: id, UserName: "alice@example.com"})
+	assert.ErrorIs(t, err, ErrDirectoryNotFound)
+}
+
+func TestDirectoryService_CreateGroup(t *testing.T) {
+	groups := new(MockGroupRepository)
+	cache := &countingCache{CacheService: NewNoopCache()}
+	directory := NewDirectoryService(new(MockUserRepository), groups, cache)
+
+	memberID := uuid.New()
+	nameFilter := repository.DirectoryFilter{Attribute: "display_name", Value: "engineering"}
+	groups.On("List", nameFilter, 1, 0).Return([]domain.Group{}, int64(0), nil)
+	groups.On("Create", mock.AnythingOfType("*domain.Group")).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Group).ID = uuid.New()
+	}).Return(nil)
+	groups.On("AddMembers", mock.AnythingOfType("uuid.UUID"), []uuid.UUID{memberID}).Return(nil)
+	groups.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Group{
+		DisplayName: "engineering",
+		Members:     []domain.User{{ID: memberID}},
+	}, nil)
+
+	group, err := directory.CreateGroup("engineering", "okta-123", []uuid.UUID{memberID})
+	require.NoError(t, err)
+	assert.Len(t, group.Members, 1)
+	assert.Equal(t, 1, cache.clears)
+
+	groups.AssertExpectations(t)
+}
+
+func TestDirectoryService_CreateGroup_Conflict(t *testing.T) {
+	groups := new(MockGroupRepository)
+	directory := NewDirectoryService(new(MockUserRepository), groups, NewNoopCache())
+
+	nameFilter := repository.DirectoryFilter{Attribute: "display_name", Value: "engineering"}
+	groups.On("List", nameFilter, 1, 0).Return([]domain.Group{{ID: uuid.New()}}, int64(1), nil)
+
+	_, err := directory.CreateGroup("engineering", "", nil)
+	assert.ErrorIs(t, err, ErrDirectoryConflict)
+}
+
+func TestDirectoryService_ChangeMembers(t *testing.T) {
+	groups := new(MockGroupRepository)
+	cache := &countingCache{CacheService: NewNoopCache()}
+	directory := NewDirectoryService(new(MockUserRepository), groups, cache)
+
+	id, userID := uuid.New(), uuid.New()
+	groups.On("GetByID", id).Return(&domain.Group{ID: id}, nil)
+	groups.On("AddMembers", id, []uuid.UUID{userID}).Return(nil)
+	groups.On("RemoveMembers", id, []uuid.UUID{userID}).Return(nil)
+	groups.On("ReplaceMembers", id, []uuid.UUID(nil)).Return(nil)
+
+	require.NoError(t, directory.AddGroupMembers(id, []uuid.UUID{userID}))
+	require.NoError(t, directory.RemoveGroupMembers(id, []uuid.UUID{userID}))
+	require.NoError(t, directory.ReplaceGroupMembers(id, nil))
+	assert.Equal(t, 3, cache.clears)
+
+	missing := uuid.New()
+	groups.On("GetByID", missing).Return(nil, nil)
+	assert.ErrorIs(t, directory.AddGroupMembers(missing, []uuid.UUID{userID}), ErrDirectoryNotFound)
+
+	groups.AssertExpectations(t)
+}
+
+// Test: Bindings granted to a group apply to its members
+func TestCheckPermission_GroupMember(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	permissionRepo := new(MockPermissionRepository)
+	groups := new(MockGroupRepository)
+	directory := NewDirectoryService(new(MockUserRepository), groups, NewNoopCache())
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, permissionRepo, NewNoopCache(), WithGroupResolver(directory))
+
+	resourceID := uuid.New()
+	role := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.viewer",
+		Permissions: []domain.Permission{{ID: uuid.New(), Name: "storage.objects.read"}},
+	}
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Bindings: []domain.Binding{{
+			ID:      uuid.New(),
+			RoleID:  role.ID,
+			Role:    role,
+			Members: toJSON([]string{"group:engineering"}),
+		}},
+	}
+
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	groups.On("ListByMember", "alice@example.com").Return([]domain.Group{{DisplayName: "engineering"}}, nil)
+	groups.On("ListByMember", "bob@example.com").Return([]domain.Group{}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, _, err = evaluator.CheckPermission("user:bob@example.com", resourceID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
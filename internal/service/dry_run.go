@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// DryRun returns a view of the service whose policy, binding and role mutations perform every
+// check of the real call (authorization, grant constraints, etags, policy limits, role scopes
+// and condition compilation) and return what they would produce, without persisting anything,
+// invalidating the cache or recording revisions. It composes with AsCaller, e.g.
+// s.AsCaller(caller).DryRun().UpdatePolicy(...). Policy results are the policy as it would be
+// after the change, one version later but still carrying the current etag, so the change can be
+// applied with it; their new bindings have no IDs. Deletions only report whether they would
+// succeed. Other methods behave as on the service.
+func (s *IAMService) DryRun() *IAMService {
+	view := *s
+	view.dryRun = true
+	return &view
+}
+
+// dryRunPolicy returns the policy of resourceID (nil when it has none yet) as it would be with
+// bindings, loading the role of each binding for display
+func (s *IAMService) dryRunPolicy(policy *domain.Policy, resourceID uuid.UUID, bindings []domain.Binding) (*domain.Policy, error) {
+	result := domain.Policy{ResourceID: resourceID}
+	if policy != nil {
+		result = *policy
+	}
+	result.Version++
+	result.Bindings = make([]domain.Binding, len(bindings))
+
+	roles := make(map[uuid.UUID]*domain.Role)
+	for i := range bindings {
+		binding := bindings[i]
+		binding.PolicyID = result.ID
+		if binding.Role == nil {
+			role, ok := roles[binding.RoleID]
+			if !ok {
+				var err error
+				if role, err = s.roleRepo.GetByID(binding.RoleID); err != nil {
+					return nil, fmt.Errorf("binding %d: failed to get role: %w", i, err)
+				}
+				roles[binding.RoleID] = role
+			}
+			binding.Role = role
+		}
+		result.Bindings[i] = binding
+	}
+	result.Metadata = policyMetadata(canonicalPolicy(&result), nil)
+	return &result, nil
+}
+
+// checkRoleUnused fails with a *repository.RoleInUseError, as deleting the role would, while
+// bindings reference it
+func (s *IAMService) checkRoleUnused(id uuid.UUID) error {
+	bindings, err := s.bindingRepo.ListByRole(id)
+	if err != nil {
+		return fmt.Errorf("failed to list bindings of role: %w", err)
+	}
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	// Like the repository, report up to 100 of the referencing bindings
+	ids := make([]uuid.UUID, 0, min(len(bindings), 100))
+	for _, binding := range bindings[:cap(ids)] {
+		ids = append(ids, binding.ID)
+	}
+	return &repository.RoleInUseError{RoleID: id, BindingIDs: ids, Total: int64(len(bindings))}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mocks panic on unexpected calls, so these tests also check that dry runs write nothing
+
+func TestIAMService_DryRun_UpdatePolicy(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	editor := testRole("roles/editor", "storage.buckets.get", "storage.buckets.update")
+	resourceID := uuid.New()
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Version:    3,
+		ETag:       "etag-3",
+		Bindings:   []domain.Binding{testBinding(&viewer, "user:alice@example.com")},
+	}
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	roleRepo.On("GetByID", editor.ID).Return(&editor, nil)
+
+	bindings := []domain.Binding{{RoleID: editor.ID, Members: toJSON([]string{"user:bob@example.com"})}}
+	_, err := service.DryRun().UpdatePolicy(resourceID, bindings, "stale")
+	assert.ErrorContains(t, err, "etag mismatch")
+
+	result, err := service.DryRun().UpdatePolicy(resourceID, bindings, "etag-3")
+	require.NoError(t, err)
+	assert.Equal(t, policy.ID, result.ID)
+	assert.Equal(t, 4, result.Version)
+	assert.Equal(t, "etag-3", result.ETag)
+	require.Len(t, result.Bindings, 1)
+	assert.Equal(t, uuid.Nil, result.Bindings[0].ID)
+	assert.Equal(t, "roles/editor", result.Bindings[0].Role.Name)
+	// The stored policy is left untouched
+	assert.Equal(t, 3, policy.Version)
+	assert.Equal(t, viewer.ID, policy.Bindings[0].RoleID)
+
+	invalid := []domain.Binding{{
+		RoleID:    editor.ID,
+		Members:   toJSON([]string{"user:bob@example.com"}),
+		Condition: &domain.Condition{Expression: "request.time >"},
+	}}
+	_, err = service.DryRun().UpdatePolicy(resourceID, invalid, "etag-3")
+	assert.ErrorContains(t, err, "invalid condition")
+}
+
+func TestIAMService_DryRun_Bindings(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+
+	// A binding on a resource without a policy would create version 1
+	bareID := uuid.New()
+	policyRepo.On("GetByResourceID", bareID).Return(nil, nil)
+	binding, err := service.DryRun().CreateBinding(bareID, viewer.ID, []string{"user:alice@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, viewer.ID, binding.RoleID)
+	assert.Equal(t, "roles/viewer", binding.Role.Name)
+
+	resourceID := uuid.New()
+	kept := testBinding(&viewer, "user:alice@example.com")
+	removed := testBinding(&viewer, "user:bob@example.com")
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Version: 2, Bindings: []domain.Binding{kept, removed}}
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	result, err := service.DryRun().BatchDeleteBindings(resourceID, []uuid.UUID{removed.ID})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Version)
+	require.Len(t, result.Bindings, 1)
+	assert.Equal(t, kept.ID, result.Bindings[0].ID)
+
+	_, err = service.DryRun().BatchDeleteBindings(resourceID, []uuid.UUID{uuid.New()})
+	assert.ErrorContains(t, err, "not found on resource")
+}
+
+func TestIAMService_DryRun_DeletePolicy(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	resourceID := uuid.New()
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ID: uuid.New(), ResourceID: resourceID, ETag: "etag"}, nil)
+
+	assert.NoError(t, service.DryRun().DeletePolicy(resourceID, "etag"))
+	assert.ErrorContains(t, service.DryRun().DeletePolicy(resourceID, "stale"), "etag mismatch")
+}
+
+func TestIAMService_DryRun_Roles(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	permissionRepo.On("GetByIDs", []uuid.UUID(nil)).Return([]domain.Permission{}, nil)
+	existing := testRole("roles/custom.viewer")
+	roleRepo.On("GetByName", "roles/custom.viewer").Return(&existing, nil)
+	roleRepo.On("GetByName", "roles/custom.editor").Return(nil, nil)
+
+	_, err := service.DryRun().CreateRole("roles/custom.viewer", "Viewer", "", nil, nil)
+	assert.ErrorContains(t, err, "already exists")
+	role, err := service.DryRun().CreateRole("roles/custom.editor", "Editor", "", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "roles/custom.editor", role.Name)
+	assert.True(t, role.IsCustom)
+
+	used := testRole("roles/custom.used")
+	binding := testBinding(&used, "user:alice@example.com")
+	bindingRepo.On("ListByRole", used.ID).Return([]domain.Binding{binding}, nil)
+	bindingRepo.On("ListByRole", existing.ID).Return([]domain.Binding{}, nil)
+
+	var inUse *repository.RoleInUseError
+	require.ErrorAs(t, service.DryRun().DeleteRole(used.ID, false), &inUse)
+	assert.Equal(t, []uuid.UUID{binding.ID}, inUse.BindingIDs)
+	assert.Equal(t, int64(1), inUse.Total)
+	assert.NoError(t, service.DryRun().DeleteRole(existing.ID, false))
+	assert.NoError(t, service.DryRun().DeleteRole(used.ID, true))
+}
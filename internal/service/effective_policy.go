@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// EffectivePolicy is every binding applying to a resource: those of its own policy and those it
+// inherits from the policies of its ancestors
+type EffectivePolicy struct {
+	ResourceID uuid.UUID
+	Policy     *domain.Policy     // The resource's own policy, with its metadata; nil when it has none
+	Bindings   []EffectiveBinding // Own bindings first, then those of each ancestor from the parent to the root
+}
+
+// EffectiveBinding is a binding of an effective policy, with the resource whose policy holds it
+type EffectiveBinding struct {
+	domain.Binding
+	ResourceID   uuid.UUID
+	ResourceName string
+	ResourceType string
+	Inherited    bool // Held by an ancestor's policy
+}
+
+// GetEffectivePolicy returns the bindings applying to a resource, annotated with the resource they
+// come from, so the full access to a resource can be shown on one screen. Callers need the
+// permission to read the resource's policy; the inherited bindings are part of its access, so no
+// permission on the ancestors is required.
+func (s *IAMService) GetEffectivePolicy(resourceID uuid.UUID) (*EffectivePolicy, error) {
+	if err := s.authorize("GetEffectivePolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.resourceRepo.GetByID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+	ancestors, err := s.resourceRepo.GetAncestors(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+
+	chain := make([]domain.Resource, 0, len(ancestors)+1)
+	chain = append(chain, *resource)
+	chain = append(chain, ancestors...)
+	ids := make([]uuid.UUID, len(chain))
+	for i := range chain {
+		ids[i] = chain[i].ID
+	}
+	policies, err := s.policyRepo.GetByResourceIDs(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policies: %w", err)
+	}
+
+	effective := &EffectivePolicy{ResourceID: resourceID, Bindings: []EffectiveBinding{}}
+	if policy := policies[resourceID]; policy != nil {
+		if effective.Policy, err = s.withMetadata(policy); err != nil {
+			return nil, err
+		}
+	}
+	for i, holder := range chain {
+		policy := policies[holder.ID]
+		if policy == nil {
+			continue
+		}
+		for _, binding := range policy.Bindings {
+			effective.Bindings = append(effective.Bindings, EffectiveBinding{
+				Binding:      binding,
+				ResourceID:   holder.ID,
+				ResourceName: holder.Name,
+				ResourceType: holder.Type,
+				Inherited:    i > 0,
+			})
+		}
+	}
+	return effective, nil
+}
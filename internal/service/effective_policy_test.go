@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Own bindings come first, then those of each ancestor with the resource holding them
+func TestIAMService_GetEffectivePolicy(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	// The bucket inherits from its project and organization; the project has no policy
+	orgID, projectID, bucketID := uuid.New(), uuid.New(), uuid.New()
+	viewer := testRole("roles/storage.viewer", "storage.objects.get")
+	admin := testRole("roles/storage.admin", "storage.objects.get", "storage.objects.delete")
+	bucketPolicy := &domain.Policy{ID: uuid.New(), ResourceID: bucketID,
+		Bindings: []domain.Binding{testBinding(&viewer, "user:alice@example.com")}}
+	orgPolicy := &domain.Policy{ID: uuid.New(), ResourceID: orgID,
+		Bindings: []domain.Binding{testBinding(&admin, "group:sre@example.com")}}
+
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket", Name: "logs"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{
+		{ID: projectID, Type: "project", Name: "prod"},
+		{ID: orgID, Type: "organization", Name: "Example Corp"},
+	}, nil)
+	policyRepo.On("GetByResourceID", bucketID).Return(bucketPolicy, nil)
+	policyRepo.On("GetByResourceID", projectID).Return(nil, nil)
+	policyRepo.On("GetByResourceID", orgID).Return(orgPolicy, nil)
+	revisionRepo.On("List", bucketPolicy.ID, 1, 0).Return([]domain.PolicyRevision{}, nil)
+
+	effective, err := service.GetEffectivePolicy(bucketID)
+	require.NoError(t, err)
+	assert.Equal(t, bucketPolicy.ID, effective.Policy.ID)
+	assert.Equal(t, 1, effective.Policy.Metadata.Bindings)
+	require.Len(t, effective.Bindings, 2)
+	assert.Equal(t, "roles/storage.viewer", effective.Bindings[0].Role.Name)
+	assert.Equal(t, bucketID, effective.Bindings[0].ResourceID)
+	assert.False(t, effective.Bindings[0].Inherited)
+	assert.Equal(t, "roles/storage.admin", effective.Bindings[1].Role.Name)
+	assert.Equal(t, orgID, effective.Bindings[1].ResourceID)
+	assert.Equal(t, "Example Corp", effective.Bindings[1].ResourceName)
+	assert.True(t, effective.Bindings[1].Inherited)
+}
+
+// Test: A resource without a policy of its own still shows what it inherits
+func TestIAMService_GetEffectivePolicy_InheritedOnly(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	orgID, projectID := uuid.New(), uuid.New()
+	owner := testRole("roles/owner", "admin.all")
+	orgPolicy := &domain.Policy{ID: uuid.New(), ResourceID: orgID,
+		Bindings: []domain.Binding{testBinding(&owner, "user:root@example.com")}}
+
+	resourceRepo.On("GetByID", projectID).Return(&domain.Resource{ID: projectID, Type: "project"}, nil)
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{{ID: orgID, Type: "organization"}}, nil)
+	policyRepo.On("GetByResourceID", projectID).Return(nil, nil)
+	policyRepo.On("GetByResourceID", orgID).Return(orgPolicy, nil)
+
+	effective, err := service.GetEffectivePolicy(projectID)
+	require.NoError(t, err)
+	assert.Nil(t, effective.Policy)
+	require.Len(t, effective.Bindings, 1)
+	assert.True(t, effective.Bindings[0].Inherited)
+
+	missing := uuid.New()
+	resourceRepo.On("GetByID", missing).Return(nil, nil)
+	_, err = service.GetEffectivePolicy(missing)
+	assert.ErrorContains(t, err, "resource not found")
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// evaluation memoizes the rows one evaluator request loads and what it derives from them, so
+// bindings, roles and ancestors shared by several checks of a batch are loaded and parsed once.
+// It lives for a single request and is independent of the global cache, which only holds
+// decisions; it is not safe for concurrent use.
+type evaluation struct {
+	pe *permissionEvaluator
+
+	// A consistent evaluation skips the decision cache and the read model, and loads resources and
+	// policies from the primary repositories
+	consistent   bool
+	resourceRepo repository.ResourceRepository
+	policyRepo   repository.PolicyRepository
+	loadPrefix   string // Prefix of its sharedLoad keys, so it never shares a load from a replica
+
+	identities  map[string][]string
+	attributes  map[string]map[string]string
+	resources   map[uuid.UUID]*domain.Resource
+	hierarchies map[uuid.UUID][]uuid.UUID
+	policies    map[uuid.UUID]*domain.Policy
+	members     map[uuid.UUID][]string
+	roles       map[uuid.UUID]map[string]bool
+	conditions  map[conditionKey]bool
+}
+
+// conditionKey identifies a condition evaluated against one condition context
+type conditionKey struct {
+	expression string
+	condCtx    *ConditionContext
+}
+
+func (pe *permissionEvaluator) newEvaluation() *evaluation {
+	return &evaluation{
+		pe:           pe,
+		resourceRepo: pe.resourceRepo,
+		policyRepo:   pe.policyRepo,
+		identities:   make(map[string][]string),
+		attributes:   make(map[string]map[string]string),
+		resources:    make(map[uuid.UUID]*domain.Resource),
+		hierarchies:  make(map[uuid.UUID][]uuid.UUID),
+		policies:     make(map[uuid.UUID]*domain.Policy),
+		members:      make(map[uuid.UUID][]string),
+		roles:        make(map[uuid.UUID]map[string]bool),
+		conditions:   make(map[conditionKey]bool),
+	}
+}
+
+// newConsistentEvaluation returns an evaluation for fully consistent checks
+func (pe *permissionEvaluator) newConsistentEvaluation() *evaluation {
+	ev := pe.newEvaluation()
+	ev.consistent = true
+	if pe.primaryResources != nil {
+		ev.resourceRepo, ev.policyRepo, ev.loadPrefix = pe.primaryResources, pe.primaryPolicies, "primary:"
+	}
+	return ev
+}
+
+// sharedLoad runs load once for all concurrent requests of the evaluator loading the same key, so
+// when the cached decisions of a hot resource expire, the burst of checks that follows sends one
+// query per resource to the database instead of one per check. Only loads in flight are shared;
+// results are not kept, and callers must not modify them.
+func sharedLoad[T any](pe *permissionEvaluator, key string, load func() (T, error)) (T, error) {
+	value, err, _ := pe.loads.Do(key, func() (interface{}, error) {
+		return load()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// identity returns the principal followed by the groups it belongs to
+func (ev *evaluation) identity(principal string) ([]string, error) {
+	if identities, ok := ev.identities[principal]; ok {
+		return identities, nil
+	}
+	identities, err := ev.pe.identities(principal)
+	if err != nil {
+		return nil, err
+	}
+	ev.identities[principal] = identities
+	return identities, nil
+}
+
+// resource returns a resource, or nil if it does not exist
+func (ev *evaluation) resource(id uuid.UUID) (*domain.Resource, error) {
+	if resource, ok := ev.resources[id]; ok {
+		return resource, nil
+	}
+	resource, err := sharedLoad(ev.pe, ev.loadPrefix+"resource:"+id.String(), func() (*domain.Resource, error) {
+		return ev.resourceRepo.GetByID(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ev.resources[id] = resource
+	return resource, nil
+}
+
+// hierarchy returns the resource followed by its ancestors
+func (ev *evaluation) hierarchy(id uuid.UUID) ([]uuid.UUID, error) {
+	if resources, ok := ev.hierarchies[id]; ok {
+		return resources, nil
+	}
+	resources, err := sharedLoad(ev.pe, ev.loadPrefix+"hierarchy:"+id.String(), func() ([]uuid.UUID, error) {
+		ancestors, err := ev.resourceRepo.GetAncestors(id)
+		if err != nil {
+			return nil, err
+		}
+		resources := make([]uuid.UUID, 0, len(ancestors)+1)
+		resources = append(resources, id)
+		for _, ancestor := range ancestors {
+			resources = append(resources, ancestor.ID)
+		}
+		return resources, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ev.hierarchies[id] = resources
+	return resources, nil
+}
+
+// policy returns the policy of a resource, or nil if it has none
+func (ev *evaluation) policy(resourceID uuid.UUID) (*domain.Policy, error) {
+	if policy, ok := ev.policies[resourceID]; ok {
+		return policy, nil
+	}
+	policy, err := sharedLoad(ev.pe, ev.loadPrefix+"policy:"+resourceID.String(), func() (*domain.Policy, error) {
+		return ev.policyRepo.GetByResourceID(resourceID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ev.policies[resourceID] = policy
+	return policy, nil
+}
+
+// loadPolicies loads the policies of the resources not loaded yet with one batched query, so
+// walking a hierarchy reads all of its policies in a single round trip; policy then serves them
+func (ev *evaluation) loadPolicies(resourceIDs []uuid.UUID) error {
+	missing := make([]uuid.UUID, 0, len(resourceIDs))
+	keys := make([]string, 0, len(resourceIDs))
+	for _, id := range resourceIDs {
+		if _, ok := ev.policies[id]; !ok {
+			missing = append(missing, id)
+			keys = append(keys, id.String())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	policies, err := sharedLoad(ev.pe, ev.loadPrefix+"policies:"+strings.Join(keys, ","), func() (map[uuid.UUID]*domain.Policy, error) {
+		return ev.policyRepo.GetByResourceIDs(missing)
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range missing {
+		ev.policies[id] = policies[id]
+	}
+	return nil
+}
+
+// grantsTo reports whether the binding grants to any of the identities, like Binding.HasAnyMember
+// but parsing the members of each binding once. Members that are not valid JSON fail the check
+// rather than grant to no one, so corrupted bindings surface; members stored before the principal
+// grammar was enforced still match exactly.
+func (ev *evaluation) grantsTo(binding *domain.Binding, identities []string) (bool, error) {
+	members, ok := ev.members[binding.ID]
+	if !ok || binding.ID == uuid.Nil {
+		var err error
+		if members, err = binding.GetMembers(); err != nil {
+			return false, fmt.Errorf("binding %s has invalid members: %w", binding.ID, err)
+		}
+		if binding.ID != uuid.Nil {
+			ev.members[binding.ID] = members
+		}
+	}
+	for _, member := range members {
+		for _, identity := range identities {
+			if domain.MemberMatches(member, identity) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasPermission reports whether role grants permission, indexing the role's permissions once
+func (ev *evaluation) hasPermission(role *domain.Role, permission string) bool {
+	if role.ID == uuid.Nil {
+		return role.HasPermission(permission)
+	}
+	permissions, ok := ev.roles[role.ID]
+	if !ok {
+		permissions = make(map[string]bool, len(role.Permissions))
+		for _, perm := range role.Permissions {
+			permissions[perm.Name] = true
+		}
+		ev.roles[role.ID] = permissions
+	}
+	return permissions[permission]
+}
+
+// principal adds the attributes of the principal attribute providers to a condition context,
+// fetching them once per principal
+func (ev *evaluation) principal(condCtx *ConditionContext) error {
+	if condCtx.principalResolved || len(ev.pe.attributes) == 0 {
+		return nil
+	}
+	attributes, ok := ev.attributes[condCtx.Principal]
+	if !ok {
+		var err error
+		if attributes, err = ev.pe.principalAttributes(condCtx.Principal); err != nil {
+			return err
+		}
+		ev.attributes[condCtx.Principal] = attributes
+	}
+	for name, value := range attributes {
+		condCtx.PrincipalAttributes[name] = value
+	}
+	condCtx.principalResolved = true
+	return nil
+}
+
+// conditionHolds evaluates a binding condition once per condition context
+func (ev *evaluation) conditionHolds(condition *domain.Condition, condCtx *ConditionContext) (bool, error) {
+	if condition == nil {
+		return true, nil
+	}
+	key := conditionKey{expression: condition.Expression, condCtx: condCtx}
+	if result, ok := ev.conditions[key]; ok {
+		return result, nil
+	}
+	// Attribute providers are only asked when the condition can read their attributes
+	if readsPrincipalAttributes(condition.Expression) {
+		if err := ev.principal(condCtx); err != nil {
+			return false, err
+		}
+	}
+	result := evaluateCondition(condition, condCtx)
+	ev.conditions[key] = result
+	return result, nil
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+var (
+	// ErrEvaluationTimeout is returned when a check exceeds the evaluator's latency budget
+	ErrEvaluationTimeout = errors.New("permission evaluation timed out")
+	// ErrEvaluatorOverloaded is returned when the maximum number of checks are already being evaluated
+	ErrEvaluatorOverloaded = errors.New("too many permission evaluations in flight")
+	// ErrCircuitOpen is returned while the circuit breaker fails checks fast
+	ErrCircuitOpen = errors.New("permission evaluation circuit breaker is open")
+)
+
+// FailureMode values deciding checks that could not be evaluated
+const (
+	FailureModeClosed = "closed" // Deny
+	FailureModeOpen   = "open"   // Allow
+)
+
+// guardedEvaluator bounds the time and concurrency of permission checks and stops sending
+// checks to a degraded database. Checks that are not evaluated are decided by the failure mode;
+// GetEffectivePermissions returns the error instead.
+//
+// The evaluator interface has no context, so a timed out evaluation keeps running in the
+// background until its queries return (bounded by database.statement_timeout_seconds); it keeps
+// its in-flight slot until then, so slow queries cannot pile up beyond max_in_flight.
+type guardedEvaluator struct {
+	PermissionEvaluator
+	timeout  time.Duration
+	slots    chan struct{} // nil without an in-flight limit
+	failOpen bool
+	breaker  *circuitBreaker // nil without a circuit breaker
+	logger   *slog.Logger
+}
+
+// NewGuardedEvaluator wraps evaluator with the latency budget, in-flight limit and circuit
+// breaker of cfg. It returns evaluator unchanged when none of them is configured.
+func NewGuardedEvaluator(evaluator PermissionEvaluator, cfg *config.EvaluatorConfig, logger *slog.Logger) (PermissionEvaluator, error) {
+	var failOpen bool
+	switch cfg.FailureMode {
+	case FailureModeClosed, "":
+	case FailureModeOpen:
+		failOpen = true
+	default:
+		return nil, fmt.Errorf("invalid evaluator failure_mode %q (valid: closed, open)", cfg.FailureMode)
+	}
+	if cfg.TimeoutMS < 0 || cfg.MaxInFlight < 0 {
+		return nil, fmt.Errorf("evaluator timeout_ms and max_in_flight must not be negative")
+	}
+	if cfg.TimeoutMS == 0 && cfg.MaxInFlight == 0 && !cfg.CircuitBreaker.Enabled {
+		return evaluator, nil
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ge := &guardedEvaluator{
+		PermissionEvaluator: evaluator,
+		timeout:             time.Duration(cfg.TimeoutMS) * time.Millisecond,
+		failOpen:            failOpen,
+		logger:              logger,
+	}
+	if cfg.MaxInFlight > 0 {
+		ge.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.CircuitBreaker.Enabled {
+		if cfg.CircuitBreaker.FailureThreshold <= 0 || cfg.CircuitBreaker.OpenSeconds <= 0 {
+			return nil, fmt.Errorf("evaluator circuit_breaker failure_threshold and open_seconds must be positive")
+		}
+		ge.breaker = newCircuitBreaker(
+			cfg.CircuitBreaker.FailureThreshold,
+			time.Duration(cfg.CircuitBreaker.OpenSeconds)*time.Second,
+			logger,
+		)
+	}
+	return ge, nil
+}
+
+// FailClosed returns evaluator with checks it could not evaluate denied, whatever its failure
+// mode. A guarded evaluator's copy shares its in-flight slots and circuit breaker; other
+// evaluators are returned unchanged. Admin API authorization uses it so that fail-open only
+// applies to data-plane checks.
+func FailClosed(evaluator PermissionEvaluator) PermissionEvaluator {
+	ge, ok := evaluator.(*guardedEvaluator)
+	if !ok || !ge.failOpen {
+		return evaluator
+	}
+	closed := *ge
+	closed.failOpen = false
+	return &closed
+}
+
+// run evaluates fn within the guard's limits. Errors of fn are returned as is; the guard's own
+// errors (ErrEvaluationTimeout, ErrEvaluatorOverloaded, ErrCircuitOpen) are reported by unavailable.
+func (ge *guardedEvaluator) run(fn func() error) error {
+	if ge.slots != nil {
+		select {
+		case ge.slots <- struct{}{}:
+		default:
+			return ErrEvaluatorOverloaded
+		}
+	}
+	release := func() {
+		if ge.slots != nil {
+			<-ge.slots
+		}
+	}
+	if ge.breaker != nil && !ge.breaker.allow() {
+		release()
+		return ErrCircuitOpen
+	}
+
+	if ge.timeout == 0 {
+		err := fn()
+		release()
+		ge.record(err)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer release()
+		done <- fn()
+	}()
+	timer := time.NewTimer(ge.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		ge.record(err)
+		return err
+	case <-timer.C:
+		ge.record(ErrEvaluationTimeout)
+		return ErrEvaluationTimeout
+	}
+}
+
+func (ge *guardedEvaluator) record(err error) {
+	if ge.breaker != nil {
+		ge.breaker.record(err == nil)
+	}
+}
+
+// unavailable reports whether err is one of the guard's errors, decided by the failure mode
+func unavailable(err error) bool {
+	return errors.Is(err, ErrEvaluationTimeout) || errors.Is(err, ErrEvaluatorOverloaded) || errors.Is(err, ErrCircuitOpen)
+}
+
+// failureReason is the reason of a check decided by the failure mode
+func (ge *guardedEvaluator) failureReason(err error) string {
+	if ge.failOpen {
+		return fmt.Sprintf("Allowed without evaluation (fail-open): %v", err)
+	}
+	return fmt.Sprintf("Denied without evaluation (fail-closed): %v", err)
+}
+
+func (ge *guardedEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(ge.Check(principal, resourceID, permission, context))
+}
+
+func (ge *guardedEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	var result CheckResult
+	err := ge.run(func() error {
+		var err error
+		result, err = ge.PermissionEvaluator.Check(principal, resourceID, permission, context)
+		return err
+	})
+	if unavailable(err) {
+		ge.logger.Warn("Permission check decided by failure mode",
+			"principal", principal, "resource_id", resourceID, "permission", permission,
+			"fail_open", ge.failOpen, "error", err)
+		return CheckResult{Allowed: ge.failOpen, Reason: ge.failureReason(err)}, nil
+	}
+	return result, err
+}
+
+func (ge *guardedEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	var results []CheckResult
+	err := ge.run(func() error {
+		var err error
+		results, err = ge.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+		return err
+	})
+	if unavailable(err) {
+		ge.logger.Warn("Batch permission check decided by failure mode",
+			"principal", principal, "checks", len(checks), "fail_open", ge.failOpen, "error", err)
+		results = make([]CheckResult, len(checks))
+		for i := range results {
+			results[i] = CheckResult{Allowed: ge.failOpen, Reason: ge.failureReason(err)}
+		}
+		return results, nil
+	}
+	return results, err
+}
+
+func (ge *guardedEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	var results []CheckResult
+	err := ge.run(func() error {
+		var err error
+		results, err = ge.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+		return err
+	})
+	if unavailable(err) {
+		ge.logger.Warn("Permission check of principals decided by failure mode",
+			"principals", len(principals), "resource_id", resourceID, "permission", permission,
+			"fail_open", ge.failOpen, "error", err)
+		results = make([]CheckResult, len(principals))
+		for i := range results {
+			results[i] = CheckResult{Allowed: ge.failOpen, Reason: ge.failureReason(err)}
+		}
+		return results, nil
+	}
+	return results, err
+}
+
+func (ge *guardedEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	var granted []string
+	err := ge.run(func() error {
+		var err error
+		granted, err = ge.PermissionEvaluator.TestPermissions(principal, resourceID, permissions, context)
+		return err
+	})
+	if unavailable(err) {
+		ge.logger.Warn("Permission test decided by failure mode",
+			"principal", principal, "resource_id", resourceID, "fail_open", ge.failOpen, "error", err)
+		if ge.failOpen {
+			return append([]string(nil), permissions...), nil
+		}
+		return []string{}, nil
+	}
+	return granted, err
+}
+
+func (ge *guardedEvaluator) GetEffectivePermissions(principal string, resourceID uuid.UUID) ([]string, []string, error) {
+	var permissions, roles []string
+	err := ge.run(func() error {
+		var err error
+		permissions, roles, err = ge.PermissionEvaluator.GetEffectivePermissions(principal, resourceID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return permissions, roles, nil
+}
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"    // Checks are evaluated
+	circuitOpen     = "open"      // Checks fail fast
+	circuitHalfOpen = "half-open" // One trial check is evaluated
+)
+
+// circuitBreaker opens after threshold consecutive failures and lets a trial check through
+// after openFor; the trial's success closes it again, its failure reopens it
+type circuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial check is in flight
+}
+
+func newCircuitBreaker(threshold int, openFor time.Duration, logger *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		openFor:   openFor,
+		logger:    logger,
+		now:       time.Now,
+		state:     circuitClosed,
+	}
+}
+
+// allow reports whether a check may be evaluated
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openFor {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		cb.trial = true
+		return true
+	case circuitHalfOpen:
+		if cb.trial {
+			return false
+		}
+		cb.trial = true
+		return true
+	}
+	return true
+}
+
+// record counts the outcome of a check let through by allow
+func (cb *circuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if success {
+		if cb.state != circuitClosed {
+			cb.logger.Info("Permission evaluation circuit breaker closed")
+		}
+		cb.state = circuitClosed
+		cb.failures = 0
+		cb.trial = false
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || (cb.state == circuitClosed && cb.failures >= cb.threshold) {
+		cb.logger.Warn("Permission evaluation circuit breaker opened",
+			"consecutive_failures", cb.failures, "open_for", cb.openFor)
+		cb.state = circuitOpen
+		cb.openedAt = cb.now()
+		cb.trial = false
+	}
+}
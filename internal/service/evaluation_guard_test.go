@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGuardedEvaluator_Configuration(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+
+	// Nothing configured leaves the evaluator unwrapped
+	unguarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{FailureMode: FailureModeClosed}, nil)
+	require.NoError(t, err)
+	assert.Same(t, evaluator, unguarded)
+
+	_, err = NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{FailureMode: "sometimes"}, nil)
+	assert.ErrorContains(t, err, "invalid evaluator failure_mode")
+
+	_, err = NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{
+		CircuitBreaker: config.CircuitBreakerConfig{Enabled: true},
+	}, nil)
+	assert.ErrorContains(t, err, "must be positive")
+}
+
+func TestGuardedEvaluator_TimeoutFailsClosed(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	release := make(chan struct{})
+	defer close(release)
+	evaluator.On("CheckPermission", "user:alice", resourceID, "docs.read", mock.Anything).
+		Run(func(mock.Arguments) { <-release }).Return(true, "Allowed", nil)
+
+	guarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{TimeoutMS: 20}, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	allowed, reason, err := guarded.CheckPermission("user:alice", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Contains(t, reason, "fail-closed")
+	assert.Contains(t, reason, ErrEvaluationTimeout.Error())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestGuardedEvaluator_FailOpen(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	release := make(chan struct{})
+	defer close(release)
+	evaluator.On("BatchCheckPermissions", "user:alice", mock.Anything).
+		Run(func(mock.Arguments) { <-release }).Return([]CheckResult{}, nil)
+	evaluator.On("TestPermissions", "user:alice", resourceID, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-release }).Return([]string{}, nil)
+	evaluator.On("GetEffectivePermissions", "user:alice", resourceID).
+		Run(func(mock.Arguments) { <-release }).Return([]string{}, []string{}, nil)
+
+	guarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{TimeoutMS: 20, FailureMode: FailureModeOpen}, nil)
+	require.NoError(t, err)
+
+	results, err := guarded.BatchCheckPermissions("user:alice", []PermissionCheck{{ResourceID: resourceID}, {ResourceID: resourceID}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Allowed)
+	assert.Contains(t, results[1].Reason, "fail-open")
+
+	granted, err := guarded.TestPermissions("user:alice", resourceID, []string{"docs.read", "docs.write"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs.read", "docs.write"}, granted)
+
+	// Effective permissions cannot be made up, so the timeout is returned
+	_, _, err = guarded.GetEffectivePermissions("user:alice", resourceID)
+	assert.ErrorIs(t, err, ErrEvaluationTimeout)
+}
+
+// Test: The fail-closed copy of a fail-open evaluator denies checks it could not evaluate
+func TestFailClosed(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	release := make(chan struct{})
+	defer close(release)
+	evaluator.On("CheckPermission", "user:alice", resourceID, "iam.roles.create", mock.Anything).
+		Run(func(mock.Arguments) { <-release }).Return(true, "Allowed", nil)
+
+	assert.Same(t, evaluator, FailClosed(evaluator))
+
+	guarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{TimeoutMS: 20, FailureMode: FailureModeOpen}, nil)
+	require.NoError(t, err)
+	closed := FailClosed(guarded)
+
+	allowed, reason, err := closed.CheckPermission("user:alice", resourceID, "iam.roles.create", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Contains(t, reason, "fail-closed")
+
+	allowed, _, err = guarded.CheckPermission("user:alice", resourceID, "iam.roles.create", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// Admin API checks are denied during the outage
+	authorizer, err := NewAdminAuthorizer(&config.AuthzConfig{Enabled: true, RootResourceID: resourceID.String()}, closed)
+	require.NoError(t, err)
+	assert.ErrorIs(t, authorizer.Authorize("user:alice", "CreateRole", nil), ErrPermissionDenied)
+}
+
+func TestGuardedEvaluator_MaxInFlight(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	evaluator.On("CheckPermission", "user:slow", resourceID, "docs.read", mock.Anything).
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).Return(true, "Allowed", nil)
+	evaluator.On("CheckPermission", "user:fast", resourceID, "docs.read", mock.Anything).Return(true, "Allowed", nil)
+
+	guarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{TimeoutMS: 20, MaxInFlight: 1}, nil)
+	require.NoError(t, err)
+
+	// The timed out check keeps its slot until its evaluation returns
+	allowed, _, err := guarded.CheckPermission("user:slow", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	<-started
+
+	allowed, reason, err := guarded.CheckPermission("user:fast", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Contains(t, reason, ErrEvaluatorOverloaded.Error())
+	evaluator.AssertNotCalled(t, "CheckPermission", "user:fast", resourceID, "docs.read", mock.Anything)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		allowed, _, _ := guarded.CheckPermission("user:fast", resourceID, "docs.read", nil)
+		return allowed
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestGuardedEvaluator_CircuitBreaker(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	dbErr := errors.New("connection refused")
+	failing := evaluator.On("CheckPermission", "user:alice", resourceID, "docs.read", mock.Anything).
+		Return(false, "Error fetching resource", dbErr)
+
+	guarded, err := NewGuardedEvaluator(evaluator, &config.EvaluatorConfig{
+		CircuitBreaker: config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 3, OpenSeconds: 30},
+	}, nil)
+	require.NoError(t, err)
+	breaker := guarded.(*guardedEvaluator).breaker
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	// Evaluation errors are returned until the threshold opens the breaker
+	for i := 0; i < 3; i++ {
+		_, _, err := guarded.CheckPermission("user:alice", resourceID, "docs.read", nil)
+		assert.ErrorIs(t, err, dbErr)
+	}
+	assert.Equal(t, circuitOpen, breaker.state)
+
+	allowed, reason, err := guarded.CheckPermission("user:alice", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Contains(t, reason, ErrCircuitOpen.Error())
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 3)
+
+	// After open_seconds a failed trial reopens the breaker
+	now = now.Add(30 * time.Second)
+	_, _, err = guarded.CheckPermission("user:alice", resourceID, "docs.read", nil)
+	assert.ErrorIs(t, err, dbErr)
+	assert.Equal(t, circuitOpen, breaker.state)
+
+	// A successful trial closes it
+	failing.Unset()
+	evaluator.On("CheckPermission", "user:alice", resourceID, "docs.read", mock.Anything).Return(true, "Allowed", nil)
+	now = now.Add(30 * time.Second)
+	allowed, _, err = guarded.CheckPermission("user:alice", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, circuitClosed, breaker.state)
+}
+
+func TestCircuitBreaker_SingleTrialWhileHalfOpen(t *testing.T) {
+	breaker := newCircuitBreaker(1, time.Second, slog.Default())
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	require.True(t, breaker.allow())
+	breaker.record(false)
+	assert.False(t, breaker.allow())
+
+	now = now.Add(time.Second)
+	var mu sync.Mutex
+	var allowed int
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if breaker.allow() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, allowed)
+	assert.Equal(t, circuitHalfOpen, breaker.state)
+}
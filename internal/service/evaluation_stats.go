@@ -0,0 +1,480 @@
+package service
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEvaluationStatsDisabled is returned by GetEvaluationStats when evaluator.stats is disabled
+var ErrEvaluationStatsDisabled = errors.New("evaluation statistics are not enabled")
+
+const (
+	// DefaultStatsWindow is the period EvaluationStats reports on
+	DefaultStatsWindow = 10 * time.Minute
+	// DefaultStatsMaxTracked bounds the resources and principals EvaluationStats counts per slot
+	DefaultStatsMaxTracked = 10000
+	// MinChecksForDenialRate is the number of checks a resource needs in the window to be ranked
+	// by denial rate, so a single denied check does not top the ranking
+	MinChecksForDenialRate = 10
+	// MaxStatsTopN caps the entries of each ranking of an EvaluationStatsReport
+	MaxStatsTopN = 100
+)
+
+// statsSlots is the number of slots the window is divided into; the oldest slot is dropped as a
+// whole, so the report covers between window*(statsSlots-1)/statsSlots and window
+const statsSlots = 10
+
+// EvaluationStats keeps rolling statistics of the permission checks of the last window: a
+// latency histogram, the slowest checks, and check and denial counts per resource and
+// principal, so operators can spot clients hammering denied checks
+type EvaluationStats struct {
+	slot       time.Duration
+	maxTracked int
+	now        func() time.Time
+
+	mu    sync.Mutex
+	slots [statsSlots]statsSlot
+}
+
+// statsSlot holds the statistics of the checks started in [start, start+slot)
+type statsSlot struct {
+	start      time.Time
+	checks     int64
+	denied     int64
+	failed     int64
+	latency    latencyHistogram
+	slowest    []SlowCheck // Up to MaxStatsTopN, slowest first
+	resources  map[uuid.UUID]*checkCounts
+	principals map[string]*checkCounts
+}
+
+type checkCounts struct {
+	checks int64
+	denied int64
+}
+
+// SlowCheck is one of the slowest checks of the window
+type SlowCheck struct {
+	Principal  string
+	ResourceID uuid.UUID
+	Permission string
+	Latency    time.Duration
+	At         time.Time
+}
+
+// ResourceCheckStats counts the checks on a resource
+type ResourceCheckStats struct {
+	ResourceID uuid.UUID
+	Checks     int64
+	Denied     int64
+	DenialRate float64 // Denied / Checks
+}
+
+// PrincipalCheckStats counts the checks of a principal
+type PrincipalCheckStats struct {
+	Principal string
+	Checks    int64
+	Denied    int64
+}
+
+// LatencySummary summarizes check latencies. Percentiles overestimate by at most 6.25%.
+type LatencySummary struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// EvaluationStatsReport is a snapshot of EvaluationStats
+type EvaluationStatsReport struct {
+	Since  time.Time // Start of the oldest slot reported on
+	Checks int64
+	Denied int64
+	Failed int64 // Checks that returned an error; not counted as denied
+	// Latency of each check; checks of a batch share the average latency of the batch
+	Latency            LatencySummary
+	SlowestChecks      []SlowCheck
+	TopDeniedResources []ResourceCheckStats  // By denial rate, among resources with MinChecksForDenialRate checks
+	TopPrincipals      []PrincipalCheckStats // By number of checks
+}
+
+// NewEvaluationStats creates statistics over the last window (DefaultStatsWindow if zero),
+// counting at most maxTracked resources and principals per tenth of the window
+// (DefaultStatsMaxTracked if zero); checks of others are only counted in the totals.
+func NewEvaluationStats(window time.Duration, maxTracked int) *EvaluationStats {
+	if window <= 0 {
+		window = DefaultStatsWindow
+	}
+	if maxTracked <= 0 {
+		maxTracked = DefaultStatsMaxTracked
+	}
+	slot := window / statsSlots
+	if slot <= 0 {
+		slot = time.Nanosecond
+	}
+	return &EvaluationStats{
+		slot:       slot,
+		maxTracked: maxTracked,
+		now:        time.Now,
+	}
+}
+
+// Record counts a check started at start
+func (s *EvaluationStats) Record(principal string, resourceID uuid.UUID, permission string, allowed, failed bool, latency time.Duration, start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot := s.slotAt(start)
+	if slot == nil {
+		return
+	}
+	slot.checks++
+	slot.latency.record(latency)
+
+	if len(slot.slowest) < MaxStatsTopN || latency > slot.slowest[len(slot.slowest)-1].Latency {
+		check := SlowCheck{Principal: principal, ResourceID: resourceID, Permission: permission, Latency: latency, At: start}
+		i := sort.Search(len(slot.slowest), func(i int) bool { return slot.slowest[i].Latency < latency })
+		slot.slowest = append(slot.slowest, SlowCheck{})
+		copy(slot.slowest[i+1:], slot.slowest[i:])
+		slot.slowest[i] = check
+		if len(slot.slowest) > MaxStatsTopN {
+			slot.slowest = slot.slowest[:MaxStatsTopN]
+		}
+	}
+
+	if failed {
+		// Failed checks are not decisions, so they are not counted per resource or principal
+		slot.failed++
+		return
+	}
+	if !allowed {
+		slot.denied++
+	}
+	if counts := trackedCounts(slot.resources, resourceID, s.maxTracked); counts != nil {
+		counts.checks++
+		if !allowed {
+			counts.denied++
+		}
+	}
+	if counts := trackedCounts(slot.principals, principal, s.maxTracked); counts != nil {
+		counts.checks++
+		if !allowed {
+			counts.denied++
+		}
+	}
+}
+
+// slotAt returns the slot of time t, resetting it when it holds an older period; nil when it
+// already holds a newer one, i.e. t is older than the window
+func (s *EvaluationStats) slotAt(t time.Time) *statsSlot {
+	start := t.Truncate(s.slot)
+	slot := &s.slots[(start.UnixNano()/int64(s.slot))%statsSlots]
+	if slot.start.After(start) {
+		return nil
+	}
+	if !slot.start.Equal(start) {
+		*slot = statsSlot{
+			start:      start,
+			resources:  make(map[uuid.UUID]*checkCounts),
+			principals: make(map[string]*checkCounts),
+		}
+	}
+	return slot
+}
+
+// trackedCounts returns the counts of key, adding them unless limit keys are already tracked
+func trackedCounts[K comparable](counts map[K]*checkCounts, key K, limit int) *checkCounts {
+	c, ok := counts[key]
+	if !ok {
+		if len(counts) >= limit {
+			return nil
+		}
+		c = &checkCounts{}
+		counts[key] = c
+	}
+	return c
+}
+
+// Report returns the statistics of the window with the topN entries of each ranking
+func (s *EvaluationStats) Report(topN int) EvaluationStatsReport {
+	topN = min(max(topN, 0), MaxStatsTopN)
+
+	s.mu.Lock()
+	oldest := s.now().Truncate(s.slot).Add(-(statsSlots - 1) * s.slot)
+	report := EvaluationStatsReport{Since: oldest}
+	var latency latencyHistogram
+	var slowest []SlowCheck
+	resources := make(map[uuid.UUID]*checkCounts)
+	principals := make(map[string]*checkCounts)
+	for i := range s.slots {
+		slot := &s.slots[i]
+		if slot.start.IsZero() || slot.start.Before(oldest) {
+			continue
+		}
+		report.Checks += slot.checks
+		report.Denied += slot.denied
+		report.Failed += slot.failed
+		latency.merge(&slot.latency)
+		slowest = append(slowest, slot.slowest...)
+		for id, counts := range slot.resources {
+			addCounts(resources, id, counts)
+		}
+		for principal, counts := range slot.principals {
+			addCounts(principals, principal, counts)
+		}
+	}
+	s.mu.Unlock()
+
+	report.Latency = latency.summary()
+
+	sort.Slice(slowest, func(i, j int) bool { return slowest[i].Latency > slowest[j].Latency })
+	report.SlowestChecks = slowest[:min(topN, len(slowest))]
+
+	for id, counts := range resources {
+		if counts.denied == 0 || counts.checks < MinChecksForDenialRate {
+			continue
+		}
+		report.TopDeniedResources = append(report.TopDeniedResources, ResourceCheckStats{
+			ResourceID: id,
+			Checks:     counts.checks,
+			Denied:     counts.denied,
+			DenialRate: float64(counts.denied) / float64(counts.checks),
+		})
+	}
+	sort.Slice(report.TopDeniedResources, func(i, j int) bool {
+		a, b := report.TopDeniedResources[i], report.TopDeniedResources[j]
+		if a.DenialRate != b.DenialRate {
+			return a.DenialRate > b.DenialRate
+		}
+		if a.Denied != b.Denied {
+			return a.Denied > b.Denied
+		}
+		return a.ResourceID.String() < b.ResourceID.String()
+	})
+	report.TopDeniedResources = report.TopDeniedResources[:min(topN, len(report.TopDeniedResources))]
+
+	for principal, counts := range principals {
+		report.TopPrincipals = append(report.TopPrincipals, PrincipalCheckStats{
+			Principal: principal,
+			Checks:    counts.checks,
+			Denied:    counts.denied,
+		})
+	}
+	sort.Slice(report.TopPrincipals, func(i, j int) bool {
+		a, b := report.TopPrincipals[i], report.TopPrincipals[j]
+		if a.Checks != b.Checks {
+			return a.Checks > b.Checks
+		}
+		return a.Principal < b.Principal
+	})
+	report.TopPrincipals = report.TopPrincipals[:min(topN, len(report.TopPrincipals))]
+
+	return report
+}
+
+func addCounts[K comparable](into map[K]*checkCounts, key K, counts *checkCounts) {
+	total, ok := into[key]
+	if !ok {
+		total = &checkCounts{}
+		into[key] = total
+	}
+	total.checks += counts.checks
+	total.denied += counts.denied
+}
+
+// histogramSubBuckets is the number of buckets per power of two of a latencyHistogram
+const histogramSubBuckets = 32
+
+// latencyHistogram counts latencies in microseconds in log-linear buckets, as an HDR histogram
+// does: values below histogramSubBuckets have a bucket each, and every larger power of two is
+// split into histogramSubBuckets/2 buckets, so a bucket spans at most 1/16 of its values
+type latencyHistogram struct {
+	counts [64 * histogramSubBuckets / 2]int64
+	total  int64
+	max    time.Duration
+}
+
+// histogramBucket returns the bucket of a value in microseconds
+func histogramBucket(us uint64) int {
+	if us < histogramSubBuckets {
+		return int(us)
+	}
+	// Shift the value so it falls in [histogramSubBuckets/2, histogramSubBuckets)
+	shift := bits.Len64(us) - bits.Len64(histogramSubBuckets-1)
+	return shift*histogramSubBuckets/2 + int(us>>shift)
+}
+
+// histogramBucketMax returns the largest value in microseconds of a bucket
+func histogramBucketMax(bucket int) uint64 {
+	if bucket < histogramSubBuckets {
+		return uint64(bucket)
+	}
+	shift := bucket/(histogramSubBuckets/2) - 1
+	sub := uint64(bucket%(histogramSubBuckets/2) + histogramSubBuckets/2)
+	return (sub+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	us := max(latency.Microseconds(), 0)
+	h.counts[histogramBucket(uint64(us))]++
+	h.total++
+	h.max = max(h.max, latency)
+}
+
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.max = max(h.max, other.max)
+}
+
+// percentile returns the upper bound of the bucket holding the q quantile, capped at the maximum
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.total) + 0.5)
+	rank = min(max(rank, 1), h.total)
+
+	var seen int64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return min(time.Duration(histogramBucketMax(bucket))*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) summary() LatencySummary {
+	return LatencySummary{
+		P50: h.percentile(0.50),
+		P90: h.percentile(0.90),
+		P99: h.percentile(0.99),
+		Max: h.max,
+	}
+}
+
+// statsEvaluator records every check in an EvaluationStats
+type statsEvaluator struct {
+	PermissionEvaluator
+	stats *EvaluationStats
+}
+
+// NewStatsEvaluator wraps evaluator so every permission check is counted in stats
+func NewStatsEvaluator(evaluator PermissionEvaluator, stats *EvaluationStats) PermissionEvaluator {
+	return &statsEvaluator{
+		PermissionEvaluator: evaluator,
+		stats:               stats,
+	}
+}
+
+func (se *statsEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(se.Check(principal, resourceID, permission, context))
+}
+
+func (se *statsEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	start := se.stats.now()
+	result, err := se.PermissionEvaluator.Check(principal, resourceID, permission, context)
+	se.stats.Record(principal, resourceID, permission, result.Allowed, err != nil, se.stats.now().Sub(start), start)
+	return result, err
+}
+
+func (se *statsEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	start := se.stats.now()
+	results, err := se.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+
+	// The batch shares its loads, so each check is counted with the average latency
+	var latency time.Duration
+	if len(checks) > 0 {
+		latency = se.stats.now().Sub(start) / time.Duration(len(checks))
+	}
+	for i, check := range checks {
+		allowed := err == nil && results[i].Allowed
+		se.stats.Record(principal, check.ResourceID, check.Permission, allowed, err != nil, latency, start)
+	}
+	return results, err
+}
+
+func (se *statsEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	start := se.stats.now()
+	results, err := se.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+
+	// The checks share their loads, so each is counted with the average latency
+	var latency time.Duration
+	if len(principals) > 0 {
+		latency = se.stats.now().Sub(start) / time.Duration(len(principals))
+	}
+	for i, principal := range principals {
+		allowed := err == nil && results[i].Allowed
+		se.stats.Record(principal, resourceID, permission, allowed, err != nil, latency, start)
+	}
+	return results, err
+}
+
+func (se *statsEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	start := se.stats.now()
+	granted, err := se.PermissionEvaluator.TestPermissions(principal, resourceID, permissions, context)
+
+	var latency time.Duration
+	if len(permissions) > 0 {
+		latency = se.stats.now().Sub(start) / time.Duration(len(permissions))
+	}
+	allowed := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		allowed[permission] = true
+	}
+	for _, permission := range permissions {
+		se.stats.Record(principal, resourceID, permission, allowed[permission], err != nil, latency, start)
+	}
+	return granted, err
+}
+
+// SetEvaluationStats enables GetEvaluationStats. It must be called before the service starts
+// handling requests.
+func (s *IAMService) SetEvaluationStats(stats *EvaluationStats) {
+	s.evaluationStats = stats
+}
+
+// GetEvaluationStats reports the statistics of the recent permission checks, with the topN
+// (10 if zero, at most MaxStatsTopN) entries of each ranking
+func (s *IAMService) GetEvaluationStats(topN int) (*EvaluationStatsReport, error) {
+	if err := s.authorize("GetEvaluationStats", nil); err != nil {
+		return nil, err
+	}
+	if s.evaluationStats == nil {
+		return nil, ErrEvaluationStatsDisabled
+	}
+
+	if topN == 0 {
+		topN = 10
+	}
+	report := s.evaluationStats.Report(topN)
+	return &report, nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, us := range []uint64{0, 1, 31, 32, 33, 63, 64, 100, 1000, 12345, 1 << 40, 1<<63 + 1} {
+		bucket := histogramBucket(us)
+		assert.GreaterOrEqual(t, histogramBucketMax(bucket), us, "value %d", us)
+		if bucket > 0 {
+			assert.Less(t, histogramBucketMax(bucket-1), us, "value %d", us)
+		}
+		// A bucket spans at most 1/16 of its values
+		assert.LessOrEqual(t, histogramBucketMax(bucket)-us, us/16, "value %d", us)
+	}
+}
+
+func TestEvaluationStats_Report(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := NewEvaluationStats(10*time.Minute, 0)
+	stats.now = func() time.Time { return now }
+
+	noisy, quiet, once := uuid.New(), uuid.New(), uuid.New()
+	for i := 0; i < 20; i++ {
+		stats.Record("user:bot@example.com", noisy, "storage.buckets.get", i%10 == 0, false, time.Millisecond, now)
+	}
+	for i := 0; i < 10; i++ {
+		stats.Record("user:alice@example.com", quiet, "storage.buckets.get", i != 0, false, 2*time.Millisecond, now)
+	}
+	stats.Record("user:alice@example.com", once, "storage.buckets.get", false, false, time.Second, now)
+	stats.Record("user:alice@example.com", once, "storage.buckets.get", false, true, 3*time.Second, now)
+
+	report := stats.Report(2)
+	assert.Equal(t, int64(32), report.Checks)
+	assert.Equal(t, int64(20), report.Denied)
+	assert.Equal(t, int64(1), report.Failed)
+	assert.Equal(t, 3*time.Second, report.Latency.Max)
+	assert.InDelta(t, float64(time.Millisecond), float64(report.Latency.P50), float64(time.Millisecond)/16)
+	assert.InDelta(t, float64(2*time.Millisecond), float64(report.Latency.P90), float64(2*time.Millisecond)/16)
+
+	require.Len(t, report.SlowestChecks, 2)
+	assert.Equal(t, 3*time.Second, report.SlowestChecks[0].Latency)
+	assert.Equal(t, once, report.SlowestChecks[1].ResourceID)
+
+	// The resource denied once out of one check has too few checks to be ranked
+	assert.Equal(t, []ResourceCheckStats{
+		{ResourceID: noisy, Checks: 20, Denied: 18, DenialRate: 0.9},
+		{ResourceID: quiet, Checks: 10, Denied: 1, DenialRate: 0.1},
+	}, report.TopDeniedResources)
+	assert.Equal(t, []PrincipalCheckStats{
+		{Principal: "user:bot@example.com", Checks: 20, Denied: 18},
+		{Principal: "user:alice@example.com", Checks: 11, Denied: 2},
+	}, report.TopPrincipals)
+
+	// Checks leave the report once their slot is out of the window
+	now = now.Add(10 * time.Minute)
+	stats.Record("user:alice@example.com", quiet, "storage.buckets.get", true, false, time.Millisecond, now)
+	report = stats.Report(10)
+	assert.Equal(t, int64(1), report.Checks)
+	assert.Empty(t, report.TopDeniedResources)
+
+	// Checks started before the window are ignored rather than clearing newer slots
+	stats.Record("user:alice@example.com", quiet, "storage.buckets.get", false, false, time.Millisecond, now.Add(-10*time.Minute))
+	assert.Equal(t, int64(1), stats.Report(10).Checks)
+}
+
+func TestEvaluationStats_MaxTracked(t *testing.T) {
+	stats := NewEvaluationStats(time.Minute, 1)
+	now := time.Now()
+	stats.Record("user:alice@example.com", uuid.New(), "storage.buckets.get", true, false, time.Millisecond, now)
+	stats.Record("user:bob@example.com", uuid.New(), "storage.buckets.get", true, false, time.Millisecond, now)
+
+	report := stats.Report(10)
+	assert.Equal(t, int64(2), report.Checks, "untracked checks still count in the totals")
+	assert.Len(t, report.TopPrincipals, 1)
+}
+
+func TestStatsEvaluator_RecordsChecks(t *testing.T) {
+	inner := new(MockPermissionEvaluator)
+	stats := NewEvaluationStats(time.Minute, 0)
+	evaluator := NewStatsEvaluator(inner, stats)
+	resourceID := uuid.New()
+
+	inner.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).
+		Return(false, "no binding", nil)
+	checks := []PermissionCheck{
+		{ResourceID: resourceID, Permission: "storage.buckets.get"},
+		{ResourceID: resourceID, Permission: "storage.buckets.delete"},
+	}
+	inner.On("BatchCheckPermissions", "user:alice@example.com", checks).Return(nil, errors.New("database unavailable"))
+	inner.On("TestPermissions", "user:alice@example.com", resourceID, []string{"storage.buckets.get", "storage.buckets.list"}, map[string]string(nil)).
+		Return([]string{"storage.buckets.list"}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	_, err = evaluator.BatchCheckPermissions("user:alice@example.com", checks)
+	assert.Error(t, err)
+	_, err = evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"storage.buckets.get", "storage.buckets.list"}, nil)
+	require.NoError(t, err)
+
+	report := stats.Report(10)
+	assert.Equal(t, int64(5), report.Checks)
+	assert.Equal(t, int64(2), report.Denied)
+	assert.Equal(t, int64(2), report.Failed)
+	assert.Equal(t, []PrincipalCheckStats{{Principal: "user:alice@example.com", Checks: 3, Denied: 2}}, report.TopPrincipals)
+}
+
+func TestIAMService_GetEvaluationStats(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.GetEvaluationStats(0)
+	assert.ErrorIs(t, err, ErrEvaluationStatsDisabled)
+
+	stats := NewEvaluationStats(time.Minute, 0)
+	for i := 0; i < 15; i++ {
+		stats.Record("user:alice@example.com", uuid.New(), "storage.buckets.get", true, false, time.Millisecond, time.Now())
+	}
+	service.SetEvaluationStats(stats)
+
+	report, err := service.GetEvaluationStats(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), report.Checks)
+	assert.Len(t, report.SlowestChecks, 10)
+}
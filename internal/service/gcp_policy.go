@@ -0,0 +1,175 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// GCPPolicy is a google.iam.v1.Policy in its JSON form, as read and written by
+// "gcloud ... get-iam-policy --format=json" and "set-iam-policy". Audit configs are not part of
+// it and are ignored when parsing.
+type GCPPolicy struct {
+	Version  int          `json:"version,omitempty"` // 3 when a binding has a condition
+	Etag     string       `json:"etag,omitempty"`
+	Bindings []GCPBinding `json:"bindings,omitempty"`
+}
+
+// GCPBinding is a google.iam.v1.Binding
+type GCPBinding struct {
+	Role      string   `json:"role"`
+	Members   []string `json:"members"`
+	Condition *GCPExpr `json:"condition,omitempty"`
+}
+
+// GCPExpr is the google.type.Expr condition of a GCPBinding
+type GCPExpr struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression"`
+}
+
+// gcpConditionalPolicyVersion is the version of GCP policies with conditional bindings
+const gcpConditionalPolicyVersion = 3
+
+// ParseGCPPolicy reads a google.iam.v1.Policy JSON document
+func ParseGCPPolicy(r io.Reader) (*GCPPolicy, error) {
+	policy := &GCPPolicy{}
+	if err := json.NewDecoder(r).Decode(policy); err != nil {
+		return nil, fmt.Errorf("failed to parse gcp policy: %w", err)
+	}
+	return policy, nil
+}
+
+// ParseGCPRoleMappings reads a YAML (or JSON) map of GCP role names to the names of the roles
+// that replace them, e.g.
+//
+//	roles/storage.objectViewer: roles/storage.viewer
+//	projects/acme/roles/deployer: roles/deployer
+func ParseGCPRoleMappings(r io.Reader) (map[string]string, error) {
+	mappings := make(map[string]string)
+	if err := yaml.NewDecoder(r).Decode(&mappings); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse role mappings: %w", err)
+	}
+	for gcpRole, role := range mappings {
+		if gcpRole == "" || role == "" {
+			return nil, fmt.Errorf("invalid role mapping %q: %q: names are required", gcpRole, role)
+		}
+	}
+	return mappings, nil
+}
+
+// ImportGCPPolicy replaces the bindings of a resource's policy with those of a GCP policy, as
+// SetPolicy would. Each GCP role is mapped through roleMappings, and roles without a mapping
+// keep their name; every role must exist. Members and conditions are kept as they are, so
+// members this server does not support, such as "deleted:" or "principal://" members, and
+// conditions it cannot compile are rejected. Every problem is reported at once, before anything
+// is written. The etag of the GCP policy is ignored.
+func (s *IAMService) ImportGCPPolicy(resourceID uuid.UUID, policy *GCPPolicy, roleMappings map[string]string) (*domain.Policy, error) {
+	if err := s.authorize("ImportGCPPolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	roles := make(map[string]*domain.Role)
+	bindings := make([]domain.Binding, 0, len(policy.Bindings))
+	for i, gcpBinding := range policy.Bindings {
+		name := gcpBinding.Role
+		if mapped, ok := roleMappings[name]; ok {
+			name = mapped
+		}
+		role, ok := roles[name]
+		if !ok {
+			var err error
+			if role, err = s.roleRepo.GetByName(name); err != nil {
+				return nil, fmt.Errorf("failed to get role %q: %w", name, err)
+			}
+			roles[name] = role
+		}
+		if role == nil {
+			problems = append(problems, fmt.Sprintf("bindings[%d]: role %q not found; map it to an existing role", i, gcpBinding.Role))
+			continue
+		}
+
+		members, err := membersJSON(gcpBinding.Members)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("bindings[%d]: %v", i, err))
+			continue
+		}
+		binding := domain.Binding{RoleID: role.ID, Members: members}
+		if expr := gcpBinding.Condition; expr != nil {
+			if err := s.ValidateCondition(expr.Expression); err != nil {
+				problems = append(problems, fmt.Sprintf("bindings[%d]: %v", i, err))
+				continue
+			}
+			binding.Condition = &domain.Condition{Title: expr.Title, Description: expr.Description, Expression: expr.Expression}
+		}
+		bindings = append(bindings, binding)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid gcp policy:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	return s.SetPolicy(resourceID, bindings, "")
+}
+
+// ExportGCPPolicy converts the policy of a resource to a GCP policy, mapping the name of each
+// role back through roleMappings; when several GCP roles map to a role, the first in name order
+// is used. Bindings are in canonical order, and annotations, which GCP policies do not have, are
+// dropped. A resource without a policy exports an empty one.
+func (s *IAMService) ExportGCPPolicy(resourceID uuid.UUID, roleMappings map[string]string) (*GCPPolicy, error) {
+	if err := s.authorize("ExportGCPPolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	exported := &GCPPolicy{Version: 1, Bindings: []GCPBinding{}}
+	if policy == nil {
+		return exported, nil
+	}
+	exported.Etag = policy.ETag
+
+	gcpRoles := make(map[string]string, len(roleMappings))
+	for _, gcpRole := range slices.Sorted(maps.Keys(roleMappings)) {
+		if _, ok := gcpRoles[roleMappings[gcpRole]]; !ok {
+			gcpRoles[roleMappings[gcpRole]] = gcpRole
+		}
+	}
+
+	for _, binding := range canonicalPolicy(policy).Bindings {
+		role := binding.Role
+		if role == nil {
+			if role, err = s.roleRepo.GetByID(binding.RoleID); err != nil {
+				return nil, fmt.Errorf("failed to get role: %w", err)
+			}
+			if role == nil {
+				return nil, fmt.Errorf("role %s not found", binding.RoleID)
+			}
+		}
+		members, err := binding.GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("invalid members: %w", err)
+		}
+
+		gcpBinding := GCPBinding{Role: role.Name, Members: members}
+		if gcpRole, ok := gcpRoles[role.Name]; ok {
+			gcpBinding.Role = gcpRole
+		}
+		if condition := binding.Condition; condition != nil {
+			gcpBinding.Condition = &GCPExpr{Title: condition.Title, Description: condition.Description, Expression: condition.Expression}
+			exported.Version = gcpConditionalPolicyVersion
+		}
+		exported.Bindings = append(exported.Bindings, gcpBinding)
+	}
+	return exported, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testGCPPolicyJSON is a policy as written by gcloud projects get-iam-policy --format=json
+const testGCPPolicyJSON = `{
+  "auditConfigs": [{"service": "allServices", "auditLogConfigs": [{"logType": "DATA_READ"}]}],
+  "bindings": [
+    {
+      "members": ["group:sre@example.com", "user:alice@example.com"],
+      "role": "roles/storage.objectViewer"
+    },
+    {
+      "condition": {
+        "description": "Until the end of the migration",
+        "expression": "request.time < timestamp('2030-01-01T00:00:00Z')",
+        "title": "temporary"
+      },
+      "members": ["serviceAccount:deployer@acme.iam.gserviceaccount.com"],
+      "role": "roles/deployer"
+    }
+  ],
+  "etag": "BwXhqDdVq3k=",
+  "version": 3
+}`
+
+func TestParseGCPPolicy(t *testing.T) {
+	policy, err := ParseGCPPolicy(strings.NewReader(testGCPPolicyJSON))
+	require.NoError(t, err)
+	assert.Equal(t, 3, policy.Version)
+	require.Len(t, policy.Bindings, 2)
+	assert.Equal(t, "roles/storage.objectViewer", policy.Bindings[0].Role)
+	assert.Equal(t, "temporary", policy.Bindings[1].Condition.Title)
+
+	_, err = ParseGCPPolicy(strings.NewReader(`{"bindings": {}}`))
+	assert.ErrorContains(t, err, "failed to parse gcp policy")
+}
+
+func TestParseGCPRoleMappings(t *testing.T) {
+	mappings, err := ParseGCPRoleMappings(strings.NewReader("roles/storage.objectViewer: roles/storage.viewer\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"roles/storage.objectViewer": "roles/storage.viewer"}, mappings)
+
+	mappings, err = ParseGCPRoleMappings(strings.NewReader(`{"roles/owner": "roles/admin"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "roles/admin", mappings["roles/owner"])
+
+	_, err = ParseGCPRoleMappings(strings.NewReader("roles/owner: \"\"\n"))
+	assert.Error(t, err)
+}
+
+func TestIAMService_ImportGCPPolicy(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	resourceID := uuid.New()
+	viewer := &domain.Role{ID: uuid.New(), Name: "roles/storage.viewer"}
+	deployer := &domain.Role{ID: uuid.New(), Name: "roles/deployer", IsCustom: true}
+	for _, role := range []*domain.Role{viewer, deployer} {
+		roleRepo.On("GetByName", role.Name).Return(role, nil)
+		roleRepo.On("GetByID", role.ID).Return(role, nil)
+	}
+	policyRepo.On("GetByResourceID", resourceID).Return(nil, nil)
+
+	gcp, err := ParseGCPPolicy(strings.NewReader(testGCPPolicyJSON))
+	require.NoError(t, err)
+	policy, err := service.DryRun().ImportGCPPolicy(resourceID, gcp, map[string]string{"roles/storage.objectViewer": "roles/storage.viewer"})
+	require.NoError(t, err)
+	require.Len(t, policy.Bindings, 2)
+	byRole := make(map[uuid.UUID]domain.Binding)
+	for _, binding := range policy.Bindings {
+		byRole[binding.RoleID] = binding
+	}
+	assert.JSONEq(t, `["group:sre@example.com","user:alice@example.com"]`, string(byRole[viewer.ID].Members))
+	assert.Nil(t, byRole[viewer.ID].Condition)
+	require.NotNil(t, byRole[deployer.ID].Condition)
+	assert.Equal(t, "Until the end of the migration", byRole[deployer.ID].Condition.Description)
+	bindingRepo.AssertNotCalled(t, "CreateBatch")
+
+	// Unmapped roles and unsupported members are reported together
+	roleRepo.On("GetByName", "roles/storage.objectViewer").Return(nil, nil)
+	gcp.Bindings[1].Members = append(gcp.Bindings[1].Members, "deleted:user:bob@example.com?uid=123")
+	_, err = service.DryRun().ImportGCPPolicy(resourceID, gcp, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `bindings[0]: role "roles/storage.objectViewer" not found`)
+	assert.Contains(t, err.Error(), `bindings[1]: invalid principal "deleted:user:bob@example.com?uid=123"`)
+}
+
+func TestIAMService_ExportGCPPolicy(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	resourceID := uuid.New()
+	viewer := &domain.Role{ID: uuid.New(), Name: "roles/storage.viewer"}
+	deployer := &domain.Role{ID: uuid.New(), Name: "roles/deployer"}
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ID: uuid.New(), ResourceID: resourceID, ETag: "etag-1", Bindings: []domain.Binding{
+		{RoleID: viewer.ID, Role: viewer, Members: toJSON([]string{"user:alice@example.com", "group:sre@example.com"})},
+		{RoleID: deployer.ID, Role: deployer, Members: toJSON([]string{"serviceAccount:deployer@acme.iam.gserviceaccount.com"}),
+			Condition: &domain.Condition{Title: "temporary", Expression: "request.time < timestamp('2030-01-01T00:00:00Z')"}},
+	}}, nil)
+
+	exported, err := service.ExportGCPPolicy(resourceID, map[string]string{
+		"roles/storage.objectViewer": "roles/storage.viewer",
+		"roles/storage.legacyReader": "roles/storage.viewer",
+	})
+	require.NoError(t, err)
+	encoded, err := json.Marshal(exported)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"version": 3,
+		"etag": "etag-1",
+		"bindings": [
+			{
+				"role": "roles/deployer",
+				"members": ["serviceAccount:deployer@acme.iam.gserviceaccount.com"],
+				"condition": {"title": "temporary", "expression": "request.time < timestamp('2030-01-01T00:00:00Z')"}
+			},
+			{"role": "roles/storage.legacyReader", "members": ["group:sre@example.com", "user:alice@example.com"]}
+		]
+	}`, string(encoded))
+
+	empty := uuid.New()
+	policyRepo.On("GetByResourceID", empty).Return(nil, nil)
+	exported, err = service.ExportGCPPolicy(empty, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &GCPPolicy{Version: 1, Bindings: []GCPBinding{}}, exported)
+}
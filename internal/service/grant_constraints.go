@@ -0,0 +1,340 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"gorm.io/datatypes"
+)
+
+// ErrGrantConstraintsDisabled is returned by the grant constraint APIs when no repository is configured
+var ErrGrantConstraintsDisabled = errors.New("grant constraints are not enabled")
+
+// GrantChange describes how a request changes the bindings of a resource's policy
+type GrantChange struct {
+	Add     []domain.Binding // Bindings added, or the complete new bindings when Replace is set
+	Remove  []uuid.UUID      // IDs of the bindings removed
+	Replace bool             // Add replaces every binding, as in CreatePolicy, UpdatePolicy and RollbackPolicy
+}
+
+// SetGrantConstraints enables delegated administration through grant constraints.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetGrantConstraints(constraints repository.GrantConstraintRepository) {
+	s.grantConstraintRepo = constraints
+}
+
+// CreateGrantConstraint restricts the roles members may grant or revoke on resourceID and its
+// descendants to allowedRoles
+func (s *IAMService) CreateGrantConstraint(
+	resourceID uuid.UUID,
+	members, allowedRoles []string,
+	description string,
+) (*domain.GrantConstraint, error) {
+	if err := s.authorize("CreateGrantConstraint", &resourceID); err != nil {
+		return nil, err
+	}
+	if s.callerView {
+		if err := s.AuthorizeGrantConstraintChange(s.caller, resourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.grantConstraintRepo == nil {
+		return nil, ErrGrantConstraintsDisabled
+	}
+
+	resource, err := s.resourceRepo.GetByID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	constraint := &domain.GrantConstraint{ResourceID: resourceID, Description: description}
+	if err := s.setGrantConstraintFields(constraint, members, allowedRoles); err != nil {
+		return nil, err
+	}
+
+	if err := s.grantConstraintRepo.Create(constraint); err != nil {
+		return nil, fmt.Errorf("failed to create grant constraint: %w", err)
+	}
+	return constraint, nil
+}
+
+// GetGrantConstraint gets a grant constraint by ID
+func (s *IAMService) GetGrantConstraint(id uuid.UUID) (*domain.GrantConstraint, error) {
+	if err := s.authorizeGrantConstraint("GetGrantConstraint", id, false); err != nil {
+		return nil, err
+	}
+
+	if s.grantConstraintRepo == nil {
+		return nil, ErrGrantConstraintsDisabled
+	}
+	return s.grantConstraintRepo.GetByID(id)
+}
+
+// UpdateGrantConstraint replaces the members, allowed roles and description of a grant constraint
+func (s *IAMService) UpdateGrantConstraint(
+	id uuid.UUID,
+	members, allowedRoles []string,
+	description string,
+) (*domain.GrantConstraint, error) {
+	if err := s.authorizeGrantConstraint("UpdateGrantConstraint", id, true); err != nil {
+		return nil, err
+	}
+
+	if s.grantConstraintRepo == nil {
+		return nil, ErrGrantConstraintsDisabled
+	}
+
+	constraint, err := s.grantConstraintRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if constraint == nil {
+		return nil, fmt.Errorf("grant constraint not found")
+	}
+
+	constraint.Description = description
+	if err := s.setGrantConstraintFields(constraint, members, allowedRoles); err != nil {
+		return nil, err
+	}
+
+	if err := s.grantConstraintRepo.Update(constraint); err != nil {
+		return nil, fmt.Errorf("failed to update grant constraint: %w", err)
+	}
+	return constraint, nil
+}
+
+// DeleteGrantConstraint deletes a grant constraint
+func (s *IAMService) DeleteGrantConstraint(id uuid.UUID) error {
+	if err := s.authorizeGrantConstraint("DeleteGrantConstraint", id, true); err != nil {
+		return err
+	}
+
+	if s.grantConstraintRepo == nil {
+		return ErrGrantConstraintsDisabled
+	}
+	return s.grantConstraintRepo.Delete(id)
+}
+
+// ListGrantConstraints lists grant constraints, optionally only those defined on resourceID
+func (s *IAMService) ListGrantConstraints(resourceID *uuid.UUID, pageSize, offset int) ([]domain.GrantConstraint, error) {
+	if err := s.authorize("ListGrantConstraints", resourceID); err != nil {
+		return nil, err
+	}
+
+	if s.grantConstraintRepo == nil {
+		return nil, ErrGrantConstraintsDisabled
+	}
+	return s.grantConstraintRepo.List(resourceID, pageSize, offset)
+}
+
+// setGrantConstraintFields validates and stores the members and allowed roles of a constraint
+func (s *IAMService) setGrantConstraintFields(constraint *domain.GrantConstraint, members, allowedRoles []string) error {
+	if len(members) == 0 {
+		return fmt.Errorf("grant constraint requires at least one member")
+	}
+	for _, name := range allowedRoles {
+		role, err := s.roleRepo.GetByName(name)
+		if err != nil {
+			return fmt.Errorf("failed to get role %q: %w", name, err)
+		}
+		if role == nil {
+			return fmt.Errorf("role %q not found", name)
+		}
+	}
+	if allowedRoles == nil {
+		allowedRoles = []string{}
+	}
+
+	membersJSON, err := json.Marshal(members)
+	if err != nil {
+		return fmt.Errorf("failed to marshal members: %w", err)
+	}
+	rolesJSON, err := json.Marshal(allowedRoles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal allowed roles: %w", err)
+	}
+	constraint.Members = datatypes.JSON(membersJSON)
+	constraint.AllowedRoles = datatypes.JSON(rolesJSON)
+	return nil
+}
+
+// AuthorizeGrants checks the grant constraints of caller on resourceID and its ancestors.
+// Every role whose grants the change adds, removes or modifies (e.g. a new condition) must be
+// allowed by each constraint that applies to caller; unchanged bindings of other roles may be
+// kept as they are. Callers without applicable constraints are not restricted beyond the
+// admin permission checks. Caller views (AsCaller) check it after the admin permission in
+// CreateBinding, DeleteBinding, BatchCreateBindings, BatchDeleteBindings, CreatePolicy,
+// UpdatePolicy, RollbackPolicy (with the bindings of the restored revision) and DeletePolicy.
+func (s *IAMService) AuthorizeGrants(caller string, resourceID uuid.UUID, change GrantChange) error {
+	if s.grantConstraintRepo == nil || caller == "" {
+		return nil
+	}
+
+	constraints, err := s.applicableGrantConstraints(caller, resourceID)
+	if err != nil {
+		return err
+	}
+	if len(constraints) == 0 {
+		return nil
+	}
+
+	roleIDs, err := s.changedRoles(resourceID, change)
+	if err != nil {
+		return err
+	}
+
+	for _, roleID := range roleIDs {
+		role, err := s.roleRepo.GetByID(roleID)
+		if err != nil {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		name := roleID.String()
+		if role != nil {
+			name = role.Name
+		}
+		for i := range constraints {
+			if !constraints[i].Allows(name) {
+				return fmt.Errorf("%w: grant constraint %s does not allow %s to grant or revoke %s",
+					ErrPermissionDenied, constraints[i].ID, caller, name)
+			}
+		}
+	}
+	return nil
+}
+
+// AuthorizeGrantConstraintChange checks that caller is not itself bound by a grant constraint
+// on resourceID or its ancestors, so delegated administrators cannot widen their own limits.
+// Caller views (AsCaller) check it after the admin permission in CreateGrantConstraint,
+// UpdateGrantConstraint and DeleteGrantConstraint.
+func (s *IAMService) AuthorizeGrantConstraintChange(caller string, resourceID uuid.UUID) error {
+	if s.grantConstraintRepo == nil || caller == "" {
+		return nil
+	}
+
+	constraints, err := s.applicableGrantConstraints(caller, resourceID)
+	if err != nil {
+		return err
+	}
+	if len(constraints) > 0 {
+		return fmt.Errorf("%w: %s is restricted by grant constraint %s and cannot manage grant constraints here",
+			ErrPermissionDenied, caller, constraints[0].ID)
+	}
+	return nil
+}
+
+// applicableGrantConstraints returns the constraints on resourceID and its ancestors whose members include caller
+func (s *IAMService) applicableGrantConstraints(caller string, resourceID uuid.UUID) ([]domain.GrantConstraint, error) {
+	ancestors, err := s.resourceRepo.GetAncestors(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	ids := make([]uuid.UUID, 0, len(ancestors)+1)
+	ids = append(ids, resourceID)
+	for i := range ancestors {
+		if ancestors[i].ID != resourceID {
+			ids = append(ids, ancestors[i].ID)
+		}
+	}
+
+	constraints, err := s.grantConstraintRepo.ListByResources(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grant constraints: %w", err)
+	}
+
+	var applicable []domain.GrantConstraint
+	for i := range constraints {
+		if constraints[i].AppliesTo(caller) {
+			applicable = append(applicable, constraints[i])
+		}
+	}
+	return applicable, nil
+}
+
+// changedRoles returns the roles whose (member, condition) grants on resourceID differ
+// between the stored policy and the policy after the change
+func (s *IAMService) changedRoles(resourceID uuid.UUID, change GrantChange) ([]uuid.UUID, error) {
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	var current []domain.Binding
+	if policy != nil {
+		current = policy.Bindings
+	}
+
+	before, err := grantSet(current)
+	if err != nil {
+		return nil, err
+	}
+	added, err := grantSet(change.Add)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[uuid.UUID]bool)
+	for key, roleID := range added {
+		if _, ok := before[key]; !ok {
+			changed[roleID] = true
+		}
+	}
+	if change.Replace {
+		for key, roleID := range before {
+			if _, ok := added[key]; !ok {
+				changed[roleID] = true
+			}
+		}
+	}
+
+	removed := make(map[uuid.UUID]bool, len(change.Remove))
+	for _, id := range change.Remove {
+		removed[id] = true
+	}
+	for i := range current {
+		if removed[current[i].ID] {
+			changed[current[i].RoleID] = true
+		}
+	}
+
+	roleIDs := make([]uuid.UUID, 0, len(changed))
+	for roleID := range changed {
+		roleIDs = append(roleIDs, roleID)
+	}
+	return roleIDs, nil
+}
+
+// grantKey identifies a member's grant of a role under a condition
+type grantKey struct {
+	roleID    uuid.UUID
+	member    string
+	condition string
+}
+
+// grantSet returns every grant of bindings, mapped to its role
+func grantSet(bindings []domain.Binding) (map[grantKey]uuid.UUID, error) {
+	grants := make(map[grantKey]uuid.UUID)
+	for i := range bindings {
+		var members []string
+		if len(bindings[i].Members) > 0 {
+			var err error
+			if members, err = bindings[i].GetMembers(); err != nil {
+				return nil, fmt.Errorf("invalid members in binding %d: %w", i, err)
+			}
+		}
+		var condition string
+		if bindings[i].Condition != nil {
+			condition = bindings[i].Condition.Expression
+		}
+		for _, member := range members {
+			grants[grantKey{bindings[i].RoleID, member, condition}] = bindings[i].RoleID
+		}
+	}
+	return grants, nil
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memGrantConstraintRepository is an in-memory GrantConstraintRepository
+type memGrantConstraintRepository struct {
+	mu          sync.Mutex
+	constraints []domain.GrantConstraint
+}
+
+func (r *memGrantConstraintRepository) Create(constraint *domain.GrantConstraint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if constraint.ID == uuid.Nil {
+		constraint.ID = uuid.New()
+	}
+	r.constraints = append(r.constraints, *constraint)
+	return nil
+}
+
+func (r *memGrantConstraintRepository) GetByID(id uuid.UUID) (*domain.GrantConstraint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.constraints {
+		if r.constraints[i].ID == id {
+			constraint := r.constraints[i]
+			return &constraint, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memGrantConstraintRepository) Update(constraint *domain.GrantConstraint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.constraints {
+		if r.constraints[i].ID == constraint.ID {
+			r.constraints[i] = *constraint
+		}
+	}
+	return nil
+}
+
+func (r *memGrantConstraintRepository) Delete(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.constraints {
+		if r.constraints[i].ID == id {
+			r.constraints = append(r.constraints[:i], r.constraints[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memGrantConstraintRepository) List(resourceID *uuid.UUID, limit, offset int) ([]domain.GrantConstraint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.GrantConstraint
+	for _, constraint := range r.constraints {
+		if resourceID == nil || constraint.ResourceID == *resourceID {
+			result = append(result, constraint)
+		}
+	}
+	return result, nil
+}
+
+func (r *memGrantConstraintRepository) ListByResources(resourceIDs []uuid.UUID) ([]domain.GrantConstraint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []domain.GrantConstraint
+	for _, constraint := range r.constraints {
+		for _, id := range resourceIDs {
+			if constraint.ResourceID == id {
+				result = append(result, constraint)
+			}
+		}
+	}
+	return result, nil
+}
+
+// grantConstraintFixture is an org -> project hierarchy where user:lead@example.com may only
+// grant the viewer role on the project
+type grantConstraintFixture struct {
+	service              *IAMService
+	orgID, projectID     uuid.UUID
+	owner, viewer        domain.Role
+	ownerBinding         domain.Binding
+	viewerBinding        domain.Binding
+	constraintRepository *memGrantConstraintRepository
+}
+
+func newGrantConstraintFixture(t *testing.T) *grantConstraintFixture {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	f := &grantConstraintFixture{
+		service:              service,
+		orgID:                uuid.New(),
+		projectID:            uuid.New(),
+		owner:                testRole("roles/owner", "admin.all"),
+		viewer:               testRole("roles/storage.viewer", "storage.buckets.get"),
+		constraintRepository: &memGrantConstraintRepository{},
+	}
+	f.ownerBinding = domain.Binding{ID: uuid.New(), RoleID: f.owner.ID, Members: toJSON([]string{"user:admin@example.com"})}
+	f.viewerBinding = domain.Binding{ID: uuid.New(), RoleID: f.viewer.ID, Members: toJSON([]string{"user:alice@example.com"})}
+
+	resourceRepo.On("GetByID", f.orgID).Return(&domain.Resource{ID: f.orgID}, nil)
+	resourceRepo.On("GetAncestors", f.projectID).Return([]domain.Resource{{ID: f.orgID}}, nil)
+	resourceRepo.On("GetAncestors", f.orgID).Return([]domain.Resource{}, nil)
+	roleRepo.On("GetByID", f.owner.ID).Return(&f.owner, nil)
+	roleRepo.On("GetByID", f.viewer.ID).Return(&f.viewer, nil)
+	roleRepo.On("GetByName", f.viewer.Name).Return(&f.viewer, nil)
+	roleRepo.On("GetByName", "roles/missing").Return(nil, nil)
+	policyRepo.On("GetByResourceID", f.projectID).Return(&domain.Policy{
+		ResourceID: f.projectID,
+		Bindings:   []domain.Binding{f.ownerBinding, f.viewerBinding},
+	}, nil)
+
+	service.SetGrantConstraints(f.constraintRepository)
+	_, err := service.CreateGrantConstraint(f.orgID, []string{"user:lead@example.com"}, []string{f.viewer.Name}, "team leads")
+	require.NoError(t, err)
+	return f
+}
+
+func TestIAMService_AuthorizeGrants(t *testing.T) {
+	f := newGrantConstraintFixture(t)
+	lead := "user:lead@example.com"
+
+	// Granting an allowed role
+	err := f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Add: []domain.Binding{
+		{RoleID: f.viewer.ID, Members: toJSON([]string{"user:bob@example.com"})},
+	}})
+	assert.NoError(t, err)
+
+	// Granting a role outside the allowed set
+	err = f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Add: []domain.Binding{
+		{RoleID: f.owner.ID, Members: toJSON([]string{"user:lead@example.com"})},
+	}})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorContains(t, err, "roles/owner")
+
+	// Replacing the policy while keeping the owner binding unchanged
+	err = f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Replace: true, Add: []domain.Binding{
+		{RoleID: f.owner.ID, Members: toJSON([]string{"user:admin@example.com"})},
+		{RoleID: f.viewer.ID, Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com"})},
+	}})
+	assert.NoError(t, err)
+
+	// Replacing the policy without the owner binding revokes it
+	err = f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Replace: true, Add: []domain.Binding{
+		{RoleID: f.viewer.ID, Members: toJSON([]string{"user:alice@example.com"})},
+	}})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// Adding a condition to the owner binding changes its grant
+	err = f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Replace: true, Add: []domain.Binding{
+		{RoleID: f.owner.ID, Members: toJSON([]string{"user:admin@example.com"}), Condition: &domain.Condition{Expression: "true"}},
+		{RoleID: f.viewer.ID, Members: toJSON([]string{"user:alice@example.com"})},
+	}})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+
+	// Removing bindings
+	assert.NoError(t, f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Remove: []uuid.UUID{f.viewerBinding.ID}}))
+	assert.ErrorIs(t, f.service.AuthorizeGrants(lead, f.projectID, GrantChange{Remove: []uuid.UUID{f.ownerBinding.ID}}), ErrPermissionDenied)
+
+	// Principals without constraints are not restricted
+	err = f.service.AuthorizeGrants("user:admin@example.com", f.projectID, GrantChange{Add: []domain.Binding{
+		{RoleID: f.owner.ID, Members: toJSON([]string{"user:bob@example.com"})},
+	}})
+	assert.NoError(t, err)
+}
+
+func TestIAMService_AuthorizeGrantConstraintChange(t *testing.T) {
+	f := newGrantConstraintFixture(t)
+
+	assert.ErrorIs(t, f.service.AuthorizeGrantConstraintChange("user:lead@example.com", f.projectID), ErrPermissionDenied)
+	assert.NoError(t, f.service.AuthorizeGrantConstraintChange("user:admin@example.com", f.projectID))
+}
+
+// Test: Caller views enforce grant constraints in the binding, policy and constraint mutators
+func TestIAMService_AsCaller_GrantConstraints(t *testing.T) {
+	f := newGrantConstraintFixture(t)
+	lead := f.service.AsCaller("user:lead@example.com")
+
+	_, err := lead.CreateBinding(f.projectID, f.owner.ID, []string{"user:lead@example.com"}, nil)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = lead.BatchCreateBindings(f.projectID, []domain.Binding{
+		{RoleID: f.owner.ID, Members: toJSON([]string{"user:lead@example.com"})},
+	})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = lead.BatchDeleteBindings(f.projectID, []uuid.UUID{f.ownerBinding.ID})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = lead.UpdatePolicy(f.projectID, []domain.Binding{f.viewerBinding}, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, lead.DeletePolicy(f.projectID, ""), ErrPermissionDenied)
+
+	bindingRepo := f.service.bindingRepo.(*MockBindingRepository)
+	policyRepo := f.service.policyRepo.(*MockPolicyRepository)
+	policyID := uuid.New()
+	bindingRepo.On("GetByID", f.ownerBinding.ID).Return(&domain.Binding{ID: f.ownerBinding.ID, PolicyID: policyID}, nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: f.projectID}, nil)
+	assert.ErrorIs(t, lead.DeleteBinding(f.ownerBinding.ID), ErrPermissionDenied)
+
+	constraints, err := f.service.ListGrantConstraints(&f.orgID, 0, 0)
+	require.NoError(t, err)
+	_, err = lead.UpdateGrantConstraint(constraints[0].ID, []string{"user:lead@example.com"}, []string{f.viewer.Name}, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = lead.CreateGrantConstraint(f.orgID, []string{"user:bob@example.com"}, []string{f.viewer.Name}, "")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, lead.DeleteGrantConstraint(constraints[0].ID), ErrPermissionDenied)
+
+	// Nothing was written
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+	bindingRepo.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+	bindingRepo.AssertNotCalled(t, "DeleteBatch", mock.Anything, mock.Anything)
+	bindingRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	policyRepo.AssertNotCalled(t, "Create", mock.Anything)
+	policyRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	constraints, err = f.service.ListGrantConstraints(nil, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, constraints, 1)
+}
+
+func TestIAMService_GrantConstraintCRUD(t *testing.T) {
+	f := newGrantConstraintFixture(t)
+
+	constraints, err := f.service.ListGrantConstraints(&f.orgID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, constraints, 1)
+	id := constraints[0].ID
+
+	_, err = f.service.CreateGrantConstraint(f.orgID, nil, []string{f.viewer.Name}, "")
+	assert.ErrorContains(t, err, "at least one member")
+
+	_, err = f.service.CreateGrantConstraint(f.orgID, []string{"user:lead@example.com"}, []string{"roles/missing"}, "")
+	assert.ErrorContains(t, err, `role "roles/missing" not found`)
+
+	updated, err := f.service.UpdateGrantConstraint(id, []string{"domain:example.com"}, nil, "everyone")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(updated.AllowedRoles))
+	assert.True(t, updated.AppliesTo("user:carol@example.com"))
+
+	require.NoError(t, f.service.DeleteGrantConstraint(id))
+	constraint, err := f.service.GetGrantConstraint(id)
+	require.NoError(t, err)
+	assert.Nil(t, constraint)
+}
+
+func TestIAMService_GrantConstraintsDisabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.CreateGrantConstraint(uuid.New(), []string{"user:lead@example.com"}, nil, "")
+	assert.ErrorIs(t, err, ErrGrantConstraintsDisabled)
+	_, err = service.ListGrantConstraints(nil, 0, 0)
+	assert.ErrorIs(t, err, ErrGrantConstraintsDisabled)
+
+	assert.NoError(t, service.AuthorizeGrants("user:lead@example.com", uuid.New(), GrantChange{}))
+}
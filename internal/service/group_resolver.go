@@ -0,0 +1,130 @@
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CachedGroupResolver caches the groups returned by a GroupResolver and bounds how long a
+// permission check waits for it. When a lookup fails or times out, the last result for the
+// principal is used if one exists; otherwise the principal gets no groups from this resolver.
+// An unavailable directory therefore denies access granted through its groups instead of
+// stalling or failing every check.
+type CachedGroupResolver struct {
+	name       string
+	resolver   GroupResolver
+	ttl        time.Duration
+	timeout    time.Duration
+	maxEntries int
+	logger     *slog.Logger
+
+	mu       sync.Mutex
+	entries  map[string]groupEntry
+	inflight map[string]*groupLookup
+}
+
+type groupEntry struct {
+	groups  []string
+	expires time.Time
+}
+
+// groupLookup is a lookup in progress, shared by concurrent checks of the same principal
+type groupLookup struct {
+	done   chan struct{}
+	groups []string
+	err    error
+}
+
+// NewCachedGroupResolver wraps resolver with a cache of up to maxEntries principals. name
+// identifies the resolver in logs. A nil logger uses slog.Default().
+func NewCachedGroupResolver(name string, resolver GroupResolver, ttl, timeout time.Duration, maxEntries int, logger *slog.Logger) *CachedGroupResolver {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &CachedGroupResolver{
+		name:       name,
+		resolver:   resolver,
+		ttl:        ttl,
+		timeout:    timeout,
+		maxEntries: maxEntries,
+		logger:     logger,
+		entries:    make(map[string]groupEntry),
+		inflight:   make(map[string]*groupLookup),
+	}
+}
+
+// GroupsOf returns the cached groups of principal, looking them up when missing or expired
+func (r *CachedGroupResolver) GroupsOf(principal string) ([]string, error) {
+	r.mu.Lock()
+	entry, cached := r.entries[principal]
+	if cached && time.Now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.groups, nil
+	}
+	lookup, ok := r.inflight[principal]
+	if !ok {
+		lookup = &groupLookup{done: make(chan struct{})}
+		r.inflight[principal] = lookup
+		go r.lookup(principal, lookup)
+	}
+	r.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if r.timeout > 0 {
+		timer := time.NewTimer(r.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-lookup.done:
+		if lookup.err == nil {
+			return lookup.groups, nil
+		}
+		r.logger.Warn("Group lookup failed", "resolver", r.name, "principal", principal, "stale", cached, "error", lookup.err)
+	case <-timeout:
+		// The lookup keeps running and caches its result for later checks
+		r.logger.Warn("Group lookup timed out", "resolver", r.name, "principal", principal, "stale", cached, "timeout", r.timeout)
+	}
+
+	if cached {
+		return entry.groups, nil
+	}
+	return nil, nil
+}
+
+func (r *CachedGroupResolver) lookup(principal string, lookup *groupLookup) {
+	lookup.groups, lookup.err = r.resolver.GroupsOf(principal)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inflight, principal)
+	if lookup.err == nil {
+		r.store(principal, lookup.groups)
+	}
+	close(lookup.done)
+}
+
+// store caches groups, evicting expired entries and then arbitrary ones when full.
+// Callers must hold r.mu.
+func (r *CachedGroupResolver) store(principal string, groups []string) {
+	if _, ok := r.entries[principal]; !ok && len(r.entries) >= r.maxEntries {
+		now := time.Now()
+		for key, entry := range r.entries {
+			if now.After(entry.expires) {
+				delete(r.entries, key)
+			}
+		}
+		for key := range r.entries {
+			if len(r.entries) < r.maxEntries {
+				break
+			}
+			delete(r.entries, key)
+		}
+	}
+	r.entries[principal] = groupEntry{groups: groups, expires: time.Now().Add(r.ttl)}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubGroupResolver returns fixed groups, optionally after a delay or with an error
+type stubGroupResolver struct {
+	mu     sync.Mutex
+	groups []string
+	err    error
+	delay  time.Duration
+	calls  atomic.Int32
+}
+
+func (r *stubGroupResolver) GroupsOf(principal string) ([]string, error) {
+	r.calls.Add(1)
+	r.mu.Lock()
+	groups, err, delay := r.groups, r.err, r.delay
+	r.mu.Unlock()
+	time.Sleep(delay)
+	return groups, err
+}
+
+func (r *stubGroupResolver) set(groups []string, err error, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups, r.err, r.delay = groups, err, delay
+}
+
+func TestCachedGroupResolver_Caches(t *testing.T) {
+	stub := &stubGroupResolver{groups: []string{"group:engineering"}}
+	resolver := NewCachedGroupResolver("test", stub, time.Minute, time.Second, 10, nil)
+
+	for i := 0; i < 3; i++ {
+		groups, err := resolver.GroupsOf("user:alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"group:engineering"}, groups)
+	}
+	assert.Equal(t, int32(1), stub.calls.Load())
+}
+
+func TestCachedGroupResolver_FailureServesStale(t *testing.T) {
+	stub := &stubGroupResolver{groups: []string{"group:engineering"}}
+	resolver := NewCachedGroupResolver("test", stub, time.Nanosecond, time.Second, 10, nil)
+
+	groups, err := resolver.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group:engineering"}, groups)
+
+	// The entry has expired, but the directory is down
+	stub.set(nil, errors.New("connection refused"), 0)
+	groups, err = resolver.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group:engineering"}, groups)
+
+	// Without a previous result the principal gets no groups
+	groups, err = resolver.GroupsOf("user:bob@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+}
+
+func TestCachedGroupResolver_Timeout(t *testing.T) {
+	stub := &stubGroupResolver{groups: []string{"group:engineering"}, delay: 200 * time.Millisecond}
+	resolver := NewCachedGroupResolver("test", stub, time.Minute, 10*time.Millisecond, 10, nil)
+
+	start := time.Now()
+	groups, err := resolver.GroupsOf("user:alice@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+	// The abandoned lookup still completes and fills the cache
+	require.Eventually(t, func() bool {
+		groups, _ := resolver.GroupsOf("user:alice@example.com")
+		return len(groups) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), stub.calls.Load())
+}
+
+func TestCachedGroupResolver_Evicts(t *testing.T) {
+	stub := &stubGroupResolver{groups: []string{"group:engineering"}}
+	resolver := NewCachedGroupResolver("test", stub, time.Minute, time.Second, 2, nil)
+
+	for _, principal := range []string{"user:a", "user:b", "user:c"} {
+		_, err := resolver.GroupsOf(principal)
+		require.NoError(t, err)
+	}
+	assert.Len(t, resolver.entries, 2)
+}
@@ -1,15 +1,23 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"github.com/pguia/iam/internal/repository"
-	"gorm.io/datatypes"
 )
 
+// ErrRoleOutOfScope is returned when a scoped custom role is bound outside its scope's subtree
+var ErrRoleOutOfScope = errors.New("role cannot be bound outside its scope")
+
 // IAMService provides IAM functionality
 type IAMService struct {
 	resourceRepo   repository.ResourceRepository
@@ -17,8 +25,39 @@ type IAMService struct {
 	roleRepo       repository.RoleRepository
 	policyRepo     repository.PolicyRepository
 	bindingRepo    repository.BindingRepository
+	revisionRepo   repository.PolicyRevisionRepository
+	conditionRepo  repository.ConditionRepository
 	evaluator      PermissionEvaluator
 	cache          CacheService
+
+	attachmentRules     AttachmentRules
+	policyLimits        *PolicyLimitSet
+	policyWatcher       *PolicyWatcher
+	operations          *OperationRunner
+	decisionRepo        repository.DecisionLogRepository
+	recommendationRepo  repository.AccessRecommendationRepository
+	grantConstraintRepo repository.GrantConstraintRepository
+	accessRequestRepo   repository.AccessRequestRepository
+	accessReviewRepo    repository.AccessReviewRepository
+	principalAliasRepo  repository.PrincipalAliasRepository
+	evaluationGrantRepo repository.EvaluationGrantRepository
+	integrityRepo       repository.IntegrityRepository
+	integrity           *integrityState
+	evaluationStats     *EvaluationStats
+	poolStats           func() map[string]sql.DBStats
+	defaultBindings     DefaultBindings
+	requireImpactAck    bool
+	tokenVerifier       TokenVerifier
+	retention           time.Duration
+	authorizer          AdminAuthorizer
+
+	// Set on the views of AsCaller
+	caller     string
+	callerView bool
+	// Set on the views of WithRequestMetadata
+	request RequestMetadata
+	// Set on the views of DryRun
+	dryRun bool
 }
 
 // NewIAMService creates a new IAM service
@@ -28,6 +67,8 @@ func NewIAMService(
 	roleRepo repository.RoleRepository,
 	policyRepo repository.PolicyRepository,
 	bindingRepo repository.BindingRepository,
+	revisionRepo repository.PolicyRevisionRepository,
+	conditionRepo repository.ConditionRepository,
 	evaluator PermissionEvaluator,
 	cache CacheService,
 ) *IAMService {
@@ -37,6 +78,8 @@ func NewIAMService(
 		roleRepo:       roleRepo,
 		policyRepo:     policyRepo,
 		bindingRepo:    bindingRepo,
+		revisionRepo:   revisionRepo,
+		conditionRepo:  conditionRepo,
 		evaluator:      evaluator,
 		cache:          cache,
 	}
@@ -51,7 +94,138 @@ func (s *IAMService) CheckPermission(
 	permission string,
 	context map[string]string,
 ) (bool, string, error) {
-	return s.evaluator.CheckPermission(principal, resourceID, permission, context)
+	return s.evaluator.CheckPermission(principal, resourceID, permission, s.withRequestMetadata(withoutReservedKeys(context)))
+}
+
+// MaxBatchChecks is the maximum number of checks accepted by BatchCheckPermissions
+const MaxBatchChecks = 100
+
+// BatchCheckPermissions runs several permission checks of a principal, returning one result per
+// check in request order. Rows shared between the checks are loaded once for the whole batch.
+func (s *IAMService) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	if principal == "" {
+		return nil, fmt.Errorf("principal is required")
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("at least one check is required")
+	}
+	if len(checks) > MaxBatchChecks {
+		return nil, fmt.Errorf("too many checks: %d (max %d)", len(checks), MaxBatchChecks)
+	}
+
+	scoped := make([]PermissionCheck, len(checks))
+	for i, check := range checks {
+		check.Context = s.withRequestMetadata(withoutReservedKeys(check.Context))
+		scoped[i] = check
+	}
+	return s.evaluator.BatchCheckPermissions(principal, scoped)
+}
+
+// Modes of CheckPermissionOnResources
+const (
+	ResourceSetAny = "any" // Allowed when the permission is held on at least one resource
+	ResourceSetAll = "all" // Allowed when the permission is held on every resource
+)
+
+// MaxResourceSetChecks is the maximum number of resources accepted by CheckPermissionOnResources
+const MaxResourceSetChecks = 1000
+
+// CheckPermissionOnResources checks one permission of a principal on a set of resources, e.g. to
+// filter a page of search results by access. It returns the decision for the set in the given
+// mode, and one result per resource in request order. The checks share one evaluation, so the
+// ancestors, policies, groups and roles common to the resources are loaded once.
+func (s *IAMService) CheckPermissionOnResources(
+	principal, permission string,
+	resourceIDs []uuid.UUID,
+	mode string,
+	context map[string]string,
+) (bool, []CheckResult, error) {
+	if principal == "" {
+		return false, nil, fmt.Errorf("principal is required")
+	}
+	if permission == "" {
+		return false, nil, fmt.Errorf("permission is required")
+	}
+	if len(resourceIDs) == 0 {
+		return false, nil, fmt.Errorf("at least one resource is required")
+	}
+	if len(resourceIDs) > MaxResourceSetChecks {
+		return false, nil, fmt.Errorf("too many resources: %d (max %d)", len(resourceIDs), MaxResourceSetChecks)
+	}
+	if mode == "" {
+		mode = ResourceSetAny
+	}
+	if mode != ResourceSetAny && mode != ResourceSetAll {
+		return false, nil, fmt.Errorf("mode must be %q or %q", ResourceSetAny, ResourceSetAll)
+	}
+
+	context = s.withRequestMetadata(withoutReservedKeys(context))
+	checks := make([]PermissionCheck, len(resourceIDs))
+	for i, resourceID := range resourceIDs {
+		checks[i] = PermissionCheck{ResourceID: resourceID, Permission: permission, Context: context}
+	}
+	results, err := s.evaluator.BatchCheckPermissions(principal, checks)
+	if err != nil {
+		return false, nil, err
+	}
+
+	allowed := slices.ContainsFunc(results, func(result CheckResult) bool { return result.Allowed })
+	if mode == ResourceSetAll {
+		allowed = !slices.ContainsFunc(results, func(result CheckResult) bool { return !result.Allowed })
+	}
+	return allowed, results, nil
+}
+
+// MaxPrincipalChecks is the maximum number of principals accepted by CheckPermissionForPrincipals
+const MaxPrincipalChecks = 100
+
+// CheckPermissionForPrincipals checks one permission of several principals on a resource, e.g. to
+// show which people of a sharing dialog can edit a document. It returns one result per principal
+// in request order. The checks share one evaluation, so the resource, its ancestors, their
+// policies and roles are loaded once; only the groups of each principal are resolved separately.
+func (s *IAMService) CheckPermissionForPrincipals(
+	resourceID uuid.UUID,
+	permission string,
+	principals []string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	if permission == "" {
+		return nil, fmt.Errorf("permission is required")
+	}
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("at least one principal is required")
+	}
+	if len(principals) > MaxPrincipalChecks {
+		return nil, fmt.Errorf("too many principals: %d (max %d)", len(principals), MaxPrincipalChecks)
+	}
+	if i := slices.Index(principals, ""); i >= 0 {
+		return nil, fmt.Errorf("principal %d is required", i)
+	}
+
+	return s.evaluator.CheckPermissionForPrincipals(principals, resourceID, permission, s.withRequestMetadata(withoutReservedKeys(context)))
+}
+
+// MaxTestPermissions is the maximum number of permissions accepted by TestIamPermissions
+const MaxTestPermissions = 100
+
+// TestIamPermissions returns the subset of the requested permissions the principal holds on a resource
+func (s *IAMService) TestIamPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	if principal == "" {
+		return nil, fmt.Errorf("principal is required")
+	}
+	if len(permissions) == 0 {
+		return nil, fmt.Errorf("at least one permission is required")
+	}
+	if len(permissions) > MaxTestPermissions {
+		return nil, fmt.Errorf("too many permissions: %d (max %d)", len(permissions), MaxTestPermissions)
+	}
+
+	return s.evaluator.TestPermissions(principal, resourceID, permissions, s.withRequestMetadata(withoutReservedKeys(context)))
 }
 
 // GetEffectivePermissions gets all effective permissions for a principal on a resource
@@ -59,42 +233,113 @@ func (s *IAMService) GetEffectivePermissions(
 	principal string,
 	resourceID uuid.UUID,
 ) ([]string, []string, error) {
+	if err := s.authorize("GetEffectivePermissions", &resourceID); err != nil {
+		return nil, nil, err
+	}
+
 	return s.evaluator.GetEffectivePermissions(principal, resourceID)
 }
 
 // =============== Resource Management ===============
 
-// CreateResource creates a new resource
+// CreateResource creates a new resource with optional tags. The default bindings of its type
+// (see SetDefaultBindings) are applied as its policy in the same transaction, granting the creator
+// what they name for it. Callers may only create resources as themselves; creator defaults to the
+// caller, and is empty for the server.
 func (s *IAMService) CreateResource(
 	resourceType, name string,
 	parentID *uuid.UUID,
-	attributes map[string]string,
+	attributes map[string]interface{},
+	tags map[string]string,
+	creator string,
 ) (*domain.Resource, error) {
+	if err := s.authorize("CreateResource", parentID); err != nil {
+		return nil, err
+	}
+	if s.callerView {
+		if creator == "" {
+			creator = s.caller
+		}
+		if creator != s.caller {
+			return nil, fmt.Errorf("%w: %s cannot create resources as %s", ErrPermissionDenied, s.caller, creator)
+		}
+	}
+
+	if err := ValidateResourceTags(tags); err != nil {
+		return nil, err
+	}
+	if parentID != nil && s.hasDepthLimits() {
+		ancestors, err := s.resourceRepo.GetAncestors(*parentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resource ancestors: %w", err)
+		}
+		// The parent's limits apply to the new level below it
+		if err := s.checkDepthLimit(*parentID, ancestors, 2); err != nil {
+			return nil, err
+		}
+	}
+
 	resource := &domain.Resource{
 		Type:       resourceType,
 		Name:       name,
 		ParentID:   parentID,
 		Attributes: attributes,
+		CreatedBy:  creator,
+		UpdatedBy:  creator,
+	}
+	for key, value := range tags {
+		resource.Tags = append(resource.Tags, domain.ResourceTag{Key: key, Value: value})
 	}
 
-	if err := s.resourceRepo.Create(resource); err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+	policy, err := s.baselinePolicy(resource, creator)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		if err := s.resourceRepo.Create(resource); err != nil {
+			return nil, fmt.Errorf("failed to create resource: %w", err)
+		}
+		return resource, nil
 	}
 
+	if err := s.resourceRepo.CreateWithPolicy(resource, policy); err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	if _, err := s.getPolicyAndRecordRevision(policy.ID); err != nil {
+		return nil, err
+	}
 	return resource, nil
 }
 
 // GetResource gets a resource by ID
 func (s *IAMService) GetResource(id uuid.UUID) (*domain.Resource, error) {
+	if err := s.authorize("GetResource", &id); err != nil {
+		return nil, err
+	}
+
 	return s.resourceRepo.GetByID(id)
 }
 
-// UpdateResource updates a resource
+// UpdateResource updates the fields of a resource named in updateMask (ResourceFieldName,
+// ResourceFieldAttributes); the others are kept. An empty mask updates every field. A non-empty
+// etag must match the current resource. Names and attributes are visible to binding conditions as
+// resource.name and resource.attributes, so cached decisions are invalidated.
 func (s *IAMService) UpdateResource(
 	id uuid.UUID,
 	name string,
-	attributes map[string]string,
+	attributes map[string]interface{},
+	updateMask []string,
+	etag string,
 ) (*domain.Resource, error) {
+	if err := s.authorize("UpdateResource", &id); err != nil {
+		return nil, err
+	}
+
+	mask, err := parseUpdateMask(updateMask, ResourceFieldName, ResourceFieldAttributes)
+	if err != nil {
+		return nil, err
+	}
+
 	resource, err := s.resourceRepo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -102,33 +347,146 @@ func (s *IAMService) UpdateResource(
 	if resource == nil {
 		return nil, fmt.Errorf("resource not found")
 	}
+	if etag != "" && resource.ETag != etag {
+		return nil, fmt.Errorf("resource has been modified, %w", repository.ErrETagMismatch)
+	}
 
-	resource.Name = name
-	resource.Attributes = attributes
+	if mask[ResourceFieldName] {
+		resource.Name = name
+	}
+	if mask[ResourceFieldAttributes] {
+		resource.Attributes = attributes
+	}
+	resource.UpdatedBy = s.caller
 
 	if err := s.resourceRepo.Update(resource); err != nil {
 		return nil, fmt.Errorf("failed to update resource: %w", err)
 	}
+	s.cache.Clear()
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeResource, id, 0))
 
 	return resource, nil
 }
 
+// UpdateResourceAttributes changes some attributes of a resource, keeping the others: each key of
+// patch replaces the attribute of the same name, and keys whose value is nil (JSON null) are
+// removed. Unlike UpdateResource, which replaces every attribute, callers changing different
+// keys at the same time do not overwrite each other. Attributes are visible to binding
+// conditions as resource.attributes, so cached decisions are invalidated.
+func (s *IAMService) UpdateResourceAttributes(id uuid.UUID, patch map[string]interface{}) (*domain.Resource, error) {
+	if err := s.authorize("UpdateResourceAttributes", &id); err != nil {
+		return nil, err
+	}
+
+	if len(patch) == 0 {
+		return nil, fmt.Errorf("no attributes provided")
+	}
+
+	if err := s.resourceRepo.PatchAttributes(id, patch, s.caller); err != nil {
+		return nil, fmt.Errorf("failed to update resource attributes: %w", err)
+	}
+	s.cache.Clear()
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeResource, id, 0))
+
+	return s.resourceRepo.GetByID(id)
+}
+
 // DeleteResource deletes a resource
 func (s *IAMService) DeleteResource(id uuid.UUID) error {
-	return s.resourceRepo.Delete(id)
+	if err := s.authorize("DeleteResource", &id); err != nil {
+		return err
+	}
+
+	change := s.newPolicyChange(PolicyChangeResource, id, 0)
+	if err := s.resourceRepo.Delete(id); err != nil {
+		return err
+	}
+	s.publishPolicyChange(change)
+	return nil
+}
+
+// OperationDeleteResourceTree is the operation type of DeleteResourceTree
+const OperationDeleteResourceTree = "DeleteResourceTree"
+
+// DeleteResourceTreeResult is the result of a DeleteResourceTree operation
+type DeleteResourceTreeResult struct {
+	Deleted int64 `json:"deleted"` // Resources deleted, including the root of the subtree
+}
+
+// DeleteResourceTree deletes a resource and all of its descendants in a long-running
+// operation, deepest resources first. Poll the returned operation with GetOperation.
+func (s *IAMService) DeleteResourceTree(id uuid.UUID) (*domain.Operation, error) {
+	if err := s.authorize("DeleteResourceTree", &id); err != nil {
+		return nil, err
+	}
+
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+
+	resource, err := s.resourceRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	return s.operations.Submit(OperationDeleteResourceTree, id.String(), func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		descendants, err := s.resourceRepo.GetDescendants(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get descendants: %w", err)
+		}
+
+		// Delete leaves first so a failure never leaves resources under a deleted parent
+		sort.SliceStable(descendants, func(i, j int) bool {
+			return strings.Count(descendants[i].Path, "/") > strings.Count(descendants[j].Path, "/")
+		})
+		ids := make([]uuid.UUID, 0, len(descendants)+1)
+		for _, descendant := range descendants {
+			ids = append(ids, descendant.ID)
+		}
+		ids = append(ids, id)
+
+		total := int64(len(ids))
+		result := &DeleteResourceTreeResult{}
+		defer s.publishPolicyChange(s.newPolicyChange(PolicyChangeResource, id, 0))
+		defer s.cache.Clear()
+		for _, resourceID := range ids {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			if err := s.resourceRepo.Delete(resourceID); err != nil {
+				return result, fmt.Errorf("failed to delete resource %s: %w", resourceID, err)
+			}
+			result.Deleted++
+			progress(result.Deleted, total)
+		}
+		return result, nil
+	})
 }
 
-// ListResources lists resources
+// ListResources lists resources, optionally filtered by attribute key/values
 func (s *IAMService) ListResources(
 	parentID *uuid.UUID,
 	resourceType string,
+	attributes map[string]interface{},
+	tags map[string]string,
 	pageSize, offset int,
 ) ([]domain.Resource, error) {
-	return s.resourceRepo.List(parentID, resourceType, pageSize, offset)
+	if err := s.authorize("ListResources", parentID); err != nil {
+		return nil, err
+	}
+
+	return s.resourceRepo.List(parentID, resourceType, attributes, tags, pageSize, offset)
 }
 
 // GetResourceHierarchy gets ancestors and descendants of a resource
 func (s *IAMService) GetResourceHierarchy(id uuid.UUID) ([]domain.Resource, []domain.Resource, error) {
+	if err := s.authorize("GetResourceHierarchy", &id); err != nil {
+		return nil, nil, err
+	}
+
 	ancestors, err := s.resourceRepo.GetAncestors(id)
 	if err != nil {
 		return nil, nil, err
@@ -148,6 +506,10 @@ func (s *IAMService) GetResourceHierarchy(id uuid.UUID) ([]domain.Resource, []do
 func (s *IAMService) CreatePermission(
 	name, description, service string,
 ) (*domain.Permission, error) {
+	if err := s.authorize("CreatePermission", nil); err != nil {
+		return nil, err
+	}
+
 	permission := &domain.Permission{
 		Name:        name,
 		Description: description,
@@ -163,21 +525,83 @@ func (s *IAMService) CreatePermission(
 
 // GetPermission gets a permission by ID
 func (s *IAMService) GetPermission(id uuid.UUID) (*domain.Permission, error) {
+	if err := s.authorize("GetPermission", nil); err != nil {
+		return nil, err
+	}
+
 	return s.permissionRepo.GetByID(id)
 }
 
 // ListPermissions lists permissions
 func (s *IAMService) ListPermissions(service string, pageSize, offset int) ([]domain.Permission, error) {
+	if err := s.authorize("ListPermissions", nil); err != nil {
+		return nil, err
+	}
+
 	return s.permissionRepo.List(service, pageSize, offset)
 }
 
+// PermissionDef declares a permission in a service's catalog
+type PermissionDef struct {
+	Name        string // e.g., "storage.buckets.create"
+	Description string
+}
+
+// SyncServicePermissions makes the stored permissions of a service match its declared catalog.
+// It is idempotent, so services can call it on every deploy: new permissions are created,
+// descriptions updated, and permissions missing from the catalog flagged as deprecated.
+func (s *IAMService) SyncServicePermissions(service string, defs []PermissionDef) (*repository.PermissionSyncResult, error) {
+	if err := s.authorize("SyncServicePermissions", nil); err != nil {
+		return nil, err
+	}
+
+	if service == "" {
+		return nil, fmt.Errorf("service is required")
+	}
+
+	permissions := make([]domain.Permission, len(defs))
+	seen := make(map[string]bool, len(defs))
+	for i, def := range defs {
+		if !strings.HasPrefix(def.Name, service+".") || len(def.Name) == len(service)+1 {
+			return nil, fmt.Errorf("permission %q must be prefixed with %q", def.Name, service+".")
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("permission %q declared more than once", def.Name)
+		}
+		seen[def.Name] = true
+		permissions[i] = domain.Permission{Name: def.Name, Description: def.Description, Service: service}
+	}
+
+	result, err := s.permissionRepo.SyncService(service, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync permissions: %w", err)
+	}
+	return result, nil
+}
+
 // =============== Role Management ===============
 
-// CreateRole creates a new role
+// CreateRole creates a new custom role. A non-nil scopeResourceID scopes the role to that
+// resource's subtree: it can only be bound on the resource and its descendants.
 func (s *IAMService) CreateRole(
 	name, title, description string,
 	permissionIDs []uuid.UUID,
+	scopeResourceID *uuid.UUID,
 ) (*domain.Role, error) {
+	if err := s.authorize("CreateRole", scopeResourceID); err != nil {
+		return nil, err
+	}
+
+	if scopeResourceID != nil {
+		scope, err := s.resourceRepo.GetByID(*scopeResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get scope resource: %w", err)
+		}
+		if scope == nil {
+			return nil, fmt.Errorf("scope resource %s not found", *scopeResourceID)
+		}
+	}
+
 	// Get permissions
 	permissions, err := s.permissionRepo.GetByIDs(permissionIDs)
 	if err != nil {
@@ -190,6 +614,22 @@ func (s *IAMService) CreateRole(
 		Description: description,
 		Permissions: permissions,
 		IsCustom:    true,
+		CreatedBy:   s.caller,
+		UpdatedBy:   s.caller,
+
+		ScopeResourceID: scopeResourceID,
+	}
+
+	if s.dryRun {
+		// The unique index rejects the name on create
+		existing, err := s.roleRepo.GetByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("role %s already exists", name)
+		}
+		return role, nil
 	}
 
 	if err := s.roleRepo.Create(role); err != nil {
@@ -201,15 +641,34 @@ func (s *IAMService) CreateRole(
 
 // GetRole gets a role by ID
 func (s *IAMService) GetRole(id uuid.UUID) (*domain.Role, error) {
+	if err := s.authorize("GetRole", nil); err != nil {
+		return nil, err
+	}
+
 	return s.roleRepo.GetByID(id)
 }
 
-// UpdateRole updates a role
+// UpdateRole updates the fields of a role named in updateMask (RoleFieldTitle,
+// RoleFieldDescription, RoleFieldPermissionIDs); the others are kept, and an empty mask updates
+// every field. A non-empty etag must match the current role. When impact acknowledgment is
+// required, changing the permissions of a bound role fails with ErrImpactNotAcknowledged unless
+// impactToken is the Token of the current AnalyzeRoleImpact result for the same permissions.
 func (s *IAMService) UpdateRole(
 	id uuid.UUID,
 	title, description string,
 	permissionIDs []uuid.UUID,
+	updateMask []string,
+	etag, impactToken string,
 ) (*domain.Role, error) {
+	if err := s.authorize("UpdateRole", nil); err != nil {
+		return nil, err
+	}
+
+	mask, err := parseUpdateMask(updateMask, RoleFieldTitle, RoleFieldDescription, RoleFieldPermissionIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	role, err := s.roleRepo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -217,113 +676,498 @@ func (s *IAMService) UpdateRole(
 	if role == nil {
 		return nil, fmt.Errorf("role not found")
 	}
+	if etag != "" && role.ETag != etag {
+		return nil, fmt.Errorf("role has been modified, %w", repository.ErrETagMismatch)
+	}
 
 	// Get new permissions
-	permissions, err := s.permissionRepo.GetByIDs(permissionIDs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	permissions := role.Permissions
+	if mask[RoleFieldPermissionIDs] {
+		if permissions, err = s.permissionRepo.GetByIDs(permissionIDs); err != nil {
+			return nil, fmt.Errorf("failed to get permissions: %w", err)
+		}
 	}
 
-	role.Title = title
-	role.Description = description
+	if s.requireImpactAck && mask[RoleFieldPermissionIDs] {
+		impact, err := s.roleImpact(role, permissions)
+		if err != nil {
+			return nil, err
+		}
+		if impact.changesPermissions() && len(impact.Bindings) > 0 && impactToken != impact.Token {
+			return nil, fmt.Errorf("%w: the change affects %d bindings on %d resources; review AnalyzeRoleImpact and pass its token",
+				ErrImpactNotAcknowledged, len(impact.Bindings), len(impact.Resources))
+		}
+	}
+
+	if mask[RoleFieldTitle] {
+		role.Title = title
+	}
+	if mask[RoleFieldDescription] {
+		role.Description = description
+	}
 	role.Permissions = permissions
+	role.UpdatedBy = s.caller
+	if s.dryRun {
+		return role, nil
+	}
 
 	if err := s.roleRepo.Update(role); err != nil {
 		return nil, fmt.Errorf("failed to update role: %w", err)
 	}
 
-	return role, nil
-}
+	// Clear cache
+	s.cache.Clear()
 
-// DeleteRole deletes a role
-func (s *IAMService) DeleteRole(id uuid.UUID) error {
-	return s.roleRepo.Delete(id)
-}
+	// The role may be bound anywhere, so every watcher reloads
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeResync, uuid.Nil, 0))
 
-// ListRoles lists roles
-func (s *IAMService) ListRoles(includePredefined bool, pageSize, offset int) ([]domain.Role, error) {
-	return s.roleRepo.List(includePredefined, pageSize, offset)
+	return role, nil
 }
 
-// =============== Policy Management ===============
+// DeleteRole deletes a role. Without force it fails with a *repository.RoleInUseError while
+// bindings reference the role; with force those bindings are deleted in the same transaction
+// and a revision is recorded for every affected policy.
+func (s *IAMService) DeleteRole(id uuid.UUID, force bool) error {
+	if err := s.authorize("DeleteRole", nil); err != nil {
+		return err
+	}
 
-// CreatePolicy creates a new policy for a resource
-func (s *IAMService) CreatePolicy(resourceID uuid.UUID, bindings []domain.Binding) (*domain.Policy, error) {
-	policy := &domain.Policy{
-		ResourceID: resourceID,
-		Version:    1,
+	if s.dryRun {
+		if force {
+			return nil
+		}
+		return s.checkRoleUnused(id)
 	}
 
-	if err := s.policyRepo.Create(policy); err != nil {
-		return nil, fmt.Errorf("failed to create policy: %w", err)
+	if !force {
+		return s.roleRepo.Delete(id)
 	}
 
-	// Create bindings
-	for i := range bindings {
-		bindings[i].PolicyID = policy.ID
-		if err := s.bindingRepo.Create(&bindings[i]); err != nil {
-			return nil, fmt.Errorf("failed to create binding: %w", err)
-		}
+	policyIDs, err := s.roleRepo.DeleteCascade(id)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
 	}
 
-	// Clear cache for this resource
-	s.cache.Clear()
+	if len(policyIDs) == 0 {
+		return nil
+	}
 
-	return s.policyRepo.GetByID(policy.ID)
-}
+	// Clear cache
+	s.cache.Clear()
 
-// GetPolicy gets a policy for a resource
-func (s *IAMService) GetPolicy(resourceID uuid.UUID) (*domain.Policy, error) {
-	return s.policyRepo.GetByResourceID(resourceID)
+	for _, policyID := range policyIDs {
+		if _, err := s.getPolicyAndRecordRevision(policyID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// UpdatePolicy updates a policy
-func (s *IAMService) UpdatePolicy(
-	resourceID uuid.UUID,
-	bindings []domain.Binding,
-	etag string,
-) (*domain.Policy, error) {
-	policy, err := s.policyRepo.GetByResourceID(resourceID)
-	if err != nil {
+// ListRoles lists roles. When scopeResourceID is set, only roles that can be bound on that
+// resource are returned: global roles and roles scoped to the resource or one of its ancestors.
+// When permission is set, only roles granting it are returned, least privileged first.
+func (s *IAMService) ListRoles(
+	includePredefined bool,
+	scopeResourceID *uuid.UUID,
+	permission string,
+	pageSize, offset int,
+) ([]domain.Role, error) {
+	if err := s.authorize("ListRoles", scopeResourceID); err != nil {
 		return nil, err
 	}
-	if policy == nil {
-		return nil, fmt.Errorf("policy not found")
-	}
 
-	// Check etag for optimistic concurrency control
-	if policy.ETag != etag {
-		return nil, fmt.Errorf("policy has been modified, etag mismatch")
+	var scopeIDs []uuid.UUID
+	if scopeResourceID != nil {
+		scopes, err := s.resourceScopes(*scopeResourceID)
+		if err != nil {
+			return nil, err
+		}
+		scopeIDs = make([]uuid.UUID, 0, len(scopes))
+		for id := range scopes {
+			scopeIDs = append(scopeIDs, id)
+		}
 	}
 
-	// Delete existing bindings
-	for _, binding := range policy.Bindings {
-		if err := s.bindingRepo.Delete(binding.ID); err != nil {
-			return nil, fmt.Errorf("failed to delete binding: %w", err)
-		}
+	if permission != "" {
+		return s.roleRepo.ListByPermission(permission, includePredefined, scopeIDs, pageSize, offset)
 	}
+	return s.roleRepo.List(includePredefined, scopeIDs, pageSize, offset)
+}
 
-	// Create new bindings
-	for i := range bindings {
-		bindings[i].PolicyID = policy.ID
-		if err := s.bindingRepo.Create(&bindings[i]); err != nil {
-			return nil, fmt.Errorf("failed to create binding: %w", err)
-		}
+// resourceScopes returns the resource and its ancestors: the scopes of the roles that may be bound on it
+func (s *IAMService) resourceScopes(resourceID uuid.UUID) (map[uuid.UUID]bool, error) {
+	ancestors, err := s.resourceRepo.GetAncestors(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource ancestors: %w", err)
 	}
 
-	// Update policy (will increment version and generate new etag)
-	if err := s.policyRepo.Update(policy); err != nil {
-		return nil, fmt.Errorf("failed to update policy: %w", err)
+	scopes := map[uuid.UUID]bool{resourceID: true}
+	for _, ancestor := range ancestors {
+		scopes[ancestor.ID] = true
 	}
+	return scopes, nil
+}
 
-	// Clear cache
-	s.cache.Clear()
+// scopeChecker checks roles against the scopes and type of one resource, loading them on first use
+type scopeChecker struct {
+	s          *IAMService
+	resourceID uuid.UUID
+	scopes     map[uuid.UUID]bool
+	resource   *domain.Resource
+}
+
+// check returns an ErrRoleOutOfScope error when role is scoped outside the resource's subtree,
+// or an ErrRoleNotAttachable error when the attachment rules do not allow it on the resource's type
+func (c *scopeChecker) check(role *domain.Role) error {
+	if role == nil {
+		return nil
+	}
+	if err := c.checkAttachment(role); err != nil {
+		return err
+	}
+	if role.ScopeResourceID == nil {
+		return nil
+	}
+
+	if c.scopes == nil {
+		scopes, err := c.s.resourceScopes(c.resourceID)
+		if err != nil {
+			return err
+		}
+		c.scopes = scopes
+	}
+
+	if !c.scopes[*role.ScopeResourceID] {
+		return fmt.Errorf("%w: role %s is scoped to resource %s", ErrRoleOutOfScope, role.Name, *role.ScopeResourceID)
+	}
+	return nil
+}
+
+// checkAttachment applies the attachment rule of role, if any, to the resource's type
+func (c *scopeChecker) checkAttachment(role *domain.Role) error {
+	if _, ok := c.s.attachmentRules[role.Name]; !ok {
+		return nil
+	}
+
+	if c.resource == nil {
+		resource, err := c.s.resourceRepo.GetByID(c.resourceID)
+		if err != nil {
+			return fmt.Errorf("failed to get resource: %w", err)
+		}
+		if resource == nil {
+			return fmt.Errorf("resource %s not found", c.resourceID)
+		}
+		c.resource = resource
+	}
+
+	if !c.s.attachmentRules.Allows(role.Name, c.resource.Type) {
+		return fmt.Errorf("%w: role %s may only be bound on %s resources, not %s",
+			ErrRoleNotAttachable, role.Name, c.s.attachmentRules.describe(role.Name), c.resource.Type)
+	}
+	return nil
+}
+
+// validateRoleScopes checks that every scoped role referenced by bindings may be bound on resourceID
+func (s *IAMService) validateRoleScopes(resourceID uuid.UUID, bindings []domain.Binding) error {
+	checker := &scopeChecker{s: s, resourceID: resourceID}
+	checked := make(map[uuid.UUID]bool)
+	for i := range bindings {
+		roleID := bindings[i].RoleID
+		if checked[roleID] {
+			continue
+		}
+		checked[roleID] = true
+
+		role, err := s.roleRepo.GetByID(roleID)
+		if err != nil {
+			return fmt.Errorf("binding %d: failed to get role: %w", i, err)
+		}
+		if err := checker.check(role); err != nil {
+			return fmt.Errorf("binding %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// =============== Policy Management ===============
+
+// CreatePolicy creates a new policy for a resource
+func (s *IAMService) CreatePolicy(resourceID uuid.UUID, bindings []domain.Binding) (*domain.Policy, error) {
+	if err := s.authorize("CreatePolicy", &resourceID); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: bindings, Replace: true}); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateConditions(bindings); err != nil {
+		return nil, err
+	}
+	if err := s.validateRoleScopes(resourceID, bindings); err != nil {
+		return nil, err
+	}
+	bindings, err := normalizeBindings(bindings)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPolicyLimits(resourceID, 0, bindings); err != nil {
+		return nil, err
+	}
+
+	if s.dryRun {
+		// The unique index rejects a second policy on create
+		existing, err := s.policyRepo.GetByResourceID(resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("resource %s already has a policy", resourceID)
+		}
+		return s.dryRunPolicy(nil, resourceID, bindings)
+	}
+
+	policy := &domain.Policy{
+		ResourceID: resourceID,
+		Version:    1,
+		CreatedBy:  s.caller,
+		UpdatedBy:  s.caller,
+	}
+
+	if err := s.policyRepo.Create(policy); err != nil {
+		return nil, fmt.Errorf("failed to create policy: %w", err)
+	}
+
+	// Create bindings
+	for i := range bindings {
+		bindings[i].PolicyID = policy.ID
+		if err := s.createBinding(&bindings[i]); err != nil {
+			return nil, err
+		}
+	}
 
-	return s.policyRepo.GetByID(policy.ID)
+	// Clear cache for this resource
+	s.cache.Clear()
+
+	return s.getPolicyAndRecordRevision(policy.ID)
+}
+
+// GetPolicy gets a policy for a resource, with its metadata
+func (s *IAMService) GetPolicy(resourceID uuid.UUID) (*domain.Policy, error) {
+	if err := s.authorize("GetPolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil || policy == nil {
+		return policy, err
+	}
+	return s.withMetadata(policy)
+}
+
+// UpdatePolicy updates a policy
+func (s *IAMService) UpdatePolicy(
+	resourceID uuid.UUID,
+	bindings []domain.Binding,
+	etag string,
+) (*domain.Policy, error) {
+	if err := s.authorize("UpdatePolicy", &resourceID); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: bindings, Replace: true}); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	// Check etag for optimistic concurrency control
+	if policy.ETag != etag {
+		return nil, fmt.Errorf("policy has been modified, etag mismatch")
+	}
+
+	return s.replaceBindings(policy, bindings)
+}
+
+// replaceBindings swaps all bindings of a policy, bumps its version and records a revision.
+// Conditions of the old bindings are deleted with them; conditions of the new bindings are
+// created, so bindings read from the current policy keep their conditions. New bindings
+// identical to an old one keep the old binding and its ID.
+func (s *IAMService) replaceBindings(policy *domain.Policy, bindings []domain.Binding) (*domain.Policy, error) {
+	if err := s.validateConditions(bindings); err != nil {
+		return nil, err
+	}
+	if err := s.validateRoleScopes(policy.ResourceID, bindings); err != nil {
+		return nil, err
+	}
+	bindings, err := normalizeBindings(bindings)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPolicyLimits(policy.ResourceID, 0, bindings); err != nil {
+		return nil, err
+	}
+
+	// Bindings identical to a current one keep it, so their IDs stay stable across replaces
+	kept, matches := matchBindings(policy.Bindings, bindings)
+	for i, match := range matches {
+		if match != nil {
+			bindings[i] = *match
+		}
+	}
+	if s.dryRun {
+		return s.dryRunPolicy(policy, policy.ResourceID, bindings)
+	}
+
+	// Delete the other existing bindings
+	for _, binding := range policy.Bindings {
+		if kept[binding.ID] {
+			continue
+		}
+		if binding.Condition != nil {
+			if err := s.conditionRepo.Delete(binding.Condition.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete condition: %w", err)
+			}
+		}
+		if err := s.bindingRepo.Delete(binding.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete binding: %w", err)
+		}
+	}
+
+	// Create new bindings
+	for i := range bindings {
+		if matches[i] != nil {
+			continue
+		}
+		bindings[i].PolicyID = policy.ID
+		if err := s.createBinding(&bindings[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Update policy (will increment version and generate new etag)
+	policy.UpdatedBy = s.caller
+	if err := s.policyRepo.Update(policy); err != nil {
+		return nil, fmt.Errorf("failed to update policy: %w", err)
+	}
+
+	// Clear cache
+	s.cache.Clear()
+
+	return s.getPolicyAndRecordRevision(policy.ID)
+}
+
+// getPolicyAndRecordRevision reloads a policy and stores an immutable snapshot of its current version,
+// authored by the caller of a caller view (AsCaller) and carrying its request metadata, if any
+func (s *IAMService) getPolicyAndRecordRevision(policyID uuid.UUID) (*domain.Policy, error) {
+	policy, err := s.policyRepo.GetByID(policyID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	revision, err := domain.NewPolicyRevision(canonicalPolicy(policy), s.caller)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot policy: %w", err)
+	}
+	revision.Service = s.request.Service
+	revision.RequestID = s.request.RequestID
+	if err := s.revisionRepo.Create(revision); err != nil {
+		return nil, fmt.Errorf("failed to record policy revision: %w", err)
+	}
+	policy.Metadata = policyMetadata(policy, revision)
+
+	if change := s.newPolicyChange(PolicyChangeUpdated, policy.ResourceID, policy.Version); change != nil {
+		change.ETag = policy.ETag
+		s.publishPolicyChange(change)
+	}
+
+	return policy, nil
+}
+
+// GetPolicyRevision gets a single revision of a resource's policy
+func (s *IAMService) GetPolicyRevision(resourceID uuid.UUID, revision int) (*domain.PolicyRevision, error) {
+	if err := s.authorize("GetPolicyRevision", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	return s.revisionRepo.GetByRevision(policy.ID, revision)
+}
+
+// ListPolicyRevisions lists revisions of a resource's policy, newest first
+func (s *IAMService) ListPolicyRevisions(resourceID uuid.UUID, pageSize, offset int) ([]domain.PolicyRevision, error) {
+	if err := s.authorize("ListPolicyRevisions", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	return s.revisionRepo.List(policy.ID, pageSize, offset)
+}
+
+// RollbackPolicy restores the bindings of a previous revision.
+// The rollback is itself recorded as a new revision, so it can be undone too.
+func (s *IAMService) RollbackPolicy(resourceID uuid.UUID, revision int) (*domain.Policy, error) {
+	if err := s.authorize("RollbackPolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	rev, err := s.revisionRepo.GetByRevision(policy.ID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if rev == nil {
+		return nil, fmt.Errorf("policy revision %d not found", revision)
+	}
+
+	bindings, err := rev.ToBindings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore bindings: %w", err)
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: bindings, Replace: true}); err != nil {
+		return nil, err
+	}
+
+	return s.replaceBindings(policy, bindings)
 }
 
 // DeletePolicy deletes a policy
 func (s *IAMService) DeletePolicy(resourceID uuid.UUID, etag string) error {
+	if err := s.authorize("DeletePolicy", &resourceID); err != nil {
+		return err
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Replace: true}); err != nil {
+		return err
+	}
+
 	policy, err := s.policyRepo.GetByResourceID(resourceID)
 	if err != nil {
 		return err
@@ -335,11 +1179,18 @@ func (s *IAMService) DeletePolicy(resourceID uuid.UUID, etag string) error {
 	if policy.ETag != etag {
 		return fmt.Errorf("policy has been modified, etag mismatch")
 	}
+	if s.dryRun {
+		return nil
+	}
 
 	// Clear cache
 	s.cache.Clear()
 
-	return s.policyRepo.Delete(policy.ID)
+	if err := s.policyRepo.Delete(policy.ID); err != nil {
+		return err
+	}
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeDeleted, resourceID, 0))
+	return nil
 }
 
 // ListPolicies lists policies
@@ -347,67 +1198,227 @@ func (s *IAMService) ListPolicies(
 	parentResourceID *uuid.UUID,
 	pageSize, offset int,
 ) ([]domain.Policy, error) {
+	if err := s.authorize("ListPolicies", parentResourceID); err != nil {
+		return nil, err
+	}
+
 	return s.policyRepo.List(parentResourceID, pageSize, offset)
 }
 
+// ListPoliciesWithDetails lists policies together with each binding's role and permissions,
+// avoiding a role lookup per binding for callers that render full policies
+func (s *IAMService) ListPoliciesWithDetails(
+	parentResourceID *uuid.UUID,
+	pageSize, offset int,
+) ([]domain.Policy, error) {
+	if err := s.authorize("ListPolicies", parentResourceID); err != nil {
+		return nil, err
+	}
+
+	return s.policyRepo.ListWithDetails(parentResourceID, pageSize, offset)
+}
+
 // =============== Binding Management ===============
 
-// CreateBinding creates a new binding
+// ValidateCondition compiles a condition expression against the condition context schema
+// (request.time, request.ip, resource.type, resource.name, resource.attributes, context)
+func (s *IAMService) ValidateCondition(expression string) error {
+	if err := ValidateConditionExpression(expression); err != nil {
+		return fmt.Errorf("invalid condition: %w", err)
+	}
+	return nil
+}
+
+// validateConditions compiles the condition of every binding
+func (s *IAMService) validateConditions(bindings []domain.Binding) error {
+	for i := range bindings {
+		if bindings[i].Condition != nil {
+			if err := s.ValidateCondition(bindings[i].Condition.Expression); err != nil {
+				return fmt.Errorf("binding %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateBinding creates a new binding, creating the resource's policy if needed, bumps the policy
+// version and records a revision
 func (s *IAMService) CreateBinding(
 	resourceID, roleID uuid.UUID,
 	members []string,
 	condition *domain.Condition,
 ) (*domain.Binding, error) {
+	if err := s.authorize("CreateBinding", &resourceID); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRoleScopes(resourceID, []domain.Binding{{RoleID: roleID}}); err != nil {
+		return nil, err
+	}
+	if condition != nil {
+		if err := s.ValidateCondition(condition.Expression); err != nil {
+			return nil, err
+		}
+	}
+
+	// Members are stored sorted and deduplicated
+	encoded, err := membersJSON(members)
+	if err != nil {
+		return nil, err
+	}
+	granted := domain.Binding{RoleID: roleID, Members: encoded, Condition: condition}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: []domain.Binding{granted}}); err != nil {
+		return nil, err
+	}
+
 	// Get or create policy for this resource
 	policy, err := s.policyRepo.GetByResourceID(resourceID)
 	if err != nil {
 		return nil, err
 	}
+	existing := 0
+	if policy != nil {
+		existing = len(policy.Bindings)
+		if indexOfGrant(policy.Bindings, roleID, condition) >= 0 {
+			merged, err := s.mergeBindings(policy, []domain.Binding{granted})
+			if err != nil {
+				return nil, err
+			}
+			return &merged.Bindings[indexOfGrant(merged.Bindings, roleID, condition)], nil
+		}
+	}
+	added := domain.Binding{Members: encoded, Condition: condition}
+	if err := s.checkPolicyLimits(resourceID, existing, []domain.Binding{added}); err != nil {
+		return nil, err
+	}
+	if s.dryRun {
+		result, err := s.dryRunPolicy(policy, resourceID, []domain.Binding{granted})
+		if err != nil {
+			return nil, err
+		}
+		return &result.Bindings[0], nil
+	}
 	if policy == nil {
 		// Create policy
 		policy = &domain.Policy{
 			ResourceID: resourceID,
 			Version:    1,
+			CreatedBy:  s.caller,
+			UpdatedBy:  s.caller,
 		}
 		if err := s.policyRepo.Create(policy); err != nil {
 			return nil, fmt.Errorf("failed to create policy: %w", err)
 		}
 	}
 
-	// Convert members to JSON
-	membersJSON, err := json.Marshal(members)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal members: %w", err)
-	}
-
 	binding := &domain.Binding{
 		PolicyID: policy.ID,
 		RoleID:   roleID,
-		Members:  datatypes.JSON(membersJSON),
+		Members:  encoded,
 	}
 
-	if err := s.bindingRepo.Create(binding); err != nil {
-		return nil, fmt.Errorf("failed to create binding: %w", err)
+	binding.Condition = condition
+	if err := s.createBinding(binding); err != nil {
+		return nil, err
 	}
-
-	// Create condition if provided
-	if condition != nil {
-		condition.BindingID = binding.ID
-		// Note: You'd need a condition repository to save this
+	if err := s.bumpPolicyVersion(policy); err != nil {
+		return nil, err
 	}
 
 	// Clear cache
 	s.cache.Clear()
 
+	if _, err := s.getPolicyAndRecordRevision(policy.ID); err != nil {
+		return nil, err
+	}
 	return s.bindingRepo.GetByID(binding.ID)
 }
 
-// DeleteBinding deletes a binding
+// bumpPolicyVersion increments the version and regenerates the etag of a policy whose bindings
+// changed. Its loaded bindings are not saved with it.
+func (s *IAMService) bumpPolicyVersion(policy *domain.Policy) error {
+	bumped := *policy
+	bumped.Bindings = nil
+	bumped.UpdatedBy = s.caller
+	if err := s.policyRepo.Update(&bumped); err != nil {
+		return fmt.Errorf("failed to update policy: %w", err)
+	}
+	return nil
+}
+
+// createBinding creates a binding and its condition, if any.
+// The condition is always inserted as a new row owned by the new binding.
+func (s *IAMService) createBinding(binding *domain.Binding) error {
+	binding.CreatedBy = s.caller
+	binding.UpdatedBy = s.caller
+	if err := s.bindingRepo.Create(binding); err != nil {
+		return fmt.Errorf("failed to create binding: %w", err)
+	}
+
+	if binding.Condition == nil {
+		return nil
+	}
+
+	condition := &domain.Condition{
+		BindingID:   binding.ID,
+		Title:       binding.Condition.Title,
+		Description: binding.Condition.Description,
+		Expression:  binding.Condition.Expression,
+	}
+	if err := s.conditionRepo.Create(condition); err != nil {
+		return fmt.Errorf("failed to create condition: %w", err)
+	}
+	binding.Condition = condition
+
+	return nil
+}
+
+// DeleteBinding deletes a binding and its condition, bumps the policy version and records a revision
 func (s *IAMService) DeleteBinding(id uuid.UUID) error {
+	if err := s.authorizeBindingRemoval("DeleteBinding", id); err != nil {
+		return err
+	}
+
+	binding, err := s.bindingRepo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get binding: %w", err)
+	}
+	if binding == nil {
+		return fmt.Errorf("binding not found")
+	}
+	policy, err := s.policyRepo.GetByID(binding.PolicyID)
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %w", err)
+	}
+	if policy == nil {
+		return fmt.Errorf("policy not found")
+	}
+	if s.dryRun {
+		return nil
+	}
+
+	condition, err := s.conditionRepo.GetByBindingID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get condition: %w", err)
+	}
+	if condition != nil {
+		if err := s.conditionRepo.Delete(condition.ID); err != nil {
+			return fmt.Errorf("failed to delete condition: %w", err)
+		}
+	}
+
 	// Clear cache
 	s.cache.Clear()
 
-	return s.bindingRepo.Delete(id)
+	if err := s.bindingRepo.Delete(id); err != nil {
+		return err
+	}
+	if err := s.bumpPolicyVersion(policy); err != nil {
+		return err
+	}
+
+	_, err = s.getPolicyAndRecordRevision(policy.ID)
+	return err
 }
 
 // ListBindings lists bindings for a resource
@@ -416,8 +1427,241 @@ func (s *IAMService) ListBindings(
 	principal string,
 	pageSize, offset int,
 ) ([]domain.Binding, error) {
+	if err := s.authorize("ListBindings", &resourceID); err != nil {
+		return nil, err
+	}
+
 	if principal != "" {
 		return s.bindingRepo.ListByPrincipal(principal, pageSize, offset)
 	}
 	return s.bindingRepo.ListByResourceID(resourceID, pageSize, offset)
 }
+
+// SearchBindings finds bindings across all resources by member substring, role name, resource
+// subtree or condition text, oldest first, with the total number of matches. Each binding's
+// Policy identifies the resource it is on.
+func (s *IAMService) SearchBindings(
+	query repository.BindingSearch,
+	pageSize, offset int,
+) ([]domain.Binding, int64, error) {
+	var scope *uuid.UUID
+	if query.ResourceID != uuid.Nil {
+		scope = &query.ResourceID
+	}
+	if err := s.authorize("SearchBindings", scope); err != nil {
+		return nil, 0, err
+	}
+
+	query.Member = strings.TrimSpace(query.Member)
+	query.Role = strings.TrimSpace(query.Role)
+	query.Condition = strings.TrimSpace(query.Condition)
+	if query.Member == "" && query.Role == "" && query.ResourceID == uuid.Nil && query.Condition == "" {
+		return nil, 0, fmt.Errorf("at least one of member, role, resource or condition is required")
+	}
+	if pageSize < 0 || offset < 0 {
+		return nil, 0, fmt.Errorf("page size and offset must not be negative")
+	}
+
+	bindings, total, err := s.bindingRepo.Search(query, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search bindings: %w", err)
+	}
+	return bindings, total, nil
+}
+
+// BatchCreateBindings validates and creates many bindings on a resource's policy in a single transaction.
+// The policy version is bumped and the cache invalidated once for the whole batch. Bindings granting
+// the same role under the same condition as another, new or existing, are merged into it.
+func (s *IAMService) BatchCreateBindings(resourceID uuid.UUID, bindings []domain.Binding) (*domain.Policy, error) {
+	if err := s.authorize("BatchCreateBindings", &resourceID); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: bindings}); err != nil {
+		return nil, err
+	}
+
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("no bindings provided")
+	}
+
+	// Validate every binding before touching the database
+	checkedRoles := make(map[uuid.UUID]bool)
+	scopes := &scopeChecker{s: s, resourceID: resourceID}
+	for i := range bindings {
+		members, err := bindings[i].GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: invalid members: %w", i, err)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("binding %d: at least one member is required", i)
+		}
+		if bindings[i].RoleID == uuid.Nil {
+			return nil, fmt.Errorf("binding %d: role is required", i)
+		}
+		if bindings[i].Condition != nil {
+			if err := s.ValidateCondition(bindings[i].Condition.Expression); err != nil {
+				return nil, fmt.Errorf("binding %d: %w", i, err)
+			}
+		}
+		if checkedRoles[bindings[i].RoleID] {
+			continue
+		}
+		role, err := s.roleRepo.GetByID(bindings[i].RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: failed to get role: %w", i, err)
+		}
+		if role == nil {
+			return nil, fmt.Errorf("binding %d: role %s not found", i, bindings[i].RoleID)
+		}
+		if err := scopes.check(role); err != nil {
+			return nil, fmt.Errorf("binding %d: %w", i, err)
+		}
+		checkedRoles[bindings[i].RoleID] = true
+	}
+
+	// Get or create policy for this resource
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if bindings, err = normalizeBindings(bindings); err != nil {
+		return nil, err
+	}
+	existing := 0
+	if policy != nil {
+		existing = len(policy.Bindings)
+		if slices.ContainsFunc(bindings, func(binding domain.Binding) bool {
+			return indexOfGrant(policy.Bindings, binding.RoleID, binding.Condition) >= 0
+		}) {
+			return s.mergeBindings(policy, bindings)
+		}
+	}
+	if err := s.checkPolicyLimits(resourceID, existing, bindings); err != nil {
+		return nil, err
+	}
+	if s.dryRun {
+		var current []domain.Binding
+		if policy != nil {
+			current = policy.Bindings
+		}
+		return s.dryRunPolicy(policy, resourceID, append(slices.Clip(current), bindings...))
+	}
+	if policy == nil {
+		policy = &domain.Policy{
+			ResourceID: resourceID,
+			Version:    1,
+			CreatedBy:  s.caller,
+		}
+		if err := s.policyRepo.Create(policy); err != nil {
+			return nil, fmt.Errorf("failed to create policy: %w", err)
+		}
+	}
+
+	for i := range bindings {
+		bindings[i].CreatedBy = s.caller
+		bindings[i].UpdatedBy = s.caller
+	}
+	policy.UpdatedBy = s.caller
+	if err := s.bindingRepo.CreateBatch(policy, bindings); err != nil {
+		return nil, fmt.Errorf("failed to create bindings: %w", err)
+	}
+
+	// Clear cache
+	s.cache.Clear()
+
+	return s.getPolicyAndRecordRevision(policy.ID)
+}
+
+// BatchDeleteBindings deletes many bindings from a resource's policy in a single transaction.
+// The policy version is bumped and the cache invalidated once for the whole batch.
+func (s *IAMService) BatchDeleteBindings(resourceID uuid.UUID, bindingIDs []uuid.UUID) (*domain.Policy, error) {
+	if err := s.authorize("BatchDeleteBindings", &resourceID); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Remove: bindingIDs}); err != nil {
+		return nil, err
+	}
+
+	if len(bindingIDs) == 0 {
+		return nil, fmt.Errorf("no bindings provided")
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("policy not found")
+	}
+
+	// Validate every binding belongs to this policy
+	existing := make(map[uuid.UUID]bool, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		existing[binding.ID] = true
+	}
+	seen := make(map[uuid.UUID]bool, len(bindingIDs))
+	for _, id := range bindingIDs {
+		if !existing[id] {
+			return nil, fmt.Errorf("binding %s not found on resource %s", id, resourceID)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("binding %s listed more than once", id)
+		}
+		seen[id] = true
+	}
+	if s.dryRun {
+		kept := make([]domain.Binding, 0, len(policy.Bindings))
+		for _, binding := range policy.Bindings {
+			if !seen[binding.ID] {
+				kept = append(kept, binding)
+			}
+		}
+		return s.dryRunPolicy(policy, resourceID, kept)
+	}
+
+	policy.UpdatedBy = s.caller
+	if err := s.bindingRepo.DeleteBatch(policy, bindingIDs); err != nil {
+		return nil, fmt.Errorf("failed to delete bindings: %w", err)
+	}
+
+	// Clear cache
+	s.cache.Clear()
+
+	return s.getPolicyAndRecordRevision(policy.ID)
+}
+
+// =============== Operations ===============
+
+// SetOperationRunner enables the long-running operation APIs.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetOperationRunner(runner *OperationRunner) {
+	s.operations = runner
+}
+
+// GetOperation gets a long-running operation by ID
+func (s *IAMService) GetOperation(id uuid.UUID) (*domain.Operation, error) {
+	if err := s.authorize("GetOperation", nil); err != nil {
+		return nil, err
+	}
+
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+	return s.operations.Get(id)
+}
+
+// ListOperations lists long-running operations newest first, optionally filtered by type and state
+func (s *IAMService) ListOperations(
+	operationType string,
+	state domain.OperationState,
+	pageSize, offset int,
+) ([]domain.Operation, error) {
+	if err := s.authorize("ListOperations", nil); err != nil {
+		return nil, err
+	}
+
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+	return s.operations.List(operationType, state, pageSize, offset)
+}
@@ -1,12 +1,17 @@
 package service
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
 	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Test: Update Resource
@@ -16,17 +21,19 @@ func TestIAMService_UpdateResource(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	resource := &domain.Resource{
 		ID:   resourceID,
 		Type: "bucket",
 		Name: "updated-bucket",
-		Attributes: map[string]string{
+		Attributes: map[string]interface{}{
 			"region": "us-west-2",
 		},
 	}
@@ -36,7 +43,7 @@ func TestIAMService_UpdateResource(t *testing.T) {
 	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil)
 
 	// Update resource
-	updatedResource, err := service.UpdateResource(resourceID, "updated-bucket", map[string]string{"region": "us-west-2"})
+	updatedResource, err := service.UpdateResource(resourceID, "updated-bucket", map[string]interface{}{"region": "us-west-2"}, nil, "")
 
 	// Assert
 	assert.NoError(t, err)
@@ -44,6 +51,41 @@ func TestIAMService_UpdateResource(t *testing.T) {
 	resourceRepo.AssertExpectations(t)
 }
 
+// Test: Updating the attributes of a resource, which conditions read, invalidates cached
+// decisions and notifies the watchers
+func TestIAMService_UpdateResource_InvalidatesDecisions(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.cache = NewTestMemoryCache()
+	service.SetPolicyWatcher(NewPolicyWatcher(10))
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket", Name: "logs"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, done := watch(t, service, ctx, resourceID)
+
+	key := GenerateCacheKey("user:alice@example.com", resourceID.String(), "storage.objects.get")
+	service.cache.Set(key, "roles/viewer")
+
+	_, err := service.UpdateResource(resourceID, "", map[string]interface{}{"classification": "restricted"}, []string{ResourceFieldAttributes}, "")
+	require.NoError(t, err)
+
+	_, found := service.cache.Get(key)
+	assert.False(t, found)
+	select {
+	case change := <-changes:
+		assert.Equal(t, PolicyChangeResource, change.Kind)
+		assert.Equal(t, resourceID, change.ResourceID)
+	case <-time.After(time.Second):
+		t.Fatal("no change received")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
 // Test: List Resources
 func TestIAMService_ListResources(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -51,10 +93,12 @@ func TestIAMService_ListResources(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	parentID := uuid.New()
 	expectedResources := []domain.Resource{
@@ -63,10 +107,10 @@ func TestIAMService_ListResources(t *testing.T) {
 	}
 
 	// Mock expectations
-	resourceRepo.On("List", &parentID, "project", 10, 0).Return(expectedResources, nil)
+	resourceRepo.On("List", &parentID, "project", map[string]interface{}(nil), map[string]string(nil), 10, 0).Return(expectedResources, nil)
 
 	// List resources
-	resources, err := service.ListResources(&parentID, "project", 10, 0)
+	resources, err := service.ListResources(&parentID, "project", nil, nil, 10, 0)
 
 	// Assert
 	assert.NoError(t, err)
@@ -81,10 +125,12 @@ func TestIAMService_GetResourceHierarchy(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	ancestors := []domain.Resource{
@@ -116,10 +162,12 @@ func TestIAMService_GetPermission(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	permID := uuid.New()
 	expectedPerm := &domain.Permission{
@@ -147,10 +195,12 @@ func TestIAMService_ListPermissions(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	expectedPerms := []domain.Permission{
 		{ID: uuid.New(), Name: "storage.read", Service: "storage"},
@@ -176,10 +226,12 @@ func TestIAMService_GetRole(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	roleID := uuid.New()
 	expectedRole := &domain.Role{
@@ -207,10 +259,12 @@ func TestIAMService_UpdateRole(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	roleID := uuid.New()
 	role := &domain.Role{
@@ -230,7 +284,7 @@ func TestIAMService_UpdateRole(t *testing.T) {
 	roleRepo.On("Update", mock.AnythingOfType("*domain.Role")).Return(nil)
 
 	// Update role
-	updatedRole, err := service.UpdateRole(roleID, role.Title, role.Description, permIDs)
+	updatedRole, err := service.UpdateRole(roleID, role.Title, role.Description, permIDs, nil, "", "")
 
 	// Assert
 	assert.NoError(t, err)
@@ -239,6 +293,88 @@ func TestIAMService_UpdateRole(t *testing.T) {
 	permissionRepo.AssertExpectations(t)
 }
 
+// Test: Updating a role's permissions clears cached decisions granted through it
+func TestIAMService_UpdateRole_ClearsCache(t *testing.T) {
+	roleRepo := new(MockRoleRepository)
+	permissionRepo := new(MockPermissionRepository)
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+	service := NewIAMService(new(MockResourceRepository), permissionRepo, roleRepo, new(MockPolicyRepository),
+		new(MockBindingRepository), new(MockPolicyRevisionRepository), new(MockConditionRepository),
+		new(MockPermissionEvaluator), cache)
+
+	roleID := uuid.New()
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/editor"}, nil)
+	permissionRepo.On("GetByIDs", []uuid.UUID(nil)).Return([]domain.Permission{}, nil)
+	roleRepo.On("Update", mock.AnythingOfType("*domain.Role")).Return(nil)
+
+	key := GenerateCacheKey("user:alice@example.com", uuid.NewString(), "storage.write")
+	cache.Set(key, "roles/editor")
+
+	_, err := service.UpdateRole(roleID, "Editor", "", nil, nil, "", "")
+	assert.NoError(t, err)
+	_, found := cache.Get(key)
+	assert.False(t, found)
+}
+
+// Test: Fields left out of the update mask are kept
+func TestIAMService_UpdateWithMask(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{
+		ID: resourceID, Name: "data", Attributes: domain.Attributes{"region": "eu"},
+	}, nil)
+	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil)
+
+	resource, err := service.UpdateResource(resourceID, "renamed", nil, []string{ResourceFieldName}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", resource.Name)
+	assert.Equal(t, domain.Attributes{"region": "eu"}, resource.Attributes)
+
+	roleID := uuid.New()
+	read := domain.Permission{ID: uuid.New(), Name: "storage.buckets.get"}
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{
+		ID: roleID, Title: "Viewer", Description: "Reads buckets", Permissions: []domain.Permission{read},
+	}, nil)
+	roleRepo.On("Update", mock.AnythingOfType("*domain.Role")).Return(nil)
+
+	role, err := service.UpdateRole(roleID, "", "Reads storage", nil, []string{RoleFieldDescription}, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Viewer", role.Title)
+	assert.Equal(t, "Reads storage", role.Description)
+	assert.Equal(t, []domain.Permission{read}, role.Permissions)
+	permissionRepo.AssertNotCalled(t, "GetByIDs", mock.Anything)
+
+	_, err = service.UpdateRole(roleID, "", "", nil, []string{"name"}, "", "")
+	assert.ErrorIs(t, err, ErrInvalidUpdateMask)
+	_, err = service.UpdateResource(resourceID, "", nil, []string{"parent_id"}, "")
+	assert.ErrorIs(t, err, ErrInvalidUpdateMask)
+}
+
+// Test: Updates with a stale etag are rejected before anything is written
+func TestIAMService_UpdateWithETag(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Name: "data", ETag: "etag-1"}, nil)
+	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil).Once()
+
+	_, err := service.UpdateResource(resourceID, "renamed", nil, []string{ResourceFieldName}, "etag-1")
+	require.NoError(t, err)
+	_, err = service.UpdateResource(resourceID, "renamed", nil, []string{ResourceFieldName}, "etag-0")
+	assert.ErrorIs(t, err, repository.ErrETagMismatch)
+	resourceRepo.AssertNumberOfCalls(t, "Update", 1)
+
+	roleID := uuid.New()
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Title: "Viewer", ETag: "etag-1"}, nil)
+	_, err = service.UpdateRole(roleID, "Reader", "", nil, []string{RoleFieldTitle}, "etag-0", "")
+	assert.ErrorIs(t, err, repository.ErrETagMismatch)
+	roleRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
 // Test: Delete Role
 func TestIAMService_DeleteRole(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -246,10 +382,12 @@ func TestIAMService_DeleteRole(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	roleID := uuid.New()
 
@@ -257,13 +395,71 @@ func TestIAMService_DeleteRole(t *testing.T) {
 	roleRepo.On("Delete", roleID).Return(nil)
 
 	// Delete role
-	err := service.DeleteRole(roleID)
+	err := service.DeleteRole(roleID, false)
 
 	// Assert
 	assert.NoError(t, err)
 	roleRepo.AssertExpectations(t)
 }
 
+// Test: Delete Role fails while bindings reference it
+func TestIAMService_DeleteRole_InUse(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleID := uuid.New()
+	inUse := &repository.RoleInUseError{RoleID: roleID, BindingIDs: []uuid.UUID{uuid.New()}, Total: 1}
+	roleRepo.On("Delete", roleID).Return(inUse)
+
+	err := service.DeleteRole(roleID, false)
+
+	var roleErr *repository.RoleInUseError
+	assert.ErrorIs(t, err, repository.ErrRoleInUse)
+	assert.ErrorAs(t, err, &roleErr)
+	assert.Equal(t, int64(1), roleErr.Total)
+	roleRepo.AssertNotCalled(t, "DeleteCascade", roleID)
+}
+
+// Test: Force-deleting a role removes its bindings and records policy revisions
+func TestIAMService_DeleteRole_Force(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleID := uuid.New()
+	policyA := &domain.Policy{ID: uuid.New(), ResourceID: uuid.New(), Version: 2}
+	policyB := &domain.Policy{ID: uuid.New(), ResourceID: uuid.New(), Version: 5}
+
+	roleRepo.On("DeleteCascade", roleID).Return([]uuid.UUID{policyA.ID, policyB.ID}, nil)
+	policyRepo.On("GetByID", policyA.ID).Return(policyA, nil)
+	policyRepo.On("GetByID", policyB.ID).Return(policyB, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Twice()
+
+	err := service.DeleteRole(roleID, true)
+
+	assert.NoError(t, err)
+	roleRepo.AssertExpectations(t)
+	revisionRepo.AssertExpectations(t)
+	roleRepo.AssertNotCalled(t, "Delete", roleID)
+}
+
 // Test: List Roles
 func TestIAMService_ListRoles(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -271,10 +467,12 @@ func TestIAMService_ListRoles(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	expectedRoles := []domain.Role{
 		{ID: uuid.New(), Name: "roles/viewer", Title: "Viewer"},
@@ -282,10 +480,10 @@ func TestIAMService_ListRoles(t *testing.T) {
 	}
 
 	// Mock expectations
-	roleRepo.On("List", true, 10, 0).Return(expectedRoles, nil)
+	roleRepo.On("List", true, []uuid.UUID(nil), 10, 0).Return(expectedRoles, nil)
 
 	// List roles
-	roles, err := service.ListRoles(true, 10, 0)
+	roles, err := service.ListRoles(true, nil, "", 10, 0)
 
 	// Assert
 	assert.NoError(t, err)
@@ -300,10 +498,14 @@ func TestIAMService_UpdatePolicy(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleRepo.On("GetByID", mock.Anything).Return(&domain.Role{ID: uuid.New(), Name: "roles/viewer"}, nil).Maybe()
 
 	policyID := uuid.New()
 	resourceID := uuid.New()
@@ -338,6 +540,7 @@ func TestIAMService_UpdatePolicy(t *testing.T) {
 		Bindings:   newBindings,
 	}
 	policyRepo.On("GetByID", policyID).Return(updatedPolicy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
 
 	// Update policy
 	policy, err := service.UpdatePolicy(resourceID, newBindings, "old-etag")
@@ -348,6 +551,106 @@ func TestIAMService_UpdatePolicy(t *testing.T) {
 	policyRepo.AssertExpectations(t)
 }
 
+// Test: Update Policy replaces conditions along with bindings
+func TestIAMService_UpdatePolicy_ReplacesConditions(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleRepo.On("GetByID", mock.Anything).Return(&domain.Role{ID: uuid.New(), Name: "roles/viewer"}, nil).Maybe()
+
+	policyID := uuid.New()
+	resourceID := uuid.New()
+	roleID := uuid.New()
+	oldBindingID := uuid.New()
+	oldConditionID := uuid.New()
+
+	oldCondition := &domain.Condition{
+		ID:         oldConditionID,
+		BindingID:  oldBindingID,
+		Title:      "Prod only",
+		Expression: `context.env == "prod"`,
+	}
+	existingPolicy := &domain.Policy{
+		ID:         policyID,
+		ResourceID: resourceID,
+		ETag:       "old-etag",
+		Bindings: []domain.Binding{
+			{ID: oldBindingID, RoleID: roleID, Condition: oldCondition},
+		},
+	}
+
+	// The caller sends back the binding it read, condition included
+	newBindings := []domain.Binding{
+		{
+			RoleID:    roleID,
+			Members:   toJSON([]string{"user:alice@example.com"}),
+			Condition: oldCondition,
+		},
+	}
+	newBindingID := uuid.New()
+
+	policyRepo.On("GetByResourceID", resourceID).Return(existingPolicy, nil)
+	conditionRepo.On("Delete", oldConditionID).Return(nil)
+	bindingRepo.On("Delete", oldBindingID).Return(nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Binding).ID = newBindingID
+	})
+	conditionRepo.On("Create", mock.MatchedBy(func(c *domain.Condition) bool {
+		return c.ID == uuid.Nil && c.BindingID == newBindingID && c.Expression == `context.env == "prod"`
+	})).Return(nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: resourceID}, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	_, err := service.UpdatePolicy(resourceID, newBindings, "old-etag")
+
+	assert.NoError(t, err)
+	conditionRepo.AssertExpectations(t)
+	bindingRepo.AssertExpectations(t)
+}
+
+// Test: Update Policy rejects invalid conditions before changing anything
+func TestIAMService_UpdatePolicy_InvalidCondition(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	existingPolicy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		ETag:       "etag",
+		Bindings:   []domain.Binding{{ID: uuid.New(), RoleID: uuid.New()}},
+	}
+	policyRepo.On("GetByResourceID", resourceID).Return(existingPolicy, nil)
+
+	_, err := service.UpdatePolicy(resourceID, []domain.Binding{{
+		RoleID:    uuid.New(),
+		Members:   toJSON([]string{"user:alice@example.com"}),
+		Condition: &domain.Condition{Expression: "unknown_variable == 1"},
+	}}, "etag")
+
+	assert.Error(t, err)
+	bindingRepo.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
 // Test: List Policies
 func TestIAMService_ListPolicies(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -355,10 +658,12 @@ func TestIAMService_ListPolicies(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	parentID := uuid.New()
 	expectedPolicies := []domain.Policy{
@@ -378,6 +683,35 @@ func TestIAMService_ListPolicies(t *testing.T) {
 	policyRepo.AssertExpectations(t)
 }
 
+func TestIAMService_ListPoliciesWithDetails(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	role := &domain.Role{ID: uuid.New(), Name: "roles/viewer"}
+	expectedPolicies := []domain.Policy{
+		{ID: uuid.New(), Bindings: []domain.Binding{{ID: uuid.New(), RoleID: role.ID, Role: role}}},
+	}
+
+	policyRepo.On("ListWithDetails", (*uuid.UUID)(nil), 10, 0).Return(expectedPolicies, nil)
+
+	policies, err := service.ListPoliciesWithDetails(nil, 10, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, "roles/viewer", policies[0].Bindings[0].Role.Name)
+	policyRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything, mock.Anything)
+	roleRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
 // Test: Create Binding
 func TestIAMService_CreateBinding(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -385,10 +719,14 @@ func TestIAMService_CreateBinding(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleRepo.On("GetByID", mock.Anything).Return(&domain.Role{ID: uuid.New(), Name: "roles/viewer"}, nil).Maybe()
 
 	resourceID := uuid.New()
 	policyID := uuid.New()
@@ -415,14 +753,42 @@ func TestIAMService_CreateBinding(t *testing.T) {
 		Members:  toJSON(members),
 	}
 	bindingRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(createdBinding, nil)
+	policyRepo.On("Update", mock.MatchedBy(func(p *domain.Policy) bool { return p.ID == policyID })).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: resourceID, Version: 2,
+		Bindings: []domain.Binding{*createdBinding}}, nil)
+	var revision *domain.PolicyRevision
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Run(func(args mock.Arguments) {
+		revision = args.Get(0).(*domain.PolicyRevision)
+	})
 
 	// Create binding
-	binding, err := service.CreateBinding(resourceID, roleID, members, nil)
+	binding, err := service.AsCaller("user:admin@example.com").CreateBinding(resourceID, roleID, members, nil)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NotNil(t, binding)
 	bindingRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+	if assert.NotNil(t, revision) {
+		assert.Equal(t, 2, revision.Revision)
+		assert.Equal(t, "user:admin@example.com", revision.Author)
+	}
+}
+
+// Test: An invalid condition is rejected before a policy is created for the resource
+func TestIAMService_CreateBinding_InvalidConditionCreatesNoPolicy(t *testing.T) {
+	policyRepo := new(MockPolicyRepository)
+	service := NewIAMService(new(MockResourceRepository), new(MockPermissionRepository), new(MockRoleRepository),
+		policyRepo, new(MockBindingRepository), new(MockPolicyRevisionRepository), new(MockConditionRepository),
+		new(MockPermissionEvaluator), NewNoopCache())
+	service.roleRepo.(*MockRoleRepository).On("GetByID", mock.Anything).Return(&domain.Role{Name: "roles/viewer"}, nil).Maybe()
+	policyRepo.On("GetByResourceID", mock.Anything).Return(nil, nil).Maybe()
+
+	_, err := service.CreateBinding(uuid.New(), uuid.New(), []string{"user:alice@example.com"},
+		&domain.Condition{Expression: "request.time <"})
+
+	assert.ErrorContains(t, err, "invalid condition")
+	policyRepo.AssertNotCalled(t, "Create", mock.Anything)
 }
 
 // Test: Delete Binding
@@ -432,15 +798,27 @@ func TestIAMService_DeleteBinding(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	bindingID := uuid.New()
 
+	conditionID := uuid.New()
+
+	policyID := uuid.New()
+
 	// Mock expectations
+	bindingRepo.On("GetByID", bindingID).Return(&domain.Binding{ID: bindingID, PolicyID: policyID}, nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: uuid.New(), Version: 3}, nil)
+	conditionRepo.On("GetByBindingID", bindingID).Return(&domain.Condition{ID: conditionID, BindingID: bindingID}, nil)
+	conditionRepo.On("Delete", conditionID).Return(nil)
 	bindingRepo.On("Delete", bindingID).Return(nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
 
 	// Delete binding
 	err := service.DeleteBinding(bindingID)
@@ -448,6 +826,9 @@ func TestIAMService_DeleteBinding(t *testing.T) {
 	// Assert
 	assert.NoError(t, err)
 	bindingRepo.AssertExpectations(t)
+	conditionRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+	revisionRepo.AssertExpectations(t)
 }
 
 // Test: List Bindings
@@ -457,10 +838,12 @@ func TestIAMService_ListBindings(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	expectedBindings := []domain.Binding{
@@ -479,3 +862,678 @@ func TestIAMService_ListBindings(t *testing.T) {
 	assert.Len(t, bindings, 2)
 	bindingRepo.AssertExpectations(t)
 }
+
+// Test: Batch Create Bindings
+func TestIAMService_BatchCreateBindings(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	roleID := uuid.New()
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Version: 1}
+	bindings := []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+		{RoleID: roleID, Members: toJSON([]string{"user:bob@example.com"})},
+	}
+
+	// Mock expectations (role is looked up once even when shared, and its bindings are merged)
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/viewer"}, nil).Once()
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	merged := []domain.Binding{{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com"})}}
+	bindingRepo.On("CreateBatch", policy, merged).Return(nil).Once()
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	result, err := service.BatchCreateBindings(resourceID, bindings)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, policy, result)
+	roleRepo.AssertExpectations(t)
+	bindingRepo.AssertExpectations(t)
+}
+
+// Test: Batch Create Bindings - validation failure touches nothing
+func TestIAMService_BatchCreateBindings_ValidationError(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleID := uuid.New()
+	bindings := []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+		{RoleID: roleID, Members: toJSON([]string{})},
+	}
+
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID}, nil)
+
+	_, err := service.BatchCreateBindings(uuid.New(), bindings)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "binding 1")
+	bindingRepo.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+}
+
+// Test: Batch Delete Bindings
+func TestIAMService_BatchDeleteBindings(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	b1, b2 := uuid.New(), uuid.New()
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Bindings: []domain.Binding{
+			{ID: b1, Members: toJSON([]string{"user:alice@example.com"})},
+			{ID: b2, Members: toJSON([]string{"user:bob@example.com"})},
+		},
+	}
+
+	// Mock expectations
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	bindingRepo.On("DeleteBatch", policy, []uuid.UUID{b1, b2}).Return(nil).Once()
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	_, err := service.BatchDeleteBindings(resourceID, []uuid.UUID{b1, b2})
+
+	// Assert
+	assert.NoError(t, err)
+	bindingRepo.AssertExpectations(t)
+}
+
+// Test: Batch Delete Bindings - unknown binding
+func TestIAMService_BatchDeleteBindings_UnknownBinding(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Bindings: []domain.Binding{{ID: uuid.New()}}}
+
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	_, err := service.BatchDeleteBindings(resourceID, []uuid.UUID{uuid.New()})
+
+	// Assert
+	assert.Error(t, err)
+	bindingRepo.AssertNotCalled(t, "DeleteBatch", mock.Anything, mock.Anything)
+}
+
+// Test: Rollback Policy restores bindings from a revision
+func TestIAMService_RollbackPolicy(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleRepo.On("GetByID", mock.Anything).Return(&domain.Role{ID: uuid.New(), Name: "roles/viewer"}, nil).Maybe()
+
+	resourceID := uuid.New()
+	roleID := uuid.New()
+	currentBindingID := uuid.New()
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Version:    3,
+		Bindings:   []domain.Binding{{ID: currentBindingID, RoleID: roleID, Members: toJSON([]string{"user:bob@example.com"})}},
+	}
+
+	// Revision 1 had alice with a condition
+	old, err := domain.NewPolicyRevision(&domain.Policy{
+		ID:         policy.ID,
+		ResourceID: resourceID,
+		Version:    1,
+		Bindings: []domain.Binding{{
+			RoleID:    roleID,
+			Members:   toJSON([]string{"user:alice@example.com"}),
+			Condition: &domain.Condition{Title: "office", Expression: `request.ip == "10.0.0.1"`},
+		}},
+	}, "user:admin@example.com")
+	assert.NoError(t, err)
+
+	// Mock expectations
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	revisionRepo.On("GetByRevision", policy.ID, 1).Return(old, nil)
+	bindingRepo.On("Delete", currentBindingID).Return(nil).Once()
+	bindingRepo.On("Create", mock.MatchedBy(func(b *domain.Binding) bool {
+		granted, err := b.HasMember("user:alice@example.com")
+		return err == nil && granted && b.Condition != nil && b.Condition.Title == "office"
+	})).Return(nil).Once()
+	conditionRepo.On("Create", mock.MatchedBy(func(c *domain.Condition) bool {
+		return c.Title == "office" && c.Expression == `request.ip == "10.0.0.1"`
+	})).Return(nil).Once()
+	policyRepo.On("Update", policy).Return(nil)
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Once()
+
+	_, err = service.RollbackPolicy(resourceID, 1)
+
+	// Assert
+	assert.NoError(t, err)
+	bindingRepo.AssertExpectations(t)
+	conditionRepo.AssertExpectations(t)
+	revisionRepo.AssertExpectations(t)
+}
+
+// Test: Rollback Policy to an unknown revision
+func TestIAMService_RollbackPolicy_RevisionNotFound(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID}
+
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	revisionRepo.On("GetByRevision", policy.ID, 7).Return(nil, nil)
+
+	_, err := service.RollbackPolicy(resourceID, 7)
+
+	// Assert
+	assert.Error(t, err)
+	bindingRepo.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
+// Test: TestIamPermissions validates input and delegates to the evaluator
+func TestIAMService_TestIamPermissions(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	requested := []string{"storage.objects.read", "storage.objects.delete"}
+	evaluator.On("TestPermissions", "user:alice@example.com", resourceID, requested, map[string]string(nil)).
+		Return([]string{"storage.objects.read"}, nil)
+
+	granted, err := service.TestIamPermissions("user:alice@example.com", resourceID, requested, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.read"}, granted)
+
+	// Invalid requests never reach the evaluator
+	_, err = service.TestIamPermissions("", resourceID, requested, nil)
+	assert.Error(t, err)
+
+	_, err = service.TestIamPermissions("user:alice@example.com", resourceID, nil, nil)
+	assert.Error(t, err)
+
+	_, err = service.TestIamPermissions("user:alice@example.com", resourceID, make([]string, MaxTestPermissions+1), nil)
+	assert.Error(t, err)
+
+	evaluator.AssertNumberOfCalls(t, "TestPermissions", 1)
+}
+
+// Test: CheckPermissionOnResources combines per-resource decisions, loading shared ancestors once
+func TestIAMService_CheckPermissionOnResources(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+	service := NewIAMService(resourceRepo, new(MockPermissionRepository), new(MockRoleRepository), policyRepo,
+		new(MockBindingRepository), new(MockPolicyRevisionRepository), new(MockConditionRepository), evaluator, NewNoopCache())
+
+	// The project grants read on its buckets; the archive bucket is not in the project
+	projectID, logsID, uploadsID, archiveID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	reader := testRole("roles/storage.reader", "storage.objects.read")
+	projectPolicy := &domain.Policy{ResourceID: projectID, Bindings: []domain.Binding{testBinding(&reader, "user:alice@example.com")}}
+	for _, id := range []uuid.UUID{logsID, uploadsID} {
+		resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "bucket"}, nil).Once()
+		resourceRepo.On("GetAncestors", id).Return([]domain.Resource{{ID: projectID}}, nil).Once()
+		policyRepo.On("GetByResourceID", id).Return(nil, nil).Once()
+	}
+	resourceRepo.On("GetByID", archiveID).Return(&domain.Resource{ID: archiveID, Type: "bucket"}, nil).Once()
+	resourceRepo.On("GetAncestors", archiveID).Return([]domain.Resource{}, nil).Once()
+	policyRepo.On("GetByResourceID", archiveID).Return(nil, nil).Once()
+	policyRepo.On("GetByResourceID", projectID).Return(projectPolicy, nil).Once()
+
+	allowed, results, err := service.CheckPermissionOnResources("user:alice@example.com", "storage.objects.read",
+		[]uuid.UUID{logsID, archiveID, uploadsID}, "", nil)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Len(t, results, 3)
+	assert.True(t, results[0].Allowed)
+	assert.False(t, results[1].Allowed)
+	assert.True(t, results[2].Allowed)
+	resourceRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+
+	// In all mode, one resource without the permission denies the set
+	resourceRepo.On("GetByID", mock.Anything).Return(&domain.Resource{Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", archiveID).Return([]domain.Resource{}, nil)
+	resourceRepo.On("GetAncestors", logsID).Return([]domain.Resource{{ID: projectID}}, nil)
+	policyRepo.On("GetByResourceID", mock.Anything).Return(nil, nil)
+	policyRepo.On("GetByResourceID", projectID).Return(projectPolicy, nil)
+	allowed, _, err = service.CheckPermissionOnResources("user:alice@example.com", "storage.objects.read",
+		[]uuid.UUID{logsID, archiveID}, ResourceSetAll, nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	_, _, err = service.CheckPermissionOnResources("user:alice@example.com", "storage.objects.read", []uuid.UUID{logsID}, "most", nil)
+	assert.ErrorContains(t, err, "mode must be")
+	_, _, err = service.CheckPermissionOnResources("user:alice@example.com", "storage.objects.read", nil, "", nil)
+	assert.ErrorContains(t, err, "at least one resource")
+	_, _, err = service.CheckPermissionOnResources("user:alice@example.com", "storage.objects.read",
+		make([]uuid.UUID, MaxResourceSetChecks+1), "", nil)
+	assert.ErrorContains(t, err, "too many resources")
+}
+
+// Test: CheckPermissionForPrincipals decides each principal, loading the resource and its
+// ancestors once
+func TestIAMService_CheckPermissionForPrincipals(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+	service := NewIAMService(resourceRepo, new(MockPermissionRepository), new(MockRoleRepository), policyRepo,
+		new(MockBindingRepository), new(MockPolicyRevisionRepository), new(MockConditionRepository), evaluator, NewNoopCache())
+
+	// The folder lets alice edit its documents and bob read them
+	folderID, docID := uuid.New(), uuid.New()
+	editor := testRole("roles/docs.editor", "docs.documents.edit", "docs.documents.read")
+	reader := testRole("roles/docs.reader", "docs.documents.read")
+	folderPolicy := &domain.Policy{ResourceID: folderID, Bindings: []domain.Binding{
+		testBinding(&editor, "user:alice@example.com"),
+		testBinding(&reader, "user:bob@example.com"),
+	}}
+	resourceRepo.On("GetByID", docID).Return(&domain.Resource{ID: docID, Type: "document"}, nil).Once()
+	resourceRepo.On("GetAncestors", docID).Return([]domain.Resource{{ID: folderID}}, nil).Once()
+	policyRepo.On("GetByResourceID", docID).Return(nil, nil).Once()
+	policyRepo.On("GetByResourceID", folderID).Return(folderPolicy, nil).Once()
+
+	results, err := service.CheckPermissionForPrincipals(docID, "docs.documents.edit",
+		[]string{"user:bob@example.com", "user:alice@example.com", "user:carol@example.com"}, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.False(t, results[0].Allowed)
+	assert.True(t, results[1].Allowed)
+	assert.Equal(t, "roles/docs.editor", results[1].Role)
+	assert.False(t, results[2].Allowed)
+	resourceRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+
+	_, err = service.CheckPermissionForPrincipals(docID, "", []string{"user:alice@example.com"}, nil)
+	assert.ErrorContains(t, err, "permission is required")
+	_, err = service.CheckPermissionForPrincipals(docID, "docs.documents.edit", nil, nil)
+	assert.ErrorContains(t, err, "at least one principal")
+	_, err = service.CheckPermissionForPrincipals(docID, "docs.documents.edit", []string{"user:alice@example.com", ""}, nil)
+	assert.ErrorContains(t, err, "principal 1 is required")
+	_, err = service.CheckPermissionForPrincipals(docID, "docs.documents.edit", make([]string, MaxPrincipalChecks+1), nil)
+	assert.ErrorContains(t, err, "too many principals")
+}
+
+// Test: Sync Service Permissions
+func TestIAMService_SyncServicePermissions(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	expected := &repository.PermissionSyncResult{Created: []string{"storage.buckets.create"}}
+	permissionRepo.On("SyncService", "storage", []domain.Permission{
+		{Name: "storage.buckets.create", Description: "Create buckets", Service: "storage"},
+	}).Return(expected, nil)
+
+	result, err := service.SyncServicePermissions("storage", []PermissionDef{
+		{Name: "storage.buckets.create", Description: "Create buckets"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+	permissionRepo.AssertExpectations(t)
+}
+
+// Test: Sync Service Permissions validates the catalog
+func TestIAMService_SyncServicePermissions_Invalid(t *testing.T) {
+	permissionRepo := new(MockPermissionRepository)
+	service := NewIAMService(nil, permissionRepo, nil, nil, nil, nil, nil, nil, NewNoopCache())
+
+	tests := []struct {
+		name    string
+		service string
+		defs    []PermissionDef
+	}{
+		{"missing service", "", []PermissionDef{{Name: "storage.buckets.get"}}},
+		{"other service", "storage", []PermissionDef{{Name: "compute.instances.get"}}},
+		{"missing name", "storage", []PermissionDef{{Name: "storage."}}},
+		{"duplicate", "storage", []PermissionDef{{Name: "storage.buckets.get"}, {Name: "storage.buckets.get"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.SyncServicePermissions(tt.service, tt.defs)
+			assert.Error(t, err)
+		})
+	}
+	permissionRepo.AssertNotCalled(t, "SyncService", mock.Anything, mock.Anything)
+}
+
+// Test: Scoped custom roles
+func TestIAMService_CreateRole_Scoped(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	orgID := uuid.New()
+	missingID := uuid.New()
+	resourceRepo.On("GetByID", orgID).Return(&domain.Resource{ID: orgID, Type: "organization"}, nil)
+	resourceRepo.On("GetByID", missingID).Return(nil, nil)
+	permissionRepo.On("GetByIDs", []uuid.UUID(nil)).Return([]domain.Permission{}, nil)
+	roleRepo.On("Create", mock.AnythingOfType("*domain.Role")).Return(nil)
+
+	role, err := service.CreateRole("roles/acme.auditor", "Auditor", "", nil, &orgID)
+	assert.NoError(t, err)
+	assert.Equal(t, &orgID, role.ScopeResourceID)
+	assert.True(t, role.IsCustom)
+
+	_, err = service.CreateRole("roles/acme.auditor", "Auditor", "", nil, &missingID)
+	assert.Error(t, err)
+	roleRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestIAMService_CreateBinding_RoleScope(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	orgID := uuid.New()
+	projectID := uuid.New()
+	otherID := uuid.New()
+	roleID := uuid.New()
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/acme.auditor", ScopeResourceID: &orgID}, nil)
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{{ID: orgID}}, nil)
+	resourceRepo.On("GetAncestors", otherID).Return([]domain.Resource{}, nil)
+
+	// Outside the scope's subtree
+	_, err := service.CreateBinding(otherID, roleID, []string{"user:alice@example.com"}, nil)
+	assert.ErrorIs(t, err, ErrRoleOutOfScope)
+	policyRepo.AssertNotCalled(t, "GetByResourceID", mock.Anything)
+
+	// Within the subtree
+	policyID := uuid.New()
+	policyRepo.On("GetByResourceID", projectID).Return(&domain.Policy{ID: policyID, ResourceID: projectID}, nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: projectID}, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+	bindingRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Binding{RoleID: roleID}, nil)
+
+	binding, err := service.CreateBinding(projectID, roleID, []string{"user:alice@example.com"}, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, binding)
+}
+
+func TestIAMService_UpdatePolicy_RoleOutOfScope(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	resourceID := uuid.New()
+	scopeID := uuid.New()
+	roleID := uuid.New()
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ID: uuid.New(), ResourceID: resourceID, ETag: "etag"}, nil)
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/team.deployer", ScopeResourceID: &scopeID}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+
+	_, err := service.UpdatePolicy(resourceID, []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+	}, "etag")
+
+	assert.ErrorIs(t, err, ErrRoleOutOfScope)
+	bindingRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestAttachmentRules_Allows(t *testing.T) {
+	rules := AttachmentRules{"roles/owner": {"organization", "folder"}}
+
+	assert.True(t, rules.Allows("roles/owner", "organization"))
+	assert.True(t, rules.Allows("roles/owner", "folder"))
+	assert.False(t, rules.Allows("roles/owner", "project"))
+	assert.True(t, rules.Allows("roles/viewer", "project"))
+	assert.True(t, AttachmentRules(nil).Allows("roles/owner", "project"))
+}
+
+func TestIAMService_CreateBinding_AttachmentRules(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+	service.SetAttachmentRules(AttachmentRules{"roles/owner": {"organization"}})
+
+	orgID := uuid.New()
+	projectID := uuid.New()
+	ownerID := uuid.New()
+	viewerID := uuid.New()
+	roleRepo.On("GetByID", ownerID).Return(&domain.Role{ID: ownerID, Name: "roles/owner"}, nil)
+	roleRepo.On("GetByID", viewerID).Return(&domain.Role{ID: viewerID, Name: "roles/viewer"}, nil)
+	resourceRepo.On("GetByID", orgID).Return(&domain.Resource{ID: orgID, Type: "organization"}, nil)
+	resourceRepo.On("GetByID", projectID).Return(&domain.Resource{ID: projectID, Type: "project"}, nil)
+
+	// Owner on a project is rejected
+	_, err := service.CreateBinding(projectID, ownerID, []string{"user:alice@example.com"}, nil)
+	assert.ErrorIs(t, err, ErrRoleNotAttachable)
+	assert.Contains(t, err.Error(), "roles/owner may only be bound on organization resources, not project")
+	policyRepo.AssertNotCalled(t, "GetByResourceID", mock.Anything)
+
+	// Owner on the organization and roles without a rule are allowed
+	policyRepo.On("GetByResourceID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Policy{ID: uuid.New()}, nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Policy{}, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+	bindingRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Binding{}, nil)
+
+	_, err = service.CreateBinding(orgID, ownerID, []string{"user:alice@example.com"}, nil)
+	assert.NoError(t, err)
+	_, err = service.CreateBinding(projectID, viewerID, []string{"user:alice@example.com"}, nil)
+	assert.NoError(t, err)
+	resourceRepo.AssertNumberOfCalls(t, "GetByID", 2)
+}
+
+func TestIAMService_UpdatePolicy_RoleNotAttachable(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+	service.SetAttachmentRules(AttachmentRules{"roles/owner": {"organization"}})
+
+	resourceID := uuid.New()
+	roleID := uuid.New()
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ID: uuid.New(), ResourceID: resourceID, ETag: "etag"}, nil)
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/owner"}, nil)
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket"}, nil)
+
+	_, err := service.UpdatePolicy(resourceID, []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+	}, "etag")
+
+	assert.ErrorIs(t, err, ErrRoleNotAttachable)
+	bindingRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestIAMService_ListRoles_ByScope(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	permissionRepo := new(MockPermissionRepository)
+	roleRepo := new(MockRoleRepository)
+	policyRepo := new(MockPolicyRepository)
+	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
+	evaluator := new(MockPermissionEvaluator)
+	cache := NewNoopCache()
+
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	orgID := uuid.New()
+	projectID := uuid.New()
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{{ID: orgID}}, nil)
+	roleRepo.On("List", true, mock.MatchedBy(func(ids []uuid.UUID) bool {
+		return assert.ElementsMatch(t, []uuid.UUID{projectID, orgID}, ids)
+	}), 10, 0).Return([]domain.Role{{Name: "roles/viewer"}}, nil)
+
+	roles, err := service.ListRoles(true, &projectID, "", 10, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	roleRepo.AssertExpectations(t)
+}
+
+func TestIAMService_ListRoles_ByPermission(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	roleRepo := new(MockRoleRepository)
+	service := NewIAMService(resourceRepo, new(MockPermissionRepository), roleRepo, new(MockPolicyRepository),
+		new(MockBindingRepository), new(MockPolicyRevisionRepository), new(MockConditionRepository),
+		new(MockPermissionEvaluator), NewNoopCache())
+
+	projectID := uuid.New()
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{}, nil)
+	roleRepo.On("ListByPermission", "storage.objects.delete", false, []uuid.UUID{projectID}, 10, 0).
+		Return([]domain.Role{{Name: "roles/storage.objectAdmin"}, {Name: "roles/storage.admin"}}, nil)
+
+	roles, err := service.ListRoles(false, &projectID, "storage.objects.delete", 10, 0)
+
+	assert.NoError(t, err)
+	assert.Len(t, roles, 2)
+	roleRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// Test: Creations and changes record the caller
+func TestIAMService_RecordsCaller(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	alice := service.AsCaller("user:alice@example.com")
+
+	service.permissionRepo.(*MockPermissionRepository).On("GetByIDs", []uuid.UUID(nil)).Return([]domain.Permission{}, nil)
+	roleRepo.On("Create", mock.AnythingOfType("*domain.Role")).Return(nil)
+	role, err := alice.CreateRole("roles/custom.viewer", "Viewer", "", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:alice@example.com", role.CreatedBy)
+	assert.Equal(t, "user:alice@example.com", role.UpdatedBy)
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, CreatedBy: "user:bob@example.com"}, nil)
+	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil)
+	resource, err := alice.UpdateResource(resourceID, "renamed", nil, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "user:bob@example.com", resource.CreatedBy)
+	assert.Equal(t, "user:alice@example.com", resource.UpdatedBy)
+
+	policyRepo.On("GetByResourceID", resourceID).Return(nil, nil)
+	policyRepo.On("Create", mock.MatchedBy(func(policy *domain.Policy) bool {
+		return policy.CreatedBy == "user:alice@example.com"
+	})).Return(nil)
+	policyRepo.On("GetByID", mock.Anything).Return(&domain.Policy{ResourceID: resourceID}, nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+	bindingRepo.On("CreateBatch", mock.Anything, mock.MatchedBy(func(bindings []domain.Binding) bool {
+		return bindings[0].CreatedBy == "user:alice@example.com"
+	})).Return(nil)
+	_, err = alice.BatchCreateBindings(resourceID, []domain.Binding{{RoleID: viewer.ID, Members: toJSON([]string{"user:carol@example.com"})}})
+	assert.NoError(t, err)
+	bindingRepo.AssertExpectations(t)
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,6 +21,20 @@ func (m *MockPermissionEvaluator) CheckPermission(principal string, resourceID u
 	return args.Bool(0), args.String(1), args.Error(2)
 }
 
+// Check delegates to the mocked CheckPermission; the mock does not know granting roles
+func (m *MockPermissionEvaluator) Check(principal string, resourceID uuid.UUID, permission string, context map[string]string) (CheckResult, error) {
+	allowed, reason, err := m.CheckPermission(principal, resourceID, permission, context)
+	return CheckResult{Allowed: allowed, Reason: reason}, err
+}
+
+func (m *MockPermissionEvaluator) TestPermissions(principal string, resourceID uuid.UUID, permissions []string, context map[string]string) ([]string, error) {
+	args := m.Called(principal, resourceID, permissions, context)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 func (m *MockPermissionEvaluator) GetEffectivePermissions(principal string, resourceID uuid.UUID) ([]string, []string, error) {
 	args := m.Called(principal, resourceID)
 	if args.Get(0) == nil {
@@ -27,6 +43,30 @@ func (m *MockPermissionEvaluator) GetEffectivePermissions(principal string, reso
 	return args.Get(0).([]string), args.Get(1).([]string), args.Error(2)
 }
 
+func (m *MockPermissionEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	args := m.Called(principal, checks)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]CheckResult), args.Error(1)
+}
+
+func (m *MockPermissionEvaluator) CheckPermissionForPrincipals(principals []string, resourceID uuid.UUID, permission string, context map[string]string) ([]CheckResult, error) {
+	args := m.Called(principals, resourceID, permission, context)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]CheckResult), args.Error(1)
+}
+
+func (m *MockPermissionEvaluator) GrantingMembers(principal string) ([]string, error) {
+	args := m.Called(principal)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // Test: Create Resource
 func TestIAMService_CreateResource(t *testing.T) {
 	resourceRepo := new(MockResourceRepository)
@@ -34,10 +74,12 @@ func TestIAMService_CreateResource(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	// Mock expectations
 	resourceRepo.On("Create", mock.AnythingOfType("*domain.Resource")).Return(nil).Run(func(args mock.Arguments) {
@@ -51,7 +93,9 @@ func TestIAMService_CreateResource(t *testing.T) {
 		"bucket",
 		"test-bucket",
 		&parentID,
-		map[string]string{"region": "us-east-1"},
+		map[string]interface{}{"region": "us-east-1"},
+		nil,
+		"",
 	)
 
 	// Assert
@@ -72,10 +116,12 @@ func TestIAMService_GetResource(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	expectedResource := &domain.Resource{
@@ -104,10 +150,12 @@ func TestIAMService_DeleteResource(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 
@@ -131,10 +179,12 @@ func TestIAMService_CreatePermission(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	// Mock expectations
 	permissionRepo.On("Create", mock.AnythingOfType("*domain.Permission")).Return(nil).Run(func(args mock.Arguments) {
@@ -166,10 +216,12 @@ func TestIAMService_CreateRole(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	permID1 := uuid.New()
 	permID2 := uuid.New()
@@ -193,6 +245,7 @@ func TestIAMService_CreateRole(t *testing.T) {
 		"Storage Editor",
 		"Can read and write buckets",
 		permissionIDs,
+		nil,
 	)
 
 	// Assert
@@ -214,10 +267,14 @@ func TestIAMService_CreatePolicy(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
+
+	roleRepo.On("GetByID", mock.Anything).Return(&domain.Role{ID: uuid.New(), Name: "roles/viewer"}, nil).Maybe()
 
 	resourceID := uuid.New()
 	roleID := uuid.New()
@@ -249,6 +306,7 @@ func TestIAMService_CreatePolicy(t *testing.T) {
 		ETag:       "etag-123",
 	}
 	policyRepo.On("GetByID", createdPolicyID).Return(finalPolicy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
 
 	// Create policy
 	policy, err := service.CreatePolicy(resourceID, bindings)
@@ -270,10 +328,12 @@ func TestIAMService_GetPolicy(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	expectedPolicy := &domain.Policy{
@@ -284,6 +344,7 @@ func TestIAMService_GetPolicy(t *testing.T) {
 
 	// Mock expectations
 	policyRepo.On("GetByResourceID", resourceID).Return(expectedPolicy, nil)
+	revisionRepo.On("List", expectedPolicy.ID, 1, 0).Return([]domain.PolicyRevision{}, nil)
 
 	// Get policy
 	policy, err := service.GetPolicy(resourceID)
@@ -291,6 +352,9 @@ func TestIAMService_GetPolicy(t *testing.T) {
 	// Assert
 	assert.NoError(t, err)
 	assert.Equal(t, expectedPolicy, policy)
+	if assert.NotNil(t, policy.Metadata) {
+		assert.Zero(t, policy.Metadata.Bindings)
+	}
 
 	policyRepo.AssertExpectations(t)
 }
@@ -302,10 +366,12 @@ func TestIAMService_DeletePolicy(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	policyID := uuid.New()
@@ -337,10 +403,12 @@ func TestIAMService_CheckPermission(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 
@@ -371,10 +439,12 @@ func TestIAMService_GetEffectivePermissions(t *testing.T) {
 	roleRepo := new(MockRoleRepository)
 	policyRepo := new(MockPolicyRepository)
 	bindingRepo := new(MockBindingRepository)
+	revisionRepo := new(MockPolicyRevisionRepository)
+	conditionRepo := new(MockConditionRepository)
 	evaluator := new(MockPermissionEvaluator)
 	cache := NewNoopCache()
 
-	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, evaluator, cache)
+	service := NewIAMService(resourceRepo, permissionRepo, roleRepo, policyRepo, bindingRepo, revisionRepo, conditionRepo, evaluator, cache)
 
 	resourceID := uuid.New()
 	expectedPerms := []string{"storage.buckets.read", "storage.buckets.write"}
@@ -434,14 +504,56 @@ func (m *MockRoleRepository) Delete(id uuid.UUID) error {
 	return args.Error(0)
 }
 
-func (m *MockRoleRepository) List(includeCustom bool, limit, offset int) ([]domain.Role, error) {
-	args := m.Called(includeCustom, limit, offset)
+func (m *MockRoleRepository) DeleteCascade(id uuid.UUID) ([]uuid.UUID, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockRoleRepository) List(includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error) {
+	args := m.Called(includeCustom, scopeIDs, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Role), args.Error(1)
+}
+
+func (m *MockRoleRepository) ListByPermission(permission string, includeCustom bool, scopeIDs []uuid.UUID, limit, offset int) ([]domain.Role, error) {
+	args := m.Called(permission, includeCustom, scopeIDs, limit, offset)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]domain.Role), args.Error(1)
 }
 
+func (m *MockRoleRepository) ListWithDeprecatedPermissions(limit, offset int) ([]domain.Role, error) {
+	args := m.Called(limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Role), args.Error(1)
+}
+
+func (m *MockRoleRepository) GetDeleted(id uuid.UUID) (*domain.Role, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Role), args.Error(1)
+}
+
+func (m *MockRoleRepository) Undelete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) PurgeDeleted(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockRoleRepository) AddPermissions(roleID uuid.UUID, permissionIDs []uuid.UUID) error {
 	args := m.Called(roleID, permissionIDs)
 	return args.Error(0)
@@ -499,6 +611,22 @@ func (m *MockBindingRepository) ListByPrincipal(principal string, limit, offset
 	return args.Get(0).([]domain.Binding), args.Error(1)
 }
 
+func (m *MockBindingRepository) ListByRole(roleID uuid.UUID) ([]domain.Binding, error) {
+	args := m.Called(roleID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Binding), args.Error(1)
+}
+
+func (m *MockBindingRepository) RoleUsage(roleIDs []uuid.UUID) ([]repository.RoleBindingUsage, error) {
+	args := m.Called(roleIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.RoleBindingUsage), args.Error(1)
+}
+
 func (m *MockBindingRepository) GetByPolicyAndPrincipal(policyID uuid.UUID, principal string) ([]domain.Binding, error) {
 	args := m.Called(policyID, principal)
 	if args.Get(0) == nil {
@@ -506,3 +634,87 @@ func (m *MockBindingRepository) GetByPolicyAndPrincipal(policyID uuid.UUID, prin
 	}
 	return args.Get(0).([]domain.Binding), args.Error(1)
 }
+
+func (m *MockBindingRepository) CreateBatch(policy *domain.Policy, bindings []domain.Binding) error {
+	args := m.Called(policy, bindings)
+	return args.Error(0)
+}
+
+func (m *MockBindingRepository) DeleteBatch(policy *domain.Policy, ids []uuid.UUID) error {
+	args := m.Called(policy, ids)
+	return args.Error(0)
+}
+
+func (m *MockBindingRepository) RemoveMember(member string, policyIDs []uuid.UUID, _ string) ([]repository.MemberRemoval, error) {
+	args := m.Called(member, policyIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.MemberRemoval), args.Error(1)
+}
+
+func (m *MockBindingRepository) Search(query repository.BindingSearch, limit, offset int) ([]domain.Binding, int64, error) {
+	args := m.Called(query, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]domain.Binding), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockBindingRepository) PurgeDeleted(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Mock PolicyRevisionRepository
+type MockPolicyRevisionRepository struct {
+	mock.Mock
+}
+
+func (m *MockPolicyRevisionRepository) Create(revision *domain.PolicyRevision) error {
+	args := m.Called(revision)
+	return args.Error(0)
+}
+
+func (m *MockPolicyRevisionRepository) GetByRevision(policyID uuid.UUID, revision int) (*domain.PolicyRevision, error) {
+	args := m.Called(policyID, revision)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PolicyRevision), args.Error(1)
+}
+
+func (m *MockPolicyRevisionRepository) List(policyID uuid.UUID, limit, offset int) ([]domain.PolicyRevision, error) {
+	args := m.Called(policyID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.PolicyRevision), args.Error(1)
+}
+
+type MockConditionRepository struct {
+	mock.Mock
+}
+
+func (m *MockConditionRepository) Create(condition *domain.Condition) error {
+	args := m.Called(condition)
+	return args.Error(0)
+}
+
+func (m *MockConditionRepository) GetByBindingID(bindingID uuid.UUID) (*domain.Condition, error) {
+	args := m.Called(bindingID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Condition), args.Error(1)
+}
+
+func (m *MockConditionRepository) Update(condition *domain.Condition) error {
+	args := m.Called(condition)
+	return args.Error(0)
+}
+
+func (m *MockConditionRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrIdempotencyInProgress is returned while the original request of an idempotency key is executing
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+// IdempotencyKeyHeader is the gRPC metadata key carrying the idempotency key of a request
+// whose message has no idempotency_key field
+const IdempotencyKeyHeader = "idempotency-key"
+
+// maxIdempotencyKeyLength is the maximum length of an idempotency key in bytes
+const maxIdempotencyKeyLength = 255
+
+// idempotencyPendingTTL bounds how long a request that never completed, e.g. because the server
+// crashed, blocks retries with its key
+const idempotencyPendingTTL = time.Minute
+
+// idempotencyCleanupInterval is the time between deletions of expired idempotency keys
+const idempotencyCleanupInterval = time.Hour
+
+// Idempotency deduplicates retried mutating requests. The result of a successful request is
+// stored under its method and idempotency key for the TTL and returned to retries with the same
+// key; failed requests are not stored, so they can be retried.
+type Idempotency struct {
+	repo   repository.IdempotencyRepository
+	ttl    time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewIdempotency creates an idempotency store keeping results for ttl. A nil logger uses slog.Default().
+func NewIdempotency(repo repository.IdempotencyRepository, ttl time.Duration, logger *slog.Logger) *Idempotency {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Idempotency{
+		repo:   repo,
+		ttl:    ttl,
+		logger: logger,
+		now:    time.Now,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Idempotent executes fn, the handler of method for request, at most once per idempotency key.
+// A retry with the same key and request returns the stored result of the first execution; a
+// retry with a different request fails with ErrIdempotencyKeyReused, and one arriving while the
+// first is executing with ErrIdempotencyInProgress. Without a key or store, fn is executed as is.
+func Idempotent[T any](idem *Idempotency, method, key string, request interface{}, fn func() (T, error)) (T, error) {
+	var zero T
+	if idem == nil || key == "" {
+		return fn()
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return zero, fmt.Errorf("idempotency key must be at most %d bytes", maxIdempotencyKeyLength)
+	}
+
+	fingerprint, err := requestFingerprint(request)
+	if err != nil {
+		return zero, err
+	}
+
+	now := idem.now()
+	reserved, err := idem.repo.Reserve(&domain.IdempotencyKey{
+		Method:      method,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyPendingTTL),
+	})
+	if err != nil {
+		return zero, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if !reserved {
+		return replay[T](idem, method, key, fingerprint)
+	}
+
+	result, err := fn()
+	if err != nil {
+		if releaseErr := idem.repo.Release(method, key); releaseErr != nil {
+			idem.logger.Warn("Failed to release idempotency key", "method", method, "error", releaseErr)
+		}
+		return result, err
+	}
+
+	// The mutation is done: failing to store its result only means a retry is not deduplicated
+	response, err := json.Marshal(result)
+	if err == nil {
+		err = idem.repo.Complete(method, key, response, idem.now().Add(idem.ttl))
+	}
+	if err != nil {
+		idem.logger.Warn("Failed to store idempotent response", "method", method, "error", err)
+	}
+	return result, nil
+}
+
+// replay returns the stored result of the request reserving method and key
+func replay[T any](idem *Idempotency, method, key, fingerprint string) (T, error) {
+	var result T
+	record, err := idem.repo.Get(method, key)
+	if err != nil {
+		return result, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	// A reservation released in the meantime is reported as in progress so the client retries
+	if record == nil || (!record.Completed && record.Fingerprint == fingerprint) {
+		return result, ErrIdempotencyInProgress
+	}
+	if record.Fingerprint != fingerprint {
+		return result, ErrIdempotencyKeyReused
+	}
+	if err := json.Unmarshal(record.Response, &result); err != nil {
+		return result, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+	return result, nil
+}
+
+// requestFingerprint hashes the JSON encoding of a request
+func requestFingerprint(request interface{}) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Start deletes expired keys every hour until Stop
+func (idem *Idempotency) Start() {
+	go idem.run()
+}
+
+// Stop waits for the cleanup to exit or ctx to expire
+func (idem *Idempotency) Stop(ctx context.Context) error {
+	idem.stopOnce.Do(func() { close(idem.stop) })
+
+	select {
+	case <-idem.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (idem *Idempotency) run() {
+	defer close(idem.done)
+
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-idem.stop:
+			return
+		case <-ticker.C:
+			deleted, err := idem.repo.DeleteExpired(idem.now())
+			if err != nil {
+				idem.logger.Error("Failed to delete expired idempotency keys", "error", err)
+				continue
+			}
+			idem.logger.Debug("Deleted expired idempotency keys", "deleted", deleted)
+		}
+	}
+}
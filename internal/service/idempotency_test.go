@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// memoryIdempotencyRepository is an in-memory IdempotencyRepository
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyKey
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: make(map[string]domain.IdempotencyKey)}
+}
+
+func (r *memoryIdempotencyRepository) Reserve(record *domain.IdempotencyKey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := record.Method + "/" + record.Key
+	if existing, ok := r.records[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	r.records[id] = *record
+	return true, nil
+}
+
+func (r *memoryIdempotencyRepository) Get(method, key string) (*domain.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[method+"/"+key]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (r *memoryIdempotencyRepository) Complete(method, key string, response datatypes.JSON, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.records[method+"/"+key]
+	record.Response = response
+	record.Completed = true
+	record.ExpiresAt = expiresAt
+	r.records[method+"/"+key] = record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Release(method, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, method+"/"+key)
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpired(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, record := range r.records {
+		if record.ExpiresAt.Before(before) {
+			delete(r.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type createResourceRequest struct {
+	Type, Name string
+}
+
+func TestIdempotent_ReplaysResult(t *testing.T) {
+	idem := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour, nil)
+
+	calls := 0
+	create := func() (*domain.Resource, error) {
+		calls++
+		return &domain.Resource{ID: uuid.New(), Type: "project", Name: "web"}, nil
+	}
+	request := createResourceRequest{Type: "project", Name: "web"}
+
+	first, err := Idempotent(idem, "CreateResource", "key-1", request, create)
+	require.NoError(t, err)
+	retried, err := Idempotent(idem, "CreateResource", "key-1", request, create)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, retried.ID)
+	assert.Equal(t, 1, calls)
+
+	// Keys are scoped by method, and requests without a key are never deduplicated
+	_, err = Idempotent(idem, "CreateBinding", "key-1", request, create)
+	require.NoError(t, err)
+	_, err = Idempotent(idem, "CreateResource", "", request, create)
+	require.NoError(t, err)
+	_, err = Idempotent(nil, "CreateResource", "key-1", request, create)
+	require.NoError(t, err)
+	assert.Equal(t, 4, calls)
+}
+
+func TestIdempotent_KeyReusedForDifferentRequest(t *testing.T) {
+	idem := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour, nil)
+	create := func() (*domain.Resource, error) { return &domain.Resource{ID: uuid.New()}, nil }
+
+	_, err := Idempotent(idem, "CreateResource", "key-1", createResourceRequest{Name: "web"}, create)
+	require.NoError(t, err)
+	_, err = Idempotent(idem, "CreateResource", "key-1", createResourceRequest{Name: "api"}, create)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
+
+func TestIdempotent_FailedRequestCanBeRetried(t *testing.T) {
+	idem := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour, nil)
+	request := createResourceRequest{Name: "web"}
+
+	_, err := Idempotent(idem, "CreateResource", "key-1", request, func() (*domain.Resource, error) {
+		return nil, errors.New("parent not found")
+	})
+	assert.Error(t, err)
+
+	resource, err := Idempotent(idem, "CreateResource", "key-1", request, func() (*domain.Resource, error) {
+		return &domain.Resource{Name: "web"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "web", resource.Name)
+}
+
+func TestIdempotent_InProgress(t *testing.T) {
+	idem := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour, nil)
+	request := createResourceRequest{Name: "web"}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		_, _ = Idempotent(idem, "CreateResource", "key-1", request, func() (*domain.Resource, error) {
+			close(started)
+			<-release
+			return &domain.Resource{Name: "web"}, nil
+		})
+	}()
+	<-started
+
+	_, err := Idempotent(idem, "CreateResource", "key-1", request, func() (*domain.Resource, error) {
+		t.Fatal("request executed twice")
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+	close(release)
+}
+
+func TestIdempotent_ExpiredKeyExecutesAgain(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	idem := NewIdempotency(repo, time.Hour, nil)
+	now := time.Now()
+	idem.now = func() time.Time { return now }
+	request := createResourceRequest{Name: "web"}
+
+	calls := 0
+	create := func() (*domain.Resource, error) {
+		calls++
+		return &domain.Resource{}, nil
+	}
+	_, err := Idempotent(idem, "CreateResource", "key-1", request, create)
+	require.NoError(t, err)
+
+	// Expire the stored result
+	require.NoError(t, repo.Complete("CreateResource", "key-1", []byte(`{}`), time.Now().Add(-time.Second)))
+	_, err = Idempotent(idem, "CreateResource", "key-1", request, create)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	deleted, err := repo.DeleteExpired(time.Now().Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+var (
+	// ErrIntegrityChecksDisabled is returned by the integrity APIs when no integrity repository
+	// is configured
+	ErrIntegrityChecksDisabled = errors.New("integrity checks are not enabled")
+	// ErrNoIntegrityReport is returned by GetIntegrityReport before the first integrity scan
+	ErrNoIntegrityReport = errors.New("no integrity scan has completed yet")
+)
+
+// OperationScanIntegrity is the operation type of ScanIntegrity
+const OperationScanIntegrity = "ScanIntegrity"
+
+// Integrity checks, in the order CheckIntegrity runs them
+const (
+	IntegrityBindingDeletedRole      = "binding-deleted-role"      // A binding grants a deleted or missing role, so it grants nothing
+	IntegrityBindingDeletedPolicy    = "binding-deleted-policy"    // A binding belongs to a deleted or missing policy
+	IntegrityPolicyDeletedResource   = "policy-deleted-resource"   // A policy is attached to a deleted or missing resource
+	IntegrityConditionWithoutBinding = "condition-without-binding" // A condition belongs to a deleted or missing binding
+	IntegrityMemberUnknownGroup      = "member-unknown-group"      // A binding names a group that is not provisioned
+)
+
+var integrityChecks = []string{
+	IntegrityBindingDeletedRole,
+	IntegrityBindingDeletedPolicy,
+	IntegrityPolicyDeletedResource,
+	IntegrityConditionWithoutBinding,
+	IntegrityMemberUnknownGroup,
+}
+
+// danglingChecks maps the dangling references of the repository to their check and the kind of
+// the referenced row
+var danglingChecks = map[string]struct{ check, referenced string }{
+	repository.DanglingBindingRole:    {IntegrityBindingDeletedRole, "role"},
+	repository.DanglingBindingPolicy:  {IntegrityBindingDeletedPolicy, "policy"},
+	repository.DanglingPolicyResource: {IntegrityPolicyDeletedResource, "resource"},
+	repository.DanglingConditionOwner: {IntegrityConditionWithoutBinding, "binding"},
+}
+
+// IntegrityFinding is an inconsistent row found by CheckIntegrity
+type IntegrityFinding struct {
+	Check      string          `json:"check"`
+	Severity   FindingSeverity `json:"severity"`
+	ID         uuid.UUID       `json:"id"`                    // The binding, policy or condition
+	ResourceID *uuid.UUID      `json:"resource_id,omitempty"` // Resource whose policy holds the row, when known
+	Reference  string          `json:"reference"`             // ID of the row it references, or the group member
+	Message    string          `json:"message"`
+}
+
+// IntegrityReport is the result of CheckIntegrity
+type IntegrityReport struct {
+	Findings      []IntegrityFinding `json:"findings"`       // Most severe first
+	Counts        map[string]int     `json:"counts"`         // Findings of each check run, including those finding nothing
+	GroupsChecked bool               `json:"groups_checked"` // Group members were checked against the provisioned groups
+	Time          time.Time          `json:"time"`
+	Duration      time.Duration      `json:"duration"`
+}
+
+// integrityState holds the latest integrity report, shared by the views of the service
+type integrityState struct {
+	checkGroups bool
+
+	mu     sync.RWMutex
+	latest *IntegrityReport
+}
+
+// SetIntegrityChecks enables ScanIntegrity, GetIntegrityReport and the IntegrityScanner. With
+// checkGroups, group members of bindings are checked against the groups provisioned through SCIM;
+// leave it off when groups also come from LDAP or ID tokens, whose groups are not provisioned. It
+// must be called before the service starts handling requests.
+func (s *IAMService) SetIntegrityChecks(integrity repository.IntegrityRepository, checkGroups bool) {
+	s.integrityRepo = integrity
+	s.integrity = &integrityState{checkGroups: checkGroups}
+}
+
+// ScanIntegrity starts a long-running operation running CheckIntegrity. Its result is the report,
+// which GetIntegrityReport then returns too.
+func (s *IAMService) ScanIntegrity() (*domain.Operation, error) {
+	if err := s.authorize("ScanIntegrity", nil); err != nil {
+		return nil, err
+	}
+
+	if s.integrityRepo == nil {
+		return nil, ErrIntegrityChecksDisabled
+	}
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+	return s.operations.Submit(OperationScanIntegrity, "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return s.CheckIntegrity(ctx)
+	})
+}
+
+// GetIntegrityReport returns the report of the latest integrity scan, by ScanIntegrity or the
+// IntegrityScanner of this server
+func (s *IAMService) GetIntegrityReport() (*IntegrityReport, error) {
+	if err := s.authorize("GetIntegrityReport", nil); err != nil {
+		return nil, err
+	}
+
+	if s.integrityRepo == nil {
+		return nil, ErrIntegrityChecksDisabled
+	}
+	s.integrity.mu.RLock()
+	defer s.integrity.mu.RUnlock()
+	if s.integrity.latest == nil {
+		return nil, ErrNoIntegrityReport
+	}
+	return s.integrity.latest, nil
+}
+
+// CheckIntegrity looks for rows left inconsistent by soft deletes, interrupted changes or manual
+// edits of the database and records the report for GetIntegrityReport. Rows referencing a
+// soft-deleted row are reported as info while the deleted row can be restored with them, and as
+// warnings otherwise; rows referencing a missing row are errors.
+func (s *IAMService) CheckIntegrity(ctx context.Context) (*IntegrityReport, error) {
+	if s.integrityRepo == nil {
+		return nil, ErrIntegrityChecksDisabled
+	}
+
+	start := time.Now()
+	report := &IntegrityReport{Findings: []IntegrityFinding{}, Counts: map[string]int{}, Time: start.UTC()}
+	for _, check := range integrityChecks {
+		if check != IntegrityMemberUnknownGroup || s.integrity.checkGroups {
+			report.Counts[check] = 0
+		}
+	}
+	add := func(finding IntegrityFinding) {
+		report.Findings = append(report.Findings, finding)
+		report.Counts[finding.Check]++
+	}
+
+	references, err := s.integrityRepo.DanglingReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find dangling references: %w", err)
+	}
+	for _, ref := range references {
+		kind, ok := danglingChecks[ref.Kind]
+		if !ok {
+			continue
+		}
+		finding := IntegrityFinding{
+			Check:      kind.check,
+			ID:         ref.ID,
+			ResourceID: ref.ResourceID,
+			Reference:  ref.ReferenceID.String(),
+		}
+		switch {
+		case !ref.Deleted:
+			finding.Severity = SeverityError
+			finding.Message = fmt.Sprintf("%s %s does not exist", kind.referenced, ref.ReferenceID)
+		case kind.check == IntegrityBindingDeletedPolicy || kind.check == IntegrityPolicyDeletedResource:
+			// Kept to be restored with the deleted row, and purged with it after the retention
+			finding.Severity = SeverityInfo
+			finding.Message = fmt.Sprintf("%s %s is deleted", kind.referenced, ref.ReferenceID)
+		default:
+			finding.Severity = SeverityWarning
+			finding.Message = fmt.Sprintf("%s %s is deleted", kind.referenced, ref.ReferenceID)
+		}
+		add(finding)
+	}
+
+	if s.integrity.checkGroups {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.GroupsChecked = true
+		if err := s.checkBoundGroups(add); err != nil {
+			return nil, err
+		}
+	}
+
+	sortIntegrityFindings(report.Findings)
+	report.Duration = time.Since(start)
+
+	s.integrity.mu.Lock()
+	s.integrity.latest = report
+	s.integrity.mu.Unlock()
+	return report, nil
+}
+
+// checkBoundGroups reports the group members of live bindings naming no provisioned group
+func (s *IAMService) checkBoundGroups(add func(IntegrityFinding)) error {
+	names, err := s.integrityRepo.GroupNames()
+	if err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+	provisioned := make(map[string]bool, len(names))
+	for _, name := range names {
+		provisioned[domain.PrincipalTypeGroup+":"+name] = true
+	}
+
+	bound, err := s.integrityRepo.BoundMembers()
+	if err != nil {
+		return fmt.Errorf("failed to list bound members: %w", err)
+	}
+	for _, binding := range bound {
+		var members []string
+		if err := json.Unmarshal(binding.Members, &members); err != nil {
+			continue
+		}
+		for _, member := range members {
+			if !strings.HasPrefix(member, domain.PrincipalTypeGroup+":") || provisioned[member] {
+				continue
+			}
+			resourceID := binding.ResourceID
+			add(IntegrityFinding{
+				Check:      IntegrityMemberUnknownGroup,
+				Severity:   SeverityWarning,
+				ID:         binding.BindingID,
+				ResourceID: &resourceID,
+				Reference:  member,
+				Message:    fmt.Sprintf("%s is not a provisioned group; it was deleted or never existed", member),
+			})
+		}
+	}
+	return nil
+}
+
+// sortIntegrityFindings orders findings by severity, then check and row
+func sortIntegrityFindings(findings []IntegrityFinding) {
+	rank := map[FindingSeverity]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	order := make(map[string]int, len(integrityChecks))
+	for i, check := range integrityChecks {
+		order[check] = i
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if rank[a.Severity] != rank[b.Severity] {
+			return rank[a.Severity] < rank[b.Severity]
+		}
+		if order[a.Check] != order[b.Check] {
+			return order[a.Check] < order[b.Check]
+		}
+		return a.ID.String() < b.ID.String()
+	})
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// IntegrityScanner checks the integrity of the database periodically and logs the findings
+type IntegrityScanner struct {
+	service  *IAMService
+	interval time.Duration
+	logger   *slog.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewIntegrityScanner creates a scanner running every interval; the service needs
+// SetIntegrityChecks. A nil logger uses slog.Default().
+func NewIntegrityScanner(service *IAMService, interval time.Duration, logger *slog.Logger) *IntegrityScanner {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &IntegrityScanner{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the first scan after one interval and then every interval until Stop
+func (is *IntegrityScanner) Start() {
+	go is.run()
+}
+
+// Stop cancels a running scan and waits for the scanner to exit or ctx to expire
+func (is *IntegrityScanner) Stop(ctx context.Context) error {
+	is.stopOnce.Do(func() { close(is.stop) })
+
+	select {
+	case <-is.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (is *IntegrityScanner) run() {
+	defer close(is.done)
+
+	ticker := time.NewTicker(is.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-is.stop:
+			return
+		case <-ticker.C:
+			is.scan()
+		}
+	}
+}
+
+// scan checks integrity, cancelling the scan when the scanner stops
+func (is *IntegrityScanner) scan() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-is.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	report, err := is.service.CheckIntegrity(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			is.logger.Error("Integrity scan failed", "error", err)
+		}
+		return
+	}
+
+	for _, finding := range report.Findings {
+		level := slog.LevelWarn
+		if finding.Severity == SeverityInfo {
+			level = slog.LevelInfo
+		}
+		is.logger.Log(ctx, level, "Integrity finding",
+			"check", finding.Check,
+			"severity", finding.Severity,
+			"id", finding.ID,
+			"resource_id", finding.ResourceID,
+			"reference", finding.Reference,
+			"message", finding.Message)
+	}
+	args := []any{"findings", len(report.Findings), "duration", report.Duration}
+	for _, check := range integrityChecks {
+		if count, ok := report.Counts[check]; ok {
+			args = append(args, check, count)
+		}
+	}
+	is.logger.Info("Integrity scan finished", args...)
+}
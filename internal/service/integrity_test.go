@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIntegrityRepository struct {
+	references []repository.DanglingReference
+	bound      []repository.BoundMembers
+	groups     []string
+}
+
+func (f *fakeIntegrityRepository) DanglingReferences() ([]repository.DanglingReference, error) {
+	return f.references, nil
+}
+
+func (f *fakeIntegrityRepository) BoundMembers() ([]repository.BoundMembers, error) {
+	return f.bound, nil
+}
+
+func (f *fakeIntegrityRepository) GroupNames() ([]string, error) {
+	return f.groups, nil
+}
+
+// Test: Missing references are errors, deleted roles and bindings warnings and deleted policies
+// and resources info, most severe first
+func TestIAMService_CheckIntegrity(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	resourceID := uuid.New()
+	deletedRole := repository.DanglingReference{Kind: repository.DanglingBindingRole, ID: uuid.New(),
+		ResourceID: &resourceID, ReferenceID: uuid.New(), Deleted: true}
+	deletedResource := repository.DanglingReference{Kind: repository.DanglingPolicyResource, ID: uuid.New(),
+		ResourceID: &resourceID, ReferenceID: resourceID, Deleted: true}
+	missingBinding := repository.DanglingReference{Kind: repository.DanglingConditionOwner, ID: uuid.New(),
+		ReferenceID: uuid.New()}
+	service.SetIntegrityChecks(&fakeIntegrityRepository{
+		references: []repository.DanglingReference{deletedRole, deletedResource, missingBinding},
+	}, false)
+
+	_, err := service.GetIntegrityReport()
+	assert.ErrorIs(t, err, ErrNoIntegrityReport)
+
+	report, err := service.CheckIntegrity(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 3)
+	assert.Equal(t, IntegrityConditionWithoutBinding, report.Findings[0].Check)
+	assert.Equal(t, SeverityError, report.Findings[0].Severity)
+	assert.Contains(t, report.Findings[0].Message, "does not exist")
+	assert.Equal(t, IntegrityBindingDeletedRole, report.Findings[1].Check)
+	assert.Equal(t, SeverityWarning, report.Findings[1].Severity)
+	assert.Equal(t, deletedRole.ReferenceID.String(), report.Findings[1].Reference)
+	assert.Equal(t, IntegrityPolicyDeletedResource, report.Findings[2].Check)
+	assert.Equal(t, SeverityInfo, report.Findings[2].Severity)
+
+	// Every check run is counted, the group check is not run
+	assert.False(t, report.GroupsChecked)
+	assert.Equal(t, map[string]int{
+		IntegrityBindingDeletedRole:      1,
+		IntegrityBindingDeletedPolicy:    0,
+		IntegrityPolicyDeletedResource:   1,
+		IntegrityConditionWithoutBinding: 1,
+	}, report.Counts)
+
+	latest, err := service.GetIntegrityReport()
+	require.NoError(t, err)
+	assert.Same(t, report, latest)
+}
+
+// Test: Group members naming no provisioned group are warnings when groups are checked
+func TestIAMService_CheckIntegrity_Groups(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	bindingID, resourceID := uuid.New(), uuid.New()
+	service.SetIntegrityChecks(&fakeIntegrityRepository{
+		bound: []repository.BoundMembers{{
+			BindingID:  bindingID,
+			ResourceID: resourceID,
+			Members:    []byte(`["group:sre@example.com", "group:former@example.com", "user:alice@example.com"]`),
+		}},
+		groups: []string{"sre@example.com"},
+	}, true)
+
+	report, err := service.CheckIntegrity(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.GroupsChecked)
+	require.Len(t, report.Findings, 1)
+	assert.Equal(t, IntegrityMemberUnknownGroup, report.Findings[0].Check)
+	assert.Equal(t, SeverityWarning, report.Findings[0].Severity)
+	assert.Equal(t, bindingID, report.Findings[0].ID)
+	assert.Equal(t, resourceID, *report.Findings[0].ResourceID)
+	assert.Equal(t, "group:former@example.com", report.Findings[0].Reference)
+	assert.Equal(t, 1, report.Counts[IntegrityMemberUnknownGroup])
+}
+
+func TestIAMService_ScanIntegrity_Disabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.ScanIntegrity()
+	assert.ErrorIs(t, err, ErrIntegrityChecksDisabled)
+	_, err = service.GetIntegrityReport()
+	assert.ErrorIs(t, err, ErrIntegrityChecksDisabled)
+	_, err = service.CheckIntegrity(context.Background())
+	assert.ErrorIs(t, err, ErrIntegrityChecksDisabled)
+}
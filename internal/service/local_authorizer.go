@@ -0,0 +1,505 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// PolicySource is the central service a LocalAuthorizer replicates from
+type PolicySource interface {
+	// GetPolicySnapshot loads the resources and policies of root's subtree and ancestors
+	GetPolicySnapshot(ctx context.Context, root uuid.UUID) (*PolicySnapshot, error)
+	// WatchPolicies streams the changes under root like IAMService.WatchPolicies, starting with
+	// a resync once the stream is open
+	WatchPolicies(ctx context.Context, root uuid.UUID, emit func(*PolicyChange) error) error
+}
+
+// LocalAuthorizer answers permission checks from an in-memory replica of one subtree's policies
+// and forwards the checks it cannot answer to the central service. The replica is loaded from a
+// snapshot whenever the watch stream reports a change; until the reload completes, checks on the
+// changed resources and their descendants are forwarded, so local answers are never older than
+// the last change seen on the stream. Checks on resources created since the last load are
+// forwarded as well, until the next periodic refresh.
+type LocalAuthorizer struct {
+	source         PolicySource
+	upstream       PermissionEvaluator
+	root           uuid.UUID
+	refresh        time.Duration
+	retry          time.Duration
+	confirmDenials bool
+	evalOpts       []EvaluatorOption
+	logger         *slog.Logger
+
+	reload chan struct{} // Coalesces the changes seen while a reload is running
+
+	mu       sync.RWMutex
+	replica  *policyReplica
+	seq      uint64               // Number of changes seen on the watch stream
+	stale    map[uuid.UUID]uint64 // Resources changed since the replica was loaded, with the seq of their last change
+	staleAll uint64               // Seq of the last resync, or 0 when the replica is current
+
+	localChecks     atomic.Int64
+	forwardedChecks atomic.Int64
+}
+
+// LocalAuthorizerStats describes the replica of a LocalAuthorizer
+type LocalAuthorizerStats struct {
+	Synced          bool      // A replica is loaded and no resync is pending
+	LoadedAt        time.Time // Time of the snapshot the replica was loaded from
+	Revision        int64     // Revision of that snapshot
+	Resources       int
+	Policies        int
+	LocalChecks     int64 // Checks answered from the replica
+	ForwardedChecks int64 // Checks forwarded to the central service
+}
+
+// policyReplica is one loaded snapshot and the evaluator answering checks from it
+type policyReplica struct {
+	snapshot    *PolicySnapshot
+	resources   map[uuid.UUID]*domain.Resource
+	policies    map[uuid.UUID]*domain.Policy
+	hierarchies map[uuid.UUID][]uuid.UUID // Resource followed by its ancestors, for resources whose chain is complete
+	evaluator   PermissionEvaluator
+}
+
+// NewLocalAuthorizer creates a local authorizer replicating cfg.RootResourceID from source and
+// forwarding to upstream. opts configure the local evaluator, e.g. with the group resolvers the
+// central service uses. A nil logger uses slog.Default().
+func NewLocalAuthorizer(
+	cfg *config.SidecarConfig,
+	source PolicySource,
+	upstream PermissionEvaluator,
+	logger *slog.Logger,
+	opts ...EvaluatorOption,
+) (*LocalAuthorizer, error) {
+	root, err := uuid.Parse(cfg.RootResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sidecar root resource id %q: %w", cfg.RootResourceID, err)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	retry := time.Duration(cfg.RetrySeconds) * time.Second
+	if retry <= 0 {
+		retry = time.Second
+	}
+
+	return &LocalAuthorizer{
+		source:         source,
+		upstream:       upstream,
+		root:           root,
+		refresh:        time.Duration(cfg.RefreshSeconds) * time.Second,
+		retry:          retry,
+		confirmDenials: cfg.ConfirmDenials,
+		evalOpts:       opts,
+		logger:         logger,
+		reload:         make(chan struct{}, 1),
+		stale:          make(map[uuid.UUID]uint64),
+	}, nil
+}
+
+// Run replicates the subtree until ctx is done, reconnecting after the watch stream fails.
+// Checks are forwarded until the first snapshot is loaded.
+func (a *LocalAuthorizer) Run(ctx context.Context) error {
+	for {
+		err := a.replicate(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// Changes made while disconnected are not replayed
+		a.observe(&PolicyChange{Kind: PolicyChangeResync})
+		a.logger.Warn("Policy replication interrupted; forwarding checks until it resumes",
+			"root", a.root, "error", err, "retry_in", a.retry)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(a.retry):
+		}
+	}
+}
+
+// replicate watches the subtree and reloads the replica after changes until the stream or a
+// reload fails
+func (a *LocalAuthorizer) replicate(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- a.source.WatchPolicies(ctx, a.root, a.observe)
+	}()
+	defer func() {
+		cancel()
+		if watchErr != nil {
+			<-watchErr
+		}
+	}()
+
+	var refresh <-chan time.Time
+	if a.refresh > 0 {
+		ticker := time.NewTicker(a.refresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-watchErr:
+			watchErr = nil
+			if err == nil {
+				err = fmt.Errorf("watch stream closed")
+			}
+			return err
+		case <-a.reload:
+		case <-refresh:
+		}
+		if err := a.load(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// observe marks the resources of change stale and schedules a reload
+func (a *LocalAuthorizer) observe(change *PolicyChange) error {
+	a.mu.Lock()
+	a.seq++
+	if change.Kind == PolicyChangeResync || change.ResourceID == uuid.Nil {
+		a.staleAll = a.seq
+	} else {
+		a.stale[change.ResourceID] = a.seq
+	}
+	a.mu.Unlock()
+
+	select {
+	case a.reload <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// load replaces the replica with a new snapshot. Changes seen after the snapshot was requested
+// stay stale until the next load.
+func (a *LocalAuthorizer) load(ctx context.Context) error {
+	a.mu.RLock()
+	seq, current := a.seq, a.replica
+	a.mu.RUnlock()
+
+	snapshot, err := a.source.GetPolicySnapshot(ctx, a.root)
+	if err != nil {
+		return fmt.Errorf("failed to load policy snapshot: %w", err)
+	}
+	// e.g. read from a lagging database replica
+	if current != nil && snapshot.Revision < current.snapshot.Revision {
+		return fmt.Errorf("policy snapshot revision %d is older than the loaded revision %d",
+			snapshot.Revision, current.snapshot.Revision)
+	}
+	replica := newPolicyReplica(snapshot, a.evalOpts)
+
+	a.mu.Lock()
+	a.replica = replica
+	for id, changed := range a.stale {
+		if changed <= seq {
+			delete(a.stale, id)
+		}
+	}
+	if a.staleAll <= seq {
+		a.staleAll = 0
+	}
+	a.mu.Unlock()
+
+	a.logger.Debug("Policy replica loaded", "root", a.root, "revision", snapshot.Revision,
+		"resources", len(replica.resources), "policies", len(replica.policies))
+	return nil
+}
+
+// serving returns the replica if it can answer checks on resourceID, or nil
+func (a *LocalAuthorizer) serving(resourceID uuid.UUID) *policyReplica {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.replica == nil || a.staleAll != 0 {
+		return nil
+	}
+	hierarchy, ok := a.replica.hierarchies[resourceID]
+	if !ok {
+		return nil
+	}
+	for _, id := range hierarchy {
+		if _, stale := a.stale[id]; stale {
+			return nil
+		}
+	}
+	return a.replica
+}
+
+// checkLocally answers a check from the replica, unless it must be forwarded, e.g. because it is
+// fully consistent
+func (a *LocalAuthorizer) checkLocally(principal string, check PermissionCheck) (CheckResult, bool) {
+	if fullyConsistent(check.Context) {
+		return CheckResult{}, false
+	}
+	replica := a.serving(check.ResourceID)
+	if replica == nil {
+		return CheckResult{}, false
+	}
+	result, err := replica.evaluator.Check(principal, check.ResourceID, check.Permission, check.Context)
+	if err != nil || (!result.Allowed && a.confirmDenials) {
+		return CheckResult{}, false
+	}
+	a.localChecks.Add(1)
+	return result, true
+}
+
+// CheckPermission checks a permission locally, or on the central service
+func (a *LocalAuthorizer) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(a.Check(principal, resourceID, permission, context))
+}
+
+// Check checks a permission locally, or on the central service
+func (a *LocalAuthorizer) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	check := PermissionCheck{ResourceID: resourceID, Permission: permission, Context: context}
+	if result, ok := a.checkLocally(principal, check); ok {
+		return result, nil
+	}
+	a.forwardedChecks.Add(1)
+	return a.upstream.Check(principal, resourceID, permission, context)
+}
+
+// TestPermissions tests permissions locally, or on the central service
+func (a *LocalAuthorizer) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	if replica := a.serving(resourceID); replica != nil {
+		granted, err := replica.evaluator.TestPermissions(principal, resourceID, permissions, context)
+		if err == nil && (!a.confirmDenials || grantsAll(granted, permissions)) {
+			a.localChecks.Add(1)
+			return granted, nil
+		}
+	}
+	a.forwardedChecks.Add(1)
+	return a.upstream.TestPermissions(principal, resourceID, permissions, context)
+}
+
+// GetEffectivePermissions lists permissions locally, or on the central service when denials
+// must be confirmed
+func (a *LocalAuthorizer) GetEffectivePermissions(principal string, resourceID uuid.UUID) ([]string, []string, error) {
+	if replica := a.serving(resourceID); replica != nil && !a.confirmDenials {
+		permissions, roles, err := replica.evaluator.GetEffectivePermissions(principal, resourceID)
+		if err == nil {
+			a.localChecks.Add(1)
+			return permissions, roles, nil
+		}
+	}
+	a.forwardedChecks.Add(1)
+	return a.upstream.GetEffectivePermissions(principal, resourceID)
+}
+
+// BatchCheckPermissions answers the checks it can locally and forwards the others to the central
+// service in one batch
+func (a *LocalAuthorizer) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	results := make([]CheckResult, len(checks))
+	var forwarded []PermissionCheck
+	var positions []int
+	for i, check := range checks {
+		if result, ok := a.checkLocally(principal, check); ok {
+			results[i] = result
+			continue
+		}
+		forwarded = append(forwarded, check)
+		positions = append(positions, i)
+	}
+	if len(forwarded) == 0 {
+		return results, nil
+	}
+
+	a.forwardedChecks.Add(int64(len(forwarded)))
+	upstream, err := a.upstream.BatchCheckPermissions(principal, forwarded)
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream) != len(forwarded) {
+		return nil, fmt.Errorf("upstream returned %d results for %d checks", len(upstream), len(forwarded))
+	}
+	for j, result := range upstream {
+		results[positions[j]] = result
+	}
+	return results, nil
+}
+
+// CheckPermissionForPrincipals answers the checks it can locally and forwards the others to the
+// central service in one call
+func (a *LocalAuthorizer) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	check := PermissionCheck{ResourceID: resourceID, Permission: permission, Context: context}
+	results := make([]CheckResult, len(principals))
+	var forwarded []string
+	var positions []int
+	for i, principal := range principals {
+		if result, ok := a.checkLocally(principal, check); ok {
+			results[i] = result
+			continue
+		}
+		forwarded = append(forwarded, principal)
+		positions = append(positions, i)
+	}
+	if len(forwarded) == 0 {
+		return results, nil
+	}
+
+	a.forwardedChecks.Add(int64(len(forwarded)))
+	upstream, err := a.upstream.CheckPermissionForPrincipals(forwarded, resourceID, permission, context)
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream) != len(forwarded) {
+		return nil, fmt.Errorf("upstream returned %d results for %d checks", len(upstream), len(forwarded))
+	}
+	for j, result := range upstream {
+		results[positions[j]] = result
+	}
+	return results, nil
+}
+
+// GrantingMembers resolves the principal's identities on the central service, which knows every
+// alias and group
+func (a *LocalAuthorizer) GrantingMembers(principal string) ([]string, error) {
+	return a.upstream.GrantingMembers(principal)
+}
+
+// Stats describes the replica and the checks answered so far
+func (a *LocalAuthorizer) Stats() LocalAuthorizerStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	stats := LocalAuthorizerStats{
+		Synced:          a.replica != nil && a.staleAll == 0,
+		LocalChecks:     a.localChecks.Load(),
+		ForwardedChecks: a.forwardedChecks.Load(),
+	}
+	if a.replica != nil {
+		stats.LoadedAt = a.replica.snapshot.Time
+		stats.Revision = a.replica.snapshot.Revision
+		stats.Resources = len(a.replica.resources)
+		stats.Policies = len(a.replica.policies)
+	}
+	return stats
+}
+
+// grantsAll reports whether granted contains every permission
+func grantsAll(granted, permissions []string) bool {
+	held := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		held[permission] = true
+	}
+	for _, permission := range permissions {
+		if !held[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// newPolicyReplica indexes a snapshot for the evaluator
+func newPolicyReplica(snapshot *PolicySnapshot, opts []EvaluatorOption) *policyReplica {
+	r := &policyReplica{
+		snapshot:    snapshot,
+		resources:   make(map[uuid.UUID]*domain.Resource, len(snapshot.Resources)),
+		policies:    make(map[uuid.UUID]*domain.Policy, len(snapshot.Policies)),
+		hierarchies: make(map[uuid.UUID][]uuid.UUID, len(snapshot.Resources)),
+	}
+	for i := range snapshot.Resources {
+		r.resources[snapshot.Resources[i].ID] = &snapshot.Resources[i]
+	}
+	for i := range snapshot.Policies {
+		r.policies[snapshot.Policies[i].ResourceID] = &snapshot.Policies[i]
+	}
+
+	// Resources whose ancestors are not all in the snapshot cannot be checked locally
+	for id, resource := range r.resources {
+		hierarchy := []uuid.UUID{id}
+		complete := true
+		for parentID := resource.ParentID; parentID != nil; {
+			parent, ok := r.resources[*parentID]
+			if !ok || len(hierarchy) > len(r.resources) {
+				complete = false
+				break
+			}
+			hierarchy = append(hierarchy, parent.ID)
+			parentID = parent.ParentID
+		}
+		if complete {
+			r.hierarchies[id] = hierarchy
+		}
+	}
+
+	r.evaluator = NewPermissionEvaluator(replicaResources{policyReplica: r}, replicaPolicies{policyReplica: r}, nil, NewNoopCache(), opts...)
+	return r
+}
+
+// replicaResources serves the resource reads of the evaluator from a replica
+type replicaResources struct {
+	repository.ResourceRepository // nil; the other methods are not implemented
+	*policyReplica
+}
+
+func (r replicaResources) GetByID(id uuid.UUID) (*domain.Resource, error) {
+	if _, ok := r.hierarchies[id]; !ok {
+		return nil, nil
+	}
+	return r.resources[id], nil
+}
+
+func (r replicaResources) GetAncestors(id uuid.UUID) ([]domain.Resource, error) {
+	hierarchy := r.hierarchies[id]
+	if len(hierarchy) == 0 {
+		return []domain.Resource{}, nil
+	}
+	ancestors := make([]domain.Resource, 0, len(hierarchy)-1)
+	for _, ancestorID := range hierarchy[1:] {
+		ancestors = append(ancestors, *r.resources[ancestorID])
+	}
+	return ancestors, nil
+}
+
+// replicaPolicies serves the policy reads of the evaluator from a replica
+type replicaPolicies struct {
+	repository.PolicyRepository // nil; the other methods are not implemented
+	*policyReplica
+}
+
+func (r replicaPolicies) GetByResourceID(resourceID uuid.UUID) (*domain.Policy, error) {
+	return r.policies[resourceID], nil
+}
+
+func (r replicaPolicies) GetByResourceIDs(resourceIDs []uuid.UUID) (map[uuid.UUID]*domain.Policy, error) {
+	policies := make(map[uuid.UUID]*domain.Policy, len(resourceIDs))
+	for _, id := range resourceIDs {
+		if policy := r.policies[id]; policy != nil {
+			policies[id] = policy
+		}
+	}
+	return policies, nil
+}
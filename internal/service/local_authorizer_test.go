@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePolicySource serves a snapshot that tests replace, and streams the changes they send
+type fakePolicySource struct {
+	mu       sync.Mutex
+	snapshot *PolicySnapshot
+	changes  chan *PolicyChange
+}
+
+func (f *fakePolicySource) GetPolicySnapshot(ctx context.Context, root uuid.UUID) (*PolicySnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.snapshot, nil
+}
+
+func (f *fakePolicySource) WatchPolicies(ctx context.Context, root uuid.UUID, emit func(*PolicyChange) error) error {
+	if err := emit(&PolicyChange{Kind: PolicyChangeResync}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change := <-f.changes:
+			if err := emit(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (f *fakePolicySource) setSnapshot(snapshot *PolicySnapshot) {
+	f.mu.Lock()
+	f.snapshot = snapshot
+	f.mu.Unlock()
+}
+
+// sidecarSnapshot returns a snapshot of org > project > bucket with bindings on org
+func sidecarSnapshot(org, project, bucket uuid.UUID, bindings ...domain.Binding) *PolicySnapshot {
+	return &PolicySnapshot{
+		Root: project,
+		Resources: []domain.Resource{
+			{ID: org, Type: "organization"},
+			{ID: project, Type: "project", ParentID: &org},
+			{ID: bucket, Type: "bucket", ParentID: &project},
+		},
+		Policies: []domain.Policy{{ID: uuid.New(), ResourceID: org, Bindings: bindings}},
+		Time:     time.Now(),
+	}
+}
+
+func newTestLocalAuthorizer(t *testing.T, source PolicySource, root uuid.UUID, confirmDenials bool) (*LocalAuthorizer, *MockPermissionEvaluator) {
+	upstream := new(MockPermissionEvaluator)
+	authorizer, err := NewLocalAuthorizer(&config.SidecarConfig{
+		RootResourceID: root.String(),
+		RetrySeconds:   1,
+		ConfirmDenials: confirmDenials,
+	}, source, upstream, nil)
+	require.NoError(t, err)
+	return authorizer, upstream
+}
+
+func TestLocalAuthorizer_AnswersFromReplica(t *testing.T) {
+	org, project, bucket := uuid.New(), uuid.New(), uuid.New()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	source := &fakePolicySource{
+		snapshot: sidecarSnapshot(org, project, bucket, testBinding(&viewer, "user:alice@example.com")),
+		changes:  make(chan *PolicyChange),
+	}
+	authorizer, upstream := newTestLocalAuthorizer(t, source, project, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go authorizer.Run(ctx)
+	require.Eventually(t, func() bool { return authorizer.Stats().Synced }, time.Second, time.Millisecond)
+
+	result, err := authorizer.Check("user:alice@example.com", bucket, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "roles/viewer", result.Role)
+
+	allowed, _, err := authorizer.CheckPermission("user:bob@example.com", bucket, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	granted, err := authorizer.TestPermissions("user:alice@example.com", project, []string{"storage.buckets.get", "storage.buckets.delete"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.get"}, granted)
+
+	permissions, roles, err := authorizer.GetEffectivePermissions("user:alice@example.com", bucket)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.get"}, permissions)
+	assert.Equal(t, []string{"roles/viewer"}, roles)
+
+	stats := authorizer.Stats()
+	assert.Equal(t, 3, stats.Resources)
+	assert.Equal(t, 1, stats.Policies)
+	assert.Equal(t, int64(4), stats.LocalChecks)
+	assert.Zero(t, stats.ForwardedChecks)
+	upstream.AssertNotCalled(t, "CheckPermission", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// A change on the stream reloads the replica
+	editor := testRole("roles/editor", "storage.buckets.get", "storage.buckets.delete")
+	source.setSnapshot(sidecarSnapshot(org, project, bucket, testBinding(&editor, "user:bob@example.com")))
+	source.changes <- &PolicyChange{Kind: PolicyChangeUpdated, ResourceID: org}
+	require.Eventually(t, func() bool {
+		result, err := authorizer.Check("user:bob@example.com", bucket, "storage.buckets.delete", nil)
+		return err == nil && result.Allowed
+	}, time.Second, time.Millisecond)
+}
+
+func TestLocalAuthorizer_ForwardsUnknownAndStaleResources(t *testing.T) {
+	org, project, bucket := uuid.New(), uuid.New(), uuid.New()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	source := &fakePolicySource{snapshot: sidecarSnapshot(org, project, bucket, testBinding(&viewer, "user:alice@example.com"))}
+	authorizer, upstream := newTestLocalAuthorizer(t, source, project, false)
+
+	// Nothing is answered locally before the first load
+	upstream.On("CheckPermission", "user:alice@example.com", bucket, "storage.buckets.get", map[string]string(nil)).
+		Return(true, "Permission granted", nil)
+	allowed, _, err := authorizer.CheckPermission("user:alice@example.com", bucket, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, int64(1), authorizer.Stats().ForwardedChecks)
+
+	require.NoError(t, authorizer.observe(&PolicyChange{Kind: PolicyChangeResync}))
+	require.NoError(t, authorizer.load(context.Background()))
+	assert.True(t, authorizer.Stats().Synced)
+	assert.NotNil(t, authorizer.serving(bucket))
+
+	// Resources created after the load are forwarded
+	created := uuid.New()
+	upstream.On("CheckPermission", "user:alice@example.com", created, "storage.buckets.get", map[string]string(nil)).
+		Return(false, "Permission denied", nil)
+	allowed, _, err = authorizer.CheckPermission("user:alice@example.com", created, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// A change on an ancestor forwards its subtree until the next load
+	require.NoError(t, authorizer.observe(&PolicyChange{Kind: PolicyChangeUpdated, ResourceID: project}))
+	assert.Nil(t, authorizer.serving(bucket))
+	assert.Nil(t, authorizer.serving(project))
+	assert.NotNil(t, authorizer.serving(org))
+
+	upstream.On("BatchCheckPermissions", "user:alice@example.com", []PermissionCheck{{ResourceID: bucket, Permission: "storage.buckets.get"}}).
+		Return([]CheckResult{{Allowed: true, Reason: "upstream"}}, nil)
+	results, err := authorizer.BatchCheckPermissions("user:alice@example.com", []PermissionCheck{
+		{ResourceID: org, Permission: "storage.buckets.get"},
+		{ResourceID: bucket, Permission: "storage.buckets.get"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "roles/viewer", results[0].Role)
+	assert.Equal(t, "upstream", results[1].Reason)
+
+	require.NoError(t, authorizer.load(context.Background()))
+	assert.NotNil(t, authorizer.serving(bucket))
+	assert.Equal(t, int64(3), authorizer.Stats().ForwardedChecks)
+}
+
+// Test: A snapshot older than the loaded one, e.g. read from a lagging replica, is not loaded
+func TestLocalAuthorizer_RejectsOlderSnapshots(t *testing.T) {
+	org, project, bucket := uuid.New(), uuid.New(), uuid.New()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	snapshot := sidecarSnapshot(org, project, bucket, testBinding(&viewer, "user:alice@example.com"))
+	snapshot.Revision = 2
+	source := &fakePolicySource{snapshot: snapshot}
+	authorizer, _ := newTestLocalAuthorizer(t, source, project, false)
+	require.NoError(t, authorizer.load(context.Background()))
+
+	older := sidecarSnapshot(org, project, bucket)
+	older.Revision = 1
+	source.setSnapshot(older)
+	require.NoError(t, authorizer.observe(&PolicyChange{Kind: PolicyChangeUpdated, ResourceID: org}))
+	assert.ErrorContains(t, authorizer.load(context.Background()), "older than the loaded revision")
+	assert.Nil(t, authorizer.serving(bucket), "the change is still pending")
+	assert.Equal(t, int64(2), authorizer.Stats().Revision)
+}
+
+func TestLocalAuthorizer_ConfirmDenials(t *testing.T) {
+	org, project, bucket := uuid.New(), uuid.New(), uuid.New()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	source := &fakePolicySource{snapshot: sidecarSnapshot(org, project, bucket, testBinding(&viewer, "group:eng@example.com"))}
+	authorizer, upstream := newTestLocalAuthorizer(t, source, project, true)
+	require.NoError(t, authorizer.load(context.Background()))
+
+	// Only the central service knows that alice is in group:eng
+	upstream.On("CheckPermission", "user:alice@example.com", bucket, "storage.buckets.get", map[string]string(nil)).
+		Return(true, "Permission granted", nil)
+	upstream.On("TestPermissions", "user:alice@example.com", bucket, []string{"storage.buckets.get"}, map[string]string(nil)).
+		Return([]string{"storage.buckets.get"}, nil)
+
+	allowed, _, err := authorizer.CheckPermission("user:alice@example.com", bucket, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	granted, err := authorizer.TestPermissions("user:alice@example.com", bucket, []string{"storage.buckets.get"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.get"}, granted)
+
+	// Allowed checks are still answered locally
+	allowed, _, err = authorizer.CheckPermission("group:eng@example.com", bucket, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	stats := authorizer.Stats()
+	assert.Equal(t, int64(1), stats.LocalChecks)
+	assert.Equal(t, int64(2), stats.ForwardedChecks)
+}
@@ -0,0 +1,62 @@
+# Built-in policy of the OPA evaluator backend. The IAM server uploads it on startup unless
+# evaluator.opa.policy_file provides a replacement, which must define the same rules.
+#
+# input:
+#   principal    the checked principal
+#   identities   the principal, its groups, its domain:<domain> member, allUsers and
+#                allAuthenticatedUsers
+#   resource     {id, type, name, attributes} of the checked resource
+#   hierarchy    [{resource_id, bindings: [{id, role, permissions, members, condition,
+#                condition_met}]}], the checked resource first, then its ancestors
+#   variables    the condition variables (request, principal, resource, context)
+#   permission   the permission of a single check
+#   permissions  the permissions of a TestIamPermissions request
+#
+# Binding conditions are CEL expressions, evaluated by the server against input.variables
+# before the query: condition_met is true for bindings without a condition and for those whose
+# condition holds. Like the native evaluator, bindings apply only when condition_met is true.
+package iam.authz
+
+import rego.v1
+
+identities := {identity | some identity in input.identities}
+
+# grants lists the bindings applying to the principal, nearest resource first
+grants := [grant |
+	some level in input.hierarchy
+	some binding in level.bindings
+	applies(binding)
+	grant := {"resource_id": level.resource_id, "role": binding.role, "permissions": binding.permissions}
+]
+
+applies(binding) if {
+	binding.condition_met
+	some member in binding.members
+	member in identities
+}
+
+# decision answers a single check
+default decision := {"allow": false, "reason": "Permission denied: no matching policy found"}
+
+decision := {
+	"allow": true,
+	"reason": sprintf("Permission granted via role '%s' on resource '%s'", [matching[0].role, matching[0].resource_id]),
+	"role": matching[0].role,
+} if {
+	count(matching) > 0
+}
+
+matching := [grant | some grant in grants; input.permission in grant.permissions]
+
+# granted answers TestIamPermissions with the held subset of input.permissions
+granted contains permission if {
+	some permission in input.permissions
+	some grant in grants
+	permission in grant.permissions
+}
+
+# effective answers GetEffectivePermissions
+effective := {
+	"roles": {grant.role | some grant in grants},
+	"permissions": {permission | some grant in grants; some permission in grant.permissions},
+}
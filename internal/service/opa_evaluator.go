@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// DefaultRegoPolicy is the Rego module of package iam.authz the OPA evaluator queries.
+// It grants what the native evaluator grants.
+//
+//go:embed opa_authz.rego
+var DefaultRegoPolicy string
+
+// RegoPolicyID is the ID the policy module is stored under in OPA
+const RegoPolicyID = "iam-authz"
+
+// Documents of package iam.authz queried by the OPA evaluator
+const (
+	regoDecision  = "iam/authz/decision"
+	regoGranted   = "iam/authz/granted"
+	regoEffective = "iam/authz/effective"
+)
+
+// RegoEngine evaluates documents of Rego policies, e.g. an OPA server (opa.Client)
+type RegoEngine interface {
+	// Evaluate queries the document at path with input and decodes it into result
+	Evaluate(ctx context.Context, path string, input, result interface{}) error
+}
+
+// opaEvaluator evaluates checks with Rego. The database stays the source of truth: every
+// request loads the hierarchy, policies and groups as the native evaluator does and passes
+// them to the policy as input, so nothing has to be synchronized into OPA.
+type opaEvaluator struct {
+	loader *permissionEvaluator
+	engine RegoEngine
+}
+
+// NewOPAEvaluator creates a permission evaluator backed by Rego policies evaluated by engine.
+// Positive decisions are cached like those of the native evaluator.
+func NewOPAEvaluator(
+	resourceRepo repository.ResourceRepository,
+	policyRepo repository.PolicyRepository,
+	permissionRepo repository.PermissionRepository,
+	cache CacheService,
+	engine RegoEngine,
+	opts ...EvaluatorOption,
+) PermissionEvaluator {
+	loader := NewPermissionEvaluator(resourceRepo, policyRepo, permissionRepo, cache, opts...).(*permissionEvaluator)
+	return &opaEvaluator{loader: loader, engine: engine}
+}
+
+// regoInput is the input document of package iam.authz
+type regoInput struct {
+	Principal   string                 `json:"principal"`
+	Identities  []string               `json:"identities"`
+	Resource    regoResource           `json:"resource"`
+	Hierarchy   []regoLevel            `json:"hierarchy"`
+	Variables   map[string]interface{} `json:"variables"`
+	Permission  string                 `json:"permission,omitempty"`
+	Permissions []string               `json:"permissions,omitempty"`
+}
+
+type regoResource struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Tags       map[string]string      `json:"tags"`
+}
+
+// regoLevel holds the bindings of one resource of the hierarchy
+type regoLevel struct {
+	ResourceID uuid.UUID     `json:"resource_id"`
+	Bindings   []regoBinding `json:"bindings"`
+}
+
+// regoBinding is a binding of the input. Conditions are CEL, which Rego cannot evaluate, so
+// ConditionMet carries the result of the binding's condition for the checked request.
+type regoBinding struct {
+	ID           uuid.UUID `json:"id"`
+	Role         string    `json:"role"`
+	Permissions  []string  `json:"permissions"`
+	Members      []string  `json:"members"`
+	Condition    string    `json:"condition,omitempty"`
+	ConditionMet bool      `json:"condition_met"`
+}
+
+// grantsUnconditionally reports whether a binding of the input without a condition grants
+// permission to one of its identities. Other allows may depend on the request, which the cache
+// key does not cover, so only these are cached.
+func (in *regoInput) grantsUnconditionally(permission string) bool {
+	for _, level := range in.Hierarchy {
+		for _, binding := range level.Bindings {
+			if binding.Condition != "" || !slices.Contains(binding.Permissions, permission) {
+				continue
+			}
+			for _, member := range binding.Members {
+				for _, identity := range in.Identities {
+					if domain.MemberMatches(member, identity) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// regoDecisionResult is the iam.authz.decision document
+type regoDecisionResult struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+	Role   string `json:"role"`
+}
+
+// regoEffectiveResult is the iam.authz.effective document
+type regoEffectiveResult struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// compileInput loads the resource, its hierarchy and the principal's identities into the
+// input document. It returns nil when the resource does not exist.
+func (oe *opaEvaluator) compileInput(
+	ev *evaluation,
+	principal string,
+	resourceID uuid.UUID,
+	context map[string]string,
+) (*regoInput, string, error) {
+	resource, err := ev.resource(resourceID)
+	if err != nil {
+		return nil, "Error fetching resource", err
+	}
+	if resource == nil {
+		return nil, "Resource not found", nil
+	}
+
+	resources, err := ev.hierarchy(resourceID)
+	if err != nil {
+		return nil, "Error fetching resource ancestors", err
+	}
+	if err := ev.loadPolicies(resources); err != nil {
+		return nil, "Error fetching policy", err
+	}
+
+	identities, err := ev.identity(principal)
+	if err != nil {
+		return nil, "Error resolving groups", err
+	}
+	identities = append(identities[:len(identities):len(identities)], tokenGroupsOf(context)...)
+	// Domain members are matched by set membership in Rego, so the domains of the principal and
+	// its linked identities are identities too
+	for _, identity := range identities {
+		if member := domain.DomainPrincipal(identity); member != "" && !slices.Contains(identities, member) {
+			identities = append(identities[:len(identities):len(identities)], member)
+		}
+	}
+	// and so are the public members, which grant to every principal
+	identities = append(identities[:len(identities):len(identities)], domain.MemberAllUsers, domain.MemberAllAuthenticatedUsers)
+
+	// Conditions are evaluated here, but a replacement policy may read input.variables, so
+	// principal attributes are always fetched
+	condCtx := NewConditionContext(principal, resource, context)
+	if err := ev.principal(condCtx); err != nil {
+		return nil, "Error fetching principal attributes", err
+	}
+
+	input := &regoInput{
+		Principal:  principal,
+		Identities: identities,
+		Resource: regoResource{
+			ID:         resource.ID,
+			Type:       resource.Type,
+			Name:       resource.Name,
+			Attributes: resource.Attributes,
+			Tags:       resource.TagMap(),
+		},
+		Hierarchy: make([]regoLevel, 0, len(resources)),
+		Variables: condCtx.Variables(),
+	}
+	if input.Resource.Attributes == nil {
+		input.Resource.Attributes = map[string]interface{}{}
+	}
+
+	for _, resID := range resources {
+		policy, err := ev.policy(resID)
+		if err != nil {
+			return nil, "Error fetching policy", err
+		}
+		level := regoLevel{ResourceID: resID, Bindings: []regoBinding{}}
+		if policy != nil {
+			for i := range policy.Bindings {
+				compiled := compileBinding(&policy.Bindings[i])
+				if compiled.ConditionMet, err = ev.conditionHolds(policy.Bindings[i].Condition, condCtx); err != nil {
+					return nil, "Error fetching principal attributes", err
+				}
+				level.Bindings = append(level.Bindings, compiled)
+			}
+		}
+		input.Hierarchy = append(input.Hierarchy, level)
+	}
+
+	return input, "", nil
+}
+
+// compileBinding converts a binding to its input form; invalid members grant nothing
+func compileBinding(binding *domain.Binding) regoBinding {
+	compiled := regoBinding{ID: binding.ID, Permissions: []string{}, Members: []string{}}
+	if binding.Role != nil {
+		compiled.Role = binding.Role.Name
+		for _, permission := range binding.Role.Permissions {
+			compiled.Permissions = append(compiled.Permissions, permission.Name)
+		}
+	}
+	if members, err := binding.GetMembers(); err == nil {
+		for _, member := range members {
+			// Domains match case-insensitively, as in domain.MemberMatches
+			if name, ok := strings.CutPrefix(member, domain.PrincipalTypeDomain+":"); ok {
+				member = domain.PrincipalTypeDomain + ":" + strings.ToLower(name)
+			}
+			compiled.Members = append(compiled.Members, member)
+		}
+	}
+	if binding.Condition != nil {
+		compiled.Condition = binding.Condition.Expression
+	}
+	return compiled
+}
+
+// CheckPermission checks if a principal has a specific permission on a resource
+func (oe *opaEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(oe.Check(principal, resourceID, permission, context))
+}
+
+// Check checks if a principal has a specific permission on a resource
+func (oe *opaEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	ev := oe.loader.newEvaluation()
+	if fullyConsistent(context) {
+		ev = oe.loader.newConsistentEvaluation()
+	}
+	return oe.checkPermission(ev, principal, resourceID, permission, context)
+}
+
+// BatchCheckPermissions runs several checks of one principal, loading shared rows once
+func (oe *opaEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	ev := oe.loader.newEvaluation()
+	results := make([]CheckResult, len(checks))
+	for i, check := range checks {
+		result, err := oe.checkPermission(ev, principal, check.ResourceID, check.Permission, check.Context)
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %s: %w", i, result.Reason, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// CheckPermissionForPrincipals checks one permission of several principals on a resource,
+// loading the resource, its ancestors and their policies once
+func (oe *opaEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	ev := oe.loader.newEvaluation()
+	if fullyConsistent(context) {
+		ev = oe.loader.newConsistentEvaluation()
+	}
+	results := make([]CheckResult, len(principals))
+	for i, principal := range principals {
+		result, err := oe.checkPermission(ev, principal, resourceID, permission, context)
+		if err != nil {
+			return nil, fmt.Errorf("check of %s: %s: %w", principal, result.Reason, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+func (oe *opaEvaluator) checkPermission(
+	ev *evaluation,
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	cache := oe.loader.cache
+	cacheKey := GenerateCacheKey(principal, resourceID.String(), permission)
+	if role, found := cachedGrant(cache, cacheKey); found && !ev.consistent {
+		return CheckResult{Allowed: true, Reason: "Permission granted (cached)", Role: role}, nil
+	}
+
+	input, reason, err := oe.compileInput(ev, principal, resourceID, context)
+	if err != nil || input == nil {
+		return CheckResult{Reason: reason}, err
+	}
+	input.Permission = permission
+
+	var decision regoDecisionResult
+	if err := oe.engine.Evaluate(contextBackground(), regoDecision, input, &decision); err != nil {
+		return CheckResult{Reason: "Error evaluating policy"}, err
+	}
+	switch {
+	case len(tokenGroupsOf(context)) > 0:
+	case decision.Allow && input.grantsUnconditionally(permission):
+		// Allows depending on a condition are evaluated by every check
+		cache.Set(cacheKey, decision.Role)
+	case ev.consistent:
+		// Later checks must not be granted by a grant the fully consistent check revoked
+		cache.Delete(cacheKey)
+	}
+	return CheckResult{Allowed: decision.Allow, Reason: decision.Reason, Role: decision.Role}, nil
+}
+
+// TestPermissions returns the subset of permissions the principal holds on a resource, in request order
+func (oe *opaEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	cache := oe.loader.cache
+	granted := make(map[string]bool, len(permissions))
+
+	var pending []string
+	for _, permission := range permissions {
+		cacheKey := GenerateCacheKey(principal, resourceID.String(), permission)
+		if _, found := cachedGrant(cache, cacheKey); found {
+			granted[permission] = true
+		} else {
+			pending = append(pending, permission)
+		}
+	}
+
+	if len(pending) > 0 {
+		input, _, err := oe.compileInput(oe.loader.newEvaluation(), principal, resourceID, context)
+		if err != nil {
+			return nil, err
+		}
+		if input == nil {
+			return []string{}, nil
+		}
+		input.Permissions = pending
+
+		var held []string
+		if err := oe.engine.Evaluate(contextBackground(), regoGranted, input, &held); err != nil {
+			return nil, fmt.Errorf("failed to evaluate policy: %w", err)
+		}
+		for _, permission := range held {
+			granted[permission] = true
+			if len(tokenGroupsOf(context)) == 0 && input.grantsUnconditionally(permission) {
+				// The granted document does not name the roles, so the role is cached as unknown
+				cache.Set(GenerateCacheKey(principal, resourceID.String(), permission), "")
+			}
+		}
+	}
+
+	result := make([]string, 0, len(granted))
+	seen := make(map[string]bool, len(granted))
+	for _, permission := range permissions {
+		if granted[permission] && !seen[permission] {
+			seen[permission] = true
+			result = append(result, permission)
+		}
+	}
+	return result, nil
+}
+
+// GrantingMembers resolves the principal's identities as the Go evaluator does
+func (oe *opaEvaluator) GrantingMembers(principal string) ([]string, error) {
+	return oe.loader.GrantingMembers(principal)
+}
+
+// GetEffectivePermissions returns all effective permissions and roles of a principal on a resource
+func (oe *opaEvaluator) GetEffectivePermissions(principal string, resourceID uuid.UUID) ([]string, []string, error) {
+	input, _, err := oe.compileInput(oe.loader.newEvaluation(), principal, resourceID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if input == nil {
+		return nil, nil, fmt.Errorf("resource not found")
+	}
+
+	var effective regoEffectiveResult
+	if err := oe.engine.Evaluate(contextBackground(), regoEffective, input, &effective); err != nil {
+		return nil, nil, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+	if effective.Permissions == nil {
+		effective.Permissions = []string{}
+	}
+	if effective.Roles == nil {
+		effective.Roles = []string{}
+	}
+	return effective.Permissions, effective.Roles, nil
+}
+
+// contextBackground returns the context of Rego queries; the engine bounds each query itself.
+// It exists because the checks' context parameter shadows the context package.
+func contextBackground() context.Context {
+	return context.Background()
+}
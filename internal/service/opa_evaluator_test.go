@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegoEngine answers the documents of package iam.authz in Go, following the built-in
+// policy, and records the inputs it receives
+type fakeRegoEngine struct {
+	inputs []regoInput
+	err    error
+}
+
+func (e *fakeRegoEngine) Evaluate(ctx context.Context, path string, input, result interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	// Round-trip through JSON as the OPA REST API does
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	var in regoInput
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	e.inputs = append(e.inputs, in)
+
+	identities := make(map[string]bool)
+	for _, identity := range in.Identities {
+		identities[identity] = true
+	}
+	var grants []regoBinding
+	var resources []uuid.UUID
+	for _, level := range in.Hierarchy {
+		for _, binding := range level.Bindings {
+			if !binding.ConditionMet {
+				continue
+			}
+			for _, member := range binding.Members {
+				if identities[member] {
+					grants = append(grants, binding)
+					resources = append(resources, level.ResourceID)
+					break
+				}
+			}
+		}
+	}
+
+	var document interface{}
+	switch path {
+	case regoDecision:
+		decision := regoDecisionResult{Reason: "Permission denied: no matching policy found"}
+		for i, grant := range grants {
+			if contains(grant.Permissions, in.Permission) {
+				decision = regoDecisionResult{Allow: true, Reason: fmt.Sprintf(
+					"Permission granted via role '%s' on resource '%s'", grant.Role, resources[i])}
+				break
+			}
+		}
+		document = decision
+	case regoGranted:
+		granted := []string{}
+		for _, permission := range in.Permissions {
+			for _, grant := range grants {
+				if contains(grant.Permissions, permission) {
+					granted = append(granted, permission)
+					break
+				}
+			}
+		}
+		document = granted
+	case regoEffective:
+		effective := regoEffectiveResult{}
+		for _, grant := range grants {
+			effective.Roles = append(effective.Roles, grant.Role)
+			effective.Permissions = append(effective.Permissions, grant.Permissions...)
+		}
+		document = effective
+	default:
+		return fmt.Errorf("unknown document %s", path)
+	}
+
+	data, err = json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// groupMap resolves groups from a fixed principal -> groups map
+type groupMap map[string][]string
+
+func (g groupMap) GroupsOf(principal string) ([]string, error) {
+	return g[principal], nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newOPATestEvaluator is a bucket in a project where the project grants the viewer role to
+// the example.com domain and the bucket grants the admin role to a group of alice
+func newOPATestEvaluator(cache CacheService) (*fakeRegoEngine, PermissionEvaluator, uuid.UUID, uuid.UUID) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	groups := groupMap{"user:alice@example.com": {"group:storage-admins@example.com"}}
+	engine := &fakeRegoEngine{}
+
+	evaluator := NewOPAEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache, engine,
+		WithGroupResolver(groups), WithPrincipalAttributeProvider(attributeMap{
+			"user:alice@example.com": {"department": "storage"},
+		}))
+
+	projectID, bucketID := uuid.New(), uuid.New()
+	viewer := testRole("roles/storage.viewer", "storage.objects.read")
+	admin := testRole("roles/storage.admin", "storage.objects.read", "storage.objects.delete")
+
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket", Name: "logs"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{{ID: projectID}}, nil)
+	policyRepo.On("GetByResourceID", bucketID).Return(&domain.Policy{ResourceID: bucketID, Bindings: []domain.Binding{
+		testBinding(&admin, "group:storage-admins@example.com"),
+	}}, nil)
+	projectBinding := testBinding(&viewer, "domain:Example.com")
+	projectBinding.Condition = &domain.Condition{Expression: `resource.type == "bucket"`}
+	policyRepo.On("GetByResourceID", projectID).Return(&domain.Policy{ResourceID: projectID, Bindings: []domain.Binding{
+		projectBinding,
+	}}, nil)
+
+	return engine, evaluator, projectID, bucketID
+}
+
+func TestOPAEvaluator_CheckPermission(t *testing.T) {
+	engine, evaluator, projectID, bucketID := newOPATestEvaluator(NewNoopCache())
+
+	allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", bucketID, "storage.objects.delete",
+		map[string]string{"ticket": "OPS-1"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, fmt.Sprintf("Permission granted via role 'roles/storage.admin' on resource '%s'", bucketID), reason)
+
+	require.Len(t, engine.inputs, 1)
+	input := engine.inputs[0]
+	assert.Equal(t, "user:alice@example.com", input.Principal)
+	assert.Equal(t, []string{"user:alice@example.com", "group:storage-admins@example.com", "domain:example.com",
+		"allUsers", "allAuthenticatedUsers"}, input.Identities)
+	assert.Equal(t, "bucket", input.Resource.Type)
+	require.Len(t, input.Hierarchy, 2)
+	assert.Equal(t, bucketID, input.Hierarchy[0].ResourceID)
+	assert.Equal(t, projectID, input.Hierarchy[1].ResourceID)
+	assert.Equal(t, []string{"domain:example.com"}, input.Hierarchy[1].Bindings[0].Members)
+	assert.Equal(t, `resource.type == "bucket"`, input.Hierarchy[1].Bindings[0].Condition)
+	assert.True(t, input.Hierarchy[1].Bindings[0].ConditionMet)
+	assert.Equal(t, "OPS-1", input.Variables["context"].(map[string]interface{})["ticket"])
+	assert.Equal(t, map[string]interface{}{"department": "storage"},
+		input.Variables["principal"].(map[string]interface{})["attributes"])
+
+	// Domain members grant through the project
+	allowed, reason, err = evaluator.CheckPermission("user:bob@example.com", bucketID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Contains(t, reason, projectID.String())
+
+	allowed, _, err = evaluator.CheckPermission("user:bob@example.com", bucketID, "storage.objects.delete", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// Test: Bindings whose condition does not hold grant nothing
+func TestOPAEvaluator_ConditionNotMet(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	engine := &fakeRegoEngine{}
+	evaluator := NewOPAEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache(), engine)
+
+	folderID := uuid.New()
+	viewer := testRole("roles/viewer", "docs.read")
+	binding := testBinding(&viewer, "user:alice@example.com")
+	binding.Condition = &domain.Condition{Expression: `context.ticket != ""`}
+	resourceRepo.On("GetByID", folderID).Return(&domain.Resource{ID: folderID, Type: "folder"}, nil)
+	resourceRepo.On("GetAncestors", folderID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", folderID).Return(&domain.Policy{ResourceID: folderID, Bindings: []domain.Binding{binding}}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", folderID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.False(t, engine.inputs[0].Hierarchy[0].Bindings[0].ConditionMet)
+
+	allowed, _, err = evaluator.CheckPermission("user:alice@example.com", folderID, "docs.read", map[string]string{"ticket": "OPS-1"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	permissions, roles, err := evaluator.GetEffectivePermissions("user:alice@example.com", folderID)
+	require.NoError(t, err)
+	assert.Empty(t, permissions)
+	assert.Empty(t, roles)
+}
+
+func TestOPAEvaluator_CheckPermission_Errors(t *testing.T) {
+	engine, evaluator, _, bucketID := newOPATestEvaluator(NewNoopCache())
+
+	engine.err = fmt.Errorf("connection refused")
+	allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", bucketID, "storage.objects.read", nil)
+	assert.Error(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, "Error evaluating policy", reason)
+
+	resourceRepo := new(MockResourceRepository)
+	missingID := uuid.New()
+	resourceRepo.On("GetByID", missingID).Return(nil, nil)
+	evaluator = NewOPAEvaluator(resourceRepo, new(MockPolicyRepository), new(MockPermissionRepository), NewNoopCache(), engine)
+	allowed, reason, err = evaluator.CheckPermission("user:alice@example.com", missingID, "storage.objects.read", nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, "Resource not found", reason)
+}
+
+func TestOPAEvaluator_TestPermissions(t *testing.T) {
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+	engine, evaluator, _, bucketID := newOPATestEvaluator(cache)
+
+	granted, err := evaluator.TestPermissions("user:bob@example.com", bucketID,
+		[]string{"storage.objects.delete", "storage.objects.read", "storage.objects.read"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.read"}, granted)
+
+	// Bob only reads through the project's conditional binding, so nothing is cached
+	granted, err = evaluator.TestPermissions("user:bob@example.com", bucketID,
+		[]string{"storage.objects.read", "storage.objects.delete"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.read"}, granted)
+	require.Len(t, engine.inputs, 2)
+	assert.Equal(t, []string{"storage.objects.read", "storage.objects.delete"}, engine.inputs[1].Permissions)
+
+	// Alice's unconditional grants are cached; only the rest is evaluated again
+	granted, err = evaluator.TestPermissions("user:alice@example.com", bucketID, []string{"storage.objects.delete"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.delete"}, granted)
+	granted, err = evaluator.TestPermissions("user:alice@example.com", bucketID,
+		[]string{"storage.objects.delete", "storage.buckets.create"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.delete"}, granted)
+	require.Len(t, engine.inputs, 4)
+	assert.Equal(t, []string{"storage.buckets.create"}, engine.inputs[3].Permissions)
+}
+
+func TestOPAEvaluator_GetEffectivePermissions(t *testing.T) {
+	_, evaluator, _, bucketID := newOPATestEvaluator(NewNoopCache())
+
+	permissions, roles, err := evaluator.GetEffectivePermissions("user:alice@example.com", bucketID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"roles/storage.admin", "roles/storage.viewer"}, roles)
+	assert.Contains(t, permissions, "storage.objects.delete")
+}
+
+func TestOPAEvaluator_BatchCheckPermissions(t *testing.T) {
+	_, evaluator, _, bucketID := newOPATestEvaluator(NewNoopCache())
+
+	results, err := evaluator.BatchCheckPermissions("user:bob@example.com", []PermissionCheck{
+		{ResourceID: bucketID, Permission: "storage.objects.read"},
+		{ResourceID: bucketID, Permission: "storage.objects.delete"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Allowed)
+	assert.False(t, results[1].Allowed)
+}
+
+func TestDefaultRegoPolicy(t *testing.T) {
+	assert.True(t, strings.HasPrefix(DefaultRegoPolicy, "#"))
+	assert.Contains(t, DefaultRegoPolicy, "package iam.authz")
+	for _, document := range []string{regoDecision, regoGranted, regoEffective} {
+		rule := document[strings.LastIndex(document, "/")+1:]
+		assert.Contains(t, DefaultRegoPolicy, "\n"+rule+" ", "missing rule %s", rule)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+var (
+	// ErrOperationQueueFull is returned when an operation is submitted while every worker is busy and the queue is full
+	ErrOperationQueueFull = errors.New("operation queue is full")
+	// ErrOperationsStopped is returned when an operation is submitted during shutdown
+	ErrOperationsStopped = errors.New("operation runner is stopped")
+	// ErrOperationsDisabled is returned by the operation APIs when no runner is configured
+	ErrOperationsDisabled = errors.New("long-running operations are not enabled")
+)
+
+// progressInterval limits how often an operation's progress is written to the database
+const progressInterval = time.Second
+
+// ProgressFunc reports that completed of total items have been processed
+type ProgressFunc func(completed, total int64)
+
+// OperationFunc performs the work of an operation. ctx is cancelled when the server
+// shuts down before the operation finishes. The result is stored as JSON.
+type OperationFunc func(ctx context.Context, progress ProgressFunc) (interface{}, error)
+
+type queuedOperation struct {
+	operation *domain.Operation
+	fn        OperationFunc
+}
+
+// OperationRunner executes long-running operations on a pool of background workers.
+// Every operation is persisted, so clients can poll its state, progress and result.
+type OperationRunner struct {
+	repo   repository.OperationRepository
+	logger *slog.Logger
+	queue  chan queuedOperation
+
+	ctx    context.Context // Cancelled when shutdown runs out of time
+	cancel context.CancelFunc
+
+	mu       sync.RWMutex
+	stopped  bool
+	stopping chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+}
+
+// NewOperationRunner creates an operation runner and starts its workers.
+// A nil logger uses slog.Default().
+func NewOperationRunner(cfg *config.OperationsConfig, repo repository.OperationRepository, logger *slog.Logger) *OperationRunner {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &OperationRunner{
+		repo:     repo,
+		logger:   logger,
+		queue:    make(chan queuedOperation, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+	}
+
+	r.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+// Submit records a new operation and queues fn for execution. target describes what the
+// operation acts on, e.g. a resource ID. The returned operation is in the pending state.
+func (r *OperationRunner) Submit(operationType, target string, fn OperationFunc) (*domain.Operation, error) {
+	// Hold the read lock while queueing so Stop cannot drain the queue concurrently
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.stopped {
+		return nil, ErrOperationsStopped
+	}
+
+	operation := &domain.Operation{
+		Type:   operationType,
+		State:  domain.OperationPending,
+		Target: target,
+	}
+	if err := r.repo.Create(operation); err != nil {
+		return nil, fmt.Errorf("failed to create operation: %w", err)
+	}
+
+	// The worker owns operation once queued; callers get a snapshot
+	submitted := *operation
+	select {
+	case r.queue <- queuedOperation{operation: operation, fn: fn}:
+		return &submitted, nil
+	default:
+		r.finish(operation, nil, ErrOperationQueueFull)
+		return nil, ErrOperationQueueFull
+	}
+}
+
+// Get returns an operation, or nil if it does not exist
+func (r *OperationRunner) Get(id uuid.UUID) (*domain.Operation, error) {
+	return r.repo.GetByID(id)
+}
+
+// List returns operations newest first, optionally filtered by type and state
+func (r *OperationRunner) List(operationType string, state domain.OperationState, pageSize, offset int) ([]domain.Operation, error) {
+	return r.repo.List(operationType, state, pageSize, offset)
+}
+
+// FailInterrupted marks operations left pending or running by a previous process as failed.
+// Call it on startup, before submitting new operations.
+func (r *OperationRunner) FailInterrupted() (int64, error) {
+	return r.repo.FailUnfinished("interrupted by server restart")
+}
+
+// Stop stops accepting operations and waits for running ones to finish. Once ctx expires
+// running operations are cancelled. Queued operations that never started are marked failed.
+func (r *OperationRunner) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		r.stopped = true
+		r.mu.Unlock()
+		close(r.stopping)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		err = ctx.Err()
+	}
+	r.cancel()
+
+	for {
+		select {
+		case queued := <-r.queue:
+			r.finish(queued.operation, nil, ErrOperationsStopped)
+		default:
+			return err
+		}
+	}
+}
+
+func (r *OperationRunner) work() {
+	defer r.workers.Done()
+	for {
+		select {
+		case <-r.stopping:
+			return
+		case queued := <-r.queue:
+			r.run(queued)
+		}
+	}
+}
+
+// run executes one operation and records its outcome
+func (r *OperationRunner) run(queued queuedOperation) {
+	operation := queued.operation
+	select {
+	case <-r.stopping:
+		r.finish(operation, nil, ErrOperationsStopped)
+		return
+	default:
+	}
+
+	operation.State = domain.OperationRunning
+	if err := r.repo.Update(operation); err != nil {
+		r.logger.Error("Failed to start operation", "operation", operation.ID, "error", err)
+	}
+
+	var mu sync.Mutex
+	var lastWrite time.Time
+	progress := func(completed, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		operation.Completed, operation.Total = completed, total
+		if time.Since(lastWrite) < progressInterval && completed < total {
+			return
+		}
+		lastWrite = time.Now()
+		if err := r.repo.UpdateProgress(operation.ID, completed, total); err != nil {
+			r.logger.Warn("Failed to record operation progress", "operation", operation.ID, "error", err)
+		}
+	}
+
+	result, err := r.execute(queued.fn, progress)
+
+	mu.Lock()
+	defer mu.Unlock()
+	r.finish(operation, result, err)
+}
+
+// execute calls fn, turning a panic into an error so one operation cannot stop a worker
+func (r *OperationRunner) execute(fn OperationFunc, progress ProgressFunc) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("operation panicked: %v", p)
+		}
+	}()
+	return fn(r.ctx, progress)
+}
+
+// finish records the final state of an operation
+func (r *OperationRunner) finish(operation *domain.Operation, result interface{}, err error) {
+	now := time.Now()
+	operation.FinishedAt = &now
+	operation.State = domain.OperationSucceeded
+	if err != nil {
+		operation.State = domain.OperationFailed
+		operation.Error = err.Error()
+	} else if result != nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			operation.State = domain.OperationFailed
+			operation.Error = fmt.Sprintf("failed to marshal result: %v", marshalErr)
+		} else {
+			operation.Result = data
+		}
+	}
+
+	if err := r.repo.Update(operation); err != nil {
+		r.logger.Error("Failed to record operation result", "operation", operation.ID, "state", operation.State, "error", err)
+		return
+	}
+	r.logger.Info("Operation finished",
+		"operation", operation.ID,
+		"type", operation.Type,
+		"state", operation.State,
+		"completed", operation.Completed)
+}
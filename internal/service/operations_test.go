@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memOperationRepository is an in-memory OperationRepository safe for concurrent use
+type memOperationRepository struct {
+	mu         sync.Mutex
+	operations map[uuid.UUID]domain.Operation
+}
+
+func newMemOperationRepository() *memOperationRepository {
+	return &memOperationRepository{operations: make(map[uuid.UUID]domain.Operation)}
+}
+
+func (r *memOperationRepository) Create(operation *domain.Operation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation.ID = uuid.New()
+	r.operations[operation.ID] = *operation
+	return nil
+}
+
+func (r *memOperationRepository) GetByID(id uuid.UUID) (*domain.Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation, ok := r.operations[id]
+	if !ok {
+		return nil, nil
+	}
+	return &operation, nil
+}
+
+func (r *memOperationRepository) Update(operation *domain.Operation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations[operation.ID] = *operation
+	return nil
+}
+
+func (r *memOperationRepository) UpdateProgress(id uuid.UUID, completed, total int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation := r.operations[id]
+	operation.Completed, operation.Total = completed, total
+	r.operations[id] = operation
+	return nil
+}
+
+func (r *memOperationRepository) List(operationType string, state domain.OperationState, limit, offset int) ([]domain.Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var operations []domain.Operation
+	for _, operation := range r.operations {
+		if (operationType == "" || operation.Type == operationType) && (state == "" || operation.State == state) {
+			operations = append(operations, operation)
+		}
+	}
+	return operations, nil
+}
+
+func (r *memOperationRepository) FailUnfinished(reason string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var failed int64
+	for id, operation := range r.operations {
+		if !operation.Done() {
+			operation.State = domain.OperationFailed
+			operation.Error = reason
+			r.operations[id] = operation
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// waitForOperation polls until the operation is done
+func waitForOperation(t *testing.T, runner *OperationRunner, id uuid.UUID) *domain.Operation {
+	t.Helper()
+	var operation *domain.Operation
+	require.Eventually(t, func() bool {
+		var err error
+		operation, err = runner.Get(id)
+		require.NoError(t, err)
+		return operation != nil && operation.Done()
+	}, 2*time.Second, 5*time.Millisecond)
+	return operation
+}
+
+func TestOperationRunner_Succeeds(t *testing.T) {
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 10}, newMemOperationRepository(), nil)
+	defer runner.Stop(context.Background())
+
+	operation, err := runner.Submit("Import", "bindings.csv", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		for i := int64(1); i <= 3; i++ {
+			progress(i, 3)
+		}
+		return map[string]int{"imported": 3}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.OperationPending, operation.State)
+
+	done := waitForOperation(t, runner, operation.ID)
+	assert.Equal(t, domain.OperationSucceeded, done.State)
+	assert.Equal(t, "bindings.csv", done.Target)
+	assert.Equal(t, int64(3), done.Completed)
+	assert.Equal(t, int64(3), done.Total)
+	assert.JSONEq(t, `{"imported":3}`, string(done.Result))
+	assert.NotNil(t, done.FinishedAt)
+}
+
+func TestOperationRunner_Fails(t *testing.T) {
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 10}, newMemOperationRepository(), nil)
+	defer runner.Stop(context.Background())
+
+	failing, err := runner.Submit("Import", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return nil, errors.New("invalid row 7")
+	})
+	require.NoError(t, err)
+	panicking, err := runner.Submit("Import", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		panic("boom")
+	})
+	require.NoError(t, err)
+
+	done := waitForOperation(t, runner, failing.ID)
+	assert.Equal(t, domain.OperationFailed, done.State)
+	assert.Equal(t, "invalid row 7", done.Error)
+
+	done = waitForOperation(t, runner, panicking.ID)
+	assert.Equal(t, domain.OperationFailed, done.State)
+	assert.Contains(t, done.Error, "boom")
+}
+
+func TestOperationRunner_QueueFull(t *testing.T) {
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 1}, newMemOperationRepository(), nil)
+	defer runner.Stop(context.Background())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	_, err := runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	require.NoError(t, err)
+	<-started
+	defer close(release)
+
+	// One waits in the queue, the next is rejected
+	_, err = runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) { return nil, nil })
+	require.NoError(t, err)
+	_, err = runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) { return nil, nil })
+	assert.ErrorIs(t, err, ErrOperationQueueFull)
+
+	failed, err := runner.List("Slow", domain.OperationFailed, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, ErrOperationQueueFull.Error(), failed[0].Error)
+}
+
+func TestOperationRunner_Stop(t *testing.T) {
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 10}, newMemOperationRepository(), nil)
+
+	started := make(chan struct{})
+	running, err := runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+	<-started
+	queued, err := runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) { return nil, nil })
+	require.NoError(t, err)
+
+	// The running operation ignores shutdown until its context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, runner.Stop(ctx), context.DeadlineExceeded)
+
+	operation, err := runner.Get(running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OperationFailed, operation.State)
+	assert.Equal(t, context.Canceled.Error(), operation.Error)
+
+	operation, err = runner.Get(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OperationFailed, operation.State)
+	assert.Equal(t, ErrOperationsStopped.Error(), operation.Error)
+
+	_, err = runner.Submit("Slow", "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) { return nil, nil })
+	assert.ErrorIs(t, err, ErrOperationsStopped)
+}
+
+func TestOperationRunner_FailInterrupted(t *testing.T) {
+	repo := newMemOperationRepository()
+	require.NoError(t, repo.Create(&domain.Operation{Type: "Import", State: domain.OperationRunning}))
+	require.NoError(t, repo.Create(&domain.Operation{Type: "Import", State: domain.OperationSucceeded}))
+
+	runner := NewOperationRunner(&config.OperationsConfig{}, repo, nil)
+	defer runner.Stop(context.Background())
+
+	failed, err := runner.FailInterrupted()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), failed)
+}
+
+func TestIAMService_DeleteResourceTree(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	_, err := service.DeleteResourceTree(uuid.New())
+	assert.ErrorIs(t, err, ErrOperationsDisabled)
+
+	runner := NewOperationRunner(&config.OperationsConfig{Workers: 1, QueueSize: 10}, newMemOperationRepository(), nil)
+	defer runner.Stop(context.Background())
+	service.SetOperationRunner(runner)
+
+	// org -> folder -> project
+	orgID, folderID, projectID := uuid.New(), uuid.New(), uuid.New()
+	folderPath := domain.ResourcePath(domain.ResourcePath("", orgID), folderID)
+	resourceRepo.On("GetByID", orgID).Return(&domain.Resource{ID: orgID}, nil)
+	resourceRepo.On("GetDescendants", orgID).Return([]domain.Resource{
+		{ID: folderID, Path: folderPath},
+		{ID: projectID, Path: domain.ResourcePath(folderPath, projectID)},
+	}, nil)
+
+	var mu sync.Mutex
+	var deleted []uuid.UUID
+	resourceRepo.On("Delete", mock.AnythingOfType("uuid.UUID")).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, args.Get(0).(uuid.UUID))
+	}).Return(nil)
+
+	operation, err := service.DeleteResourceTree(orgID)
+	require.NoError(t, err)
+	assert.Equal(t, OperationDeleteResourceTree, operation.Type)
+
+	done := waitForOperation(t, runner, operation.ID)
+	assert.Equal(t, domain.OperationSucceeded, done.State)
+	assert.JSONEq(t, `{"deleted":3}`, string(done.Result))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []uuid.UUID{projectID, folderID, orgID}, deleted)
+
+	got, err := service.GetOperation(operation.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OperationSucceeded, got.State)
+}
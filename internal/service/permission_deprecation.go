@@ -0,0 +1,290 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// DeprecatePermission flags a permission as deprecated. Roles keep granting it, so checks still
+// succeed, but they are counted and logged by a DeprecationTracker until the roles are migrated.
+// replacementName optionally names the permission to grant instead.
+func (s *IAMService) DeprecatePermission(id uuid.UUID, replacementName string) (*domain.Permission, error) {
+	if err := s.authorize("DeprecatePermission", nil); err != nil {
+		return nil, err
+	}
+
+	permission, err := s.permissionRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if permission == nil {
+		return nil, fmt.Errorf("permission not found")
+	}
+
+	if replacementName != "" {
+		if replacementName == permission.Name {
+			return nil, fmt.Errorf("a permission cannot replace itself")
+		}
+		replacement, err := s.permissionRepo.GetByName(replacementName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replacement permission: %w", err)
+		}
+		if replacement == nil {
+			return nil, fmt.Errorf("replacement permission %q not found", replacementName)
+		}
+		if replacement.Deprecated {
+			return nil, fmt.Errorf("replacement permission %q is deprecated", replacementName)
+		}
+	}
+
+	if err := s.permissionRepo.SetDeprecated(id, true, replacementName); err != nil {
+		return nil, fmt.Errorf("failed to deprecate permission: %w", err)
+	}
+	permission.Deprecated = true
+	permission.ReplacementName = replacementName
+	return permission, nil
+}
+
+// UndeprecatePermission clears the deprecation of a permission and its replacement
+func (s *IAMService) UndeprecatePermission(id uuid.UUID) (*domain.Permission, error) {
+	if err := s.authorize("UndeprecatePermission", nil); err != nil {
+		return nil, err
+	}
+
+	permission, err := s.permissionRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if permission == nil {
+		return nil, fmt.Errorf("permission not found")
+	}
+
+	if err := s.permissionRepo.SetDeprecated(id, false, ""); err != nil {
+		return nil, fmt.Errorf("failed to undeprecate permission: %w", err)
+	}
+	permission.Deprecated = false
+	permission.ReplacementName = ""
+	return permission, nil
+}
+
+// DeprecatedPermissionRole is a role that still grants deprecated permissions
+type DeprecatedPermissionRole struct {
+	Role       domain.Role
+	Deprecated []domain.Permission // The deprecated permissions it grants, with their replacements
+}
+
+// ListRolesWithDeprecatedPermissions lists the roles granting deprecated permissions, by name,
+// to track the migration of roles to the replacements
+func (s *IAMService) ListRolesWithDeprecatedPermissions(pageSize, offset int) ([]DeprecatedPermissionRole, error) {
+	if err := s.authorize("ListRolesWithDeprecatedPermissions", nil); err != nil {
+		return nil, err
+	}
+
+	if pageSize < 0 || offset < 0 {
+		return nil, fmt.Errorf("page size and offset must not be negative")
+	}
+
+	roles, err := s.roleRepo.ListWithDeprecatedPermissions(pageSize, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	result := make([]DeprecatedPermissionRole, len(roles))
+	for i := range roles {
+		result[i].Role = roles[i]
+		for _, permission := range roles[i].Permissions {
+			if permission.Deprecated {
+				result[i].Deprecated = append(result[i].Deprecated, permission)
+			}
+		}
+		sort.Slice(result[i].Deprecated, func(a, b int) bool {
+			return result[i].Deprecated[a].Name < result[i].Deprecated[b].Name
+		})
+	}
+	return result, nil
+}
+
+// DefaultDeprecationRefresh is how often a DeprecationTracker reloads the deprecated permissions
+// and, at most, how often it logs a warning per permission
+const DefaultDeprecationRefresh = time.Minute
+
+// DeprecationTracker counts checks of deprecated permissions and logs a warning for each such
+// permission at most once per refresh interval
+type DeprecationTracker struct {
+	permissions repository.PermissionRepository
+	refresh     time.Duration
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu         sync.Mutex
+	deprecated map[string]string // Name of each deprecated permission to its replacement
+	loadedAt   time.Time
+	loading    bool
+	counts     map[string]int64
+	warnedAt   map[string]time.Time
+	unwarned   map[string]int64 // Checks since the last warning
+}
+
+// NewDeprecationTracker creates a tracker reading the deprecated permissions from permissions
+// every refresh interval (DefaultDeprecationRefresh if zero); a nil logger uses slog.Default().
+func NewDeprecationTracker(permissions repository.PermissionRepository, refresh time.Duration, logger *slog.Logger) *DeprecationTracker {
+	if refresh <= 0 {
+		refresh = DefaultDeprecationRefresh
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &DeprecationTracker{
+		permissions: permissions,
+		refresh:     refresh,
+		logger:      logger,
+		now:         time.Now,
+		counts:      make(map[string]int64),
+		warnedAt:    make(map[string]time.Time),
+		unwarned:    make(map[string]int64),
+	}
+}
+
+// Observe records a check of permission by principal, if the permission is deprecated
+func (t *DeprecationTracker) Observe(principal, permission string) {
+	t.reloadIfStale()
+
+	t.mu.Lock()
+	replacement, deprecated := t.deprecated[permission]
+	if !deprecated {
+		t.mu.Unlock()
+		return
+	}
+	now := t.now()
+	t.counts[permission]++
+	t.unwarned[permission]++
+	if now.Sub(t.warnedAt[permission]) < t.refresh {
+		t.mu.Unlock()
+		return
+	}
+	checks := t.unwarned[permission]
+	t.warnedAt[permission] = now
+	t.unwarned[permission] = 0
+	t.mu.Unlock()
+
+	t.logger.Warn("Deprecated permission checked",
+		"permission", permission,
+		"replacement", replacement,
+		"principal", principal,
+		"checks", checks)
+}
+
+// Counts returns the number of checks of each deprecated permission since the tracker started
+func (t *DeprecationTracker) Counts() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int64, len(t.counts))
+	for permission, count := range t.counts {
+		counts[permission] = count
+	}
+	return counts
+}
+
+// reloadIfStale reloads the deprecated permissions when they are older than the refresh interval.
+// One caller reloads while the others keep using the previous set.
+func (t *DeprecationTracker) reloadIfStale() {
+	t.mu.Lock()
+	if t.loading || (t.deprecated != nil && t.now().Sub(t.loadedAt) < t.refresh) {
+		t.mu.Unlock()
+		return
+	}
+	t.loading = true
+	t.mu.Unlock()
+
+	permissions, err := t.permissions.ListDeprecated()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loading = false
+	t.loadedAt = t.now()
+	if err != nil {
+		// Retry after the refresh interval rather than on every check
+		t.logger.Error("Failed to load deprecated permissions", "error", err)
+		if t.deprecated == nil {
+			t.deprecated = map[string]string{}
+		}
+		return
+	}
+	t.deprecated = make(map[string]string, len(permissions))
+	for _, permission := range permissions {
+		t.deprecated[permission.Name] = permission.ReplacementName
+	}
+}
+
+// deprecationEvaluator reports checks of deprecated permissions to a DeprecationTracker
+type deprecationEvaluator struct {
+	PermissionEvaluator
+	tracker *DeprecationTracker
+}
+
+// NewDeprecationEvaluator wraps evaluator so checks of deprecated permissions are counted and
+// logged by tracker. The checks themselves are unchanged.
+func NewDeprecationEvaluator(evaluator PermissionEvaluator, tracker *DeprecationTracker) PermissionEvaluator {
+	return &deprecationEvaluator{
+		PermissionEvaluator: evaluator,
+		tracker:             tracker,
+	}
+}
+
+func (de *deprecationEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	de.tracker.Observe(principal, permission)
+	return de.PermissionEvaluator.CheckPermission(principal, resourceID, permission, context)
+}
+
+func (de *deprecationEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	de.tracker.Observe(principal, permission)
+	return de.PermissionEvaluator.Check(principal, resourceID, permission, context)
+}
+
+func (de *deprecationEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	for _, check := range checks {
+		de.tracker.Observe(principal, check.Permission)
+	}
+	return de.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+}
+
+func (de *deprecationEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	for _, principal := range principals {
+		de.tracker.Observe(principal, permission)
+	}
+	return de.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+}
+
+func (de *deprecationEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	for _, permission := range permissions {
+		de.tracker.Observe(principal, permission)
+	}
+	return de.PermissionEvaluator.TestPermissions(principal, resourceID, permissions, context)
+}
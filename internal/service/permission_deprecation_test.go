@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_DeprecatePermission(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	id := uuid.New()
+	permissionRepo.On("GetByID", id).Return(&domain.Permission{ID: id, Name: "storage.buckets.getIamPolicy"}, nil)
+	permissionRepo.On("GetByName", "storage.buckets.getPolicy").Return(&domain.Permission{Name: "storage.buckets.getPolicy"}, nil)
+	permissionRepo.On("SetDeprecated", id, true, "storage.buckets.getPolicy").Return(nil)
+
+	permission, err := service.DeprecatePermission(id, "storage.buckets.getPolicy")
+
+	require.NoError(t, err)
+	assert.True(t, permission.Deprecated)
+	assert.Equal(t, "storage.buckets.getPolicy", permission.ReplacementName)
+	permissionRepo.AssertExpectations(t)
+}
+
+func TestIAMService_DeprecatePermission_InvalidReplacement(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	id := uuid.New()
+	permissionRepo.On("GetByID", id).Return(&domain.Permission{ID: id, Name: "storage.buckets.get"}, nil)
+	permissionRepo.On("GetByName", "storage.buckets.missing").Return(nil, nil)
+	permissionRepo.On("GetByName", "storage.buckets.old").Return(&domain.Permission{Name: "storage.buckets.old", Deprecated: true}, nil)
+
+	_, err := service.DeprecatePermission(id, "storage.buckets.get")
+	assert.ErrorContains(t, err, "cannot replace itself")
+
+	_, err = service.DeprecatePermission(id, "storage.buckets.missing")
+	assert.ErrorContains(t, err, "not found")
+
+	_, err = service.DeprecatePermission(id, "storage.buckets.old")
+	assert.ErrorContains(t, err, "is deprecated")
+
+	permissionRepo.AssertNotCalled(t, "SetDeprecated")
+}
+
+func TestIAMService_DeprecatePermission_NotFound(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	id := uuid.New()
+	permissionRepo.On("GetByID", id).Return(nil, nil)
+
+	_, err := service.DeprecatePermission(id, "")
+	assert.ErrorContains(t, err, "permission not found")
+}
+
+func TestIAMService_UndeprecatePermission(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	id := uuid.New()
+	permissionRepo.On("GetByID", id).Return(&domain.Permission{ID: id, Name: "storage.buckets.get", Deprecated: true, ReplacementName: "storage.buckets.read"}, nil)
+	permissionRepo.On("SetDeprecated", id, false, "").Return(nil)
+
+	permission, err := service.UndeprecatePermission(id)
+
+	require.NoError(t, err)
+	assert.False(t, permission.Deprecated)
+	assert.Empty(t, permission.ReplacementName)
+}
+
+func TestIAMService_ListRolesWithDeprecatedPermissions(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	role := domain.Role{
+		ID:   uuid.New(),
+		Name: "roles/storage.viewer",
+		Permissions: []domain.Permission{
+			{Name: "storage.objects.list", Deprecated: true},
+			{Name: "storage.buckets.get"},
+			{Name: "storage.buckets.list", Deprecated: true, ReplacementName: "storage.buckets.search"},
+		},
+	}
+	roleRepo.On("ListWithDeprecatedPermissions", 10, 0).Return([]domain.Role{role}, nil)
+
+	roles, err := service.ListRolesWithDeprecatedPermissions(10, 0)
+
+	require.NoError(t, err)
+	require.Len(t, roles, 1)
+	assert.Equal(t, role.ID, roles[0].Role.ID)
+	require.Len(t, roles[0].Deprecated, 2)
+	assert.Equal(t, "storage.buckets.list", roles[0].Deprecated[0].Name)
+	assert.Equal(t, "storage.buckets.search", roles[0].Deprecated[0].ReplacementName)
+	assert.Equal(t, "storage.objects.list", roles[0].Deprecated[1].Name)
+
+	_, err = service.ListRolesWithDeprecatedPermissions(-1, 0)
+	assert.Error(t, err)
+}
+
+func TestDeprecationTracker_Observe(t *testing.T) {
+	permissionRepo := new(MockPermissionRepository)
+	permissionRepo.On("ListDeprecated").Return([]domain.Permission{
+		{Name: "storage.buckets.getIamPolicy", Deprecated: true, ReplacementName: "storage.buckets.getPolicy"},
+	}, nil).Once()
+
+	var logs bytes.Buffer
+	tracker := NewDeprecationTracker(permissionRepo, time.Minute, slog.New(slog.NewTextHandler(&logs, nil)))
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	tracker.Observe("user:alice@example.com", "storage.buckets.getIamPolicy")
+	tracker.Observe("user:bob@example.com", "storage.buckets.getIamPolicy")
+	tracker.Observe("user:alice@example.com", "storage.buckets.get")
+
+	assert.Equal(t, map[string]int64{"storage.buckets.getIamPolicy": 2}, tracker.Counts())
+	assert.Equal(t, 1, bytes.Count(logs.Bytes(), []byte("Deprecated permission checked")), "warnings are rate limited")
+	assert.Contains(t, logs.String(), "replacement=storage.buckets.getPolicy")
+	permissionRepo.AssertNumberOfCalls(t, "ListDeprecated", 1)
+}
+
+func TestDeprecationTracker_Reloads(t *testing.T) {
+	permissionRepo := new(MockPermissionRepository)
+	permissionRepo.On("ListDeprecated").Return(nil, errors.New("connection refused")).Once()
+	permissionRepo.On("ListDeprecated").Return([]domain.Permission{{Name: "storage.buckets.get", Deprecated: true}}, nil).Once()
+
+	tracker := NewDeprecationTracker(permissionRepo, time.Minute, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	tracker.Observe("user:alice@example.com", "storage.buckets.get")
+	tracker.Observe("user:alice@example.com", "storage.buckets.get") // Failed load is not retried yet
+	assert.Empty(t, tracker.Counts())
+
+	now = now.Add(time.Minute)
+	tracker.Observe("user:alice@example.com", "storage.buckets.get")
+	assert.Equal(t, map[string]int64{"storage.buckets.get": 1}, tracker.Counts())
+	permissionRepo.AssertNumberOfCalls(t, "ListDeprecated", 2)
+}
+
+func TestDeprecationEvaluator_ObservesChecks(t *testing.T) {
+	permissionRepo := new(MockPermissionRepository)
+	permissionRepo.On("ListDeprecated").Return([]domain.Permission{{Name: "storage.buckets.get", Deprecated: true}}, nil)
+	tracker := NewDeprecationTracker(permissionRepo, time.Minute, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	inner := new(MockPermissionEvaluator)
+	evaluator := NewDeprecationEvaluator(inner, tracker)
+	resourceID := uuid.New()
+
+	inner.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).
+		Return(true, "granted", nil)
+	inner.On("TestPermissions", "user:alice@example.com", resourceID, []string{"storage.buckets.get", "storage.buckets.list"}, map[string]string(nil)).
+		Return([]string{"storage.buckets.get"}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed, "deprecated permissions are still granted")
+
+	_, err = evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"storage.buckets.get", "storage.buckets.list"}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int64{"storage.buckets.get": 2}, tracker.Counts())
+}
@@ -2,16 +2,58 @@ package service
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/domain"
 	"github.com/pguia/iam/internal/repository"
+	"golang.org/x/sync/singleflight"
 )
 
 // PermissionEvaluator evaluates permission checks
 type PermissionEvaluator interface {
 	CheckPermission(principal string, resourceID uuid.UUID, permission string, context map[string]string) (bool, string, error)
+	// Check is CheckPermission with the role that granted an allowed check
+	Check(principal string, resourceID uuid.UUID, permission string, context map[string]string) (CheckResult, error)
+	TestPermissions(principal string, resourceID uuid.UUID, permissions []string, context map[string]string) ([]string, error)
 	GetEffectivePermissions(principal string, resourceID uuid.UUID) ([]string, []string, error)
+	BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error)
+	// CheckPermissionForPrincipals checks one permission of several principals on a resource,
+	// returning one result per principal in order
+	CheckPermissionForPrincipals(principals []string, resourceID uuid.UUID, permission string, context map[string]string) ([]CheckResult, error)
+	// GrantingMembers returns the members whose bindings grant to the principal: the principal,
+	// its linked identities, their groups and the domains of users
+	GrantingMembers(principal string) ([]string, error)
+}
+
+// PermissionCheck is one check of a batch
+type PermissionCheck struct {
+	ResourceID uuid.UUID
+	Permission string
+	Context    map[string]string
+}
+
+// CheckResult is the decision of one check
+type CheckResult struct {
+	Allowed bool
+	Reason  string
+	Role    string // Name of the role that granted an allowed check; empty when unknown
+}
+
+// checkPermissionResult adapts the result of Check to CheckPermission
+func checkPermissionResult(result CheckResult, err error) (bool, string, error) {
+	return result.Allowed, result.Reason, err
+}
+
+// cachedGrant looks up an allowed check in the cache, which holds the name of the granting
+// role ("" when unknown)
+func cachedGrant(cache CacheService, key string) (string, bool) {
+	cached, found := cache.Get(key)
+	if !found {
+		return "", false
+	}
+	role, ok := cached.(string)
+	return role, ok
 }
 
 type permissionEvaluator struct {
@@ -19,6 +61,83 @@ type permissionEvaluator struct {
 	policyRepo     repository.PolicyRepository
 	permissionRepo repository.PermissionRepository
 	cache          CacheService
+	aliases        AliasResolver
+	groups         []GroupResolver
+	attributes     []PrincipalAttributeProvider
+	grants         repository.EvaluationGrantRepository
+	loads          singleflight.Group // Resource, hierarchy and policy loads in flight, see sharedLoad
+
+	// Repositories of fully consistent checks; resourceRepo and policyRepo without WithPrimaryReads
+	primaryResources repository.ResourceRepository
+	primaryPolicies  repository.PolicyRepository
+}
+
+// GroupResolver resolves the groups a principal belongs to
+type GroupResolver interface {
+	// GroupsOf returns the group principals (e.g. "group:engineering") of principal
+	GroupsOf(principal string) ([]string, error)
+}
+
+// AliasResolver resolves the identities linked to a principal, e.g. its address before an email
+// domain migration
+type AliasResolver interface {
+	// AliasesOf returns the identities linked to principal, excluding principal itself
+	AliasesOf(principal string) ([]string, error)
+}
+
+// PrincipalAttributeProvider supplies attributes of principals (e.g. department, clearance)
+// to binding conditions as principal.attributes
+type PrincipalAttributeProvider interface {
+	// AttributesOf returns the attributes of principal; unknown principals have none
+	AttributesOf(principal string) (map[string]string, error)
+}
+
+// EvaluatorOption configures optional permission evaluator behaviour
+type EvaluatorOption func(*permissionEvaluator)
+
+// WithGroupResolver makes bindings granted to a group apply to the group's members.
+// It may be given several times; a principal belongs to the groups of every resolver.
+func WithGroupResolver(groups GroupResolver) EvaluatorOption {
+	return func(pe *permissionEvaluator) {
+		pe.groups = append(pe.groups, groups)
+	}
+}
+
+// WithAliasResolver makes bindings granted to any identity linked to a principal apply to it,
+// together with the groups of the linked identities
+func WithAliasResolver(aliases AliasResolver) EvaluatorOption {
+	return func(pe *permissionEvaluator) {
+		pe.aliases = aliases
+	}
+}
+
+// WithPrincipalAttributeProvider makes the provider's attributes available to conditions. It may
+// be given several times; later providers override attributes of earlier ones, and all of them
+// override attributes supplied in the CheckPermission context. Attributes are only fetched for
+// checks reaching a conditional binding.
+func WithPrincipalAttributeProvider(provider PrincipalAttributeProvider) EvaluatorOption {
+	return func(pe *permissionEvaluator) {
+		pe.attributes = append(pe.attributes, provider)
+	}
+}
+
+// WithEvaluationGrants answers CheckPermission and BatchCheckPermissions from the evaluation read
+// model, with one indexed lookup over the whole hierarchy instead of loading the policy of every
+// ancestor. TestPermissions and GetEffectivePermissions still read policies.
+func WithEvaluationGrants(grants repository.EvaluationGrantRepository) EvaluatorOption {
+	return func(pe *permissionEvaluator) {
+		pe.grants = grants
+	}
+}
+
+// WithPrimaryReads makes fully consistent checks (ConsistencyFullyConsistent) read resources and
+// policies through resources and policies, the repositories of the primary database when the
+// evaluator's own read from a replica
+func WithPrimaryReads(resources repository.ResourceRepository, policies repository.PolicyRepository) EvaluatorOption {
+	return func(pe *permissionEvaluator) {
+		pe.primaryResources = resources
+		pe.primaryPolicies = policies
+	}
 }
 
 // NewPermissionEvaluator creates a new permission evaluator
@@ -27,13 +146,81 @@ func NewPermissionEvaluator(
 	policyRepo repository.PolicyRepository,
 	permissionRepo repository.PermissionRepository,
 	cache CacheService,
+	opts ...EvaluatorOption,
 ) PermissionEvaluator {
-	return &permissionEvaluator{
+	pe := &permissionEvaluator{
 		resourceRepo:   resourceRepo,
 		policyRepo:     policyRepo,
 		permissionRepo: permissionRepo,
 		cache:          cache,
 	}
+	for _, opt := range opts {
+		opt(pe)
+	}
+	return pe
+}
+
+// identities returns the principal and its linked identities, followed by the groups they
+// belong to
+func (pe *permissionEvaluator) identities(principal string) ([]string, error) {
+	identities := []string{principal}
+	if pe.aliases != nil {
+		aliases, err := pe.aliases.AliasesOf(principal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve aliases: %w", err)
+		}
+		identities = append(identities, aliases...)
+	}
+
+	linked := len(identities)
+	for _, resolver := range pe.groups {
+		for _, identity := range identities[:linked] {
+			groups, err := resolver.GroupsOf(identity)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve groups: %w", err)
+			}
+			identities = append(identities, groups...)
+		}
+	}
+	return identities, nil
+}
+
+// GrantingMembers returns the principal's identities, each followed by its domain for users, and
+// the public members
+func (pe *permissionEvaluator) GrantingMembers(principal string) ([]string, error) {
+	identities, err := pe.identities(principal)
+	if err != nil {
+		return nil, err
+	}
+	return grantingMembers(identities), nil
+}
+
+// grantingMembers adds the domain of each user to identities, as users are granted what their
+// domain is granted, and allUsers and allAuthenticatedUsers, which grant to every principal
+func grantingMembers(identities []string) []string {
+	members := make([]string, 0, 2*len(identities)+2)
+	for _, identity := range identities {
+		members = append(members, identity)
+		if domainMember := domain.DomainPrincipal(identity); domainMember != "" {
+			members = append(members, domainMember)
+		}
+	}
+	return append(members, domain.MemberAllUsers, domain.MemberAllAuthenticatedUsers)
+}
+
+// principalAttributes merges the attributes of every provider
+func (pe *permissionEvaluator) principalAttributes(principal string) (map[string]string, error) {
+	merged := make(map[string]string)
+	for _, provider := range pe.attributes {
+		attributes, err := provider.AttributesOf(principal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch principal attributes: %w", err)
+		}
+		for name, value := range attributes {
+			merged[name] = value
+		}
+	}
+	return merged, nil
 }
 
 // CheckPermission checks if a principal has a specific permission on a resource
@@ -43,108 +230,346 @@ func (pe *permissionEvaluator) CheckPermission(
 	permission string,
 	context map[string]string,
 ) (bool, string, error) {
+	return checkPermissionResult(pe.Check(principal, resourceID, permission, context))
+}
+
+// Check checks if a principal has a specific permission on a resource
+func (pe *permissionEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	ev := pe.newEvaluation()
+	if fullyConsistent(context) {
+		ev = pe.newConsistentEvaluation()
+	}
+	return ev.checkPermission(principal, resourceID, permission, context)
+}
+
+// BatchCheckPermissions runs several checks of one principal. Resources, ancestors, policies,
+// groups and roles shared between the checks are loaded and parsed once for the whole batch.
+func (pe *permissionEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	ev := pe.newEvaluation()
+	results := make([]CheckResult, len(checks))
+	for i, check := range checks {
+		result, err := ev.checkPermission(principal, check.ResourceID, check.Permission, check.Context)
+		if err != nil {
+			return nil, fmt.Errorf("check %d: %s: %w", i, result.Reason, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// CheckPermissionForPrincipals checks one permission of several principals on a resource. The
+// resource, its ancestors, their policies and roles are loaded and parsed once for all principals.
+func (pe *permissionEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	ev := pe.newEvaluation()
+	if fullyConsistent(context) {
+		ev = pe.newConsistentEvaluation()
+	}
+	results := make([]CheckResult, len(principals))
+	for i, principal := range principals {
+		result, err := ev.checkPermission(principal, resourceID, permission, context)
+		if err != nil {
+			return nil, fmt.Errorf("check of %s: %s: %w", principal, result.Reason, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+func (ev *evaluation) checkPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	pe := ev.pe
+
 	// Check cache first
 	cacheKey := GenerateCacheKey(principal, resourceID.String(), permission)
-	if cached, found := pe.cache.Get(cacheKey); found {
-		result := cached.(bool)
-		if result {
-			return true, "Permission granted (cached)", nil
-		}
+	if role, found := cachedGrant(pe.cache, cacheKey); found && !ev.consistent {
+		return CheckResult{Allowed: true, Reason: "Permission granted (cached)", Role: role}, nil
 	}
 
 	// Get the resource
-	resource, err := pe.resourceRepo.GetByID(resourceID)
+	resource, err := ev.resource(resourceID)
 	if err != nil {
-		return false, "Error fetching resource", err
+		return CheckResult{Reason: "Error fetching resource"}, err
 	}
 	if resource == nil {
-		return false, "Resource not found", nil
+		return CheckResult{Reason: "Resource not found"}, nil
 	}
 
 	// Check permission on this resource and all ancestors (hierarchical inheritance)
-	resources := []uuid.UUID{resourceID}
+	resources, err := ev.hierarchy(resourceID)
+	if err != nil {
+		return CheckResult{Reason: "Error fetching resource ancestors"}, err
+	}
+
+	// Build the typed condition context once for the whole hierarchy
+	condCtx := NewConditionContext(principal, resource, context)
 
-	// Get ancestors
-	ancestors, err := pe.resourceRepo.GetAncestors(resourceID)
+	identities, err := ev.identity(principal)
 	if err != nil {
-		return false, "Error fetching resource ancestors", err
+		return CheckResult{Reason: "Error resolving groups"}, err
+	}
+	// Decisions relying on the groups of a token are not cached for the principal
+	tokenGroups := tokenGroupsOf(context)
+	if len(tokenGroups) > 0 {
+		identities = append(identities[:len(identities):len(identities)], tokenGroups...)
 	}
-	for _, ancestor := range ancestors {
-		resources = append(resources, ancestor.ID)
+
+	// The read model checks the whole hierarchy at once
+	if pe.grants != nil && !ev.consistent {
+		result, conditional, err := ev.checkGrants(identities, resources, permission, condCtx)
+		if err == nil && result.Allowed && !conditional && len(tokenGroups) == 0 {
+			pe.cache.Set(cacheKey, result.Role)
+		}
+		return result, err
 	}
 
 	// Check each resource in the hierarchy
+	if err := ev.loadPolicies(resources); err != nil {
+		return CheckResult{Reason: "Error fetching policy"}, err
+	}
 	for _, resID := range resources {
-		allowed, reason, err := pe.checkResourcePermission(principal, resID, permission, context)
+		result, conditional, err := ev.checkResourcePermission(identities, resID, permission, condCtx)
 		if err != nil {
-			return false, reason, err
+			return result, err
 		}
-		if allowed {
-			// Cache the positive result
-			pe.cache.Set(cacheKey, true)
-			return true, reason, nil
+		if result.Allowed {
+			// Cache the positive result with its role. The cache key ignores the request, so
+			// grants depending on a condition are evaluated by every check.
+			if !conditional && len(tokenGroups) == 0 {
+				pe.cache.Set(cacheKey, result.Role)
+			}
+			return result, nil
 		}
 	}
 
-	return false, "Permission denied: no matching policy found", nil
+	if ev.consistent && len(tokenGroups) == 0 {
+		// Later checks must not be granted by a grant the fully consistent check revoked
+		pe.cache.Delete(cacheKey)
+	}
+	return CheckResult{Reason: "Permission denied: no matching policy found"}, nil
 }
 
-// checkResourcePermission checks permission on a specific resource (no hierarchy)
-func (pe *permissionEvaluator) checkResourcePermission(
-	principal string,
+// checkResourcePermission checks permission on a specific resource (no hierarchy). It reports
+// whether an allow came from a binding with a condition.
+func (ev *evaluation) checkResourcePermission(
+	identities []string,
 	resourceID uuid.UUID,
 	permission string,
-	context map[string]string,
-) (bool, string, error) {
+	condCtx *ConditionContext,
+) (CheckResult, bool, error) {
 	// Get policy for this resource
-	policy, err := pe.policyRepo.GetByResourceID(resourceID)
+	policy, err := ev.policy(resourceID)
 	if err != nil {
-		return false, "Error fetching policy", err
+		return CheckResult{Reason: "Error fetching policy"}, false, err
 	}
 	if policy == nil {
-		return false, "No policy found for resource", nil
+		return CheckResult{Reason: "No policy found for resource"}, false, nil
 	}
 
 	// Check each binding in the policy
-	for _, binding := range policy.Bindings {
-		// Check if principal is in members
-		if !binding.HasMember(principal) {
+	for i := range policy.Bindings {
+		binding := &policy.Bindings[i]
+
+		// Check if the principal or one of its groups is in members
+		granted, err := ev.grantsTo(binding, identities)
+		if err != nil {
+			return CheckResult{Reason: "Error reading binding members"}, false, err
+		}
+		if !granted {
 			continue
 		}
 
 		// Check if binding has a condition
 		if binding.Condition != nil {
-			// Evaluate condition (simplified - in production use CEL)
-			allowed := pe.evaluateCondition(binding.Condition, context)
-			if !allowed {
+			// Evaluate the CEL condition
+			holds, err := ev.conditionHolds(binding.Condition, condCtx)
+			if err != nil {
+				return CheckResult{Reason: "Error fetching principal attributes"}, false, err
+			}
+			if !holds {
 				continue
 			}
 		}
 
 		// Check if role has the required permission
 		if binding.Role != nil {
-			if binding.Role.HasPermission(permission) {
-				return true, fmt.Sprintf("Permission granted via role '%s' on resource '%s'",
-					binding.Role.Name, resourceID), nil
+			if ev.hasPermission(binding.Role, permission) {
+				return CheckResult{
+					Allowed: true,
+					Reason:  fmt.Sprintf(grantedViaRoleReason, binding.Role.Name, resourceID),
+					Role:    binding.Role.Name,
+				}, binding.Condition != nil, nil
 			}
 		}
 	}
 
-	return false, "No matching binding found", nil
+	return CheckResult{Reason: "No matching binding found"}, false, nil
 }
 
-// evaluateCondition evaluates a condition expression (simplified)
-// In production, use CEL (Common Expression Language) for this
-func (pe *permissionEvaluator) evaluateCondition(condition *domain.Condition, context map[string]string) bool {
-	if condition == nil || condition.Expression == "" {
-		return true
+// checkGrants checks permission on resources, a resource followed by its ancestors, with one
+// lookup in the evaluation read model. Grants on nearer resources win, as when walking policies.
+// It reports whether an allow came from a grant with a condition.
+func (ev *evaluation) checkGrants(
+	identities []string,
+	resources []uuid.UUID,
+	permission string,
+	condCtx *ConditionContext,
+) (CheckResult, bool, error) {
+	grants, err := ev.pe.grants.Lookup(resources, permission, grantingMembers(identities))
+	if err != nil {
+		return CheckResult{Reason: "Error fetching grants"}, false, err
+	}
+
+	// Nearest resource first, and unconditional grants before those needing a condition evaluated
+	depth := make(map[uuid.UUID]int, len(resources))
+	for i, id := range resources {
+		depth[id] = i
+	}
+	sort.SliceStable(grants, func(i, j int) bool {
+		if depth[grants[i].ResourceID] != depth[grants[j].ResourceID] {
+			return depth[grants[i].ResourceID] < depth[grants[j].ResourceID]
+		}
+		return !grants[i].Conditional() && grants[j].Conditional()
+	})
+
+	for i := range grants {
+		grant := &grants[i]
+		if grant.Conditional() {
+			holds, err := ev.conditionHolds(&domain.Condition{Expression: grant.ConditionExpression}, condCtx)
+			if err != nil {
+				return CheckResult{Reason: "Error fetching principal attributes"}, false, err
+			}
+			if !holds {
+				continue
+			}
+		}
+		return CheckResult{
+			Allowed: true,
+			Reason:  fmt.Sprintf(grantedViaRoleReason, grant.RoleName, grant.ResourceID),
+			Role:    grant.RoleName,
+		}, grant.Conditional(), nil
+	}
+
+	return CheckResult{Reason: "Permission denied: no matching policy found"}, false, nil
+}
+
+// grantedViaRoleReason is the reason of a check allowed by a binding; opa_authz.rego uses it too
+const grantedViaRoleReason = "Permission granted via role '%s' on resource '%s'"
+
+// TestPermissions returns the subset of permissions the principal holds on a resource,
+// in request order. The hierarchy and its policies are loaded once for all permissions.
+func (pe *permissionEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	granted := make(map[string]bool, len(permissions))
+
+	// Serve what we can from the cache
+	pending := false
+	for _, permission := range permissions {
+		cacheKey := GenerateCacheKey(principal, resourceID.String(), permission)
+		if _, found := cachedGrant(pe.cache, cacheKey); found {
+			granted[permission] = true
+		} else {
+			pending = true
+		}
+	}
+
+	if pending {
+		ev := pe.newEvaluation()
+
+		resource, err := ev.resource(resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if resource == nil {
+			return []string{}, nil
+		}
+
+		resources, err := ev.hierarchy(resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ev.loadPolicies(resources); err != nil {
+			return nil, err
+		}
+
+		condCtx := NewConditionContext(principal, resource, context)
+
+		identities, err := ev.identity(principal)
+		if err != nil {
+			return nil, err
+		}
+		tokenGroups := tokenGroupsOf(context)
+		if len(tokenGroups) > 0 {
+			identities = append(identities[:len(identities):len(identities)], tokenGroups...)
+		}
+
+		for _, resID := range resources {
+			policy, err := ev.policy(resID)
+			if err != nil {
+				return nil, err
+			}
+			if policy == nil {
+				continue
+			}
+
+			for i := range policy.Bindings {
+				binding := &policy.Bindings[i]
+				if binding.Role == nil {
+					continue
+				}
+				member, err := ev.grantsTo(binding, identities)
+				if err != nil {
+					return nil, err
+				}
+				if !member {
+					continue
+				}
+				holds, err := ev.conditionHolds(binding.Condition, condCtx)
+				if err != nil {
+					return nil, err
+				}
+				if !holds {
+					continue
+				}
+				for _, permission := range permissions {
+					if !granted[permission] && ev.hasPermission(binding.Role, permission) {
+						granted[permission] = true
+						if binding.Condition == nil && len(tokenGroups) == 0 {
+							pe.cache.Set(GenerateCacheKey(principal, resourceID.String(), permission), binding.Role.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(granted))
+	seen := make(map[string]bool, len(granted))
+	for _, permission := range permissions {
+		if granted[permission] && !seen[permission] {
+			seen[permission] = true
+			result = append(result, permission)
+		}
 	}
 
-	// Simplified condition evaluation
-	// In production, integrate with CEL library
-	// For now, just return true to allow testing
-	// TODO: Implement CEL integration
-	return true
+	return result, nil
 }
 
 // GetEffectivePermissions returns all effective permissions for a principal on a resource
@@ -154,9 +579,10 @@ func (pe *permissionEvaluator) GetEffectivePermissions(
 ) ([]string, []string, error) {
 	permissions := make(map[string]bool)
 	roles := make(map[string]bool)
+	ev := pe.newEvaluation()
 
 	// Get the resource
-	resource, err := pe.resourceRepo.GetByID(resourceID)
+	resource, err := ev.resource(resourceID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -165,18 +591,24 @@ func (pe *permissionEvaluator) GetEffectivePermissions(
 	}
 
 	// Collect from this resource and all ancestors
-	resources := []uuid.UUID{resourceID}
-	ancestors, err := pe.resourceRepo.GetAncestors(resourceID)
+	resources, err := ev.hierarchy(resourceID)
 	if err != nil {
 		return nil, nil, err
 	}
-	for _, ancestor := range ancestors {
-		resources = append(resources, ancestor.ID)
+	// A resource whose policy fails to load is skipped below, as when it is loaded on its own
+	_ = ev.loadPolicies(resources)
+
+	identities, err := ev.identity(principal)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	// Without a request context, conditions see only the principal and the resource
+	condCtx := NewConditionContext(principal, resource, nil)
+
 	// Check each resource
 	for _, resID := range resources {
-		policy, err := pe.policyRepo.GetByResourceID(resID)
+		policy, err := ev.policy(resID)
 		if err != nil {
 			continue
 		}
@@ -185,8 +617,20 @@ func (pe *permissionEvaluator) GetEffectivePermissions(
 		}
 
 		// Check each binding
-		for _, binding := range policy.Bindings {
-			if !binding.HasMember(principal) {
+		for i := range policy.Bindings {
+			binding := &policy.Bindings[i]
+			granted, err := ev.grantsTo(binding, identities)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !granted {
+				continue
+			}
+			holds, err := ev.conditionHolds(binding.Condition, condCtx)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !holds {
 				continue
 			}
 
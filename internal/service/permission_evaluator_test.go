@@ -2,13 +2,18 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pguia/iam/internal/config"
 	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"gorm.io/datatypes"
 )
 
@@ -29,6 +34,11 @@ func (m *MockResourceRepository) Create(resource *domain.Resource) error {
 	return args.Error(0)
 }
 
+func (m *MockResourceRepository) CreateWithPolicy(resource *domain.Resource, policy *domain.Policy) error {
+	args := m.Called(resource, policy)
+	return args.Error(0)
+}
+
 func (m *MockResourceRepository) GetByID(id uuid.UUID) (*domain.Resource, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -47,14 +57,24 @@ func (m *MockResourceRepository) Delete(id uuid.UUID) error {
 	return args.Error(0)
 }
 
-func (m *MockResourceRepository) List(parentID *uuid.UUID, resourceType string, limit, offset int) ([]domain.Resource, error) {
-	args := m.Called(parentID, resourceType, limit, offset)
+func (m *MockResourceRepository) List(parentID *uuid.UUID, resourceType string, attributes map[string]interface{}, tags map[string]string, limit, offset int) ([]domain.Resource, error) {
+	args := m.Called(parentID, resourceType, attributes, tags, limit, offset)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]domain.Resource), args.Error(1)
 }
 
+func (m *MockResourceRepository) PatchAttributes(id uuid.UUID, patch map[string]interface{}, _ string) error {
+	args := m.Called(id, patch)
+	return args.Error(0)
+}
+
+func (m *MockResourceRepository) SetTags(id uuid.UUID, tags map[string]string, _ string) error {
+	args := m.Called(id, tags)
+	return args.Error(0)
+}
+
 func (m *MockResourceRepository) GetAncestors(id uuid.UUID) ([]domain.Resource, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -71,6 +91,14 @@ func (m *MockResourceRepository) GetChildren(parentID uuid.UUID) ([]domain.Resou
 	return args.Get(0).([]domain.Resource), args.Error(1)
 }
 
+func (m *MockResourceRepository) ListByName(parentID *uuid.UUID, name string) ([]domain.Resource, error) {
+	args := m.Called(parentID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Resource), args.Error(1)
+}
+
 func (m *MockResourceRepository) GetDescendants(id uuid.UUID) ([]domain.Resource, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -79,6 +107,40 @@ func (m *MockResourceRepository) GetDescendants(id uuid.UUID) ([]domain.Resource
 	return args.Get(0).([]domain.Resource), args.Error(1)
 }
 
+func (m *MockResourceRepository) GetSnapshot(root uuid.UUID) (*repository.ResourceSnapshot, error) {
+	args := m.Called(root)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.ResourceSnapshot), args.Error(1)
+}
+
+func (m *MockResourceRepository) ListChanges(since time.Time, after uuid.UUID, limit int) ([]repository.ResourceChange, error) {
+	args := m.Called(since, after, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.ResourceChange), args.Error(1)
+}
+
+func (m *MockResourceRepository) GetDeleted(id uuid.UUID) (*domain.Resource, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Resource), args.Error(1)
+}
+
+func (m *MockResourceRepository) Undelete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockResourceRepository) PurgeDeleted(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 type MockPolicyRepository struct {
 	mock.Mock
 }
@@ -104,6 +166,22 @@ func (m *MockPolicyRepository) GetByResourceID(resourceID uuid.UUID) (*domain.Po
 	return args.Get(0).(*domain.Policy), args.Error(1)
 }
 
+// GetByResourceIDs is served by the GetByResourceID expectations, so tests set up the policies of
+// a hierarchy one resource at a time whichever way the code loads them
+func (m *MockPolicyRepository) GetByResourceIDs(resourceIDs []uuid.UUID) (map[uuid.UUID]*domain.Policy, error) {
+	policies := make(map[uuid.UUID]*domain.Policy, len(resourceIDs))
+	for _, id := range resourceIDs {
+		policy, err := m.GetByResourceID(id)
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil {
+			policies[id] = policy
+		}
+	}
+	return policies, nil
+}
+
 func (m *MockPolicyRepository) Update(policy *domain.Policy) error {
 	args := m.Called(policy)
 	return args.Error(0)
@@ -122,6 +200,32 @@ func (m *MockPolicyRepository) List(parentResourceID *uuid.UUID, limit, offset i
 	return args.Get(0).([]domain.Policy), args.Error(1)
 }
 
+func (m *MockPolicyRepository) ListWithDetails(parentResourceID *uuid.UUID, limit, offset int) ([]domain.Policy, error) {
+	args := m.Called(parentResourceID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Policy), args.Error(1)
+}
+
+func (m *MockPolicyRepository) GetDeletedByResourceID(resourceID uuid.UUID) (*domain.Policy, error) {
+	args := m.Called(resourceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Policy), args.Error(1)
+}
+
+func (m *MockPolicyRepository) Undelete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockPolicyRepository) PurgeDeleted(before time.Time) (int64, error) {
+	args := m.Called(before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 type MockPermissionRepository struct {
 	mock.Mock
 }
@@ -155,6 +259,14 @@ func (m *MockPermissionRepository) List(service string, limit, offset int) ([]do
 	return args.Get(0).([]domain.Permission), args.Error(1)
 }
 
+func (m *MockPermissionRepository) SyncService(service string, permissions []domain.Permission) (*repository.PermissionSyncResult, error) {
+	args := m.Called(service, permissions)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PermissionSyncResult), args.Error(1)
+}
+
 func (m *MockPermissionRepository) GetByIDs(ids []uuid.UUID) ([]domain.Permission, error) {
 	args := m.Called(ids)
 	if args.Get(0) == nil {
@@ -163,6 +275,19 @@ func (m *MockPermissionRepository) GetByIDs(ids []uuid.UUID) ([]domain.Permissio
 	return args.Get(0).([]domain.Permission), args.Error(1)
 }
 
+func (m *MockPermissionRepository) SetDeprecated(id uuid.UUID, deprecated bool, replacementName string) error {
+	args := m.Called(id, deprecated, replacementName)
+	return args.Error(0)
+}
+
+func (m *MockPermissionRepository) ListDeprecated() ([]domain.Permission, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.Permission), args.Error(1)
+}
+
 func (m *MockPermissionRepository) Delete(id uuid.UUID) error {
 	args := m.Called(id)
 	return args.Error(0)
@@ -236,6 +361,93 @@ func TestCheckPermission_DirectResource(t *testing.T) {
 	policyRepo.AssertExpectations(t)
 }
 
+// Test: Domain members grant to every user of the domain
+func TestCheckPermission_DomainMember(t *testing.T) {
+	// Setup
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	permissionRepo := new(MockPermissionRepository)
+	cache := NewNoopCache()
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, permissionRepo, cache)
+
+	resourceID := uuid.New()
+	resource := &domain.Resource{ID: resourceID, Type: "bucket", Name: "test-bucket"}
+	role := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.viewer",
+		Permissions: []domain.Permission{{ID: uuid.New(), Name: "storage.objects.read"}},
+	}
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Bindings: []domain.Binding{{
+			ID:      uuid.New(),
+			RoleID:  role.ID,
+			Role:    role,
+			Members: toJSON([]string{"domain:example.com"}),
+		}},
+	}
+
+	// Mock expectations
+	resourceRepo.On("GetByID", resourceID).Return(resource, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	// Any example.com user is granted
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// Users of other domains are not
+	allowed, _, err = evaluator.CheckPermission("user:mallory@evil.com", resourceID, "storage.objects.read", nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// Effective permissions include domain grants
+	permissions, roles, err := evaluator.GetEffectivePermissions("user:bob@example.com", resourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.read"}, permissions)
+	assert.Equal(t, []string{"roles/storage.viewer"}, roles)
+}
+
+// Test: A binding whose members are not valid JSON fails the check instead of granting to no one
+func TestCheckPermission_CorruptedMembers(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	permissionRepo := new(MockPermissionRepository)
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, permissionRepo, NewNoopCache())
+
+	resourceID := uuid.New()
+	role := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.viewer",
+		Permissions: []domain.Permission{{ID: uuid.New(), Name: "storage.objects.read"}},
+	}
+	policy := &domain.Policy{
+		ID:         uuid.New(),
+		ResourceID: resourceID,
+		Bindings: []domain.Binding{{
+			ID:      uuid.New(),
+			RoleID:  role.ID,
+			Role:    role,
+			Members: []byte(`["user:alice@example.com"`),
+		}},
+	}
+
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "bucket", Name: "b"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.objects.read", nil)
+	assert.ErrorContains(t, err, "invalid members")
+	assert.False(t, allowed)
+
+	_, _, err = evaluator.GetEffectivePermissions("user:alice@example.com", resourceID)
+	assert.ErrorContains(t, err, "invalid members")
+}
+
 // Test: Permission denied when user not in binding
 func TestCheckPermission_UserNotInBinding(t *testing.T) {
 	// Setup
@@ -650,3 +862,525 @@ func NewTestMemoryCache() CacheService {
 		CleanupMinutes: 10,
 	})
 }
+
+// Test: TestPermissions returns the granted subset in request order
+func TestTestPermissions(t *testing.T) {
+	// Setup
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	permissionRepo := new(MockPermissionRepository)
+	cache := NewNoopCache()
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, permissionRepo, cache)
+
+	parentID := uuid.New()
+	resourceID := uuid.New()
+	resource := &domain.Resource{ID: resourceID, Type: "bucket", Name: "test-bucket", ParentID: &parentID}
+
+	viewer := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.viewer",
+		Permissions: []domain.Permission{{Name: "storage.objects.read"}},
+	}
+	admin := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.admin",
+		Permissions: []domain.Permission{{Name: "storage.objects.delete"}},
+	}
+
+	// Viewer on the bucket, admin inherited from the project
+	policy := &domain.Policy{
+		ResourceID: resourceID,
+		Bindings:   []domain.Binding{{Role: viewer, Members: toJSON([]string{"user:alice@example.com"})}},
+	}
+	parentPolicy := &domain.Policy{
+		ResourceID: parentID,
+		Bindings:   []domain.Binding{{Role: admin, Members: toJSON([]string{"user:alice@example.com"})}},
+	}
+
+	// Mock expectations: the hierarchy is loaded once for all permissions
+	resourceRepo.On("GetByID", resourceID).Return(resource, nil).Once()
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{{ID: parentID}}, nil).Once()
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil).Once()
+	policyRepo.On("GetByResourceID", parentID).Return(parentPolicy, nil).Once()
+
+	granted, err := evaluator.TestPermissions(
+		"user:alice@example.com",
+		resourceID,
+		[]string{"storage.objects.delete", "storage.objects.write", "storage.objects.read", "storage.objects.delete"},
+		nil,
+	)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.delete", "storage.objects.read"}, granted)
+	resourceRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+}
+
+// Test: TestPermissions is served from the cache when every permission is cached
+func TestTestPermissions_Cached(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache)
+
+	resourceID := uuid.New()
+	cache.Set(GenerateCacheKey("user:alice@example.com", resourceID.String(), "storage.objects.read"), "roles/viewer")
+
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"storage.objects.read"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.read"}, granted)
+	resourceRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
+// Test: TestPermissions on a missing resource grants nothing
+func TestTestPermissions_ResourceNotFound(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, new(MockPolicyRepository), new(MockPermissionRepository), NewNoopCache())
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(nil, nil)
+
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"storage.objects.read"}, nil)
+
+	assert.NoError(t, err)
+	assert.Empty(t, granted)
+}
+
+// Test: Bindings to a linked identity, its domain and its groups grant to the principal
+func TestCheckPermission_PrincipalAliases(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	aliases := &memPrincipalAliasRepository{links: []domain.PrincipalAlias{
+		{Alias: "user:alice@example.com", Principal: "user:alice@corp.example.com"},
+	}}
+	groups := groupMap{"user:alice@example.com": {"group:storage@example.com"}}
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache(),
+		WithAliasResolver(aliases), WithGroupResolver(groups))
+
+	bucketID := uuid.New()
+	viewer := testRole("roles/storage.viewer", "storage.objects.read")
+	writer := testRole("roles/storage.writer", "storage.objects.write")
+	admin := testRole("roles/storage.admin", "storage.objects.delete")
+	policy := &domain.Policy{ResourceID: bucketID, Bindings: []domain.Binding{
+		testBinding(&viewer, "user:alice@example.com"),
+		testBinding(&writer, "domain:example.com"),
+		testBinding(&admin, "group:storage@example.com"),
+	}}
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", bucketID).Return(policy, nil)
+
+	for _, permission := range []string{"storage.objects.read", "storage.objects.write", "storage.objects.delete"} {
+		allowed, _, err := evaluator.CheckPermission("user:alice@corp.example.com", bucketID, permission, nil)
+		require.NoError(t, err)
+		assert.True(t, allowed, permission)
+	}
+
+	allowed, _, err := evaluator.CheckPermission("user:bob@corp.example.com", bucketID, "storage.objects.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// Test: BatchCheckPermissions loads shared rows and groups once for the whole batch
+func TestBatchCheckPermissions(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	groups := &stubGroupResolver{groups: []string{"group:storage@example.com"}}
+
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache(),
+		WithGroupResolver(groups))
+
+	// Two buckets in one project; the project grants the viewer role to a group
+	projectID, logsID, uploadsID := uuid.New(), uuid.New(), uuid.New()
+	viewer := &domain.Role{
+		ID:          uuid.New(),
+		Name:        "roles/storage.viewer",
+		Permissions: []domain.Permission{{Name: "storage.objects.read"}},
+	}
+	projectPolicy := &domain.Policy{
+		ResourceID: projectID,
+		Bindings: []domain.Binding{{ID: uuid.New(), Role: viewer, Members: toJSON([]string{"group:storage@example.com"}),
+			Condition: &domain.Condition{Expression: `resource.type == "bucket"`}}},
+	}
+
+	resourceRepo.On("GetByID", logsID).Return(&domain.Resource{ID: logsID, Type: "bucket"}, nil).Once()
+	resourceRepo.On("GetByID", uploadsID).Return(&domain.Resource{ID: uploadsID, Type: "bucket"}, nil).Once()
+	resourceRepo.On("GetAncestors", logsID).Return([]domain.Resource{{ID: projectID}}, nil).Once()
+	resourceRepo.On("GetAncestors", uploadsID).Return([]domain.Resource{{ID: projectID}}, nil).Once()
+	policyRepo.On("GetByResourceID", logsID).Return(nil, nil).Once()
+	policyRepo.On("GetByResourceID", uploadsID).Return(nil, nil).Once()
+	policyRepo.On("GetByResourceID", projectID).Return(projectPolicy, nil).Once()
+
+	results, err := evaluator.BatchCheckPermissions("user:alice@example.com", []PermissionCheck{
+		{ResourceID: logsID, Permission: "storage.objects.read"},
+		{ResourceID: uploadsID, Permission: "storage.objects.read"},
+		{ResourceID: logsID, Permission: "storage.objects.delete"},
+		{ResourceID: uploadsID, Permission: "storage.objects.read", Context: map[string]string{"ip": "10.0.0.1"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.True(t, results[0].Allowed)
+	assert.True(t, results[1].Allowed)
+	assert.False(t, results[2].Allowed)
+	assert.True(t, results[3].Allowed)
+	assert.Contains(t, results[0].Reason, projectID.String())
+	assert.Equal(t, int32(1), groups.calls.Load())
+	resourceRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+}
+
+// Test: BatchCheckPermissions fails when a check fails to load
+func TestBatchCheckPermissions_Error(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, new(MockPolicyRepository), new(MockPermissionRepository), NewNoopCache())
+
+	resourceID := uuid.New()
+	resourceRepo.On("GetByID", resourceID).Return(nil, assert.AnError)
+
+	results, err := evaluator.BatchCheckPermissions("user:alice@example.com", []PermissionCheck{
+		{ResourceID: resourceID, Permission: "storage.objects.read"},
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "check 0: Error fetching resource")
+	assert.Nil(t, results)
+}
+
+// attributeMap provides principal attributes from a fixed principal -> attributes map
+type attributeMap map[string]map[string]string
+
+func (a attributeMap) AttributesOf(principal string) (map[string]string, error) {
+	return a[principal], nil
+}
+
+// countingAttributes counts the attribute lookups of a provider
+type countingAttributes struct {
+	attributes map[string]string
+	err        error
+	calls      int
+}
+
+func (c *countingAttributes) AttributesOf(principal string) (map[string]string, error) {
+	c.calls++
+	return c.attributes, c.err
+}
+
+// Test: Principal attributes are fetched once per batch for conditional bindings and override
+// attributes supplied in the context
+func TestPrincipalAttributes_ConditionalBindings(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	provider := &countingAttributes{attributes: map[string]string{"clearance": "secret"}}
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache(),
+		WithPrincipalAttributeProvider(attributeMap{"user:alice@example.com": {"clearance": "public", "department": "finance"}}),
+		WithPrincipalAttributeProvider(provider),
+	).(*permissionEvaluator)
+
+	plainID, conditionalID := uuid.New(), uuid.New()
+	viewer := testRole("roles/viewer", "docs.read")
+	conditional := testBinding(&viewer, "domain:example.com")
+	conditional.Condition = &domain.Condition{Expression: `principal.attributes.clearance == "secret"`}
+	for id, binding := range map[uuid.UUID]domain.Binding{plainID: testBinding(&viewer, "user:alice@example.com"), conditionalID: conditional} {
+		resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "doc"}, nil)
+		resourceRepo.On("GetAncestors", id).Return([]domain.Resource{}, nil)
+		policyRepo.On("GetByResourceID", id).Return(&domain.Policy{ResourceID: id, Bindings: []domain.Binding{binding}}, nil)
+	}
+
+	// Unconditional bindings do not need attributes
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", plainID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 0, provider.calls)
+
+	ev := evaluator.newEvaluation()
+	condCtx := NewConditionContext("user:alice@example.com", nil, map[string]string{"principal.clearance": "top-secret", "principal.site": "hq"})
+	holds, err := ev.conditionHolds(conditional.Condition, condCtx)
+	require.NoError(t, err)
+	assert.True(t, holds)
+	assert.Equal(t, map[string]string{"clearance": "secret", "department": "finance", "site": "hq"}, condCtx.PrincipalAttributes)
+
+	// Conditions that cannot read principal attributes do not fetch them
+	ev = evaluator.newEvaluation()
+	holds, err = ev.conditionHolds(&domain.Condition{Expression: `resource.type == "folder"`},
+		NewConditionContext("user:alice@example.com", &domain.Resource{Type: "doc"}, nil))
+	require.NoError(t, err)
+	assert.False(t, holds)
+	assert.Equal(t, 1, provider.calls)
+
+	// One lookup for all checks of a batch
+	provider.calls = 0
+	results, err := evaluator.BatchCheckPermissions("user:alice@example.com", []PermissionCheck{
+		{ResourceID: conditionalID, Permission: "docs.read"},
+		{ResourceID: conditionalID, Permission: "docs.write"},
+	})
+	require.NoError(t, err)
+	assert.True(t, results[0].Allowed)
+	assert.False(t, results[1].Allowed)
+	assert.Equal(t, 1, provider.calls)
+
+	// Provider failures fail the check
+	provider.err = errors.New("directory unavailable")
+	_, reason, err := evaluator.CheckPermission("user:alice@example.com", conditionalID, "docs.read", nil)
+	assert.ErrorContains(t, err, "directory unavailable")
+	assert.Equal(t, "Error fetching principal attributes", reason)
+}
+
+// Test: A binding whose condition does not hold grants nothing
+func TestCheckPermission_ConditionNotMet(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+
+	resourceID := uuid.New()
+	viewer := testRole("roles/viewer", "docs.read")
+	binding := testBinding(&viewer, "domain:example.com")
+	binding.Condition = &domain.Condition{Expression: `principal.attributes.department == "finance"`}
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "doc"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ResourceID: resourceID, Bindings: []domain.Binding{binding}}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", map[string]string{"principal.department": "sales"})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	allowed, _, err = evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", map[string]string{"principal.department": "finance"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	permissions, roles, err := evaluator.GetEffectivePermissions("user:alice@example.com", resourceID)
+	require.NoError(t, err)
+	assert.Empty(t, permissions)
+	assert.Empty(t, roles)
+}
+
+// Test: Allows of conditional bindings are not cached, as the cache key ignores the request
+func TestCheckPermission_ConditionalAllowNotCached(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	cache := NewTestMemoryCache()
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache)
+
+	resourceID := uuid.New()
+	viewer := testRole("roles/viewer", "docs.read", "docs.list")
+	binding := testBinding(&viewer, "user:alice@example.com")
+	binding.Condition = &domain.Condition{Expression: `context.team == "storage"`}
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "doc"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ResourceID: resourceID, Bindings: []domain.Binding{binding}}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", map[string]string{"team": "storage"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"docs.list"}, map[string]string{"team": "storage"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs.list"}, granted)
+
+	for _, context := range []map[string]string{{"team": "sales"}, nil} {
+		allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", context)
+		require.NoError(t, err)
+		assert.False(t, allowed, reason)
+		granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"docs.read", "docs.list"}, context)
+		require.NoError(t, err)
+		assert.Empty(t, granted)
+	}
+	_, found := cache.Get(GenerateCacheKey("user:alice@example.com", resourceID.String(), "docs.read"))
+	assert.False(t, found)
+}
+
+// Test: Allows of conditional grants of the read model are not cached either
+func TestCheckPermission_EvaluationGrants_ConditionalAllowNotCached(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	conditionID := uuid.New()
+	bucketID := uuid.New()
+	grants := memEvaluationGrants{
+		{BindingID: uuid.New(), Member: "user:alice@example.com", Permission: "storage.objects.get", ResourceID: bucketID, RoleName: "roles/storage.reader",
+			ConditionID: &conditionID, ConditionExpression: `context.team == "storage"`},
+	}
+	evaluator := NewPermissionEvaluator(resourceRepo, new(MockPolicyRepository), new(MockPermissionRepository), NewTestMemoryCache(), WithEvaluationGrants(grants))
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{}, nil)
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", bucketID, "storage.objects.get", map[string]string{"team": "storage"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, _, err = evaluator.CheckPermission("user:alice@example.com", bucketID, "storage.objects.get", map[string]string{"team": "sales"})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// Test: A condition of an ancestor's binding reads the attributes of the checked resource, which
+// callers do not pass
+func TestCheckPermission_InheritedConditionOnResourceAttributes(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+
+	folderID, publicID, restrictedID := uuid.New(), uuid.New(), uuid.New()
+	folder := domain.Resource{ID: folderID, Type: "folder", Attributes: domain.Attributes{"classification": "public"}}
+	reader := testRole("roles/reader", "docs.read")
+	binding := testBinding(&reader, "user:alice@example.com")
+	binding.Condition = &domain.Condition{Expression: `resource.attributes["classification"] != "restricted"`}
+	policyRepo.On("GetByResourceID", folderID).Return(&domain.Policy{ResourceID: folderID, Bindings: []domain.Binding{binding}}, nil)
+
+	for id, classification := range map[uuid.UUID]string{publicID: "public", restrictedID: "restricted"} {
+		resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "doc", ParentID: &folderID,
+			Attributes: domain.Attributes{"classification": classification}}, nil)
+		resourceRepo.On("GetAncestors", id).Return([]domain.Resource{folder}, nil)
+		policyRepo.On("GetByResourceID", id).Return(nil, nil)
+	}
+
+	allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", publicID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed, reason)
+	assert.Contains(t, reason, folderID.String())
+
+	allowed, _, err = evaluator.CheckPermission("user:alice@example.com", restrictedID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// Test: allUsers and allAuthenticatedUsers grant to every principal, through policies and the
+// read model
+func TestCheckPermission_PublicMembers(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+
+	docID, bucketID := uuid.New(), uuid.New()
+	reader := testRole("roles/reader", "docs.read")
+	writer := testRole("roles/writer", "docs.write")
+	resourceRepo.On("GetByID", docID).Return(&domain.Resource{ID: docID, Type: "doc"}, nil)
+	resourceRepo.On("GetAncestors", docID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", docID).Return(&domain.Policy{ResourceID: docID, Bindings: []domain.Binding{
+		testBinding(&reader, domain.MemberAllUsers),
+		testBinding(&writer, domain.MemberAllAuthenticatedUsers),
+	}}, nil)
+
+	for _, principal := range []string{"user:alice@example.com", "serviceAccount:ci@example.iam"} {
+		for _, permission := range []string{"docs.read", "docs.write"} {
+			allowed, reason, err := evaluator.CheckPermission(principal, docID, permission, nil)
+			require.NoError(t, err)
+			assert.True(t, allowed, "%s %s: %s", principal, permission, reason)
+		}
+	}
+
+	grants := memEvaluationGrants{
+		{BindingID: uuid.New(), Member: domain.MemberAllUsers, Permission: "storage.objects.get", ResourceID: bucketID, RoleName: "roles/storage.reader"},
+	}
+	readModel := NewPermissionEvaluator(resourceRepo, new(MockPolicyRepository), new(MockPermissionRepository), NewNoopCache(), WithEvaluationGrants(grants))
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{}, nil)
+
+	allowed, reason, err := readModel.CheckPermission("user:bob@example.com", bucketID, "storage.objects.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed, reason)
+}
+
+// memEvaluationGrants is an in-memory evaluation read model
+type memEvaluationGrants []domain.EvaluationGrant
+
+func (m memEvaluationGrants) Lookup(resourceIDs []uuid.UUID, permission string, members []string) ([]domain.EvaluationGrant, error) {
+	var grants []domain.EvaluationGrant
+	for _, grant := range m {
+		for _, member := range members {
+			if grant.Permission == permission && grant.Member == domain.GrantMember(member) && containsID(resourceIDs, grant.ResourceID) {
+				grants = append(grants, grant)
+				break
+			}
+		}
+	}
+	return grants, nil
+}
+
+// AuthorizedChildren is not used by the evaluator
+func (m memEvaluationGrants) AuthorizedChildren(uuid.UUID, []uuid.UUID, string, []string, int, int) ([]repository.AuthorizedChild, error) {
+	return nil, nil
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Test: With the read model, checks are answered without loading policies
+func TestCheckPermission_EvaluationGrants(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	orgID, bucketID := uuid.New(), uuid.New()
+	falseCondition := uuid.New()
+	grants := memEvaluationGrants{
+		{BindingID: uuid.New(), Member: "domain:example.com", Permission: "storage.objects.get", ResourceID: orgID, RoleName: "roles/org.viewer"},
+		{BindingID: uuid.New(), Member: "user:alice@example.com", Permission: "storage.objects.get", ResourceID: bucketID, RoleName: "roles/storage.reader",
+			ConditionID: &falseCondition, ConditionExpression: "false"},
+		{BindingID: uuid.New(), Member: "user:alice@example.com", Permission: "storage.objects.delete", ResourceID: bucketID, RoleName: "roles/storage.admin",
+			ConditionID: &falseCondition, ConditionExpression: "false"},
+	}
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache(), WithEvaluationGrants(grants))
+
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket"}, nil)
+	resourceRepo.On("GetAncestors", bucketID).Return([]domain.Resource{{ID: orgID, Type: "organization"}}, nil)
+
+	// The bucket grant's condition does not hold, so the org grant to the domain applies
+	result, err := evaluator.Check("user:alice@Example.com", bucketID, "storage.objects.get", nil)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, "roles/org.viewer", result.Role)
+	assert.Contains(t, result.Reason, orgID.String())
+
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", bucketID, "storage.objects.delete", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	allowed, _, err = evaluator.CheckPermission("user:bob@other.com", bucketID, "storage.objects.get", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	policyRepo.AssertNotCalled(t, "GetByResourceID", mock.Anything)
+}
+
+// Test: Concurrent checks share one load of the same resource
+func TestCheckPermission_SharedLoads(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), NewNoopCache())
+
+	resourceID := uuid.New()
+	viewer := testRole("roles/viewer", "docs.read")
+	release := make(chan struct{})
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "doc"}, nil).
+		Run(func(mock.Arguments) { <-release })
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).
+		Return(&domain.Policy{ResourceID: resourceID, Bindings: []domain.Binding{testBinding(&viewer, "user:alice@example.com")}}, nil)
+
+	const checks = 20
+	var wg sync.WaitGroup
+	allowed := make([]bool, checks)
+	for i := 0; i < checks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			allowed[i], _, _ = evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", nil)
+		}(i)
+	}
+	// Let every check reach the load in flight
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range allowed {
+		assert.True(t, allowed[i])
+	}
+	resourceRepo.AssertNumberOfCalls(t, "GetByID", 1)
+}
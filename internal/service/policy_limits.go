@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// ErrQuotaExceeded is returned when a change would exceed a configured policy limit
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError describes the policy limit a change would exceed.
+// It wraps ErrQuotaExceeded so callers can use errors.Is.
+type QuotaError struct {
+	Limit      string    // Name of the limit, e.g. "max_bindings"
+	ResourceID uuid.UUID // Resource whose limits apply
+	Value      int       // Size the change would reach
+	Max        int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s of resource %s is %d, got %d", ErrQuotaExceeded, e.Limit, e.ResourceID, e.Max, e.Value)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// PolicyLimits are the size limits of the policy of a resource. A zero limit is unlimited.
+type PolicyLimits struct {
+	MaxBindings        int // Bindings in the policy
+	MaxMembers         int // Members of each binding
+	MaxConditionLength int // Characters in each condition expression
+	MaxDepth           int // Levels of the hierarchy; resource.max_depth is enforced regardless
+}
+
+// override returns the limits with the non-zero limits of o replacing them
+func (l PolicyLimits) override(o PolicyLimits) PolicyLimits {
+	if o.MaxBindings > 0 {
+		l.MaxBindings = o.MaxBindings
+	}
+	if o.MaxMembers > 0 {
+		l.MaxMembers = o.MaxMembers
+	}
+	if o.MaxConditionLength > 0 {
+		l.MaxConditionLength = o.MaxConditionLength
+	}
+	if o.MaxDepth > 0 {
+		l.MaxDepth = o.MaxDepth
+	}
+	return l
+}
+
+// checkBindings checks a policy of resourceID holding existing bindings besides the given ones
+func (l PolicyLimits) checkBindings(resourceID uuid.UUID, existing int, bindings []domain.Binding) error {
+	if total := existing + len(bindings); l.MaxBindings > 0 && total > l.MaxBindings {
+		return &QuotaError{Limit: "max_bindings", ResourceID: resourceID, Value: total, Max: l.MaxBindings}
+	}
+	for i := range bindings {
+		if l.MaxMembers > 0 {
+			members, err := bindings[i].GetMembers()
+			if err != nil {
+				return fmt.Errorf("binding %d: invalid members: %w", i, err)
+			}
+			if len(members) > l.MaxMembers {
+				return fmt.Errorf("binding %d: %w", i,
+					&QuotaError{Limit: "max_members", ResourceID: resourceID, Value: len(members), Max: l.MaxMembers})
+			}
+		}
+		if condition := bindings[i].Condition; l.MaxConditionLength > 0 && condition != nil {
+			if length := len([]rune(condition.Expression)); length > l.MaxConditionLength {
+				return fmt.Errorf("binding %d: %w", i,
+					&QuotaError{Limit: "max_condition_length", ResourceID: resourceID, Value: length, Max: l.MaxConditionLength})
+			}
+		}
+	}
+	return nil
+}
+
+// PolicyLimitSet holds the default policy limits and their overrides for some subtrees
+type PolicyLimitSet struct {
+	defaults  PolicyLimits
+	overrides map[uuid.UUID]PolicyLimits
+}
+
+// NewPolicyLimitSet creates the policy limits described by cfg
+func NewPolicyLimitSet(cfg *config.PolicyLimitsConfig) (*PolicyLimitSet, error) {
+	set := &PolicyLimitSet{
+		defaults: PolicyLimits{
+			MaxBindings:        cfg.MaxBindings,
+			MaxMembers:         cfg.MaxMembers,
+			MaxConditionLength: cfg.MaxConditionLength,
+		},
+		overrides: make(map[uuid.UUID]PolicyLimits, len(cfg.Overrides)),
+	}
+	for _, override := range cfg.Overrides {
+		id, err := uuid.Parse(override.ResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy limit override resource %q: %w", override.ResourceID, err)
+		}
+		set.overrides[id] = PolicyLimits{
+			MaxBindings:        override.MaxBindings,
+			MaxMembers:         override.MaxMembers,
+			MaxConditionLength: override.MaxConditionLength,
+			MaxDepth:           override.MaxDepth,
+		}
+	}
+	return set, nil
+}
+
+// resolve returns the limits of the first resource of chain, given its ancestors ordered from
+// its parent to the root
+func (p *PolicyLimitSet) resolve(chain []uuid.UUID) PolicyLimits {
+	for _, id := range chain {
+		if override, ok := p.overrides[id]; ok {
+			return p.defaults.override(override)
+		}
+	}
+	return p.defaults
+}
+
+// SetPolicyLimits limits the size of policies and, for overridden subtrees, the hierarchy depth.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetPolicyLimits(limits *PolicyLimitSet) {
+	s.policyLimits = limits
+}
+
+// policyLimitsFor returns the limits applying to the policy of resourceID
+func (s *IAMService) policyLimitsFor(resourceID uuid.UUID) (PolicyLimits, error) {
+	if s.policyLimits == nil {
+		return PolicyLimits{}, nil
+	}
+	if len(s.policyLimits.overrides) == 0 {
+		return s.policyLimits.defaults, nil
+	}
+
+	ancestors, err := s.resourceRepo.GetAncestors(resourceID)
+	if err != nil {
+		return PolicyLimits{}, fmt.Errorf("failed to get resource ancestors: %w", err)
+	}
+	chain := make([]uuid.UUID, 0, len(ancestors)+1)
+	chain = append(chain, resourceID)
+	for _, ancestor := range ancestors {
+		chain = append(chain, ancestor.ID)
+	}
+	return s.policyLimits.resolve(chain), nil
+}
+
+// checkPolicyLimits checks that the policy of resourceID stays within its limits once the given
+// bindings are added to the existing ones
+func (s *IAMService) checkPolicyLimits(resourceID uuid.UUID, existing int, bindings []domain.Binding) error {
+	limits, err := s.policyLimitsFor(resourceID)
+	if err != nil {
+		return err
+	}
+	return limits.checkBindings(resourceID, existing, bindings)
+}
+
+// hasDepthLimits reports whether some override limits the hierarchy depth
+func (s *IAMService) hasDepthLimits() bool {
+	if s.policyLimits == nil {
+		return false
+	}
+	for _, override := range s.policyLimits.overrides {
+		if override.MaxDepth > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDepthLimit checks the depth limit of resourceID, placed under ancestors (ordered from its
+// parent to the root) with a subtree spanning height levels, itself included.
+// resource.max_depth itself is enforced by the resource repository.
+func (s *IAMService) checkDepthLimit(resourceID uuid.UUID, ancestors []domain.Resource, height int) error {
+	chain := make([]uuid.UUID, 0, len(ancestors)+1)
+	chain = append(chain, resourceID)
+	for _, ancestor := range ancestors {
+		chain = append(chain, ancestor.ID)
+	}
+	limits := s.policyLimits.resolve(chain)
+	if depth := len(ancestors) + height; limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &QuotaError{Limit: "max_depth", ResourceID: resourceID, Value: depth, Max: limits.MaxDepth}
+	}
+	return nil
+}
+
+// subtreeHeight returns the number of levels of the subtree rooted at id, itself included
+func (s *IAMService) subtreeHeight(id uuid.UUID) (int, error) {
+	descendants, err := s.resourceRepo.GetDescendants(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get resource descendants: %w", err)
+	}
+
+	depth := map[uuid.UUID]int{id: 1}
+	height := 1
+	// Descendants may come in any order; settle depths until every resource has one
+	for pending := descendants; len(pending) > 0; {
+		var next []domain.Resource
+		for _, resource := range pending {
+			if resource.ParentID == nil {
+				continue
+			}
+			parentDepth, ok := depth[*resource.ParentID]
+			if !ok {
+				next = append(next, resource)
+				continue
+			}
+			depth[resource.ID] = parentDepth + 1
+			if parentDepth+1 > height {
+				height = parentDepth + 1
+			}
+		}
+		if len(next) == len(pending) {
+			break // Orphaned rows; ignore them
+		}
+		pending = next
+	}
+	return height, nil
+}
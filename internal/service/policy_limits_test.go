@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicyLimitSet_Resolve(t *testing.T) {
+	tenant := uuid.New()
+	project := uuid.New()
+	limits, err := NewPolicyLimitSet(&config.PolicyLimitsConfig{
+		MaxBindings:        10,
+		MaxMembers:         100,
+		MaxConditionLength: 1000,
+		Overrides: []config.PolicyLimitOverride{
+			{ResourceID: tenant.String(), MaxBindings: 50, MaxDepth: 4},
+			{ResourceID: project.String(), MaxMembers: 5},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, PolicyLimits{MaxBindings: 10, MaxMembers: 100, MaxConditionLength: 1000},
+		limits.resolve([]uuid.UUID{uuid.New()}))
+	assert.Equal(t, PolicyLimits{MaxBindings: 50, MaxMembers: 100, MaxConditionLength: 1000, MaxDepth: 4},
+		limits.resolve([]uuid.UUID{uuid.New(), tenant}))
+	// The nearest override wins, on top of the defaults
+	assert.Equal(t, PolicyLimits{MaxBindings: 10, MaxMembers: 5, MaxConditionLength: 1000},
+		limits.resolve([]uuid.UUID{project, tenant}))
+
+	_, err = NewPolicyLimitSet(&config.PolicyLimitsConfig{Overrides: []config.PolicyLimitOverride{{ResourceID: "org"}}})
+	assert.Error(t, err)
+}
+
+func TestPolicyLimits_CheckBindings(t *testing.T) {
+	resourceID := uuid.New()
+	limits := PolicyLimits{MaxBindings: 3, MaxMembers: 2, MaxConditionLength: 10}
+
+	assert.NoError(t, limits.checkBindings(resourceID, 1, []domain.Binding{
+		{Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com"})},
+		{Members: toJSON([]string{"user:carol@example.com"}), Condition: &domain.Condition{Expression: "true"}},
+	}))
+
+	err := limits.checkBindings(resourceID, 3, []domain.Binding{{Members: toJSON([]string{"user:alice@example.com"})}})
+	var quotaErr *QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaError{Limit: "max_bindings", ResourceID: resourceID, Value: 4, Max: 3}, *quotaErr)
+
+	err = limits.checkBindings(resourceID, 0, []domain.Binding{
+		{Members: toJSON([]string{"user:alice@example.com"})},
+		{Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com", "user:carol@example.com"})},
+	})
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "binding 1: quota exceeded: max_members")
+
+	err = limits.checkBindings(resourceID, 0, []domain.Binding{
+		{Members: toJSON([]string{"user:alice@example.com"}), Condition: &domain.Condition{Expression: strings.Repeat("x", 11)}},
+	})
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "max_condition_length", quotaErr.Limit)
+
+	// Zero limits are unlimited
+	assert.NoError(t, PolicyLimits{}.checkBindings(resourceID, 10000, nil))
+}
+
+func TestIAMService_BatchCreateBindings_QuotaExceeded(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	limits, err := NewPolicyLimitSet(&config.PolicyLimitsConfig{MaxBindings: 2})
+	require.NoError(t, err)
+	service.SetPolicyLimits(limits)
+
+	resourceID := uuid.New()
+	roleID := uuid.New()
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Bindings: []domain.Binding{{ID: uuid.New()}, {ID: uuid.New()}}}
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/viewer"}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	_, err = service.BatchCreateBindings(resourceID, []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+	})
+
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	bindingRepo.AssertNotCalled(t, "CreateBatch", mock.Anything, mock.Anything)
+}
+
+func TestIAMService_CreateBinding_TenantOverride(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	tenant := uuid.New()
+	resourceID := uuid.New()
+	limits, err := NewPolicyLimitSet(&config.PolicyLimitsConfig{
+		MaxMembers: 100,
+		Overrides:  []config.PolicyLimitOverride{{ResourceID: tenant.String(), MaxMembers: 1}},
+	})
+	require.NoError(t, err)
+	service.SetPolicyLimits(limits)
+
+	roleID := uuid.New()
+	roleRepo.On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/viewer"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{{ID: tenant}}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(nil, nil)
+
+	_, err = service.CreateBinding(resourceID, roleID, []string{"user:alice@example.com", "user:bob@example.com"}, nil)
+
+	var quotaErr *QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "max_members", quotaErr.Limit)
+	assert.Equal(t, 1, quotaErr.Max)
+	policyRepo.AssertNotCalled(t, "Create", mock.Anything)
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestIAMService_CreateResource_DepthOverride(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	tenant := uuid.New()
+	folder := uuid.New()
+	limits, err := NewPolicyLimitSet(&config.PolicyLimitsConfig{
+		Overrides: []config.PolicyLimitOverride{{ResourceID: tenant.String(), MaxDepth: 2}},
+	})
+	require.NoError(t, err)
+	service.SetPolicyLimits(limits)
+
+	resourceRepo.On("GetAncestors", tenant).Return([]domain.Resource{}, nil)
+	resourceRepo.On("GetAncestors", folder).Return([]domain.Resource{{ID: tenant}}, nil)
+	resourceRepo.On("Create", mock.AnythingOfType("*domain.Resource")).Return(nil)
+
+	_, err = service.CreateResource("folder", "team", &tenant, nil, nil, "")
+	require.NoError(t, err)
+
+	_, err = service.CreateResource("project", "app", &folder, nil, nil, "")
+	var quotaErr *QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaError{Limit: "max_depth", ResourceID: folder, Value: 3, Max: 2}, *quotaErr)
+	resourceRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestIAMService_MoveResource_DepthOverride(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	tenant := uuid.New()
+	id := uuid.New()
+	child := uuid.New()
+	limits, err := NewPolicyLimitSet(&config.PolicyLimitsConfig{
+		Overrides: []config.PolicyLimitOverride{{ResourceID: tenant.String(), MaxDepth: 2}},
+	})
+	require.NoError(t, err)
+	service.SetPolicyLimits(limits)
+
+	resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "folder"}, nil)
+	resourceRepo.On("GetByID", tenant).Return(&domain.Resource{ID: tenant, Type: "organization"}, nil)
+	resourceRepo.On("GetAncestors", tenant).Return([]domain.Resource{}, nil)
+	resourceRepo.On("GetDescendants", id).Return([]domain.Resource{{ID: child, ParentID: &id}}, nil)
+
+	_, _, err = service.MoveResource(id, &tenant, false)
+
+	var quotaErr *QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, 3, quotaErr.Value)
+	resourceRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
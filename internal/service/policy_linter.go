@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// FindingSeverity ranks how risky a policy finding is
+type FindingSeverity string
+
+// Finding severities, most severe first
+const (
+	SeverityError   FindingSeverity = "error"   // Grants access that is almost certainly unintended, or is broken
+	SeverityWarning FindingSeverity = "warning" // Likely a mistake; review it
+	SeverityInfo    FindingSeverity = "info"    // Harmless but worth cleaning up
+)
+
+// Policy lint rules
+const (
+	LintPublicPrivilegedRole = "public-privileged-role" // Owner or admin.all role bound to allUsers or allAuthenticatedUsers
+	LintPublicAccess         = "public-access"          // Any other role bound to allUsers or allAuthenticatedUsers
+	LintEmptyBinding         = "empty-binding"          // Binding without members
+	LintDuplicateMember      = "duplicate-member"       // Member listed more than once in a binding
+	LintAdminOnLeaf          = "admin-on-leaf"          // admin.all granted on a resource without children
+	LintInvalidCondition     = "invalid-condition"      // Condition that does not compile against the condition schema
+	LintConditionNeverTrue   = "condition-never-true"   // Condition that can no longer evaluate to true
+)
+
+// LintSuppressAnnotation is the binding annotation listing the lint rules not to report for
+// the binding, separated by commas, or "*" for all of them
+const LintSuppressAnnotation = "iam.lint/suppress"
+
+// OperationScanPolicies is the operation type of ScanPolicies
+const OperationScanPolicies = "ScanPolicies"
+
+// Members granting to everyone; the evaluator never matches them, but policies imported from
+// other systems may carry them
+var publicMembers = map[string]bool{
+	"allUsers":              true,
+	"allAuthenticatedUsers": true,
+}
+
+// privilegedPermission grants full administrative access, e.g. through roles/owner
+const privilegedPermission = "admin.all"
+
+// PolicyFinding is a risky configuration found in a binding
+type PolicyFinding struct {
+	Rule         string          `json:"rule"`
+	Severity     FindingSeverity `json:"severity"`
+	ResourceID   uuid.UUID       `json:"resource_id"`
+	BindingID    uuid.UUID       `json:"binding_id,omitempty"` // Nil for bindings that are not stored yet
+	BindingIndex int             `json:"binding_index"`        // Position of the binding in the policy
+	Role         string          `json:"role,omitempty"`
+	Message      string          `json:"message"`
+	Suppressed   bool            `json:"suppressed,omitempty"` // Listed in the binding's LintSuppressAnnotation
+}
+
+// PolicyScanResult is the result of a ScanPolicies operation
+type PolicyScanResult struct {
+	Policies   int             `json:"policies"`   // Policies scanned
+	Suppressed int             `json:"suppressed"` // Findings left out because of a suppression annotation
+	Findings   []PolicyFinding `json:"findings"`   // Unsuppressed findings, most severe first
+}
+
+var (
+	// conditionExpiry matches an upper bound on request.time, e.g. request.time < timestamp("2024-01-01T00:00:00Z")
+	conditionExpiry = regexp.MustCompile(`request\.time\s*<=?\s*timestamp\(\s*["']([^"']+)["']\s*\)`)
+	// conditionExpiryReversed matches the same bound written the other way around
+	conditionExpiryReversed = regexp.MustCompile(`timestamp\(\s*["']([^"']+)["']\s*\)\s*>=?\s*request\.time`)
+)
+
+// ValidatePolicy lints the bindings of a resource's policy without changing it. With nil
+// bindings the stored policy is checked; otherwise the given bindings are checked as a
+// proposed replacement, e.g. before UpdatePolicy. Suppressed findings are included and marked.
+func (s *IAMService) ValidatePolicy(resourceID uuid.UUID, bindings []domain.Binding) ([]PolicyFinding, error) {
+	if err := s.authorize("ValidatePolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.resourceRepo.GetByID(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource: %w", err)
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	if bindings == nil {
+		policy, err := s.policyRepo.GetByResourceID(resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy: %w", err)
+		}
+		if policy == nil {
+			return nil, nil
+		}
+		bindings = policy.Bindings
+	}
+
+	for i := range bindings {
+		if bindings[i].Role != nil {
+			continue
+		}
+		role, err := s.roleRepo.GetByID(bindings[i].RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: failed to get role: %w", i, err)
+		}
+		if role == nil {
+			return nil, fmt.Errorf("binding %d: role not found", i)
+		}
+		bindings[i].Role = role
+	}
+
+	return s.lintBindings(resource, bindings, time.Now())
+}
+
+// ScanPolicies starts a long-running operation that lints every policy. The result holds the
+// unsuppressed findings.
+func (s *IAMService) ScanPolicies() (*domain.Operation, error) {
+	if err := s.authorize("ScanPolicies", nil); err != nil {
+		return nil, err
+	}
+
+	if s.operations == nil {
+		return nil, ErrOperationsDisabled
+	}
+	return s.operations.Submit(OperationScanPolicies, "", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return s.LintPolicies(ctx, progress)
+	})
+}
+
+// LintPolicies lints every policy and returns the unsuppressed findings. progress may be nil.
+func (s *IAMService) LintPolicies(ctx context.Context, progress ProgressFunc) (*PolicyScanResult, error) {
+	policies, err := s.policyRepo.ListWithDetails(nil, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+
+	result := &PolicyScanResult{Policies: len(policies), Findings: []PolicyFinding{}}
+	now := time.Now()
+	for i := range policies {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(int64(i), int64(len(policies)))
+		}
+
+		resource := policies[i].Resource
+		if resource == nil {
+			resource = &domain.Resource{ID: policies[i].ResourceID}
+		}
+		findings, err := s.lintBindings(resource, policies[i].Bindings, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lint policy of resource %s: %w", policies[i].ResourceID, err)
+		}
+		for _, finding := range findings {
+			if finding.Suppressed {
+				result.Suppressed++
+				continue
+			}
+			result.Findings = append(result.Findings, finding)
+		}
+	}
+
+	sortFindings(result.Findings)
+	return result, nil
+}
+
+// lintBindings applies every rule to bindings, whose roles must be loaded
+func (s *IAMService) lintBindings(resource *domain.Resource, bindings []domain.Binding, now time.Time) ([]PolicyFinding, error) {
+	var findings []PolicyFinding
+	var err error
+	var leaf *bool // Looked up once, only when admin.all is granted
+
+	for i := range bindings {
+		binding := &bindings[i]
+		report := func(rule string, severity FindingSeverity, format string, args ...interface{}) {
+			finding := PolicyFinding{
+				Rule:         rule,
+				Severity:     severity,
+				ResourceID:   resource.ID,
+				BindingID:    binding.ID,
+				BindingIndex: i,
+				Message:      fmt.Sprintf(format, args...),
+			}
+			if binding.Role != nil {
+				finding.Role = binding.Role.Name
+			}
+			findings = append(findings, finding)
+		}
+
+		var members []string
+		if len(binding.Members) > 0 {
+			if members, err = binding.GetMembers(); err != nil {
+				return nil, fmt.Errorf("binding %d: invalid members: %w", i, err)
+			}
+		}
+		privileged := binding.Role != nil &&
+			(binding.Role.Name == "roles/owner" || binding.Role.HasPermission(privilegedPermission))
+
+		if len(members) == 0 {
+			report(LintEmptyBinding, SeverityWarning, "binding has no members")
+		}
+		seen := make(map[string]bool, len(members))
+		for _, member := range members {
+			if seen[member] {
+				report(LintDuplicateMember, SeverityInfo, "%s is listed more than once", member)
+			}
+			seen[member] = true
+
+			if !publicMembers[member] {
+				continue
+			}
+			if privileged {
+				report(LintPublicPrivilegedRole, SeverityError, "privileged role is granted to %s", member)
+			} else {
+				report(LintPublicAccess, SeverityWarning, "role is granted to %s", member)
+			}
+		}
+
+		if binding.Role != nil && binding.Role.HasPermission(privilegedPermission) {
+			if leaf == nil {
+				children, err := s.resourceRepo.GetChildren(resource.ID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get children: %w", err)
+				}
+				isLeaf := len(children) == 0
+				leaf = &isLeaf
+			}
+			if *leaf {
+				report(LintAdminOnLeaf, SeverityWarning, "%s is granted on a resource without children; a narrower role is likely enough", privilegedPermission)
+			}
+		}
+
+		if binding.Condition != nil {
+			if err := ValidateConditionExpression(binding.Condition.Expression); err != nil {
+				report(LintInvalidCondition, SeverityError, "%v", err)
+			} else if reason := conditionNeverTrue(binding.Condition.Expression, now); reason != "" {
+				report(LintConditionNeverTrue, SeverityError, "condition %s; the binding grants nothing", reason)
+			}
+		}
+	}
+
+	if err := markSuppressed(bindings, findings); err != nil {
+		return nil, err
+	}
+	sortFindings(findings)
+	return findings, nil
+}
+
+// conditionNeverTrue reports why expression can no longer evaluate to true, or "" if it may.
+// Only a literal false and request.time upper bounds in the past outside of an || are detected.
+func conditionNeverTrue(expression string, now time.Time) string {
+	trimmed := strings.TrimSpace(expression)
+	if trimmed == "false" {
+		return "is always false"
+	}
+	if strings.Contains(trimmed, "||") {
+		return ""
+	}
+
+	for _, pattern := range []*regexp.Regexp{conditionExpiry, conditionExpiryReversed} {
+		for _, match := range pattern.FindAllStringSubmatch(trimmed, -1) {
+			expiry, err := time.Parse(time.RFC3339, match[1])
+			if err == nil && !expiry.After(now) {
+				return fmt.Sprintf("expired at %s", expiry.Format(time.RFC3339))
+			}
+		}
+	}
+	return ""
+}
+
+// markSuppressed flags the findings listed in their binding's LintSuppressAnnotation
+func markSuppressed(bindings []domain.Binding, findings []PolicyFinding) error {
+	for i := range findings {
+		annotations, err := bindings[findings[i].BindingIndex].GetAnnotations()
+		if err != nil {
+			return fmt.Errorf("binding %d: invalid annotations: %w", findings[i].BindingIndex, err)
+		}
+		for _, rule := range strings.Split(annotations[LintSuppressAnnotation], ",") {
+			rule = strings.TrimSpace(rule)
+			if rule == "*" || rule == findings[i].Rule {
+				findings[i].Suppressed = true
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// sortFindings orders findings by severity, then resource and binding position
+func sortFindings(findings []PolicyFinding) {
+	rank := map[FindingSeverity]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if rank[a.Severity] != rank[b.Severity] {
+			return rank[a.Severity] < rank[b.Severity]
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID.String() < b.ResourceID.String()
+		}
+		return a.BindingIndex < b.BindingIndex
+	})
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func findingRules(findings []PolicyFinding) []string {
+	rules := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule)
+	}
+	return rules
+}
+
+func TestIAMService_ValidatePolicy(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	bucketID := uuid.New()
+	resourceRepo.On("GetByID", bucketID).Return(&domain.Resource{ID: bucketID, Type: "bucket"}, nil)
+	resourceRepo.On("GetChildren", bucketID).Return([]domain.Resource{}, nil)
+
+	owner := testRole("roles/owner", "admin.all")
+	viewer := testRole("roles/storage.viewer", "storage.buckets.get")
+	roleRepo.On("GetByID", owner.ID).Return(&owner, nil)
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+
+	bindings := []domain.Binding{
+		{RoleID: owner.ID, Members: toJSON([]string{"allUsers"})},
+		{RoleID: viewer.ID, Members: toJSON([]string{"allAuthenticatedUsers", "user:alice@example.com", "user:alice@example.com"})},
+		{RoleID: viewer.ID, Members: toJSON([]string{})},
+		{RoleID: viewer.ID, Members: toJSON([]string{"user:bob@example.com"}), Condition: &domain.Condition{
+			Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`,
+		}},
+	}
+
+	findings, err := service.ValidatePolicy(bucketID, bindings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		LintPublicPrivilegedRole,
+		LintConditionNeverTrue,
+		LintAdminOnLeaf,
+		LintPublicAccess,
+		LintEmptyBinding,
+		LintDuplicateMember,
+	}, findingRules(findings))
+
+	assert.Equal(t, SeverityError, findings[0].Severity)
+	assert.Equal(t, "roles/owner", findings[0].Role)
+	assert.Equal(t, 0, findings[0].BindingIndex)
+	assert.Equal(t, bucketID, findings[0].ResourceID)
+	assert.Contains(t, findings[1].Message, "expired at 2020-01-01T00:00:00Z")
+	assert.Equal(t, 3, findings[1].BindingIndex)
+	assert.Equal(t, SeverityInfo, findings[5].Severity)
+	for _, finding := range findings {
+		assert.False(t, finding.Suppressed)
+	}
+}
+
+func TestIAMService_ValidatePolicy_Suppressed(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	projectID := uuid.New()
+	resourceRepo.On("GetByID", projectID).Return(&domain.Resource{ID: projectID, Type: "project"}, nil)
+
+	viewer := testRole("roles/storage.viewer", "storage.buckets.get")
+	policyRepo.On("GetByResourceID", projectID).Return(&domain.Policy{ResourceID: projectID, Bindings: []domain.Binding{
+		{ID: uuid.New(), RoleID: viewer.ID, Role: &viewer, Members: toJSON([]string{"allUsers"}),
+			Annotations: []byte(`{"iam.lint/suppress": "empty-binding, public-access"}`)},
+		{ID: uuid.New(), RoleID: viewer.ID, Role: &viewer, Members: toJSON([]string{}),
+			Annotations: []byte(`{"iam.lint/suppress": "*"}`)},
+		{ID: uuid.New(), RoleID: viewer.ID, Role: &viewer, Members: toJSON([]string{"user:alice@example.com"}),
+			Condition: &domain.Condition{Expression: "false"}},
+	}}, nil)
+
+	findings, err := service.ValidatePolicy(projectID, nil)
+	require.NoError(t, err)
+	require.Len(t, findings, 3)
+	assert.Equal(t, LintConditionNeverTrue, findings[0].Rule)
+	assert.False(t, findings[0].Suppressed)
+	assert.True(t, findings[1].Suppressed)
+	assert.True(t, findings[2].Suppressed)
+}
+
+func TestIAMService_ValidatePolicy_ResourceNotFound(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	id := uuid.New()
+	resourceRepo.On("GetByID", id).Return(nil, nil)
+
+	_, err := service.ValidatePolicy(id, nil)
+	assert.ErrorContains(t, err, "resource not found")
+}
+
+func TestIAMService_LintPolicies(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	owner := testRole("roles/owner", "admin.all")
+	viewer := testRole("roles/storage.viewer", "storage.buckets.get")
+	orgID, bucketID := uuid.New(), uuid.New()
+	resourceRepo.On("GetChildren", orgID).Return([]domain.Resource{{ID: bucketID}}, nil)
+	policyRepo.On("ListWithDetails", (*uuid.UUID)(nil), 0, 0).Return([]domain.Policy{
+		{ResourceID: orgID, Resource: &domain.Resource{ID: orgID}, Bindings: []domain.Binding{
+			{ID: uuid.New(), RoleID: owner.ID, Role: &owner, Members: toJSON([]string{"user:admin@example.com"})},
+		}},
+		{ResourceID: bucketID, Resource: &domain.Resource{ID: bucketID}, Bindings: []domain.Binding{
+			{ID: uuid.New(), RoleID: viewer.ID, Role: &viewer, Members: toJSON([]string{"allUsers"})},
+			{ID: uuid.New(), RoleID: viewer.ID, Role: &viewer, Members: toJSON([]string{}),
+				Annotations: []byte(`{"iam.lint/suppress": "empty-binding"}`)},
+		}},
+	}, nil)
+
+	result, err := service.LintPolicies(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Policies)
+	assert.Equal(t, 1, result.Suppressed)
+	assert.Equal(t, []string{LintPublicAccess}, findingRules(result.Findings))
+	assert.Equal(t, bucketID, result.Findings[0].ResourceID)
+}
+
+func TestIAMService_ScanPolicies_Disabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	_, err := service.ScanPolicies()
+	assert.ErrorIs(t, err, ErrOperationsDisabled)
+}
+
+func TestConditionNeverTrue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expression string
+		never      bool
+	}{
+		{`false`, true},
+		{` false `, true},
+		{`true`, false},
+		{`request.time < timestamp("2025-01-01T00:00:00Z")`, true},
+		{`request.time <= timestamp('2025-06-01T00:00:00Z')`, true},
+		{`timestamp("2025-01-01T00:00:00Z") > request.time && resource.type == "bucket"`, true},
+		{`request.time < timestamp("2026-01-01T00:00:00Z")`, false},
+		{`request.time > timestamp("2025-01-01T00:00:00Z")`, false},
+		{`request.time < timestamp("2025-01-01T00:00:00Z") || context.breakglass == "true"`, false},
+		{`resource.type == "bucket"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			assert.Equal(t, tt.never, conditionNeverTrue(tt.expression, now) != "")
+		})
+	}
+}
+
+func TestPolicyScanner(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	scanned := make(chan struct{}, 1)
+	policyRepo.On("ListWithDetails", (*uuid.UUID)(nil), 0, 0).Return([]domain.Policy{}, nil).Run(func(mock.Arguments) {
+		select {
+		case scanned <- struct{}{}:
+		default:
+		}
+	})
+
+	scanner := NewPolicyScanner(service, 10*time.Millisecond, nil)
+	scanner.Start()
+
+	select {
+	case <-scanned:
+	case <-time.After(time.Second):
+		t.Fatal("policies were not scanned")
+	}
+	require.NoError(t, scanner.Stop(context.Background()))
+	require.NoError(t, scanner.Stop(context.Background()))
+}
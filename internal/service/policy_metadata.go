@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pguia/iam/internal/domain"
+)
+
+// withMetadata sets the metadata of a policy returned by the API, taking the last modification
+// from its latest revision
+func (s *IAMService) withMetadata(policy *domain.Policy) (*domain.Policy, error) {
+	revisions, err := s.revisionRepo.List(policy.ID, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest policy revision: %w", err)
+	}
+	var latest *domain.PolicyRevision
+	if len(revisions) > 0 {
+		latest = &revisions[0]
+	}
+	policy.Metadata = policyMetadata(canonicalPolicy(policy), latest)
+	return policy, nil
+}
+
+// policyMetadata summarizes the bindings of a policy loaded with their roles. Without a revision,
+// e.g. for policies created before revisions were recorded, the author is unknown.
+func policyMetadata(policy *domain.Policy, latest *domain.PolicyRevision) *domain.PolicyMetadata {
+	metadata := &domain.PolicyMetadata{
+		Bindings:       len(policy.Bindings),
+		Roles:          []string{},
+		LastModifiedAt: policy.UpdatedAt,
+	}
+	if latest != nil {
+		metadata.LastModifiedBy = latest.Author
+		metadata.LastModifiedAt = latest.CreatedAt
+	}
+
+	members := make(map[string]bool)
+	roles := make(map[string]bool)
+	for i := range policy.Bindings {
+		binding := &policy.Bindings[i]
+		if binding.Role != nil && !roles[binding.Role.Name] {
+			roles[binding.Role.Name] = true
+			metadata.Roles = append(metadata.Roles, binding.Role.Name)
+		}
+		bindingMembers, err := binding.GetMembers()
+		if err != nil {
+			continue
+		}
+		for _, member := range bindingMembers {
+			members[member] = true
+			if publicMembers[member] {
+				metadata.PublicMembers = true
+			}
+		}
+	}
+	metadata.Members = len(members)
+	sort.Strings(metadata.Roles)
+	return metadata
+}
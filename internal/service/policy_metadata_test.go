@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyMetadata(t *testing.T) {
+	viewer := testRole("roles/viewer", "docs.read")
+	editor := testRole("roles/editor", "docs.read", "docs.write")
+	updated := time.Now().Add(-time.Hour)
+	policy := &domain.Policy{
+		ID:        uuid.New(),
+		UpdatedAt: updated,
+		Bindings: []domain.Binding{
+			testBinding(&viewer, "user:alice@example.com", "allUsers"),
+			testBinding(&editor, "user:alice@example.com", "group:eng@example.com"),
+			testBinding(&viewer, "user:bob@example.com"),
+		},
+	}
+
+	metadata := policyMetadata(policy, nil)
+	assert.Equal(t, 3, metadata.Bindings)
+	assert.Equal(t, 4, metadata.Members)
+	assert.Equal(t, []string{"roles/editor", "roles/viewer"}, metadata.Roles)
+	assert.True(t, metadata.PublicMembers)
+	assert.Empty(t, metadata.LastModifiedBy)
+	assert.Equal(t, updated, metadata.LastModifiedAt)
+
+	revised := time.Now()
+	metadata = policyMetadata(&domain.Policy{}, &domain.PolicyRevision{Author: "user:admin@example.com", CreatedAt: revised})
+	assert.Zero(t, metadata.Members)
+	assert.Empty(t, metadata.Roles)
+	assert.False(t, metadata.PublicMembers)
+	assert.Equal(t, "user:admin@example.com", metadata.LastModifiedBy)
+	assert.Equal(t, revised, metadata.LastModifiedAt)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gorm.io/datatypes"
+)
+
+// normalizeBindings returns bindings as they are stored: the members of each binding sorted and
+// deduplicated, and bindings granting the same role under the same condition merged into the
+// first of them. A merged binding keeps the annotations of the first, plus those only the others
+// have. Bindings are not reordered, so a policy written twice is stored the same way.
+func normalizeBindings(bindings []domain.Binding) ([]domain.Binding, error) {
+	normalized := make([]domain.Binding, 0, len(bindings))
+	for i := range bindings {
+		members, err := bindings[i].GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: invalid members: %w", i, err)
+		}
+
+		merged := indexOfGrant(normalized, bindings[i].RoleID, bindings[i].Condition)
+		if merged < 0 {
+			binding := bindings[i]
+			if binding.Members, err = membersJSON(members); err != nil {
+				return nil, err
+			}
+			normalized = append(normalized, binding)
+			continue
+		}
+
+		into := &normalized[merged]
+		existing, err := into.GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: invalid members: %w", i, err)
+		}
+		if into.Members, err = membersJSON(append(existing, members...)); err != nil {
+			return nil, err
+		}
+		if into.Annotations, err = mergeAnnotations(into, &bindings[i]); err != nil {
+			return nil, fmt.Errorf("binding %d: %w", i, err)
+		}
+	}
+	return normalized, nil
+}
+
+// normalizeMembers sorts and deduplicates members
+func normalizeMembers(members []string) []string {
+	members = slices.Clone(members)
+	slices.Sort(members)
+	return slices.Compact(members)
+}
+
+// membersJSON encodes members normalized, failing if one does not follow the member grammar
+func membersJSON(members []string) (datatypes.JSON, error) {
+	for _, member := range members {
+		if _, err := domain.ParseMember(member); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(normalizeMembers(members))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal members: %w", err)
+	}
+	return datatypes.JSON(encoded), nil
+}
+
+// indexOfGrant returns the index of the binding granting roleID under condition, or -1 if none does
+func indexOfGrant(bindings []domain.Binding, roleID uuid.UUID, condition *domain.Condition) int {
+	return slices.IndexFunc(bindings, func(binding domain.Binding) bool {
+		return binding.RoleID == roleID && sameCondition(binding.Condition, condition)
+	})
+}
+
+// mergeBindings adds bindings to those of policy, merging the bindings that grant a role of the
+// policy under the same condition into the existing binding, which is replaced by a new one
+func (s *IAMService) mergeBindings(policy *domain.Policy, bindings []domain.Binding) (*domain.Policy, error) {
+	return s.replaceBindings(policy, append(slices.Clip(policy.Bindings), bindings...))
+}
+
+// sameCondition reports whether two binding conditions, either of which may be nil, are the same
+func sameCondition(a, b *domain.Condition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Expression == b.Expression && a.Title == b.Title && a.Description == b.Description
+}
+
+// mergeAnnotations returns the annotations of into with those of from it does not have
+func mergeAnnotations(into, from *domain.Binding) (datatypes.JSON, error) {
+	annotations, err := into.GetAnnotations()
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations: %w", err)
+	}
+	others, err := from.GetAnnotations()
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations: %w", err)
+	}
+	if len(others) == 0 {
+		return into.Annotations, nil
+	}
+
+	merged := maps.Clone(others)
+	maps.Copy(merged, annotations)
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal annotations: %w", err)
+	}
+	return datatypes.JSON(encoded), nil
+}
+
+// canonicalPolicy sorts and deduplicates the members of each binding of policy, and sorts its
+// bindings by role name, condition and members, so that equal policies read the same whatever
+// order they were written in, including policies stored before writes were normalized
+func canonicalPolicy(policy *domain.Policy) *domain.Policy {
+	for i := range policy.Bindings {
+		binding := &policy.Bindings[i]
+		if members, err := binding.GetMembers(); err == nil {
+			if encoded, err := membersJSON(members); err == nil {
+				binding.Members = encoded
+			}
+		}
+	}
+	slices.SortStableFunc(policy.Bindings, func(a, b domain.Binding) int {
+		return cmp.Or(
+			strings.Compare(bindingRoleName(&a), bindingRoleName(&b)),
+			strings.Compare(bindingExpression(&a), bindingExpression(&b)),
+			strings.Compare(string(a.Members), string(b.Members)),
+		)
+	})
+	return policy
+}
+
+// bindingRoleName is the name of the role of a binding, or its ID when the role is not loaded
+func bindingRoleName(binding *domain.Binding) string {
+	if binding.Role != nil {
+		return binding.Role.Name
+	}
+	return binding.RoleID.String()
+}
+
+// bindingExpression is the condition expression of a binding, empty when it has none
+func bindingExpression(binding *domain.Binding) string {
+	if binding.Condition != nil {
+		return binding.Condition.Expression
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeBindings(t *testing.T) {
+	viewer, editor := uuid.New(), uuid.New()
+	prod := &domain.Condition{Title: "prod", Expression: `context.env == "prod"`}
+
+	normalized, err := normalizeBindings([]domain.Binding{
+		{RoleID: viewer, Members: toJSON([]string{"user:bob@example.com", "user:alice@example.com", "user:bob@example.com"})},
+		{RoleID: editor, Members: toJSON([]string{"user:carol@example.com"})},
+		{RoleID: viewer, Members: toJSON([]string{"user:carol@example.com"}), Condition: prod},
+		{RoleID: viewer, Members: toJSON([]string{"user:alice@example.com", "user:dave@example.com"}),
+			Annotations: []byte(`{"owner": "team-a"}`)},
+		{RoleID: viewer, Members: toJSON([]string{"user:erin@example.com"}),
+			Condition: &domain.Condition{Title: "prod", Expression: `context.env == "prod"`}},
+	})
+	require.NoError(t, err)
+	require.Len(t, normalized, 3)
+
+	assert.Equal(t, viewer, normalized[0].RoleID)
+	assert.JSONEq(t, `["user:alice@example.com", "user:bob@example.com", "user:dave@example.com"]`, string(normalized[0].Members))
+	assert.JSONEq(t, `{"owner": "team-a"}`, string(normalized[0].Annotations))
+	assert.Equal(t, editor, normalized[1].RoleID)
+	assert.Same(t, prod, normalized[2].Condition)
+	assert.JSONEq(t, `["user:carol@example.com", "user:erin@example.com"]`, string(normalized[2].Members))
+
+	_, err = normalizeBindings([]domain.Binding{{RoleID: viewer, Members: []byte(`{`)}})
+	assert.ErrorContains(t, err, "binding 0: invalid members")
+
+	// Members are written only if they follow the member grammar
+	_, err = normalizeBindings([]domain.Binding{{RoleID: viewer, Members: toJSON([]string{"user:alice@example.com", "alice"})}})
+	assert.ErrorIs(t, err, domain.ErrInvalidPrincipal)
+}
+
+func TestCanonicalPolicy(t *testing.T) {
+	viewer := testRole("roles/viewer")
+	admin := testRole("roles/admin")
+	conditional := testBinding(&viewer, "user:carol@example.com")
+	conditional.Condition = &domain.Condition{Expression: `context.env == "prod"`}
+	policy := &domain.Policy{Bindings: []domain.Binding{
+		conditional,
+		testBinding(&viewer, "user:bob@example.com", "user:alice@example.com", "user:bob@example.com"),
+		testBinding(&admin, "user:root@example.com"),
+	}}
+
+	canonicalPolicy(policy)
+	assert.Equal(t, "roles/admin", policy.Bindings[0].Role.Name)
+	assert.JSONEq(t, `["user:alice@example.com", "user:bob@example.com"]`, string(policy.Bindings[1].Members))
+	assert.Equal(t, conditional.ID, policy.Bindings[2].ID)
+}
+
+// Test: A binding of a role already granted under the same condition is merged into it
+func TestIAMService_CreateBinding_Merges(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+	resourceID := uuid.New()
+	existing := testBinding(&viewer, "user:bob@example.com")
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Version: 1, Bindings: []domain.Binding{existing}}
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+
+	binding, err := service.DryRun().CreateBinding(resourceID, viewer.ID, []string{"user:alice@example.com", "user:bob@example.com"}, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["user:alice@example.com", "user:bob@example.com"]`, string(binding.Members))
+
+	// The merged binding replaces the existing one
+	bindingRepo.On("Delete", existing.ID).Return(nil).Once()
+	bindingRepo.On("Create", mock.MatchedBy(func(b *domain.Binding) bool {
+		return string(b.Members) == `["user:alice@example.com","user:bob@example.com"]`
+	})).Return(nil).Once()
+	policyRepo.On("Update", policy).Return(nil).Once()
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Once()
+
+	_, err = service.CreateBinding(resourceID, viewer.ID, []string{"user:alice@example.com"}, nil)
+	require.NoError(t, err)
+	bindingRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+}
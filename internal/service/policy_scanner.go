@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// PolicyScanner lints every policy periodically and logs the unsuppressed findings
+type PolicyScanner struct {
+	service  *IAMService
+	interval time.Duration
+	logger   *slog.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPolicyScanner creates a scanner running every interval. A nil logger uses slog.Default().
+func NewPolicyScanner(service *IAMService, interval time.Duration, logger *slog.Logger) *PolicyScanner {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &PolicyScanner{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the first scan after one interval and then every interval until Stop
+func (p *PolicyScanner) Start() {
+	go p.run()
+}
+
+// Stop cancels a running scan and waits for the scanner to exit or ctx to expire
+func (p *PolicyScanner) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *PolicyScanner) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.scan()
+		}
+	}
+}
+
+// scan lints all policies, cancelling the scan when the scanner stops
+func (p *PolicyScanner) scan() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	result, err := p.service.LintPolicies(ctx, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("Policy scan failed", "error", err)
+		}
+		return
+	}
+
+	for _, finding := range result.Findings {
+		level := slog.LevelWarn
+		if finding.Severity == SeverityInfo {
+			level = slog.LevelInfo
+		}
+		p.logger.Log(ctx, level, "Policy lint finding",
+			"rule", finding.Rule,
+			"severity", finding.Severity,
+			"resource_id", finding.ResourceID,
+			"binding_id", finding.BindingID,
+			"role", finding.Role,
+			"message", finding.Message)
+	}
+	p.logger.Info("Policy scan finished",
+		"policies", result.Policies,
+		"findings", len(result.Findings),
+		"suppressed", result.Suppressed)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// PolicySnapshot is what a replica of a subtree needs to evaluate checks: its resources and
+// policies and those of the ancestors it inherits from
+type PolicySnapshot struct {
+	Root      uuid.UUID
+	Resources []domain.Resource // The root's ancestors, the root and its descendants, with their tags
+	Policies  []domain.Policy   // Of those resources, with bindings, roles, permissions and conditions
+	Roles     []domain.Role     // Granted by the policies, with their permissions
+	Revision  int64             // Grows with every change of a resource, policy or role
+	Time      time.Time
+}
+
+// GetPolicySnapshot reads the subtree of rootResourceID and its ancestors in one transaction.
+// Replicas pair it with WatchPolicies: they load a snapshot after the stream's initial resync
+// and after each change it reports, and keep the snapshot of the highest revision.
+func (s *IAMService) GetPolicySnapshot(ctx context.Context, rootResourceID uuid.UUID) (*PolicySnapshot, error) {
+	if err := s.authorize("GetPolicySnapshot", &rootResourceID); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.resourceRepo.GetSnapshot(rootResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy snapshot: %w", err)
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+	return &PolicySnapshot{
+		Root:      rootResourceID,
+		Resources: snapshot.Resources,
+		Policies:  snapshot.Policies,
+		Roles:     snapshot.Roles,
+		Revision:  snapshot.Revision,
+		Time:      time.Now().UTC(),
+	}, nil
+}
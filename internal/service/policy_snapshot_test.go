@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_GetPolicySnapshot(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	root := uuid.New()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	resourceRepo.On("GetSnapshot", root).Return(&repository.ResourceSnapshot{
+		Resources: []domain.Resource{{ID: root}},
+		Policies:  []domain.Policy{{ResourceID: root, Bindings: []domain.Binding{testBinding(&viewer, "user:alice@example.com")}}},
+		Roles:     []domain.Role{viewer},
+		Revision:  42,
+	}, nil)
+
+	snapshot, err := service.GetPolicySnapshot(context.Background(), root)
+	require.NoError(t, err)
+	assert.Equal(t, root, snapshot.Root)
+	assert.Len(t, snapshot.Resources, 1)
+	assert.Len(t, snapshot.Policies, 1)
+	assert.Equal(t, []domain.Role{viewer}, snapshot.Roles)
+	assert.Equal(t, int64(42), snapshot.Revision)
+	assert.False(t, snapshot.Time.IsZero())
+
+	missing := uuid.New()
+	resourceRepo.On("GetSnapshot", missing).Return(nil, nil)
+	_, err = service.GetPolicySnapshot(context.Background(), missing)
+	assert.ErrorContains(t, err, "resource not found")
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// PolicyState is the declarative state of the policies of a subtree, as exported by ExportState
+// and applied by ImportState
+type PolicyState struct {
+	Root     uuid.UUID
+	Policies []domain.Policy // Of the root and its descendants that have one, ordered by resource path
+	Revision int64           // Grows with every change of a resource, policy or role
+}
+
+// SetPolicy replaces the bindings of a resource's policy, creating the policy if the resource has
+// none. With an etag, the current policy must have it; without, the policy is replaced whatever
+// its state. Bindings identical to a current one keep their ID, and a policy left unchanged keeps
+// its version and etag, so reapplying the same bindings is a no-op. The result is read back from
+// the primary, so it can be compared with the declared state directly. Creating a policy also
+// requires the permissions of CreatePolicy.
+func (s *IAMService) SetPolicy(resourceID uuid.UUID, bindings []domain.Binding, etag string) (*domain.Policy, error) {
+	if err := s.authorize("SetPolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		if etag != "" {
+			return nil, fmt.Errorf("policy not found, etag mismatch")
+		}
+		return s.CreatePolicy(resourceID, bindings)
+	}
+
+	if etag != "" && policy.ETag != etag {
+		return nil, fmt.Errorf("policy has been modified, etag mismatch")
+	}
+	if err := s.authorizeGrants(resourceID, GrantChange{Add: bindings, Replace: true}); err != nil {
+		return nil, err
+	}
+
+	if kept, _ := matchBindings(policy.Bindings, bindings); len(kept) == len(policy.Bindings) && len(kept) == len(bindings) {
+		return s.withMetadata(policy)
+	}
+	return s.replaceBindings(policy, bindings)
+}
+
+// ExportState reads the policies of rootResourceID and its descendants from the primary in one
+// transaction, in canonical order, so that successive exports of an unchanged subtree are identical
+func (s *IAMService) ExportState(rootResourceID uuid.UUID) (*PolicyState, error) {
+	if err := s.authorize("ExportState", &rootResourceID); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.resourceRepo.GetSnapshot(rootResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy state: %w", err)
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	// The snapshot starts with the root's ancestors, whose policies are not part of the subtree
+	paths := make(map[uuid.UUID]string, len(snapshot.Resources))
+	root := slices.IndexFunc(snapshot.Resources, func(resource domain.Resource) bool {
+		return resource.ID == rootResourceID
+	})
+	for _, resource := range snapshot.Resources[root:] {
+		paths[resource.ID] = resource.Path
+	}
+
+	state := &PolicyState{Root: rootResourceID, Policies: []domain.Policy{}, Revision: snapshot.Revision}
+	for i := range snapshot.Policies {
+		if _, ok := paths[snapshot.Policies[i].ResourceID]; ok {
+			state.Policies = append(state.Policies, *canonicalPolicy(&snapshot.Policies[i]))
+		}
+	}
+	slices.SortFunc(state.Policies, func(a, b domain.Policy) int {
+		return cmp.Or(strings.Compare(paths[a.ResourceID], paths[b.ResourceID]), strings.Compare(a.ResourceID.String(), b.ResourceID.String()))
+	})
+	return state, nil
+}
+
+// ImportState applies the policies of a state to resources of the subtree of rootResourceID, as
+// SetPolicy would, using each policy's etag. Resources of the subtree whose policy is not listed
+// are left as they are. Every policy is validated before any is applied; if applying one fails,
+// the policies applied before it are returned with the error.
+func (s *IAMService) ImportState(rootResourceID uuid.UUID, policies []domain.Policy) ([]domain.Policy, error) {
+	if err := s.authorize("ImportState", &rootResourceID); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.resourceRepo.GetSnapshot(rootResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy state: %w", err)
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+	root := slices.IndexFunc(snapshot.Resources, func(resource domain.Resource) bool {
+		return resource.ID == rootResourceID
+	})
+	subtree := make(map[uuid.UUID]bool, len(snapshot.Resources)-root)
+	for _, resource := range snapshot.Resources[root:] {
+		subtree[resource.ID] = true
+	}
+
+	seen := make(map[uuid.UUID]bool, len(policies))
+	for i := range policies {
+		resourceID := policies[i].ResourceID
+		if !subtree[resourceID] {
+			return nil, fmt.Errorf("policy %d: resource %s is not in the subtree of %s", i, resourceID, rootResourceID)
+		}
+		if seen[resourceID] {
+			return nil, fmt.Errorf("policy %d: resource %s listed more than once", i, resourceID)
+		}
+		seen[resourceID] = true
+
+		if _, err := s.DryRun().SetPolicy(resourceID, slices.Clone(policies[i].Bindings), policies[i].ETag); err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+	}
+	applied := make([]domain.Policy, 0, len(policies))
+	for i := range policies {
+		policy, err := s.SetPolicy(policies[i].ResourceID, policies[i].Bindings, policies[i].ETag)
+		if err != nil {
+			return applied, fmt.Errorf("policy %d: %w", i, err)
+		}
+		applied = append(applied, *policy)
+	}
+	return applied, nil
+}
+
+// matchBindings pairs each desired binding with a distinct identical current binding, returning
+// the IDs of the current bindings that were matched and the match of each desired binding, if any
+func matchBindings(current, desired []domain.Binding) (map[uuid.UUID]bool, []*domain.Binding) {
+	kept := make(map[uuid.UUID]bool)
+	matches := make([]*domain.Binding, len(desired))
+	for i := range desired {
+		for j := range current {
+			if !kept[current[j].ID] && sameBinding(current[j], desired[i]) {
+				kept[current[j].ID] = true
+				matches[i] = &current[j]
+				break
+			}
+		}
+	}
+	return kept, matches
+}
+
+// sameBinding reports whether two bindings grant the same role to the same members, in any
+// order, under the same condition and with the same annotations
+func sameBinding(a, b domain.Binding) bool {
+	if a.RoleID != b.RoleID || !sameCondition(a.Condition, b.Condition) {
+		return false
+	}
+
+	aMembers, errA := a.GetMembers()
+	bMembers, errB := b.GetMembers()
+	if errA != nil || errB != nil {
+		return false
+	}
+	if !slices.Equal(normalizeMembers(aMembers), normalizeMembers(bMembers)) {
+		return false
+	}
+
+	aAnnotations, errA := a.GetAnnotations()
+	bAnnotations, errB := b.GetAnnotations()
+	return errA == nil && errB == nil && maps.Equal(aAnnotations, bAnnotations)
+}
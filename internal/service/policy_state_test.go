@@ -0,0 +1,131 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_SetPolicy(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	editor := testRole("roles/editor", "storage.buckets.update")
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+	roleRepo.On("GetByID", editor.ID).Return(&editor, nil)
+
+	resourceID := uuid.New()
+	kept := testBinding(&viewer, "user:bob@example.com", "user:alice@example.com")
+	removed := testBinding(&editor, "user:carol@example.com")
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: resourceID, Version: 2, ETag: "etag-2",
+		Bindings: []domain.Binding{removed, kept}}
+	policyRepo.On("GetByResourceID", resourceID).Return(policy, nil)
+	revisionRepo.On("List", policy.ID, 1, 0).Return([]domain.PolicyRevision{}, nil)
+
+	_, err := service.SetPolicy(resourceID, nil, "stale")
+	assert.ErrorContains(t, err, "etag mismatch")
+
+	// The same bindings in another order change nothing
+	same := []domain.Binding{
+		{RoleID: editor.ID, Members: toJSON([]string{"user:carol@example.com"})},
+		{RoleID: viewer.ID, Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com"})},
+	}
+	result, err := service.SetPolicy(resourceID, same, "etag-2")
+	require.NoError(t, err)
+	assert.Equal(t, "etag-2", result.ETag)
+	require.Len(t, result.Bindings, 2)
+	assert.Equal(t, "roles/editor", result.Bindings[0].Role.Name)
+	assert.Equal(t, kept.ID, result.Bindings[1].ID)
+	assert.JSONEq(t, `["user:alice@example.com", "user:bob@example.com"]`, string(result.Bindings[1].Members))
+
+	// Only the changed binding is replaced; the other keeps its ID, as Create only expects the editor
+	bindingRepo.On("Delete", removed.ID).Return(nil).Once()
+	bindingRepo.On("Create", mock.MatchedBy(func(b *domain.Binding) bool { return b.RoleID == editor.ID })).
+		Return(nil).Once()
+	policyRepo.On("Update", policy).Return(nil).Once()
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Once()
+	changed := []domain.Binding{
+		{RoleID: viewer.ID, Members: toJSON([]string{"user:alice@example.com", "user:bob@example.com"})},
+		{RoleID: editor.ID, Members: toJSON([]string{"user:dave@example.com"})},
+	}
+	_, err = service.SetPolicy(resourceID, changed, "")
+	require.NoError(t, err)
+	bindingRepo.AssertExpectations(t)
+	policyRepo.AssertExpectations(t)
+
+	missing := uuid.New()
+	policyRepo.On("GetByResourceID", missing).Return(nil, nil)
+	_, err = service.SetPolicy(missing, nil, "etag-1")
+	assert.ErrorContains(t, err, "policy not found")
+}
+
+func TestIAMService_ExportState(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	editor := testRole("roles/editor", "storage.buckets.update")
+
+	org, folder, project := uuid.New(), uuid.New(), uuid.New()
+	folderPath := domain.ResourcePath(domain.ResourcePath("", org), folder)
+	resourceRepo.On("GetSnapshot", folder).Return(&repository.ResourceSnapshot{
+		Resources: []domain.Resource{
+			{ID: org, Path: domain.ResourcePath("", org)},
+			{ID: folder, Path: folderPath},
+			{ID: project, Path: domain.ResourcePath(folderPath, project)},
+		},
+		Policies: []domain.Policy{
+			{ResourceID: project, Bindings: []domain.Binding{
+				testBinding(&viewer, "user:bob@example.com", "user:alice@example.com"),
+				testBinding(&editor, "user:carol@example.com"),
+			}},
+			{ResourceID: org, Bindings: []domain.Binding{testBinding(&viewer, "user:admin@example.com")}},
+			{ResourceID: folder},
+		},
+		Revision: 7,
+	}, nil)
+
+	state, err := service.ExportState(folder)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), state.Revision)
+	require.Len(t, state.Policies, 2)
+	assert.Equal(t, folder, state.Policies[0].ResourceID)
+	assert.Equal(t, project, state.Policies[1].ResourceID)
+	bindings := state.Policies[1].Bindings
+	assert.Equal(t, "roles/editor", bindings[0].Role.Name)
+	assert.JSONEq(t, `["user:alice@example.com", "user:bob@example.com"]`, string(bindings[1].Members))
+
+	missing := uuid.New()
+	resourceRepo.On("GetSnapshot", missing).Return(nil, nil)
+	_, err = service.ExportState(missing)
+	assert.ErrorContains(t, err, "resource not found")
+}
+
+// Test: Nothing is applied unless every policy of the state is valid
+func TestIAMService_ImportState(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	root, child := uuid.New(), uuid.New()
+	resourceRepo.On("GetSnapshot", root).Return(&repository.ResourceSnapshot{
+		Resources: []domain.Resource{{ID: root}, {ID: child}},
+	}, nil)
+	policyRepo.On("GetByResourceID", root).Return(&domain.Policy{ID: uuid.New(), ResourceID: root, ETag: "a"}, nil)
+	policyRepo.On("GetByResourceID", child).Return(&domain.Policy{ID: uuid.New(), ResourceID: child, ETag: "b"}, nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("List", mock.Anything, 1, 0).Return([]domain.PolicyRevision{}, nil)
+
+	_, err := service.ImportState(root, []domain.Policy{{ResourceID: root, ETag: "a"}, {ResourceID: child, ETag: "stale"}})
+	assert.ErrorContains(t, err, "policy 1: policy has been modified, etag mismatch")
+
+	_, err = service.ImportState(root, []domain.Policy{{ResourceID: uuid.New()}})
+	assert.ErrorContains(t, err, "is not in the subtree")
+	_, err = service.ImportState(root, []domain.Policy{{ResourceID: child}, {ResourceID: child}})
+	assert.ErrorContains(t, err, "listed more than once")
+}
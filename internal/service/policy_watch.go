@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of policy changes
+const (
+	PolicyChangeUpdated  = "updated"  // Bindings of the resource's policy were created, replaced or deleted
+	PolicyChangeDeleted  = "deleted"  // The resource's policy was deleted
+	PolicyChangeResource = "resource" // The resource was moved, deleted, restored or retagged; policies inherited by its subtree changed
+	PolicyChangeResync   = "resync"   // Changes were missed; everything under the watched resource must be reloaded
+)
+
+// DefaultPolicyWatchBuffer is the number of changes queued for a watcher before it must resync
+const DefaultPolicyWatchBuffer = 256
+
+// PolicyChange notifies a watcher that access under a resource changed
+type PolicyChange struct {
+	Kind       string
+	ResourceID uuid.UUID // uuid.Nil for resync
+	Version    int       // Version of the policy after an update
+	ETag       string    // ETag of the policy after an update
+	Time       time.Time
+
+	// The resource's ancestors, parent first, to match watchers of a subtree; nil matches every watcher
+	ancestors []uuid.UUID
+}
+
+// PolicyWatcher fans policy changes out to the WatchPolicies streams of this server
+type PolicyWatcher struct {
+	buffer int
+
+	mu            sync.RWMutex
+	subscriptions map[*policySubscription]struct{}
+}
+
+// policySubscription queues the changes of one WatchPolicies stream
+type policySubscription struct {
+	root      uuid.UUID
+	ancestors atomic.Pointer[[]uuid.UUID] // Of root; their policies are inherited by the watched subtree
+	changes   chan PolicyChange
+	lagged    atomic.Bool // A change was dropped because the queue was full
+}
+
+// NewPolicyWatcher creates a watcher queuing up to buffer changes per stream
+// (DefaultPolicyWatchBuffer if zero)
+func NewPolicyWatcher(buffer int) *PolicyWatcher {
+	if buffer <= 0 {
+		buffer = DefaultPolicyWatchBuffer
+	}
+	return &PolicyWatcher{
+		buffer:        buffer,
+		subscriptions: make(map[*policySubscription]struct{}),
+	}
+}
+
+// Watchers returns the number of open WatchPolicies streams
+func (w *PolicyWatcher) Watchers() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.subscriptions)
+}
+
+// Publish queues change for every stream watching one of its resources. It never blocks: a stream
+// whose queue is full is sent a resync once it catches up.
+func (w *PolicyWatcher) Publish(change PolicyChange) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for sub := range w.subscriptions {
+		if !sub.matches(&change) {
+			continue
+		}
+		select {
+		case sub.changes <- change:
+		default:
+			sub.lagged.Store(true)
+		}
+	}
+}
+
+func (w *PolicyWatcher) subscribe(root uuid.UUID) *policySubscription {
+	sub := &policySubscription{root: root, changes: make(chan PolicyChange, w.buffer)}
+	w.mu.Lock()
+	w.subscriptions[sub] = struct{}{}
+	w.mu.Unlock()
+	return sub
+}
+
+func (w *PolicyWatcher) unsubscribe(sub *policySubscription) {
+	w.mu.Lock()
+	delete(w.subscriptions, sub)
+	w.mu.Unlock()
+}
+
+// matches reports whether change concerns the subtree watched by sub or the ancestors it inherits from
+func (sub *policySubscription) matches(change *PolicyChange) bool {
+	if change.ancestors == nil || change.ResourceID == sub.root {
+		return true
+	}
+	for _, id := range change.ancestors {
+		if id == sub.root {
+			return true
+		}
+	}
+	return sub.inherits(change.ResourceID)
+}
+
+// inherits reports whether id is an ancestor of the watched root
+func (sub *policySubscription) inherits(id uuid.UUID) bool {
+	if ancestors := sub.ancestors.Load(); ancestors != nil {
+		for _, ancestor := range *ancestors {
+			if ancestor == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// watchAncestors (re)loads the ancestors of the watched root
+func (s *IAMService) watchAncestors(sub *policySubscription) error {
+	ancestors, err := s.resourceRepo.GetAncestors(sub.root)
+	if err != nil {
+		return fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	ids := make([]uuid.UUID, len(ancestors))
+	for i := range ancestors {
+		ids[i] = ancestors[i].ID
+	}
+	sub.ancestors.Store(&ids)
+	return nil
+}
+
+// SetPolicyWatcher publishes the policy changes made through the service to watcher.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetPolicyWatcher(watcher *PolicyWatcher) {
+	s.policyWatcher = watcher
+}
+
+// watchingPolicies reports whether policy changes have to be published
+func (s *IAMService) watchingPolicies() bool {
+	return s.policyWatcher != nil && s.policyWatcher.Watchers() > 0
+}
+
+// newPolicyChange describes a change of resourceID for its watchers, or returns nil if nobody
+// watches. Build it before deleting or moving the resource so its current ancestors are notified.
+func (s *IAMService) newPolicyChange(kind string, resourceID uuid.UUID, version int) *PolicyChange {
+	if !s.watchingPolicies() {
+		return nil
+	}
+
+	change := &PolicyChange{Kind: kind, ResourceID: resourceID, Version: version}
+	if resourceID == uuid.Nil {
+		change.Kind = PolicyChangeResync
+		return change
+	}
+	// Without ancestors the change is sent to every watcher, which is safe for cache invalidation
+	if ancestors, err := s.resourceRepo.GetAncestors(resourceID); err == nil {
+		change.ancestors = make([]uuid.UUID, len(ancestors))
+		for i := range ancestors {
+			change.ancestors[i] = ancestors[i].ID
+		}
+	}
+	return change
+}
+
+// publishPolicyChange sends change, if any, to the watchers
+func (s *IAMService) publishPolicyChange(change *PolicyChange) {
+	if change == nil {
+		return
+	}
+	change.Time = time.Now().UTC()
+	s.policyWatcher.Publish(*change)
+}
+
+// WatchPolicies calls emit for each policy change in the subtree of rootResourceID, or on one of
+// its ancestors, until ctx is done or emit fails. Only changes made through this server are seen.
+// Changes are not replayed: the first change is a resync, emitted once the stream is open, after
+// which the watcher loads the policies it caches. A later resync means changes were missed and
+// the subtree must be reloaded.
+func (s *IAMService) WatchPolicies(ctx context.Context, rootResourceID uuid.UUID, emit func(*PolicyChange) error) error {
+	if err := s.authorize("WatchPolicies", &rootResourceID); err != nil {
+		return err
+	}
+
+	if s.policyWatcher == nil {
+		return fmt.Errorf("policy watching is not enabled")
+	}
+	root, err := s.resourceRepo.GetByID(rootResourceID)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return fmt.Errorf("resource not found")
+	}
+
+	sub := s.policyWatcher.subscribe(rootResourceID)
+	defer s.policyWatcher.unsubscribe(sub)
+	if err := s.watchAncestors(sub); err != nil {
+		return err
+	}
+	if err := emit(&PolicyChange{Kind: PolicyChangeResync, Time: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change := <-sub.changes:
+			if err := emit(&change); err != nil {
+				return err
+			}
+			// Moving the root or one of its ancestors changes what the subtree inherits from
+			if change.Kind == PolicyChangeResource && (change.ResourceID == rootResourceID || sub.inherits(change.ResourceID)) {
+				if err := s.watchAncestors(sub); err != nil {
+					return err
+				}
+			}
+		}
+		// Once the queue is drained, report the changes dropped while it was full
+		if len(sub.changes) == 0 && sub.lagged.Swap(false) {
+			if err := emit(&PolicyChange{Kind: PolicyChangeResync, Time: time.Now().UTC()}); err != nil {
+				return err
+			}
+		}
+	}
+}
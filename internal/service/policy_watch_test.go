@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyWatcher_PublishMatchesSubtree(t *testing.T) {
+	watcher := NewPolicyWatcher(10)
+	org := uuid.New()
+	project := uuid.New()
+	other := uuid.New()
+
+	orgSub := watcher.subscribe(org)
+	projectSub := watcher.subscribe(project)
+	assert.Equal(t, 2, watcher.Watchers())
+
+	watcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: project, ancestors: []uuid.UUID{org}})
+	watcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: other, ancestors: []uuid.UUID{}})
+	watcher.Publish(PolicyChange{Kind: PolicyChangeResync})
+
+	assert.Len(t, orgSub.changes, 2)
+	assert.Len(t, projectSub.changes, 2)
+	assert.Equal(t, project, (<-orgSub.changes).ResourceID)
+	assert.Equal(t, PolicyChangeResync, (<-orgSub.changes).Kind)
+
+	watcher.unsubscribe(orgSub)
+	watcher.unsubscribe(projectSub)
+	assert.Equal(t, 0, watcher.Watchers())
+}
+
+func TestPolicyWatcher_PublishMatchesInheritedPolicies(t *testing.T) {
+	watcher := NewPolicyWatcher(10)
+	org := uuid.New()
+	project := uuid.New()
+
+	sub := watcher.subscribe(project)
+	sub.ancestors.Store(&[]uuid.UUID{org})
+
+	watcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: org, ancestors: []uuid.UUID{}})
+	watcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: uuid.New(), ancestors: []uuid.UUID{org}})
+
+	require.Len(t, sub.changes, 1)
+	assert.Equal(t, org, (<-sub.changes).ResourceID)
+}
+
+// watch runs WatchPolicies in the background, returning its changes and its result
+func watch(t *testing.T, service *IAMService, ctx context.Context, root uuid.UUID) (<-chan *PolicyChange, <-chan error) {
+	changes := make(chan *PolicyChange, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- service.WatchPolicies(ctx, root, func(change *PolicyChange) error {
+			changes <- change
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool { return service.policyWatcher.Watchers() == 1 }, time.Second, time.Millisecond)
+	select {
+	case change := <-changes:
+		require.Equal(t, PolicyChangeResync, change.Kind, "the stream opens with a resync")
+	case <-time.After(time.Second):
+		t.Fatal("stream not opened")
+	}
+	return changes, done
+}
+
+func TestIAMService_WatchPolicies(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.SetPolicyWatcher(NewPolicyWatcher(10))
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	org := uuid.New()
+	project := uuid.New()
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: project, Version: 3, ETag: "etag-3"}
+	resourceRepo.On("GetByID", org).Return(&domain.Resource{ID: org}, nil)
+	resourceRepo.On("GetAncestors", org).Return([]domain.Resource{}, nil)
+	resourceRepo.On("GetAncestors", project).Return([]domain.Resource{{ID: org}}, nil)
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, done := watch(t, service, ctx, org)
+
+	_, err := service.getPolicyAndRecordRevision(policy.ID)
+	require.NoError(t, err)
+
+	select {
+	case change := <-changes:
+		assert.Equal(t, PolicyChangeUpdated, change.Kind)
+		assert.Equal(t, project, change.ResourceID)
+		assert.Equal(t, 3, change.Version)
+		assert.Equal(t, "etag-3", change.ETag)
+		assert.False(t, change.Time.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("no change received")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, 0, service.policyWatcher.Watchers())
+}
+
+// Test: CreateBinding publishes the version and etag of the policy after the write
+func TestIAMService_CreateBinding_PublishesNewVersion(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	service.SetPolicyWatcher(NewPolicyWatcher(10))
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	project := uuid.New()
+	roleID := uuid.New()
+	policyID := uuid.New()
+	service.roleRepo.(*MockRoleRepository).On("GetByID", roleID).Return(&domain.Role{ID: roleID, Name: "roles/viewer"}, nil)
+	resourceRepo.On("GetByID", project).Return(&domain.Resource{ID: project}, nil)
+	resourceRepo.On("GetAncestors", project).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", project).Return(&domain.Policy{ID: policyID, ResourceID: project, Version: 1, ETag: "etag-1"}, nil)
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: project, Version: 2, ETag: "etag-2"}, nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil)
+	bindingRepo.On("GetByID", mock.AnythingOfType("uuid.UUID")).Return(&domain.Binding{RoleID: roleID}, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, _ := watch(t, service, ctx, project)
+
+	_, err := service.CreateBinding(project, roleID, []string{"user:alice@example.com"}, nil)
+	require.NoError(t, err)
+
+	select {
+	case change := <-changes:
+		assert.Equal(t, PolicyChangeUpdated, change.Kind)
+		assert.Equal(t, 2, change.Version)
+		assert.Equal(t, "etag-2", change.ETag)
+	case <-time.After(time.Second):
+		t.Fatal("no change received")
+	}
+	assert.Empty(t, changes)
+}
+
+func TestIAMService_WatchPolicies_Resync(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.SetPolicyWatcher(NewPolicyWatcher(1))
+
+	org := uuid.New()
+	resourceRepo.On("GetByID", org).Return(&domain.Resource{ID: org}, nil)
+	resourceRepo.On("GetAncestors", org).Return([]domain.Resource{}, nil)
+
+	errStop := errors.New("stop")
+	received := make(chan string, 10)
+	unblock := make(chan struct{})
+	done := make(chan error, 1)
+	opened := false
+	go func() {
+		done <- service.WatchPolicies(context.Background(), org, func(change *PolicyChange) error {
+			if !opened {
+				opened = true
+				return nil
+			}
+			received <- change.Kind
+			<-unblock
+			if change.Kind == PolicyChangeResync {
+				return errStop
+			}
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool { return service.policyWatcher.Watchers() == 1 }, time.Second, time.Millisecond)
+
+	// The stream is busy with the first change while the second fills its queue and the third is dropped
+	service.policyWatcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: org})
+	assert.Equal(t, PolicyChangeUpdated, <-received)
+	service.policyWatcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: org})
+	service.policyWatcher.Publish(PolicyChange{Kind: PolicyChangeDeleted, ResourceID: org})
+	close(unblock)
+
+	assert.ErrorIs(t, <-done, errStop)
+	assert.Equal(t, PolicyChangeUpdated, <-received)
+	assert.Equal(t, PolicyChangeResync, <-received)
+}
+
+// Test: Moving an ancestor of the watched root is delivered, and the moved ancestors are watched
+func TestIAMService_WatchPolicies_FollowsMovedAncestors(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.SetPolicyWatcher(NewPolicyWatcher(10))
+
+	oldParent := uuid.New()
+	newParent := uuid.New()
+	project := uuid.New()
+	resourceRepo.On("GetByID", project).Return(&domain.Resource{ID: project}, nil)
+	resourceRepo.On("GetAncestors", project).Return([]domain.Resource{{ID: oldParent}}, nil).Once()
+	resourceRepo.On("GetAncestors", project).Return([]domain.Resource{{ID: newParent}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, _ := watch(t, service, ctx, project)
+
+	service.policyWatcher.Publish(PolicyChange{Kind: PolicyChangeResource, ResourceID: project, ancestors: []uuid.UUID{oldParent}})
+	assert.Equal(t, project, (<-changes).ResourceID)
+
+	require.Eventually(t, func() bool {
+		service.policyWatcher.Publish(PolicyChange{Kind: PolicyChangeUpdated, ResourceID: newParent, ancestors: []uuid.UUID{}})
+		select {
+		case change := <-changes:
+			return change.ResourceID == newParent
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestIAMService_WatchPolicies_Errors(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	root := uuid.New()
+
+	assert.Error(t, service.WatchPolicies(context.Background(), root, nil), "watching is not enabled")
+
+	service.SetPolicyWatcher(NewPolicyWatcher(0))
+	resourceRepo.On("GetByID", root).Return(nil, nil)
+	assert.ErrorContains(t, service.WatchPolicies(context.Background(), root, nil), "resource not found")
+}
+
+func TestIAMService_MoveResource_NotifiesOldAndNewAncestors(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.SetPolicyWatcher(NewPolicyWatcher(10))
+
+	oldParent := uuid.New()
+	newParent := uuid.New()
+	id := uuid.New()
+	resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "project", ParentID: &oldParent}, nil)
+	resourceRepo.On("GetByID", newParent).Return(&domain.Resource{ID: newParent, Type: "folder"}, nil)
+	resourceRepo.On("GetAncestors", newParent).Return([]domain.Resource{}, nil)
+	resourceRepo.On("GetAncestors", id).Return([]domain.Resource{{ID: oldParent}}, nil)
+	resourceRepo.On("Update", mock.AnythingOfType("*domain.Resource")).Return(nil)
+
+	oldSub := service.policyWatcher.subscribe(oldParent)
+	newSub := service.policyWatcher.subscribe(newParent)
+
+	_, _, err := service.MoveResource(id, &newParent, false)
+	require.NoError(t, err)
+
+	require.Len(t, oldSub.changes, 1)
+	require.Len(t, newSub.changes, 1)
+	change := <-newSub.changes
+	assert.Equal(t, PolicyChangeResource, change.Kind)
+	assert.Equal(t, id, change.ResourceID)
+}
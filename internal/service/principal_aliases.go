@@ -0,0 +1,258 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"gorm.io/datatypes"
+)
+
+// ErrPrincipalAliasesDisabled is returned by the principal alias APIs when no repository is configured
+var ErrPrincipalAliasesDisabled = errors.New("principal aliases are not enabled")
+
+// AliasRewrite describes the binding members RewriteAliasedMembers replaced on one resource
+type AliasRewrite struct {
+	ResourceID uuid.UUID
+	PolicyID   uuid.UUID
+	Replaced   int // Alias members replaced by, or merged into, their canonical principal
+}
+
+// AliasRewriteReport summarizes a RewriteAliasedMembers run
+type AliasRewriteReport struct {
+	Policies []AliasRewrite
+	Replaced int
+	DryRun   bool
+}
+
+// SetPrincipalAliases enables linking alias identities to canonical principals.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetPrincipalAliases(aliases repository.PrincipalAliasRepository) {
+	s.principalAliasRepo = aliases
+}
+
+// LinkPrincipal links alias to the canonical principal, so bindings to either apply to both.
+// Links are one level deep: principal may not be an alias, and alias may not already be linked
+// or have aliases of its own.
+func (s *IAMService) LinkPrincipal(alias, principal string) (*domain.PrincipalAlias, error) {
+	if err := s.authorize("LinkPrincipal", nil); err != nil {
+		return nil, err
+	}
+
+	if s.principalAliasRepo == nil {
+		return nil, ErrPrincipalAliasesDisabled
+	}
+	if err := validateAliasLink(alias, principal); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.principalAliasRepo.GetByAlias(alias)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get principal alias: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%s is already an alias of %s", alias, existing.Principal)
+	}
+	canonical, err := s.principalAliasRepo.GetByAlias(principal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get principal alias: %w", err)
+	}
+	if canonical != nil {
+		return nil, fmt.Errorf("%s is an alias of %s; link to the canonical principal instead", principal, canonical.Principal)
+	}
+	aliases, err := s.principalAliasRepo.List(alias, 1, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list principal aliases: %w", err)
+	}
+	if len(aliases) > 0 {
+		return nil, fmt.Errorf("%s has aliases and cannot become an alias", alias)
+	}
+
+	link := &domain.PrincipalAlias{Alias: alias, Principal: principal, CreatedBy: s.caller}
+	if err := s.principalAliasRepo.Create(link); err != nil {
+		return nil, fmt.Errorf("failed to link principal: %w", err)
+	}
+	// Cached decisions of either identity no longer hold
+	s.cache.Clear()
+	return link, nil
+}
+
+// UnlinkPrincipal removes the link of alias to its canonical principal
+func (s *IAMService) UnlinkPrincipal(alias string) error {
+	if err := s.authorize("UnlinkPrincipal", nil); err != nil {
+		return err
+	}
+
+	if s.principalAliasRepo == nil {
+		return ErrPrincipalAliasesDisabled
+	}
+
+	link, err := s.principalAliasRepo.GetByAlias(alias)
+	if err != nil {
+		return fmt.Errorf("failed to get principal alias: %w", err)
+	}
+	if link == nil {
+		return fmt.Errorf("principal alias not found")
+	}
+	if err := s.principalAliasRepo.Delete(alias); err != nil {
+		return fmt.Errorf("failed to unlink principal: %w", err)
+	}
+	s.cache.Clear()
+	return nil
+}
+
+// ListPrincipalAliases lists the alias links, optionally only those of a canonical principal
+func (s *IAMService) ListPrincipalAliases(principal string, pageSize, offset int) ([]domain.PrincipalAlias, error) {
+	if err := s.authorize("ListPrincipalAliases", nil); err != nil {
+		return nil, err
+	}
+
+	if s.principalAliasRepo == nil {
+		return nil, ErrPrincipalAliasesDisabled
+	}
+	return s.principalAliasRepo.List(principal, pageSize, offset)
+}
+
+// RewriteAliasedMembers replaces the alias members of every binding with their canonical
+// principal, merging them with members already granted the same binding. Each changed policy
+// is updated and gets a revision. With dryRun, or on a DryRun view, it only reports what would
+// change.
+func (s *IAMService) RewriteAliasedMembers(dryRun bool) (*AliasRewriteReport, error) {
+	if err := s.authorize("RewriteAliasedMembers", nil); err != nil {
+		return nil, err
+	}
+
+	if s.principalAliasRepo == nil {
+		return nil, ErrPrincipalAliasesDisabled
+	}
+
+	links, err := s.principalAliasRepo.List("", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list principal aliases: %w", err)
+	}
+	canonical := make(map[string]string, len(links))
+	for _, link := range links {
+		canonical[link.Alias] = link.Principal
+	}
+
+	// Search matches substrings, so only bindings with an exact alias member are rewritten
+	var resourceIDs []uuid.UUID
+	for _, link := range links {
+		bindings, _, err := s.bindingRepo.Search(repository.BindingSearch{Member: link.Alias}, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search bindings of %s: %w", link.Alias, err)
+		}
+		for _, binding := range bindings {
+			members, err := binding.GetMembers()
+			if err != nil {
+				return nil, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+			}
+			if binding.Policy != nil && slices.Contains(members, link.Alias) && !slices.Contains(resourceIDs, binding.Policy.ResourceID) {
+				resourceIDs = append(resourceIDs, binding.Policy.ResourceID)
+			}
+		}
+	}
+
+	// The caller was authorized to rewrite aliases, not for iam.policies.update
+	rewriter := *s
+	rewriter.callerView = false
+	rewriter.dryRun = false
+	dryRun = dryRun || s.dryRun
+	report := &AliasRewriteReport{DryRun: dryRun}
+	for _, resourceID := range resourceIDs {
+		rewrite, err := rewriter.rewriteAliasedMembers(resourceID, canonical, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		if rewrite != nil {
+			report.Policies = append(report.Policies, *rewrite)
+			report.Replaced += rewrite.Replaced
+		}
+	}
+	return report, nil
+}
+
+// rewriteAliasedMembers replaces the alias members of the bindings of resourceID's policy,
+// returning nil when it has none
+func (s *IAMService) rewriteAliasedMembers(resourceID uuid.UUID, canonical map[string]string, dryRun bool) (*AliasRewrite, error) {
+	policy, err := s.policyRepo.GetByResourceID(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	if policy == nil {
+		return nil, nil
+	}
+
+	replaced := 0
+	bindings := make([]domain.Binding, 0, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		members, err := binding.GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+		}
+		rewritten := make([]string, 0, len(members))
+		for _, member := range members {
+			if principal, ok := canonical[member]; ok {
+				member = principal
+				replaced++
+			}
+			if !slices.Contains(rewritten, member) {
+				rewritten = append(rewritten, member)
+			}
+		}
+
+		membersJSON, err := json.Marshal(rewritten)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal members: %w", err)
+		}
+		rebound := domain.Binding{RoleID: binding.RoleID, Members: datatypes.JSON(membersJSON), Annotations: binding.Annotations}
+		if binding.Condition != nil {
+			rebound.Condition = &domain.Condition{
+				Title:       binding.Condition.Title,
+				Description: binding.Condition.Description,
+				Expression:  binding.Condition.Expression,
+			}
+		}
+		bindings = append(bindings, rebound)
+	}
+	if replaced == 0 {
+		return nil, nil
+	}
+
+	rewrite := &AliasRewrite{ResourceID: resourceID, PolicyID: policy.ID, Replaced: replaced}
+	if dryRun {
+		return rewrite, nil
+	}
+	if _, err := s.replaceBindings(policy, bindings); err != nil {
+		return nil, fmt.Errorf("failed to rewrite aliases on resource %s: %w", resourceID, err)
+	}
+	return rewrite, nil
+}
+
+// validateAliasLink checks that alias and principal are distinct identities of the same type.
+// Domains match users by email and cannot be linked.
+func validateAliasLink(alias, principal string) error {
+	aliasType, _, ok := strings.Cut(alias, ":")
+	if !ok || aliasType == "" {
+		return fmt.Errorf("invalid alias %q: expected type:identifier", alias)
+	}
+	principalType, _, ok := strings.Cut(principal, ":")
+	if !ok || principalType == "" {
+		return fmt.Errorf("invalid principal %q: expected type:identifier", principal)
+	}
+	if aliasType != principalType {
+		return fmt.Errorf("alias %s and principal %s must have the same type", alias, principal)
+	}
+	if aliasType == domain.PrincipalTypeDomain {
+		return fmt.Errorf("domain principals cannot be linked")
+	}
+	if alias == principal {
+		return fmt.Errorf("a principal cannot be its own alias")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memPrincipalAliasRepository keeps principal aliases in memory
+type memPrincipalAliasRepository struct {
+	links []domain.PrincipalAlias
+}
+
+func (r *memPrincipalAliasRepository) Create(alias *domain.PrincipalAlias) error {
+	alias.ID = uuid.New()
+	r.links = append(r.links, *alias)
+	return nil
+}
+
+func (r *memPrincipalAliasRepository) GetByAlias(alias string) (*domain.PrincipalAlias, error) {
+	for i := range r.links {
+		if r.links[i].Alias == alias {
+			link := r.links[i]
+			return &link, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memPrincipalAliasRepository) Delete(alias string) error {
+	for i := range r.links {
+		if r.links[i].Alias == alias {
+			r.links = append(r.links[:i], r.links[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memPrincipalAliasRepository) List(principal string, limit, offset int) ([]domain.PrincipalAlias, error) {
+	var links []domain.PrincipalAlias
+	for _, link := range r.links {
+		if principal == "" || link.Principal == principal {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (r *memPrincipalAliasRepository) AliasesOf(principal string) ([]string, error) {
+	canonical := principal
+	if link, _ := r.GetByAlias(principal); link != nil {
+		canonical = link.Principal
+	}
+	var linked []string
+	if canonical != principal {
+		linked = append(linked, canonical)
+	}
+	for _, link := range r.links {
+		if link.Principal == canonical && link.Alias != principal {
+			linked = append(linked, link.Alias)
+		}
+	}
+	return linked, nil
+}
+
+func TestIAMService_LinkPrincipal(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	aliases := &memPrincipalAliasRepository{}
+	service.SetPrincipalAliases(aliases)
+
+	link, err := service.LinkPrincipal("user:alice@example.com", "user:alice@corp.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user:alice@corp.example.com", link.Principal)
+
+	_, err = service.LinkPrincipal("user:alice@example.com", "user:other@corp.example.com")
+	assert.ErrorContains(t, err, "already an alias of user:alice@corp.example.com")
+	_, err = service.LinkPrincipal("user:al@example.com", "user:alice@example.com")
+	assert.ErrorContains(t, err, "link to the canonical principal instead")
+	_, err = service.LinkPrincipal("user:alice@corp.example.com", "user:alice@new.example.com")
+	assert.ErrorContains(t, err, "has aliases")
+	_, err = service.LinkPrincipal("serviceAccount:ci@example.com", "user:ci@example.com")
+	assert.ErrorContains(t, err, "same type")
+	_, err = service.LinkPrincipal("domain:example.com", "domain:corp.example.com")
+	assert.ErrorContains(t, err, "cannot be linked")
+	_, err = service.LinkPrincipal("alice", "user:alice@corp.example.com")
+	assert.ErrorContains(t, err, "invalid alias")
+
+	links, err := service.ListPrincipalAliases("user:alice@corp.example.com", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+
+	require.NoError(t, service.UnlinkPrincipal("user:alice@example.com"))
+	assert.ErrorContains(t, service.UnlinkPrincipal("user:alice@example.com"), "not found")
+}
+
+func TestIAMService_RewriteAliasedMembers(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	aliases := &memPrincipalAliasRepository{}
+	service.SetPrincipalAliases(aliases)
+	_, err := service.LinkPrincipal("user:alice@example.com", "user:alice@corp.example.com")
+	require.NoError(t, err)
+
+	// The viewer binding holds both identities, the editor binding only the alias
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	editor := testRole("roles/editor", "storage.buckets.update")
+	projectID := uuid.New()
+	viewerBinding := testBinding(&viewer, "user:alice@example.com", "user:alice@corp.example.com", "user:bob@example.com")
+	editorBinding := testBinding(&editor, "user:alice@example.com")
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: projectID, Bindings: []domain.Binding{viewerBinding, editorBinding}}
+	viewerBinding.Policy, editorBinding.Policy = policy, policy
+
+	// Substring matches of the alias are not rewritten
+	other := testBinding(&viewer, "user:malice@example.com")
+	other.Policy = &domain.Policy{ID: uuid.New(), ResourceID: uuid.New()}
+
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	bindingRepo.On("Search", repository.BindingSearch{Member: "user:alice@example.com"}, 0, 0).
+		Return([]domain.Binding{viewerBinding, editorBinding, other}, int64(3), nil)
+	policyRepo.On("GetByResourceID", projectID).Return(policy, nil)
+	roleRepo.On("GetByID", viewer.ID).Return(&viewer, nil)
+	roleRepo.On("GetByID", editor.ID).Return(&editor, nil)
+
+	report, err := service.RewriteAliasedMembers(true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Replaced)
+	require.Len(t, report.Policies, 1)
+	assert.Equal(t, policy.ID, report.Policies[0].PolicyID)
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+
+	var created []domain.Binding
+	policyRepo.On("Update", mock.AnythingOfType("*domain.Policy")).Return(nil)
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	bindingRepo.On("Delete", mock.AnythingOfType("uuid.UUID")).Return(nil)
+	bindingRepo.On("Create", mock.AnythingOfType("*domain.Binding")).Return(nil).Run(func(args mock.Arguments) {
+		created = append(created, *args.Get(0).(*domain.Binding))
+	})
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	report, err = service.RewriteAliasedMembers(false)
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 2, report.Replaced)
+
+	members := make(map[uuid.UUID][]string)
+	for _, binding := range created {
+		names, err := binding.GetMembers()
+		require.NoError(t, err)
+		sort.Strings(names)
+		members[binding.RoleID] = names
+	}
+	assert.Equal(t, map[uuid.UUID][]string{
+		viewer.ID: {"user:alice@corp.example.com", "user:bob@example.com"},
+		editor.ID: {"user:alice@corp.example.com"},
+	}, members)
+}
+
+func TestIAMService_PrincipalAliasesDisabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.LinkPrincipal("user:alice@example.com", "user:alice@corp.example.com")
+	assert.ErrorIs(t, err, ErrPrincipalAliasesDisabled)
+	assert.ErrorIs(t, service.UnlinkPrincipal("user:alice@example.com"), ErrPrincipalAliasesDisabled)
+	_, err = service.ListPrincipalAliases("", 0, 0)
+	assert.ErrorIs(t, err, ErrPrincipalAliasesDisabled)
+	_, err = service.RewriteAliasedMembers(true)
+	assert.ErrorIs(t, err, ErrPrincipalAliasesDisabled)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// principalRemovalBatch is the number of policies RemovePrincipal changes per transaction
+const principalRemovalBatch = 100
+
+// PrincipalRemoval describes a principal removed from one binding by RemovePrincipal
+type PrincipalRemoval struct {
+	ResourceID     uuid.UUID
+	PolicyID       uuid.UUID
+	BindingID      uuid.UUID
+	Role           string
+	Condition      string // CEL expression of the binding, if any
+	BindingDeleted bool   // The principal was the binding's only member
+}
+
+// PrincipalRemovalReport lists the bindings RemovePrincipal removed a principal from
+type PrincipalRemovalReport struct {
+	Principal string
+	Removals  []PrincipalRemoval
+	Policies  int // Policies changed, each with a new revision
+}
+
+// RemovePrincipal removes principal from every binding on every resource, e.g. when offboarding
+// a user. Policies are changed in batched transactions and each changed policy gets a revision
+// authored by the caller. If a batch fails, the report lists the removals of the batches before it.
+// Domain members granting to the principal are kept.
+func (s *IAMService) RemovePrincipal(principal string) (*PrincipalRemovalReport, error) {
+	if err := s.authorize("RemovePrincipal", nil); err != nil {
+		return nil, err
+	}
+
+	principal = strings.TrimSpace(principal)
+	if principal == "" {
+		return nil, fmt.Errorf("principal is required")
+	}
+	if strings.HasPrefix(principal, domain.PrincipalTypeDomain+":") {
+		return nil, fmt.Errorf("domain principals cannot be removed; remove their bindings instead")
+	}
+
+	// Search matches substrings, so only bindings with principal as an exact member are changed
+	bindings, _, err := s.bindingRepo.Search(repository.BindingSearch{Member: principal}, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search bindings: %w", err)
+	}
+	found := make(map[uuid.UUID]domain.Binding)
+	var policyIDs []uuid.UUID
+	for _, binding := range bindings {
+		members, err := binding.GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+		}
+		if !slices.Contains(members, principal) {
+			continue
+		}
+		found[binding.ID] = binding
+		if !slices.Contains(policyIDs, binding.PolicyID) {
+			policyIDs = append(policyIDs, binding.PolicyID)
+		}
+	}
+
+	report := &PrincipalRemovalReport{Principal: principal}
+	for start := 0; start < len(policyIDs); start += principalRemovalBatch {
+		batch := policyIDs[start:min(start+principalRemovalBatch, len(policyIDs))]
+		removals, err := s.bindingRepo.RemoveMember(principal, batch, s.caller)
+		if err != nil {
+			return report, fmt.Errorf("failed to remove %s from bindings: %w", principal, err)
+		}
+		s.cache.Clear()
+
+		changed := make(map[uuid.UUID]bool)
+		for _, removal := range removals {
+			entry := PrincipalRemoval{
+				PolicyID:       removal.PolicyID,
+				BindingID:      removal.BindingID,
+				BindingDeleted: removal.Deleted,
+			}
+			if binding, ok := found[removal.BindingID]; ok {
+				if binding.Policy != nil {
+					entry.ResourceID = binding.Policy.ResourceID
+				}
+				if binding.Role != nil {
+					entry.Role = binding.Role.Name
+				}
+				if binding.Condition != nil {
+					entry.Condition = binding.Condition.Expression
+				}
+			}
+			report.Removals = append(report.Removals, entry)
+			changed[removal.PolicyID] = true
+		}
+
+		// Each changed policy gets a revision recording the removal
+		for _, policyID := range batch {
+			if !changed[policyID] {
+				continue
+			}
+			if _, err := s.getPolicyAndRecordRevision(policyID); err != nil {
+				return report, err
+			}
+			report.Policies++
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_RemovePrincipal(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+	project := &domain.Policy{ID: uuid.New(), ResourceID: uuid.New()}
+	bucket := &domain.Policy{ID: uuid.New(), ResourceID: uuid.New()}
+	shared := testBinding(&viewer, "user:alice@example.com", "user:bob@example.com")
+	shared.PolicyID, shared.Policy = project.ID, project
+	alone := testBinding(&viewer, "user:alice@example.com")
+	alone.PolicyID, alone.Policy = bucket.ID, bucket
+	alone.Condition = &domain.Condition{Expression: `resource.type == "bucket"`}
+	// Substring matches of the principal are kept
+	similar := testBinding(&viewer, "user:malice@example.com")
+	similar.PolicyID, similar.Policy = uuid.New(), &domain.Policy{ID: uuid.New()}
+
+	bindingRepo.On("Search", repository.BindingSearch{Member: "user:alice@example.com"}, 0, 0).
+		Return([]domain.Binding{shared, alone, similar}, int64(3), nil)
+	bindingRepo.On("RemoveMember", "user:alice@example.com", []uuid.UUID{project.ID, bucket.ID}).
+		Return([]repository.MemberRemoval{
+			{PolicyID: project.ID, BindingID: shared.ID, RoleID: viewer.ID},
+			{PolicyID: bucket.ID, BindingID: alone.ID, RoleID: viewer.ID, Deleted: true},
+		}, nil).Once()
+	policyRepo.On("GetByID", project.ID).Return(project, nil)
+	policyRepo.On("GetByID", bucket.ID).Return(bucket, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil).Twice()
+
+	report, err := service.AsCaller("user:admin@example.com").RemovePrincipal(" user:alice@example.com ")
+	require.NoError(t, err)
+	assert.Equal(t, "user:alice@example.com", report.Principal)
+	assert.Equal(t, 2, report.Policies)
+	assert.Equal(t, []PrincipalRemoval{
+		{ResourceID: project.ResourceID, PolicyID: project.ID, BindingID: shared.ID, Role: "roles/viewer"},
+		{ResourceID: bucket.ResourceID, PolicyID: bucket.ID, BindingID: alone.ID, Role: "roles/viewer",
+			Condition: `resource.type == "bucket"`, BindingDeleted: true},
+	}, report.Removals)
+	bindingRepo.AssertExpectations(t)
+	revisionRepo.AssertExpectations(t)
+	for _, call := range revisionRepo.Calls {
+		assert.Equal(t, "user:admin@example.com", call.Arguments.Get(0).(*domain.PolicyRevision).Author)
+	}
+
+	_, err = service.RemovePrincipal("domain:example.com")
+	assert.ErrorContains(t, err, "domain principals cannot be removed")
+	_, err = service.RemovePrincipal("")
+	assert.ErrorContains(t, err, "principal is required")
+}
+
+// Test: Removals of committed batches are reported when a later batch fails
+func TestIAMService_RemovePrincipal_Batches(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	viewer := testRole("roles/viewer", "storage.buckets.get")
+
+	var bindings []domain.Binding
+	var policyIDs []uuid.UUID
+	for range principalRemovalBatch + 1 {
+		binding := testBinding(&viewer, "user:alice@example.com")
+		binding.PolicyID = uuid.New()
+		bindings = append(bindings, binding)
+		policyIDs = append(policyIDs, binding.PolicyID)
+	}
+	first := []repository.MemberRemoval{{PolicyID: policyIDs[0], BindingID: bindings[0].ID, Deleted: true}}
+
+	bindingRepo.On("Search", repository.BindingSearch{Member: "user:alice@example.com"}, 0, 0).
+		Return(bindings, int64(len(bindings)), nil)
+	bindingRepo.On("RemoveMember", "user:alice@example.com", policyIDs[:principalRemovalBatch]).Return(first, nil)
+	bindingRepo.On("RemoveMember", "user:alice@example.com", policyIDs[principalRemovalBatch:]).Return(nil, assert.AnError)
+	policyRepo.On("GetByID", policyIDs[0]).Return(&domain.Policy{ID: policyIDs[0]}, nil)
+	service.revisionRepo.(*MockPolicyRevisionRepository).On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	report, err := service.RemovePrincipal("user:alice@example.com")
+	assert.ErrorIs(t, err, assert.AnError)
+	require.NotNil(t, report)
+	assert.Len(t, report.Removals, 1)
+	assert.Equal(t, 1, report.Policies)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/domain"
+)
+
+// Purger periodically hard-deletes rows deleted longer ago than the service's retention window
+type Purger struct {
+	service  *IAMService
+	interval time.Duration
+	logger   *slog.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPurger creates a purger running every interval. A nil logger uses slog.Default().
+func NewPurger(service *IAMService, interval time.Duration, logger *slog.Logger) *Purger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Purger{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the first purge after one interval and then every interval until Stop
+func (p *Purger) Start() {
+	go p.run()
+}
+
+// Stop waits for a running purge to finish and the purger to exit, or for ctx to expire
+func (p *Purger) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Purger) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.purge()
+		}
+	}
+}
+
+func (p *Purger) purge() {
+	result, err := p.service.PurgeDeleted()
+	if errors.Is(err, domain.ErrNotWriter) {
+		// The writer's region purges
+		p.logger.Debug("Purge of deleted rows skipped", "error", err)
+		return
+	}
+	if err != nil {
+		p.logger.Error("Purge of deleted rows failed", "error", err)
+		return
+	}
+	p.logger.Info("Purged deleted rows past retention",
+		"bindings", result.Bindings,
+		"policies", result.Policies,
+		"roles", result.Roles,
+		"resources", result.Resources)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// Request metadata keys (gRPC metadata or HTTP headers, matched without regard to case) through
+// which callers identify who a request is made for and where it comes from. The interceptors of
+// the API read them with RequestMetadataFromHeaders; pkg/client sends them.
+const (
+	// End-user a service calls on behalf of, e.g. "user:alice@example.com". Only trusted services
+	// may set it; see config server.trusted_caller_services.
+	MetadataCaller = "x-iam-caller"
+	// Correlates a request across services and logs; generated when missing
+	MetadataRequestID = "x-request-id"
+	// Addresses of the originating client and the proxies in between, the client first
+	MetadataForwardedFor = "x-forwarded-for"
+)
+
+// maxRequestIDLength bounds the request IDs recorded in revisions and decision logs
+const maxRequestIDLength = 128
+
+// RequestMetadata identifies who a request is made for and where it comes from
+type RequestMetadata struct {
+	Caller    string // Principal the request is made for: the end-user, or Service itself
+	Service   string // Authenticated principal of the calling service, e.g. from its client certificate
+	RequestID string
+	ClientIP  string // Originating client address, when forwarded
+}
+
+// RequestMetadataFromHeaders reads the request metadata of a call authenticated as service.
+// Services may only assert another caller with MetadataCaller when they are in trustedServices;
+// otherwise they call for themselves. A missing request ID is generated, and a forwarded client
+// address that is not an IP address is ignored.
+func RequestMetadataFromHeaders(service string, headers map[string][]string, trustedServices []string) (RequestMetadata, error) {
+	md := RequestMetadata{Caller: service, Service: service, RequestID: uuid.NewString()}
+
+	if caller := firstHeader(headers, MetadataCaller); caller != "" && caller != service {
+		if !slices.Contains(trustedServices, service) {
+			return RequestMetadata{}, fmt.Errorf("%w: %q may not call on behalf of %q", ErrPermissionDenied, service, caller)
+		}
+		if _, err := domain.ParseMember(caller); err != nil {
+			return RequestMetadata{}, fmt.Errorf("invalid %s: %w", MetadataCaller, err)
+		}
+		md.Caller = caller
+	}
+
+	if requestID := firstHeader(headers, MetadataRequestID); requestID != "" {
+		if len(requestID) > maxRequestIDLength {
+			requestID = requestID[:maxRequestIDLength]
+		}
+		md.RequestID = requestID
+	}
+
+	if forwarded := firstHeader(headers, MetadataForwardedFor); forwarded != "" {
+		client, _, _ := strings.Cut(forwarded, ",")
+		if addr, err := netip.ParseAddr(strings.TrimSpace(client)); err == nil {
+			md.ClientIP = addr.String()
+		}
+	}
+	return md, nil
+}
+
+// firstHeader returns the first value of the header named key, whatever its case
+func firstHeader(headers map[string][]string, key string) string {
+	for name, values := range headers {
+		if strings.EqualFold(name, key) && len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+	}
+	return ""
+}
+
+// WithRequestMetadata returns a caller view (see AsCaller) of md.Caller that records md: policy
+// revisions and decision logs carry its request ID and calling service, and checks without a
+// request.ip context key see its client address.
+func (s *IAMService) WithRequestMetadata(md RequestMetadata) *IAMService {
+	view := s.AsCaller(md.Caller)
+	view.request = md
+	return view
+}
+
+// Context keys carrying the request metadata of a view to the evaluators and decision logs.
+// Callers cannot supply them, IAMService removes them from the contexts of other checks.
+const (
+	contextKeyRequestID     = "call.request_id"
+	contextKeyCallerService = "call.service"
+)
+
+// withRequestMetadata returns context carrying the request metadata of the view, copying it only
+// if the view has any
+func (s *IAMService) withRequestMetadata(context map[string]string) map[string]string {
+	md := s.request
+	if md == (RequestMetadata{}) {
+		return context
+	}
+
+	copied := make(map[string]string, len(context)+3)
+	for key, value := range context {
+		copied[key] = value
+	}
+	if md.RequestID != "" {
+		copied[contextKeyRequestID] = md.RequestID
+	}
+	if md.Service != "" {
+		copied[contextKeyCallerService] = md.Service
+	}
+	if _, ok := copied[ContextKeyCallerIP]; !ok && md.ClientIP != "" {
+		copied[ContextKeyCallerIP] = md.ClientIP
+	}
+	return copied
+}
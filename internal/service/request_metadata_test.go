@@ -0,0 +1,94 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMetadataFromHeaders(t *testing.T) {
+	portal := "serviceAccount:portal@example.com"
+	trusted := []string{portal}
+
+	// HTTP headers are canonicalized, gRPC metadata is lowercase
+	headers := http.Header{}
+	headers.Set(MetadataCaller, "user:alice@example.com")
+	headers.Set(MetadataRequestID, "req-42")
+	headers.Set(MetadataForwardedFor, "203.0.113.7, 10.0.0.1")
+	md, err := RequestMetadataFromHeaders(portal, headers, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, RequestMetadata{Caller: "user:alice@example.com", Service: portal, RequestID: "req-42", ClientIP: "203.0.113.7"}, md)
+
+	md, err = RequestMetadataFromHeaders(portal, map[string][]string{MetadataForwardedFor: {"unknown"}}, trusted)
+	require.NoError(t, err)
+	assert.Equal(t, portal, md.Caller)
+	assert.NotEmpty(t, md.RequestID)
+	assert.Empty(t, md.ClientIP)
+
+	// Only trusted services call on behalf of others, and only for valid principals
+	_, err = RequestMetadataFromHeaders("serviceAccount:batch@example.com", headers, trusted)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	_, err = RequestMetadataFromHeaders(portal, map[string][]string{MetadataCaller: {"alice"}}, trusted)
+	assert.ErrorContains(t, err, "invalid x-iam-caller")
+}
+
+func TestIAMService_WithRequestMetadata_RecordsDecisions(t *testing.T) {
+	evaluator := new(MockPermissionEvaluator)
+	sink := &memorySink{}
+	decisions := NewDecisionLogger(&config.DecisionLogConfig{SampleRate: 1}, sink, nil)
+	service := NewIAMService(nil, nil, nil, nil, nil, nil, nil, NewDecisionLoggingEvaluator(evaluator, decisions), nil)
+
+	resourceID := uuid.New()
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", mock.MatchedBy(func(context map[string]string) bool {
+		return context[ContextKeyCallerIP] == "203.0.113.7"
+	})).Return(true, "granted", nil).Once()
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", mock.MatchedBy(func(context map[string]string) bool {
+		return len(context) == 0
+	})).Return(true, "granted", nil).Once()
+
+	view := service.WithRequestMetadata(RequestMetadata{
+		Caller: "serviceAccount:api@example.com", Service: "serviceAccount:api@example.com", RequestID: "req-42", ClientIP: "203.0.113.7",
+	})
+	allowed, _, err := view.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// Callers cannot forge the metadata of others
+	_, _, err = service.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get",
+		map[string]string{contextKeyRequestID: "forged", contextKeyCallerService: "serviceAccount:admin@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, decisions.Close())
+	require.Len(t, sink.entries, 2)
+	assert.Equal(t, "req-42", sink.entries[0].RequestID)
+	assert.Equal(t, "serviceAccount:api@example.com", sink.entries[0].Service)
+	assert.Empty(t, sink.entries[1].RequestID)
+	assert.Empty(t, sink.entries[1].Service)
+	evaluator.AssertExpectations(t)
+}
+
+func TestIAMService_WithRequestMetadata_RecordsRevisions(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	policy := &domain.Policy{ID: uuid.New(), ResourceID: uuid.New(), Version: 2}
+	policyRepo.On("GetByID", policy.ID).Return(policy, nil)
+	revisionRepo.On("Create", mock.MatchedBy(func(revision *domain.PolicyRevision) bool {
+		return revision.Author == "user:alice@example.com" && revision.Service == "serviceAccount:portal@example.com" &&
+			revision.RequestID == "req-42"
+	})).Return(nil).Once()
+
+	view := service.WithRequestMetadata(RequestMetadata{
+		Caller: "user:alice@example.com", Service: "serviceAccount:portal@example.com", RequestID: "req-42",
+	})
+	_, err := view.getPolicyAndRecordRevision(policy.ID)
+	require.NoError(t, err)
+	revisionRepo.AssertExpectations(t)
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// AccessChange is a role a principal inherits on a moved subtree that the move grants or revokes
+type AccessChange struct {
+	Principal   string
+	Role        string
+	ResourceID  uuid.UUID // Ancestor whose policy binds the role
+	Conditional bool      // The binding has a condition, so access may still depend on the request
+}
+
+// MoveImpact lists the inherited access a resource move changes for the moved subtree
+type MoveImpact struct {
+	Gained []AccessChange
+	Lost   []AccessChange
+}
+
+// MoveResource re-parents a resource and its subtree under newParentID (nil makes it a root).
+// The move is applied atomically and rejected when it would create a cycle or exceed the
+// maximum hierarchy depth. With preview set nothing is changed; the access the subtree would
+// gain or lose through inherited policies is returned instead.
+func (s *IAMService) MoveResource(id uuid.UUID, newParentID *uuid.UUID, preview bool) (*domain.Resource, *MoveImpact, error) {
+	if err := s.authorize("MoveResource", &id); err != nil {
+		return nil, nil, err
+	}
+	if err := s.authorize("MoveResource", newParentID); err != nil {
+		return nil, nil, err
+	}
+
+	resource, err := s.resourceRepo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resource == nil {
+		return nil, nil, fmt.Errorf("resource not found")
+	}
+
+	newAncestors, err := s.moveTargetAncestors(id, newParentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.hasDepthLimits() {
+		height, err := s.subtreeHeight(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.checkDepthLimit(id, newAncestors, height); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if preview {
+		oldAncestors, err := s.resourceRepo.GetAncestors(id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get resource ancestors: %w", err)
+		}
+		impact, err := s.moveImpact(oldAncestors, newAncestors)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resource, impact, nil
+	}
+
+	// Watchers of both the old and the new ancestors are notified
+	change := s.newPolicyChange(PolicyChangeResource, id, 0)
+	if change != nil && change.ancestors != nil {
+		for _, ancestor := range newAncestors {
+			change.ancestors = append(change.ancestors, ancestor.ID)
+		}
+	}
+
+	resource.ParentID = newParentID
+	resource.UpdatedBy = s.caller
+	if err := s.resourceRepo.Update(resource); err != nil {
+		return nil, nil, fmt.Errorf("failed to move resource: %w", err)
+	}
+
+	// Cache keys are per principal, so the subtree's entries cannot be singled out
+	s.cache.Clear()
+	s.publishPolicyChange(change)
+
+	return resource, nil, nil
+}
+
+// moveTargetAncestors returns the ancestors id would have under newParentID, parent first,
+// rejecting a parent inside id's own subtree
+func (s *IAMService) moveTargetAncestors(id uuid.UUID, newParentID *uuid.UUID) ([]domain.Resource, error) {
+	if newParentID == nil {
+		return nil, nil
+	}
+	if *newParentID == id {
+		return nil, &repository.HierarchyError{ResourceID: id, ParentID: id, Err: repository.ErrHierarchyCycle}
+	}
+
+	parent, err := s.resourceRepo.GetByID(*newParentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("parent resource %s not found", *newParentID)
+	}
+
+	ancestors, err := s.resourceRepo.GetAncestors(*newParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource ancestors: %w", err)
+	}
+
+	chain := append([]domain.Resource{*parent}, ancestors...)
+	for _, ancestor := range chain {
+		if ancestor.ID == id {
+			return nil, &repository.HierarchyError{ResourceID: id, ParentID: *newParentID, Err: repository.ErrHierarchyCycle}
+		}
+	}
+	return chain, nil
+}
+
+// moveImpact compares the roles inherited from the old and new ancestors of a moved resource
+func (s *IAMService) moveImpact(oldAncestors, newAncestors []domain.Resource) (*MoveImpact, error) {
+	// Ancestors on both chains grant the same access before and after the move
+	shared := make(map[uuid.UUID]bool)
+	for _, ancestor := range oldAncestors {
+		shared[ancestor.ID] = false
+	}
+	for _, ancestor := range newAncestors {
+		if _, ok := shared[ancestor.ID]; ok {
+			shared[ancestor.ID] = true
+		}
+	}
+
+	before, err := s.inheritedAccess(oldAncestors, shared)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.inheritedAccess(newAncestors, shared)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MoveImpact{
+		Gained: accessDifference(after, before),
+		Lost:   accessDifference(before, after),
+	}, nil
+}
+
+// inheritedAccess collects the principal/role pairs bound on ancestors not in skip
+func (s *IAMService) inheritedAccess(ancestors []domain.Resource, skip map[uuid.UUID]bool) (map[string]AccessChange, error) {
+	access := make(map[string]AccessChange)
+	for _, ancestor := range ancestors {
+		if skip[ancestor.ID] {
+			continue
+		}
+
+		bindings, err := s.bindingRepo.ListByResourceID(ancestor.ID, 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bindings: %w", err)
+		}
+
+		for i := range bindings {
+			members, err := bindings[i].GetMembers()
+			if err != nil {
+				return nil, fmt.Errorf("invalid members in binding %s: %w", bindings[i].ID, err)
+			}
+
+			role := bindings[i].RoleID.String()
+			if bindings[i].Role != nil {
+				role = bindings[i].Role.Name
+			}
+
+			for _, member := range members {
+				key := member + "\x00" + role
+				// The nearest unconditional grant describes the access best
+				if existing, ok := access[key]; ok && !existing.Conditional {
+					continue
+				}
+				access[key] = AccessChange{
+					Principal:   member,
+					Role:        role,
+					ResourceID:  ancestor.ID,
+					Conditional: bindings[i].Condition != nil,
+				}
+			}
+		}
+	}
+	return access, nil
+}
+
+// accessDifference returns the entries of a missing from b, sorted by principal and role
+func accessDifference(a, b map[string]AccessChange) []AccessChange {
+	var changes []AccessChange
+	for key, change := range a {
+		if _, ok := b[key]; !ok {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Principal != changes[j].Principal {
+			return changes[i].Principal < changes[j].Principal
+		}
+		return changes[i].Role < changes[j].Role
+	})
+	return changes
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMoveTestService() (*IAMService, *MockResourceRepository, *MockBindingRepository) {
+	resourceRepo := new(MockResourceRepository)
+	bindingRepo := new(MockBindingRepository)
+	service := NewIAMService(
+		resourceRepo,
+		new(MockPermissionRepository),
+		new(MockRoleRepository),
+		new(MockPolicyRepository),
+		bindingRepo,
+		new(MockPolicyRevisionRepository),
+		new(MockConditionRepository),
+		new(MockPermissionEvaluator),
+		NewNoopCache(),
+	)
+	return service, resourceRepo, bindingRepo
+}
+
+func TestIAMService_MoveResource(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	oldParentID := uuid.New()
+	newParentID := uuid.New()
+	id := uuid.New()
+	resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Type: "folder", ParentID: &oldParentID}, nil)
+	resourceRepo.On("GetByID", newParentID).Return(&domain.Resource{ID: newParentID, Type: "organization"}, nil)
+	resourceRepo.On("GetAncestors", newParentID).Return([]domain.Resource{}, nil)
+	resourceRepo.On("Update", mock.MatchedBy(func(r *domain.Resource) bool {
+		return r.ID == id && r.ParentID != nil && *r.ParentID == newParentID
+	})).Return(nil)
+
+	moved, impact, err := service.MoveResource(id, &newParentID, false)
+	require.NoError(t, err)
+	assert.Nil(t, impact)
+	assert.Equal(t, &newParentID, moved.ParentID)
+	resourceRepo.AssertExpectations(t)
+}
+
+func TestIAMService_MoveResource_RejectsCycle(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	// folder -> project; moving the folder under its own project
+	folderID := uuid.New()
+	projectID := uuid.New()
+	resourceRepo.On("GetByID", folderID).Return(&domain.Resource{ID: folderID}, nil)
+	resourceRepo.On("GetByID", projectID).Return(&domain.Resource{ID: projectID, ParentID: &folderID}, nil)
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{{ID: folderID}}, nil)
+
+	_, _, err := service.MoveResource(folderID, &projectID, false)
+	assert.ErrorIs(t, err, repository.ErrHierarchyCycle)
+	resourceRepo.AssertNotCalled(t, "Update", mock.Anything)
+
+	_, _, err = service.MoveResource(folderID, &folderID, true)
+	assert.ErrorIs(t, err, repository.ErrHierarchyCycle)
+}
+
+func TestIAMService_MoveResource_Preview(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+
+	// org -> {team-a, team-b}; the project moves from team-a to team-b
+	orgID := uuid.New()
+	teamA := uuid.New()
+	teamB := uuid.New()
+	projectID := uuid.New()
+	resourceRepo.On("GetByID", projectID).Return(&domain.Resource{ID: projectID, ParentID: &teamA}, nil)
+	resourceRepo.On("GetByID", teamB).Return(&domain.Resource{ID: teamB, ParentID: &orgID}, nil)
+	resourceRepo.On("GetAncestors", projectID).Return([]domain.Resource{{ID: teamA}, {ID: orgID}}, nil)
+	resourceRepo.On("GetAncestors", teamB).Return([]domain.Resource{{ID: orgID}}, nil)
+
+	viewer := &domain.Role{Name: "roles/viewer"}
+	editor := &domain.Role{Name: "roles/editor"}
+	bindingRepo.On("ListByResourceID", teamA, 0, 0).Return([]domain.Binding{
+		{Role: editor, Members: toJSON([]string{"user:alice@example.com"})},
+		{Role: viewer, Members: toJSON([]string{"user:carol@example.com"})},
+	}, nil)
+	bindingRepo.On("ListByResourceID", teamB, 0, 0).Return([]domain.Binding{
+		{Role: editor, Members: toJSON([]string{"user:bob@example.com"})},
+		{Role: viewer, Members: toJSON([]string{"user:carol@example.com"})},
+	}, nil)
+
+	resource, impact, err := service.MoveResource(projectID, &teamB, true)
+	require.NoError(t, err)
+	assert.Equal(t, &teamA, resource.ParentID)
+	require.NotNil(t, impact)
+
+	assert.Equal(t, []AccessChange{{Principal: "user:bob@example.com", Role: "roles/editor", ResourceID: teamB}}, impact.Gained)
+	assert.Equal(t, []AccessChange{{Principal: "user:alice@example.com", Role: "roles/editor", ResourceID: teamA}}, impact.Lost)
+
+	// The shared organization is not consulted and nothing is moved
+	bindingRepo.AssertNotCalled(t, "ListByResourceID", orgID, 0, 0)
+	resourceRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// MaxResourceTags is the maximum number of tags on one resource
+const MaxResourceTags = 64
+
+// maxTagValueLength is the maximum length of a tag value in characters
+const maxTagValueLength = 255
+
+// resourceTagKey matches tag keys: a lowercase letter followed by up to 62 lowercase letters,
+// digits, '_', '-' or '.', so keys are usable as resource.tags.<key> in conditions
+var resourceTagKey = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,62}$`)
+
+// ValidateResourceTags checks the number of tags and the format of their keys and values
+func ValidateResourceTags(tags map[string]string) error {
+	if len(tags) > MaxResourceTags {
+		return fmt.Errorf("too many tags: %d (max %d)", len(tags), MaxResourceTags)
+	}
+	for key, value := range tags {
+		if !resourceTagKey.MatchString(key) {
+			return fmt.Errorf("invalid tag key %q: must start with a lowercase letter and contain at most 63 lowercase letters, digits, '_', '-' or '.'", key)
+		}
+		if !utf8.ValidString(value) || utf8.RuneCountInString(value) > maxTagValueLength {
+			return fmt.Errorf("invalid value of tag %q: must be valid UTF-8 of at most %d characters", key, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// SetResourceTags replaces the tags of a resource. Tags are visible to binding conditions as
+// resource.tags, so cached decisions are invalidated.
+func (s *IAMService) SetResourceTags(id uuid.UUID, tags map[string]string) (*domain.Resource, error) {
+	if err := s.authorize("SetResourceTags", &id); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateResourceTags(tags); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.resourceRepo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource: %w", err)
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+
+	if err := s.resourceRepo.SetTags(id, tags, s.caller); err != nil {
+		return nil, fmt.Errorf("failed to set resource tags: %w", err)
+	}
+	s.cache.Clear()
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeResource, id, 0))
+
+	return s.resourceRepo.GetByID(id)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateResourceTags(t *testing.T) {
+	tooMany := make(map[string]string, MaxResourceTags+1)
+	for i := 0; i <= MaxResourceTags; i++ {
+		tooMany["key"+strings.Repeat("x", i)] = ""
+	}
+
+	tests := []struct {
+		name   string
+		tags   map[string]string
+		errMsg string
+	}{
+		{"valid", map[string]string{"env": "prod", "cost-center": "cc-42", "team.owner": ""}, ""},
+		{"none", nil, ""},
+		{"uppercase key", map[string]string{"Env": "prod"}, "invalid tag key"},
+		{"key starting with digit", map[string]string{"1env": "prod"}, "invalid tag key"},
+		{"key too long", map[string]string{"k" + strings.Repeat("x", 63): "v"}, "invalid tag key"},
+		{"value too long", map[string]string{"env": strings.Repeat("é", 256)}, "invalid value of tag"},
+		{"too many", tooMany, "too many tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResourceTags(tt.tags)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestIAMService_SetResourceTags(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	resourceID := uuid.New()
+	tags := map[string]string{"env": "prod"}
+
+	tagged := &domain.Resource{ID: resourceID, Tags: []domain.ResourceTag{{ResourceID: resourceID, Key: "env", Value: "prod"}}}
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID}, nil).Once()
+	resourceRepo.On("SetTags", resourceID, tags).Return(nil)
+	resourceRepo.On("GetByID", resourceID).Return(tagged, nil).Once()
+
+	resource, err := service.SetResourceTags(resourceID, tags)
+	require.NoError(t, err)
+	assert.Equal(t, tags, resource.TagMap())
+
+	// Invalid tags are rejected before the resource is looked up
+	_, err = service.SetResourceTags(resourceID, map[string]string{"Env": "prod"})
+	assert.ErrorContains(t, err, "invalid tag key")
+
+	missing := uuid.New()
+	resourceRepo.On("GetByID", missing).Return(nil, nil)
+	_, err = service.SetResourceTags(missing, tags)
+	assert.EqualError(t, err, "resource not found")
+	resourceRepo.AssertNotCalled(t, "SetTags", missing, mock.Anything)
+}
+
+func TestIAMService_UpdateResourceAttributes(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	resourceID := uuid.New()
+	patch := map[string]interface{}{"region": "us", "tier": nil}
+
+	patched := &domain.Resource{ID: resourceID, Attributes: domain.Attributes{"region": "us"}}
+	resourceRepo.On("PatchAttributes", resourceID, patch).Return(nil)
+	resourceRepo.On("GetByID", resourceID).Return(patched, nil)
+
+	resource, err := service.UpdateResourceAttributes(resourceID, patch)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Attributes{"region": "us"}, resource.Attributes)
+
+	_, err = service.UpdateResourceAttributes(resourceID, nil)
+	assert.EqualError(t, err, "no attributes provided")
+
+	missing := uuid.New()
+	resourceRepo.On("PatchAttributes", missing, patch).Return(fmt.Errorf("resource not found: %s", missing))
+	_, err = service.UpdateResourceAttributes(missing, patch)
+	assert.ErrorContains(t, err, "resource not found")
+}
+
+func TestIAMService_CreateResourceWithTags(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	resourceRepo.On("Create", mock.MatchedBy(func(r *domain.Resource) bool {
+		return len(r.Tags) == 1 && r.Tags[0].Key == "env" && r.Tags[0].Value == "prod"
+	})).Return(nil)
+
+	resource, err := service.CreateResource("project", "prod", nil, nil, map[string]string{"env": "prod"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, resource.TagMap())
+
+	_, err = service.CreateResource("project", "prod", nil, nil, map[string]string{"": "prod"}, "")
+	assert.ErrorContains(t, err, "invalid tag key")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// ErrPastRetention is returned when restoring a row deleted longer ago than the retention window
+var ErrPastRetention = errors.New("deleted longer ago than the retention window")
+
+// PurgeResult counts the rows hard-deleted by PurgeDeleted
+type PurgeResult struct {
+	Bindings  int64 `json:"bindings"`
+	Policies  int64 `json:"policies"`
+	Roles     int64 `json:"roles"`
+	Resources int64 `json:"resources"`
+}
+
+// SetRetention sets how long deleted resources, roles, policies and bindings can be restored;
+// PurgeDeleted hard-deletes them afterwards. Zero (the default) keeps them forever.
+func (s *IAMService) SetRetention(retention time.Duration) {
+	s.retention = retention
+}
+
+// checkRetention returns ErrPastRetention when a row deleted at deletedAt can no longer be restored
+func (s *IAMService) checkRetention(deletedAt time.Time) error {
+	if s.retention > 0 && time.Since(deletedAt) > s.retention {
+		return fmt.Errorf("%w (deleted at %s)", ErrPastRetention, deletedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// UndeleteResource restores a deleted resource with its policy and tags. Its parent must not be
+// deleted, and descendants that were deleted on their own (e.g. by DeleteResourceTree) have to be
+// restored one by one, top-down.
+func (s *IAMService) UndeleteResource(id uuid.UUID) (*domain.Resource, error) {
+	if err := s.authorize("UndeleteResource", &id); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.resourceRepo.GetDeleted(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted resource: %w", err)
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("deleted resource not found")
+	}
+	if err := s.checkRetention(resource.DeletedAt.Time); err != nil {
+		return nil, err
+	}
+
+	if err := s.resourceRepo.Undelete(id); err != nil {
+		return nil, fmt.Errorf("failed to undelete resource: %w", err)
+	}
+	s.cache.Clear()
+	s.publishPolicyChange(s.newPolicyChange(PolicyChangeResource, id, 0))
+
+	return s.resourceRepo.GetByID(id)
+}
+
+// UndeleteRole restores a deleted role with its permissions. Bindings removed by a forced
+// DeleteRole are not restored; UndeletePolicy or RollbackPolicy can bring them back.
+func (s *IAMService) UndeleteRole(id uuid.UUID) (*domain.Role, error) {
+	if err := s.authorize("UndeleteRole", nil); err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetDeleted(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted role: %w", err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("deleted role not found")
+	}
+	if err := s.checkRetention(role.DeletedAt.Time); err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepo.Undelete(id); err != nil {
+		return nil, fmt.Errorf("failed to undelete role: %w", err)
+	}
+
+	return s.roleRepo.GetByID(id)
+}
+
+// UndeletePolicy restores the deleted policy of a resource with the bindings it had when it was
+// deleted. The restore is recorded as a new policy revision.
+func (s *IAMService) UndeletePolicy(resourceID uuid.UUID) (*domain.Policy, error) {
+	if err := s.authorize("UndeletePolicy", &resourceID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetDeletedByResourceID(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted policy: %w", err)
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("deleted policy not found")
+	}
+	if err := s.checkRetention(policy.DeletedAt.Time); err != nil {
+		return nil, err
+	}
+
+	if err := s.policyRepo.Undelete(policy.ID); err != nil {
+		return nil, fmt.Errorf("failed to undelete policy: %w", err)
+	}
+	s.cache.Clear()
+
+	return s.getPolicyAndRecordRevision(policy.ID)
+}
+
+// PurgeDeleted hard-deletes bindings, policies, roles and resources deleted longer ago than the
+// retention window. Rows still referenced by other rows are kept until those are purged.
+func (s *IAMService) PurgeDeleted() (*PurgeResult, error) {
+	if s.retention <= 0 {
+		return nil, fmt.Errorf("retention is not configured")
+	}
+	before := time.Now().Add(-s.retention)
+	result := &PurgeResult{}
+
+	// Bindings go first so that purged roles are no longer referenced
+	var err error
+	if result.Bindings, err = s.bindingRepo.PurgeDeleted(before); err != nil {
+		return result, fmt.Errorf("failed to purge bindings: %w", err)
+	}
+	if result.Policies, err = s.policyRepo.PurgeDeleted(before); err != nil {
+		return result, fmt.Errorf("failed to purge policies: %w", err)
+	}
+	if result.Roles, err = s.roleRepo.PurgeDeleted(before); err != nil {
+		return result, fmt.Errorf("failed to purge roles: %w", err)
+	}
+	if result.Resources, err = s.resourceRepo.PurgeDeleted(before); err != nil {
+		return result, fmt.Errorf("failed to purge resources: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func deletedAt(ago time.Duration) gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now().Add(-ago), Valid: true}
+}
+
+func TestIAMService_UndeleteResource(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	service.SetRetention(30 * 24 * time.Hour)
+
+	id := uuid.New()
+	resourceRepo.On("GetDeleted", id).Return(&domain.Resource{ID: id, DeletedAt: deletedAt(time.Hour)}, nil)
+	resourceRepo.On("Undelete", id).Return(nil)
+	resourceRepo.On("GetByID", id).Return(&domain.Resource{ID: id, Name: "restored"}, nil)
+
+	resource, err := service.UndeleteResource(id)
+	require.NoError(t, err)
+	assert.Equal(t, "restored", resource.Name)
+	resourceRepo.AssertExpectations(t)
+}
+
+func TestIAMService_UndeleteResource_NotDeleted(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	id := uuid.New()
+	resourceRepo.On("GetDeleted", id).Return(nil, nil)
+
+	_, err := service.UndeleteResource(id)
+	assert.ErrorContains(t, err, "deleted resource not found")
+	resourceRepo.AssertNotCalled(t, "Undelete", id)
+}
+
+func TestIAMService_Undelete_PastRetention(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	service.SetRetention(24 * time.Hour)
+
+	id := uuid.New()
+	resourceRepo.On("GetDeleted", id).Return(&domain.Resource{ID: id, DeletedAt: deletedAt(48 * time.Hour)}, nil)
+	roleRepo.On("GetDeleted", id).Return(&domain.Role{ID: id, DeletedAt: deletedAt(48 * time.Hour)}, nil)
+	policyRepo.On("GetDeletedByResourceID", id).Return(&domain.Policy{ID: id, DeletedAt: deletedAt(48 * time.Hour)}, nil)
+
+	_, err := service.UndeleteResource(id)
+	assert.ErrorIs(t, err, ErrPastRetention)
+	_, err = service.UndeleteRole(id)
+	assert.ErrorIs(t, err, ErrPastRetention)
+	_, err = service.UndeletePolicy(id)
+	assert.ErrorIs(t, err, ErrPastRetention)
+
+	resourceRepo.AssertNotCalled(t, "Undelete", mock.Anything)
+	roleRepo.AssertNotCalled(t, "Undelete", mock.Anything)
+	policyRepo.AssertNotCalled(t, "Undelete", mock.Anything)
+
+	// Without retention deleted rows can always be restored
+	service.SetRetention(0)
+	roleRepo.On("Undelete", id).Return(nil)
+	roleRepo.On("GetByID", id).Return(&domain.Role{ID: id}, nil)
+	_, err = service.UndeleteRole(id)
+	assert.NoError(t, err)
+}
+
+func TestIAMService_UndeletePolicy_RecordsRevision(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	resourceID := uuid.New()
+	policyID := uuid.New()
+	policyRepo.On("GetDeletedByResourceID", resourceID).
+		Return(&domain.Policy{ID: policyID, ResourceID: resourceID, DeletedAt: deletedAt(time.Hour)}, nil)
+	policyRepo.On("Undelete", policyID).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: resourceID, Version: 3}, nil)
+	revisionRepo.On("Create", mock.AnythingOfType("*domain.PolicyRevision")).Return(nil)
+
+	policy, err := service.UndeletePolicy(resourceID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, policy.Version)
+	revisionRepo.AssertExpectations(t)
+}
+
+func TestIAMService_PurgeDeleted(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	_, err := service.PurgeDeleted()
+	assert.ErrorContains(t, err, "retention is not configured")
+
+	service.SetRetention(24 * time.Hour)
+	cutoff := mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) >= 24*time.Hour && time.Since(before) < 25*time.Hour
+	})
+	bindingRepo.On("PurgeDeleted", cutoff).Return(int64(4), nil)
+	policyRepo.On("PurgeDeleted", cutoff).Return(int64(1), nil)
+	roleRepo.On("PurgeDeleted", cutoff).Return(int64(0), errors.New("connection reset"))
+
+	result, err := service.PurgeDeleted()
+	assert.ErrorContains(t, err, "failed to purge roles")
+	assert.Equal(t, &PurgeResult{Bindings: 4, Policies: 1}, result)
+	resourceRepo.AssertNotCalled(t, "PurgeDeleted", mock.Anything)
+}
+
+func TestPurger(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	service.SetRetention(time.Hour)
+	purged := make(chan struct{}, 1)
+	bindingRepo.On("PurgeDeleted", mock.Anything).Return(int64(0), nil)
+	service.policyRepo.(*MockPolicyRepository).On("PurgeDeleted", mock.Anything).Return(int64(0), nil)
+	service.roleRepo.(*MockRoleRepository).On("PurgeDeleted", mock.Anything).Return(int64(0), nil)
+	resourceRepo.On("PurgeDeleted", mock.Anything).Return(int64(2), nil).Run(func(mock.Arguments) {
+		select {
+		case purged <- struct{}{}:
+		default:
+		}
+	})
+
+	purger := NewPurger(service, 10*time.Millisecond, nil)
+	purger.Start()
+
+	select {
+	case <-purged:
+	case <-time.After(time.Second):
+		t.Fatal("deleted rows were not purged")
+	}
+	require.NoError(t, purger.Stop(context.Background()))
+}
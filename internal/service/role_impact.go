@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+)
+
+// ErrImpactNotAcknowledged is returned by UpdateRole when impact acknowledgment is required and the
+// request does not carry the token of the current impact analysis
+var ErrImpactNotAcknowledged = errors.New("role update impact not acknowledged")
+
+// RoleImpact describes who and what a change of a role's permissions affects
+type RoleImpact struct {
+	RoleID             uuid.UUID
+	AddedPermissions   []string
+	RemovedPermissions []string
+	Bindings           []uuid.UUID // Bindings granting the role
+	Resources          []uuid.UUID // Resources the role is bound on; their descendants inherit the change
+	Principals         []string    // Members of those bindings, e.g. users, groups and domains
+
+	// Token acknowledges this impact in UpdateRole. It changes when the permission diff or the
+	// role's bindings change, so an acknowledgment goes stale once the impact differs.
+	Token string
+}
+
+// SetRequireImpactAcknowledgment makes UpdateRole reject permission changes to bound roles unless
+// the request carries the token of the current AnalyzeRoleImpact result.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetRequireImpactAcknowledgment(require bool) {
+	s.requireImpactAck = require
+}
+
+// AnalyzeRoleImpact returns the bindings, resources and principals affected by replacing the
+// permissions of a role with permissionIDs, without changing anything
+func (s *IAMService) AnalyzeRoleImpact(roleID uuid.UUID, permissionIDs []uuid.UUID) (*RoleImpact, error) {
+	if err := s.authorize("AnalyzeRoleImpact", nil); err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.GetByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role not found")
+	}
+
+	permissions, err := s.permissionRepo.GetByIDs(permissionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	return s.roleImpact(role, permissions)
+}
+
+// roleImpact computes the impact of giving role the permissions
+func (s *IAMService) roleImpact(role *domain.Role, permissions []domain.Permission) (*RoleImpact, error) {
+	impact := &RoleImpact{
+		RoleID:             role.ID,
+		AddedPermissions:   []string{},
+		RemovedPermissions: []string{},
+		Bindings:           []uuid.UUID{},
+		Resources:          []uuid.UUID{},
+		Principals:         []string{},
+	}
+
+	current := make(map[string]bool, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		current[permission.Name] = true
+	}
+	proposed := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		proposed[permission.Name] = true
+		if !current[permission.Name] {
+			impact.AddedPermissions = append(impact.AddedPermissions, permission.Name)
+		}
+	}
+	for name := range current {
+		if !proposed[name] {
+			impact.RemovedPermissions = append(impact.RemovedPermissions, name)
+		}
+	}
+	sort.Strings(impact.AddedPermissions)
+	sort.Strings(impact.RemovedPermissions)
+
+	bindings, err := s.bindingRepo.ListByRole(role.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bindings: %w", err)
+	}
+
+	resources := make(map[uuid.UUID]bool)
+	principals := make(map[string]bool)
+	for i := range bindings {
+		impact.Bindings = append(impact.Bindings, bindings[i].ID)
+		if policy := bindings[i].Policy; policy != nil && !resources[policy.ResourceID] {
+			resources[policy.ResourceID] = true
+			impact.Resources = append(impact.Resources, policy.ResourceID)
+		}
+		members, err := bindings[i].GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("invalid members in binding %s: %w", bindings[i].ID, err)
+		}
+		for _, member := range members {
+			if !principals[member] {
+				principals[member] = true
+				impact.Principals = append(impact.Principals, member)
+			}
+		}
+	}
+	sort.Strings(impact.Principals)
+
+	impact.Token = impact.token()
+	return impact, nil
+}
+
+// token fingerprints the permission diff and the affected bindings
+func (impact *RoleImpact) token() string {
+	bindings := make([]string, len(impact.Bindings))
+	for i, id := range impact.Bindings {
+		bindings[i] = id.String()
+	}
+	sort.Strings(bindings)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%q\n%q\n%q\n", impact.RoleID, impact.AddedPermissions, impact.RemovedPermissions, bindings)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// changesPermissions reports whether the impact adds or removes any permission
+func (impact *RoleImpact) changesPermissions() bool {
+	return len(impact.AddedPermissions) > 0 || len(impact.RemovedPermissions) > 0
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// roleImpactFixture is a storage role bound on a project and a bucket
+type roleImpactFixture struct {
+	service             *IAMService
+	role                domain.Role
+	read, write, delete domain.Permission
+	projectID, bucketID uuid.UUID
+	bindings            []domain.Binding
+}
+
+func newRoleImpactFixture() *roleImpactFixture {
+	service, _, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+
+	f := &roleImpactFixture{
+		service:   service,
+		read:      domain.Permission{ID: uuid.New(), Name: "storage.objects.read"},
+		write:     domain.Permission{ID: uuid.New(), Name: "storage.objects.write"},
+		delete:    domain.Permission{ID: uuid.New(), Name: "storage.objects.delete"},
+		projectID: uuid.New(),
+		bucketID:  uuid.New(),
+	}
+	f.role = domain.Role{ID: uuid.New(), Name: "roles/storage.editor", Permissions: []domain.Permission{f.read, f.write}}
+	f.bindings = []domain.Binding{
+		{ID: uuid.New(), RoleID: f.role.ID, Policy: &domain.Policy{ResourceID: f.projectID},
+			Members: toJSON([]string{"user:alice@example.com", "group:eng@example.com"})},
+		{ID: uuid.New(), RoleID: f.role.ID, Policy: &domain.Policy{ResourceID: f.bucketID},
+			Members: toJSON([]string{"user:alice@example.com", "serviceAccount:ci@example.com"})},
+	}
+
+	roleRepo.On("GetByID", f.role.ID).Return(&f.role, nil)
+	roleRepo.On("Update", mock.AnythingOfType("*domain.Role")).Return(nil)
+	permissionRepo.On("GetByIDs", []uuid.UUID{f.read.ID, f.delete.ID}).Return([]domain.Permission{f.read, f.delete}, nil)
+	permissionRepo.On("GetByIDs", []uuid.UUID{f.read.ID, f.write.ID}).Return([]domain.Permission{f.read, f.write}, nil)
+	bindingRepo.On("ListByRole", f.role.ID).Return(f.bindings, nil)
+	return f
+}
+
+func TestIAMService_AnalyzeRoleImpact(t *testing.T) {
+	f := newRoleImpactFixture()
+
+	impact, err := f.service.AnalyzeRoleImpact(f.role.ID, []uuid.UUID{f.read.ID, f.delete.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.objects.delete"}, impact.AddedPermissions)
+	assert.Equal(t, []string{"storage.objects.write"}, impact.RemovedPermissions)
+	assert.Equal(t, []uuid.UUID{f.bindings[0].ID, f.bindings[1].ID}, impact.Bindings)
+	assert.Equal(t, []uuid.UUID{f.projectID, f.bucketID}, impact.Resources)
+	assert.Equal(t, []string{"group:eng@example.com", "serviceAccount:ci@example.com", "user:alice@example.com"}, impact.Principals)
+	assert.NotEmpty(t, impact.Token)
+
+	// The same permissions give no diff and a different token
+	unchanged, err := f.service.AnalyzeRoleImpact(f.role.ID, []uuid.UUID{f.read.ID, f.write.ID})
+	require.NoError(t, err)
+	assert.Empty(t, unchanged.AddedPermissions)
+	assert.Empty(t, unchanged.RemovedPermissions)
+	assert.NotEqual(t, impact.Token, unchanged.Token)
+}
+
+func TestIAMService_AnalyzeRoleImpact_RoleNotFound(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	id := uuid.New()
+	service.roleRepo.(*MockRoleRepository).On("GetByID", id).Return(nil, nil)
+
+	_, err := service.AnalyzeRoleImpact(id, nil)
+	assert.ErrorContains(t, err, "role not found")
+}
+
+func TestIAMService_UpdateRole_RequiresImpactAcknowledgment(t *testing.T) {
+	f := newRoleImpactFixture()
+	f.service.SetRequireImpactAcknowledgment(true)
+	permissionIDs := []uuid.UUID{f.read.ID, f.delete.ID}
+
+	_, err := f.service.UpdateRole(f.role.ID, "Editor", "", permissionIDs, nil, "", "")
+	assert.ErrorIs(t, err, ErrImpactNotAcknowledged)
+	assert.ErrorContains(t, err, "affects 2 bindings on 2 resources")
+
+	_, err = f.service.UpdateRole(f.role.ID, "Editor", "", permissionIDs, nil, "", "stale")
+	assert.ErrorIs(t, err, ErrImpactNotAcknowledged)
+
+	// Changes that keep the permissions need no acknowledgment
+	_, err = f.service.UpdateRole(f.role.ID, "Storage Editor", "", []uuid.UUID{f.read.ID, f.write.ID}, nil, "", "")
+	require.NoError(t, err)
+
+	impact, err := f.service.AnalyzeRoleImpact(f.role.ID, permissionIDs)
+	require.NoError(t, err)
+	role, err := f.service.UpdateRole(f.role.ID, "Editor", "", permissionIDs, nil, "", impact.Token)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Permission{f.read, f.delete}, role.Permissions)
+}
+
+func TestIAMService_UpdateRole_AcknowledgmentNotRequired(t *testing.T) {
+	f := newRoleImpactFixture()
+
+	_, err := f.service.UpdateRole(f.role.ID, "Editor", "", []uuid.UUID{f.read.ID, f.delete.ID}, nil, "", "")
+	require.NoError(t, err)
+	f.service.bindingRepo.(*MockBindingRepository).AssertNotCalled(t, "ListByRole", mock.Anything)
+}
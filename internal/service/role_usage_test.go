@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIAMService_GetRoleUsage(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	role := &domain.Role{ID: uuid.New(), Name: "roles/storage.viewer"}
+	roleRepo.On("GetByID", role.ID).Return(role, nil)
+	bindingRepo.On("RoleUsage", []uuid.UUID{role.ID}).
+		Return([]repository.RoleBindingUsage{{RoleID: role.ID, Bindings: 3, Principals: 5}}, nil)
+
+	// Without the decision log only binding counters are known
+	usage, err := service.GetRoleUsage(role.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &RoleUsage{RoleID: role.ID, Bindings: 3, Principals: 5}, usage)
+
+	lastUsedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.SetAccessAnalysis(&stubDecisionLogRepository{roleUsage: []repository.RoleGrantUsage{
+		{Role: role.Name, Count: 42, LastUsedAt: lastUsedAt},
+	}}, &memRecommendationRepository{})
+
+	usage, err = service.GetRoleUsage(role.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), usage.Grants)
+	require.NotNil(t, usage.LastUsedAt)
+	assert.Equal(t, lastUsedAt, *usage.LastUsedAt)
+}
+
+func TestIAMService_GetRoleUsage_NotFound(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	roleID := uuid.New()
+	service.roleRepo.(*MockRoleRepository).On("GetByID", roleID).Return(nil, nil)
+
+	_, err := service.GetRoleUsage(roleID)
+	assert.EqualError(t, err, "role not found")
+}
+
+func TestIAMService_RoleUsages(t *testing.T) {
+	service, _, bindingRepo := newMoveTestService()
+
+	used := domain.Role{ID: uuid.New(), Name: "roles/editor"}
+	unused := domain.Role{ID: uuid.New(), Name: "roles/legacy"}
+	bindingRepo.On("RoleUsage", []uuid.UUID{used.ID, unused.ID}).
+		Return([]repository.RoleBindingUsage{{RoleID: used.ID, Bindings: 1, Principals: 2}}, nil)
+	service.SetAccessAnalysis(&stubDecisionLogRepository{roleUsage: []repository.RoleGrantUsage{
+		{Role: used.Name, Count: 7, LastUsedAt: time.Now()},
+	}}, &memRecommendationRepository{})
+
+	usage, err := service.RoleUsages([]domain.Role{used, unused})
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	assert.Equal(t, int64(7), usage[0].Grants)
+	assert.Equal(t, RoleUsage{RoleID: unused.ID}, usage[1])
+
+	usage, err = service.RoleUsages(nil)
+	require.NoError(t, err)
+	assert.Empty(t, usage)
+}
@@ -0,0 +1,685 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"gopkg.in/yaml.v3"
+	"gorm.io/datatypes"
+)
+
+// SeedFile declares permissions, roles, resources and bindings to import with ApplySeed:
+//
+//	permissions:
+//	  - name: storage.buckets.get
+//	    description: Get bucket details
+//	roles:
+//	  - name: roles/storage.viewer
+//	    title: Storage Viewer
+//	    permissions: [storage.buckets.get]
+//	resources:
+//	  - key: org
+//	    type: organization
+//	    name: Example Corp
+//	  - key: prod
+//	    type: project
+//	    name: Production
+//	    parent: org
+//	bindings:
+//	  - resource: prod
+//	    role: roles/storage.viewer
+//	    members: [group:sre@example.com]
+type SeedFile struct {
+	// The permissions of a service (the prefix of their name before the first ".") are its
+	// complete catalog: permissions of the service missing from the file are deprecated
+	Permissions []SeedPermission `yaml:"permissions"`
+	Roles       []SeedRole       `yaml:"roles"`
+	Resources   []SeedResource   `yaml:"resources"`
+	Bindings    []SeedBinding    `yaml:"bindings"`
+}
+
+// SeedPermission declares a permission
+type SeedPermission struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// SeedRole declares a custom role. Permissions not declared in the file must already exist.
+type SeedRole struct {
+	Name        string   `yaml:"name"`
+	Title       string   `yaml:"title"`
+	Description string   `yaml:"description"`
+	Permissions []string `yaml:"permissions"`
+	Scope       string   `yaml:"scope"` // Key of the resource the role is scoped to, if any
+}
+
+// SeedResource declares a resource. It is identified by its parent, type and name, so
+// re-importing a file updates the resources it created instead of duplicating them.
+type SeedResource struct {
+	Key        string                 `yaml:"key"` // Refers to the resource elsewhere in the file
+	Type       string                 `yaml:"type"`
+	Name       string                 `yaml:"name"`
+	Parent     string                 `yaml:"parent"` // Key of the parent resource; empty for a root
+	Attributes map[string]interface{} `yaml:"attributes"`
+	Tags       map[string]string      `yaml:"tags"`
+}
+
+// SeedBinding grants a role to members on a resource. Roles not declared in the file must
+// already exist, e.g. predefined roles.
+type SeedBinding struct {
+	Resource  string         `yaml:"resource"` // Resource key
+	Role      string         `yaml:"role"`     // Role name
+	Members   []string       `yaml:"members"`
+	Condition *SeedCondition `yaml:"condition"`
+}
+
+// SeedCondition is the condition of a SeedBinding
+type SeedCondition struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Expression  string `yaml:"expression"`
+}
+
+// SeedCounts counts the objects of one kind handled by ApplySeed
+type SeedCounts struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// SeedResult summarizes an ApplySeed run. Policies counts the resources whose bindings were
+// created or extended.
+type SeedResult struct {
+	Permissions           SeedCounts
+	DeprecatedPermissions []string
+	Roles                 SeedCounts
+	Resources             SeedCounts
+	Policies              SeedCounts
+}
+
+// ParseSeedFile reads and validates a YAML seed file. Unknown fields are rejected so that
+// typos do not silently drop declarations.
+func ParseSeedFile(r io.Reader) (*SeedFile, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	file := &SeedFile{}
+	if err := decoder.Decode(file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse seed file: %w", err)
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Validate checks the file on its own: required fields, duplicates, and references to
+// resources declared in it. References to existing permissions and roles are checked by
+// ApplySeed before anything is written.
+func (f *SeedFile) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	permissions := make(map[string]bool, len(f.Permissions))
+	for i, permission := range f.Permissions {
+		switch {
+		case permission.Name == "":
+			addf("permissions[%d]: name is required", i)
+		case permissionService(permission.Name) == "":
+			addf("permission %q: name must be <service>.<resource>.<verb>", permission.Name)
+		case permissions[permission.Name]:
+			addf("permission %q: declared more than once", permission.Name)
+		}
+		permissions[permission.Name] = true
+	}
+
+	resources := make(map[string]*SeedResource, len(f.Resources))
+	for i := range f.Resources {
+		resource := &f.Resources[i]
+		if resource.Key == "" {
+			addf("resources[%d]: key is required", i)
+			continue
+		}
+		if resources[resource.Key] != nil {
+			addf("resource %q: declared more than once", resource.Key)
+			continue
+		}
+		resources[resource.Key] = resource
+		if resource.Type == "" {
+			addf("resource %q: type is required", resource.Key)
+		}
+		if resource.Name == "" {
+			addf("resource %q: name is required", resource.Key)
+		}
+		if err := ValidateResourceTags(resource.Tags); err != nil {
+			addf("resource %q: %v", resource.Key, err)
+		}
+	}
+	for _, resource := range f.Resources {
+		if resource.Parent != "" && resources[resource.Parent] == nil {
+			addf("resource %q: parent %q is not declared", resource.Key, resource.Parent)
+		}
+	}
+	if _, err := f.resourceOrder(); err != nil {
+		addf("%v", err)
+	}
+
+	roles := make(map[string]bool, len(f.Roles))
+	for i, role := range f.Roles {
+		if role.Name == "" {
+			addf("roles[%d]: name is required", i)
+			continue
+		}
+		if roles[role.Name] {
+			addf("role %q: declared more than once", role.Name)
+		}
+		roles[role.Name] = true
+		if role.Title == "" {
+			addf("role %q: title is required", role.Name)
+		}
+		if role.Scope != "" && resources[role.Scope] == nil {
+			addf("role %q: scope %q is not declared", role.Name, role.Scope)
+		}
+	}
+
+	for i, binding := range f.Bindings {
+		if binding.Resource == "" {
+			addf("bindings[%d]: resource is required", i)
+		} else if resources[binding.Resource] == nil {
+			addf("bindings[%d]: resource %q is not declared", i, binding.Resource)
+		}
+		if binding.Role == "" {
+			addf("bindings[%d]: role is required", i)
+		}
+		if len(binding.Members) == 0 {
+			addf("bindings[%d]: at least one member is required", i)
+		}
+		if binding.Condition != nil {
+			if err := ValidateConditionExpression(binding.Condition.Expression); err != nil {
+				addf("bindings[%d]: invalid condition: %v", i, err)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid seed file:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// resourceOrder returns the resources parents first, or an error naming a resource that is
+// its own ancestor
+func (f *SeedFile) resourceOrder() ([]*SeedResource, error) {
+	byKey := make(map[string]*SeedResource, len(f.Resources))
+	for i := range f.Resources {
+		byKey[f.Resources[i].Key] = &f.Resources[i]
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(f.Resources))
+	order := make([]*SeedResource, 0, len(f.Resources))
+	var visit func(resource *SeedResource) error
+	visit = func(resource *SeedResource) error {
+		switch state[resource.Key] {
+		case visiting:
+			return fmt.Errorf("resource %q is its own ancestor", resource.Key)
+		case visited:
+			return nil
+		}
+		state[resource.Key] = visiting
+		if parent := byKey[resource.Parent]; parent != nil {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[resource.Key] = visited
+		order = append(order, resource)
+		return nil
+	}
+	for i := range f.Resources {
+		if err := visit(&f.Resources[i]); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// permissionService returns the service of a permission name, or "" if it has none
+func permissionService(name string) string {
+	service, rest, ok := strings.Cut(name, ".")
+	if !ok || service == "" || rest == "" {
+		return ""
+	}
+	return service
+}
+
+// ApplySeed imports a seed file idempotently: missing objects are created, changed ones
+// updated, and re-applying the same file changes nothing. Permissions and roles referenced
+// but not declared must exist; they are checked before anything is written.
+//
+// Bindings are additive: members missing from a binding of the same role and condition are
+// added, and bindings not in the file are kept.
+func (s *IAMService) ApplySeed(file *SeedFile) (*SeedResult, error) {
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkSeedReferences(file); err != nil {
+		return nil, err
+	}
+
+	result := &SeedResult{}
+	if err := s.seedPermissions(file, result); err != nil {
+		return nil, err
+	}
+	resourceIDs, err := s.seedResources(file, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.seedRoles(file, resourceIDs, result); err != nil {
+		return nil, err
+	}
+	if err := s.seedBindings(file, resourceIDs, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkSeedReferences reports permissions and roles used but neither declared nor stored
+func (s *IAMService) checkSeedReferences(file *SeedFile) error {
+	declared := make(map[string]bool)
+	for _, permission := range file.Permissions {
+		declared["permission "+permission.Name] = true
+	}
+	for _, role := range file.Roles {
+		declared["role "+role.Name] = true
+	}
+
+	var missing []string
+	checked := make(map[string]bool)
+	check := func(kind, name string, lookup func(string) (bool, error)) error {
+		key := kind + " " + name
+		if declared[key] || checked[key] {
+			return nil
+		}
+		checked[key] = true
+		found, err := lookup(name)
+		if err != nil {
+			return fmt.Errorf("failed to get %s %q: %w", kind, name, err)
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("%s %q", kind, name))
+		}
+		return nil
+	}
+	permissionExists := func(name string) (bool, error) {
+		permission, err := s.permissionRepo.GetByName(name)
+		return permission != nil, err
+	}
+	roleExists := func(name string) (bool, error) {
+		role, err := s.roleRepo.GetByName(name)
+		return role != nil, err
+	}
+
+	for _, role := range file.Roles {
+		for _, name := range role.Permissions {
+			if err := check("permission", name, permissionExists); err != nil {
+				return err
+			}
+		}
+	}
+	for _, binding := range file.Bindings {
+		if err := check("role", binding.Role, roleExists); err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("seed file references undeclared objects that do not exist: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (s *IAMService) seedPermissions(file *SeedFile, result *SeedResult) error {
+	catalogs := make(map[string][]PermissionDef)
+	var services []string
+	for _, permission := range file.Permissions {
+		service := permissionService(permission.Name)
+		if _, ok := catalogs[service]; !ok {
+			services = append(services, service)
+		}
+		catalogs[service] = append(catalogs[service], PermissionDef{
+			Name:        permission.Name,
+			Description: permission.Description,
+		})
+	}
+
+	for _, service := range services {
+		synced, err := s.SyncServicePermissions(service, catalogs[service])
+		if err != nil {
+			return fmt.Errorf("failed to seed %s permissions: %w", service, err)
+		}
+		result.Permissions.Created += len(synced.Created)
+		result.Permissions.Updated += len(synced.Updated)
+		result.Permissions.Unchanged += len(synced.Unchanged)
+		result.DeprecatedPermissions = append(result.DeprecatedPermissions, synced.Deprecated...)
+	}
+	return nil
+}
+
+// seedResources creates or updates the resources, parents first, and returns their IDs by key
+func (s *IAMService) seedResources(file *SeedFile, result *SeedResult) (map[string]uuid.UUID, error) {
+	order, err := file.resourceOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]uuid.UUID, len(order))
+	for _, declared := range order {
+		var parentID *uuid.UUID
+		if declared.Parent != "" {
+			id := ids[declared.Parent]
+			parentID = &id
+		}
+
+		existing, err := s.findSeedResource(declared, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			resource, err := s.CreateResource(declared.Type, declared.Name, parentID, declared.Attributes, declared.Tags, "")
+			if err != nil {
+				return nil, fmt.Errorf("resource %q: %w", declared.Key, err)
+			}
+			ids[declared.Key] = resource.ID
+			result.Resources.Created++
+			continue
+		}
+		ids[declared.Key] = existing.ID
+
+		changed := false
+		if !sameJSON(existing.Attributes, declared.Attributes) {
+			if _, err := s.UpdateResource(existing.ID, "", declared.Attributes, []string{ResourceFieldAttributes}, ""); err != nil {
+				return nil, fmt.Errorf("resource %q: %w", declared.Key, err)
+			}
+			changed = true
+		}
+		if !sameTags(existing.Tags, declared.Tags) {
+			if _, err := s.SetResourceTags(existing.ID, declared.Tags); err != nil {
+				return nil, fmt.Errorf("resource %q: %w", declared.Key, err)
+			}
+			changed = true
+		}
+		if changed {
+			result.Resources.Updated++
+		} else {
+			result.Resources.Unchanged++
+		}
+	}
+	return ids, nil
+}
+
+// findSeedResource returns the stored resource with the parent, type and name of declared, if any
+func (s *IAMService) findSeedResource(declared *SeedResource, parentID *uuid.UUID) (*domain.Resource, error) {
+	candidates, err := s.resourceRepo.List(parentID, declared.Type, nil, nil, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: failed to list resources: %w", declared.Key, err)
+	}
+
+	var found *domain.Resource
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.Name != declared.Name || (parentID == nil) != (candidate.ParentID == nil) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("resource %q: several %s resources are named %q under the same parent",
+				declared.Key, declared.Type, declared.Name)
+		}
+		found = candidate
+	}
+	return found, nil
+}
+
+func (s *IAMService) seedRoles(file *SeedFile, resourceIDs map[string]uuid.UUID, result *SeedResult) error {
+	for _, declared := range file.Roles {
+		permissionIDs := make([]uuid.UUID, 0, len(declared.Permissions))
+		for _, name := range declared.Permissions {
+			permission, err := s.permissionRepo.GetByName(name)
+			if err != nil {
+				return fmt.Errorf("role %q: failed to get permission %q: %w", declared.Name, name, err)
+			}
+			if permission == nil {
+				return fmt.Errorf("role %q: permission %q not found", declared.Name, name)
+			}
+			permissionIDs = append(permissionIDs, permission.ID)
+		}
+		var scopeID *uuid.UUID
+		if declared.Scope != "" {
+			id := resourceIDs[declared.Scope]
+			scopeID = &id
+		}
+
+		existing, err := s.roleRepo.GetByName(declared.Name)
+		if err != nil {
+			return fmt.Errorf("role %q: failed to get role: %w", declared.Name, err)
+		}
+		if existing == nil {
+			if _, err := s.CreateRole(declared.Name, declared.Title, declared.Description, permissionIDs, scopeID); err != nil {
+				return fmt.Errorf("role %q: %w", declared.Name, err)
+			}
+			result.Roles.Created++
+			continue
+		}
+
+		if !existing.IsCustom {
+			return fmt.Errorf("role %q: predefined roles cannot be seeded", declared.Name)
+		}
+		if !sameUUIDPointer(existing.ScopeResourceID, scopeID) {
+			return fmt.Errorf("role %q: the scope of an existing role cannot be changed", declared.Name)
+		}
+		if existing.Title == declared.Title && existing.Description == declared.Description &&
+			samePermissionSet(existing.Permissions, permissionIDs) {
+			result.Roles.Unchanged++
+			continue
+		}
+		if _, err := s.UpdateRole(existing.ID, declared.Title, declared.Description, permissionIDs, nil, "", ""); err != nil {
+			return fmt.Errorf("role %q: %w", declared.Name, err)
+		}
+		result.Roles.Updated++
+	}
+	return nil
+}
+
+// seedBindings merges the declared bindings into the policy of each resource
+func (s *IAMService) seedBindings(file *SeedFile, resourceIDs map[string]uuid.UUID, result *SeedResult) error {
+	var keys []string
+	byResource := make(map[string][]SeedBinding)
+	for _, binding := range file.Bindings {
+		if _, ok := byResource[binding.Resource]; !ok {
+			keys = append(keys, binding.Resource)
+		}
+		byResource[binding.Resource] = append(byResource[binding.Resource], binding)
+	}
+
+	roleIDs := make(map[string]uuid.UUID)
+	for _, key := range keys {
+		resourceID := resourceIDs[key]
+		policy, err := s.policyRepo.GetByResourceID(resourceID)
+		if err != nil {
+			return fmt.Errorf("resource %q: failed to get policy: %w", key, err)
+		}
+
+		// Start from the current bindings, recreated without their IDs
+		var current []domain.Binding
+		if policy != nil {
+			current = make([]domain.Binding, len(policy.Bindings))
+			for i, binding := range policy.Bindings {
+				current[i] = domain.Binding{RoleID: binding.RoleID, Members: binding.Members, Annotations: binding.Annotations}
+				if binding.Condition != nil {
+					current[i].Condition = &domain.Condition{
+						Title:       binding.Condition.Title,
+						Description: binding.Condition.Description,
+						Expression:  binding.Condition.Expression,
+					}
+				}
+			}
+		}
+
+		merged := current
+		changed := false
+		for _, declared := range byResource[key] {
+			roleID, ok := roleIDs[declared.Role]
+			if !ok {
+				role, err := s.roleRepo.GetByName(declared.Role)
+				if err != nil {
+					return fmt.Errorf("resource %q: failed to get role %q: %w", key, declared.Role, err)
+				}
+				if role == nil {
+					return fmt.Errorf("resource %q: role %q not found", key, declared.Role)
+				}
+				roleID = role.ID
+				roleIDs[declared.Role] = roleID
+			}
+
+			added, err := mergeSeedBinding(&merged, roleID, declared)
+			if err != nil {
+				return fmt.Errorf("resource %q: %w", key, err)
+			}
+			changed = changed || added
+		}
+
+		switch {
+		case !changed:
+			result.Policies.Unchanged++
+		case policy == nil:
+			if _, err := s.BatchCreateBindings(resourceID, merged); err != nil {
+				return fmt.Errorf("resource %q: %w", key, err)
+			}
+			result.Policies.Created++
+		default:
+			if _, err := s.replaceBindings(policy, merged); err != nil {
+				return fmt.Errorf("resource %q: %w", key, err)
+			}
+			result.Policies.Updated++
+		}
+	}
+	return nil
+}
+
+// mergeSeedBinding adds the members of declared to the binding of the same role and condition
+// in bindings, appending a new binding if there is none. It reports whether bindings changed.
+func mergeSeedBinding(bindings *[]domain.Binding, roleID uuid.UUID, declared SeedBinding) (bool, error) {
+	for i := range *bindings {
+		binding := &(*bindings)[i]
+		if binding.RoleID != roleID || !sameSeedCondition(binding.Condition, declared.Condition) {
+			continue
+		}
+
+		members, err := binding.GetMembers()
+		if err != nil {
+			return false, fmt.Errorf("invalid members: %w", err)
+		}
+		present := make(map[string]bool, len(members))
+		for _, member := range members {
+			present[member] = true
+		}
+		added := false
+		for _, member := range declared.Members {
+			if !present[member] {
+				members = append(members, member)
+				present[member] = true
+				added = true
+			}
+		}
+		if !added {
+			return false, nil
+		}
+		membersJSON, err := json.Marshal(members)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal members: %w", err)
+		}
+		binding.Members = datatypes.JSON(membersJSON)
+		return true, nil
+	}
+
+	membersJSON, err := json.Marshal(declared.Members)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal members: %w", err)
+	}
+	binding := domain.Binding{RoleID: roleID, Members: datatypes.JSON(membersJSON)}
+	if declared.Condition != nil {
+		binding.Condition = &domain.Condition{
+			Title:       declared.Condition.Title,
+			Description: declared.Condition.Description,
+			Expression:  declared.Condition.Expression,
+		}
+	}
+	*bindings = append(*bindings, binding)
+	return true, nil
+}
+
+func sameSeedCondition(stored *domain.Condition, declared *SeedCondition) bool {
+	if stored == nil || declared == nil {
+		return stored == nil && declared == nil
+	}
+	return stored.Expression == declared.Expression
+}
+
+// sameJSON compares attributes by their JSON encoding, so that numbers decoded from YAML and
+// from the database compare equal. Empty and missing attributes are the same.
+func sameJSON(stored domain.Attributes, declared map[string]interface{}) bool {
+	if len(stored) == 0 && len(declared) == 0 {
+		return true
+	}
+	a, errA := json.Marshal(map[string]interface{}(stored))
+	b, errB := json.Marshal(declared)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+func sameTags(stored []domain.ResourceTag, declared map[string]string) bool {
+	if len(stored) != len(declared) {
+		return false
+	}
+	for _, tag := range stored {
+		if value, ok := declared[tag.Key]; !ok || value != tag.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func samePermissionSet(stored []domain.Permission, declared []uuid.UUID) bool {
+	want := make([]string, 0, len(declared))
+	seen := make(map[uuid.UUID]bool, len(declared))
+	for _, id := range declared {
+		if !seen[id] {
+			seen[id] = true
+			want = append(want, id.String())
+		}
+	}
+	have := make([]string, len(stored))
+	for i, permission := range stored {
+		have[i] = permission.ID.String()
+	}
+	sort.Strings(want)
+	sort.Strings(have)
+	return strings.Join(want, ",") == strings.Join(have, ",")
+}
+
+func sameUUIDPointer(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testSeedYAML = `
+permissions:
+  - name: storage.buckets.get
+    description: Get bucket details
+roles:
+  - name: roles/storage.reader
+    title: Storage Reader
+    permissions: [storage.buckets.get]
+resources:
+  - key: bucket
+    type: bucket
+    name: prod-data
+    parent: org
+    attributes:
+      region: us-east-1
+      replicas: 3
+  - key: org
+    type: organization
+    name: Example Corp
+bindings:
+  - resource: bucket
+    role: roles/storage.reader
+    members: [group:sre@example.com]
+`
+
+func TestParseSeedFile(t *testing.T) {
+	file, err := ParseSeedFile(strings.NewReader(testSeedYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, []SeedPermission{{Name: "storage.buckets.get", Description: "Get bucket details"}}, file.Permissions)
+	require.Len(t, file.Resources, 2)
+	assert.Equal(t, map[string]interface{}{"region": "us-east-1", "replicas": 3}, file.Resources[0].Attributes)
+	assert.Equal(t, []string{"group:sre@example.com"}, file.Bindings[0].Members)
+
+	order, err := file.resourceOrder()
+	require.NoError(t, err)
+	assert.Equal(t, "org", order[0].Key)
+	assert.Equal(t, "bucket", order[1].Key)
+}
+
+func TestParseSeedFile_Example(t *testing.T) {
+	f, err := os.Open("../../examples/seed/seed.yaml")
+	require.NoError(t, err)
+	defer f.Close()
+
+	file, err := ParseSeedFile(f)
+	require.NoError(t, err)
+	assert.NotEmpty(t, file.Bindings)
+}
+
+func TestParseSeedFile_Empty(t *testing.T) {
+	file, err := ParseSeedFile(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Empty(t, file.Resources)
+}
+
+func TestParseSeedFile_RejectsUnknownFields(t *testing.T) {
+	_, err := ParseSeedFile(strings.NewReader("roles:\n  - name: roles/x\n    titel: X\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field titel not found")
+}
+
+func TestSeedFile_Validate(t *testing.T) {
+	file := &SeedFile{
+		Permissions: []SeedPermission{{Name: "storage"}, {Name: "storage.buckets.get"}, {Name: "storage.buckets.get"}},
+		Roles: []SeedRole{
+			{Name: "roles/scoped", Title: "Scoped", Scope: "missing"},
+			{Name: "roles/untitled"},
+		},
+		Resources: []SeedResource{
+			{Key: "a", Type: "folder", Name: "A", Parent: "b"},
+			{Key: "b", Type: "folder", Name: "B", Parent: "a"},
+			{Key: "c", Type: "folder", Parent: "nowhere"},
+			{Key: "c", Type: "folder", Name: "C"},
+		},
+		Bindings: []SeedBinding{
+			{Resource: "unknown", Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			{Resource: "a", Role: "roles/viewer"},
+			{Resource: "a", Role: "roles/viewer", Members: []string{"allUsers"}, Condition: &SeedCondition{Expression: "request.time < (timestamp"}},
+		},
+	}
+
+	err := file.Validate()
+	require.Error(t, err)
+	for _, problem := range []string{
+		`permission "storage": name must be <service>.<resource>.<verb>`,
+		`permission "storage.buckets.get": declared more than once`,
+		`resource "c": name is required`,
+		`resource "c": declared more than once`,
+		`resource "c": parent "nowhere" is not declared`,
+		`is its own ancestor`,
+		`role "roles/scoped": scope "missing" is not declared`,
+		`role "roles/untitled": title is required`,
+		`bindings[0]: resource "unknown" is not declared`,
+		`bindings[1]: at least one member is required`,
+		`bindings[2]: invalid condition`,
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestIAMService_ApplySeed_RejectsMissingReferences(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+
+	permissionRepo.On("GetByName", "compute.instances.get").Return(nil, nil)
+	roleRepo.On("GetByName", "roles/viewer").Return(nil, nil)
+
+	file := &SeedFile{
+		Roles:     []SeedRole{{Name: "roles/compute.reader", Title: "Compute Reader", Permissions: []string{"compute.instances.get"}}},
+		Resources: []SeedResource{{Key: "org", Type: "organization", Name: "Example Corp"}},
+		Bindings:  []SeedBinding{{Resource: "org", Role: "roles/viewer", Members: []string{"user:alice@example.com"}}},
+	}
+	_, err := service.ApplySeed(file)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `permission "compute.instances.get", role "roles/viewer"`)
+
+	resourceRepo.AssertNotCalled(t, "Create", mock.Anything)
+	roleRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestIAMService_ApplySeed_Creates(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+	revisionRepo := service.revisionRepo.(*MockPolicyRevisionRepository)
+
+	file, err := ParseSeedFile(strings.NewReader(testSeedYAML))
+	require.NoError(t, err)
+
+	permission := &domain.Permission{ID: uuid.New(), Name: "storage.buckets.get"}
+	permissionRepo.On("SyncService", "storage", []domain.Permission{
+		{Name: "storage.buckets.get", Description: "Get bucket details", Service: "storage"},
+	}).Return(&repository.PermissionSyncResult{Created: []string{"storage.buckets.get"}, Deprecated: []string{"storage.buckets.list"}}, nil)
+	permissionRepo.On("GetByName", "storage.buckets.get").Return(permission, nil)
+	permissionRepo.On("GetByIDs", []uuid.UUID{permission.ID}).Return([]domain.Permission{*permission}, nil)
+
+	orgID, bucketID := uuid.New(), uuid.New()
+	resourceRepo.On("List", (*uuid.UUID)(nil), "organization", map[string]interface{}(nil), map[string]string(nil), 0, 0).Return([]domain.Resource{}, nil)
+	resourceRepo.On("List", &orgID, "bucket", map[string]interface{}(nil), map[string]string(nil), 0, 0).Return([]domain.Resource{}, nil)
+	resourceRepo.On("Create", mock.MatchedBy(func(r *domain.Resource) bool { return r.Type == "organization" })).
+		Run(func(args mock.Arguments) { args.Get(0).(*domain.Resource).ID = orgID }).Return(nil)
+	resourceRepo.On("Create", mock.MatchedBy(func(r *domain.Resource) bool {
+		return r.Type == "bucket" && r.ParentID != nil && *r.ParentID == orgID && r.Attributes["region"] == "us-east-1"
+	})).Run(func(args mock.Arguments) { args.Get(0).(*domain.Resource).ID = bucketID }).Return(nil)
+
+	role := &domain.Role{ID: uuid.New(), Name: "roles/storage.reader", IsCustom: true}
+	roleRepo.On("GetByName", "roles/storage.reader").Return(nil, nil).Once()
+	roleRepo.On("Create", mock.MatchedBy(func(r *domain.Role) bool {
+		return r.Name == "roles/storage.reader" && r.IsCustom && len(r.Permissions) == 1
+	})).Return(nil)
+	roleRepo.On("GetByName", "roles/storage.reader").Return(role, nil)
+	roleRepo.On("GetByID", role.ID).Return(role, nil)
+
+	policyID := uuid.New()
+	policyRepo.On("GetByResourceID", bucketID).Return(nil, nil)
+	policyRepo.On("Create", mock.MatchedBy(func(p *domain.Policy) bool { return p.ResourceID == bucketID })).
+		Run(func(args mock.Arguments) { args.Get(0).(*domain.Policy).ID = policyID }).Return(nil)
+	bindingRepo.On("CreateBatch", mock.Anything, mock.MatchedBy(func(bindings []domain.Binding) bool {
+		return len(bindings) == 1 && bindings[0].RoleID == role.ID && string(bindings[0].Members) == `["group:sre@example.com"]`
+	})).Return(nil)
+	policyRepo.On("GetByID", policyID).Return(&domain.Policy{ID: policyID, ResourceID: bucketID}, nil)
+	revisionRepo.On("Create", mock.Anything).Return(nil)
+
+	result, err := service.ApplySeed(file)
+	require.NoError(t, err)
+	assert.Equal(t, SeedCounts{Created: 1}, result.Permissions)
+	assert.Equal(t, []string{"storage.buckets.list"}, result.DeprecatedPermissions)
+	assert.Equal(t, SeedCounts{Created: 1}, result.Roles)
+	assert.Equal(t, SeedCounts{Created: 2}, result.Resources)
+	assert.Equal(t, SeedCounts{Created: 1}, result.Policies)
+	bindingRepo.AssertExpectations(t)
+}
+
+func TestIAMService_ApplySeed_Idempotent(t *testing.T) {
+	service, resourceRepo, bindingRepo := newMoveTestService()
+	permissionRepo := service.permissionRepo.(*MockPermissionRepository)
+	roleRepo := service.roleRepo.(*MockRoleRepository)
+	policyRepo := service.policyRepo.(*MockPolicyRepository)
+
+	file, err := ParseSeedFile(strings.NewReader(testSeedYAML))
+	require.NoError(t, err)
+
+	permission := domain.Permission{ID: uuid.New(), Name: "storage.buckets.get"}
+	permissionRepo.On("SyncService", "storage", mock.Anything).
+		Return(&repository.PermissionSyncResult{Unchanged: []string{"storage.buckets.get"}}, nil)
+	permissionRepo.On("GetByName", "storage.buckets.get").Return(&permission, nil)
+
+	// Attributes read back from JSONB decode numbers as float64
+	org := domain.Resource{ID: uuid.New(), Type: "organization", Name: "Example Corp"}
+	bucket := domain.Resource{ID: uuid.New(), Type: "bucket", Name: "prod-data", ParentID: &org.ID,
+		Attributes: domain.Attributes{"region": "us-east-1", "replicas": float64(3)}}
+	other := domain.Resource{ID: uuid.New(), Type: "organization", Name: "Example Corp", ParentID: &bucket.ID}
+	resourceRepo.On("List", (*uuid.UUID)(nil), "organization", mock.Anything, mock.Anything, 0, 0).Return([]domain.Resource{other, org}, nil)
+	resourceRepo.On("List", &org.ID, "bucket", mock.Anything, mock.Anything, 0, 0).Return([]domain.Resource{bucket}, nil)
+
+	role := &domain.Role{ID: uuid.New(), Name: "roles/storage.reader", Title: "Storage Reader", IsCustom: true,
+		Permissions: []domain.Permission{permission}}
+	roleRepo.On("GetByName", "roles/storage.reader").Return(role, nil)
+
+	policyRepo.On("GetByResourceID", bucket.ID).Return(&domain.Policy{ID: uuid.New(), ResourceID: bucket.ID, Bindings: []domain.Binding{
+		{ID: uuid.New(), RoleID: role.ID, Members: toJSON([]string{"user:alice@example.com", "group:sre@example.com"})},
+	}}, nil)
+
+	result, err := service.ApplySeed(file)
+	require.NoError(t, err)
+	assert.Equal(t, SeedCounts{Unchanged: 1}, result.Permissions)
+	assert.Equal(t, SeedCounts{Unchanged: 1}, result.Roles)
+	assert.Equal(t, SeedCounts{Unchanged: 2}, result.Resources)
+	assert.Equal(t, SeedCounts{Unchanged: 1}, result.Policies)
+
+	resourceRepo.AssertNotCalled(t, "Create", mock.Anything)
+	resourceRepo.AssertNotCalled(t, "Update", mock.Anything)
+	roleRepo.AssertNotCalled(t, "Update", mock.Anything)
+	bindingRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestMergeSeedBinding(t *testing.T) {
+	roleID := uuid.New()
+	condition := &SeedCondition{Expression: `resource.type == "bucket"`}
+	bindings := []domain.Binding{
+		{RoleID: roleID, Members: toJSON([]string{"user:alice@example.com"})},
+		{RoleID: roleID, Members: toJSON([]string{"user:bob@example.com"}), Condition: &domain.Condition{Expression: condition.Expression}},
+	}
+
+	added, err := mergeSeedBinding(&bindings, roleID, SeedBinding{Members: []string{"user:alice@example.com", "user:carol@example.com"}})
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.JSONEq(t, `["user:alice@example.com","user:carol@example.com"]`, string(bindings[0].Members))
+
+	added, err = mergeSeedBinding(&bindings, roleID, SeedBinding{Members: []string{"user:bob@example.com"}, Condition: condition})
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	added, err = mergeSeedBinding(&bindings, uuid.New(), SeedBinding{Members: []string{"user:dave@example.com"}})
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Len(t, bindings, 3)
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+)
+
+// ShadowStats counts the checks evaluated by a shadow evaluator since the server started
+type ShadowStats struct {
+	Checks      int64 // Checks evaluated by both evaluators
+	Divergences int64 // Checks the evaluators decided differently
+	Errors      int64 // Checks the shadow evaluator failed
+	Skipped     int64 // Sampled checks dropped because max_in_flight shadow checks were running
+}
+
+// ShadowEvaluator serves the results of a primary evaluator and evaluates a sample of the same
+// checks with a shadow evaluator in the background, logging the checks they decide differently.
+// It validates a change of evaluator, e.g. from native to opa or to the read model, on
+// production traffic without changing any result. Checks the primary evaluator fails are not
+// compared, and GetEffectivePermissions is not shadowed.
+type ShadowEvaluator struct {
+	PermissionEvaluator
+	shadow     PermissionEvaluator
+	sampleRate float64
+	sample     func() float64
+	slots      chan struct{}
+	logger     *slog.Logger
+	inflight   sync.WaitGroup
+
+	checks      atomic.Int64
+	divergences atomic.Int64
+	errors      atomic.Int64
+	skipped     atomic.Int64
+}
+
+// NewShadowEvaluator wraps primary so that the sample of checks of cfg is also evaluated by
+// shadow. The shadow evaluator should not share the primary evaluator's cache, so its decisions
+// are neither served nor influenced by the primary's.
+func NewShadowEvaluator(primary, shadow PermissionEvaluator, cfg *config.ShadowEvaluatorConfig, logger *slog.Logger) *ShadowEvaluator {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	maxInFlight := cfg.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	return &ShadowEvaluator{
+		PermissionEvaluator: primary,
+		shadow:              shadow,
+		sampleRate:          cfg.SampleRate,
+		sample:              rand.Float64,
+		slots:               make(chan struct{}, maxInFlight),
+		logger:              logger,
+	}
+}
+
+// Stats returns the counters of the checks shadowed so far
+func (se *ShadowEvaluator) Stats() ShadowStats {
+	return ShadowStats{
+		Checks:      se.checks.Load(),
+		Divergences: se.divergences.Load(),
+		Errors:      se.errors.Load(),
+		Skipped:     se.skipped.Load(),
+	}
+}
+
+// Stop waits for the shadow checks in flight to return or ctx to expire
+func (se *ShadowEvaluator) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		se.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goShadow runs fn in the background if the call is sampled and a shadow slot is free
+func (se *ShadowEvaluator) goShadow(fn func()) {
+	if se.sampleRate < 1 && se.sample() >= se.sampleRate {
+		return
+	}
+	select {
+	case se.slots <- struct{}{}:
+	default:
+		se.skipped.Add(1)
+		return
+	}
+
+	se.inflight.Add(1)
+	go func() {
+		defer func() {
+			<-se.slots
+			se.inflight.Done()
+		}()
+		fn()
+	}()
+}
+
+// compare records the shadow result of a check and logs it when it diverges from the primary's
+func (se *ShadowEvaluator) compare(principal string, resourceID uuid.UUID, permission string, primary, shadow CheckResult) {
+	se.checks.Add(1)
+	if primary.Allowed == shadow.Allowed {
+		return
+	}
+	se.divergences.Add(1)
+	se.logger.Warn("Shadow evaluation diverged",
+		"principal", principal,
+		"resource_id", resourceID,
+		"permission", permission,
+		"allowed", primary.Allowed,
+		"reason", primary.Reason,
+		"shadow_allowed", shadow.Allowed,
+		"shadow_reason", shadow.Reason,
+	)
+}
+
+// failed records a check the shadow evaluator could not evaluate
+func (se *ShadowEvaluator) failed(principal string, err error) {
+	se.errors.Add(1)
+	se.logger.Debug("Shadow evaluation failed", "principal", principal, "error", err)
+}
+
+func (se *ShadowEvaluator) CheckPermission(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	return checkPermissionResult(se.Check(principal, resourceID, permission, context))
+}
+
+func (se *ShadowEvaluator) Check(
+	principal string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (CheckResult, error) {
+	result, err := se.PermissionEvaluator.Check(principal, resourceID, permission, context)
+	if err != nil {
+		return result, err
+	}
+
+	// The caller may reuse its context once the check returns
+	context = maps.Clone(context)
+	se.goShadow(func() {
+		shadow, err := se.shadow.Check(principal, resourceID, permission, context)
+		if err != nil {
+			se.failed(principal, err)
+			return
+		}
+		se.compare(principal, resourceID, permission, result, shadow)
+	})
+	return result, nil
+}
+
+func (se *ShadowEvaluator) BatchCheckPermissions(principal string, checks []PermissionCheck) ([]CheckResult, error) {
+	results, err := se.PermissionEvaluator.BatchCheckPermissions(principal, checks)
+	if err != nil {
+		return results, err
+	}
+
+	checks = slices.Clone(checks)
+	for i := range checks {
+		checks[i].Context = maps.Clone(checks[i].Context)
+	}
+	primary := slices.Clone(results)
+	se.goShadow(func() {
+		shadow, err := se.shadow.BatchCheckPermissions(principal, checks)
+		if err == nil && len(shadow) != len(checks) {
+			err = fmt.Errorf("shadow evaluator returned %d results for %d checks", len(shadow), len(checks))
+		}
+		if err != nil {
+			se.failed(principal, err)
+			return
+		}
+		for i, check := range checks {
+			se.compare(principal, check.ResourceID, check.Permission, primary[i], shadow[i])
+		}
+	})
+	return results, nil
+}
+
+func (se *ShadowEvaluator) CheckPermissionForPrincipals(
+	principals []string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) ([]CheckResult, error) {
+	results, err := se.PermissionEvaluator.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+	if err != nil {
+		return results, err
+	}
+
+	principals = slices.Clone(principals)
+	context = maps.Clone(context)
+	primary := slices.Clone(results)
+	se.goShadow(func() {
+		shadow, err := se.shadow.CheckPermissionForPrincipals(principals, resourceID, permission, context)
+		if err == nil && len(shadow) != len(principals) {
+			err = fmt.Errorf("shadow evaluator returned %d results for %d principals", len(shadow), len(principals))
+		}
+		if err != nil {
+			se.failed(strings.Join(principals, ","), err)
+			return
+		}
+		for i, principal := range principals {
+			se.compare(principal, resourceID, permission, primary[i], shadow[i])
+		}
+	})
+	return results, nil
+}
+
+func (se *ShadowEvaluator) TestPermissions(
+	principal string,
+	resourceID uuid.UUID,
+	permissions []string,
+	context map[string]string,
+) ([]string, error) {
+	granted, err := se.PermissionEvaluator.TestPermissions(principal, resourceID, permissions, context)
+	if err != nil {
+		return granted, err
+	}
+
+	permissions = slices.Clone(permissions)
+	context = maps.Clone(context)
+	allowed := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		allowed[permission] = true
+	}
+	se.goShadow(func() {
+		shadowGranted, err := se.shadow.TestPermissions(principal, resourceID, permissions, context)
+		if err != nil {
+			se.failed(principal, err)
+			return
+		}
+		shadowAllowed := make(map[string]bool, len(shadowGranted))
+		for _, permission := range shadowGranted {
+			shadowAllowed[permission] = true
+		}
+		for _, permission := range permissions {
+			se.compare(principal, resourceID, permission,
+				CheckResult{Allowed: allowed[permission]},
+				CheckResult{Allowed: shadowAllowed[permission]},
+			)
+		}
+	})
+	return granted, nil
+}
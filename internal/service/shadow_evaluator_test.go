@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowEvaluator_ServesPrimaryAndCountsDivergences(t *testing.T) {
+	primary := new(MockPermissionEvaluator)
+	shadow := new(MockPermissionEvaluator)
+	evaluator := NewShadowEvaluator(primary, shadow, &config.ShadowEvaluatorConfig{SampleRate: 1, MaxInFlight: 10}, slog.Default())
+	resourceID := uuid.New()
+	context := map[string]string{"request.ip": "10.0.0.1"}
+
+	primary.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", context).Return(true, "granted", nil)
+	shadow.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", context).Return(false, "denied", nil)
+	primary.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.list", context).Return(true, "granted", nil)
+	shadow.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.list", context).Return(true, "granted", nil)
+	primary.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.delete", context).Return(false, "denied", nil)
+	shadow.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.delete", context).Return(false, "", errors.New("opa unavailable"))
+
+	for _, permission := range []string{"storage.buckets.get", "storage.buckets.list"} {
+		allowed, reason, err := evaluator.CheckPermission("user:alice@example.com", resourceID, permission, context)
+		require.NoError(t, err)
+		assert.True(t, allowed, "the primary result is served")
+		assert.Equal(t, "granted", reason)
+	}
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.delete", context)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	checks := []PermissionCheck{
+		{ResourceID: resourceID, Permission: "storage.buckets.get"},
+		{ResourceID: resourceID, Permission: "storage.buckets.list"},
+	}
+	primary.On("BatchCheckPermissions", "user:alice@example.com", checks).Return([]CheckResult{{Allowed: true}, {Allowed: false}}, nil)
+	shadow.On("BatchCheckPermissions", "user:alice@example.com", checks).Return([]CheckResult{{Allowed: true}, {Allowed: true}}, nil)
+	results, err := evaluator.BatchCheckPermissions("user:alice@example.com", checks)
+	require.NoError(t, err)
+	assert.False(t, results[1].Allowed)
+
+	permissions := []string{"storage.buckets.get", "storage.buckets.list"}
+	primary.On("TestPermissions", "user:alice@example.com", resourceID, permissions, context).Return([]string{"storage.buckets.get"}, nil)
+	shadow.On("TestPermissions", "user:alice@example.com", resourceID, permissions, context).Return([]string{"storage.buckets.get"}, nil)
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, permissions, context)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.get"}, granted)
+
+	require.NoError(t, evaluator.Stop(t.Context()))
+	assert.Equal(t, ShadowStats{Checks: 6, Divergences: 2, Errors: 1}, evaluator.Stats())
+}
+
+func TestShadowEvaluator_SamplingAndLimits(t *testing.T) {
+	primary := new(MockPermissionEvaluator)
+	shadow := new(MockPermissionEvaluator)
+	resourceID := uuid.New()
+	primary.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).Return(true, "granted", nil)
+	primary.On("CheckPermission", "user:bob@example.com", resourceID, "storage.buckets.get", map[string]string(nil)).Return(false, "", errors.New("database unavailable"))
+
+	// Unsampled checks and checks the primary evaluator fails are not shadowed
+	evaluator := NewShadowEvaluator(primary, shadow, &config.ShadowEvaluatorConfig{SampleRate: 0.5, MaxInFlight: 1}, nil)
+	evaluator.sample = func() float64 { return 0.5 }
+	_, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	_, _, err = evaluator.CheckPermission("user:bob@example.com", resourceID, "storage.buckets.get", nil)
+	assert.Error(t, err)
+	shadow.AssertNotCalled(t, "CheckPermission")
+
+	// Sampled checks are skipped while max_in_flight shadow checks are running
+	evaluator.sample = func() float64 { return 0 }
+	evaluator.slots <- struct{}{}
+	_, _, err = evaluator.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	<-evaluator.slots
+	assert.Equal(t, ShadowStats{Skipped: 1}, evaluator.Stats())
+
+	// Stop gives up on shadow checks still running when its context expires
+	release := make(chan struct{})
+	evaluator.goShadow(func() { <-release })
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	assert.ErrorIs(t, evaluator.Stop(ctx), context.Canceled)
+	close(release)
+	assert.NoError(t, evaluator.Stop(t.Context()))
+}
@@ -22,7 +22,13 @@ func TestToJSON_Helper(t *testing.T) {
 	assert.ElementsMatch(t, members, retrieved)
 
 	// Test HasMember
-	assert.True(t, binding.HasMember("user:alice@example.com"))
-	assert.True(t, binding.HasMember("user:bob@example.com"))
-	assert.False(t, binding.HasMember("user:charlie@example.com"))
+	granted, err := binding.HasMember("user:alice@example.com")
+	assert.NoError(t, err)
+	assert.True(t, granted)
+	granted, err = binding.HasMember("user:bob@example.com")
+	assert.NoError(t, err)
+	assert.True(t, granted)
+	granted, err = binding.HasMember("user:charlie@example.com")
+	assert.NoError(t, err)
+	assert.False(t, granted)
 }
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidToken is returned when an ID token fails verification
+	ErrInvalidToken = errors.New("invalid id token")
+	// ErrTokenVerificationDisabled is returned for ID tokens when no token verifier is configured
+	ErrTokenVerificationDisabled = errors.New("id token verification is not configured")
+)
+
+// TokenVerifier verifies ID tokens, e.g. oidc.Verifier
+type TokenVerifier interface {
+	// VerifyPrincipal returns the principal a token was issued to, the group principals it
+	// asserts and when it expires
+	VerifyPrincipal(token string) (principal string, groups []string, expiry time.Time, err error)
+}
+
+// contextKeyTokenGroups carries the groups asserted by a verified ID token in the context of
+// the token's checks, comma-separated. The groups apply to those checks only: the evaluator adds
+// them to the principal's identities and does not cache decisions of checks carrying them.
+// Callers cannot supply it, IAMService removes it from the contexts of other checks.
+const contextKeyTokenGroups = "token.groups"
+
+// withTokenGroups returns a copy of context carrying groups
+func withTokenGroups(context map[string]string, groups []string) map[string]string {
+	scoped := withoutReservedKeys(context)
+	if len(groups) > 0 {
+		if scoped == nil {
+			scoped = make(map[string]string, 1)
+		}
+		scoped[contextKeyTokenGroups] = strings.Join(groups, ",")
+	}
+	return scoped
+}
+
+// reservedContextKeys are the context keys the service sets on checks
+var reservedContextKeys = []string{contextKeyTokenGroups, contextKeyConsistency, contextKeyRequestID, contextKeyCallerService}
+
+// withoutReservedKeys returns context without the keys callers cannot supply, copying it only if
+// it has any of them
+func withoutReservedKeys(context map[string]string) map[string]string {
+	if !slices.ContainsFunc(reservedContextKeys, func(key string) bool { _, ok := context[key]; return ok }) {
+		return context
+	}
+	stripped := make(map[string]string, len(context))
+	for key, value := range context {
+		if !slices.Contains(reservedContextKeys, key) {
+			stripped[key] = value
+		}
+	}
+	return stripped
+}
+
+// tokenGroupsOf returns the token groups carried by a check context
+func tokenGroupsOf(context map[string]string) []string {
+	if groups := context[contextKeyTokenGroups]; groups != "" {
+		return strings.Split(groups, ",")
+	}
+	return nil
+}
+
+// SetTokenVerifier enables permission checks carrying an ID token instead of a principal.
+// It must be called before the service starts handling requests.
+func (s *IAMService) SetTokenVerifier(verifier TokenVerifier) {
+	s.tokenVerifier = verifier
+}
+
+// ResolvePrincipal verifies an ID token and returns the principal it was issued to
+func (s *IAMService) ResolvePrincipal(idToken string) (string, error) {
+	principal, _, err := s.verifyToken(idToken)
+	return principal, err
+}
+
+// verifyToken verifies an ID token and returns the principal it was issued to and the groups it asserts
+func (s *IAMService) verifyToken(idToken string) (string, []string, error) {
+	if s.tokenVerifier == nil {
+		return "", nil, ErrTokenVerificationDisabled
+	}
+	if idToken == "" {
+		return "", nil, fmt.Errorf("%w: token is empty", ErrInvalidToken)
+	}
+
+	principal, groups, _, err := s.tokenVerifier.VerifyPrincipal(idToken)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return principal, groups, nil
+}
+
+// CheckPermissionWithToken checks a permission of the principal an ID token was issued to,
+// including the groups the token asserts. The groups only apply to this check.
+func (s *IAMService) CheckPermissionWithToken(
+	idToken string,
+	resourceID uuid.UUID,
+	permission string,
+	context map[string]string,
+) (bool, string, error) {
+	principal, groups, err := s.verifyToken(idToken)
+	if err != nil {
+		return false, "", err
+	}
+	return s.evaluator.CheckPermission(principal, resourceID, permission, s.withRequestMetadata(withTokenGroups(context, groups)))
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenVerifier accepts the token "valid" for alice and rejects everything else
+type fakeTokenVerifier struct {
+	groups []string
+	expiry time.Time
+}
+
+func (f *fakeTokenVerifier) VerifyPrincipal(token string) (string, []string, time.Time, error) {
+	if token != "valid" {
+		return "", nil, time.Time{}, errors.New("invalid token signature")
+	}
+	return "user:alice@example.com", f.groups, f.expiry, nil
+}
+
+func TestIAMService_CheckPermissionWithToken(t *testing.T) {
+	service, _, _ := newMoveTestService()
+	evaluator := service.evaluator.(*MockPermissionEvaluator)
+	service.SetTokenVerifier(&fakeTokenVerifier{
+		groups: []string{"group:eng@example.com", "group:ops@example.com"},
+		expiry: time.Now().Add(time.Hour),
+	})
+
+	resourceID := uuid.New()
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get",
+		map[string]string{"ticket": "OPS-1", contextKeyTokenGroups: "group:eng@example.com,group:ops@example.com"}).
+		Return(true, "Permission granted", nil)
+
+	allowed, _, err := service.CheckPermissionWithToken("valid", resourceID, "storage.buckets.get", map[string]string{"ticket": "OPS-1"})
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, _, err = service.CheckPermissionWithToken("forged", resourceID, "storage.buckets.get", nil)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, _, err = service.CheckPermissionWithToken("", resourceID, "storage.buckets.get", nil)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	evaluator.AssertNumberOfCalls(t, "CheckPermission", 1)
+
+	// Callers cannot claim token groups in the context of other checks
+	evaluator.On("CheckPermission", "user:alice@example.com", resourceID, "storage.buckets.get", map[string]string{"ticket": "OPS-1"}).
+		Return(false, "Permission denied", nil)
+	allowed, _, err = service.CheckPermission("user:alice@example.com", resourceID, "storage.buckets.get",
+		map[string]string{"ticket": "OPS-1", contextKeyTokenGroups: "group:eng@example.com"})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// Test: Token groups grant only the checks of the token and are not cached for the principal
+func TestTokenGroups_ScopedToCheck(t *testing.T) {
+	resourceRepo := new(MockResourceRepository)
+	policyRepo := new(MockPolicyRepository)
+	cache := NewCacheService(&config.CacheConfig{Enabled: true, TTLSeconds: 60, MaxSize: 100, CleanupMinutes: 1})
+	evaluator := NewPermissionEvaluator(resourceRepo, policyRepo, new(MockPermissionRepository), cache)
+
+	resourceID := uuid.New()
+	viewer := testRole("roles/viewer", "docs.read")
+	resourceRepo.On("GetByID", resourceID).Return(&domain.Resource{ID: resourceID, Type: "doc"}, nil)
+	resourceRepo.On("GetAncestors", resourceID).Return([]domain.Resource{}, nil)
+	policyRepo.On("GetByResourceID", resourceID).Return(&domain.Policy{ResourceID: resourceID, Bindings: []domain.Binding{
+		testBinding(&viewer, "group:eng@example.com"),
+	}}, nil)
+
+	tokenContext := withTokenGroups(nil, []string{"group:eng@example.com"})
+	allowed, _, err := evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", tokenContext)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	granted, err := evaluator.TestPermissions("user:alice@example.com", resourceID, []string{"docs.read"}, tokenContext)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs.read"}, granted)
+
+	_, found := cache.Get(GenerateCacheKey("user:alice@example.com", resourceID.String(), "docs.read"))
+	assert.False(t, found)
+	allowed, _, err = evaluator.CheckPermission("user:alice@example.com", resourceID, "docs.read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestIAMService_ResolvePrincipal_Disabled(t *testing.T) {
+	service, _, _ := newMoveTestService()
+
+	_, err := service.ResolvePrincipal("valid")
+	assert.ErrorIs(t, err, ErrTokenVerificationDisabled)
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+)
+
+// Relation tuple encodings
+const (
+	TupleFormatZanzibar = "zanzibar" // object#relation@subject, the notation of the Zanzibar paper
+	TupleFormatSpiceDB  = "spicedb"  // zed relationship syntax, with IDs escaped to SpiceDB's character set
+	TupleFormatOpenFGA  = "openfga"  // one OpenFGA tuple key JSON object per line
+)
+
+// Relations and caveat shared by every export
+const (
+	TupleRelationParent = "parent"        // resource#parent@<parent type>:<parent id>
+	TupleRelationMember = "member"        // group#member and domain#member usersets
+	TupleCaveatName     = "iam_condition" // caveat (SpiceDB) or condition (OpenFGA) of conditional bindings
+)
+
+// tupleExportPageSize is the number of resources loaded per query of an export
+const tupleExportPageSize = 100
+
+// RelationTuple is a Zanzibar relation tuple: the subject, or the subject's members when
+// SubjectRelation is set, has Relation to the object
+type RelationTuple struct {
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+	Condition       string // Expression of the binding condition, empty if unconditional
+}
+
+// ResourceTuples are all tuples of one resource: its parent and the bindings of its policy.
+// They replace the tuples previously exported for the resource; a deleted resource has none.
+type ResourceTuples struct {
+	ObjectType string
+	ObjectID   string
+	Deleted    bool
+	Tuples     []RelationTuple
+	Cursor     string // Resumes an export after this resource
+}
+
+// ExportRelationTuples converts resources and their policies into relation tuples, calling emit
+// once per resource in change order. An empty cursor exports everything; the cursor of the last
+// emitted resource, which is also returned, exports only what changed since. Resources that
+// changed while the export ran may be emitted again by the next one.
+func (s *IAMService) ExportRelationTuples(cursor string, emit func(*ResourceTuples) error) (string, error) {
+	if err := s.authorize("ExportRelationTuples", nil); err != nil {
+		return "", err
+	}
+
+	since, after, err := decodeTupleCursor(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		changes, err := s.resourceRepo.ListChanges(since, after, tupleExportPageSize)
+		if err != nil {
+			return "", err
+		}
+		for i := range changes {
+			since, after = changes[i].ChangedAt, changes[i].Resource.ID
+			cursor = encodeTupleCursor(since, after)
+
+			tuples, err := resourceTuples(&changes[i])
+			if err != nil {
+				return "", err
+			}
+			tuples.Cursor = cursor
+			if err := emit(tuples); err != nil {
+				return "", err
+			}
+		}
+		if len(changes) < tupleExportPageSize {
+			return cursor, nil
+		}
+	}
+}
+
+// resourceTuples converts a changed resource into its tuples
+func resourceTuples(change *repository.ResourceChange) (*ResourceTuples, error) {
+	resource := &change.Resource
+	tuples := &ResourceTuples{
+		ObjectType: tupleType(resource.Type),
+		ObjectID:   resource.ID.String(),
+		Deleted:    resource.DeletedAt.Valid,
+		Tuples:     []RelationTuple{},
+	}
+	if tuples.Deleted {
+		return tuples, nil
+	}
+
+	if resource.ParentID != nil && resource.Parent != nil {
+		tuples.Tuples = append(tuples.Tuples, RelationTuple{
+			ObjectType:  tuples.ObjectType,
+			ObjectID:    tuples.ObjectID,
+			Relation:    TupleRelationParent,
+			SubjectType: tupleType(resource.Parent.Type),
+			SubjectID:   resource.ParentID.String(),
+		})
+	}
+
+	if change.Policy == nil {
+		return tuples, nil
+	}
+	for _, binding := range change.Policy.Bindings {
+		if binding.Role == nil {
+			continue
+		}
+		members, err := binding.GetMembers()
+		if err != nil {
+			return nil, fmt.Errorf("invalid members in binding %s: %w", binding.ID, err)
+		}
+		for _, member := range members {
+			for _, tuple := range memberTuples(member) {
+				tuple.ObjectType = tuples.ObjectType
+				tuple.ObjectID = tuples.ObjectID
+				tuple.Relation = RoleRelation(binding.Role.Name)
+				if binding.Condition != nil {
+					tuple.Condition = binding.Condition.Expression
+				}
+				tuples.Tuples = append(tuples.Tuples, tuple)
+			}
+		}
+	}
+	return tuples, nil
+}
+
+// memberTuples maps a binding member to the subjects of its tuples; unknown member types are
+// skipped. allUsers and allAuthenticatedUsers grant to every principal checked, so they map to
+// the user and service account wildcards.
+func memberTuples(member string) []RelationTuple {
+	if domain.IsPublicMember(member) {
+		return []RelationTuple{
+			{SubjectType: "user", SubjectID: "*"},
+			{SubjectType: "service_account", SubjectID: "*"},
+		}
+	}
+
+	kind, id, ok := strings.Cut(member, ":")
+	if !ok || id == "" {
+		return nil
+	}
+	switch kind {
+	case domain.PrincipalTypeUser:
+		return []RelationTuple{{SubjectType: "user", SubjectID: id}}
+	case domain.PrincipalTypeServiceAccount:
+		return []RelationTuple{{SubjectType: "service_account", SubjectID: id}}
+	case domain.PrincipalTypeGroup:
+		return []RelationTuple{{SubjectType: "group", SubjectID: id, SubjectRelation: TupleRelationMember}}
+	case domain.PrincipalTypeDomain:
+		return []RelationTuple{{SubjectType: "domain", SubjectID: strings.ToLower(id), SubjectRelation: TupleRelationMember}}
+	}
+	return nil
+}
+
+// RoleRelation returns the relation of a role, e.g. "storage_object_viewer" for
+// "roles/storage.objectViewer"
+func RoleRelation(role string) string {
+	return tupleType(strings.TrimPrefix(role, "roles/"))
+}
+
+// tupleType converts a name into an identifier valid as a SpiceDB and OpenFGA type or relation:
+// snake case, with characters other than letters and digits replaced by underscores
+func tupleType(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if i > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r - 'A' + 'a')
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		}
+	}
+	name = strings.TrimSuffix(b.String(), "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "t_" + name
+	}
+	return name
+}
+
+// encodeTupleCursor encodes the position after a change
+func encodeTupleCursor(changedAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(changedAt.UTC().Format(time.RFC3339Nano) + "/" + id.String()))
+}
+
+// decodeTupleCursor decodes a cursor; the empty cursor is the position before any change
+func decodeTupleCursor(cursor string) (time.Time, uuid.UUID, error) {
+	if cursor == "" {
+		return time.Time{}, uuid.Nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor")
+	}
+	at, id, ok := strings.Cut(string(data), "/")
+	if !ok {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor")
+	}
+	changedAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor")
+	}
+	after, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor")
+	}
+	return changedAt, after, nil
+}
+
+// TupleEncoder writes relation tuples in one of the TupleFormat encodings, one tuple per line
+type TupleEncoder struct {
+	w      io.Writer
+	format string
+}
+
+// NewTupleEncoder creates an encoder writing tuples in format to w
+func NewTupleEncoder(w io.Writer, format string) (*TupleEncoder, error) {
+	switch format {
+	case TupleFormatZanzibar, TupleFormatSpiceDB, TupleFormatOpenFGA:
+		return &TupleEncoder{w: w, format: format}, nil
+	}
+	return nil, fmt.Errorf("unknown tuple format %q", format)
+}
+
+// Encode writes a tuple
+func (e *TupleEncoder) Encode(tuple *RelationTuple) error {
+	var line string
+	switch e.format {
+	case TupleFormatOpenFGA:
+		data, err := json.Marshal(openFGATuple(tuple))
+		if err != nil {
+			return fmt.Errorf("failed to encode tuple: %w", err)
+		}
+		line = string(data)
+	case TupleFormatSpiceDB:
+		line = zanzibarTuple(tuple, escapeSpiceDBID)
+	default:
+		line = zanzibarTuple(tuple, func(id string) string { return id })
+	}
+
+	_, err := io.WriteString(e.w, line+"\n")
+	return err
+}
+
+// zanzibarTuple formats type:id#relation@type:id[#relation], followed by the binding condition
+// as a caveat with its expression as context
+func zanzibarTuple(tuple *RelationTuple, escape func(string) string) string {
+	var b strings.Builder
+	b.WriteString(tuple.ObjectType + ":" + escape(tuple.ObjectID) + "#" + tuple.Relation)
+	subjectID := tuple.SubjectID
+	if subjectID != "*" {
+		subjectID = escape(subjectID)
+	}
+	b.WriteString("@" + tuple.SubjectType + ":" + subjectID)
+	if tuple.SubjectRelation != "" {
+		b.WriteString("#" + tuple.SubjectRelation)
+	}
+	if tuple.Condition != "" {
+		context, _ := json.Marshal(map[string]string{"expression": tuple.Condition})
+		b.WriteString("[" + TupleCaveatName + ":" + string(context) + "]")
+	}
+	return b.String()
+}
+
+// escapeSpiceDBID replaces the characters SpiceDB does not allow in object IDs, e.g. the "@" of
+// emails, and "=" itself by =XX hex escapes, so escaped IDs stay unique
+func escapeSpiceDBID(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '/', c == '_', c == '|', c == '-', c == '+':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// openFGATupleKey is an OpenFGA TupleKey as accepted by the Write API and the CLI
+type openFGATupleKey struct {
+	User      string            `json:"user"`
+	Relation  string            `json:"relation"`
+	Object    string            `json:"object"`
+	Condition *openFGACondition `json:"condition,omitempty"`
+}
+
+type openFGACondition struct {
+	Name    string            `json:"name"`
+	Context map[string]string `json:"context"`
+}
+
+func openFGATuple(tuple *RelationTuple) openFGATupleKey {
+	key := openFGATupleKey{
+		User:     tuple.SubjectType + ":" + tuple.SubjectID,
+		Relation: tuple.Relation,
+		Object:   tuple.ObjectType + ":" + tuple.ObjectID,
+	}
+	if tuple.SubjectRelation != "" {
+		key.User += "#" + tuple.SubjectRelation
+	}
+	if tuple.Condition != "" {
+		key.Condition = &openFGACondition{
+			Name:    TupleCaveatName,
+			Context: map[string]string{"expression": tuple.Condition},
+		}
+	}
+	return key
+}
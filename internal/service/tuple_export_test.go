@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/domain"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestIAMService_ExportRelationTuples(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	org := domain.Resource{ID: uuid.New(), Type: "organization"}
+	bucket := domain.Resource{ID: uuid.New(), Type: "storageBucket", ParentID: &org.ID, Parent: &org}
+	deleted := domain.Resource{ID: uuid.New(), Type: "project", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}}
+
+	viewer := testRole("roles/storage.objectViewer", "storage.objects.get")
+	conditional := testBinding(&viewer, "user:bob@example.com")
+	conditional.Condition = &domain.Condition{Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`}
+	policy := &domain.Policy{ResourceID: bucket.ID, Bindings: []domain.Binding{
+		testBinding(&viewer, "user:alice@example.com", "group:eng@example.com", "domain:Example.com",
+			"serviceAccount:ci@example.iam", "allUsers"),
+		conditional,
+	}}
+
+	changedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	resourceRepo.On("ListChanges", time.Time{}, uuid.Nil, tupleExportPageSize).Return([]repository.ResourceChange{
+		{Resource: org, ChangedAt: changedAt},
+		{Resource: bucket, Policy: policy, ChangedAt: changedAt},
+		{Resource: deleted, ChangedAt: changedAt.Add(time.Second)},
+	}, nil)
+
+	var exported []*ResourceTuples
+	cursor, err := service.ExportRelationTuples("", func(tuples *ResourceTuples) error {
+		exported = append(exported, tuples)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 3)
+	assert.Equal(t, exported[2].Cursor, cursor)
+
+	assert.Equal(t, "organization", exported[0].ObjectType)
+	assert.Empty(t, exported[0].Tuples)
+
+	object := bucket.ID.String()
+	relation := "storage_object_viewer"
+	assert.Equal(t, "storage_bucket", exported[1].ObjectType)
+	assert.Equal(t, []RelationTuple{
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: TupleRelationParent, SubjectType: "organization", SubjectID: org.ID.String()},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "user", SubjectID: "alice@example.com"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "group", SubjectID: "eng@example.com", SubjectRelation: "member"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "domain", SubjectID: "example.com", SubjectRelation: "member"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "service_account", SubjectID: "ci@example.iam"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "user", SubjectID: "*"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "service_account", SubjectID: "*"},
+		{ObjectType: "storage_bucket", ObjectID: object, Relation: relation, SubjectType: "user", SubjectID: "bob@example.com", Condition: conditional.Condition.Expression},
+	}, exported[1].Tuples)
+
+	assert.True(t, exported[2].Deleted)
+	assert.Empty(t, exported[2].Tuples)
+
+	// The cursor resumes after the last resource
+	since, after, err := decodeTupleCursor(cursor)
+	require.NoError(t, err)
+	assert.True(t, since.Equal(changedAt.Add(time.Second)))
+	assert.Equal(t, deleted.ID, after)
+	resourceRepo.On("ListChanges", mock.Anything, deleted.ID, tupleExportPageSize).Return([]repository.ResourceChange{}, nil)
+
+	next, err := service.ExportRelationTuples(cursor, func(*ResourceTuples) error {
+		t.Fatal("nothing changed")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cursor, next)
+}
+
+func TestIAMService_ExportRelationTuples_Errors(t *testing.T) {
+	service, resourceRepo, _ := newMoveTestService()
+
+	_, err := service.ExportRelationTuples("not a cursor", func(*ResourceTuples) error { return nil })
+	assert.EqualError(t, err, "invalid cursor")
+
+	resourceRepo.On("ListChanges", time.Time{}, uuid.Nil, tupleExportPageSize).Return([]repository.ResourceChange{
+		{Resource: domain.Resource{ID: uuid.New(), Type: "project"}},
+	}, nil)
+	stop := errors.New("stop")
+	_, err = service.ExportRelationTuples("", func(*ResourceTuples) error { return stop })
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestTupleType(t *testing.T) {
+	assert.Equal(t, "project", tupleType("project"))
+	assert.Equal(t, "storage_bucket", tupleType("storageBucket"))
+	assert.Equal(t, "compute_instance", tupleType("compute.instance"))
+	assert.Equal(t, "t_3d", tupleType("3d"))
+	assert.Equal(t, "storage_object_viewer", RoleRelation("roles/storage.objectViewer"))
+	assert.Equal(t, "owner", RoleRelation("roles/owner"))
+}
+
+func TestTupleEncoder(t *testing.T) {
+	tuples := []RelationTuple{
+		{ObjectType: "project", ObjectID: "p1", Relation: "viewer", SubjectType: "user", SubjectID: "alice@example.com"},
+		{ObjectType: "project", ObjectID: "p1", Relation: "viewer", SubjectType: "group", SubjectID: "eng", SubjectRelation: "member"},
+		{ObjectType: "project", ObjectID: "p1", Relation: "viewer", SubjectType: "user", SubjectID: "*", Condition: `resource.type == "project"`},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{TupleFormatZanzibar, "project:p1#viewer@user:alice@example.com\n" +
+			"project:p1#viewer@group:eng#member\n" +
+			`project:p1#viewer@user:*[iam_condition:{"expression":"resource.type == \"project\""}]` + "\n"},
+		{TupleFormatSpiceDB, "project:p1#viewer@user:alice=40example=2Ecom\n" +
+			"project:p1#viewer@group:eng#member\n" +
+			`project:p1#viewer@user:*[iam_condition:{"expression":"resource.type == \"project\""}]` + "\n"},
+		{TupleFormatOpenFGA, `{"user":"user:alice@example.com","relation":"viewer","object":"project:p1"}` + "\n" +
+			`{"user":"group:eng#member","relation":"viewer","object":"project:p1"}` + "\n" +
+			`{"user":"user:*","relation":"viewer","object":"project:p1","condition":{"name":"iam_condition","context":{"expression":"resource.type == \"project\""}}}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewTupleEncoder(&buf, tt.format)
+			require.NoError(t, err)
+			for i := range tuples {
+				require.NoError(t, encoder.Encode(&tuples[i]))
+			}
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+
+	_, err := NewTupleEncoder(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
+
+func TestEscapeSpiceDBID(t *testing.T) {
+	assert.Equal(t, "a-b_c/d|e+f", escapeSpiceDBID("a-b_c/d|e+f"))
+	assert.Equal(t, "a=3Db", escapeSpiceDBID("a=b"))
+	assert.Equal(t, "bob=40example=2Ecom", escapeSpiceDBID("bob@example.com"))
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrInvalidUpdateMask is returned when an update mask names a field the method cannot update
+var ErrInvalidUpdateMask = errors.New("invalid update mask")
+
+// Fields of the update masks of UpdateResource and UpdateRole
+const (
+	ResourceFieldName       = "name"
+	ResourceFieldAttributes = "attributes"
+
+	RoleFieldTitle         = "title"
+	RoleFieldDescription   = "description"
+	RoleFieldPermissionIDs = "permission_ids"
+)
+
+// updateMaskAll stands for every field in an update mask
+const updateMaskAll = "*"
+
+// updateMask lists the fields an update changes
+type updateMask map[string]bool
+
+// parseUpdateMask resolves the update mask of a method updating fields. An empty mask, or "*",
+// selects every field, so callers that send all of them keep working.
+func parseUpdateMask(mask []string, fields ...string) (updateMask, error) {
+	if len(mask) == 0 || (len(mask) == 1 && mask[0] == updateMaskAll) {
+		mask = fields
+	}
+
+	selected := make(updateMask, len(mask))
+	for _, field := range mask {
+		if !slices.Contains(fields, field) {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidUpdateMask, field)
+		}
+		selected[field] = true
+	}
+	return selected, nil
+}
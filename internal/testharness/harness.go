@@ -0,0 +1,124 @@
+// Package testharness builds the IAM service on a freshly migrated database for integration
+// tests, so they need no pre-provisioned iam_db:
+//
+//	h := testharness.New(t)
+//	resource, err := h.Service.CreateResource(...)
+//
+// The servers come from testenv: TEST_DB_HOST, containers started with testcontainers-go
+// (go test -tags testcontainers), or localhost. TEST_DB_DRIVER=sqlite uses an embedded SQLite
+// database instead (needs -tags sqlite).
+package testharness
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/pguia/iam/internal/database"
+	"github.com/pguia/iam/internal/repository"
+	"github.com/pguia/iam/internal/service"
+	"github.com/pguia/iam/internal/testharness/testenv"
+	"github.com/stretchr/testify/require"
+)
+
+// Harness is an IAM service on a migrated database in a schema of its own
+type Harness struct {
+	DB *database.Database
+
+	Resources   repository.ResourceRepository
+	Permissions repository.PermissionRepository
+	Roles       repository.RoleRepository
+	Policies    repository.PolicyRepository
+	Bindings    repository.BindingRepository
+	Revisions   repository.PolicyRevisionRepository
+	Conditions  repository.ConditionRepository
+
+	Cache     service.CacheService
+	Evaluator service.PermissionEvaluator
+	Service   *service.IAMService
+}
+
+// Option configures a Harness
+type Option func(*options)
+
+type options struct {
+	redis bool
+}
+
+// WithRedis caches permission checks in the shared Redis server (see testenv.Redis), which is
+// cleared first
+func WithRedis() Option {
+	return func(o *options) {
+		o.redis = true
+	}
+}
+
+// databaseConfig returns the settings of a new schema of the shared Postgres server or, with
+// TEST_DB_DRIVER=sqlite, of an SQLite database in a temporary directory
+func databaseConfig(t testing.TB) *config.DatabaseConfig {
+	if os.Getenv("TEST_DB_DRIVER") == "sqlite" {
+		return &config.DatabaseConfig{
+			Driver:     database.DriverSQLite,
+			SQLitePath: filepath.Join(t.TempDir(), "iam.db"),
+		}
+	}
+	return testenv.Postgres(t)
+}
+
+// New migrates a new schema of the shared Postgres server and builds the repositories and
+// IAM service on it. Everything is torn down when the test finishes.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	db, err := database.New(databaseConfig(t), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	require.NoError(t, db.Migrate())
+
+	cache := service.NewNoopCache()
+	if o.redis {
+		redisCache, err := service.NewRedisCache(testenv.Redis(t))
+		require.NoError(t, err)
+		redisCache.Clear()
+		t.Cleanup(func() {
+			if closer, ok := redisCache.(io.Closer); ok {
+				closer.Close()
+			}
+		})
+		cache = redisCache
+	}
+
+	h := &Harness{
+		DB:          db,
+		Resources:   repository.NewResourceRepository(db.DB),
+		Permissions: repository.NewPermissionRepository(db.DB),
+		Roles:       repository.NewRoleRepository(db.DB),
+		Policies:    repository.NewPolicyRepository(db.DB),
+		Bindings:    repository.NewBindingRepository(db.DB),
+		Revisions:   repository.NewPolicyRevisionRepository(db.DB),
+		Conditions:  repository.NewConditionRepository(db.DB),
+		Cache:       cache,
+	}
+	h.Evaluator = service.NewPermissionEvaluator(h.Resources, h.Policies, h.Permissions, cache)
+	h.Service = service.NewIAMService(
+		h.Resources,
+		h.Permissions,
+		h.Roles,
+		h.Policies,
+		h.Bindings,
+		h.Revisions,
+		h.Conditions,
+		h.Evaluator,
+		cache,
+	)
+	return h
+}
@@ -0,0 +1,56 @@
+package testharness_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/testharness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarness_CheckPermission(t *testing.T) {
+	h := testharness.New(t)
+
+	org, err := h.Service.CreateResource("organization", "acme", nil, nil, nil, "")
+	require.NoError(t, err)
+	project, err := h.Service.CreateResource("project", "web", &org.ID, nil, nil, "")
+	require.NoError(t, err)
+
+	permission, err := h.Service.CreatePermission("storage.buckets.get", "Read buckets", "storage")
+	require.NoError(t, err)
+	role, err := h.Service.CreateRole("roles/storage.viewer", "Storage Viewer", "", []uuid.UUID{permission.ID}, nil)
+	require.NoError(t, err)
+
+	_, err = h.Service.CreateBinding(org.ID, role.ID, []string{"user:alice@example.com"}, nil)
+	require.NoError(t, err)
+
+	allowed, _, err := h.Service.CheckPermission("user:alice@example.com", project.ID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed, "inherited from the organization")
+
+	allowed, _, err = h.Service.CheckPermission("user:bob@example.com", project.ID, "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestHarness_IsolatedSchemas(t *testing.T) {
+	first := testharness.New(t)
+	second := testharness.New(t)
+
+	_, err := first.Service.CreateResource("organization", "acme", nil, nil, nil, "")
+	require.NoError(t, err)
+
+	resources, err := second.Resources.List(nil, "", nil, nil, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+}
+
+func TestHarness_WithRedis(t *testing.T) {
+	h := testharness.New(t, testharness.WithRedis())
+
+	h.Cache.Set("perm:test", true)
+	value, ok := h.Cache.Get("perm:test")
+	require.True(t, ok)
+	assert.Equal(t, true, value)
+}
@@ -0,0 +1,77 @@
+//go:build testcontainers
+
+package testenv
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// containersAvailable reports whether servers can be started with testcontainers-go
+const containersAvailable = true
+
+// Container images, matching docker-compose.yml
+const (
+	postgresImage = "postgres:18"
+	redisImage    = "valkey/valkey:9.0.0-alpine3.22"
+)
+
+// startTimeout bounds pulling an image and waiting for its server to accept connections
+const startTimeout = 2 * time.Minute
+
+// startPostgres starts a Postgres container; it is removed by the testcontainers reaper
+// when the test binary exits
+func startPostgres() (*config.DatabaseConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	container, err := tcpostgres.Run(ctx, postgresImage,
+		tcpostgres.WithDatabase("iam_db"),
+		tcpostgres.WithUsername("postgres"),
+		tcpostgres.WithPassword("postgres"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start postgres container: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres container host: %w", err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres container port: %w", err)
+	}
+
+	return &config.DatabaseConfig{
+		Host:     host,
+		Port:     port.Int(),
+		User:     "postgres",
+		Password: "postgres",
+		DBName:   "iam_db",
+		SSLMode:  "disable",
+	}, nil
+}
+
+// startRedis starts a Valkey container; it is removed by the testcontainers reaper when the
+// test binary exits
+func startRedis() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	container, err := tcredis.Run(ctx, redisImage)
+	if err != nil {
+		return "", fmt.Errorf("failed to start redis container: %w", err)
+	}
+	address, err := container.Endpoint(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get redis container address: %w", err)
+	}
+	return address, nil
+}
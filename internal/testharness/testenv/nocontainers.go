@@ -0,0 +1,22 @@
+//go:build !testcontainers
+
+package testenv
+
+import (
+	"errors"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// containersAvailable reports whether servers can be started with testcontainers-go
+const containersAvailable = false
+
+var errNoContainers = errors.New("testcontainers support is not compiled in; build with -tags testcontainers")
+
+func startPostgres() (*config.DatabaseConfig, error) {
+	return nil, errNoContainers
+}
+
+func startRedis() (string, error) {
+	return "", errNoContainers
+}
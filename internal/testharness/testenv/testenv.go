@@ -0,0 +1,154 @@
+// Package testenv provides the Postgres and Redis servers of integration tests.
+//
+// Servers are found in this order:
+//   - TEST_DB_HOST / TEST_REDIS_ADDR, e.g. the service containers of CI
+//   - containers started with testcontainers-go, when built with the testcontainers tag
+//   - localhost:5432 and localhost:6379; tests are skipped when nothing listens there
+//
+// Containers are started once per test binary and shared by its tests, which are isolated
+// by a Postgres schema each; they are removed when the test binary exits.
+//
+// The package only depends on config, so the internal tests of domain and repository can use it.
+package testenv
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var (
+	postgresOnce   sync.Once
+	postgresServer *config.DatabaseConfig
+	postgresErr    error
+	postgresAbsent bool
+
+	redisOnce    sync.Once
+	redisAddress string
+	redisErr     error
+	redisAbsent  bool
+)
+
+// dialTimeout bounds probing the localhost fallback servers
+const dialTimeout = time.Second
+
+// PostgresServer returns the connection settings of the shared Postgres server, starting it if needed
+func PostgresServer(t testing.TB) config.DatabaseConfig {
+	t.Helper()
+	postgresOnce.Do(func() {
+		host := os.Getenv("TEST_DB_HOST")
+		if host == "" && containersAvailable {
+			postgresServer, postgresErr = startPostgres()
+			return
+		}
+		if host == "" {
+			host = "localhost"
+			postgresAbsent = !listening("localhost:5432")
+		}
+		postgresServer = &config.DatabaseConfig{
+			Host:     host,
+			Port:     5432,
+			User:     "postgres",
+			Password: "postgres",
+			DBName:   "iam_db",
+			SSLMode:  "disable",
+		}
+	})
+	require.NoError(t, postgresErr, "failed to start postgres")
+	if postgresAbsent {
+		t.Skip("no postgres server: set TEST_DB_HOST, build with -tags testcontainers, or start one on localhost:5432")
+	}
+	return *postgresServer
+}
+
+// Postgres returns the settings of a database in a new, empty schema of the shared server.
+// The schema is dropped when the test finishes.
+func Postgres(t testing.TB) *config.DatabaseConfig {
+	t.Helper()
+	server := PostgresServer(t)
+
+	admin, err := gorm.Open(postgres.Open(dsn(&server)), &gorm.Config{})
+	require.NoError(t, err)
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+	require.NoError(t, admin.Exec("CREATE SCHEMA "+schema).Error)
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	cfg := server
+	cfg.SearchPath = schema + ",public" // Extensions such as pgcrypto live in public
+	cfg.MaxConns = 10
+	cfg.MaxIdle = 2
+	return &cfg
+}
+
+// OpenPostgres connects to a new, empty schema of the shared server (see Postgres)
+func OpenPostgres(t testing.TB) *gorm.DB {
+	t.Helper()
+	cfg := Postgres(t)
+
+	db, err := gorm.Open(postgres.Open(dsn(cfg)), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// Redis returns the settings of the shared Redis server, starting it if needed.
+// Tests using it must not run in parallel: the database is flushed by whoever needs it empty.
+func Redis(t testing.TB) *config.RedisCacheConfig {
+	t.Helper()
+	redisOnce.Do(func() {
+		redisAddress = os.Getenv("TEST_REDIS_ADDR")
+		if redisAddress == "" && containersAvailable {
+			redisAddress, redisErr = startRedis()
+			return
+		}
+		if redisAddress == "" {
+			redisAddress = "localhost:6379"
+			redisAbsent = !listening(redisAddress)
+		}
+	})
+	require.NoError(t, redisErr, "failed to start redis")
+	if redisAbsent {
+		t.Skip("no redis server: set TEST_REDIS_ADDR, build with -tags testcontainers, or start one on localhost:6379")
+	}
+	return &config.RedisCacheConfig{Address: redisAddress, TTLSeconds: 300}
+}
+
+// listening reports whether a server accepts connections at address
+func listening(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// dsn returns the connection string of cfg
+func dsn(cfg *config.DatabaseConfig) string {
+	s := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
+	if cfg.SearchPath != "" {
+		s += " search_path=" + cfg.SearchPath
+	}
+	return s
+}
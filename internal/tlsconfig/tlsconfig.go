@@ -0,0 +1,194 @@
+// Package tlsconfig builds crypto/tls configurations from config.TLSConfig for the gRPC server
+// and the clients of backing services such as Redis.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+)
+
+// reloadInterval is how often the certificate files are checked for changes, so rotated
+// certificates (e.g. by cert-manager) are picked up without a restart
+const reloadInterval = 10 * time.Second
+
+// clientAuthModes maps config.TLSConfig.ClientAuth to the TLS client authentication policy
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// Server returns the TLS configuration of a server presenting cfg's certificate. With a CA file,
+// clients must present a certificate signed by it (mutual TLS) unless client_auth says otherwise.
+func Server(cfg *config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("tls cert_file and key_file are required")
+	}
+	minVersion, err := parseMinVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := newKeyPairReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return keyPair.certificate() },
+	}
+
+	mode := cfg.ClientAuth
+	if mode == "" {
+		mode = "none"
+		if cfg.CAFile != "" {
+			mode = "require_and_verify"
+		}
+	}
+	clientAuth, ok := clientAuthModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid tls client_auth %q (valid: none, request, require, verify_if_given, require_and_verify)", cfg.ClientAuth)
+	}
+	tlsConfig.ClientAuth = clientAuth
+
+	if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		if cfg.CAFile == "" {
+			return nil, fmt.Errorf("tls ca_file is required to verify client certificates")
+		}
+		pool, err := loadCAs(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Client returns the TLS configuration of a client verifying the server against cfg's CA file,
+// or the system roots without one, and presenting cfg's certificate when set
+func Client(cfg *config.TLSConfig) (*tls.Config, error) {
+	minVersion, err := parseMinVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := loadCAs(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case cfg.CertFile != "" && cfg.KeyFile != "":
+		keyPair, err := newKeyPairReloader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return keyPair.certificate()
+		}
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	return tlsConfig, nil
+}
+
+func parseMinVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid tls min_version %q (valid: 1.2, 1.3)", version)
+}
+
+func loadCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("tls ca_file %s contains no certificates", path)
+	}
+	return pool, nil
+}
+
+// keyPairReloader serves a certificate and reloads it when its files change. A failed reload
+// keeps serving the previous certificate, e.g. while the files are being replaced.
+type keyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newKeyPairReloader(certFile, keyFile string) (*keyPairReloader, error) {
+	r := &keyPairReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *keyPairReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= reloadInterval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.latestModTime(); err == nil && !modTime.Equal(r.modTime) {
+			r.load()
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the key pair; callers other than the constructor must hold r.mu
+func (r *keyPairReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return fmt.Errorf("failed to read tls certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *keyPairReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
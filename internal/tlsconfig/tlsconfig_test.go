@@ -0,0 +1,211 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pguia/iam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI is a CA with a server and a client certificate written to a temporary directory
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	CAFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	p := &testPKI{dir: t.TempDir(), ca: ca, caKey: key}
+	p.CAFile = p.write(t, "ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) write(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(p.dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// issue writes a certificate signed by the CA and returns its certificate and key files
+func (p *testPKI) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return p.write(t, name+".pem", "CERTIFICATE", der), p.write(t, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// handshake connects client to a server using serverConfig and returns the handshake error
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+		_, err = conn.Write([]byte{1})
+		serverErr <- err
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err == nil {
+		// TLS 1.3 reports a rejected client certificate on the first read
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if sErr := <-serverErr; sErr != nil {
+		return sErr
+	}
+	return err
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, serverKey := pki.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := pki.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	serverConfig, err := Server(&config.TLSConfig{CertFile: serverCert, KeyFile: serverKey, CAFile: pki.CAFile})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, serverConfig.ClientAuth)
+
+	clientConfig, err := Client(&config.TLSConfig{CAFile: pki.CAFile, CertFile: clientCert, KeyFile: clientKey, ServerName: "localhost"})
+	require.NoError(t, err)
+	assert.NoError(t, handshake(t, serverConfig, clientConfig))
+
+	// Clients without a certificate are rejected
+	anonymous, err := Client(&config.TLSConfig{CAFile: pki.CAFile, ServerName: "localhost"})
+	require.NoError(t, err)
+	assert.Error(t, handshake(t, serverConfig, anonymous))
+}
+
+func TestServer_ServerOnlyTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, serverKey := pki.issue(t, "server", x509.ExtKeyUsageServerAuth)
+
+	serverConfig, err := Server(&config.TLSConfig{CertFile: serverCert, KeyFile: serverKey})
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, serverConfig.ClientAuth)
+
+	clientConfig, err := Client(&config.TLSConfig{CAFile: pki.CAFile, ServerName: "localhost"})
+	require.NoError(t, err)
+	assert.NoError(t, handshake(t, serverConfig, clientConfig))
+
+	// The server certificate is verified against the configured CA
+	untrusted, err := Client(&config.TLSConfig{CAFile: newTestPKI(t).CAFile, ServerName: "localhost"})
+	require.NoError(t, err)
+	assert.Error(t, handshake(t, serverConfig, untrusted))
+}
+
+func TestServer_Validation(t *testing.T) {
+	pki := newTestPKI(t)
+	cert, key := pki.issue(t, "server", x509.ExtKeyUsageServerAuth)
+
+	tests := []struct {
+		name   string
+		cfg    config.TLSConfig
+		errMsg string
+	}{
+		{"missing certificate", config.TLSConfig{KeyFile: key}, "cert_file and key_file are required"},
+		{"missing files", config.TLSConfig{CertFile: "/nonexistent.pem", KeyFile: key}, "failed to read tls certificate"},
+		{"invalid client auth", config.TLSConfig{CertFile: cert, KeyFile: key, ClientAuth: "always"}, "invalid tls client_auth"},
+		{"verification without ca", config.TLSConfig{CertFile: cert, KeyFile: key, ClientAuth: "require_and_verify"}, "ca_file is required"},
+		{"invalid min version", config.TLSConfig{CertFile: cert, KeyFile: key, MinVersion: "1.0"}, "invalid tls min_version"},
+		{"ca without certificates", config.TLSConfig{CertFile: cert, KeyFile: key, CAFile: key}, "contains no certificates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Server(&tt.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+
+	_, err := Client(&config.TLSConfig{CertFile: cert})
+	assert.EqualError(t, err, "tls cert_file and key_file must be set together")
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	pki := newTestPKI(t)
+	certFile, keyFile := pki.issue(t, "server", x509.ExtKeyUsageServerAuth)
+
+	reloader, err := newKeyPairReloader(certFile, keyFile)
+	require.NoError(t, err)
+	first, err := reloader.certificate()
+	require.NoError(t, err)
+
+	// Replace the files with a new certificate
+	rotatedCert, rotatedKey := pki.issue(t, "rotated", x509.ExtKeyUsageServerAuth)
+	require.NoError(t, os.Rename(rotatedCert, certFile))
+	require.NoError(t, os.Rename(rotatedKey, keyFile))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+
+	// Changes are picked up after the reload interval
+	same, _ := reloader.certificate()
+	assert.Same(t, first, same)
+
+	reloader.checkedAt = time.Now().Add(-reloadInterval)
+	rotated, err := reloader.certificate()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Certificate[0], rotated.Certificate[0])
+
+	// A broken file keeps the previous certificate
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	require.NoError(t, os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute)))
+	reloader.checkedAt = time.Now().Add(-reloadInterval)
+	kept, err := reloader.certificate()
+	require.NoError(t, err)
+	assert.Same(t, rotated, kept)
+}
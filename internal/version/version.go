@@ -0,0 +1,75 @@
+// Package version reports build information and the API versions served by this binary
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X github.com/pguia/iam/internal/version.Version=v1.2.0 -X github.com/pguia/iam/internal/version.GitCommit=$(git rev-parse HEAD)"
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+// APIVersion is the current, stable API package. It only receives backwards compatible
+// (additive) changes; breaking changes go to a new package served side by side with it.
+const APIVersion = "iam.v1"
+
+// SupportedAPIVersions lists every API package served by this binary, oldest first
+var SupportedAPIVersions = []string{APIVersion}
+
+// Info describes the running build
+type Info struct {
+	Version              string   `json:"version"`
+	GitCommit            string   `json:"git_commit"`
+	BuildDate            string   `json:"build_date"`
+	GoVersion            string   `json:"go_version"`
+	APIVersion           string   `json:"api_version"`
+	SupportedAPIVersions []string `json:"supported_api_versions"`
+}
+
+// Get returns the build information. When the commit was not set at link time it falls
+// back to the VCS revision recorded by the Go toolchain, if any.
+func Get() Info {
+	info := Info{
+		Version:              Version,
+		GitCommit:            GitCommit,
+		BuildDate:            BuildDate,
+		GoVersion:            runtime.Version(),
+		APIVersion:           APIVersion,
+		SupportedAPIVersions: append([]string(nil), SupportedAPIVersions...),
+	}
+
+	if info.GitCommit == "" || info.BuildDate == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					if info.GitCommit == "" {
+						info.GitCommit = setting.Value
+					}
+				case "vcs.time":
+					if info.BuildDate == "" {
+						info.BuildDate = setting.Value
+					}
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// Supports reports whether apiVersion (e.g. "iam.v1") is served by this binary
+func Supports(apiVersion string) bool {
+	for _, v := range SupportedAPIVersions {
+		if v == apiVersion {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	oldVersion, oldCommit, oldDate := Version, GitCommit, BuildDate
+	t.Cleanup(func() { Version, GitCommit, BuildDate = oldVersion, oldCommit, oldDate })
+
+	Version, GitCommit, BuildDate = "v1.2.0", "abc123", "2026-01-02T03:04:05Z"
+
+	info := Get()
+	assert.Equal(t, "v1.2.0", info.Version)
+	assert.Equal(t, "abc123", info.GitCommit)
+	assert.Equal(t, "2026-01-02T03:04:05Z", info.BuildDate)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, "iam.v1", info.APIVersion)
+	assert.Equal(t, []string{"iam.v1"}, info.SupportedAPIVersions)
+
+	// Callers cannot modify the supported versions through the returned slice
+	info.SupportedAPIVersions[0] = "iam.v9"
+	assert.Equal(t, "iam.v1", SupportedAPIVersions[0])
+}
+
+func TestSupports(t *testing.T) {
+	assert.True(t, Supports("iam.v1"))
+	assert.False(t, Supports("iam.v2"))
+	assert.False(t, Supports(""))
+}
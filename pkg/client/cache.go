@@ -0,0 +1,87 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize bounds the decision cache when no size is configured
+const DefaultCacheSize = 10000
+
+type cachedDecision struct {
+	decision   Decision
+	expiration time.Time
+}
+
+// DecisionCache is a small TTL cache of context-free CheckPermission decisions.
+// It is safe for concurrent use.
+type DecisionCache struct {
+	mu      sync.Mutex
+	entries map[decisionKey]cachedDecision
+	ttl     time.Duration
+	size    int
+}
+
+// decisionKey identifies a context-free check
+type decisionKey struct {
+	principal  string
+	resourceID string
+	permission string
+}
+
+// NewDecisionCache creates a cache holding up to size decisions for ttl
+func NewDecisionCache(ttl time.Duration, size int) *DecisionCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &DecisionCache{
+		entries: make(map[decisionKey]cachedDecision),
+		ttl:     ttl,
+		size:    size,
+	}
+}
+
+// Get returns the cached decision for req, if present and not expired
+func (c *DecisionCache) Get(req CheckRequest) (Decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[cacheKey(req)]
+	if !ok || time.Now().After(entry.expiration) {
+		return Decision{}, false
+	}
+	return entry.decision, true
+}
+
+// Set caches decision for req
+func (c *DecisionCache) Set(req CheckRequest, decision Decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		now := time.Now()
+		for key, entry := range c.entries {
+			if now.After(entry.expiration) {
+				delete(c.entries, key)
+			}
+		}
+		// Still full: start over rather than track recency
+		if len(c.entries) >= c.size {
+			c.entries = make(map[decisionKey]cachedDecision)
+		}
+	}
+
+	c.entries[cacheKey(req)] = cachedDecision{decision: decision, expiration: time.Now().Add(c.ttl)}
+}
+
+// Clear drops all cached decisions
+func (c *DecisionCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[decisionKey]cachedDecision)
+}
+
+// cacheKey ignores the context; only context-free checks are cached
+func cacheKey(req CheckRequest) decisionKey {
+	return decisionKey{principal: req.Principal, resourceID: req.ResourceID, permission: req.Permission}
+}
@@ -0,0 +1,309 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Default client settings
+const (
+	DefaultTimeout        = 2 * time.Second
+	DefaultMaxRetries     = 3
+	DefaultInitialBackoff = 50 * time.Millisecond
+	DefaultMaxBackoff     = 1 * time.Second
+)
+
+// Errors transports wrap around the failures they correspond to, so callers can test them with
+// errors.Is whatever the transport
+var (
+	// ErrUnavailable marks transient failures (service unreachable, overloaded or timed out),
+	// so the client knows an idempotent call may be retried
+	ErrUnavailable = errors.New("iam service unavailable")
+	// ErrPermissionDenied: the caller may not make the call (PERMISSION_DENIED)
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNotFound: the resource, policy or role the call names does not exist (NOT_FOUND)
+	ErrNotFound = errors.New("not found")
+	// ErrEtagMismatch: the etag of a write no longer matches, as the object changed since it was
+	// read (ABORTED); read it again and reapply the change
+	ErrEtagMismatch = errors.New("etag mismatch")
+)
+
+// Decision is the result of a permission check
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Consistency levels of a check; see CheckPermissionRequest.consistency
+const (
+	ConsistencyMinimizeLatency = "minimize_latency" // Default; may be answered from caches and replicas
+	ConsistencyFullyConsistent = "fully_consistent" // Sees every binding committed before the check
+)
+
+// CheckRequest is a single permission check
+type CheckRequest struct {
+	Principal   string
+	ResourceID  string
+	Permission  string
+	Context     map[string]string // Condition context; see CheckPermissionRequest.context
+	IDToken     string            // ID token the server resolves the principal from, instead of Principal
+	Consistency string            // Consistency level; empty is ConsistencyMinimizeLatency
+}
+
+// Transport performs the remote calls. It is implemented by grpctransport.Transport
+// and can be replaced in tests.
+type Transport interface {
+	CheckPermission(ctx context.Context, req CheckRequest) (Decision, error)
+	TestIamPermissions(ctx context.Context, principal, resourceID string, permissions []string, condContext map[string]string) ([]string, error)
+	GetEffectivePermissions(ctx context.Context, principal, resourceID string) (permissions, roles []string, err error)
+	Close() error
+}
+
+// Options configures a Client
+type Options struct {
+	Timeout        time.Duration    // Deadline applied to each attempt; 0 disables
+	MaxRetries     int              // Retries after the first attempt
+	InitialBackoff time.Duration    // Backoff before the first retry; doubled on each retry
+	MaxBackoff     time.Duration    // Upper bound for the backoff
+	Retryable      func(error) bool // Decides whether an error is retried; defaults to IsRetryable
+	CacheTTL       time.Duration    // Local decision cache TTL; 0 disables caching
+	CacheSize      int              // Maximum number of cached decisions
+	Hooks          Hooks
+}
+
+// CallEvent describes an attempt of a call, for logging and metrics
+type CallEvent struct {
+	Method   string // e.g. "CheckPermission"
+	Attempt  int    // 0 for the first attempt
+	Duration time.Duration
+	Err      error
+	Retrying bool // Whether the call is retried after this attempt
+}
+
+// Hooks are optional instrumentation callbacks. They run synchronously and must not block.
+type Hooks struct {
+	OnAttempt func(ctx context.Context, event CallEvent)
+}
+
+// Option configures a Client
+type Option func(*Options)
+
+// WithTimeout sets the deadline applied to each attempt
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithRetries sets the retry budget and backoff bounds
+func WithRetries(maxRetries int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(o *Options) {
+		o.MaxRetries = maxRetries
+		o.InitialBackoff = initialBackoff
+		o.MaxBackoff = maxBackoff
+	}
+}
+
+// WithRetryPolicy overrides which errors are retried
+func WithRetryPolicy(retryable func(error) bool) Option {
+	return func(o *Options) {
+		o.Retryable = retryable
+	}
+}
+
+// WithDecisionCache caches CheckPermission decisions locally for ttl.
+// Checks carrying a condition context are never cached.
+func WithDecisionCache(ttl time.Duration, size int) Option {
+	return func(o *Options) {
+		o.CacheTTL = ttl
+		o.CacheSize = size
+	}
+}
+
+// WithHooks installs instrumentation hooks, e.g. to log failures or record latencies and retries
+func WithHooks(hooks Hooks) Option {
+	return func(o *Options) {
+		o.Hooks = hooks
+	}
+}
+
+// Client is a typed IAM client
+type Client struct {
+	transport Transport
+	opts      Options
+	cache     *DecisionCache
+}
+
+// New creates a client on top of transport
+func New(transport Transport, opts ...Option) *Client {
+	o := Options{
+		Timeout:        DefaultTimeout,
+		MaxRetries:     DefaultMaxRetries,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Retryable:      IsRetryable,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Retryable == nil {
+		o.Retryable = IsRetryable
+	}
+
+	c := &Client{transport: transport, opts: o}
+	if o.CacheTTL > 0 {
+		c.cache = NewDecisionCache(o.CacheTTL, o.CacheSize)
+	}
+	return c
+}
+
+// Close closes the underlying transport
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+// CheckPermission checks whether principal holds permission on a resource
+func (c *Client) CheckPermission(ctx context.Context, principal, resourceID, permission string, condContext map[string]string) (Decision, error) {
+	return c.CheckPermissionWithConsistency(ctx, principal, resourceID, permission, ConsistencyMinimizeLatency, condContext)
+}
+
+// CheckPermissionWithConsistency checks whether principal holds permission on a resource at a
+// consistency level. ConsistencyFullyConsistent checks, e.g. right after granting a role, skip the
+// local decision cache and the server's caches and replicas; their decisions are still cached
+// for the checks that follow.
+func (c *Client) CheckPermissionWithConsistency(ctx context.Context, principal, resourceID, permission, consistency string, condContext map[string]string) (Decision, error) {
+	req := CheckRequest{Principal: principal, ResourceID: resourceID, Permission: permission, Context: condContext}
+	if consistency != ConsistencyMinimizeLatency {
+		req.Consistency = consistency
+	}
+
+	cacheable := c.cache != nil && len(condContext) == 0
+	if cacheable && req.Consistency != ConsistencyFullyConsistent {
+		if decision, ok := c.cache.Get(req); ok {
+			return decision, nil
+		}
+	}
+
+	var decision Decision
+	err := c.call(ctx, "CheckPermission", true, func(ctx context.Context) error {
+		var err error
+		decision, err = c.transport.CheckPermission(ctx, req)
+		return err
+	})
+	if err != nil {
+		return Decision{}, fmt.Errorf("check permission: %w", err)
+	}
+
+	if cacheable {
+		c.cache.Set(req, decision)
+	}
+	return decision, nil
+}
+
+// CheckPermissionWithToken checks whether the principal an ID token was issued to holds
+// permission on a resource. The server verifies the token and resolves the principal and its
+// groups from the claims. Decisions are never cached locally, as the token is not a stable key.
+func (c *Client) CheckPermissionWithToken(ctx context.Context, idToken, resourceID, permission string, condContext map[string]string) (Decision, error) {
+	req := CheckRequest{IDToken: idToken, ResourceID: resourceID, Permission: permission, Context: condContext}
+
+	var decision Decision
+	err := c.call(ctx, "CheckPermission", true, func(ctx context.Context) error {
+		var err error
+		decision, err = c.transport.CheckPermission(ctx, req)
+		return err
+	})
+	if err != nil {
+		return Decision{}, fmt.Errorf("check permission: %w", err)
+	}
+	return decision, nil
+}
+
+// Allowed is a convenience wrapper returning only whether the check passed
+func (c *Client) Allowed(ctx context.Context, principal, resourceID, permission string) (bool, error) {
+	decision, err := c.CheckPermission(ctx, principal, resourceID, permission, nil)
+	return decision.Allowed, err
+}
+
+// TestIamPermissions returns the subset of permissions the principal holds on a resource
+func (c *Client) TestIamPermissions(ctx context.Context, principal, resourceID string, permissions []string, condContext map[string]string) ([]string, error) {
+	var granted []string
+	err := c.call(ctx, "TestIamPermissions", true, func(ctx context.Context) error {
+		var err error
+		granted, err = c.transport.TestIamPermissions(ctx, principal, resourceID, permissions, condContext)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("test iam permissions: %w", err)
+	}
+	return granted, nil
+}
+
+// GetEffectivePermissions returns the permissions and roles a principal holds on a resource
+func (c *Client) GetEffectivePermissions(ctx context.Context, principal, resourceID string) ([]string, []string, error) {
+	var permissions, roles []string
+	err := c.call(ctx, "GetEffectivePermissions", true, func(ctx context.Context) error {
+		var err error
+		permissions, roles, err = c.transport.GetEffectivePermissions(ctx, principal, resourceID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("get effective permissions: %w", err)
+	}
+	return permissions, roles, nil
+}
+
+// InvalidateCache drops all locally cached decisions
+func (c *Client) InvalidateCache() {
+	if c.cache != nil {
+		c.cache.Clear()
+	}
+}
+
+// call runs fn with a per-attempt deadline. Retryable errors of idempotent calls are retried with
+// exponential backoff; other calls are attempted once, as a lost response does not mean the
+// call had no effect.
+func (c *Client) call(ctx context.Context, method string, idempotent bool, fn func(context.Context) error) error {
+	backoff := c.opts.InitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := c.attempt(ctx, fn)
+		retrying := err != nil && idempotent && attempt < c.opts.MaxRetries && c.opts.Retryable(err) && ctx.Err() == nil
+		if c.opts.Hooks.OnAttempt != nil {
+			c.opts.Hooks.OnAttempt(ctx, CallEvent{Method: method, Attempt: attempt, Duration: time.Since(start), Err: err, Retrying: retrying})
+		}
+		if !retrying {
+			return err
+		}
+
+		// Full jitter keeps many clients from retrying in lockstep
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, fn func(context.Context) error) error {
+	if c.opts.Timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// IsRetryable reports whether err is transient and the call may be retried
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, context.DeadlineExceeded)
+}
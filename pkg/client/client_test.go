@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport fails the first failures calls with err, then answers with decision
+type fakeTransport struct {
+	calls    atomic.Int32
+	last     CheckRequest
+	failures int32
+	err      error
+	decision Decision
+	delay    time.Duration
+}
+
+func (f *fakeTransport) CheckPermission(ctx context.Context, req CheckRequest) (Decision, error) {
+	n := f.calls.Add(1)
+	f.last = req
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return Decision{}, ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+	if n <= f.failures {
+		return Decision{}, f.err
+	}
+	return f.decision, nil
+}
+
+func (f *fakeTransport) TestIamPermissions(ctx context.Context, principal, resourceID string, permissions []string, condContext map[string]string) ([]string, error) {
+	if n := f.calls.Add(1); n <= f.failures {
+		return nil, f.err
+	}
+	return permissions[:1], nil
+}
+
+func (f *fakeTransport) GetEffectivePermissions(ctx context.Context, principal, resourceID string) ([]string, []string, error) {
+	if n := f.calls.Add(1); n <= f.failures {
+		return nil, nil, f.err
+	}
+	return []string{"storage.buckets.get"}, []string{"roles/viewer"}, nil
+}
+
+func (f *fakeTransport) Close() error { return nil }
+
+func fastRetries() Option {
+	return WithRetries(3, time.Millisecond, 2*time.Millisecond)
+}
+
+func TestClient_CheckPermission_RetriesTransientErrors(t *testing.T) {
+	transport := &fakeTransport{failures: 2, err: ErrUnavailable, decision: Decision{Allowed: true}}
+	c := New(transport, fastRetries())
+
+	decision, err := c.CheckPermission(context.Background(), User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int32(3), transport.calls.Load())
+}
+
+func TestClient_CheckPermission_GivesUpAfterMaxRetries(t *testing.T) {
+	transport := &fakeTransport{failures: 10, err: ErrUnavailable}
+	c := New(transport, fastRetries())
+
+	_, err := c.CheckPermission(context.Background(), User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int32(4), transport.calls.Load())
+}
+
+func TestClient_CheckPermission_DoesNotRetryPermanentErrors(t *testing.T) {
+	transport := &fakeTransport{failures: 10, err: errors.New("invalid argument")}
+	c := New(transport, fastRetries())
+
+	_, err := c.CheckPermission(context.Background(), User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), transport.calls.Load())
+}
+
+func TestClient_CheckPermission_AppliesTimeoutPerAttempt(t *testing.T) {
+	transport := &fakeTransport{delay: time.Second}
+	c := New(transport, WithTimeout(5*time.Millisecond), WithRetries(1, time.Millisecond, time.Millisecond))
+
+	start := time.Now()
+	_, err := c.CheckPermission(context.Background(), User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(2), transport.calls.Load())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestClient_CheckPermission_StopsOnCanceledContext(t *testing.T) {
+	transport := &fakeTransport{failures: 10, err: ErrUnavailable}
+	c := New(transport, WithRetries(5, time.Second, time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.CheckPermission(ctx, User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), transport.calls.Load())
+}
+
+func TestClient_DecisionCache(t *testing.T) {
+	transport := &fakeTransport{decision: Decision{Allowed: true}}
+	c := New(transport, WithDecisionCache(time.Minute, 10))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, err := c.Allowed(ctx, User("alice@example.com"), "res-1", "storage.buckets.get")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, int32(1), transport.calls.Load())
+
+	// Conditional checks bypass the cache
+	_, err := c.CheckPermission(ctx, User("alice@example.com"), "res-1", "storage.buckets.get", map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), transport.calls.Load())
+
+	c.InvalidateCache()
+	_, err = c.Allowed(ctx, User("alice@example.com"), "res-1", "storage.buckets.get")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), transport.calls.Load())
+}
+
+func TestClient_CheckPermissionWithConsistency(t *testing.T) {
+	transport := &fakeTransport{decision: Decision{Allowed: true}}
+	c := New(transport, WithDecisionCache(time.Minute, 10))
+	ctx := context.Background()
+
+	_, err := c.CheckPermission(ctx, User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.Empty(t, transport.last.Consistency)
+
+	// Fully consistent checks skip the cache, and refresh it
+	transport.decision = Decision{Allowed: false, Reason: "revoked"}
+	decision, err := c.CheckPermissionWithConsistency(ctx, User("alice@example.com"), "res-1", "storage.buckets.get", ConsistencyFullyConsistent, nil)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, ConsistencyFullyConsistent, transport.last.Consistency)
+	assert.Equal(t, int32(2), transport.calls.Load())
+
+	decision, err = c.CheckPermission(ctx, User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, int32(2), transport.calls.Load())
+}
+
+func TestClient_DecisionCache_Expires(t *testing.T) {
+	transport := &fakeTransport{decision: Decision{Allowed: true}}
+	c := New(transport, WithDecisionCache(time.Millisecond, 10))
+	ctx := context.Background()
+
+	_, err := c.Allowed(ctx, User("alice@example.com"), "res-1", "storage.buckets.get")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = c.Allowed(ctx, User("alice@example.com"), "res-1", "storage.buckets.get")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), transport.calls.Load())
+}
+
+func TestClient_TestIamPermissionsAndEffectivePermissions(t *testing.T) {
+	transport := &fakeTransport{failures: 1, err: ErrUnavailable}
+	c := New(transport, fastRetries())
+	ctx := context.Background()
+
+	granted, err := c.TestIamPermissions(ctx, User("alice@example.com"), "res-1", []string{"a", "b"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, granted)
+
+	permissions, roles, err := c.GetEffectivePermissions(ctx, User("alice@example.com"), "res-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"storage.buckets.get"}, permissions)
+	assert.Equal(t, []string{"roles/viewer"}, roles)
+}
+
+func TestParsePrincipal(t *testing.T) {
+	principalType, id, err := ParsePrincipal(ServiceAccount("ci@example.iam"))
+	require.NoError(t, err)
+	assert.Equal(t, PrincipalServiceAccount, principalType)
+	assert.Equal(t, "ci@example.iam", id)
+
+	for _, invalid := range []string{"alice@example.com", "user:", "robot:r2d2"} {
+		_, _, err := ParsePrincipal(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClient_CheckPermissionWithToken(t *testing.T) {
+	transport := &fakeTransport{decision: Decision{Allowed: true}}
+	c := New(transport, fastRetries(), WithDecisionCache(time.Minute, 10))
+
+	for i := 0; i < 2; i++ {
+		decision, err := c.CheckPermissionWithToken(context.Background(), "eyJhbGciOi...", "res-1", "storage.buckets.get", nil)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	}
+	assert.Equal(t, "eyJhbGciOi...", transport.last.IDToken)
+	assert.Empty(t, transport.last.Principal)
+	// Token checks bypass the local decision cache
+	assert.Equal(t, int32(2), transport.calls.Load())
+}
+
+// fakePolicyTransport fails the first failures policy calls with err
+type fakePolicyTransport struct {
+	fakeTransport
+	policy Policy
+}
+
+func (f *fakePolicyTransport) GetPolicy(ctx context.Context, resourceID string) (Policy, error) {
+	if n := f.calls.Add(1); n <= f.failures {
+		return Policy{}, f.err
+	}
+	return f.policy, nil
+}
+
+func (f *fakePolicyTransport) SetPolicy(ctx context.Context, resourceID string, bindings []Binding, etag string) (Policy, error) {
+	if n := f.calls.Add(1); n <= f.failures {
+		return Policy{}, f.err
+	}
+	f.policy = Policy{ResourceID: resourceID, Bindings: bindings, ETag: etag + "-next"}
+	return f.policy, nil
+}
+
+func TestClient_Policies_RetryOnlyIdempotentCalls(t *testing.T) {
+	transport := &fakePolicyTransport{fakeTransport: fakeTransport{failures: 1, err: ErrUnavailable}, policy: Policy{ResourceID: "res-1", ETag: "e1"}}
+	c := New(transport, fastRetries())
+	ctx := context.Background()
+
+	policy, err := c.GetPolicy(ctx, "res-1")
+	require.NoError(t, err)
+	assert.Equal(t, "e1", policy.ETag)
+	assert.Equal(t, int32(2), transport.calls.Load())
+
+	// A write whose response is lost may have been applied, so it is not retried
+	transport.calls.Store(0)
+	bindings := []Binding{{RoleID: "role-1", Members: []string{User("alice@example.com")}}}
+	_, err = c.SetPolicy(ctx, "res-1", bindings, policy.ETag)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int32(1), transport.calls.Load())
+
+	policy, err = c.SetPolicy(ctx, "res-1", bindings, policy.ETag)
+	require.NoError(t, err)
+	assert.Equal(t, bindings, policy.Bindings)
+
+	transport.calls.Store(0)
+	transport.err = ErrEtagMismatch
+	_, err = c.SetPolicy(ctx, "res-1", bindings, "stale")
+	assert.ErrorIs(t, err, ErrEtagMismatch)
+}
+
+func TestClient_Policies_Unsupported(t *testing.T) {
+	c := New(&fakeTransport{})
+	_, err := c.GetPolicy(context.Background(), "res-1")
+	assert.ErrorIs(t, err, ErrPoliciesUnsupported)
+	_, err = c.SetPolicy(context.Background(), "res-1", nil, "")
+	assert.ErrorIs(t, err, ErrPoliciesUnsupported)
+}
+
+func TestClient_CallHooks(t *testing.T) {
+	var calls []CallEvent
+	transport := &fakeTransport{failures: 2, err: ErrUnavailable, decision: Decision{Allowed: true}}
+	c := New(transport, fastRetries(), WithHooks(Hooks{
+		OnAttempt: func(ctx context.Context, event CallEvent) { calls = append(calls, event) },
+	}))
+
+	_, err := c.CheckPermission(context.Background(), User("alice@example.com"), "res-1", "storage.buckets.get", nil)
+	require.NoError(t, err)
+	require.Len(t, calls, 3)
+	for i, event := range calls {
+		assert.Equal(t, "CheckPermission", event.Method)
+		assert.Equal(t, i, event.Attempt)
+	}
+	assert.ErrorIs(t, calls[0].Err, ErrUnavailable)
+	assert.True(t, calls[1].Retrying)
+	assert.NoError(t, calls[2].Err)
+	assert.False(t, calls[2].Retrying)
+
+	// Permanent errors are reported once, without retrying
+	calls = nil
+	transport.calls.Store(0)
+	transport.err = ErrNotFound
+	_, err = c.CheckPermission(context.Background(), User("alice@example.com"), "res-2", "storage.buckets.get", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.Len(t, calls, 1)
+	assert.False(t, calls[0].Retrying)
+}
+
+func TestOutgoingMetadata(t *testing.T) {
+	assert.Empty(t, OutgoingMetadata(context.Background()))
+
+	parent := WithCaller(context.Background(), User("alice@example.com"))
+	ctx := WithClientIP(WithRequestID(parent, "req-42"), "203.0.113.7")
+	assert.Equal(t, map[string]string{
+		MetadataCaller:       "user:alice@example.com",
+		MetadataRequestID:    "req-42",
+		MetadataForwardedFor: "203.0.113.7",
+	}, OutgoingMetadata(ctx))
+	// Deriving a context leaves the metadata of its parent unchanged
+	assert.Equal(t, map[string]string{MetadataCaller: "user:alice@example.com"}, OutgoingMetadata(parent))
+}
@@ -0,0 +1,23 @@
+// Package client is the supported Go SDK for the IAM service.
+//
+// A Client wraps a Transport (normally the gRPC transport in package
+// grpctransport) and adds per-call deadlines, retries with jittered
+// exponential backoff and optional local caching of decisions:
+//
+//	creds, err := grpctransport.WithTLS("ca.pem", "client.pem", "client-key.pem")
+//	if err != nil {
+//		return err
+//	}
+//	transport, err := grpctransport.Dial("iam.internal:8081", creds)
+//	if err != nil {
+//		return err
+//	}
+//	iam := client.New(transport, client.WithDecisionCache(30*time.Second, 10000))
+//	defer iam.Close()
+//
+//	decision, err := iam.CheckPermission(ctx, client.User("alice@example.com"), projectID, "projects.update", nil)
+//
+// Failures wrap ErrPermissionDenied, ErrNotFound, ErrEtagMismatch or ErrUnavailable when they
+// are one of those, whatever the transport; test them with errors.Is. Only idempotent calls are
+// retried, so SetPolicy is attempted once. WithHooks reports each attempt for logging and metrics.
+package client
@@ -0,0 +1,196 @@
+// Package grpctransport implements client.Transport over gRPC.
+//
+// It depends on the generated iam/v1 stubs (make proto) and on google.golang.org/grpc,
+// which is why it is excluded from ./... in go.mod like the examples.
+package grpctransport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	iamv1 "github.com/pguia/iam/api/proto/iam/v1"
+	"github.com/pguia/iam/pkg/client"
+)
+
+// Transport calls the IAM service over a gRPC connection
+type Transport struct {
+	conn *grpc.ClientConn
+	iam  iamv1.IAMServiceClient
+}
+
+// Dial connects to the IAM service at addr. Without dial options the connection is
+// insecure (plaintext); pass WithTLS, or grpc.WithTransportCredentials, in production.
+func Dial(addr string, opts ...grpc.DialOption) (*Transport, error) {
+	defaults := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+
+	conn, err := grpc.NewClient(addr, append(defaults, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IAM service: %w", err)
+	}
+	return New(conn), nil
+}
+
+// WithTLS returns a dial option connecting over TLS. The server certificate is verified against
+// the PEM certificates in caFile, or the system roots when caFile is empty. When certFile and
+// keyFile are set, the client presents that certificate, as servers requiring mTLS expect.
+func WithTLS(caFile, certFile, keyFile string) (grpc.DialOption, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca file %s contains no certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
+}
+
+// New wraps an existing connection; Close closes it
+func New(conn *grpc.ClientConn) *Transport {
+	return &Transport{conn: conn, iam: iamv1.NewIAMServiceClient(conn)}
+}
+
+// Close closes the connection
+func (t *Transport) Close() error {
+	return t.conn.Close()
+}
+
+// CheckPermission implements client.Transport
+func (t *Transport) CheckPermission(ctx context.Context, req client.CheckRequest) (client.Decision, error) {
+	resp, err := t.iam.CheckPermission(outgoing(ctx), &iamv1.CheckPermissionRequest{
+		Principal:   req.Principal,
+		ResourceId:  req.ResourceID,
+		Permission:  req.Permission,
+		Context:     req.Context,
+		IdToken:     req.IDToken,
+		Consistency: req.Consistency,
+	})
+	if err != nil {
+		return client.Decision{}, wrapError(err)
+	}
+	return client.Decision{Allowed: resp.Allowed, Reason: resp.Reason}, nil
+}
+
+// TestIamPermissions implements client.Transport
+func (t *Transport) TestIamPermissions(ctx context.Context, principal, resourceID string, permissions []string, condContext map[string]string) ([]string, error) {
+	resp, err := t.iam.TestIamPermissions(outgoing(ctx), &iamv1.TestIamPermissionsRequest{
+		Principal:   principal,
+		ResourceId:  resourceID,
+		Permissions: permissions,
+		Context:     condContext,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return resp.Permissions, nil
+}
+
+// GetEffectivePermissions implements client.Transport
+func (t *Transport) GetEffectivePermissions(ctx context.Context, principal, resourceID string) ([]string, []string, error) {
+	resp, err := t.iam.GetEffectivePermissions(outgoing(ctx), &iamv1.GetEffectivePermissionsRequest{
+		Principal:  principal,
+		ResourceId: resourceID,
+	})
+	if err != nil {
+		return nil, nil, wrapError(err)
+	}
+	return resp.Permissions, resp.Roles, nil
+}
+
+// GetPolicy implements client.PolicyTransport
+func (t *Transport) GetPolicy(ctx context.Context, resourceID string) (client.Policy, error) {
+	resp, err := t.iam.GetPolicy(outgoing(ctx), &iamv1.GetPolicyRequest{ResourceId: resourceID})
+	if err != nil {
+		return client.Policy{}, wrapError(err)
+	}
+	return fromPolicy(resp.Policy), nil
+}
+
+// SetPolicy implements client.PolicyTransport
+func (t *Transport) SetPolicy(ctx context.Context, resourceID string, bindings []client.Binding, etag string) (client.Policy, error) {
+	req := &iamv1.SetPolicyRequest{ResourceId: resourceID, Etag: etag}
+	for _, binding := range bindings {
+		b := &iamv1.Binding{RoleId: binding.RoleID, Members: binding.Members}
+		if c := binding.Condition; c != nil {
+			b.Condition = &iamv1.Condition{Title: c.Title, Description: c.Description, Expression: c.Expression}
+		}
+		req.Bindings = append(req.Bindings, b)
+	}
+
+	resp, err := t.iam.SetPolicy(outgoing(ctx), req)
+	if err != nil {
+		return client.Policy{}, wrapError(err)
+	}
+	return fromPolicy(resp.Policy), nil
+}
+
+// fromPolicy converts a policy of the API to a client.Policy
+func fromPolicy(p *iamv1.Policy) client.Policy {
+	policy := client.Policy{ResourceID: p.GetResourceId(), ETag: p.GetEtag(), Version: int(p.GetVersion())}
+	for _, b := range p.GetBindings() {
+		binding := client.Binding{RoleID: b.RoleId, Members: b.Members}
+		if c := b.Condition; c != nil {
+			binding.Condition = &client.Condition{Title: c.Title, Description: c.Description, Expression: c.Expression}
+		}
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+	return policy
+}
+
+// outgoing attaches the request metadata of ctx (client.WithCaller, ...) to the call
+func outgoing(ctx context.Context) context.Context {
+	for key, value := range client.OutgoingMetadata(ctx) {
+		ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+	}
+	return ctx
+}
+
+// wrapError wraps gRPC failures in the client error they correspond to, keeping the status for
+// status.FromError. Transient failures are marked with client.ErrUnavailable so they are retried.
+func wrapError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %w", client.ErrUnavailable, err)
+	case codes.PermissionDenied:
+		return fmt.Errorf("%w: %w", client.ErrPermissionDenied, err)
+	case codes.NotFound:
+		return fmt.Errorf("%w: %w", client.ErrNotFound, err)
+	case codes.Aborted:
+		return fmt.Errorf("%w: %w", client.ErrEtagMismatch, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import "context"
+
+// Request metadata keys identifying who a call is made for and where it comes from. Transports
+// send the values set on the context of a call with WithCaller, WithRequestID and WithClientIP.
+const (
+	MetadataCaller       = "x-iam-caller"    // End-user the call is made on behalf of
+	MetadataRequestID    = "x-request-id"    // Correlates the call with the request that caused it
+	MetadataForwardedFor = "x-forwarded-for" // Address of the originating client
+)
+
+type metadataKey struct{}
+
+// WithCaller returns a context whose calls are made on behalf of caller, e.g. the end-user of a
+// portal granting a role, so that the server records them as the author. The server only accepts
+// it from services listed in its server.trusted_caller_services.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return withMetadata(ctx, MetadataCaller, caller)
+}
+
+// WithRequestID returns a context whose calls carry requestID, recorded by the server in decision
+// logs and policy revisions
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return withMetadata(ctx, MetadataRequestID, requestID)
+}
+
+// WithClientIP returns a context whose calls carry the address of the originating client, which
+// the conditions of checks without a request.ip context key see
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	return withMetadata(ctx, MetadataForwardedFor, clientIP)
+}
+
+// OutgoingMetadata returns the request metadata set on ctx, by key
+func OutgoingMetadata(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// withMetadata returns a context carrying the metadata of ctx with key set to value
+func withMetadata(ctx context.Context, key, value string) context.Context {
+	md := make(map[string]string, len(OutgoingMetadata(ctx))+1)
+	for k, v := range OutgoingMetadata(ctx) {
+		md[k] = v
+	}
+	md[key] = value
+	return context.WithValue(ctx, metadataKey{}, md)
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPoliciesUnsupported is returned by the policy calls of a client whose transport does not
+// implement PolicyTransport
+var ErrPoliciesUnsupported = errors.New("transport does not support policies")
+
+// Policy is the policy of a resource
+type Policy struct {
+	ResourceID string
+	Bindings   []Binding
+	ETag       string // Pass to SetPolicy to fail with ErrEtagMismatch if the policy changed since
+	Version    int
+}
+
+// Binding grants a role to members, optionally under a condition
+type Binding struct {
+	RoleID    string
+	Members   []string // e.g. User("alice@example.com")
+	Condition *Condition
+}
+
+// Condition restricts a binding; Expression is a CEL expression
+type Condition struct {
+	Title       string
+	Description string
+	Expression  string
+}
+
+// PolicyTransport is implemented by transports that read and write policies, such as
+// grpctransport.Transport
+type PolicyTransport interface {
+	GetPolicy(ctx context.Context, resourceID string) (Policy, error)
+	SetPolicy(ctx context.Context, resourceID string, bindings []Binding, etag string) (Policy, error)
+}
+
+// GetPolicy returns the policy of a resource
+func (c *Client) GetPolicy(ctx context.Context, resourceID string) (Policy, error) {
+	transport, ok := c.transport.(PolicyTransport)
+	if !ok {
+		return Policy{}, ErrPoliciesUnsupported
+	}
+
+	var policy Policy
+	err := c.call(ctx, "GetPolicy", true, func(ctx context.Context) error {
+		var err error
+		policy, err = transport.GetPolicy(ctx, resourceID)
+		return err
+	})
+	if err != nil {
+		return Policy{}, fmt.Errorf("get policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetPolicy replaces the bindings of a resource's policy. A non-empty etag must match the
+// current policy, or the call fails with ErrEtagMismatch. SetPolicy is not retried: after a lost
+// response the policy may already be set, and a retry would fail on the etag it changed.
+func (c *Client) SetPolicy(ctx context.Context, resourceID string, bindings []Binding, etag string) (Policy, error) {
+	transport, ok := c.transport.(PolicyTransport)
+	if !ok {
+		return Policy{}, ErrPoliciesUnsupported
+	}
+
+	var policy Policy
+	err := c.call(ctx, "SetPolicy", false, func(ctx context.Context) error {
+		var err error
+		policy, err = transport.SetPolicy(ctx, resourceID, bindings, etag)
+		return err
+	})
+	if err != nil {
+		return Policy{}, fmt.Errorf("set policy: %w", err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Principal types understood by the IAM service
+const (
+	PrincipalUser           = "user"
+	PrincipalGroup          = "group"
+	PrincipalServiceAccount = "serviceAccount"
+	PrincipalDomain         = "domain"
+)
+
+// User formats a user principal, e.g. "user:alice@example.com"
+func User(email string) string {
+	return PrincipalUser + ":" + email
+}
+
+// Group formats a group principal, e.g. "group:admins@example.com"
+func Group(email string) string {
+	return PrincipalGroup + ":" + email
+}
+
+// ServiceAccount formats a service account principal
+func ServiceAccount(email string) string {
+	return PrincipalServiceAccount + ":" + email
+}
+
+// Domain formats a domain principal matching every user of the domain, e.g. "domain:example.com"
+func Domain(domain string) string {
+	return PrincipalDomain + ":" + domain
+}
+
+// ParsePrincipal splits a principal into its type and identifier
+func ParsePrincipal(principal string) (principalType, id string, err error) {
+	principalType, id, ok := strings.Cut(principal, ":")
+	if !ok || id == "" {
+		return "", "", fmt.Errorf("invalid principal %q: expected type:identifier", principal)
+	}
+
+	switch principalType {
+	case PrincipalUser, PrincipalGroup, PrincipalServiceAccount, PrincipalDomain:
+		return principalType, id, nil
+	default:
+		return "", "", fmt.Errorf("invalid principal %q: unknown type %q", principal, principalType)
+	}
+}
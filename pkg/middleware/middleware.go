@@ -0,0 +1,209 @@
+// Package middleware provides net/http middleware that authorizes requests against the IAM service.
+//
+// Authentication is left to the application: an earlier middleware stores the caller's
+// principal with WithPrincipal, and RequirePermission checks it against a resource:
+//
+//	authz := middleware.New(iamClient, middleware.WithFailOpen(false))
+//	mux.Handle("GET /buckets/{id}", authz.RequirePermission("storage.buckets.get", middleware.PathValue("id"))(handler))
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pguia/iam/pkg/client"
+)
+
+// Default middleware settings
+const (
+	DefaultCacheTTL  = 5 * time.Second
+	DefaultCacheSize = 10000
+)
+
+// Checker performs permission checks; *client.Client implements it
+type Checker interface {
+	CheckPermission(ctx context.Context, principal, resourceID, permission string, condContext map[string]string) (client.Decision, error)
+}
+
+// ResourceFunc extracts the resource a request targets
+type ResourceFunc func(r *http.Request) string
+
+// PrincipalFunc extracts the authenticated principal of a request
+type PrincipalFunc func(r *http.Request) (string, bool)
+
+// Event describes a single authorization decision, for logging and metrics
+type Event struct {
+	Principal  string
+	ResourceID string
+	Permission string
+	Allowed    bool
+	Reason     string
+	Cached     bool          // Served from the local decision cache
+	FailedOpen bool          // IAM was unreachable and the request was let through
+	Err        error         // Error returned by the check, if any
+	Duration   time.Duration // Time spent deciding, including the remote call
+}
+
+// Hooks are optional instrumentation callbacks
+type Hooks struct {
+	OnDecision func(r *http.Request, event Event)
+}
+
+// Options configures a Middleware
+type Options struct {
+	CacheTTL  time.Duration // Local decision cache TTL; 0 disables caching
+	CacheSize int           // Maximum number of cached decisions
+	FailOpen  bool          // Allow requests when IAM is unreachable instead of answering 503
+	Principal PrincipalFunc // Defaults to PrincipalFromRequest
+	Hooks     Hooks
+	Logger    *slog.Logger // Defaults to slog.Default()
+}
+
+// Option configures a Middleware
+type Option func(*Options)
+
+// WithCache sets the local decision cache TTL and size; a zero TTL disables the cache
+func WithCache(ttl time.Duration, size int) Option {
+	return func(o *Options) {
+		o.CacheTTL = ttl
+		o.CacheSize = size
+	}
+}
+
+// WithFailOpen lets requests through when IAM is unreachable.
+// Only use it for endpoints where availability matters more than enforcement.
+func WithFailOpen(failOpen bool) Option {
+	return func(o *Options) {
+		o.FailOpen = failOpen
+	}
+}
+
+// WithPrincipalFunc overrides how the principal is read from a request
+func WithPrincipalFunc(fn PrincipalFunc) Option {
+	return func(o *Options) {
+		o.Principal = fn
+	}
+}
+
+// WithHooks installs instrumentation hooks
+func WithHooks(hooks Hooks) Option {
+	return func(o *Options) {
+		o.Hooks = hooks
+	}
+}
+
+// WithLogger sets the logger used to report fail-open decisions
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// Middleware authorizes HTTP requests
+type Middleware struct {
+	checker Checker
+	opts    Options
+	cache   *client.DecisionCache
+}
+
+// New creates a Middleware. Decisions are cached for DefaultCacheTTL unless
+// configured otherwise, and requests fail closed when IAM is unreachable.
+func New(checker Checker, opts ...Option) *Middleware {
+	o := Options{
+		CacheTTL:  DefaultCacheTTL,
+		CacheSize: DefaultCacheSize,
+		Principal: PrincipalFromRequest,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Principal == nil {
+		o.Principal = PrincipalFromRequest
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+
+	m := &Middleware{checker: checker, opts: o}
+	if o.CacheTTL > 0 {
+		m.cache = client.NewDecisionCache(o.CacheTTL, o.CacheSize)
+	}
+	return m
+}
+
+// RequirePermission returns a middleware that only calls next when the request's
+// principal holds permission on the resource returned by resource
+func (m *Middleware) RequirePermission(permission string, resource ResourceFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := m.opts.Principal(r)
+			if !ok || principal == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			resourceID := resource(r)
+			if resourceID == "" {
+				http.Error(w, "Bad request: missing resource", http.StatusBadRequest)
+				return
+			}
+
+			event := m.decide(r.Context(), principal, resourceID, permission)
+			if m.opts.Hooks.OnDecision != nil {
+				m.opts.Hooks.OnDecision(r, event)
+			}
+
+			switch {
+			case event.Allowed:
+				next.ServeHTTP(w, r)
+			case event.Err != nil && client.IsRetryable(event.Err):
+				http.Error(w, "Authorization service unavailable", http.StatusServiceUnavailable)
+			case event.Err != nil:
+				http.Error(w, "Authorization check failed", http.StatusInternalServerError)
+			default:
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			}
+		})
+	}
+}
+
+// Invalidate drops all locally cached decisions, e.g. after changing a policy
+func (m *Middleware) Invalidate() {
+	if m.cache != nil {
+		m.cache.Clear()
+	}
+}
+
+func (m *Middleware) decide(ctx context.Context, principal, resourceID, permission string) Event {
+	start := time.Now()
+	event := Event{Principal: principal, ResourceID: resourceID, Permission: permission}
+	req := client.CheckRequest{Principal: principal, ResourceID: resourceID, Permission: permission}
+
+	if m.cache != nil {
+		if decision, ok := m.cache.Get(req); ok {
+			event.Allowed, event.Reason, event.Cached = decision.Allowed, decision.Reason, true
+			event.Duration = time.Since(start)
+			return event
+		}
+	}
+
+	decision, err := m.checker.CheckPermission(ctx, principal, resourceID, permission, nil)
+	event.Duration = time.Since(start)
+	if err != nil {
+		event.Err = err
+		if m.opts.FailOpen && client.IsRetryable(err) {
+			m.opts.Logger.WarnContext(ctx, "IAM unreachable, failing open",
+				"principal", principal, "permission", permission, "resource_id", resourceID, "error", err)
+			event.Allowed, event.FailedOpen = true, true
+		}
+		return event
+	}
+
+	if m.cache != nil {
+		m.cache.Set(req, decision)
+	}
+	event.Allowed, event.Reason = decision.Allowed, decision.Reason
+	return event
+}
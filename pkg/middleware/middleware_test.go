@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pguia/iam/pkg/client"
+)
+
+type fakeChecker struct {
+	calls   int
+	allowed map[string]bool // principal -> allowed
+	err     error
+}
+
+func (f *fakeChecker) CheckPermission(ctx context.Context, principal, resourceID, permission string, condContext map[string]string) (client.Decision, error) {
+	f.calls++
+	if f.err != nil {
+		return client.Decision{}, f.err
+	}
+	return client.Decision{Allowed: f.allowed[principal]}, nil
+}
+
+func serve(t *testing.T, m *Middleware, principal string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	handler := m.RequirePermission("storage.buckets.get", PathValue("id"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux := http.NewServeMux()
+	mux.Handle("GET /buckets/{id}", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/buckets/bucket-1", nil)
+	if principal != "" {
+		req = req.WithContext(WithPrincipal(req.Context(), principal))
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequirePermission(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{"user:alice@example.com": true}}
+	m := New(checker)
+
+	assert.Equal(t, http.StatusOK, serve(t, m, "user:alice@example.com").Code)
+	assert.Equal(t, http.StatusForbidden, serve(t, m, "user:bob@example.com").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(t, m, "").Code)
+}
+
+func TestRequirePermission_CachesDecisions(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{"user:alice@example.com": true}}
+	var events []Event
+	m := New(checker, WithHooks(Hooks{OnDecision: func(r *http.Request, event Event) {
+		events = append(events, event)
+	}}))
+
+	serve(t, m, "user:alice@example.com")
+	serve(t, m, "user:alice@example.com")
+	assert.Equal(t, 1, checker.calls)
+	require.Len(t, events, 2)
+	assert.False(t, events[0].Cached)
+	assert.True(t, events[1].Cached)
+	assert.Equal(t, "bucket-1", events[1].ResourceID)
+
+	m.Invalidate()
+	serve(t, m, "user:alice@example.com")
+	assert.Equal(t, 2, checker.calls)
+
+	uncached := New(checker, WithCache(0, 0))
+	serve(t, uncached, "user:alice@example.com")
+	serve(t, uncached, "user:alice@example.com")
+	assert.Equal(t, 4, checker.calls)
+}
+
+func TestRequirePermission_Unavailable(t *testing.T) {
+	checker := &fakeChecker{err: client.ErrUnavailable}
+
+	closed := New(checker)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(t, closed, "user:alice@example.com").Code)
+
+	var event Event
+	open := New(checker, WithFailOpen(true), WithHooks(Hooks{OnDecision: func(r *http.Request, e Event) {
+		event = e
+	}}))
+	assert.Equal(t, http.StatusOK, serve(t, open, "user:alice@example.com").Code)
+	assert.True(t, event.FailedOpen)
+	assert.ErrorIs(t, event.Err, client.ErrUnavailable)
+
+	// Failures are not cached: the next request asks IAM again
+	calls := checker.calls
+	serve(t, open, "user:alice@example.com")
+	assert.Equal(t, calls+1, checker.calls)
+}
+
+func TestRequirePermission_PermanentErrorFailsClosed(t *testing.T) {
+	checker := &fakeChecker{err: errors.New("invalid resource")}
+	m := New(checker, WithFailOpen(true))
+
+	assert.Equal(t, http.StatusInternalServerError, serve(t, m, "user:alice@example.com").Code)
+}
+
+func TestRequirePermission_CustomPrincipalFunc(t *testing.T) {
+	checker := &fakeChecker{allowed: map[string]bool{"serviceAccount:ci@example.iam": true}}
+	m := New(checker, WithCache(time.Second, 10), WithPrincipalFunc(func(r *http.Request) (string, bool) {
+		return "serviceAccount:ci@example.iam", true
+	}))
+
+	assert.Equal(t, http.StatusOK, serve(t, m, "").Code)
+}
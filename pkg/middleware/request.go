@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated principal, e.g. "user:alice@example.com"
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// PrincipalFromRequest returns the principal stored in the request context
+func PrincipalFromRequest(r *http.Request) (string, bool) {
+	return PrincipalFromContext(r.Context())
+}
+
+// StaticResource always targets the same resource
+func StaticResource(resourceID string) ResourceFunc {
+	return func(*http.Request) string {
+		return resourceID
+	}
+}
+
+// PathValue targets the resource named by a path wildcard, e.g. PathValue("id") for "/buckets/{id}"
+func PathValue(name string) ResourceFunc {
+	return func(r *http.Request) string {
+		return r.PathValue(name)
+	}
+}